@@ -7,8 +7,9 @@
 // Architecture:
 //
 //	Node.js (DNS.js) --[Unix Socket]--> Go DNS (this binary)
-//	  POST /config  → full zone configuration sync
-//	  GET  /health  → liveness check
+//	  POST /config   → full zone configuration sync
+//	  POST /firewall → shared firewall policy
+//	  GET  /health   → liveness check
 //
 // The DNS server listens on UDP and TCP port 53 (or fallback ports) and
 // serves authoritative responses for configured zones.
@@ -34,6 +35,7 @@ import (
 
 	"odac/internal/dns/api"
 	"odac/internal/dns/resolver"
+	"odac/internal/firewall"
 	"odac/internal/netutil"
 )
 
@@ -83,7 +85,7 @@ func main() {
 	fmt.Printf("ODAC_DNS_PORT=%d\n", port)
 
 	// Start Control API (Unix Socket or TCP fallback)
-	apiListener := startControlAPI(res, readiness)
+	apiListener := startControlAPI(res, rateLimiter.Guard(), readiness)
 
 	// Wait for termination signal
 	c := make(chan os.Signal, 1)
@@ -278,9 +280,9 @@ func startDNSServers(handler dns.Handler, port int, readiness *api.Readiness) (*
 
 // startControlAPI starts the HTTP control API on a Unix socket or TCP fallback.
 // Mirrors the proxy's API listener setup in main.go.
-func startControlAPI(res *resolver.Resolver, readiness *api.Readiness) net.Listener {
+func startControlAPI(res *resolver.Resolver, guard *firewall.Guard, readiness *api.Readiness) net.Listener {
 	socketPath := os.Getenv("ODAC_DNS_SOCKET_PATH")
-	apiServer := api.NewServer(res, readiness)
+	apiServer := api.NewServer(res, guard, readiness)
 
 	var listener net.Listener
 	var err error
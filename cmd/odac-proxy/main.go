@@ -18,6 +18,7 @@ import (
 	"syscall"
 	"time"
 
+	"odac/internal/firewall"
 	"odac/internal/netutil"
 	"odac/internal/proxy/api"
 	"odac/internal/proxy/config"
@@ -60,9 +61,10 @@ func main() {
 	optimizeTCPCongestion() // BBR congestion control + FQ qdisc
 
 	// Initialize components
-	cfg := config.Firewall{Enabled: true} // Default
+	cfg := config.Firewall{Policy: firewall.Policy{Enabled: true}} // Default
 	fw := proxy.NewFirewall(cfg)
 	prx := proxy.NewProxy()
+	streams := proxy.NewStreams(fw.Guard())
 
 	// Stack middleware: Firewall -> Proxy
 	// We removed timeoutMiddleware because robust timeout handling is now done
@@ -114,7 +116,7 @@ func main() {
 	// bind and produces a multi-second outage during zero-downtime updates.
 	readiness := &api.Readiness{}
 
-	apiServer := api.NewServer(prx, fw, readiness)
+	apiServer := api.NewServer(prx, fw, streams, readiness)
 
 	go func() {
 		if err := http.Serve(apiListener, apiServer); err != nil {
@@ -210,6 +212,8 @@ func main() {
 		},
 	}
 
+	tlsConfig.GetConfigForClient = prx.ConfigForClient(tlsConfig)
+
 	httpsServer := &http.Server{
 		Handler:   handler,
 		TLSConfig: tlsConfig,
@@ -280,6 +284,8 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	streams.Close()
+
 	// Shutdown all servers
 	var wg sync.WaitGroup
 	wg.Add(3)
@@ -16,18 +16,24 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
 
+	"odac/internal/alert"
 	"odac/internal/api"
+	"odac/internal/applog"
 	"odac/internal/appmgr"
+	"odac/internal/audit"
 	"odac/internal/config"
 	"odac/internal/dataplane"
 	"odac/internal/docker"
 	"odac/internal/domains"
 	"odac/internal/hub"
+	"odac/internal/logship"
 	"odac/internal/logx"
+	"odac/internal/secrets"
 	"odac/internal/sysinfo"
 	"odac/internal/system"
 	"odac/internal/system/swap"
@@ -55,8 +61,9 @@ func main() {
 	// exactly like Node's constructor-time ping; a docker-less host keeps a
 	// non-nil but unavailable client and every operation no-ops.
 	containers, err := docker.Connect(docker.Options{
-		HostRoot: os.Getenv("ODAC_HOST_ROOT"),
-		LogsRoot: filepath.Join(baseDir, "logs"),
+		HostRoot:       os.Getenv("ODAC_HOST_ROOT"),
+		LogsRoot:       filepath.Join(baseDir, "logs"),
+		BuildCacheRoot: filepath.Join(baseDir, "cache", "build"),
 	})
 	if err != nil {
 		// Client construction only fails on malformed DOCKER_HOST-style env;
@@ -76,11 +83,14 @@ func main() {
 	apiSrv := api.NewServer(cfg)
 	apiSrv.Addr = os.Getenv("ODAC_API_ADDR") // test/smoke override only, like the CLI's
 	apiSrv.Init()                            // generates config.api.auth on first start
+	auditLog := audit.New(cfg)
+	apiSrv.SetAuditor(auditLog)
 
 	// Domain + SSL managers (task 3.5). SSL rides the 1s check tick; Domain
 	// fills appmgr's DomainDeleter seam for app-delete cascades.
 	sslSvc := domains.NewSSL(cfg, dnsSvc, proxySvc, mailSvc)
 	domainSvc := domains.NewDomain(cfg, dnsSvc, sslSvc, proxySvc, mailSvc)
+	proxySvc.SetOnDemand(domainSvc)
 
 	// System inventory. Built before appmgr because it also answers the GPU
 	// pre-flight ("can this engine hand a card to a container"), which app
@@ -95,6 +105,15 @@ func main() {
 		},
 	)
 
+	// Secrets store: values appmgr resolves for secret:// env references.
+	secretSvc := secrets.New(cfg)
+	sslSvc.SetSecrets(secretSvc)
+
+	// Alerting: producers below queue events, the alerter samples host
+	// usage itself and mails through the local mail server.
+	alerter := alert.New(cfg, alert.Deps{Mailer: mailSvc, Secrets: secretSvc, Usage: sysInfo})
+	sslSvc.SetAlerter(alerter)
+
 	// App manager (task 3.4e). Skipped only when the Docker client could not
 	// even be constructed (malformed DOCKER_HOST-style env) — an unreachable
 	// daemon still yields a client, and appmgr no-ops like Node does.
@@ -106,10 +125,25 @@ func main() {
 			Proxy:   proxySvc,
 			Domains: domainSvc,
 			GPUHost: sysInfo,
+			Secrets: secretSvc,
+			Alerter: alerter,
+
+			DomainBinder: domainSvc,
 		})
 		appMgr.Init() // Node: the DI registry runs App.init() on first resolve
 	}
 
+	// Log shipping: app logs arrive through the applog tap, the server's
+	// own output through the logx writers, data-plane logs by tailing.
+	shipDeps := logship.Deps{Secrets: secretSvc}
+	if appMgr != nil {
+		shipDeps.Redactor = appMgr
+	}
+	shipper := logship.New(cfg, shipDeps)
+	logx.Stdout = io.MultiWriter(os.Stdout, shipper.Writer("server", "out"))
+	logx.Stderr = io.MultiWriter(os.Stderr, shipper.Writer("server", "err"))
+	applog.SetTap(shipper.App)
+
 	// Updater (task 3.7): zero-downtime self-update. It owns its own SDK
 	// client like Node's Updater constructs its own dockerode instance; a
 	// docker-less host degrades to an always-failing client (update checks
@@ -168,6 +202,7 @@ func main() {
 		})
 	}
 	hubSvc := hub.New(cfg, hubURL, hubDeps)
+	hubSvc.SetAuditor(auditLog)
 	if appMgr != nil {
 		appMgr.SetHub(hubSvc) // closes the 3.4e seam (triggers + recipe fetch)
 	}
@@ -176,6 +211,10 @@ func main() {
 	// installed, daemon restarted) must not wait for the hourly system.info.
 	sysInfo.SetGPUChangeHook(func() { hubSvc.Trigger("system.info") })
 
+	fwSvc := dataplane.NewFirewall(cfg, proxySvc, mailSvc, dnsSvc)
+	swapMgr := swap.New(cfg)
+	swapMgr.SetAlerter(alerter)
+
 	svc := system.Services{
 		Proxy: proxySvc,
 		DNS:   dnsSvc,
@@ -183,7 +222,9 @@ func main() {
 		Api:   apiSrv,
 		SSL:   sslSvc,
 		Hub:   hubSvc,
-		Swap:  swap.New(cfg),
+		Swap:  swapMgr,
+
+		Firewall: fwSvc,
 	}
 	if appMgr != nil {
 		svc.App = appMgr
@@ -191,8 +232,10 @@ func main() {
 	sys := system.New(cfg, svc, upd)
 	upd.SetSystem(sys) // closes the System↔Updater cycle (rollback re-Init)
 
-	registerActions(apiSrv, sys, upd, dnsSvc, mailSvc, appMgr, domainSvc, sslSvc, hubSvc)
+	registerActions(apiSrv, sys, upd, dnsSvc, mailSvc, fwSvc, proxySvc, appMgr, domainSvc, sslSvc, hubSvc, secretSvc, shipper, alerter, auditLog)
 
+	shipper.Start()
+	alerter.Start()
 	if err := sys.Init(); err != nil {
 		log.Error("System initialization failed:", err.Error())
 		os.Exit(1)
@@ -217,7 +260,7 @@ func (h hubContainers) CreateTerminalSession(appName string, opts docker.Termina
 
 // registerActions wires the full contract-0.1 action table (complete as of
 // task 3.7 — every action in Node's Api.js #commands is registered).
-func registerActions(apiSrv *api.Server, sys *system.System, upd *updater.Updater, dnsSvc *dataplane.DNS, mailSvc *dataplane.Mail, appMgr *appmgr.Manager, domainSvc *domains.Domain, sslSvc *domains.SSL, hubSvc *hub.Hub) {
+func registerActions(apiSrv *api.Server, sys *system.System, upd *updater.Updater, dnsSvc *dataplane.DNS, mailSvc *dataplane.Mail, fwSvc *dataplane.Firewall, proxySvc *dataplane.Proxy, appMgr *appmgr.Manager, domainSvc *domains.Domain, sslSvc *domains.SSL, hubSvc *hub.Hub, secretSvc *secrets.Store, shipper *logship.Shipper, alerter *alert.Alerter, auditLog *audit.Log) {
 	res := func(r api.Result) (*api.Result, error) { return &r, nil }
 
 	apiSrv.Register("auth", func(a api.Args, _ api.Progress) (*api.Result, error) {
@@ -249,6 +292,12 @@ func registerActions(apiSrv *api.Server, sys *system.System, upd *updater.Update
 		apiSrv.Register("app.api", func(a api.Args, _ api.Progress) (*api.Result, error) {
 			return appMgr.SetAPI(a.At(0), a.At(1)), nil
 		})
+		apiSrv.Register("app.build", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.SetBuild(a.At(0), a.At(1)), nil
+		})
+		apiSrv.Register("app.cache.clear", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.ClearBuildCache(a.At(0)), nil
+		})
 		apiSrv.Register("app.create", func(a api.Args, _ api.Progress) (*api.Result, error) {
 			return appMgr.Create(a.At(0)), nil
 		})
@@ -261,6 +310,9 @@ func registerActions(apiSrv *api.Server, sys *system.System, upd *updater.Update
 			}
 			return appMgr.Delete(a.At(0), purge), nil
 		})
+		apiSrv.Register("app.deploykey", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.DeployKey(a.At(0), a.At(1)), nil
+		})
 		apiSrv.Register("app.device.add", func(a api.Args, _ api.Progress) (*api.Result, error) {
 			return appMgr.DeviceAdd(a.At(0), argStr(a.At(1)), argStr(a.At(2))), nil
 		})
@@ -270,15 +322,44 @@ func registerActions(apiSrv *api.Server, sys *system.System, upd *updater.Update
 		apiSrv.Register("app.list", func(a api.Args, _ api.Progress) (*api.Result, error) {
 			return appMgr.List(a.At(0) == true), nil
 		})
+		apiSrv.Register("app.logs", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.Logs(a.At(0), a.At(1)), nil
+		})
+		apiSrv.Register("app.logs.export", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.LogsExport(a.At(0), a.At(1)), nil
+		})
 		apiSrv.Register("app.network", func(a api.Args, _ api.Progress) (*api.Result, error) {
 			return appMgr.SetNetworkMode(a.At(0), argStr(a.At(1))), nil
 		})
 		apiSrv.Register("app.isolate", func(a api.Args, _ api.Progress) (*api.Result, error) {
 			return appMgr.SetIsolated(a.At(0), a.At(1) == true), nil
 		})
+		apiSrv.Register("app.ondemand", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.SetOnDemand(a.At(0), a.At(1)), nil
+		})
+		apiSrv.Register("app.preview", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.SetPreviews(a.At(0), a.At(1)), nil
+		})
+		apiSrv.Register("app.preview.create", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.PreviewCreate(a.At(0), a.At(1), a.At(2)), nil
+		})
+		apiSrv.Register("app.preview.delete", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.PreviewDelete(a.At(0), a.At(1)), nil
+		})
+		apiSrv.Register("app.preview.list", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			return appMgr.PreviewList(a.At(0)), nil
+		})
 		apiSrv.Register("app.privileged", func(a api.Args, _ api.Progress) (*api.Result, error) {
 			return appMgr.SetPrivileged(a.At(0), argStr(a.At(1))), nil
 		})
+		apiSrv.Register("app.redeploy", func(a api.Args, _ api.Progress) (*api.Result, error) {
+			opts, _ := a.At(1).(map[string]any)
+			return appMgr.Redeploy(appmgr.RedeployPayload{
+				Container: argStr(a.At(0)),
+				Branch:    argStr(opts["branch"]),
+				CommitSha: argStr(opts["commit"]),
+			}), nil
+		})
 		apiSrv.Register("app.restart", func(a api.Args, _ api.Progress) (*api.Result, error) {
 			return appMgr.Restart(a.At(0)), nil
 		})
@@ -296,15 +377,150 @@ func registerActions(apiSrv *api.Server, sys *system.System, upd *updater.Update
 	apiSrv.Register("domain.add", func(a api.Args, _ api.Progress) (*api.Result, error) {
 		return res(domainSvc.Add(a.At(0), a.At(1)))
 	})
+	apiSrv.Register("domain.auth.list", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(domainSvc.AuthList(a.At(0)))
+	})
+	apiSrv.Register("domain.auth.remove", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(domainSvc.AuthRemove(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("domain.auth.set", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(domainSvc.AuthSet(a.At(0), a.At(1), a.At(2)))
+	})
+	apiSrv.Register("domain.auth.user", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(domainSvc.AuthUser(a.At(0), a.At(1), a.At(2), a.At(3)))
+	})
+	apiSrv.Register("domain.backend", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(domainSvc.Backend(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("domain.cache", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(domainSvc.Cache(a.At(0), a.At(1)))
+	})
 	apiSrv.Register("domain.delete", func(a api.Args, _ api.Progress) (*api.Result, error) {
 		return res(domainSvc.Delete(a.At(0), a.At(1) == true))
 	})
 	apiSrv.Register("domain.list", func(a api.Args, _ api.Progress) (*api.Result, error) {
 		return res(domainSvc.List(a.At(0)))
 	})
+	apiSrv.Register("domain.maintenance", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(domainSvc.Maintenance(a.At(0), a.At(1), a.At(2), a.At(3)))
+	})
+	apiSrv.Register("domain.mtls", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(domainSvc.MTLS(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("domain.relay", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(domainSvc.Relay(a.At(0)))
+	})
+	apiSrv.Register("tunnel.add", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(proxySvc.AddTunnel(a.At(0), a.At(1), a.At(2), a.At(3)))
+	})
+	apiSrv.Register("tunnel.delete", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(proxySvc.DeleteTunnel(a.At(0)))
+	})
+	apiSrv.Register("tunnel.list", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(proxySvc.ListTunnels())
+	})
+	apiSrv.Register("stream.add", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(proxySvc.AddStream(a.At(0), a.At(1), a.At(2)))
+	})
+	apiSrv.Register("stream.delete", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(proxySvc.DeleteStream(a.At(0)))
+	})
+	apiSrv.Register("stream.list", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(proxySvc.ListStreams())
+	})
+	apiSrv.Register("cache.disk", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(proxySvc.DiskCache(a.At(0)))
+	})
+	apiSrv.Register("cache.purge", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(proxySvc.Purge(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("secret.set", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(secretSvc.Set(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("secret.delete", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(secretSvc.Delete(a.At(0)))
+	})
+	apiSrv.Register("secret.list", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(secretSvc.List())
+	})
+	apiSrv.Register("secret.rotate", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(secretSvc.Rotate())
+	})
+	apiSrv.Register("log.sink.add", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(shipper.AddSink(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("log.sink.delete", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(shipper.DeleteSink(a.At(0)))
+	})
+	apiSrv.Register("log.sink.list", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(shipper.List())
+	})
+	apiSrv.Register("log.label", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(shipper.SetLabels(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("alert.channel.add", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(alerter.ChannelAdd(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("alert.channel.delete", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(alerter.ChannelDelete(a.At(0)))
+	})
+	apiSrv.Register("alert.channel.list", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(alerter.Channels())
+	})
+	apiSrv.Register("alert.rule.set", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(alerter.RuleSet(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("alert.rule.delete", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(alerter.RuleDelete(a.At(0)))
+	})
+	apiSrv.Register("alert.rule.list", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(alerter.Rules())
+	})
+	apiSrv.Register("alert.test", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(alerter.Test(a.At(0)))
+	})
+	apiSrv.Register("alert.history", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(alerter.History())
+	})
+	apiSrv.Register("audit.list", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(auditLog.List(a.At(0)))
+	})
+	apiSrv.Register("token.create", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(apiSrv.TokenCreate(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("token.list", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(apiSrv.TokenList())
+	})
+	apiSrv.Register("token.revoke", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(apiSrv.TokenRevoke(a.At(0)))
+	})
 	apiSrv.Register("ssl.renew", func(a api.Args, _ api.Progress) (*api.Result, error) {
 		return res(sslSvc.Renew(a.At(0)))
 	})
+	apiSrv.Register("ssl.import", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(sslSvc.Import(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("ssl.ca.add", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(sslSvc.CAAdd(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("ssl.ca.delete", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(sslSvc.CADelete(a.At(0)))
+	})
+	apiSrv.Register("ssl.ca.list", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(sslSvc.CAs())
+	})
+	apiSrv.Register("ssl.settings", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(sslSvc.Settings(a.At(0), a.At(1)))
+	})
+	apiSrv.Register("firewall.ban", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(fwSvc.Ban(a.At(0), a.At(1), a.At(2)))
+	})
+	apiSrv.Register("firewall.list", func(_ api.Args, _ api.Progress) (*api.Result, error) {
+		return res(fwSvc.List())
+	})
+	apiSrv.Register("firewall.unban", func(a api.Args, _ api.Progress) (*api.Result, error) {
+		return res(fwSvc.Unban(a.At(0)))
+	})
 	apiSrv.Register("mail.create", func(a api.Args, _ api.Progress) (*api.Result, error) {
 		return res(mailSvc.Create(a.At(0), a.At(1), a.At(2)))
 	})
@@ -14,7 +14,9 @@ import (
 	"path/filepath"
 	"runtime"
 
+	"odac/internal/alert"
 	"odac/internal/config"
+	"odac/internal/secrets"
 	"odac/internal/watchdog"
 )
 
@@ -25,7 +27,13 @@ func main() {
 		os.Exit(1)
 	}
 
-	watchdog.New(cfg, serverCommand()).Run()
+	w := watchdog.New(cfg, serverCommand())
+	w.SetGiveUpHook(func(message string) {
+		// The server is down, so only the webhook channels can be reached.
+		alerter := alert.New(cfg, alert.Deps{Secrets: secrets.New(cfg)})
+		alerter.Deliver(alert.Event{Kind: "watchdog.gave_up", Subject: "odac-server", Message: message, Value: 1})
+	})
+	w.Run()
 }
 
 // serverCommand resolves what to supervise: an explicit Node entrypoint via
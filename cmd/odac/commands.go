@@ -6,11 +6,17 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type command struct {
@@ -43,6 +49,11 @@ var commands []entry
 
 func init() {
 	commands = []entry{
+		{"audit", &command{
+			args:        []string{"--since", "--action", "--limit"},
+			description: "Show the audit log: --since (2h, 7d or RFC 3339), --action <glob>, --limit <entries>",
+			action:      auditAction,
+		}},
 		{"auth", &command{
 			args:        []string{"key", "-k", "--key"},
 			description: "Define your server to your ODAC account",
@@ -88,6 +99,72 @@ func init() {
 				return a.call("update", nil, false)
 			},
 		}},
+		{"alert", &command{
+			title: "ALERTS",
+			sub: []entry{
+				{"channel", &command{
+					sub: []entry{
+						{"add", &command{
+							description: "Send alerts to a webhook, Slack, Discord or email",
+							args:        []string{"-n", "--name", "--type", "--url", "--to", "--from"},
+							action:      alertChannelAddAction,
+						}},
+						{"delete", &command{
+							description: "Delete an alert channel",
+							args:        []string{"-n", "--name"},
+							action: func(a *app, args []string) int {
+								return a.call("alert.channel.delete", []any{a.nameArg(args, __("Enter the channel name: "))}, false)
+							},
+						}},
+						{"list", &command{
+							description: "List alert channels",
+							action: func(a *app, _ []string) int {
+								return a.call("alert.channel.list", []any{}, false)
+							},
+						}},
+					},
+				}},
+				{"history", &command{
+					description: "Show recent alerts",
+					action: func(a *app, _ []string) int {
+						return a.call("alert.history", []any{}, false)
+					},
+				}},
+				{"rule", &command{
+					sub: []entry{
+						{"delete", &command{
+							description: "Delete a rule or reset a built-in one",
+							args:        []string{"-n", "--name"},
+							action: func(a *app, args []string) int {
+								return a.call("alert.rule.delete", []any{a.nameArg(args, __("Enter the rule name: "))}, false)
+							},
+						}},
+						{"list", &command{
+							description: "List alert rules",
+							action: func(a *app, _ []string) int {
+								return a.call("alert.rule.list", []any{}, false)
+							},
+						}},
+						{"set", &command{
+							description: "Create or change an alert rule",
+							args:        []string{"-n", "--name", "--event", "--match", "--threshold", "--cooldown", "--channel", "--all-channels", "--enable", "--disable"},
+							action:      alertRuleSetAction,
+						}},
+					},
+				}},
+				{"test", &command{
+					description: "Send a test alert to one channel or all of them",
+					args:        []string{"-n", "--name"},
+					action: func(a *app, args []string) int {
+						name := parseArg(args, "-n", "--name")
+						if name == "" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+							name = args[0]
+						}
+						return a.call("alert.test", []any{name}, false)
+					},
+				}},
+			},
+		}},
 		{"app", &command{
 			title: "APP",
 			sub: []entry{
@@ -96,9 +173,25 @@ func init() {
 					args:        []string{"-i", "--id", "--allow", "--all", "--off"},
 					action:      appAPIAction,
 				}},
+				{"build", &command{
+					description: "Show or change a git app's build settings: --arg KEY=VALUE, --secret KEY=<secret name>, --unset KEY, --cache <MB> (0 turns the build cache off)",
+					args:        []string{"-i", "--id", "--arg", "--secret", "--unset", "--cache"},
+					action:      appBuildAction,
+				}},
+				{"cache", &command{
+					sub: []entry{
+						{"clear", &command{
+							description: "Empty a git app's build cache",
+							args:        []string{"-i", "--id"},
+							action: func(a *app, args []string) int {
+								return a.call("app.cache.clear", []any{a.appArg(args)}, false)
+							},
+						}},
+					},
+				}},
 				{"create", &command{
-					description: "Create a new application",
-					args:        []string{"-t", "--type", "-n", "--name", "-u", "--url", "-b", "--branch", "--token", "-D", "--dev"},
+					description: "Create a new application. --recipe <file.json> or --compose <docker-compose.yml> deploys from a local file.",
+					args:        []string{"-t", "--type", "-n", "--name", "-u", "--url", "-b", "--branch", "--token", "--path", "--known-hosts", "--build-arg", "--build-secret", "-D", "--dev", "--recipe", "--compose"},
 					action:      appCreateAction,
 				}},
 				{"delete", &command{
@@ -139,16 +232,75 @@ func init() {
 						return a.call("app.list", nil, false)
 					},
 				}},
+				{"logs", &command{
+					description: "Show an app's runtime logs: --since/--until (2h, 7d or RFC 3339), --grep <regex>, --stderr, --limit <lines>. --follow keeps printing new lines; --export writes the selection to a gzip archive.",
+					args:        []string{"-i", "--id", "--since", "--until", "--grep", "--stderr", "--limit", "-f", "--follow", "--export"},
+					action:      appLogsAction,
+				}},
 				{"network", &command{
 					description: "Set an app's network mode: --host to share the host namespace, --bridge (default) for the shared network. Restart required.",
 					args:        []string{"-i", "--id", "--host", "--bridge"},
 					action:      appNetworkAction,
 				}},
+				{"ondemand", &command{
+					description: "Issue certificates on the fly for customer domains pointed at an app: --ask <path> is asked with ?domain=<host> (2xx approves), --allow <pattern> (repeatable, e.g. *.example.com) approves without asking, --limit <n> caps certificates per hour (default 20). --off turns it off; no flags show the settings.",
+					args:        []string{"-i", "--id", "--ask", "--allow", "--limit", "--off"},
+					action:      appOnDemandAction,
+				}},
+				{"preview", &command{
+					sub: []entry{
+						{"create", &command{
+							description: "Deploy a branch of a git app as a preview at <branch>.<app domain> (again to redeploy it). --env KEY=VALUE overrides the app's env.",
+							args:        []string{"-i", "--id", "-b", "--branch", "--env", "--token"},
+							action:      appPreviewCreateAction,
+						}},
+						{"delete", &command{
+							description: "Tear down a preview",
+							args:        []string{"-i", "--id", "-b", "--branch"},
+							action: func(a *app, args []string) int {
+								app, branch := a.appPreviewArgs(args)
+								return a.call("app.preview.delete", []any{app, branch}, false)
+							},
+						}},
+						{"disable", &command{
+							description: "Stop offering previews for a git app and tear its previews down",
+							args:        []string{"-i", "--id"},
+							action: func(a *app, args []string) int {
+								return a.call("app.preview", []any{appIDArg(a, args), map[string]any{"enabled": false}}, false)
+							},
+						}},
+						{"enable", &command{
+							description: "Let a git app have previews. --ttl <hours> (default 72) tears a preview down after that long without a deploy.",
+							args:        []string{"-i", "--id", "--ttl"},
+							action:      appPreviewEnableAction,
+						}},
+						{"list", &command{
+							description: "List previews, of one app or of all",
+							args:        []string{"-i", "--id"},
+							action: func(a *app, args []string) int {
+								app := parseArg(args, "-i", "--id")
+								if app == "" && len(args) > 0 {
+									app = args[0]
+								}
+								data := []any{}
+								if app != "" {
+									data = []any{app}
+								}
+								return a.call("app.preview.list", data, false)
+							},
+						}},
+					},
+				}},
 				{"privileged", &command{
 					description: "Grant elevated access to an app: --root (default) or --full. Use --off to revoke. (At your own risk)",
 					args:        []string{"-i", "--id", "--root", "--full", "--off"},
 					action:      appPrivilegedAction,
 				}},
+				{"redeploy", &command{
+					description: "Pull and rebuild a git app, then swap it in with zero downtime. -b/--branch and --commit pick what to deploy.",
+					args:        []string{"-i", "--id", "-b", "--branch", "--commit"},
+					action:      appRedeployAction,
+				}},
 				{"restart", &command{
 					description: "Restart an App",
 					args:        []string{"-i", "--id"},
@@ -172,6 +324,21 @@ func init() {
 				}},
 			},
 		}},
+		{"cache", &command{
+			title: "CACHE",
+			sub: []entry{
+				{"disk", &command{
+					description: "Show the proxy's disk cache, or set its size with --size <MB> (0 turns it off)",
+					args:        []string{"--size"},
+					action:      cacheDiskAction,
+				}},
+				{"purge", &command{
+					description: "Drop a domain's cached assets and pages, or only those with --tag <tag> (repeatable), at --url <url> or below --prefix <path>",
+					args:        []string{"-d", "--domain", "--tag", "--url", "--prefix"},
+					action:      cachePurgeAction,
+				}},
+			},
+		}},
 		{"dns", &command{
 			title: "DNS",
 			sub: []entry{
@@ -215,6 +382,45 @@ func init() {
 						return a.call("domain.add", []any{domain, app}, false)
 					},
 				}},
+				{"auth", &command{
+					sub: []entry{
+						{"list", &command{
+							description: "List a domain's access rules and users",
+							args:        []string{"-d", "--domain"},
+							action: func(a *app, args []string) int {
+								return a.call("domain.auth.list", []any{a.domainFlagArg(args)}, false)
+							},
+						}},
+						{"remove", &command{
+							description: "Remove the access rule for a path",
+							args:        []string{"-d", "--domain", "--path"},
+							action: func(a *app, args []string) int {
+								domain := a.domainFlagArg(args, "--path")
+								return a.call("domain.auth.remove", []any{domain, parseArg(args, "--path")}, false)
+							},
+						}},
+						{"set", &command{
+							description: "Protect a path (default /): --basic, --allow <ips>, --forward <app> [--uri /verify], --public. Prefix --no- to unset.",
+							args:        []string{"-d", "--domain", "--path", "--basic", "--allow", "--forward", "--uri", "--headers", "--public", "--realm"},
+							action:      domainAuthSetAction,
+						}},
+						{"user", &command{
+							description: "Add or update a basic-auth user. Use --delete to remove it.",
+							args:        []string{"-d", "--domain", "-u", "--user", "-p", "--password", "--delete"},
+							action:      domainAuthUserAction,
+						}},
+					},
+				}},
+				{"backend", &command{
+					description: "Reach the app over --protocol http1, h2c or https [--insecure] [--server-name <name>]. --grpc-web translates browser gRPC-Web.",
+					args:        []string{"-d", "--domain", "--protocol", "--insecure", "--server-name", "--grpc-web"},
+					action:      domainBackendAction,
+				}},
+				{"cache", &command{
+					description: "Set the page cache key: --ignore-query <param> (repeatable, utm_* matches a prefix), --query keys the other params, --cookie <name> and --header <name> (repeatable), --device, --debug, or --reset",
+					args:        []string{"-d", "--domain", "--ignore-query", "--query", "--cookie", "--header", "--device", "--debug", "--reset"},
+					action:      domainCacheAction,
+				}},
 				{"delete", &command{
 					description: "Delete a domain",
 					args:        []string{"-d", "--domain"},
@@ -244,6 +450,94 @@ func init() {
 						return a.call("domain.list", data, false)
 					},
 				}},
+				{"maintenance", &command{
+					description: "Serve a maintenance page on a domain: --on or --off. --allow <ips> lets addresses through.",
+					args:        []string{"-d", "--domain", "--on", "--off", "--allow", "--retry-after"},
+					action:      domainMaintenanceAction,
+				}},
+				{"mtls", &command{
+					description: "Require client certificates signed by a CA: --ca <file> [--optional]. --off turns it off.",
+					args:        []string{"-d", "--domain", "--ca", "--optional", "--require", "--off"},
+					action:      domainMTLSAction,
+				}},
+				{"relay", &command{
+					description: "Accept a tunnel agent for a domain on this server (again to rotate its token)",
+					args:        []string{"-d", "--domain"},
+					action: func(a *app, args []string) int {
+						return a.call("domain.relay", []any{a.domainFlagArg(args)}, false)
+					},
+				}},
+			},
+		}},
+		{"firewall", &command{
+			title: "FIREWALL",
+			sub: []entry{
+				{"ban", &command{
+					description: "Ban an IP address or CIDR range",
+					args:        []string{"-i", "--ip", "--for", "--reason"},
+					action: func(a *app, args []string) int {
+						ip := parseArg(args, "-i", "--ip")
+						if ip == "" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+							ip = args[0]
+						}
+						if ip == "" {
+							ip = a.question(__("Enter the IP address or CIDR range: "))
+						}
+						return a.call("firewall.ban", []any{ip, parseArg(args, "--for"), parseArg(args, "--reason")}, false)
+					},
+				}},
+				{"list", &command{
+					description: "List active bans",
+					action: func(a *app, _ []string) int {
+						return a.call("firewall.list", []any{}, false)
+					},
+				}},
+				{"unban", &command{
+					description: "Lift a ban",
+					args:        []string{"-i", "--ip"},
+					action: func(a *app, args []string) int {
+						ip := parseArg(args, "-i", "--ip")
+						if ip == "" && len(args) > 0 {
+							ip = args[0]
+						}
+						if ip == "" {
+							ip = a.question(__("Enter the IP address or CIDR range: "))
+						}
+						return a.call("firewall.unban", []any{ip}, false)
+					},
+				}},
+			},
+		}},
+		{"log", &command{
+			title: "LOG SHIPPING",
+			sub: []entry{
+				{"label", &command{
+					description: "Set or show the labels an app's shipped logs carry",
+					args:        []string{"-a", "--app"},
+					action:      logLabelAction,
+				}},
+				{"sink", &command{
+					sub: []entry{
+						{"add", &command{
+							description: "Ship logs to a syslog, Loki or OTLP endpoint",
+							args:        []string{"-n", "--name", "--type", "--url", "--header", "--label", "--app", "--no-daemon"},
+							action:      logSinkAddAction,
+						}},
+						{"delete", &command{
+							description: "Stop shipping to a sink and drop its spool",
+							args:        []string{"-n", "--name"},
+							action: func(a *app, args []string) int {
+								return a.call("log.sink.delete", []any{a.nameArg(args, __("Enter the sink name: "))}, false)
+							},
+						}},
+						{"list", &command{
+							description: "List log sinks and their delivery state",
+							action: func(a *app, _ []string) int {
+								return a.call("log.sink.list", []any{}, false)
+							},
+						}},
+					},
+				}},
 			},
 		}},
 		{"mail", &command{
@@ -289,9 +583,65 @@ func init() {
 				}},
 			},
 		}},
+		{"secret", &command{
+			title: "SECRET",
+			sub: []entry{
+				{"delete", &command{
+					description: "Delete a secret",
+					args:        []string{"-n", "--name"},
+					action: func(a *app, args []string) int {
+						return a.call("secret.delete", []any{a.secretNameArg(args)}, false)
+					},
+				}},
+				{"list", &command{
+					description: "List secrets (values are never shown)",
+					action: func(a *app, _ []string) int {
+						return a.call("secret.list", []any{}, false)
+					},
+				}},
+				{"rotate", &command{
+					description: "Re-encrypt all secrets under a new host key",
+					action: func(a *app, _ []string) int {
+						return a.call("secret.rotate", []any{}, false)
+					},
+				}},
+				{"set", &command{
+					description: "Create or replace a secret",
+					args:        []string{"-n", "--name", "-v", "--value", "--file"},
+					action:      secretSetAction,
+				}},
+			},
+		}},
 		{"ssl", &command{
 			title: "SSL",
 			sub: []entry{
+				{"ca", &command{
+					sub: []entry{
+						{"add", &command{
+							description: "Add an ACME CA (--directory <url>) or set EAB credentials: --eab-kid <kid> --eab-hmac secret://<name>",
+							args:        []string{"-n", "--name", "--directory", "--eab-kid", "--eab-hmac"},
+							action:      sslCAAddAction,
+						}},
+						{"delete", &command{
+							description: "Delete a CA, or the EAB credentials of a built-in one",
+							args:        []string{"-n", "--name"},
+							action: func(a *app, args []string) int {
+								return a.call("ssl.ca.delete", []any{a.nameArg(args, __("Enter the CA name: "))}, false)
+							},
+						}},
+						{"list", &command{
+							description: "List certificate authorities",
+							action: func(a *app, _ []string) int {
+								return a.call("ssl.ca.list", []any{}, false)
+							},
+						}},
+					},
+				}},
+				{"import", &command{
+					description: "Install a certificate from another CA: --cert <file> --key <file> [--chain <file>]. --remove goes back to Let's Encrypt.",
+					args:        []string{"-d", "--domain", "--cert", "--key", "--chain", "--remove"},
+					action:      sslImportAction,
+				}},
 				{"renew", &command{
 					description: "Renew SSL certificate for a domain",
 					args:        []string{"-d", "--domain"},
@@ -303,6 +653,80 @@ func init() {
 						return a.call("ssl.renew", []any{domain}, false)
 					},
 				}},
+				{"settings", &command{
+					description: "Choose the CAs (--ca a,b) and key type (--key-type ec256|ec384|rsa2048|rsa4096) of a domain, or without -d the default",
+					args:        []string{"-d", "--domain", "--ca", "--key-type"},
+					action:      sslSettingsAction,
+				}},
+			},
+		}},
+		{"stream", &command{
+			title: "STREAM",
+			sub: []entry{
+				{"add", &command{
+					description: "Forward a TCP/UDP port to an app: --listen <port> -a <app> [--port <app port>] [--udp] [--tls terminate|passthrough --domain <domain>]",
+					args:        []string{"-n", "--name", "--listen", "-a", "--app", "--port", "--udp", "--tls", "--domain"},
+					action:      streamAddAction,
+				}},
+				{"delete", &command{
+					description: "Remove a stream",
+					args:        []string{"-n", "--name"},
+					action: func(a *app, args []string) int {
+						return a.call("stream.delete", []any{a.nameArg(args, __("Enter the stream name: "))}, false)
+					},
+				}},
+				{"list", &command{
+					description: "List streams with their connection and byte counters",
+					action: func(a *app, _ []string) int {
+						return a.call("stream.list", []any{}, false)
+					},
+				}},
+			},
+		}},
+		{"token", &command{
+			title: "TOKEN",
+			sub: []entry{
+				{"create", &command{
+					description: "Create a named API token: --allow <action> (repeatable or comma-separated), --app/--domain to confine it, --expires <90d|12h>",
+					args:        []string{"-n", "--name", "--allow", "--app", "--domain", "--expires"},
+					action:      tokenCreateAction,
+				}},
+				{"list", &command{
+					description: "List named API tokens (tokens are never shown)",
+					action: func(a *app, _ []string) int {
+						return a.call("token.list", []any{}, false)
+					},
+				}},
+				{"revoke", &command{
+					description: "Revoke a named API token",
+					args:        []string{"-n", "--name"},
+					action: func(a *app, args []string) int {
+						return a.call("token.revoke", []any{a.nameArg(args, __("Enter the token name: "))}, false)
+					},
+				}},
+			},
+		}},
+		{"tunnel", &command{
+			title: "TUNNEL",
+			sub: []entry{
+				{"add", &command{
+					description: "Expose an app through a self-hosted relay",
+					args:        []string{"-d", "--domain", "-a", "--app", "--relay", "--token"},
+					action:      tunnelAddAction,
+				}},
+				{"delete", &command{
+					description: "Remove a self-hosted relay tunnel",
+					args:        []string{"-d", "--domain"},
+					action: func(a *app, args []string) int {
+						return a.call("tunnel.delete", []any{a.domainFlagArg(args)}, false)
+					},
+				}},
+				{"list", &command{
+					description: "List tunnels",
+					action: func(a *app, _ []string) int {
+						return a.call("tunnel.list", []any{}, false)
+					},
+				}},
 			},
 		}},
 	}
@@ -346,6 +770,18 @@ func parseArg(args []string, prefixes ...string) string {
 	return ""
 }
 
+// parseArgAll returns the value of every occurrence of a repeatable flag.
+func parseArgAll(args []string, flag string) []string {
+	var values []string
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			values = append(values, args[i+1])
+			i++
+		}
+	}
+	return values
+}
+
 // question ports Cli.question: prompt on stdout, read one trimmed line.
 func (a *app) question(prompt string) string {
 	fmt.Fprint(a.out, prompt)
@@ -419,6 +855,9 @@ func deriveAppName(url string) string {
 }
 
 func appCreateAction(a *app, args []string) int {
+	if parseArg(args, "--recipe") != "" || parseArg(args, "--compose") != "" {
+		return appCreateFromFile(a, args)
+	}
 	typ := parseArg(args, "-t", "--type")
 	if typ == "" {
 		for _, arg := range args {
@@ -448,7 +887,7 @@ func appCreateAction(a *app, args []string) int {
 			"token":  nullable(parseArg(args, "--token")),
 			"dev":    isDev,
 		}
-		return a.call("app.create", []any{config}, false)
+		return appCreateGit(a, args, config)
 	}
 
 	if typ == "" {
@@ -463,7 +902,7 @@ func appCreateAction(a *app, args []string) int {
 			"name": deriveAppName(typ),
 			"dev":  isDev,
 		}
-		return a.call("app.create", []any{config}, false)
+		return appCreateGit(a, args, config)
 	}
 	if isDev {
 		return a.call("app.create", []any{map[string]any{"type": "app", "app": typ, "dev": true}}, false)
@@ -471,6 +910,258 @@ func appCreateAction(a *app, args []string) int {
 	return a.call("app.create", []any{typ}, false)
 }
 
+// appCreateGit adds the monorepo path and build settings and, for SSH
+// remotes, shows the app's deploy key first: the clone can only succeed
+// once the key has been added to the repository.
+func appCreateGit(a *app, args []string, config map[string]any) int {
+	if p := parseArg(args, "--path"); p != "" {
+		config["path"] = p
+	}
+	build := map[string]any{}
+	for flag, key := range map[string]string{"--build-arg": "args", "--build-secret": "secrets"} {
+		pairs, err := keyValueArgs(args, flag)
+		if err != nil {
+			fmt.Fprintln(a.errOut, err)
+			return 1
+		}
+		if len(pairs) > 0 {
+			build[key] = pairs
+		}
+	}
+	if len(build) > 0 {
+		config["build"] = build
+	}
+	url, _ := config["url"].(string)
+	if !strings.HasPrefix(url, "ssh://") && !gitScpRe.MatchString(url) {
+		return a.call("app.create", []any{config}, false)
+	}
+
+	knownHosts := ""
+	if file := parseArg(args, "--known-hosts"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(a.errOut, err)
+			return 1
+		}
+		knownHosts = string(data)
+		config["knownHosts"] = knownHosts
+	}
+	if code := a.call("app.deploykey", []any{config["name"], knownHosts}, false); code != 0 {
+		return code
+	}
+	a.question(__("Press Enter once the key is added to the repository..."))
+	return a.call("app.create", []any{config}, false)
+}
+
+// appBuildAction sends only the changes named on the command line; with
+// none it shows the app's current build settings.
+func appBuildAction(a *app, args []string) int {
+	valueFlags := []string{"--arg", "--secret", "--unset", "--cache"}
+	rest := args
+	for _, flag := range valueFlags {
+		rest = withoutFlagValue(rest, flag)
+	}
+	appID := appIDArg(a, rest)
+
+	changes := map[string]any{}
+	for flag, key := range map[string]string{"--arg": "args", "--secret": "secrets"} {
+		pairs, err := keyValueArgs(args, flag)
+		if err != nil {
+			fmt.Fprintln(a.errOut, err)
+			return 1
+		}
+		if len(pairs) > 0 {
+			changes[key] = pairs
+		}
+	}
+	if unset := parseArgAll(args, "--unset"); len(unset) > 0 {
+		keys := make([]any, len(unset))
+		for i, k := range unset {
+			keys[i] = k
+		}
+		changes["unset"] = keys
+	}
+	if size := parseArg(args, "--cache"); size != "" {
+		if size == "default" {
+			changes["cache"] = nil
+		} else if mb, err := strconv.Atoi(size); err == nil && mb >= 0 {
+			changes["cache"] = mb
+		} else {
+			fmt.Fprintln(a.errOut, __("Invalid cache size: %s", size))
+			return 1
+		}
+	}
+
+	if len(changes) == 0 {
+		return a.call("app.build", []any{appID}, false)
+	}
+	return a.call("app.build", []any{appID, changes}, false)
+}
+
+// appPreviewArgs reads the app and branch of a preview command, by flag or
+// as the first two positional arguments.
+func (a *app) appPreviewArgs(args []string) (string, string) {
+	app := parseArg(args, "-i", "--id")
+	branch := parseArg(args, "-b", "--branch")
+	var positional []string
+	rest := args
+	for _, flag := range []string{"-i", "--id", "-b", "--branch", "--env", "--token"} {
+		rest = withoutFlagValue(rest, flag)
+	}
+	for _, arg := range rest {
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+		}
+	}
+	if app == "" && len(positional) > 0 {
+		app, positional = positional[0], positional[1:]
+	}
+	if branch == "" && len(positional) > 0 {
+		branch = positional[0]
+	}
+	if app == "" {
+		app = a.question(__("Enter the App ID or Name: "))
+	}
+	if branch == "" {
+		branch = a.question(__("Enter the branch name: "))
+	}
+	return app, branch
+}
+
+func appPreviewCreateAction(a *app, args []string) int {
+	app, branch := a.appPreviewArgs(args)
+	opts := map[string]any{}
+	env, err := keyValueArgs(args, "--env")
+	if err != nil {
+		fmt.Fprintln(a.errOut, err)
+		return 1
+	}
+	if len(env) > 0 {
+		opts["env"] = env
+	}
+	if token := parseArg(args, "--token"); token != "" {
+		opts["token"] = token
+	}
+	if len(opts) == 0 {
+		return a.call("app.preview.create", []any{app, branch}, false)
+	}
+	return a.call("app.preview.create", []any{app, branch, opts}, false)
+}
+
+// appRedeployAction sends branch and commit only when given, so the app's
+// own branch stays the default.
+func appRedeployAction(a *app, args []string) int {
+	branch := parseArg(args, "-b", "--branch")
+	commit := parseArg(args, "--commit")
+	app := appIDArg(a, withoutFlagValue(withoutFlagValue(withoutFlagValue(args, "-b"), "--branch"), "--commit"))
+	opts := map[string]any{}
+	if branch != "" {
+		opts["branch"] = branch
+	}
+	if commit != "" {
+		opts["commit"] = commit
+	}
+	if len(opts) == 0 {
+		return a.call("app.redeploy", []any{app}, false)
+	}
+	return a.call("app.redeploy", []any{app, opts}, false)
+}
+
+func appPreviewEnableAction(a *app, args []string) int {
+	app := appIDArg(a, withoutFlagValue(args, "--ttl"))
+	settings := map[string]any{"enabled": true}
+	if ttl := parseArg(args, "--ttl"); ttl != "" {
+		hours, err := strconv.Atoi(ttl)
+		if err != nil || hours <= 0 {
+			fmt.Fprintln(a.errOut, __("Invalid preview TTL: %s", ttl))
+			return 1
+		}
+		settings["ttl"] = hours
+	}
+	return a.call("app.preview", []any{app, settings}, false)
+}
+
+func appOnDemandAction(a *app, args []string) int {
+	rest := args
+	for _, flag := range []string{"--ask", "--allow", "--limit"} {
+		rest = withoutFlagValue(rest, flag)
+	}
+	app := appIDArg(a, rest)
+	if slices.Contains(args, "--off") {
+		return a.call("app.ondemand", []any{app, map[string]any{"enabled": false}}, false)
+	}
+
+	settings := map[string]any{}
+	if ask := parseArg(args, "--ask"); ask != "" {
+		settings["ask"] = ask
+	}
+	if allow := parseArgAll(args, "--allow"); len(allow) > 0 {
+		settings["allow"] = allow
+	}
+	if limit := parseArg(args, "--limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			fmt.Fprintln(a.errOut, __("Invalid limit: %s", limit))
+			return 1
+		}
+		settings["limit"] = n
+	}
+	if len(settings) == 0 {
+		return a.call("app.ondemand", []any{app}, false)
+	}
+	return a.call("app.ondemand", []any{app, settings}, false)
+}
+
+// keyValueArgs collects every KEY=VALUE given to a repeatable flag.
+func keyValueArgs(args []string, flag string) (map[string]any, error) {
+	pairs := map[string]any{}
+	for _, raw := range parseArgAll(args, flag) {
+		key, value, ok := strings.Cut(raw, "=")
+		if !ok || key == "" {
+			return nil, errors.New(__("Expected KEY=VALUE after %s: %s", flag, raw))
+		}
+		pairs[key] = value
+	}
+	return pairs, nil
+}
+
+// appCreateFromFile sends a local recipe or compose file. The file is read
+// here and its contents sent, so paths are relative to the caller.
+func appCreateFromFile(a *app, args []string) int {
+	var config map[string]any
+	if file := parseArg(args, "--recipe"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(a.errOut, err)
+			return 1
+		}
+		var recipe map[string]any
+		if json.Unmarshal(data, &recipe) != nil || recipe == nil {
+			fmt.Fprintln(a.errOut, __("Invalid recipe file: %s", file))
+			return 1
+		}
+		config = map[string]any{
+			"type":   "app",
+			"app":    strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+			"recipe": recipe,
+		}
+	} else {
+		file := parseArg(args, "--compose")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(a.errOut, err)
+			return 1
+		}
+		// Like compose, default the project name to the file's directory.
+		dir, _ := filepath.Abs(filepath.Dir(file))
+		config = map[string]any{"type": "compose", "compose": string(data), "project": filepath.Base(dir)}
+	}
+	if name := parseArg(args, "-n", "--name"); name != "" {
+		config["name"] = name
+	}
+	return a.call("app.create", []any{config}, false)
+}
+
 // appIDArg resolves the app from -i/--id, else the first non-flag argument,
 // else a prompt.
 func appIDArg(a *app, args []string) string {
@@ -529,7 +1220,7 @@ func appAPIAction(a *app, args []string) int {
 
 	var permissions any = allow
 	if all {
-		fmt.Fprintln(a.out, __("WARNING: This grants the app every API action, including creating and deleting apps, domains and mailboxes. Server control and privilege management (auth, update, server.stop, app.privileged, app.api) are never granted. Prefer --allow with the actions it actually needs."))
+		fmt.Fprintln(a.out, __("WARNING: This grants the app every API action, including creating and deleting apps, domains and mailboxes. Server control and privilege management (auth, update, server.stop, app.privileged, app.api, token.*) are never granted. Prefer --allow with the actions it actually needs."))
 		if !strings.EqualFold(a.question(__(`Type "yes" to continue: `)), "yes") {
 			fmt.Fprintln(a.out, __("Aborted."))
 			return 1
@@ -560,6 +1251,75 @@ func withoutFlagValue(args []string, flag string) []string {
 	return out
 }
 
+// logFollowInterval is how often --follow polls for new log lines.
+var logFollowInterval = time.Second
+
+func appLogsAction(a *app, args []string) int {
+	rest := args
+	for _, flag := range []string{"--since", "--until", "--grep", "--limit"} {
+		rest = withoutFlagValue(rest, flag)
+	}
+	app := appIDArg(a, rest)
+	query := map[string]any{}
+	for _, key := range []string{"since", "until", "grep"} {
+		if v := parseArg(args, "--"+key); v != "" {
+			query[key] = v
+		}
+	}
+	if slices.Contains(args, "--stderr") {
+		query["stream"] = "err"
+	}
+	if limit := parseArg(args, "--limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			fmt.Fprintln(a.errOut, __("Invalid line limit: %s", limit))
+			return 1
+		}
+		query["limit"] = n
+	}
+	if slices.Contains(args, "--export") {
+		return a.call("app.logs.export", []any{app, query}, false)
+	}
+
+	follow := slices.Contains(args, "-f") || slices.Contains(args, "--follow")
+	for {
+		resp := a.request("app.logs", []any{app, query})
+		if resp == nil {
+			return 1
+		}
+		var page struct {
+			Lines []struct {
+				TS     int64  `json:"ts"`
+				Stream string `json:"stream"`
+				Text   string `json:"text"`
+			} `json:"lines"`
+			Cursor string `json:"cursor"`
+			More   bool   `json:"more"`
+		}
+		json.Unmarshal(resp.Data, &page)
+		for _, line := range page.Lines {
+			text := line.Text
+			if line.Stream == "err" {
+				text = color(text, ansiRed)
+			}
+			if line.TS > 0 {
+				text = color(time.UnixMilli(line.TS).Format("2006-01-02 15:04:05"), ansiGray) + " " + text
+			}
+			fmt.Fprintln(a.out, text)
+		}
+		if page.Cursor != "" {
+			query["cursor"] = page.Cursor
+		}
+		if page.More {
+			continue
+		}
+		if !follow {
+			return 0
+		}
+		time.Sleep(logFollowInterval)
+	}
+}
+
 func appIsolateAction(a *app, args []string) int {
 	app := appIDArg(a, args)
 	isolated := !slices.Contains(args, "--off")
@@ -594,6 +1354,521 @@ func appPrivilegedAction(a *app, args []string) int {
 	return a.call("app.privileged", []any{app, mode}, false)
 }
 
+// domainFlagArg reads the domain from -d/--domain, else the first bare
+// argument that is not the value of one of valueFlags, else a prompt.
+func (a *app) domainFlagArg(args []string, valueFlags ...string) string {
+	domain := parseArg(args, "-d", "--domain")
+	if domain == "" {
+		for _, flag := range valueFlags {
+			args = withoutFlagValue(args, flag)
+		}
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				domain = arg
+				break
+			}
+		}
+	}
+	if domain == "" {
+		domain = a.question(__("Enter the domain name: "))
+	}
+	return domain
+}
+
+func cacheDiskAction(a *app, args []string) int {
+	size := parseArg(args, "--size")
+	if size == "" {
+		return a.call("cache.disk", []any{map[string]any{}}, false)
+	}
+	mb, err := strconv.Atoi(size)
+	if err != nil || mb < 0 {
+		fmt.Fprintln(a.errOut, __("Invalid cache size: %s", size))
+		return 1
+	}
+	return a.call("cache.disk", []any{map[string]any{"size": mb}}, false)
+}
+
+func cachePurgeAction(a *app, args []string) int {
+	tags := parseArgAll(args, "--tag")
+	url := parseArg(args, "--url")
+	prefix := parseArg(args, "--prefix")
+	domain := a.domainFlagArg(args, "--tag", "--url", "--prefix")
+	opts := map[string]any{}
+	if len(tags) > 0 {
+		opts["tags"] = tags
+	}
+	if url != "" {
+		opts["url"] = url
+	}
+	if prefix != "" {
+		opts["prefix"] = prefix
+	}
+	return a.call("cache.purge", []any{domain, opts}, false)
+}
+
+// domainCacheAction shows the policy when no option is given.
+func domainCacheAction(a *app, args []string) int {
+	ignore := parseArgAll(args, "--ignore-query")
+	cookies := parseArgAll(args, "--cookie")
+	headers := parseArgAll(args, "--header")
+	domain := a.domainFlagArg(args, "--ignore-query", "--cookie", "--header")
+	opts := map[string]any{}
+	if len(ignore) > 0 {
+		opts["ignoreQuery"] = ignore
+	}
+	if len(cookies) > 0 {
+		opts["cookies"] = cookies
+	}
+	if len(headers) > 0 {
+		opts["headers"] = headers
+	}
+	for flag, key := range map[string]string{"--query": "query", "--device": "device", "--debug": "debug", "--reset": "reset"} {
+		if slices.Contains(args, flag) {
+			opts[key] = true
+		}
+	}
+	return a.call("domain.cache", []any{domain, opts}, false)
+}
+
+// domainBackendAction shows the setting when --protocol is missing.
+func domainBackendAction(a *app, args []string) int {
+	protocol := parseArg(args, "--protocol")
+	serverName := parseArg(args, "--server-name")
+	domain := a.domainFlagArg(args, "--protocol", "--server-name")
+	opts := map[string]any{}
+	if protocol != "" {
+		opts["protocol"] = protocol
+	}
+	if serverName != "" {
+		opts["serverName"] = serverName
+	}
+	if slices.Contains(args, "--insecure") {
+		opts["insecure"] = true
+	}
+	if slices.Contains(args, "--grpc-web") {
+		opts["grpcWeb"] = true
+	}
+	return a.call("domain.backend", []any{domain, opts}, false)
+}
+
+func domainMaintenanceAction(a *app, args []string) int {
+	allow := parseArg(args, "--allow")
+	retry := parseArg(args, "--retry-after")
+	domain := a.domainFlagArg(args, "--allow", "--retry-after")
+	on := !slices.Contains(args, "--off")
+	return a.call("domain.maintenance", []any{domain, on, allow, retry}, false)
+}
+
+// domainMTLSAction reads the CA bundle locally; --optional or --require
+// alone changes the mode of an existing setup.
+func domainMTLSAction(a *app, args []string) int {
+	domain := a.domainFlagArg(args, "--ca")
+	if slices.Contains(args, "--off") {
+		return a.call("domain.mtls", []any{domain, map[string]any{"off": true}}, false)
+	}
+	opts := map[string]any{}
+	if file := parseArg(args, "--ca"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(a.errOut, err)
+			return 1
+		}
+		opts["ca"] = string(data)
+	}
+	if slices.Contains(args, "--optional") {
+		opts["mode"] = "optional"
+	} else if slices.Contains(args, "--require") {
+		opts["mode"] = "require"
+	}
+	return a.call("domain.mtls", []any{domain, opts}, false)
+}
+
+func tunnelAddAction(a *app, args []string) int {
+	app := parseArg(args, "-a", "--app")
+	relay := parseArg(args, "--relay")
+	token := parseArg(args, "--token")
+	domain := a.domainFlagArg(args, "-a", "--app", "--relay", "--token")
+	if app == "" {
+		app = a.question(__("Enter the App ID or Name: "))
+	}
+	if relay == "" {
+		relay = a.question(__("Enter the relay URL: "))
+	}
+	if token == "" {
+		token = a.question(__("Enter the agent token: "))
+	}
+	return a.call("tunnel.add", []any{domain, app, relay, token}, false)
+}
+
+// secretNameArg reads the secret name from -n/--name or the first
+// positional argument, asking for it when neither is given.
+func (a *app) secretNameArg(args []string, valueFlags ...string) string {
+	name := parseArg(args, "-n", "--name")
+	if name == "" {
+		for _, flag := range valueFlags {
+			args = withoutFlagValue(args, flag)
+		}
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				name = arg
+				break
+			}
+		}
+	}
+	if name == "" {
+		name = a.question(__("Enter the secret name: "))
+	}
+	return name
+}
+
+// secretSetAction takes the value from --value, a --file or, so it stays
+// out of the shell history, a prompt asked twice.
+func secretSetAction(a *app, args []string) int {
+	name := a.secretNameArg(args, "-v", "--value", "--file")
+	value := parseArg(args, "-v", "--value")
+	if file := parseArg(args, "--file"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(a.errOut, err)
+			return 1
+		}
+		value = string(data)
+	}
+	if value == "" {
+		value = a.question(__("Enter the secret value: "))
+		if a.question(__("Re-enter the secret value: ")) != value {
+			fmt.Fprintln(a.out, __("Values do not match."))
+			return 1
+		}
+	}
+	return a.call("secret.set", []any{name, value}, false)
+}
+
+func sslCAAddAction(a *app, args []string) int {
+	name := a.nameArg(args, __("Enter the CA name: "))
+	opts := map[string]any{}
+	for _, f := range []struct{ flag, key string }{{"--directory", "directory"}, {"--eab-kid", "kid"}, {"--eab-hmac", "hmacKey"}} {
+		if value := parseArg(args, f.flag); value != "" {
+			opts[f.key] = value
+		}
+	}
+	return a.call("ssl.ca.add", []any{name, opts}, false)
+}
+
+// sslSettingsAction changes only the settings named on the command line;
+// with none it shows them. "default" goes back to the inherited value.
+func sslSettingsAction(a *app, args []string) int {
+	domain := parseArg(args, "-d", "--domain")
+	opts := map[string]any{}
+	if ca := parseArg(args, "--ca"); ca != "" {
+		if ca == "default" {
+			ca = ""
+		}
+		opts["ca"] = ca
+	}
+	if keyType := parseArg(args, "--key-type"); keyType != "" {
+		if keyType == "default" {
+			keyType = ""
+		}
+		opts["keyType"] = keyType
+	}
+	return a.call("ssl.settings", []any{domain, opts}, false)
+}
+
+// sslImportAction sends the contents of the PEM files, which only need to
+// be readable on this machine.
+func sslImportAction(a *app, args []string) int {
+	domain := a.domainFlagArg(args, "--cert", "--key", "--chain")
+	if slices.Contains(args, "--remove") {
+		return a.call("ssl.import", []any{domain, map[string]any{"remove": true}}, false)
+	}
+	if parseArg(args, "--cert") == "" || parseArg(args, "--key") == "" {
+		fmt.Fprintln(a.out, __("Both --cert and --key are required."))
+		return 1
+	}
+	opts := map[string]any{}
+	for _, f := range []struct{ flag, key string }{{"--cert", "cert"}, {"--key", "key"}, {"--chain", "chain"}} {
+		file := parseArg(args, f.flag)
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(a.errOut, err)
+			return 1
+		}
+		opts[f.key] = string(data)
+	}
+	return a.call("ssl.import", []any{domain, opts}, false)
+}
+
+func auditAction(a *app, args []string) int {
+	query := map[string]any{}
+	for _, key := range []string{"since", "action"} {
+		if v := parseArg(args, "--"+key); v != "" {
+			query[key] = v
+		}
+	}
+	if limit := parseArg(args, "--limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			fmt.Fprintln(a.errOut, __("Invalid limit: %s", limit))
+			return 1
+		}
+		query["limit"] = n
+	}
+	return a.call("audit.list", []any{query}, false)
+}
+
+// nameArg reads a name from -n/--name or the first positional argument,
+// asking with prompt when neither is given.
+func (a *app) nameArg(args []string, prompt string) string {
+	name := parseArg(args, "-n", "--name")
+	if name == "" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name = args[0]
+	}
+	if name == "" {
+		name = a.question(prompt)
+	}
+	return name
+}
+
+// alertChannelAddAction asks for the target the channel type needs.
+func alertChannelAddAction(a *app, args []string) int {
+	name := a.nameArg(args, __("Enter the channel name: "))
+	kind := parseArg(args, "--type")
+	if kind == "" {
+		kind = a.question(__("Enter the channel type (webhook, slack, discord or email): "))
+	}
+	opts := map[string]any{"type": kind}
+	if kind == "email" {
+		for _, f := range []struct{ flag, key, prompt string }{
+			{"--to", "to", __("Enter the recipient address: ")},
+			{"--from", "from", __("Enter the sender address: ")},
+		} {
+			value := parseArg(args, f.flag)
+			if value == "" {
+				value = a.question(f.prompt)
+			}
+			opts[f.key] = value
+		}
+	} else {
+		url := parseArg(args, "--url")
+		if url == "" {
+			url = a.question(__("Enter the webhook URL: "))
+		}
+		opts["url"] = url
+	}
+	return a.call("alert.channel.add", []any{name, opts}, false)
+}
+
+// alertRuleSetAction sends only the settings named on the command line, so
+// a built-in rule can be tuned one field at a time.
+func alertRuleSetAction(a *app, args []string) int {
+	name := a.nameArg(args, __("Enter the rule name: "))
+	opts := map[string]any{}
+	for _, f := range []struct{ flag, key string }{{"--event", "event"}, {"--match", "match"}, {"--cooldown", "cooldown"}} {
+		if value := parseArg(args, f.flag); value != "" {
+			opts[f.key] = value
+		}
+	}
+	if threshold := parseArg(args, "--threshold"); threshold != "" {
+		n, err := strconv.ParseFloat(threshold, 64)
+		if err != nil || n < 0 {
+			fmt.Fprintln(a.errOut, __("Invalid threshold: %s", threshold))
+			return 1
+		}
+		opts["threshold"] = n
+	}
+	if channels := parseArgAll(args, "--channel"); len(channels) > 0 {
+		list := make([]any, len(channels))
+		for i, c := range channels {
+			list[i] = c
+		}
+		opts["channels"] = list
+	} else if slices.Contains(args, "--all-channels") {
+		opts["channels"] = []any{}
+	}
+	switch {
+	case slices.Contains(args, "--disable"):
+		opts["disabled"] = true
+	case slices.Contains(args, "--enable"):
+		opts["disabled"] = false
+	}
+	return a.call("alert.rule.set", []any{name, opts}, false)
+}
+
+// tokenCreateAction collects the repeatable flags; --allow also takes a
+// comma-separated list, like odac app api.
+func tokenCreateAction(a *app, args []string) int {
+	rest := args
+	for _, flag := range []string{"--allow", "--app", "--domain", "--expires"} {
+		rest = withoutFlagValue(rest, flag)
+	}
+	name := a.nameArg(rest, __("Enter the token name: "))
+	raw := strings.Join(parseArgAll(args, "--allow"), ",")
+	if raw == "" {
+		raw = a.question(__("Enter the API actions to allow (comma-separated, or * for all): "))
+	}
+	var allow []any
+	for _, action := range splitActions(raw) {
+		allow = append(allow, action)
+	}
+	opts := map[string]any{"allow": allow}
+	for _, f := range []struct{ flag, key string }{{"--app", "apps"}, {"--domain", "domains"}} {
+		if values := parseArgAll(args, f.flag); len(values) > 0 {
+			list := make([]any, len(values))
+			for i, v := range values {
+				list[i] = v
+			}
+			opts[f.key] = list
+		}
+	}
+	if expires := parseArg(args, "--expires"); expires != "" {
+		opts["expires"] = expires
+	}
+	return a.call("token.create", []any{name, opts}, false)
+}
+
+func streamAddAction(a *app, args []string) int {
+	rest := args
+	for _, flag := range []string{"--listen", "-a", "--app", "--port", "--tls", "--domain"} {
+		rest = withoutFlagValue(rest, flag)
+	}
+	name := a.nameArg(rest, __("Enter the stream name: "))
+	listen := parseArg(args, "--listen")
+	if listen == "" {
+		listen = a.question(__("Enter the port to listen on: "))
+	}
+	appID := parseArg(args, "-a", "--app")
+	if appID == "" {
+		appID = a.question(__("Enter the App ID or Name: "))
+	}
+	opts := map[string]any{"app": appID}
+	for _, f := range []struct{ flag, key string }{{"--port", "port"}, {"--tls", "tls"}, {"--domain", "domain"}} {
+		if v := parseArg(args, f.flag); v != "" {
+			opts[f.key] = v
+		}
+	}
+	if slices.Contains(args, "--udp") {
+		opts["udp"] = true
+	}
+	return a.call("stream.add", []any{name, listen, opts}, false)
+}
+
+// logSinkAddAction sends only what was given, leaving defaults (every app,
+// daemon logs included) to the server.
+func logSinkAddAction(a *app, args []string) int {
+	headers, err := keyValueArgs(args, "--header")
+	if err != nil {
+		fmt.Fprintln(a.errOut, err)
+		return 1
+	}
+	labels, err := keyValueArgs(args, "--label")
+	if err != nil {
+		fmt.Fprintln(a.errOut, err)
+		return 1
+	}
+	name := a.nameArg(args, __("Enter the sink name: "))
+	kind := parseArg(args, "--type")
+	if kind == "" {
+		kind = a.question(__("Enter the sink type (syslog, loki or otlp): "))
+	}
+	url := parseArg(args, "--url")
+	if url == "" {
+		url = a.question(__("Enter the sink URL: "))
+	}
+	opts := map[string]any{"type": kind, "url": url}
+	if len(headers) > 0 {
+		opts["headers"] = headers
+	}
+	if len(labels) > 0 {
+		opts["labels"] = labels
+	}
+	if apps := parseArgAll(args, "--app"); len(apps) > 0 {
+		list := make([]any, len(apps))
+		for i, app := range apps {
+			list[i] = app
+		}
+		opts["apps"] = list
+	}
+	if slices.Contains(args, "--no-daemon") {
+		opts["daemon"] = false
+	}
+	return a.call("log.sink.add", []any{name, opts}, false)
+}
+
+// logLabelAction takes KEY=VALUE pairs after the app; an empty value
+// removes that label, and no pairs shows the current ones.
+func logLabelAction(a *app, args []string) int {
+	app := parseArg(args, "-a", "--app")
+	labels := map[string]any{}
+	for _, arg := range withoutFlagValue(withoutFlagValue(args, "-a"), "--app") {
+		key, value, ok := strings.Cut(arg, "=")
+		switch {
+		case !ok && app == "":
+			app = arg
+		case !ok || key == "":
+			fmt.Fprintln(a.errOut, __("Expected KEY=VALUE: %s", arg))
+			return 1
+		case value == "":
+			labels[key] = nil
+		default:
+			labels[key] = value
+		}
+	}
+	if app == "" {
+		app = a.question(__("Enter the App ID or Name: "))
+	}
+	return a.call("log.label", []any{app, labels}, false)
+}
+
+// domainAuthSetAction sends only the settings named on the command line, so
+// a rule can be changed one aspect at a time.
+func domainAuthSetAction(a *app, args []string) int {
+	valueFlags := []string{"--path", "--allow", "--forward", "--uri", "--headers", "--realm"}
+	domain := a.domainFlagArg(args, valueFlags...)
+	opts := map[string]any{}
+	for _, f := range []struct {
+		flag, key string
+		value     any
+	}{
+		{"--basic", "basic", true}, {"--no-basic", "basic", false},
+		{"--public", "public", true}, {"--no-public", "public", false},
+		{"--no-allow", "allow", ""}, {"--no-forward", "forward", ""},
+	} {
+		if slices.Contains(args, f.flag) {
+			opts[f.key] = f.value
+		}
+	}
+	for _, flag := range valueFlags[1:] {
+		if v := parseArg(args, flag); v != "" {
+			opts[strings.TrimPrefix(flag, "--")] = v
+		}
+	}
+	return a.call("domain.auth.set", []any{domain, parseArg(args, "--path"), opts}, false)
+}
+
+func domainAuthUserAction(a *app, args []string) int {
+	domain := a.domainFlagArg(args, "-u", "--user", "-p", "--password")
+	user := parseArg(args, "-u", "--user")
+	if user == "" {
+		user = a.question(__("Enter the user name: "))
+	}
+	if slices.Contains(args, "--delete") {
+		return a.call("domain.auth.user", []any{domain, user, "", true}, false)
+	}
+	password := parseArg(args, "-p", "--password")
+	if password == "" {
+		password = a.question(__("Enter the password: "))
+		if a.question(__("Re-enter the password: ")) != password {
+			fmt.Fprintln(a.out, __("Passwords do not match."))
+			return 1
+		}
+	}
+	return a.call("domain.auth.user", []any{domain, user, password, false}, false)
+}
+
 func nullable(s string) any {
 	if s == "" {
 		return nil
@@ -2,8 +2,11 @@ package main
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"odac/internal/apiproto"
@@ -29,24 +32,113 @@ func TestDispatchActionsAndData(t *testing.T) {
 		wantAction string
 		wantData   []any
 	}{
+		{"alert channel add", []string{"alert", "channel", "add", "ops", "--type", "slack", "--url", "secret://slack-hook"}, "",
+			"alert.channel.add", []any{"ops", map[string]any{"type": "slack", "url": "secret://slack-hook"}}},
+		{"alert channel add email", []string{"alert", "channel", "add", "-n", "mail", "--type", "email", "--to", "ops@example.com"}, "alerts@example.com\n",
+			"alert.channel.add", []any{"mail", map[string]any{"type": "email", "to": "ops@example.com", "from": "alerts@example.com"}}},
+		{"alert channel delete", []string{"alert", "channel", "delete", "ops"}, "", "alert.channel.delete", []any{"ops"}},
+		{"alert rule set", []string{"alert", "rule", "set", "ssl.failed", "--threshold", "1", "--cooldown", "2h", "--channel", "ops", "--channel", "mail", "--disable"}, "",
+			"alert.rule.set", []any{"ssl.failed", map[string]any{"threshold": float64(1), "cooldown": "2h", "channels": []any{"ops", "mail"}, "disabled": true}}},
+		{"alert rule set all channels", []string{"alert", "rule", "set", "-n", "web-down", "--event", "app.*", "--match", "web", "--all-channels", "--enable"}, "",
+			"alert.rule.set", []any{"web-down", map[string]any{"event": "app.*", "match": "web", "channels": []any{}, "disabled": false}}},
+		{"alert rule delete", []string{"alert", "rule", "delete", "web-down"}, "", "alert.rule.delete", []any{"web-down"}},
+		{"alert rule list", []string{"alert", "rule", "list"}, "", "alert.rule.list", []any{}},
+		{"alert test all", []string{"alert", "test"}, "", "alert.test", []any{""}},
+		{"alert test one", []string{"alert", "test", "ops"}, "", "alert.test", []any{"ops"}},
+		{"alert history", []string{"alert", "history"}, "", "alert.history", []any{}},
+		{"audit", []string{"audit"}, "", "audit.list", []any{map[string]any{}}},
+		{"audit filtered", []string{"audit", "--since", "1d", "--action", "app.*", "--limit", "20"}, "",
+			"audit.list", []any{map[string]any{"since": "1d", "action": "app.*", "limit": float64(20)}}},
 		{"app list", []string{"app", "list"}, "", "app.list", []any{}},
 		{"app delete positional", []string{"app", "delete", "42"}, "", "app.delete", []any{"42"}},
 		{"app delete flag", []string{"app", "delete", "-i", "42"}, "", "app.delete", []any{"42"}},
 		{"app restart", []string{"app", "restart", "blog"}, "", "app.restart", []any{"blog"}},
+		{"app redeploy", []string{"app", "redeploy", "blog"}, "", "app.redeploy", []any{"blog"}},
+		{"app redeploy commit", []string{"app", "redeploy", "-b", "release", "blog", "--commit", "0a1b2c3"}, "",
+			"app.redeploy", []any{"blog", map[string]any{"branch": "release", "commit": "0a1b2c3"}}},
 		{"app start", []string{"app", "start", "blog"}, "", "app.start", []any{"blog"}},
 		{"app stop", []string{"app", "stop", "blog"}, "", "app.stop", []any{"blog"}},
+		{"app build show", []string{"app", "build", "web"}, "", "app.build", []any{"web"}},
+		{"app build changes", []string{"app", "build", "-i", "web", "--arg", "NODE_ENV=production", "--arg", "API=https://x/?a=b",
+			"--secret", "NPM_TOKEN=npm-token", "--unset", "OLD", "--cache", "512"}, "",
+			"app.build", []any{"web", map[string]any{
+				"args":    map[string]any{"NODE_ENV": "production", "API": "https://x/?a=b"},
+				"secrets": map[string]any{"NPM_TOKEN": "npm-token"},
+				"unset":   []any{"OLD"},
+				"cache":   float64(512),
+			}}},
+		{"app build cache default", []string{"app", "build", "web", "--cache", "default"}, "",
+			"app.build", []any{"web", map[string]any{"cache": nil}}},
+		{"app cache clear", []string{"app", "cache", "clear", "web"}, "", "app.cache.clear", []any{"web"}},
+		{"app logs tail", []string{"app", "logs", "web"}, "", "app.logs", []any{"web", map[string]any{}}},
+		{"app logs query", []string{"app", "logs", "--since", "2h", "-i", "web", "--grep", "time(out|d)", "--stderr", "--limit", "50"}, "",
+			"app.logs", []any{"web", map[string]any{"since": "2h", "grep": "time(out|d)", "stream": "err", "limit": float64(50)}}},
+		{"app logs export", []string{"app", "logs", "web", "--since", "1d", "--until", "2026-07-01T00:00:00Z", "--export"}, "",
+			"app.logs.export", []any{"web", map[string]any{"since": "1d", "until": "2026-07-01T00:00:00Z"}}},
+		{"app ondemand", []string{"app", "ondemand", "saas", "--ask", "/check", "--allow", "*.customers.test", "--allow", "shop.example.com", "--limit", "50"}, "",
+			"app.ondemand", []any{"saas", map[string]any{"ask": "/check", "allow": []any{"*.customers.test", "shop.example.com"}, "limit": float64(50)}}},
+		{"app ondemand show", []string{"app", "ondemand", "-i", "saas"}, "",
+			"app.ondemand", []any{"saas"}},
+		{"app ondemand off", []string{"app", "ondemand", "saas", "--off"}, "",
+			"app.ondemand", []any{"saas", map[string]any{"enabled": false}}},
+		{"app preview enable", []string{"app", "preview", "enable", "web", "--ttl", "24"}, "",
+			"app.preview", []any{"web", map[string]any{"enabled": true, "ttl": float64(24)}}},
+		{"app preview disable", []string{"app", "preview", "disable", "-i", "web"}, "",
+			"app.preview", []any{"web", map[string]any{"enabled": false}}},
+		{"app preview create", []string{"app", "preview", "create", "web", "feature/login"}, "",
+			"app.preview.create", []any{"web", "feature/login"}},
+		{"app preview create opts", []string{"app", "preview", "create", "--env", "DEBUG=1", "web", "-b", "fix-1", "--token", "tok"}, "",
+			"app.preview.create", []any{"web", "fix-1", map[string]any{"env": map[string]any{"DEBUG": "1"}, "token": "tok"}}},
+		{"app preview delete", []string{"app", "preview", "delete", "web", "feature/login"}, "",
+			"app.preview.delete", []any{"web", "feature/login"}},
+		{"app preview list all", []string{"app", "preview", "list"}, "", "app.preview.list", []any{}},
+		{"app preview list app", []string{"app", "preview", "list", "web"}, "", "app.preview.list", []any{"web"}},
 		{"app device add", []string{"app", "device", "add", "blog", "/dev/ttyACM0"}, "",
 			"app.device.add", []any{"blog", "/dev/ttyACM0"}},
 		{"app device delete flags", []string{"app", "device", "delete", "-a", "blog", "-d", "/dev/x"}, "",
 			"app.device.delete", []any{"blog", "/dev/x"}},
+		{"cache disk", []string{"cache", "disk"}, "", "cache.disk", []any{map[string]any{}}},
+		{"cache disk size", []string{"cache", "disk", "--size", "4096"}, "", "cache.disk", []any{map[string]any{"size": float64(4096)}}},
+		{"cache purge domain", []string{"cache", "purge", "example.com"}, "", "cache.purge", []any{"example.com", map[string]any{}}},
+		{"cache purge filters", []string{"cache", "purge", "--tag", "article-42", "-d", "example.com", "--tag", "home", "--url", "/about", "--prefix", "/feed/"}, "",
+			"cache.purge", []any{"example.com", map[string]any{"tags": []any{"article-42", "home"}, "url": "/about", "prefix": "/feed/"}}},
+		{"cache purge positional tag", []string{"cache", "purge", "--tag", "home", "example.com"}, "",
+			"cache.purge", []any{"example.com", map[string]any{"tags": []any{"home"}}}},
 		{"domain add positional", []string{"domain", "add", "example.com", "blog"}, "",
 			"domain.add", []any{"example.com", "blog"}},
 		{"domain add flags", []string{"domain", "add", "-d", "example.com", "-a", "blog"}, "",
 			"domain.add", []any{"example.com", "blog"}},
+		{"domain backend", []string{"domain", "backend", "-d", "grpc.example.com", "--protocol", "h2c", "--grpc-web"}, "",
+			"domain.backend", []any{"grpc.example.com", map[string]any{"protocol": "h2c", "grpcWeb": true}}},
+		{"domain backend https", []string{"domain", "backend", "example.com", "--protocol", "https", "--insecure", "--server-name", "app.internal"}, "",
+			"domain.backend", []any{"example.com", map[string]any{"protocol": "https", "insecure": true, "serverName": "app.internal"}}},
+		{"domain cache", []string{"domain", "cache", "example.com"}, "", "domain.cache", []any{"example.com", map[string]any{}}},
+		{"domain cache flags", []string{"domain", "cache", "-d", "example.com", "--ignore-query", "utm_*", "--ignore-query", "fbclid", "--query", "--cookie", "currency", "--header", "Accept-Language", "--device", "--debug"}, "",
+			"domain.cache", []any{"example.com", map[string]any{"ignoreQuery": []any{"utm_*", "fbclid"}, "query": true, "cookies": []any{"currency"}, "headers": []any{"Accept-Language"}, "device": true, "debug": true}}},
+		{"domain cache reset", []string{"domain", "cache", "--reset", "example.com"}, "", "domain.cache", []any{"example.com", map[string]any{"reset": true}}},
 		{"domain delete", []string{"domain", "delete", "example.com"}, "", "domain.delete", []any{"example.com"}},
 		{"domain list bare", []string{"domain", "list"}, "", "domain.list", []any{}},
 		{"domain list filtered", []string{"domain", "list", "blog"}, "", "domain.list", []any{"blog"}},
 		{"dns list", []string{"dns", "list", "example.com"}, "", "dns.list", []any{"example.com"}},
+		{"firewall ban", []string{"firewall", "ban", "203.0.113.0/24", "--for", "7d", "--reason", "scanner"}, "",
+			"firewall.ban", []any{"203.0.113.0/24", "7d", "scanner"}},
+		{"firewall ban interactive", []string{"firewall", "ban"}, "198.51.100.7\n",
+			"firewall.ban", []any{"198.51.100.7", "", ""}},
+		{"firewall unban", []string{"firewall", "unban", "-i", "198.51.100.7"}, "", "firewall.unban", []any{"198.51.100.7"}},
+		{"firewall list", []string{"firewall", "list"}, "", "firewall.list", []any{}},
+		{"log sink add", []string{"log", "sink", "add", "loki", "--type", "loki", "--url", "https://loki.example.com/loki/api/v1/push",
+			"--header", "Authorization=secret://loki-token", "--label", "env=prod", "--app", "web", "--app", "api", "--no-daemon"}, "",
+			"log.sink.add", []any{"loki", map[string]any{
+				"type": "loki", "url": "https://loki.example.com/loki/api/v1/push",
+				"headers": map[string]any{"Authorization": "secret://loki-token"}, "labels": map[string]any{"env": "prod"},
+				"apps": []any{"web", "api"}, "daemon": false,
+			}}},
+		{"log sink add interactive", []string{"log", "sink", "add"}, "central\nsyslog\ntls://logs.example.com\n",
+			"log.sink.add", []any{"central", map[string]any{"type": "syslog", "url": "tls://logs.example.com"}}},
+		{"log sink delete", []string{"log", "sink", "delete", "-n", "loki"}, "", "log.sink.delete", []any{"loki"}},
+		{"log sink list", []string{"log", "sink", "list"}, "", "log.sink.list", []any{}},
+		{"log label", []string{"log", "label", "web", "team=core", "tier="}, "", "log.label", []any{"web", map[string]any{"team": "core", "tier": nil}}},
+		{"log label show", []string{"log", "label", "-a", "web"}, "", "log.label", []any{"web", map[string]any{}}},
 		{"mail create flags skip confirm", []string{"mail", "create", "-e", "a@x.com", "-p", "pw"}, "",
 			"mail.create", []any{"a@x.com", "pw", "pw"}},
 		{"mail create interactive", []string{"mail", "create"}, "a@x.com\npw1\npw2\n",
@@ -55,7 +147,60 @@ func TestDispatchActionsAndData(t *testing.T) {
 		{"mail list", []string{"mail", "list", "-d", "x.com"}, "", "mail.list", []any{"x.com"}},
 		{"mail password", []string{"mail", "password", "-e", "a@x.com", "-p", "np"}, "",
 			"mail.password", []any{"a@x.com", "np", "np"}},
+		{"domain maintenance on", []string{"domain", "maintenance", "-d", "example.com", "--on", "--allow", "203.0.113.7"}, "",
+			"domain.maintenance", []any{"example.com", true, "203.0.113.7", ""}},
+		{"domain mtls off", []string{"domain", "mtls", "-d", "example.com", "--off"}, "", "domain.mtls", []any{"example.com", map[string]any{"off": true}}},
+		{"domain mtls mode", []string{"domain", "mtls", "example.com", "--optional"}, "", "domain.mtls", []any{"example.com", map[string]any{"mode": "optional"}}},
+		{"domain maintenance off positional", []string{"domain", "maintenance", "--retry-after", "600", "example.com", "--off"}, "",
+			"domain.maintenance", []any{"example.com", false, "", "600"}},
+		{"domain auth set", []string{"domain", "auth", "set", "example.com", "--path", "/admin", "--basic", "--allow", "10.0.0.0/8", "--no-forward"}, "",
+			"domain.auth.set", []any{"example.com", "/admin", map[string]any{"basic": true, "allow": "10.0.0.0/8", "forward": ""}}},
+		{"domain auth set forward", []string{"domain", "auth", "set", "--forward", "sso", "--uri", "/verify", "-d", "example.com"}, "",
+			"domain.auth.set", []any{"example.com", "", map[string]any{"forward": "sso", "uri": "/verify"}}},
+		{"domain auth user interactive", []string{"domain", "auth", "user", "example.com", "-u", "alice"}, "s3cret-pw\ns3cret-pw\n",
+			"domain.auth.user", []any{"example.com", "alice", "s3cret-pw", false}},
+		{"domain auth user delete", []string{"domain", "auth", "user", "-d", "example.com", "--user", "alice", "--delete"}, "",
+			"domain.auth.user", []any{"example.com", "alice", "", true}},
+		{"domain auth remove", []string{"domain", "auth", "remove", "example.com", "--path", "/admin"}, "",
+			"domain.auth.remove", []any{"example.com", "/admin"}},
+		{"domain auth list", []string{"domain", "auth", "list", "example.com"}, "", "domain.auth.list", []any{"example.com"}},
+		{"domain relay", []string{"domain", "relay", "-d", "office.example.com"}, "", "domain.relay", []any{"office.example.com"}},
+		{"tunnel add", []string{"tunnel", "add", "office.example.com", "-a", "blog", "--relay", "https://office.example.com", "--token", "abc"}, "",
+			"tunnel.add", []any{"office.example.com", "blog", "https://office.example.com", "abc"}},
+		{"tunnel add interactive", []string{"tunnel", "add", "-d", "office.example.com"}, "blog\nwss://relay.example.com\nabc\n",
+			"tunnel.add", []any{"office.example.com", "blog", "wss://relay.example.com", "abc"}},
+		{"tunnel delete", []string{"tunnel", "delete", "office.example.com"}, "", "tunnel.delete", []any{"office.example.com"}},
+		{"tunnel list", []string{"tunnel", "list"}, "", "tunnel.list", []any{}},
+		{"secret set", []string{"secret", "set", "db-password", "-v", "hunter2"}, "", "secret.set", []any{"db-password", "hunter2"}},
+		{"secret set interactive", []string{"secret", "set", "-n", "api-key"}, "k3y\nk3y\n", "secret.set", []any{"api-key", "k3y"}},
+		{"secret delete", []string{"secret", "delete", "db-password"}, "", "secret.delete", []any{"db-password"}},
+		{"secret list", []string{"secret", "list"}, "", "secret.list", []any{}},
+		{"secret rotate", []string{"secret", "rotate"}, "", "secret.rotate", []any{}},
+		{"ssl ca add", []string{"ssl", "ca", "add", "zerossl", "--eab-kid", "kid-1", "--eab-hmac", "secret://zerossl-hmac"}, "",
+			"ssl.ca.add", []any{"zerossl", map[string]any{"kid": "kid-1", "hmacKey": "secret://zerossl-hmac"}}},
+		{"ssl ca add custom", []string{"ssl", "ca", "add", "-n", "step", "--directory", "https://ca.internal/acme/acme/directory"}, "",
+			"ssl.ca.add", []any{"step", map[string]any{"directory": "https://ca.internal/acme/acme/directory"}}},
+		{"ssl ca delete", []string{"ssl", "ca", "delete", "step"}, "", "ssl.ca.delete", []any{"step"}},
+		{"ssl ca list", []string{"ssl", "ca", "list"}, "", "ssl.ca.list", []any{}},
 		{"ssl renew", []string{"ssl", "renew", "-d", "example.com"}, "", "ssl.renew", []any{"example.com"}},
+		{"ssl settings", []string{"ssl", "settings", "-d", "example.com", "--ca", "zerossl,letsencrypt", "--key-type", "rsa2048"}, "",
+			"ssl.settings", []any{"example.com", map[string]any{"ca": "zerossl,letsencrypt", "keyType": "rsa2048"}}},
+		{"ssl settings default", []string{"ssl", "settings", "--key-type", "default"}, "", "ssl.settings", []any{"", map[string]any{"keyType": ""}}},
+		{"ssl import remove", []string{"ssl", "import", "example.com", "--remove"}, "", "ssl.import", []any{"example.com", map[string]any{"remove": true}}},
+		{"stream add", []string{"stream", "add", "postgres", "--listen", "5432", "-a", "db"}, "",
+			"stream.add", []any{"postgres", "5432", map[string]any{"app": "db"}}},
+		{"stream add tls", []string{"stream", "add", "--listen", "8443", "--app", "web", "--port", "443", "--tls", "passthrough", "--domain", "a.example.com", "web-a"}, "",
+			"stream.add", []any{"web-a", "8443", map[string]any{"app": "web", "port": "443", "tls": "passthrough", "domain": "a.example.com"}}},
+		{"stream add udp interactive", []string{"stream", "add", "--udp", "-n", "game"}, "27015\ngame\n",
+			"stream.add", []any{"game", "27015", map[string]any{"app": "game", "udp": true}}},
+		{"stream delete", []string{"stream", "delete", "postgres"}, "", "stream.delete", []any{"postgres"}},
+		{"stream list", []string{"stream", "list"}, "", "stream.list", []any{}},
+		{"token create", []string{"token", "create", "--name", "ci", "--allow", "app.redeploy", "--app", "web", "--app", "api", "--expires", "90d"}, "",
+			"token.create", []any{"ci", map[string]any{"allow": []any{"app.redeploy"}, "apps": []any{"web", "api"}, "expires": "90d"}}},
+		{"token create interactive", []string{"token", "create", "--domain", "example.com", "deploy"}, "app.redeploy, domain.add\n",
+			"token.create", []any{"deploy", map[string]any{"allow": []any{"app.redeploy", "domain.add"}, "domains": []any{"example.com"}}}},
+		{"token list", []string{"token", "list"}, "", "token.list", []any{}},
+		{"token revoke", []string{"token", "revoke", "ci"}, "", "token.revoke", []any{"ci"}},
 		{"auth positional", []string{"auth", "SECRETKEY"}, "", "auth", []any{"SECRETKEY"}},
 		{"auth interactive", []string{"auth"}, "typedkey\n", "auth", []any{"typedkey"}},
 		{"update", []string{"update"}, "", "update", []any{}},
@@ -127,6 +272,11 @@ func TestAppCreateVariants(t *testing.T) {
 			[]any{map[string]any{"type": "git", "url": "https://github.com/x/repo.git", "name": "repo", "dev": false}}},
 		{"scp-style git url", []string{"app", "create", "git@github.com:x/repo.git", "-D"}, "",
 			[]any{map[string]any{"type": "git", "url": "git@github.com:x/repo.git", "name": "repo", "dev": true}}},
+		{"monorepo path", []string{"app", "create", "https://git.example.com/team/mono.git", "--path", "services/api"}, "",
+			[]any{map[string]any{"type": "git", "url": "https://git.example.com/team/mono.git", "name": "mono", "dev": false, "path": "services/api"}}},
+		{"build args and secrets", []string{"app", "create", "https://git.example.com/a/web.git", "--build-arg", "NODE_ENV=production", "--build-secret", "NPM_TOKEN=npm-token"}, "",
+			[]any{map[string]any{"type": "git", "url": "https://git.example.com/a/web.git", "name": "web", "dev": false,
+				"build": map[string]any{"args": map[string]any{"NODE_ENV": "production"}, "secrets": map[string]any{"NPM_TOKEN": "npm-token"}}}}},
 		{"dev app type", []string{"app", "create", "node", "-D"}, "",
 			[]any{map[string]any{"type": "app", "app": "node", "dev": true}}},
 		{"plain type string", []string{"app", "create", "node"}, "", []any{"node"}},
@@ -153,6 +303,135 @@ func TestAppCreateVariants(t *testing.T) {
 	}
 }
 
+func TestAppCreateGitSSHShowsDeployKey(t *testing.T) {
+	hosts := filepath.Join(t.TempDir(), "known_hosts")
+	os.WriteFile(hosts, []byte("git.example.com ssh-ed25519 AAAA\n"), 0o644)
+
+	var actions []string
+	var data [][]any
+	var mu sync.Mutex
+	addr := fakeServer(t, func(req apiproto.Request, conn net.Conn) {
+		mu.Lock()
+		actions = append(actions, req.Action)
+		data = append(data, req.Data)
+		mu.Unlock()
+		conn.Write([]byte(`{"id":"r","result":true,"message":"ok"}`))
+	})
+	a, _, errOut := testApp(t, addr)
+	a.in = strings.NewReader("\n")
+	argv := []string{"app", "create", "git", "-u", "git@git.example.com:team/mono.git", "-n", "api", "--known-hosts", hosts}
+	if code := a.run(argv); code != 0 {
+		t.Fatalf("exit = %d, stderr: %s", code, errOut)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(actions, []string{"app.deploykey", "app.create"}) {
+		t.Fatalf("actions = %v", actions)
+	}
+	if !reflect.DeepEqual(data[0], []any{"api", "git.example.com ssh-ed25519 AAAA\n"}) {
+		t.Errorf("deploykey data = %#v", data[0])
+	}
+	if config, _ := data[1][0].(map[string]any); config["knownHosts"] != "git.example.com ssh-ed25519 AAAA\n" {
+		t.Errorf("create data = %#v", data[1])
+	}
+}
+
+func TestAppCreateFromFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "shop")
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "stack.json"), []byte(`{"image":"redis:7"}`), 0o644)
+	compose := "services:\n  web:\n    image: nginx\n"
+	os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(compose), 0o644)
+
+	tests := []struct {
+		name string
+		argv []string
+		want map[string]any
+	}{
+		{"recipe", []string{"app", "create", "--recipe", filepath.Join(dir, "stack.json"), "-n", "cache"},
+			map[string]any{"type": "app", "app": "stack", "recipe": map[string]any{"image": "redis:7"}, "name": "cache"}},
+		{"compose", []string{"app", "create", "--compose", filepath.Join(dir, "docker-compose.yml")},
+			map[string]any{"type": "compose", "compose": compose, "project": "shop"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, last := recordingServer(t)
+			a, _, errOut := testApp(t, addr)
+			if code := a.run(tt.argv); code != 0 {
+				t.Fatalf("exit = %d, stderr: %s", code, errOut)
+			}
+			if !reflect.DeepEqual(last.Data, []any{tt.want}) {
+				t.Errorf("data = %#v", last.Data)
+			}
+		})
+	}
+
+	addr, _ := recordingServer(t)
+	a, _, _ := testApp(t, addr)
+	if code := a.run([]string{"app", "create", "--recipe", filepath.Join(dir, "missing.json")}); code == 0 {
+		t.Error("missing recipe file accepted")
+	}
+}
+
+func TestSecretSetFromFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(file, []byte("-----BEGIN KEY-----\n"), 0o600)
+
+	addr, last := recordingServer(t)
+	a, _, errOut := testApp(t, addr)
+	if code := a.run([]string{"secret", "set", "tls-key", "--file", file}); code != 0 {
+		t.Fatalf("exit = %d, stderr: %s", code, errOut)
+	}
+	if !reflect.DeepEqual(last.Data, []any{"tls-key", "-----BEGIN KEY-----\n"}) {
+		t.Errorf("data = %#v", last.Data)
+	}
+
+	a, out, _ := testApp(t, addr)
+	a.in = strings.NewReader("one\ntwo\n")
+	if code := a.run([]string{"secret", "set", "x"}); code == 0 || !strings.Contains(out.String(), "do not match") {
+		t.Errorf("mismatched values accepted: %s", out)
+	}
+}
+
+func TestCertificateFilesAreSent(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"crt.pem": "CERT", "key.pem": "KEY", "chain.pem": "CHAIN", "ca.pem": "CA"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+	}
+	tests := []struct {
+		name string
+		argv []string
+		want []any
+	}{
+		{"ssl import", []string{"ssl", "import", "-d", "example.com", "--cert", filepath.Join(dir, "crt.pem"), "--key", filepath.Join(dir, "key.pem"), "--chain", filepath.Join(dir, "chain.pem")},
+			[]any{"example.com", map[string]any{"cert": "CERT", "key": "KEY", "chain": "CHAIN"}}},
+		{"domain mtls", []string{"domain", "mtls", "--ca", filepath.Join(dir, "ca.pem"), "example.com"},
+			[]any{"example.com", map[string]any{"ca": "CA"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, last := recordingServer(t)
+			a, _, errOut := testApp(t, addr)
+			if code := a.run(tt.argv); code != 0 {
+				t.Fatalf("exit = %d, stderr: %s", code, errOut)
+			}
+			if !reflect.DeepEqual(last.Data, tt.want) {
+				t.Errorf("data = %#v", last.Data)
+			}
+		})
+	}
+
+	addr, last := recordingServer(t)
+	a, _, _ := testApp(t, addr)
+	if code := a.run([]string{"ssl", "import", "-d", "example.com", "--cert", filepath.Join(dir, "crt.pem")}); code == 0 || last.Action != "" {
+		t.Error("import without a key sent")
+	}
+	if code := a.run([]string{"ssl", "import", "-d", "example.com", "--cert", filepath.Join(dir, "crt.pem"), "--key", filepath.Join(dir, "missing.pem")}); code == 0 || last.Action != "" {
+		t.Error("missing key file accepted")
+	}
+}
+
 func TestPrivilegedAbort(t *testing.T) {
 	addr, last := recordingServer(t)
 	a, out, _ := testApp(t, addr)
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/user"
 
 	"odac/internal/apiproto"
 	"odac/internal/config"
@@ -104,7 +105,7 @@ func (a *app) call(action string, data []any, detail bool) int {
 	auth, _ := a.cfg.Map("api")["auth"].(string)
 	r := &renderer{out: a.out, errOut: a.errOut, detail: detail}
 	resp, err := a.client.Call(
-		apiproto.Request{Auth: auth, Action: action, Data: data},
+		apiproto.Request{Auth: auth, Action: action, Data: data, User: cliUser()},
 		r.progress,
 	)
 	if err != nil {
@@ -118,6 +119,43 @@ func (a *app) call(action string, data []any, detail bool) int {
 	return 1
 }
 
+// request performs one request/response cycle for commands that print the
+// response themselves. Failures are reported and yield nil.
+func (a *app) request(action string, data []any) *apiproto.Response {
+	if !a.check() {
+		fmt.Fprintln(a.errOut, "Odac server is not running.")
+		return nil
+	}
+	auth, _ := a.cfg.Map("api")["auth"].(string)
+	resp, err := a.client.Call(apiproto.Request{Auth: auth, Action: action, Data: data, User: cliUser()}, nil)
+	if err != nil {
+		fmt.Fprintln(a.errOut, "Socket error:", err)
+		return nil
+	}
+	if !resp.Result {
+		msg := resp.Message
+		if msg == "" {
+			msg = "Unknown error"
+		}
+		fmt.Fprintln(a.errOut, msg)
+		return nil
+	}
+	return resp
+}
+
+// cliUser names who runs the CLI for the server's audit log, keeping the
+// account sudo was invoked from.
+func cliUser() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if sudo := os.Getenv("SUDO_USER"); sudo != "" && sudo != name {
+		return sudo + " (sudo as " + name + ")"
+	}
+	return name
+}
+
 // parseArgs converts `odac api` arguments to the positional `data` array.
 func parseArgs(rawArgs []string) []any {
 	data := make([]any, 0, len(rawArgs))
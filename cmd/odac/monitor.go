@@ -924,7 +924,7 @@ func (m *monitor) restartSelected(post func(func())) {
 	client := m.a.client
 	go func() {
 		resp, err := client.Call(
-			apiproto.Request{Auth: auth, Action: "app.restart", Data: []any{name}}, nil)
+			apiproto.Request{Auth: auth, Action: "app.restart", Data: []any{name}, User: cliUser()}, nil)
 		var msg string
 		switch {
 		case err != nil:
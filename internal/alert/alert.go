@@ -0,0 +1,313 @@
+// Package alert turns internal events (app crashes, failed builds and
+// starts, SSL renewal failures, memory pressure, resource thresholds, the
+// watchdog giving up) into notifications: a JSON webhook, a Slack or Discord
+// incoming webhook, or an email sent through the local mail server.
+//
+// Every event is matched against the rules; each kind has a built-in rule
+// that configured rules can override or disable. A rule fires when the
+// event's value reaches its threshold and then stays quiet for its cooldown
+// per subject, counting what it held back. Gauge kinds (resource usage,
+// memory pressure) also notify once when they fall back below the
+// threshold. One event reaches a channel at most once, however many rules
+// route it there.
+//
+// Rules and channels live under the "alerts" config key:
+//
+//	{"channels": [{"name", "type", "url", "to", "from"}],
+//	 "rules": [{"name", "event", "match", "threshold", "cooldown", "channels", "disabled"}]}
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odac/internal/api"
+	"odac/internal/config"
+	"odac/internal/logx"
+	"odac/internal/sysinfo"
+)
+
+const (
+	inboxSize      = 1024
+	sampleInterval = time.Minute
+	historySize    = 100
+	sendTimeout    = 10 * time.Second
+)
+
+// Event is one thing that happened. Value is what rule thresholds compare
+// against: a count for crashes and SSL attempts, a percentage for gauges.
+type Event struct {
+	Kind    string    `json:"kind"`
+	Subject string    `json:"subject"`
+	Message string    `json:"message"`
+	Value   float64   `json:"value"`
+	Time    time.Time `json:"time"`
+}
+
+// Mailer sends mail through the local mail server. *dataplane.Mail
+// provides it.
+type Mailer interface {
+	Send(data any, rawData json.RawMessage) api.Result
+}
+
+// SecretRevealer resolves secret:// channel URLs. *secrets.Store provides
+// it.
+type SecretRevealer interface {
+	Reveal(name string) (string, error)
+}
+
+// UsageSampler reports host utilization for the system.* rules.
+// *sysinfo.Info provides it.
+type UsageSampler interface {
+	Usage() sysinfo.Usage
+}
+
+// Deps are the Alerter's collaborators. Any may be nil.
+type Deps struct {
+	Mailer  Mailer
+	Secrets SecretRevealer
+	Usage   UsageSampler
+}
+
+// Alerter evaluates events against the rules and delivers notifications.
+type Alerter struct {
+	cfg      *config.Store
+	deps     Deps
+	hostname string
+	log      *logx.Logger
+	client   *http.Client
+
+	inbox   chan Event
+	dropped atomic.Int64
+
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+	states  map[string]*ruleState
+	history []Record
+}
+
+// ruleState tracks one rule for one subject.
+type ruleState struct {
+	firing     bool
+	sent       time.Time
+	suppressed int
+}
+
+// Record is one entry of the alert history.
+type Record struct {
+	Time     time.Time `json:"time"`
+	Status   string    `json:"status"` // "firing", "resolved" or "suppressed"
+	Kind     string    `json:"kind"`
+	Subject  string    `json:"subject"`
+	Message  string    `json:"message"`
+	Rules    []string  `json:"rules"`
+	Channels []string  `json:"channels,omitempty"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+// New builds an Alerter. Events are only evaluated after Start, except
+// through Deliver.
+func New(cfg *config.Store, deps Deps) *Alerter {
+	hostname, _ := os.Hostname()
+	return &Alerter{
+		cfg:      cfg,
+		deps:     deps,
+		hostname: hostname,
+		log:      logx.New("Alert"),
+		client:   &http.Client{Timeout: sendTimeout},
+		inbox:    make(chan Event, inboxSize),
+		states:   map[string]*ruleState{},
+	}
+}
+
+// Start runs the evaluator and the resource sampler.
+func (a *Alerter) Start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.started {
+		return
+	}
+	a.started = true
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go a.run(a.stop, a.done)
+}
+
+// Stop halts the evaluator. Queued events are discarded.
+func (a *Alerter) Stop() {
+	a.mu.Lock()
+	if !a.started {
+		a.mu.Unlock()
+		return
+	}
+	a.started = false
+	close(a.stop)
+	done := a.done
+	a.mu.Unlock()
+	<-done
+}
+
+// Alert queues an event without blocking; a full queue drops it.
+func (a *Alerter) Alert(kind, subject, message string, value float64) {
+	select {
+	case a.inbox <- Event{Kind: kind, Subject: subject, Message: message, Value: value, Time: time.Now()}:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Deliver evaluates one event right away, for a process that will not live
+// long enough to run the evaluator (the watchdog giving up).
+func (a *Alerter) Deliver(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	a.handle(e)
+}
+
+func (a *Alerter) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	a.sample() // sets the CPU baseline
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-a.inbox:
+			a.handle(e)
+		case <-ticker.C:
+			for _, e := range a.sample() {
+				a.handle(e)
+			}
+		}
+	}
+}
+
+// sample turns host utilization into gauge events.
+func (a *Alerter) sample() []Event {
+	if a.deps.Usage == nil {
+		return nil
+	}
+	u := a.deps.Usage.Usage()
+	now := time.Now()
+	gauge := func(kind, what string, v int) Event {
+		return Event{Kind: kind, Subject: a.hostname, Value: float64(v), Time: now,
+			Message: fmt.Sprintf("%s usage is %d%%.", what, v)}
+	}
+	return []Event{
+		gauge("system.cpu", "CPU", u.CPU),
+		gauge("system.memory", "Memory", u.Memory),
+		gauge("system.disk", "Disk", u.Disk),
+	}
+}
+
+// handle matches an event against the rules, applies cooldowns and sends
+// one notification per channel and status.
+func (a *Alerter) handle(e Event) {
+	rules, channels := a.load()
+	byName := make(map[string]Channel, len(channels))
+	for _, c := range channels {
+		byName[c.Name] = c
+	}
+
+	type batch struct {
+		rules    []string
+		channels []string
+		repeats  int
+	}
+	out := map[string]*batch{}
+	add := func(status string, r Rule, repeats int) {
+		b := out[status]
+		if b == nil {
+			b = &batch{}
+			out[status] = b
+		}
+		b.rules = append(b.rules, r.Name)
+		b.repeats = max(b.repeats, repeats)
+		targets := r.Channels
+		if len(targets) == 0 {
+			for _, c := range channels {
+				targets = append(targets, c.Name)
+			}
+		}
+		for _, name := range targets {
+			if _, ok := byName[name]; ok && !slices.Contains(b.channels, name) {
+				b.channels = append(b.channels, name)
+			}
+		}
+	}
+
+	var held []string
+	a.mu.Lock()
+	for _, r := range rules {
+		if r.Disabled || !r.matches(e) {
+			continue
+		}
+		key := r.Name + "\x00" + e.Subject
+		st := a.states[key]
+		if e.Value < r.Threshold {
+			if st != nil && st.firing && gauges[e.Kind] {
+				st.firing = false
+				add("resolved", r, 0)
+			}
+			continue
+		}
+		if st == nil {
+			st = &ruleState{}
+			a.states[key] = st
+		}
+		if st.firing && e.Time.Sub(st.sent) < r.Cooldown {
+			st.suppressed++
+			held = append(held, r.Name)
+			continue
+		}
+		repeats := st.suppressed
+		st.firing, st.sent, st.suppressed = true, e.Time, 0
+		add("firing", r, repeats)
+	}
+	a.mu.Unlock()
+
+	if len(held) > 0 && len(out) == 0 && !gauges[e.Kind] {
+		a.record(Record{Time: e.Time, Status: "suppressed", Kind: e.Kind, Subject: e.Subject, Message: e.Message, Rules: held})
+	}
+	for _, status := range []string{"firing", "resolved"} {
+		b := out[status]
+		if b == nil {
+			continue
+		}
+		n := notification{Event: e, Status: status, Rules: b.rules, Repeats: b.repeats, Host: a.hostname}
+		rec := Record{Time: e.Time, Status: status, Kind: e.Kind, Subject: e.Subject, Message: e.Message, Rules: b.rules, Channels: b.channels}
+		for _, name := range b.channels {
+			if err := a.send(byName[name], n); err != nil {
+				a.log.Error("Alert to %s failed: %s", name, err.Error())
+				rec.Errors = append(rec.Errors, name+": "+err.Error())
+			}
+		}
+		a.record(rec)
+	}
+}
+
+func (a *Alerter) record(r Record) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.history = append(a.history, r)
+	if len(a.history) > historySize {
+		a.history = a.history[len(a.history)-historySize:]
+	}
+}
+
+// formatValue renders a value without a trailing ".0".
+func formatValue(v float64) string {
+	return strings.TrimSuffix(strconv.FormatFloat(v, 'f', 1, 64), ".0")
+}
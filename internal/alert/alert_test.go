@@ -0,0 +1,211 @@
+package alert
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"odac/internal/api"
+	"odac/internal/config"
+)
+
+type hook struct {
+	srv    *httptest.Server
+	mu     sync.Mutex
+	bodies []map[string]any
+}
+
+func newHook(t *testing.T) *hook {
+	h := &hook{}
+	h.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		json.Unmarshal(raw, &body)
+		h.mu.Lock()
+		h.bodies = append(h.bodies, body)
+		h.mu.Unlock()
+	}))
+	t.Cleanup(h.srv.Close)
+	return h
+}
+
+func (h *hook) received() []map[string]any {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]map[string]any(nil), h.bodies...)
+}
+
+type fakeMailer struct{ sent []map[string]any }
+
+func (f *fakeMailer) Send(data any, _ json.RawMessage) api.Result {
+	f.sent = append(f.sent, data.(map[string]any))
+	return api.Res(true, "Mail sent successfully.")
+}
+
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) Reveal(name string) (string, error) { return f[name], nil }
+
+func newAlerter(t *testing.T, deps Deps) *Alerter {
+	t.Helper()
+	cfg, err := config.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("config.Open: %v", err)
+	}
+	return New(cfg, deps)
+}
+
+func TestThresholdCooldownAndDedup(t *testing.T) {
+	h := newHook(t)
+	a := newAlerter(t, Deps{})
+	if r := a.ChannelAdd("ops", map[string]any{"type": "webhook", "url": h.srv.URL}); !r.Status {
+		t.Fatalf("channel: %v", r.Message)
+	}
+	// A second rule routing the same event to the same channel.
+	if r := a.RuleSet("web-crash", map[string]any{"event": "app.*", "match": "web", "channels": []any{"ops"}}); !r.Status {
+		t.Fatalf("rule: %v", r.Message)
+	}
+
+	at := time.Now()
+	crash := func(n float64) {
+		at = at.Add(time.Minute)
+		a.Deliver(Event{Kind: "app.crashed", Subject: "web", Message: "App web stopped unexpectedly.", Value: n, Time: at})
+	}
+	crash(1) // only the custom rule (threshold 0) fires
+	crash(2) // held by its cooldown; the built-in wants 3
+	crash(3) // the built-in fires; the custom rule is still cooling down
+
+	got := h.received()
+	if len(got) != 2 {
+		t.Fatalf("notifications = %d, want 2: %v", len(got), got)
+	}
+	if got[1]["status"] != "firing" || got[1]["subject"] != "web" || got[1]["value"] != float64(3) {
+		t.Errorf("second notification = %v", got[1])
+	}
+
+	at = at.Add(defaultCooldown)
+	crash(4)
+	got = h.received()
+	if len(got) != 3 {
+		t.Fatalf("after the cooldown: %d notifications", len(got))
+	}
+	// Both rules fired again; the channel heard once, with what was held back.
+	if rules := got[2]["rules"].([]any); len(rules) != 2 || got[2]["repeats"] != float64(2) {
+		t.Errorf("merged notification = %v", got[2])
+	}
+
+	hist := a.History().Data.([]any)
+	if first := hist[0].(Record); first.Status != "firing" || len(first.Channels) != 1 {
+		t.Errorf("history head = %+v", first)
+	}
+}
+
+func TestGaugeResolves(t *testing.T) {
+	h := newHook(t)
+	a := newAlerter(t, Deps{})
+	a.ChannelAdd("ops", map[string]any{"type": "slack", "url": h.srv.URL + "/services/T0/B0/secret"})
+
+	now := time.Now()
+	a.Deliver(Event{Kind: "system.disk", Subject: "host", Message: "Disk usage is 95%.", Value: 95, Time: now})
+	a.Deliver(Event{Kind: "system.disk", Subject: "host", Message: "Disk usage is 96%.", Value: 96, Time: now.Add(time.Minute)})
+	a.Deliver(Event{Kind: "system.disk", Subject: "host", Message: "Disk usage is 50%.", Value: 50, Time: now.Add(2 * time.Minute)})
+	a.Deliver(Event{Kind: "system.disk", Subject: "host", Message: "Disk usage is 40%.", Value: 40, Time: now.Add(3 * time.Minute)})
+
+	got := h.received()
+	if len(got) != 2 {
+		t.Fatalf("notifications = %v", got)
+	}
+	if text, _ := got[0]["text"].(string); !strings.Contains(text, "FIRING system.disk") {
+		t.Errorf("firing text = %q", text)
+	}
+	if text, _ := got[1]["text"].(string); !strings.Contains(text, "RESOLVED system.disk") {
+		t.Errorf("resolved text = %q", text)
+	}
+	if rows := a.Channels().Data.([]any); strings.Contains(rows[0].(map[string]any)["target"].(string), "secret") {
+		t.Errorf("channel list shows the webhook path: %v", rows)
+	}
+}
+
+func TestRuleOverrideDisableAndReset(t *testing.T) {
+	h := newHook(t)
+	a := newAlerter(t, Deps{})
+	a.ChannelAdd("ops", map[string]any{"type": "webhook", "url": h.srv.URL})
+
+	a.RuleSet("ssl.failed", map[string]any{"threshold": float64(1)})
+	a.Deliver(Event{Kind: "ssl.failed", Subject: "example.com", Value: 1})
+	a.RuleSet("ssl.failed", map[string]any{"disabled": true})
+	a.Deliver(Event{Kind: "ssl.failed", Subject: "other.example", Value: 5})
+	if got := h.received(); len(got) != 1 {
+		t.Fatalf("notifications = %v", got)
+	}
+
+	if r := a.RuleDelete("ssl.failed"); !r.Status {
+		t.Errorf("reset: %v", r.Message)
+	}
+	if r := a.RuleDelete("ssl.failed"); r.Status {
+		t.Error("deleted a built-in rule")
+	}
+	rules, _ := a.load()
+	for _, r := range rules {
+		if r.Name == "ssl.failed" && (r.Disabled || r.Threshold != 3) {
+			t.Errorf("not reset: %+v", r)
+		}
+	}
+
+	for _, bad := range []map[string]any{
+		{"threshold": float64(-1)}, {"cooldown": "soon"}, {"channels": []any{"nope"}}, {"event": "["}, {"colour": "red"},
+	} {
+		if r := a.RuleSet("x", bad); r.Status {
+			t.Errorf("accepted %v", bad)
+		}
+	}
+	if r := a.RuleSet("custom", map[string]any{"threshold": float64(2)}); r.Status {
+		t.Error("created a rule without an event")
+	}
+}
+
+func TestEmailAndSecretChannels(t *testing.T) {
+	h := newHook(t)
+	mail := &fakeMailer{}
+	a := newAlerter(t, Deps{Mailer: mail, Secrets: fakeSecrets{"hook": h.srv.URL}})
+	a.ChannelAdd("mail", map[string]any{"type": "email", "to": "ops@example.com", "from": "alerts@example.com"})
+	a.ChannelAdd("chat", map[string]any{"type": "discord", "url": "secret://hook"})
+
+	if r := a.Test(nil); !r.Status {
+		t.Fatalf("test: %v", r.Message)
+	}
+	if len(mail.sent) != 1 || mail.sent[0]["subject"] == "" {
+		t.Errorf("mail = %v", mail.sent)
+	}
+	if got := h.received(); len(got) != 1 || !strings.Contains(got[0]["content"].(string), "TEST") {
+		t.Errorf("discord = %v", got)
+	}
+	if r := a.Test("nope"); r.Status {
+		t.Error("tested an unknown channel")
+	}
+
+	for _, bad := range []map[string]any{
+		{"type": "email", "to": "ops@example.com"},
+		{"type": "webhook", "url": "ftp://example.com"},
+		{"type": "pager", "url": "https://example.com"},
+	} {
+		if r := a.ChannelAdd("bad", bad); r.Status {
+			t.Errorf("accepted %v", bad)
+		}
+	}
+}
+
+func TestAlertNeverBlocks(t *testing.T) {
+	a := newAlerter(t, Deps{})
+	for i := 0; i < inboxSize+10; i++ {
+		a.Alert("app.crashed", "web", "", 1)
+	}
+	if a.dropped.Load() != 10 {
+		t.Errorf("dropped = %d", a.dropped.Load())
+	}
+}
@@ -0,0 +1,144 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"odac/internal/api"
+)
+
+// discordLimit is the longest message Discord accepts.
+const discordLimit = 2000
+
+// notification is what a channel receives for one event.
+type notification struct {
+	Event
+	Status  string   // "firing", "resolved" or "test"
+	Rules   []string // the rules that routed it
+	Repeats int      // events held back by the cooldown since the last notice
+	Host    string
+}
+
+func (n notification) title() string {
+	return fmt.Sprintf("[odac %s] %s %s: %s", n.Host, strings.ToUpper(n.Status), n.Kind, n.Subject)
+}
+
+func (n notification) text() string {
+	var b strings.Builder
+	b.WriteString(n.Message)
+	if n.Repeats > 0 {
+		fmt.Fprintf(&b, "\nHappened %d more times since the last notice.", n.Repeats)
+	}
+	fmt.Fprintf(&b, "\nHost: %s\nTime: %s", n.Host, n.Time.UTC().Format(time.RFC3339))
+	return b.String()
+}
+
+func (a *Alerter) send(c Channel, n notification) error {
+	if c.Type == "email" {
+		return a.sendMail(c, n)
+	}
+	target := c.URL
+	if ref, ok := strings.CutPrefix(target, secretPrefix); ok {
+		if a.deps.Secrets == nil {
+			return errors.New("the secrets store is unavailable")
+		}
+		revealed, err := a.deps.Secrets.Reveal(ref)
+		if err != nil {
+			return err
+		}
+		target = revealed
+	}
+
+	var payload any
+	switch c.Type {
+	case "slack":
+		payload = map[string]string{"text": n.title() + "\n" + n.text()}
+	case "discord":
+		content := "**" + n.title() + "**\n" + n.text()
+		if len(content) > discordLimit {
+			content = content[:discordLimit]
+		}
+		payload = map[string]string{"content": content}
+	default:
+		payload = map[string]any{
+			"status": n.Status, "kind": n.Kind, "subject": n.Subject, "message": n.Message,
+			"value": n.Value, "time": n.Time.UTC().Format(time.RFC3339), "host": n.Host,
+			"rules": n.Rules, "repeats": n.Repeats,
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL may carry a token; report only what went wrong.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			return uerr.Err
+		}
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (a *Alerter) sendMail(c Channel, n notification) error {
+	if a.deps.Mailer == nil {
+		return errors.New("the mail server is unavailable")
+	}
+	title := n.title()
+	r := a.deps.Mailer.Send(map[string]any{
+		"from":    map[string]any{"value": []any{map[string]any{"address": c.From}}},
+		"to":      map[string]any{"value": []any{map[string]any{"address": c.To}}},
+		"header":  map[string]any{"Subject": title},
+		"subject": title,
+		"text":    n.text(),
+	}, nil)
+	if !r.Status {
+		return fmt.Errorf("%v", r.Message)
+	}
+	return nil
+}
+
+// Test sends a test notification to one channel, or to every channel when
+// none is named.
+func (a *Alerter) Test(nameArg any) api.Result {
+	name, _ := nameArg.(string)
+	_, channels := a.load()
+	n := notification{
+		Event:  Event{Kind: "test", Subject: a.hostname, Message: "This is a test alert from ODAC.", Time: time.Now()},
+		Status: "test",
+		Host:   a.hostname,
+	}
+	var sent, failed []string
+	for _, c := range channels {
+		if name != "" && c.Name != name {
+			continue
+		}
+		if err := a.send(c, n); err != nil {
+			failed = append(failed, c.Name+": "+err.Error())
+		} else {
+			sent = append(sent, c.Name)
+		}
+	}
+	switch {
+	case len(sent) == 0 && len(failed) == 0 && name != "":
+		return api.Res(false, __("Alert channel %s not found.", name))
+	case len(sent) == 0 && len(failed) == 0:
+		return api.Res(false, __("No alert channels are configured."))
+	case len(failed) > 0:
+		return api.Res(false, __("Test alert failed: %s", strings.Join(failed, "; ")))
+	}
+	return api.Res(true, __("Test alert sent to %s.", strings.Join(sent, ", ")))
+}
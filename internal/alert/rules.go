@@ -0,0 +1,437 @@
+package alert
+
+import (
+	"errors"
+	"maps"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"odac/internal/api"
+	"odac/internal/lang"
+)
+
+var __ = lang.T
+
+const (
+	configKey       = "alerts"
+	defaultCooldown = 30 * time.Minute
+	secretPrefix    = "secret://"
+)
+
+var (
+	channelNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+	ruleNameRe    = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+)
+
+// Rule routes matching events to channels.
+type Rule struct {
+	Name      string
+	Event     string // kind, or a glob such as "app.*"
+	Match     string // subject glob; empty matches every subject
+	Threshold float64
+	Cooldown  time.Duration
+	Channels  []string // empty for every channel
+	Disabled  bool
+	Builtin   bool
+}
+
+func (r Rule) matches(e Event) bool {
+	if ok, _ := path.Match(r.Event, e.Kind); !ok {
+		return false
+	}
+	if r.Match == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Match, e.Subject)
+	return ok
+}
+
+// builtins cover every kind ODAC emits. A configured rule of the same name
+// overrides the fields it sets.
+var builtins = []Rule{
+	{Name: "app.crashed", Event: "app.crashed", Threshold: 3},
+	{Name: "app.start_failed", Event: "app.start_failed", Threshold: 1},
+	{Name: "app.build_failed", Event: "app.build_failed", Threshold: 1},
+	{Name: "ssl.failed", Event: "ssl.failed", Threshold: 3},
+	{Name: "ssl.expiring", Event: "ssl.expiring", Threshold: 1},
+	{Name: "swap.pressure", Event: "swap.pressure", Threshold: 90},
+	{Name: "system.cpu", Event: "system.cpu", Threshold: 90},
+	{Name: "system.memory", Event: "system.memory", Threshold: 90},
+	{Name: "system.disk", Event: "system.disk", Threshold: 90},
+	{Name: "watchdog.gave_up", Event: "watchdog.gave_up", Threshold: 1},
+}
+
+// gauges are sampled kinds: their value can fall back below a threshold,
+// which resolves the alert.
+var gauges = map[string]bool{"swap.pressure": true, "system.cpu": true, "system.memory": true, "system.disk": true}
+
+func builtin(name string) (Rule, bool) {
+	for _, r := range builtins {
+		if r.Name == name {
+			r.Builtin, r.Cooldown = true, defaultCooldown
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// applyRule layers a stored rule's fields over base.
+func applyRule(base Rule, raw map[string]any) Rule {
+	if v, ok := raw["event"].(string); ok && v != "" {
+		base.Event = v
+	}
+	if v, ok := raw["match"].(string); ok {
+		base.Match = v
+	}
+	if v, ok := raw["threshold"].(float64); ok {
+		base.Threshold = v
+	}
+	if v, ok := raw["cooldown"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			base.Cooldown = d
+		}
+	}
+	if list, ok := raw["channels"].([]any); ok {
+		base.Channels = nil
+		for _, c := range list {
+			if name, _ := c.(string); name != "" {
+				base.Channels = append(base.Channels, name)
+			}
+		}
+	}
+	if v, ok := raw["disabled"].(bool); ok {
+		base.Disabled = v
+	}
+	return base
+}
+
+// Channel is one notification target.
+type Channel struct {
+	Name string
+	Type string // "webhook", "slack", "discord" or "email"
+	URL  string // may be a secret:// reference
+	To   string
+	From string
+}
+
+func validateChannel(c Channel) error {
+	if !channelNameRe.MatchString(c.Name) {
+		return errors.New(__("Invalid channel name. Use up to 32 lowercase letters, digits and hyphens."))
+	}
+	switch c.Type {
+	case "webhook", "slack", "discord":
+		if strings.HasPrefix(c.URL, secretPrefix) {
+			return nil
+		}
+		if u, err := url.Parse(c.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.New(__("A %s channel needs an http:// or https:// URL, or a secret:// reference.", c.Type))
+		}
+	case "email":
+		if !strings.Contains(c.To, "@") || !strings.Contains(c.From, "@") {
+			return errors.New(__("An email channel needs a to and a from address."))
+		}
+	default:
+		return errors.New(__("Unknown channel type %s. Use webhook, slack, discord or email.", c.Type))
+	}
+	return nil
+}
+
+// load reads the channels and the effective rules: the built-ins with
+// their overrides, then the custom rules.
+func (a *Alerter) load() ([]Rule, []Channel) {
+	var rawRules, rawChannels []any
+	a.cfg.View(func() {
+		settings := a.cfg.Map(configKey)
+		rawRules, _ = settings["rules"].([]any)
+		rawChannels, _ = settings["channels"].([]any)
+	})
+
+	var channels []Channel
+	for _, item := range rawChannels {
+		raw, _ := item.(map[string]any)
+		c := Channel{}
+		c.Name, _ = raw["name"].(string)
+		c.Type, _ = raw["type"].(string)
+		c.URL, _ = raw["url"].(string)
+		c.To, _ = raw["to"].(string)
+		c.From, _ = raw["from"].(string)
+		if validateChannel(c) == nil {
+			channels = append(channels, c)
+		}
+	}
+
+	stored := map[string]map[string]any{}
+	var order []string
+	for _, item := range rawRules {
+		raw, _ := item.(map[string]any)
+		name, _ := raw["name"].(string)
+		if name != "" && stored[name] == nil {
+			stored[name] = raw
+			order = append(order, name)
+		}
+	}
+	var rules []Rule
+	for _, b := range builtins {
+		r, _ := builtin(b.Name)
+		if raw := stored[b.Name]; raw != nil {
+			r = applyRule(r, raw)
+		}
+		rules = append(rules, r)
+	}
+	for _, name := range order {
+		if _, ok := builtin(name); ok {
+			continue
+		}
+		r := applyRule(Rule{Name: name, Cooldown: defaultCooldown}, stored[name])
+		if r.Event != "" {
+			rules = append(rules, r)
+		}
+	}
+	return rules, channels
+}
+
+// ChannelAdd creates or replaces a channel. opts holds type and url, or to
+// and from for email.
+func (a *Alerter) ChannelAdd(nameArg, optsArg any) api.Result {
+	name, _ := nameArg.(string)
+	opts, _ := optsArg.(map[string]any)
+	c := Channel{Name: name}
+	c.Type, _ = opts["type"].(string)
+	c.URL, _ = opts["url"].(string)
+	c.To, _ = opts["to"].(string)
+	c.From, _ = opts["from"].(string)
+	if err := validateChannel(c); err != nil {
+		return api.Res(false, err.Error())
+	}
+	entry := map[string]any{"name": c.Name, "type": c.Type}
+	if c.Type == "email" {
+		entry["to"], entry["from"] = c.To, c.From
+	} else {
+		entry["url"] = c.URL
+	}
+
+	replaced := false
+	a.cfg.Mutate(func() {
+		settings := a.cfg.Map(configKey)
+		if settings == nil {
+			settings = map[string]any{}
+		}
+		list, _ := settings["channels"].([]any)
+		next := make([]any, 0, len(list)+1)
+		for _, item := range list {
+			if raw, _ := item.(map[string]any); raw != nil && raw["name"] == c.Name {
+				replaced = true
+				continue
+			}
+			next = append(next, item)
+		}
+		settings["channels"] = append(next, entry)
+		a.cfg.Set(configKey, settings)
+	})
+	if replaced {
+		return api.Res(true, __("Alert channel %s updated.", c.Name))
+	}
+	return api.Res(true, __("Alert channel %s added.", c.Name))
+}
+
+// ChannelDelete removes a channel. Rules naming it skip it from then on.
+func (a *Alerter) ChannelDelete(nameArg any) api.Result {
+	name, _ := nameArg.(string)
+	found := false
+	a.cfg.Mutate(func() {
+		settings := a.cfg.Map(configKey)
+		list, _ := settings["channels"].([]any)
+		next := make([]any, 0, len(list))
+		for _, item := range list {
+			if raw, _ := item.(map[string]any); raw != nil && raw["name"] == name {
+				found = true
+				continue
+			}
+			next = append(next, item)
+		}
+		if found {
+			settings["channels"] = next
+			a.cfg.Set(configKey, settings)
+		}
+	})
+	if !found {
+		return api.Res(false, __("Alert channel %s not found.", name))
+	}
+	return api.Res(true, __("Alert channel %s deleted.", name))
+}
+
+// Channels lists the channels. Webhook URLs are cut to their host, since
+// Slack and Discord carry the token in the path.
+func (a *Alerter) Channels() api.Result {
+	_, channels := a.load()
+	rows := []any{}
+	for _, c := range channels {
+		target := c.To
+		if c.Type != "email" {
+			target = displayURL(c.URL)
+		}
+		rows = append(rows, map[string]any{"name": c.Name, "type": c.Type, "target": target, "from": c.From})
+	}
+	return api.Res(true, rows)
+}
+
+func displayURL(raw string) string {
+	if strings.HasPrefix(raw, secretPrefix) {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if u.Path == "" || u.Path == "/" {
+		return u.Scheme + "://" + u.Host
+	}
+	return u.Scheme + "://" + u.Host + "/..."
+}
+
+// RuleSet creates a rule or changes the given fields of one. opts may hold
+// event, match, threshold, cooldown (a duration such as "30m"), channels
+// and disabled. A new rule needs an event.
+func (a *Alerter) RuleSet(nameArg, optsArg any) api.Result {
+	name, _ := nameArg.(string)
+	if !ruleNameRe.MatchString(name) {
+		return api.Res(false, __("Invalid rule name. Use lowercase letters, digits, dots, hyphens and underscores."))
+	}
+	opts, _ := optsArg.(map[string]any)
+	changes := map[string]any{}
+	for key, v := range opts {
+		switch key {
+		case "event", "match":
+			pattern, ok := v.(string)
+			if _, err := path.Match(pattern, ""); !ok || err != nil || (key == "event" && pattern == "") {
+				return api.Res(false, __("Invalid %s pattern.", key))
+			}
+		case "threshold":
+			if n, ok := v.(float64); !ok || n < 0 {
+				return api.Res(false, __("Threshold must be a number of at least 0."))
+			}
+		case "cooldown":
+			s, _ := v.(string)
+			if d, err := time.ParseDuration(s); err != nil || d < 0 {
+				return api.Res(false, __("Invalid cooldown %s. Use a duration such as 30m or 2h.", s))
+			}
+		case "channels":
+			list, ok := v.([]any)
+			if !ok {
+				return api.Res(false, __("Channels must be a list of channel names."))
+			}
+			_, channels := a.load()
+			for _, c := range list {
+				if !slices.ContainsFunc(channels, func(ch Channel) bool { return ch.Name == c }) {
+					return api.Res(false, __("Alert channel %s not found.", c))
+				}
+			}
+		case "disabled":
+			if _, ok := v.(bool); !ok {
+				return api.Res(false, __("disabled must be true or false."))
+			}
+		default:
+			return api.Res(false, __("Unknown rule setting %s.", key))
+		}
+		changes[key] = v
+	}
+
+	_, isBuiltin := builtin(name)
+	ok := true
+	a.cfg.Mutate(func() {
+		settings := a.cfg.Map(configKey)
+		if settings == nil {
+			settings = map[string]any{}
+		}
+		list, _ := settings["rules"].([]any)
+		var entry map[string]any
+		for _, item := range list {
+			if raw, _ := item.(map[string]any); raw != nil && raw["name"] == name {
+				entry = raw
+			}
+		}
+		if entry == nil {
+			if !isBuiltin && changes["event"] == nil {
+				ok = false
+				return
+			}
+			entry = map[string]any{"name": name}
+			list = append(list, entry)
+		}
+		maps.Copy(entry, changes)
+		settings["rules"] = list
+		a.cfg.Set(configKey, settings)
+	})
+	if !ok {
+		return api.Res(false, __("A new rule needs an event."))
+	}
+	return api.Res(true, __("Alert rule %s saved.", name))
+}
+
+// RuleDelete removes a custom rule, or resets a built-in one.
+func (a *Alerter) RuleDelete(nameArg any) api.Result {
+	name, _ := nameArg.(string)
+	found := false
+	a.cfg.Mutate(func() {
+		settings := a.cfg.Map(configKey)
+		list, _ := settings["rules"].([]any)
+		next := make([]any, 0, len(list))
+		for _, item := range list {
+			if raw, _ := item.(map[string]any); raw != nil && raw["name"] == name {
+				found = true
+				continue
+			}
+			next = append(next, item)
+		}
+		if found {
+			settings["rules"] = next
+			a.cfg.Set(configKey, settings)
+		}
+	})
+	_, isBuiltin := builtin(name)
+	switch {
+	case found && isBuiltin:
+		return api.Res(true, __("Alert rule %s reset to its default.", name))
+	case found:
+		return api.Res(true, __("Alert rule %s deleted.", name))
+	case isBuiltin:
+		return api.Res(false, __("Alert rule %s is built in. Disable it instead.", name))
+	}
+	return api.Res(false, __("Alert rule %s not found.", name))
+}
+
+// Rules lists the effective rules.
+func (a *Alerter) Rules() api.Result {
+	rules, _ := a.load()
+	rows := []any{}
+	for _, r := range rules {
+		channels := "*"
+		if len(r.Channels) > 0 {
+			channels = strings.Join(r.Channels, ",")
+		}
+		source := "custom"
+		if r.Builtin {
+			source = "built-in"
+		}
+		rows = append(rows, map[string]any{
+			"name": r.Name, "event": r.Event, "match": r.Match, "threshold": formatValue(r.Threshold),
+			"cooldown": r.Cooldown.String(), "channels": channels, "enabled": !r.Disabled, "source": source,
+		})
+	}
+	return api.Res(true, rows)
+}
+
+// History lists recent alerts, newest first.
+func (a *Alerter) History() api.Result {
+	a.mu.Lock()
+	rows := make([]any, 0, len(a.history))
+	for i := len(a.history) - 1; i >= 0; i-- {
+		rows = append(rows, a.history[i])
+	}
+	a.mu.Unlock()
+	return api.Res(true, rows)
+}
@@ -79,6 +79,19 @@ func (a Args) Raw(i int) json.RawMessage {
 	return a.raw[i]
 }
 
+// Caller identifies who issued a command, for the audit log.
+type Caller struct {
+	Kind string `json:"kind"`           // "root", "domain", "app", "token", "hub" or "anonymous"
+	Name string `json:"name,omitempty"` // the domain, app name, token name or Hub request ID
+	User string `json:"user,omitempty"` // the OS user the CLI reported, root only
+}
+
+// Auditor records handled commands; *audit.Log implements it. r is nil when
+// the handler returned nothing.
+type Auditor interface {
+	Record(source, action string, caller Caller, args []any, r *Result)
+}
+
 // Handler executes one action. A nil *Result reproduces Node's undefined
 // spread ({"id":"..."} only — server.stop does this); a non-nil error maps
 // to result(false, err.message || 'error').
@@ -94,10 +107,13 @@ type Server struct {
 	// the zero-downtime handover and applies either way.
 	Addr string
 
+	auditor Auditor
+
 	mu       sync.Mutex
 	commands map[string]Handler
-	tokens   map[string]string // domain token -> domain
-	allowed  map[string]bool   // runtime IP allowlist (Allow/Disallow)
+	tokens   map[string]string    // domain token -> domain
+	used     map[string]time.Time // named token -> last lastUsed write
+	allowed  map[string]bool      // runtime IP allowlist (Allow/Disallow)
 	tcp      net.Listener
 	unix     net.Listener
 	started  bool
@@ -111,6 +127,7 @@ func NewServer(cfg *config.Store) *Server {
 		log:      logx.New("Api"),
 		commands: map[string]Handler{},
 		tokens:   map[string]string{},
+		used:     map[string]time.Time{},
 		allowed:  map[string]bool{},
 	}
 }
@@ -123,6 +140,9 @@ func (s *Server) Register(action string, h Handler) {
 	s.mu.Unlock()
 }
 
+// SetAuditor wires the audit log. Call it before Start.
+func (s *Server) SetAuditor(a Auditor) { s.auditor = a }
+
 // SocketPath returns the unix socket path (<base>/run/api.sock).
 func (s *Server) SocketPath() string {
 	return filepath.Join(s.cfg.BaseDir(), "run", "api.sock")
@@ -138,16 +158,21 @@ func (s *Server) HostSocketDir() string {
 // appDeniedActions are actions an app token may never call, whatever its
 // grant says. Two kinds live here: the server's own lifecycle and identity
 // (update restarts it, server.stop takes the platform down, auth re-points
-// its Cloud pairing), and the two that hand out privilege (app.privileged
+// its Cloud pairing), and those that hand out privilege (app.privileged
 // elevates a container to root or full Docker privileged; app.api rewrites
 // the grants this table protects, so an app holding it could simply widen
-// itself). Nothing an app legitimately automates needs them.
+// itself; token.create mints a key as wide as the caller asks, token.list
+// and token.revoke reach every other token). Nothing an app legitimately
+// automates needs them. Named tokens are held to the same table.
 var appDeniedActions = map[string]bool{
 	"auth":           true,
 	"update":         true,
 	"server.stop":    true,
 	"app.privileged": true,
 	"app.api":        true,
+	"token.create":   true,
+	"token.list":     true,
+	"token.revoke":   true,
 }
 
 // AppMayCall reports whether an app token is ever allowed to call an action.
@@ -429,6 +454,7 @@ func (s *Server) handleRequest(c *apiConn, id string, raw json.RawMessage) bool
 		Auth   any               `json:"auth"`
 		Action any               `json:"action"`
 		Data   []json.RawMessage `json:"data"`
+		User   any               `json:"user"`
 	}
 	// A valid JSON document that is not an object destructures to all-
 	// undefined in Node ({auth, action, data} = payload || {}); a failed
@@ -438,17 +464,26 @@ func (s *Server) handleRequest(c *apiConn, id string, raw json.RawMessage) bool
 	auth, _ := payload.Auth.(string)
 	action, _ := payload.Action.(string)
 
-	// Auth logic: root vs client (domain token vs app token).
+	// Auth logic: root vs client (domain token, named token or app token).
 	isRoot := false
 	isApp := false
+	var named *namedToken
 	clientDomain := ""
 	var appPermissions any
 
+	caller := Caller{Kind: "anonymous"}
+
 	rootKey := s.authKey()
 	if rootKey != "" && constantTimeEqual(auth, rootKey) {
 		isRoot = true
+		caller.Kind = "root"
+		caller.User, _ = payload.User.(string)
 	} else if domain, ok := s.lookupToken(auth); ok {
 		clientDomain = domain
+		caller = Caller{Kind: "domain", Name: domain}
+	} else if named = s.lookupNamed(auth); named != nil {
+		clientDomain = "token " + named.name
+		caller = Caller{Kind: "token", Name: named.name}
 	} else if appAuth := s.verifyAppToken(auth); appAuth != nil {
 		name, _ := appAuth["n"].(string)
 		var app map[string]any
@@ -471,11 +506,13 @@ func (s *Server) handleRequest(c *apiConn, id string, raw json.RawMessage) bool
 		if app == nil {
 			s.log.Warn(fmt.Sprintf("Rejected app token: App '%s' not found or inactive", name))
 			r := Res(false, "unauthorized")
+			s.audit(action, Caller{Kind: "app", Name: name}, nil, &r)
 			c.write(encodeFinal(id, true, &r))
 			return false
 		}
 		isApp = true
 		clientDomain = name
+		caller = Caller{Kind: "app", Name: name}
 		// Deviation from Node, which trusted the token's own "p" claim: the
 		// grant lives in config.apps[].api and is read per request, so
 		// revoking one lands on the next call instead of surviving in an
@@ -485,6 +522,7 @@ func (s *Server) handleRequest(c *apiConn, id string, raw json.RawMessage) bool
 		appPermissions = livePerms
 	} else {
 		r := Res(false, "unauthorized")
+		s.audit(action, caller, nil, &r)
 		c.write(encodeFinal(id, true, &r))
 		return false
 	}
@@ -494,18 +532,20 @@ func (s *Server) handleRequest(c *apiConn, id string, raw json.RawMessage) bool
 	s.mu.Unlock()
 	if action == "" || handler == nil {
 		r := Res(false, "unknown_action")
+		s.audit(action, caller, nil, &r)
 		c.write(encodeFinal(id, true, &r))
 		return false
 	}
 
-	// RBAC: domain tokens may only mail.send; app tokens carry an explicit
-	// permission list ('*' wildcard or the literal true for everything),
-	// minus the actions no grant can ever cover.
+	// RBAC: domain tokens may only mail.send; app and named tokens carry an
+	// explicit permission list ('*' wildcard or, for apps, the literal true
+	// for everything), minus the actions no grant can ever cover.
 	if !isRoot {
 		allowed := false
-		if isApp && !AppMayCall(action) {
+		if (isApp || named != nil) && !AppMayCall(action) {
 			s.log.Warn(fmt.Sprintf("Blocked restricted action '%s' from app '%s'", action, clientDomain))
 			r := Res(false, "permission_denied")
+			s.audit(action, caller, nil, &r)
 			c.write(encodeFinal(id, true, &r))
 			return false
 		}
@@ -521,12 +561,15 @@ func (s *Server) handleRequest(c *apiConn, id string, raw json.RawMessage) bool
 					}
 				}
 			}
+		} else if named != nil {
+			allowed = named.allows(action)
 		} else if action == "mail.send" {
 			allowed = true
 		}
 		if !allowed {
 			s.log.Warn(fmt.Sprintf("Blocked unauthorized action '%s' from '%s'", action, clientDomain))
 			r := Res(false, "permission_denied")
+			s.audit(action, caller, nil, &r)
 			c.write(encodeFinal(id, true, &r))
 			return false
 		}
@@ -536,6 +579,13 @@ func (s *Server) handleRequest(c *apiConn, id string, raw json.RawMessage) bool
 	for i, rawArg := range payload.Data {
 		json.Unmarshal(rawArg, &args.values[i]) // failure leaves nil (undefined)
 	}
+	if named != nil && !s.inScope(named, action, args) {
+		s.log.Warn(fmt.Sprintf("Blocked out-of-scope action '%s' from %s", action, clientDomain))
+		r := Res(false, "permission_denied")
+		s.audit(action, caller, args.values, &r)
+		c.write(encodeFinal(id, true, &r))
+		return false
+	}
 	progress := func(process, status, message any) {
 		c.write(encodeProgress(process, status, message))
 	}
@@ -547,13 +597,21 @@ func (s *Server) handleRequest(c *apiConn, id string, raw json.RawMessage) bool
 			msg = "error"
 		}
 		r := Res(false, msg)
+		s.audit(action, caller, args.values, &r)
 		c.write(encodeFinal(id, true, &r))
 		return true
 	}
+	s.audit(action, caller, args.values, result)
 	c.write(encodeFinal(id, true, result))
 	return true
 }
 
+func (s *Server) audit(action string, caller Caller, args []any, r *Result) {
+	if s.auditor != nil {
+		s.auditor.Record("api", action, caller, args, r)
+	}
+}
+
 // runHandler converts a handler panic into Node's thrown-error path
 // (result(false, err.message)). This is NOT a keep-alive recover — Node
 // wrapped every command in try/catch, so a failing handler answers the
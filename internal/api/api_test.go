@@ -8,7 +8,9 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -506,3 +508,147 @@ func TestResNormalization(t *testing.T) {
 }
 
 func ptr(r Result) *Result { return &r }
+
+type auditCall struct {
+	action string
+	caller Caller
+	args   []any
+	status bool
+}
+
+type fakeAuditor struct {
+	mu    sync.Mutex
+	calls []auditCall
+}
+
+func (f *fakeAuditor) Record(_, action string, caller Caller, args []any, r *Result) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, auditCall{action, caller, args, r != nil && r.Status})
+}
+
+func TestAuditRecordsCallerAndOutcome(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Set("domains", map[string]any{"example.com": map[string]any{}})
+	auditor := &fakeAuditor{}
+	s.SetAuditor(auditor)
+	s.Init()
+	s.Start()
+	t.Cleanup(s.Stop)
+	waitListening(t, s)
+	s.Register("app.stop", func(_ Args, _ Progress) (*Result, error) {
+		r := Res(true, "stopped")
+		return &r, nil
+	})
+
+	raw, _ := json.Marshal(map[string]any{"auth": fixtureKey, "action": "app.stop", "data": []any{"web"}, "user": "alice"})
+	call(t, "tcp", tcpAddr(s), string(raw))
+	call(t, "tcp", tcpAddr(s), request(fixtureDomainToken, "app.stop", "web"))
+	call(t, "tcp", tcpAddr(s), request("wrong", "app.stop"))
+
+	want := []auditCall{
+		{"app.stop", Caller{Kind: "root", User: "alice"}, []any{"web"}, true},
+		{"app.stop", Caller{Kind: "domain", Name: "example.com"}, nil, false},
+		{"app.stop", Caller{Kind: "anonymous"}, nil, false},
+	}
+	auditor.mu.Lock()
+	defer auditor.mu.Unlock()
+	if !reflect.DeepEqual(auditor.calls, want) {
+		t.Errorf("audit = %+v", auditor.calls)
+	}
+}
+
+func TestNamedTokens(t *testing.T) {
+	s := startTestServer(t)
+	s.cfg.Set("apps", []any{
+		map[string]any{"id": float64(1), "name": "web", "active": true},
+		map[string]any{"id": float64(2), "name": "shop", "active": true},
+	})
+	ok := func(_ Args, _ Progress) (*Result, error) {
+		r := Res(true, "ok")
+		return &r, nil
+	}
+	for _, action := range []string{"app.redeploy", "app.restart", "app.list", "domain.add", "mail.create", "token.create", "token.list", "token.revoke"} {
+		s.Register(action, ok)
+	}
+
+	for _, action := range []string{"token.create", "token.list", "token.revoke"} {
+		if r := s.TokenCreate("ci", map[string]any{"allow": []any{action}}); r.Status {
+			t.Errorf("granted %s to a token", action)
+		}
+	}
+	if r := s.TokenCreate("ci", map[string]any{"allow": []any{"app.nope"}}); r.Status {
+		t.Error("granted an unknown action")
+	}
+	if r := s.TokenCreate("ci", map[string]any{"allow": []any{"app.redeploy", "app.list"}, "apps": []any{"web"}}); r.Status {
+		t.Error("granted a scoped token an action that names no app")
+	}
+	r := s.TokenCreate("ci", map[string]any{"allow": []any{"app.redeploy", "domain.add"}, "apps": []any{"web"}})
+	if !r.Status {
+		t.Fatalf("create = %v", r.Message)
+	}
+	token := r.Data.(map[string]any)["token"].(string)
+	if r := s.TokenCreate("ci", map[string]any{"allow": "*"}); r.Status {
+		t.Error("created a second token with the same name")
+	}
+	raw, _ := json.Marshal(s.cfg.Map("api")["tokens"])
+	if strings.Contains(string(raw), token) || !strings.Contains(string(raw), hashToken(token)) {
+		t.Errorf("stored = %s", raw)
+	}
+
+	for _, c := range []struct {
+		action string
+		args   []any
+		want   string
+	}{
+		{"app.redeploy", []any{"web"}, `"result":true`},
+		{"app.redeploy", []any{float64(1)}, `"result":true`},
+		{"app.redeploy", []any{"shop"}, "permission_denied"},
+		{"app.restart", []any{"web"}, "permission_denied"},
+		{"app.list", nil, "permission_denied"},
+		{"domain.add", []any{"example.com", "web"}, `"result":true`},
+		{"domain.add", []any{"example.com", "shop"}, "permission_denied"},
+		{"token.create", []any{"more", map[string]any{"allow": "*"}}, "permission_denied"},
+		{"token.revoke", []any{"mail"}, "permission_denied"},
+	} {
+		lines := call(t, "tcp", tcpAddr(s), request(token, c.action, c.args...))
+		if !strings.Contains(lines[0], c.want) {
+			t.Errorf("%s %v = %v, want %s", c.action, c.args, lines, c.want)
+		}
+	}
+	if used := s.TokenList().Data.([]any)[0].(map[string]any)["lastUsed"]; used == "never" {
+		t.Error("lastUsed not recorded")
+	}
+
+	r = s.TokenCreate("mail", map[string]any{"allow": []any{"mail.create"}, "domains": []any{"Example.com"}})
+	mailToken := r.Data.(map[string]any)["token"].(string)
+	if lines := call(t, "tcp", tcpAddr(s), request(mailToken, "mail.create", "a@mx.example.com", "p", "p")); !strings.Contains(lines[0], `"result":true`) {
+		t.Errorf("subdomain mailbox = %v", lines)
+	}
+	if lines := call(t, "tcp", tcpAddr(s), request(mailToken, "mail.create", "a@example.org", "p", "p")); !strings.Contains(lines[0], "permission_denied") {
+		t.Errorf("other domain mailbox = %v", lines)
+	}
+
+	if r := s.TokenRevoke("ci"); !r.Status {
+		t.Fatalf("revoke = %v", r.Message)
+	}
+	if lines := call(t, "tcp", tcpAddr(s), request(token, "app.redeploy", "web")); !strings.Contains(lines[0], "unauthorized") {
+		t.Errorf("revoked token = %v", lines)
+	}
+
+	r = s.TokenCreate("short", map[string]any{"allow": "*", "expires": "1h"})
+	short := r.Data.(map[string]any)["token"].(string)
+	if lines := call(t, "tcp", tcpAddr(s), request(short, "app.list")); !strings.Contains(lines[0], `"result":true`) {
+		t.Errorf("unexpired token = %v", lines)
+	}
+	s.cfg.Mutate(func() {
+		for _, v := range s.cfg.Map("api")["tokens"].([]any) {
+			if m := v.(map[string]any); m["name"] == "short" {
+				m["expires"] = float64(time.Now().Add(-time.Second).UnixMilli())
+			}
+		}
+	})
+	if lines := call(t, "tcp", tcpAddr(s), request(short, "app.list")); !strings.Contains(lines[0], "unauthorized") {
+		t.Errorf("expired token = %v", lines)
+	}
+}
@@ -0,0 +1,438 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"odac/internal/lang"
+)
+
+var __ = lang.T
+
+// Named tokens are revocable API keys for people and CI systems, created by
+// the root user. Config keeps them under api.tokens, each as
+// {name, hash, allow, apps, domains, created, expires, lastUsed}: the token
+// itself is shown once at creation and only its SHA-256 is stored. allow is
+// checked like an app grant; apps and domains, when set, confine the token to
+// actions on those resources.
+
+const (
+	namedTokenPrefix = "odac_"
+	lastUsedEvery    = time.Minute // how often a busy token's lastUsed is written
+)
+
+var tokenNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+type namedToken struct {
+	name    string
+	allow   []any
+	apps    []string
+	domains []string
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupNamed finds the live, unexpired named token matching auth.
+func (s *Server) lookupNamed(auth string) *namedToken {
+	if !strings.HasPrefix(auth, namedTokenPrefix) {
+		return nil
+	}
+	hash := hashToken(auth)
+	now := time.Now()
+	var found *namedToken
+	s.cfg.View(func() {
+		list, _ := s.cfg.Map("api")["tokens"].([]any)
+		for _, v := range list {
+			t, _ := v.(map[string]any)
+			stored, _ := t["hash"].(string)
+			if t == nil || !constantTimeEqual(stored, hash) {
+				continue
+			}
+			if exp, _ := t["expires"].(float64); exp > 0 && now.UnixMilli() >= int64(exp) {
+				return
+			}
+			name, _ := t["name"].(string)
+			allow, _ := copyPermissions(t["allow"]).([]any)
+			found = &namedToken{name: name, allow: allow, apps: stringList(t["apps"]), domains: stringList(t["domains"])}
+			return
+		}
+	})
+	if found != nil {
+		s.touchNamed(found.name, now)
+	}
+	return found
+}
+
+// touchNamed records a token's last use, at most once per lastUsedEvery so a
+// CI loop does not rewrite the config on every call.
+func (s *Server) touchNamed(name string, now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.used[name]) < lastUsedEvery {
+		s.mu.Unlock()
+		return
+	}
+	s.used[name] = now
+	s.mu.Unlock()
+	s.cfg.Mutate(func() {
+		list, _ := s.cfg.Map("api")["tokens"].([]any)
+		for _, v := range list {
+			if t, _ := v.(map[string]any); t != nil && t["name"] == any(name) {
+				t["lastUsed"] = float64(now.UnixMilli())
+				s.cfg.Touch("api")
+				return
+			}
+		}
+	})
+}
+
+// allows reports whether the token's allow-list covers action.
+func (t *namedToken) allows(action string) bool {
+	for _, v := range t.allow {
+		if v == any("*") || v == any(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// target is an argument that names an app or a domain. An "email" target is
+// scoped by its domain part, a "new" target by the name inside the app.create
+// config.
+type target struct {
+	kind  string // "app", "new", "domain" or "email"
+	index int
+}
+
+// actionTargets lists the resources an action touches, where the default of
+// app.* (app at 0) and domain.* (domain at 0) does not fit.
+var actionTargets = map[string][]target{
+	"app.list":         nil,
+	"app.create":       {{"new", 0}},
+	"domain.list":      {{"app", 0}},
+	"domain.add":       {{"domain", 0}, {"app", 1}},
+	"tunnel.add":       {{"domain", 0}, {"app", 1}},
+	"tunnel.delete":    {{"domain", 0}},
+	"cache.purge":      {{"domain", 0}},
+	"ssl.renew":        {{"domain", 0}},
+	"ssl.import":       {{"domain", 0}},
+	"dns.list":         {{"domain", 0}},
+	"log.label":        {{"app", 0}},
+	"mail.list":        {{"domain", 0}},
+	"mail.create":      {{"email", 0}},
+	"mail.delete":      {{"email", 0}},
+	"mail.password":    {{"email", 0}},
+	"app.preview.list": {{"app", 0}},
+}
+
+func targetsOf(action string) []target {
+	if t, ok := actionTargets[action]; ok {
+		return t
+	}
+	switch {
+	case strings.HasPrefix(action, "app."):
+		return []target{{"app", 0}}
+	case strings.HasPrefix(action, "domain."):
+		return []target{{"domain", 0}}
+	}
+	return nil
+}
+
+// inScope reports whether a call stays within the token's apps and domains.
+// An unscoped token passes everything its allow-list does; a scoped one only
+// reaches actions that name at least one resource of a kind it is scoped to,
+// and every such resource must be in its list. Actions that touch no named
+// resource (listing every app, sending mail) are therefore closed to it.
+func (s *Server) inScope(t *namedToken, action string, args Args) bool {
+	if len(t.apps) == 0 && len(t.domains) == 0 {
+		return true
+	}
+	checked := false
+	for _, tg := range targetsOf(action) {
+		v := args.At(tg.index)
+		switch tg.kind {
+		case "app", "new":
+			if len(t.apps) == 0 {
+				continue
+			}
+			name := ""
+			if tg.kind == "new" {
+				cfg, _ := v.(map[string]any)
+				name, _ = cfg["name"].(string)
+			} else {
+				name = s.appName(v)
+			}
+			if name == "" || !slices.Contains(t.apps, name) {
+				return false
+			}
+		case "domain", "email":
+			if len(t.domains) == 0 {
+				continue
+			}
+			d, _ := v.(string)
+			if tg.kind == "email" {
+				_, d, _ = strings.Cut(d, "@")
+			}
+			if !domainInScope(strings.ToLower(d), t.domains) {
+				return false
+			}
+		}
+		checked = true
+	}
+	return checked
+}
+
+// reachable reports whether a token scoped to apps and/or domains can ever
+// call action, that is whether the action names a resource of a scoped kind.
+func reachable(action string, apps, domains bool) bool {
+	for _, tg := range targetsOf(action) {
+		switch tg.kind {
+		case "app", "new":
+			if apps {
+				return true
+			}
+		case "domain", "email":
+			if domains {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appName resolves an App ID or name the way the CLI's -i accepts it. A name
+// with no app behind it (app.deploykey before app.create) is kept as given.
+func (s *Server) appName(v any) string {
+	name := ""
+	s.cfg.View(func() {
+		apps, _ := s.cfg.Get("apps").([]any)
+		for _, a := range apps {
+			am, _ := a.(map[string]any)
+			if am == nil {
+				continue
+			}
+			if id, ok := am["id"].(float64); ok && (v == any(id) || v == any(strconv.FormatFloat(id, 'f', -1, 64))) {
+				name, _ = am["name"].(string)
+				return
+			}
+			if am["name"] == v {
+				name, _ = am["name"].(string)
+				return
+			}
+		}
+	})
+	if name == "" {
+		name, _ = v.(string)
+	}
+	return name
+}
+
+// domainInScope accepts a scoped domain and its subdomains.
+func domainInScope(d string, domains []string) bool {
+	if d == "" {
+		return false
+	}
+	for _, s := range domains {
+		if d == s || strings.HasSuffix(d, "."+s) {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenCreate mints a named token. opts holds allow (action names, "*" for
+// all), and optionally apps, domains and expires (a duration such as 90d or
+// 12h, or an RFC 3339 time). The token is returned once and never again.
+func (s *Server) TokenCreate(nameArg, optsArg any) Result {
+	name, _ := nameArg.(string)
+	if !tokenNameRe.MatchString(name) {
+		return Res(false, __("Invalid token name. Use lowercase letters, digits, dots, dashes and underscores."))
+	}
+	opts, _ := optsArg.(map[string]any)
+	allow := stringList(opts["allow"])
+	if len(allow) == 0 {
+		return Res(false, __("A token needs at least one allowed action."))
+	}
+	for _, action := range allow {
+		if action == "*" {
+			continue
+		}
+		if !AppMayCall(action) {
+			return Res(false, __("%s cannot be granted to a token.", action))
+		}
+		if !s.HasAction(action) {
+			return Res(false, __("Unknown action: %s", action))
+		}
+	}
+	apps := stringList(opts["apps"])
+	domains := stringList(opts["domains"])
+	for i, d := range domains {
+		domains[i] = strings.ToLower(strings.TrimSuffix(d, "."))
+	}
+	if len(apps) > 0 || len(domains) > 0 {
+		for _, action := range allow {
+			if action != "*" && !reachable(action, len(apps) > 0, len(domains) > 0) {
+				return Res(false, __("%s names no app or domain, so a scoped token could never call it.", action))
+			}
+		}
+	}
+	var expires float64
+	if e, _ := opts["expires"].(string); e != "" {
+		at, err := parseExpiry(e, time.Now())
+		if err != nil {
+			return Res(false, err.Error())
+		}
+		expires = float64(at.UnixMilli())
+	}
+
+	token := namedTokenPrefix + randomHex(24)
+	entry := map[string]any{
+		"name":    name,
+		"hash":    hashToken(token),
+		"allow":   anyList(allow),
+		"created": float64(time.Now().UnixMilli()),
+	}
+	if len(apps) > 0 {
+		entry["apps"] = anyList(apps)
+	}
+	if len(domains) > 0 {
+		entry["domains"] = anyList(domains)
+	}
+	if expires > 0 {
+		entry["expires"] = expires
+	}
+
+	exists := false
+	s.cfg.Mutate(func() {
+		apiCfg := s.cfg.Map("api")
+		list, _ := apiCfg["tokens"].([]any)
+		for _, v := range list {
+			if t, _ := v.(map[string]any); t != nil && t["name"] == any(name) {
+				exists = true
+				return
+			}
+		}
+		apiCfg["tokens"] = append(list, entry)
+		s.cfg.Touch("api")
+	})
+	if exists {
+		return Res(false, __("A token named %s already exists. Revoke it first.", name))
+	}
+	s.log.Log("Created API token %s", name)
+	return Res(true, __("Token %s created. Store it now: it is not shown again.", name), map[string]any{"name": name, "token": token})
+}
+
+// TokenList lists named tokens without their hashes.
+func (s *Server) TokenList() Result {
+	rows := []any{}
+	s.cfg.View(func() {
+		list, _ := s.cfg.Map("api")["tokens"].([]any)
+		for _, v := range list {
+			t, _ := v.(map[string]any)
+			if t == nil {
+				continue
+			}
+			rows = append(rows, map[string]any{
+				"name":     t["name"],
+				"allow":    strings.Join(stringList(t["allow"]), ","),
+				"apps":     strings.Join(stringList(t["apps"]), ","),
+				"domains":  strings.Join(stringList(t["domains"]), ","),
+				"created":  formatMillis(t["created"], ""),
+				"expires":  formatMillis(t["expires"], "never"),
+				"lastUsed": formatMillis(t["lastUsed"], "never"),
+			})
+		}
+	})
+	return Res(true, rows)
+}
+
+// TokenRevoke deletes a named token; its next request is refused.
+func (s *Server) TokenRevoke(nameArg any) Result {
+	name, _ := nameArg.(string)
+	found := false
+	s.cfg.Mutate(func() {
+		apiCfg := s.cfg.Map("api")
+		list, _ := apiCfg["tokens"].([]any)
+		kept := make([]any, 0, len(list))
+		for _, v := range list {
+			if t, _ := v.(map[string]any); t != nil && t["name"] == any(name) {
+				found = true
+				continue
+			}
+			kept = append(kept, v)
+		}
+		if found {
+			apiCfg["tokens"] = kept
+			s.cfg.Touch("api")
+		}
+	})
+	if !found {
+		return Res(false, __("Token %s not found.", name))
+	}
+	s.mu.Lock()
+	delete(s.used, name)
+	s.mu.Unlock()
+	s.log.Log("Revoked API token %s", name)
+	return Res(true, __("Token %s revoked.", name))
+}
+
+func parseExpiry(s string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return now.AddDate(0, 0, n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	if at, err := time.Parse(time.RFC3339, s); err == nil && at.After(now) {
+		return at, nil
+	}
+	return time.Time{}, errors.New(__("Invalid expiry %s. Use a duration such as 90d or 12h, or a future RFC 3339 time.", s))
+}
+
+func formatMillis(v any, zero string) string {
+	ms, _ := v.(float64)
+	if ms <= 0 {
+		return zero
+	}
+	return time.UnixMilli(int64(ms)).Local().Format("2006-01-02 15:04")
+}
+
+// stringList reads a JSON array of strings (or a single string), dropping
+// empties.
+func stringList(v any) []string {
+	var out []string
+	switch t := v.(type) {
+	case string:
+		if t != "" {
+			out = append(out, t)
+		}
+	case []any:
+		for _, e := range t {
+			if s := strings.TrimSpace(fmt.Sprint(e)); e != nil && s != "" {
+				out = append(out, s)
+			}
+		}
+	case []string:
+		out = append(out, t...)
+	}
+	return out
+}
+
+func anyList(list []string) []any {
+	out := make([]any, len(list))
+	for i, s := range list {
+		out[i] = s
+	}
+	return out
+}
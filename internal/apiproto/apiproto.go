@@ -28,6 +28,8 @@ type Request struct {
 	Auth   string `json:"auth"`
 	Action string `json:"action"`
 	Data   []any  `json:"data"`
+	// User names who ran the CLI, for the server's audit log.
+	User string `json:"user,omitempty"`
 }
 
 // Progress is one streamed progress line (identified by its "status" key).
@@ -33,6 +33,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -139,6 +140,20 @@ var (
 	errLogPrefix = "Failed to read build log: "
 )
 
+// tap receives a copy of every entry of every Logger; see SetTap.
+var tap atomic.Pointer[func(app string, stream Stream, e Entry)]
+
+// SetTap routes a copy of every build and runtime entry of every app to fn,
+// or stops doing so when fn is nil. fn runs on the writer's goroutine and
+// must not block.
+func SetTap(fn func(app string, stream Stream, e Entry)) {
+	if fn == nil {
+		tap.Store(nil)
+		return
+	}
+	tap.Store(&fn)
+}
+
 // Logger captures build and runtime logs for one app.
 type Logger struct {
 	appName    string
@@ -249,6 +264,9 @@ func (l *Logger) notify(stream Stream, typ, data string, ts int64) {
 	for _, cb := range cbs {
 		cb(e)
 	}
+	if fn := tap.Load(); fn != nil {
+		(*fn)(l.appName, stream, e)
+	}
 }
 
 // GetHealth returns the sliding 24h error-hour window ending at the current
@@ -488,7 +506,8 @@ func (l *Logger) pruneBuilds() {
 	}
 }
 
-// pruneRuntimeLogs deletes runtime .log files older than 7 days (mtime).
+// pruneRuntimeLogs deletes runtime logs, their .1 backups and their
+// indexes once older than 7 days (mtime).
 func (l *Logger) pruneRuntimeLogs() {
 	names, err := os.ReadDir(l.runtimeDir)
 	if err != nil {
@@ -496,7 +515,7 @@ func (l *Logger) pruneRuntimeLogs() {
 	}
 	cutoff := l.now().Add(-runtimeKeeepDays * 24 * time.Hour)
 	for _, de := range names {
-		if !strings.HasSuffix(de.Name(), ".log") {
+		if !strings.Contains(de.Name(), ".log") {
 			continue
 		}
 		info, err := de.Info()
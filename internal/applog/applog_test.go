@@ -553,3 +553,20 @@ func TestDestroyRemovesTree(t *testing.T) {
 		t.Error("logs dir should be removed")
 	}
 }
+
+func TestTapSeesEveryEntry(t *testing.T) {
+	var got []string
+	SetTap(func(app string, stream Stream, e Entry) {
+		got = append(got, app+"/"+string(stream)+"/"+e.T+"/"+e.D)
+	})
+	defer SetTap(nil)
+
+	l := newTestLogger(t)
+	r, _ := l.NewRuntimeStream()
+	r.Write([]byte("up\n"))
+	r.Error([]byte("down\n"))
+	r.End()
+	if strings.Join(got, ",") != "myapp/runtime/out/up\n,myapp/runtime/err/down\n" {
+		t.Errorf("tap saw %q", got)
+	}
+}
@@ -0,0 +1,401 @@
+package applog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	indexSuffix = ".idx"
+
+	// DefaultQueryLimit is the page size when a query sets none.
+	DefaultQueryLimit = 200
+	// MaxQueryLimit caps one page.
+	MaxQueryLimit = 5000
+)
+
+var runtimeFileRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\.log(\.1)?$`)
+
+// Line is one runtime log line. TS is 0 and Stream "" for lines written
+// before the file had an index.
+type Line struct {
+	TS     int64  `json:"ts"`
+	Stream string `json:"stream"`
+	Text   string `json:"text"`
+}
+
+// Query selects runtime log lines. Since and Until are Unix ms, 0 for
+// open-ended; Stream is "out", "err" or "" for both.
+//
+// Without a Cursor or Since a query returns the newest Limit lines.
+// Otherwise it reads forward from the cursor (or from Since) and returns
+// at most Limit lines; More says whether the range holds more.
+type Query struct {
+	Since   int64
+	Until   int64
+	Pattern *regexp.Regexp
+	Stream  string
+	Limit   int
+	Cursor  string
+}
+
+// Page is one query result. Cursor continues the read after the last line
+// returned, and also picks up lines written later (for following a log).
+type Page struct {
+	Lines  []Line `json:"lines"`
+	Cursor string `json:"cursor"`
+	More   bool   `json:"more"`
+}
+
+// mark is one index entry: lines starting at or after off were written at
+// ts to stream.
+type mark struct {
+	off    int64
+	ts     int64
+	stream string
+}
+
+// runtimeFile is one log file, .1 backups ordered before the live file of
+// the same day.
+type runtimeFile struct {
+	name string
+	day  string
+	live bool
+}
+
+// runtimeFiles lists the runtime logs oldest first. The newest live file is
+// the one still being written.
+func (l *Logger) runtimeFiles() []runtimeFile {
+	entries, err := os.ReadDir(l.runtimeDir)
+	if err != nil {
+		return nil
+	}
+	var files []runtimeFile
+	for _, de := range entries {
+		m := runtimeFileRe.FindStringSubmatch(de.Name())
+		if m == nil {
+			continue
+		}
+		files = append(files, runtimeFile{name: de.Name(), day: m[1], live: m[2] == ""})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].day != files[j].day {
+			return files[i].day < files[j].day
+		}
+		return !files[i].live && files[j].live
+	})
+	return files
+}
+
+// Query reads runtime log lines matching q.
+func (l *Logger) Query(q Query) (Page, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	if q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+	files := l.runtimeFiles()
+	if len(files) == 0 {
+		return Page{Lines: []Line{}}, nil
+	}
+	if q.Cursor == "" && q.Since == 0 {
+		return l.tail(files, q)
+	}
+	return l.forward(files, q)
+}
+
+// forward reads from q's cursor, or from the first file, onwards.
+func (l *Logger) forward(files []runtimeFile, q Query) (Page, error) {
+	page := Page{Lines: []Line{}, Cursor: q.Cursor}
+	start, from, err := l.startOf(files, q)
+	if err != nil {
+		return page, err
+	}
+	last := len(files) - 1
+	for i := start; i < len(files); i++ {
+		f := files[i]
+		if i > start {
+			from = 0
+		}
+		if q.Until > 0 && dayStart(f.day) > q.Until {
+			break
+		}
+		if i != last && q.Cursor == "" && l.olderThan(f.name, q.Since) {
+			continue
+		}
+		stop := false
+		end, err := l.scanFile(f.name, from, i == last, func(line Line, next int64) bool {
+			if q.Until > 0 && line.TS > q.Until {
+				stop = true
+				return false
+			}
+			if !q.matches(line) {
+				return true
+			}
+			if len(page.Lines) == q.Limit {
+				page.More = true
+				stop = true
+				return false
+			}
+			page.Lines = append(page.Lines, line)
+			page.Cursor = cursorAt(f.name, next)
+			return true
+		})
+		if err != nil {
+			return page, err
+		}
+		if stop {
+			return page, nil
+		}
+		page.Cursor = cursorAt(f.name, end)
+	}
+	return page, nil
+}
+
+// tail returns the newest q.Limit matching lines, reading files newest
+// first until it has enough.
+func (l *Logger) tail(files []runtimeFile, q Query) (Page, error) {
+	page := Page{Lines: []Line{}}
+	last := len(files) - 1
+	for i := last; i >= 0 && len(page.Lines) < q.Limit; i-- {
+		f := files[i]
+		if q.Until > 0 && dayStart(f.day) > q.Until {
+			continue
+		}
+		var found []Line
+		end, err := l.scanFile(f.name, 0, i == last, func(line Line, _ int64) bool {
+			if q.Until > 0 && line.TS > q.Until {
+				return false
+			}
+			if q.matches(line) {
+				found = append(found, line)
+				if len(found) > q.Limit {
+					found = found[1:]
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return page, err
+		}
+		if i == last {
+			page.Cursor = cursorAt(f.name, end)
+		}
+		page.Lines = append(found, page.Lines...)
+	}
+	if len(page.Lines) > q.Limit {
+		page.Lines = page.Lines[len(page.Lines)-q.Limit:]
+	}
+	return page, nil
+}
+
+// startOf resolves where a forward query begins: the cursor's file and
+// offset, or the first file.
+func (l *Logger) startOf(files []runtimeFile, q Query) (int, int64, error) {
+	if q.Cursor == "" {
+		return 0, 0, nil
+	}
+	name, offStr, ok := strings.Cut(q.Cursor, ":")
+	off, err := strconv.ParseInt(offStr, 10, 64)
+	if !ok || err != nil || off < 0 || !runtimeFileRe.MatchString(name) {
+		return 0, 0, fmt.Errorf("invalid log cursor %q", q.Cursor)
+	}
+	// A live file rotated since the cursor was issued: its lines now sit in
+	// the .1 backup at the same offsets.
+	if !strings.HasSuffix(name, ".1") {
+		if info, err := os.Stat(filepath.Join(l.runtimeDir, name)); err != nil || info.Size() < off {
+			if _, err := os.Stat(filepath.Join(l.runtimeDir, name+".1")); err == nil {
+				name += ".1"
+			}
+		}
+	}
+	for i, f := range files {
+		if f.name == name {
+			return i, off, nil
+		}
+	}
+	// The file is gone: go on with the next day.
+	for i, f := range files {
+		if f.day > name[:10] {
+			return i, 0, nil
+		}
+	}
+	return len(files), 0, nil
+}
+
+func (q Query) matches(line Line) bool {
+	if q.Since > 0 && line.TS < q.Since {
+		return false
+	}
+	if q.Stream != "" && line.Stream != q.Stream {
+		return false
+	}
+	return q.Pattern == nil || q.Pattern.MatchString(line.Text)
+}
+
+func (l *Logger) olderThan(name string, since int64) bool {
+	info, err := os.Stat(filepath.Join(l.runtimeDir, name))
+	return err == nil && info.ModTime().UnixMilli() < since
+}
+
+func dayStart(day string) int64 {
+	t, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func cursorAt(name string, off int64) string {
+	return name + ":" + strconv.FormatInt(off, 10)
+}
+
+// readMarks loads a log file's index. A missing or damaged index yields
+// the marks it could read.
+func (l *Logger) readMarks(name string) []mark {
+	f, err := os.Open(filepath.Join(l.runtimeDir, name+indexSuffix))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var marks []mark
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		off, err1 := strconv.ParseInt(fields[0], 10, 64)
+		ts, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		stream := "out"
+		if fields[2] == "e" {
+			stream = "err"
+		}
+		marks = append(marks, mark{off: off, ts: ts, stream: stream})
+	}
+	return marks
+}
+
+// scanFile calls fn with each line of a runtime file from offset from and
+// the offset just past it, until fn returns false. The live file's
+// unterminated last line is left for a later read. It returns the offset
+// reading stopped at.
+func (l *Logger) scanFile(name string, from int64, live bool, fn func(line Line, next int64) bool) (int64, error) {
+	f, err := os.Open(filepath.Join(l.runtimeDir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return from, nil
+		}
+		return from, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(from, io.SeekStart); err != nil {
+		return from, err
+	}
+
+	marks := l.readMarks(name)
+	current := mark{}
+	next := 0
+	for next < len(marks) && marks[next].off <= from {
+		current = marks[next]
+		next++
+	}
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	pos := from
+	for {
+		text, n, complete, err := readLine(reader)
+		if n == 0 || (!complete && live) {
+			return pos, nil
+		}
+		for next < len(marks) && marks[next].off <= pos {
+			current = marks[next]
+			next++
+		}
+		line := Line{TS: current.ts, Stream: current.stream, Text: text}
+		if !fn(line, pos+n) {
+			return pos, nil
+		}
+		pos += n
+		if err != nil {
+			return pos, nil
+		}
+	}
+}
+
+// readLine reads one line, capping its text at maxLineLength. It returns
+// the bytes consumed and whether the line ended in a newline.
+func readLine(r *bufio.Reader) (string, int64, bool, error) {
+	var buf []byte
+	var n int64
+	for {
+		chunk, err := r.ReadSlice('\n')
+		n += int64(len(chunk))
+		if room := maxLineLength - len(buf); room > 0 {
+			if len(chunk) > room {
+				buf = append(buf, chunk[:room]...)
+			} else {
+				buf = append(buf, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		complete := err == nil
+		text := strings.TrimRight(string(buf), "\r\n")
+		return text, n, complete, err
+	}
+}
+
+// Export writes the lines q selects, ignoring its Limit and Cursor, to w as
+// gzip-compressed text, one "<RFC3339 time> <stream> <text>" line each. It
+// returns the number of lines written.
+func (l *Logger) Export(q Query, w io.Writer) (int, error) {
+	zw := gzip.NewWriter(w)
+	q.Cursor, q.Limit = "", MaxQueryLimit
+	files := l.runtimeFiles()
+	count := 0
+	for len(files) > 0 {
+		page, err := l.forward(files, q)
+		if err != nil {
+			zw.Close()
+			return count, err
+		}
+		for _, line := range page.Lines {
+			fmt.Fprintf(zw, "%s %s %s\n", formatTS(line.TS), streamLabel(line.Stream), line.Text)
+		}
+		count += len(page.Lines)
+		if !page.More {
+			break
+		}
+		q.Cursor = page.Cursor
+	}
+	return count, zw.Close()
+}
+
+func formatTS(ts int64) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.UnixMilli(ts).UTC().Format(time.RFC3339Nano)
+}
+
+func streamLabel(stream string) string {
+	if stream == "" {
+		return "-"
+	}
+	return stream
+}
@@ -0,0 +1,145 @@
+package applog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeRuntime opens a stream at start and writes chunks one second apart,
+// "!"-prefixed chunks to stderr.
+func writeRuntime(t *testing.T, l *Logger, start time.Time, chunks ...string) *RuntimeControl {
+	t.Helper()
+	now := start
+	l.now = func() time.Time { return now }
+	r, err := l.NewRuntimeStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range chunks {
+		if strings.HasPrefix(c, "!") {
+			r.Error([]byte(c[1:]))
+		} else {
+			r.Write([]byte(c))
+		}
+		now = now.Add(time.Second)
+	}
+	return r
+}
+
+func texts(lines []Line) string {
+	var out []string
+	for _, line := range lines {
+		out = append(out, line.Text)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestQueryTailFiltersAndCursor(t *testing.T) {
+	l := newTestLogger(t)
+	start := time.Date(2026, 7, 11, 10, 0, 0, 0, time.UTC)
+	r := writeRuntime(t, l, start, "boot\n", "!oops one\n", "ready\nserving\n", "!oops two\n", "partial")
+	defer r.End()
+
+	page, err := l.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(page.Lines); got != "boot,oops one,ready,serving,oops two" {
+		t.Fatalf("tail = %q", got)
+	}
+	if page.Lines[1].Stream != "err" || page.Lines[3].Stream != "out" || page.Lines[3].TS != start.Add(2*time.Second).UnixMilli() {
+		t.Errorf("line attribution = %+v", page.Lines)
+	}
+
+	page, _ = l.Query(Query{Stream: "err", Pattern: regexp.MustCompile(`two`)})
+	if got := texts(page.Lines); got != "oops two" {
+		t.Errorf("stderr grep = %q", got)
+	}
+	page, _ = l.Query(Query{Limit: 2})
+	if got := texts(page.Lines); got != "serving,oops two" {
+		t.Errorf("tail limit = %q", got)
+	}
+
+	// Following: the unterminated line waits until it is complete.
+	r.Write([]byte(" done\nnext\n"))
+	next, err := l.Query(Query{Cursor: page.Cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(next.Lines); got != "partial done,next" {
+		t.Errorf("follow = %q", got)
+	}
+}
+
+func TestQueryRangeAcrossFilesWithPages(t *testing.T) {
+	l := newTestLogger(t)
+	day1 := time.Date(2026, 7, 10, 23, 0, 0, 0, time.UTC)
+	writeRuntime(t, l, day1, "a\n", "b\n").End()
+	l.maxRuntimeBytes, l.rotateCheckEvery = 4, 1
+	r := writeRuntime(t, l, day1.Add(24*time.Hour), "c\n", "d\n", "e\n", "f\n")
+	r.End()
+	if _, err := os.Stat(filepath.Join(l.runtimeDir, "2026-07-11.log.1")); err != nil {
+		t.Fatal("expected a size-rotated backup")
+	}
+
+	q := Query{Since: day1.Add(time.Second).UnixMilli(), Until: day1.Add(24*time.Hour + 2*time.Second).UnixMilli(), Limit: 2}
+	var got []string
+	for {
+		page, err := l.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, texts(page.Lines))
+		if !page.More {
+			break
+		}
+		q.Cursor = page.Cursor
+	}
+	if strings.Join(got, "|") != "b,c|d,e" {
+		t.Errorf("pages = %q", got)
+	}
+
+	if _, err := l.Query(Query{Cursor: "../etc/passwd:0"}); err == nil {
+		t.Error("accepted a cursor outside the runtime logs")
+	}
+}
+
+func TestQueryUnindexedLines(t *testing.T) {
+	l := newTestLogger(t)
+	os.WriteFile(filepath.Join(l.runtimeDir, "2026-07-01.log"), []byte("old\n"), 0o644)
+	page, _ := l.Query(Query{})
+	if len(page.Lines) != 1 || page.Lines[0].TS != 0 || page.Lines[0].Stream != "" {
+		t.Fatalf("unindexed = %+v", page.Lines)
+	}
+	if page, _ := l.Query(Query{Since: 1}); len(page.Lines) != 0 {
+		t.Errorf("undated line matched a time range: %+v", page.Lines)
+	}
+}
+
+func TestExportCompressesTheRange(t *testing.T) {
+	l := newTestLogger(t)
+	start := time.Date(2026, 7, 11, 10, 0, 0, 0, time.UTC)
+	writeRuntime(t, l, start, "one\n", "!two\n", "three\n").End()
+
+	var buf bytes.Buffer
+	n, err := l.Export(Query{Since: start.Add(time.Second).UnixMilli()}, &buf)
+	if err != nil || n != 2 {
+		t.Fatalf("export = %d, %v", n, err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(zr)
+	want := "2026-07-11T10:00:01Z err two\n2026-07-11T10:00:02Z out three\n"
+	if string(raw) != want {
+		t.Errorf("export = %q", raw)
+	}
+}
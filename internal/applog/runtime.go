@@ -2,6 +2,7 @@ package applog
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -9,6 +10,10 @@ import (
 // RuntimeControl is the control object returned by NewRuntimeStream —
 // Node's createRuntimeStream return value: a daily-rotated append writer
 // with a size cap and an error-hour histogram.
+//
+// Next to each log file it keeps an index (<file>.idx) of "offset ts stream"
+// marks, one whenever the stream or the second changes, so Query can date
+// and attribute lines without changing the log file itself.
 type RuntimeControl struct {
 	logger  *Logger
 	logPath string
@@ -16,6 +21,10 @@ type RuntimeControl struct {
 	// All fields below are guarded by the logger's mu; file writes are
 	// serialized under it too (Node relied on the single-threaded loop).
 	file            *os.File
+	index           *os.File
+	offset          int64
+	markSec         int64
+	markStream      byte
 	ended           bool
 	stats           runtimeStats
 	bytesSinceCheck int64
@@ -52,10 +61,16 @@ func (l *Logger) NewRuntimeStream() (*RuntimeControl, error) {
 	if err != nil {
 		return nil, err
 	}
+	var offset int64
+	if info, err := file.Stat(); err == nil {
+		offset = info.Size()
+	}
+	// A missing index only costs the lines their timestamps.
+	index, _ := os.OpenFile(logPath+indexSuffix, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 
 	l.pruneRuntimeLogs()
 
-	return &RuntimeControl{logger: l, logPath: logPath, file: file, stats: stats}, nil
+	return &RuntimeControl{logger: l, logPath: logPath, file: file, index: index, offset: offset, stats: stats}, nil
 }
 
 // Path returns the on-disk runtime log path for the day the stream opened.
@@ -69,11 +84,11 @@ func (r *RuntimeControl) Write(p []byte) {
 		l.mu.Unlock()
 		return
 	}
-	r.file.Write(p)
-	r.maybeRotateLocked(int64(len(p)))
+	now := l.now().UnixMilli()
+	r.writeLocked(p, 'o', now)
 	l.mu.Unlock()
 
-	l.notify(Runtime, "out", string(p), l.now().UnixMilli())
+	l.notify(Runtime, "out", string(p), now)
 }
 
 // Error appends a stderr chunk: broadcast, error-hour histogram update
@@ -105,13 +120,24 @@ func (r *RuntimeControl) Error(p []byte) {
 		}
 	}
 
-	r.file.Write(p)
-	r.maybeRotateLocked(int64(len(p)))
+	r.writeLocked(p, 'e', now.UnixMilli())
 	l.mu.Unlock()
 
 	l.notify(Runtime, "err", string(p), now.UnixMilli())
 }
 
+// writeLocked appends a chunk, marking the index first when the stream or
+// the second changed since the last mark. Caller holds mu.
+func (r *RuntimeControl) writeLocked(p []byte, stream byte, ts int64) {
+	if r.index != nil && (stream != r.markStream || ts/1000 != r.markSec) {
+		fmt.Fprintf(r.index, "%d %d %c\n", r.offset, ts, stream)
+		r.markStream, r.markSec = stream, ts/1000
+	}
+	n, _ := r.file.Write(p)
+	r.offset += int64(n)
+	r.maybeRotateLocked(int64(len(p)))
+}
+
 // maybeRotateLocked enforces the in-day 100 MB size cap. Caller holds mu.
 //
 // ⚠ Ordering is load-bearing (Node crashed in production with the reverse
@@ -145,6 +171,13 @@ func (r *RuntimeControl) maybeRotateLocked(chunkLen int64) {
 	old := r.file
 	r.file = fresh
 	old.Close()
+
+	r.offset, r.markStream = 0, 0
+	if r.index != nil {
+		r.index.Close()
+		os.Rename(r.logPath+indexSuffix, r.logPath+".1"+indexSuffix)
+		r.index, _ = os.OpenFile(r.logPath+indexSuffix, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	}
 }
 
 // End closes the file stream. Idempotent. Subscribers are NOT cleared:
@@ -159,6 +192,9 @@ func (r *RuntimeControl) End() {
 	}
 	r.ended = true
 	r.file.Close()
+	if r.index != nil {
+		r.index.Close()
+	}
 }
 
 // Subscribe subscribes to the runtime broadcast channel.
@@ -70,9 +70,11 @@ type Docker interface {
 	SetNetworks(name string, networks []string) docker.SetNetworksResult
 	EnsureImage(imageName string, logw io.Writer) error
 	StatPathIsDir(name, containerPath string) (isDir bool, ok bool)
-	CloneRepo(url, branch, targetDir, token string, buildLog docker.BuildLog) error
-	FetchRepo(url, branch, targetDir, token, commitSha string, buildLog docker.BuildLog) error
-	Build(sourceDir, imageName, appName string, buildLog docker.BuildLog) error
+	CloneRepo(url, branch, targetDir, token, sshDir string, buildLog docker.BuildLog) error
+	FetchRepo(url, branch, targetDir, token, sshDir, commitSha string, buildLog docker.BuildLog) error
+	RemoteBranchExists(url, branch, workDir, token, sshDir string) (bool, error)
+	Build(sourceDir, imageName, appName string, opts docker.BuildOptions, buildLog docker.BuildLog) error
+	ClearBuildCache(appName string) (int64, error)
 	RegisterBuildLogger(appName string, logger *applog.Logger)
 	UnregisterBuildLogger(appName string)
 	ResolveHostPath(localPath string) string
@@ -91,6 +93,7 @@ type TokenIssuer interface {
 type ProxyController interface {
 	SyncConfig()
 	PurgeCacheForApp(appID any)
+	SetMaintenance(appID any, on bool)
 }
 
 // Hub is the Hub surface App needs: change notifications and recipe fetch.
@@ -113,6 +116,25 @@ type DomainDeleter interface {
 	DeleteByApp(appName string) error
 }
 
+// DomainBinder routes a preview environment's host to its container.
+// *domains.Domain provides it; a nil DomainBinder creates previews without
+// a host.
+type DomainBinder interface {
+	Add(domain, appID any) api.Result
+}
+
+// Secrets resolves secret:// env references at container start.
+// *secrets.Store provides it; a nil Secrets drops the referencing variables.
+type Secrets interface {
+	Reveal(name string) (string, error)
+}
+
+// Alerter receives operational events for alerting. *alert.Alerter
+// provides it; a nil Alerter drops them.
+type Alerter interface {
+	Alert(kind, subject, message string, value float64)
+}
+
 // Deps carries the Manager's collaborators. Hub, Domains, Api and Proxy may
 // be nil until their tasks land; every use is nil-tolerant like the Node
 // registry, which never resolves a missing module.
@@ -123,6 +145,10 @@ type Deps struct {
 	Hub     Hub
 	Domains DomainDeleter
 	GPUHost GPUHost
+	Secrets Secrets
+	Alerter Alerter
+
+	DomainBinder DomainBinder
 }
 
 // Manager is the App.js singleton.
@@ -147,6 +173,7 @@ type Manager struct {
 	creating   map[string]bool           // app names mid-create
 	logStreams map[string]*runtimeStream // app name -> live runtime log
 	loggers    map[string]*applog.Logger // app name -> logger instance
+	crashes    map[string][]time.Time    // app name -> recent unexpected exits
 
 	// Test hooks: cadences default to Node's literals; sleep defaults to
 	// time.Sleep. deploySwitchDelay is Deploy.js's NODE_ENV!=='test' 5s.
@@ -163,6 +190,11 @@ type Manager struct {
 	renameInterval    time.Duration // Deploy rename retry (2s)
 	restartDelay      time.Duration // standard restart settle (1s)
 	deploySwitchDelay time.Duration // Blue-Green pre-stop drain (5s)
+
+	// Preview sweeps run from Check at most once per previewSweepInterval.
+	previewSweepInterval time.Duration
+	previewSweptAt       time.Time // guarded by mu
+	previewSweeping      bool      // guarded by mu
 }
 
 // spawn runs fn on a tracked goroutine (Node's un-awaited promises).
@@ -201,6 +233,7 @@ func New(cfg *config.Store, logsRoot string, deps Deps) *Manager {
 		creating:   map[string]bool{},
 		logStreams: map[string]*runtimeStream{},
 		loggers:    map[string]*applog.Logger{},
+		crashes:    map[string][]time.Time{},
 
 		httpProbe:         realHTTPProbe,
 		sleep:             time.Sleep,
@@ -213,6 +246,8 @@ func New(cfg *config.Store, logsRoot string, deps Deps) *Manager {
 		renameInterval:    2 * time.Second,
 		restartDelay:      time.Second,
 		deploySwitchDelay: 5 * time.Second,
+
+		previewSweepInterval: 10 * time.Minute,
 	}
 }
 
@@ -311,6 +346,7 @@ func (m *Manager) Check() {
 		shouldRun := false
 		if !isRunning && p.status == "running" {
 			m.log.Log("App %s is not running. Restarting...", p.name)
+			m.noteCrash(p.name)
 			shouldRun = true
 		} else if !isRunning && p.status != "stopped" && p.status != "errored" && p.status != "starting" && p.status != "installing" {
 			shouldRun = true
@@ -323,6 +359,8 @@ func (m *Manager) Check() {
 			})
 		}
 	}
+
+	m.schedulePreviewSweep()
 }
 
 // ---- working-set primitives (Node's private App data management) ----
@@ -489,6 +527,33 @@ func (m *Manager) generateUniqueNameLocked(baseName string) string {
 // startup wiring).
 func (m *Manager) SetHub(hub Hub) { m.deps.Hub = hub }
 
+func (m *Manager) alert(kind, app, message string, value float64) {
+	if m.deps.Alerter != nil {
+		m.deps.Alerter.Alert(kind, app, message, value)
+	}
+}
+
+// crashWindow is how far back noteCrash counts an app's unexpected exits.
+const crashWindow = 10 * time.Minute
+
+// noteCrash records an unexpected exit and reports how many the app had
+// within crashWindow, so a crash loop stands out from a one-off.
+func (m *Manager) noteCrash(name string) {
+	now := time.Now()
+	m.mu.Lock()
+	recent := m.crashes[name][:0]
+	for _, at := range m.crashes[name] {
+		if now.Sub(at) < crashWindow {
+			recent = append(recent, at)
+		}
+	}
+	recent = append(recent, now)
+	m.crashes[name] = recent
+	count := len(recent)
+	m.mu.Unlock()
+	m.alert("app.crashed", name, __("App %s stopped unexpectedly, %s times in the last %s minutes.", name, count, int(crashWindow/time.Minute)), float64(count))
+}
+
 func (m *Manager) hubTrigger(event string) {
 	if m.deps.Hub != nil {
 		m.deps.Hub.Trigger(event)
@@ -501,6 +566,14 @@ func (m *Manager) proxySync() {
 	}
 }
 
+// proxyMaintenance shows the maintenance page on an app's domains while a
+// recreate that cannot run Blue-Green has it stopped.
+func (m *Manager) proxyMaintenance(appID any, on bool) {
+	if m.deps.Proxy != nil {
+		m.deps.Proxy.SetMaintenance(appID, on)
+	}
+}
+
 func (m *Manager) proxyPurge(appID any) {
 	if m.deps.Proxy != nil {
 		m.deps.Proxy.PurgeCacheForApp(appID)
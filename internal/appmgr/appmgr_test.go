@@ -8,8 +8,10 @@ package appmgr
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -56,11 +58,20 @@ type fakeDocker struct {
 	fetchHook func() // fires inside FetchRepo
 	buildHook func() // fires inside Build
 
-	cloneCalls [][2]string // url, branch
-	cloneErr   error
-	fetchCalls [][2]string
-	buildCalls []string // image names
-	buildErr   error
+	cloneCalls   [][2]string // url, branch
+	cloneErr     error
+	cloneHook    func(targetDir string) // fires inside CloneRepo
+	fetchCalls   [][2]string
+	gitSSHDirs   []string // sshDir of every clone/fetch
+	buildCalls   []string // image names
+	buildSources []string
+	buildOpts    []docker.BuildOptions
+	buildErr     error
+	cacheCleared []string
+
+	goneBranches map[string]bool // RemoteBranchExists answers false for these
+	lsRemoteErr  error
+	lsRemotes    []string // branch of every RemoteBranchExists
 
 	containers []docker.ContainerInfo
 
@@ -252,17 +263,23 @@ func (f *fakeDocker) StatPathIsDir(name, containerPath string) (bool, bool) {
 	return isDir, ok
 }
 
-func (f *fakeDocker) CloneRepo(url, branch, _, _ string, _ docker.BuildLog) error {
+func (f *fakeDocker) CloneRepo(url, branch, targetDir, _, sshDir string, _ docker.BuildLog) error {
 	f.mu.Lock()
 	f.cloneCalls = append(f.cloneCalls, [2]string{url, branch})
+	f.gitSSHDirs = append(f.gitSSHDirs, sshDir)
 	err := f.cloneErr
+	hook := f.cloneHook
 	f.mu.Unlock()
+	if hook != nil {
+		hook(targetDir)
+	}
 	return err
 }
 
-func (f *fakeDocker) FetchRepo(url, branch, _, _, _ string, _ docker.BuildLog) error {
+func (f *fakeDocker) FetchRepo(url, branch, _, _, sshDir, _ string, _ docker.BuildLog) error {
 	f.mu.Lock()
 	f.fetchCalls = append(f.fetchCalls, [2]string{url, branch})
+	f.gitSSHDirs = append(f.gitSSHDirs, sshDir)
 	hook := f.fetchHook
 	f.mu.Unlock()
 	if hook != nil {
@@ -271,9 +288,18 @@ func (f *fakeDocker) FetchRepo(url, branch, _, _, _ string, _ docker.BuildLog) e
 	return nil
 }
 
-func (f *fakeDocker) Build(_, imageName, _ string, _ docker.BuildLog) error {
+func (f *fakeDocker) RemoteBranchExists(_, branch, _, _, _ string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lsRemotes = append(f.lsRemotes, branch)
+	return !f.goneBranches[branch], f.lsRemoteErr
+}
+
+func (f *fakeDocker) Build(sourceDir, imageName, _ string, opts docker.BuildOptions, _ docker.BuildLog) error {
 	f.mu.Lock()
 	f.buildCalls = append(f.buildCalls, imageName)
+	f.buildSources = append(f.buildSources, sourceDir)
+	f.buildOpts = append(f.buildOpts, opts)
 	hook := f.buildHook
 	err := f.buildErr
 	f.mu.Unlock()
@@ -283,6 +309,13 @@ func (f *fakeDocker) Build(_, imageName, _ string, _ docker.BuildLog) error {
 	return err
 }
 
+func (f *fakeDocker) ClearBuildCache(appName string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cacheCleared = append(f.cacheCleared, appName)
+	return 3 << 20, nil
+}
+
 func (f *fakeDocker) RegisterBuildLogger(appName string, _ *applog.Logger) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -318,9 +351,11 @@ func (f *fakeAPI) HasAction(action string) bool {
 }
 
 type fakeProxy struct {
-	mu     sync.Mutex
-	syncs  int
-	purges []any
+	mu          sync.Mutex
+	syncs       int
+	purges      []any
+	maintenance []bool
+	inMaint     map[string]bool
 }
 
 func (f *fakeProxy) SyncConfig() {
@@ -335,6 +370,21 @@ func (f *fakeProxy) PurgeCacheForApp(appID any) {
 	f.purges = append(f.purges, appID)
 }
 
+func (f *fakeProxy) SetMaintenance(appID any, on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maintenance = append(f.maintenance, on)
+	// Like the real proxy, a change of state pushes the config.
+	key := fmt.Sprint(appID)
+	if f.inMaint[key] != on {
+		if f.inMaint == nil {
+			f.inMaint = map[string]bool{}
+		}
+		f.inMaint[key] = on
+		f.syncs++
+	}
+}
+
 type fakeHub struct {
 	mu       sync.Mutex
 	triggers []string
@@ -598,6 +648,40 @@ func TestCheckPreventsConcurrentRuns(t *testing.T) {
 	fx.waitIdle(t)
 }
 
+type alertRecord struct {
+	kind, subject string
+	value         float64
+}
+
+type fakeAlerter struct {
+	mu     sync.Mutex
+	alerts []alertRecord
+}
+
+func (f *fakeAlerter) Alert(kind, subject, _ string, value float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.alerts = append(f.alerts, alertRecord{kind, subject, value})
+}
+
+func TestCheckReportsCrashLoops(t *testing.T) {
+	fx := newFixture(t, []any{map[string]any{
+		"id": float64(7), "name": "flaky", "active": true,
+		"type": "container", "status": "running",
+	}})
+	alerts := &fakeAlerter{}
+	fx.m.deps.Alerter = alerts
+
+	fx.checkAndSettle(t)
+	fx.m.noteCrash("flaky")
+	fx.m.noteCrash("flaky")
+
+	want := []alertRecord{{"app.crashed", "flaky", 1}, {"app.crashed", "flaky", 2}, {"app.crashed", "flaky", 3}}
+	if !reflect.DeepEqual(alerts.alerts, want) {
+		t.Errorf("alerts = %v", alerts.alerts)
+	}
+}
+
 func TestCreateFromGitConcurrencyGuard(t *testing.T) {
 	fx := newFixture(t, []any{})
 
@@ -639,10 +723,10 @@ type blockingCloneDocker struct {
 	once    sync.Once
 }
 
-func (b *blockingCloneDocker) CloneRepo(url, branch, dir, token string, l docker.BuildLog) error {
+func (b *blockingCloneDocker) CloneRepo(url, branch, dir, token, sshDir string, l docker.BuildLog) error {
 	b.once.Do(func() { close(b.started) })
 	<-b.block
-	return b.fakeDocker.CloneRepo(url, branch, dir, token, l)
+	return b.fakeDocker.CloneRepo(url, branch, dir, token, sshDir, l)
 }
 
 // ---- api permission handling ----
@@ -0,0 +1,203 @@
+package appmgr
+
+import (
+	"errors"
+	"regexp"
+
+	"odac/internal/api"
+	"odac/internal/docker"
+)
+
+// defaultBuildCacheMB caps an app's build cache when neither the app nor
+// config.app.buildCache sets a size.
+const defaultBuildCacheMB = 2048
+
+// buildVarRE matches build arg and secret names, the same rule the builder
+// enforces before they reach a `docker build` command line.
+var buildVarRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// applyBuildChanges merges an app.build payload into an app's "buildConfig"
+// block: {args: {K: V}, secrets: {K: name}, unset: [K], cache: MB}. Secret
+// entries are stored as secret:// references, never as values.
+func applyBuildChanges(current map[string]any, changes map[string]any) (map[string]any, error) {
+	build := copyMap(current)
+	if build == nil {
+		build = map[string]any{}
+	}
+	args, _ := build["args"].(map[string]any)
+	args = copyMap(args)
+	if args == nil {
+		args = map[string]any{}
+	}
+	secrets, _ := build["secrets"].(map[string]any)
+	secrets = copyMap(secrets)
+	if secrets == nil {
+		secrets = map[string]any{}
+	}
+
+	unset, _ := changes["unset"].([]any)
+	for _, k := range unset {
+		key, _ := k.(string)
+		delete(args, key)
+		delete(secrets, key)
+	}
+	if raw, _ := changes["args"].(map[string]any); raw != nil {
+		for k, v := range raw {
+			value, ok := v.(string)
+			if !buildVarRE.MatchString(k) || !ok {
+				return nil, errors.New(__("Invalid build argument: %s", k))
+			}
+			delete(secrets, k)
+			args[k] = value
+		}
+	}
+	if raw, _ := changes["secrets"].(map[string]any); raw != nil {
+		for k, v := range raw {
+			ref, _ := v.(string)
+			if _, _, isRef := parseSecretRef(ref); !isRef {
+				ref = secretRefPrefix + ref
+			}
+			name, file, ok := parseSecretRef(ref)
+			if !buildVarRE.MatchString(k) || !ok || file {
+				return nil, errors.New(__("Invalid build secret: %s", k))
+			}
+			delete(args, k)
+			secrets[k] = secretRefPrefix + name
+		}
+	}
+	if v, present := changes["cache"]; present {
+		if v == nil {
+			delete(build, "cache")
+		} else if mb, ok := v.(float64); ok && mb >= 0 {
+			build["cache"] = float64(int64(mb))
+		} else {
+			return nil, errors.New(__("Invalid build cache size."))
+		}
+	}
+
+	build["args"], build["secrets"] = args, secrets
+	if len(args) == 0 {
+		delete(build, "args")
+	}
+	if len(secrets) == 0 {
+		delete(build, "secrets")
+	}
+	return build, nil
+}
+
+// buildOptions turns an app's "buildConfig" block into docker.BuildOptions,
+// revealing its secret references. A build secret that cannot be resolved
+// fails the build: unlike a missing runtime variable, the result would be
+// an image built without the credentials it asked for.
+func (m *Manager) buildOptions(build map[string]any) (docker.BuildOptions, error) {
+	mb := float64(defaultBuildCacheMB)
+	m.cfg.View(func() {
+		if appCfg, _ := m.cfg.Get("app").(map[string]any); appCfg != nil {
+			if n, ok := appCfg["buildCache"].(float64); ok && n >= 0 {
+				mb = n
+			}
+		}
+	})
+	if n, ok := build["cache"].(float64); ok && n >= 0 {
+		mb = n
+	}
+	opts := docker.BuildOptions{CacheLimit: int64(mb) << 20}
+
+	if args, _ := build["args"].(map[string]any); len(args) > 0 {
+		opts.Args = map[string]string{}
+		for k, v := range args {
+			opts.Args[k] = jsString(v)
+		}
+	}
+	if secrets, _ := build["secrets"].(map[string]any); len(secrets) > 0 {
+		if m.deps.Secrets == nil {
+			return opts, errors.New(__("Build secrets need the secrets store, which is unavailable."))
+		}
+		opts.Secrets = map[string]string{}
+		for k, v := range secrets {
+			name, _, ok := parseSecretRef(v)
+			if !ok {
+				return opts, errors.New(__("Invalid build secret: %s", k))
+			}
+			value, err := m.deps.Secrets.Reveal(name)
+			if err != nil {
+				return opts, errors.New(__("Build secret %s: %s", k, err.Error()))
+			}
+			opts.Secrets[k] = value
+		}
+	}
+	return opts, nil
+}
+
+// buildSummary is the app.build response: args with their values, secrets
+// as the references they are stored as, and the cache cap in MB.
+func buildSummary(build map[string]any) map[string]any {
+	out := map[string]any{"args": map[string]any{}, "secrets": map[string]any{}, "cache": nil}
+	if args, _ := build["args"].(map[string]any); args != nil {
+		out["args"] = copyMap(args)
+	}
+	if secrets, _ := build["secrets"].(map[string]any); secrets != nil {
+		out["secrets"] = copyMap(secrets)
+	}
+	if v, ok := build["cache"]; ok {
+		out["cache"] = v
+	}
+	return out
+}
+
+// SetBuild changes an app's build args, build secrets and build cache cap.
+// The changes apply from the next build. A nil or empty changes payload
+// only reports the current settings.
+func (m *Manager) SetBuild(id any, changesArg any) *api.Result {
+	changes, _ := changesArg.(map[string]any)
+	var result *api.Result
+	m.cfg.Mutate(func() {
+		app := m.getLocked(id)
+		if app == nil {
+			result = res(false, __("App %s not found.", jsString(id)))
+			return
+		}
+		if app["type"] != "git" {
+			result = res(false, __("Build settings only apply to git apps."))
+			return
+		}
+		current, _ := app["buildConfig"].(map[string]any)
+		if len(changes) == 0 {
+			result = res(true, buildSummary(current))
+			return
+		}
+		build, err := applyBuildChanges(current, changes)
+		if err != nil {
+			result = res(false, err.Error())
+			return
+		}
+		if len(build) == 0 {
+			delete(app, "buildConfig")
+		} else {
+			app["buildConfig"] = build
+		}
+		m.saveAppsLocked()
+		result = res(true, buildSummary(build))
+	})
+	return result
+}
+
+// ClearBuildCache empties every build cache of an app. The next build
+// downloads its dependencies again.
+func (m *Manager) ClearBuildCache(id any) *api.Result {
+	var name string
+	m.cfg.View(func() {
+		if app := m.getLocked(id); app != nil {
+			name, _ = app["name"].(string)
+		}
+	})
+	if name == "" {
+		return res(false, __("App %s not found.", jsString(id)))
+	}
+	freed, err := m.deps.Docker.ClearBuildCache(name)
+	if err != nil {
+		m.log.Error("Clearing build cache of %s: %s", name, err.Error())
+		return res(false, err.Error())
+	}
+	return res(true, __("Build cache of %s cleared (%s MB freed).", name, itoa(int(freed>>20))))
+}
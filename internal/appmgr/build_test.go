@@ -0,0 +1,111 @@
+package appmgr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateFromGitBuildSettings(t *testing.T) {
+	fx := newFixture(t, []any{})
+	fx.m.deps.Secrets = fakeSecrets{"npm-token": "npm_s3cr3t"}
+
+	r := fx.m.Create(map[string]any{
+		"type": "git", "url": "https://github.com/a/web.git", "name": "web",
+		"build": map[string]any{
+			"args":    map[string]any{"NODE_ENV": "production"},
+			"secrets": map[string]any{"NPM_TOKEN": "npm-token"},
+		},
+	})
+	if !r.Status {
+		t.Fatalf("create failed: %v", r.Message)
+	}
+	fx.waitIdle(t)
+
+	fx.dock.mu.Lock()
+	opts := fx.dock.buildOpts[0]
+	fx.dock.mu.Unlock()
+	if opts.Args["NODE_ENV"] != "production" || opts.Secrets["NPM_TOKEN"] != "npm_s3cr3t" {
+		t.Fatalf("build opts = %+v", opts)
+	}
+	if opts.CacheLimit != defaultBuildCacheMB<<20 {
+		t.Errorf("cache limit = %d", opts.CacheLimit)
+	}
+
+	// Only the reference is stored, and the app.build view shows just that.
+	app := fx.findApp("web")
+	if strings.Contains(jsString(app), "npm_s3cr3t") {
+		t.Fatalf("secret value stored with the app: %v", app)
+	}
+	summary, _ := fx.m.SetBuild("web", nil).Data.(map[string]any)
+	if secrets, _ := summary["secrets"].(map[string]any); secrets["NPM_TOKEN"] != "secret://npm-token" {
+		t.Fatalf("summary = %v", summary)
+	}
+
+	// Changes apply from the next build; a cache of 0 turns caching off.
+	r = fx.m.SetBuild("web", map[string]any{"unset": []any{"NODE_ENV"}, "cache": float64(0)})
+	if !r.Status {
+		t.Fatalf("set build: %v", r.Message)
+	}
+	// The settings must survive the watchdog's reload from config.
+	fx.checkAndSettle(t)
+	if r := fx.m.Redeploy(RedeployPayload{Container: "web"}); !r.Status {
+		t.Fatalf("redeploy: %v", r.Message)
+	}
+	fx.waitIdle(t)
+	fx.dock.mu.Lock()
+	opts = fx.dock.buildOpts[1]
+	fx.dock.mu.Unlock()
+	if len(opts.Args) != 0 || opts.CacheLimit != 0 || opts.Secrets["NPM_TOKEN"] != "npm_s3cr3t" {
+		t.Fatalf("redeploy opts = %+v", opts)
+	}
+
+	if r := fx.m.ClearBuildCache("web"); !r.Status || !strings.Contains(jsString(r.Message), "3 MB") {
+		t.Fatalf("clear: %v", r.Message)
+	}
+	fx.m.Delete("web", true)
+	fx.dock.mu.Lock()
+	cleared := fx.dock.cacheCleared
+	fx.dock.mu.Unlock()
+	if len(cleared) != 2 || cleared[1] != "web" {
+		t.Errorf("cache cleared for %v", cleared)
+	}
+}
+
+func TestBuildSecretMissingFailsBuild(t *testing.T) {
+	fx := newFixture(t, []any{})
+	fx.m.deps.Secrets = fakeSecrets{}
+	r := fx.m.Create(map[string]any{
+		"type": "git", "url": "https://github.com/a/web.git", "name": "web",
+		"build": map[string]any{"secrets": map[string]any{"NPM_TOKEN": "npm-token"}},
+	})
+	if r.Status || fx.appCount() != 0 {
+		t.Fatalf("build ran without its secret: %v", r.Message)
+	}
+	fx.dock.mu.Lock()
+	builds := len(fx.dock.buildCalls)
+	fx.dock.mu.Unlock()
+	if builds != 0 {
+		t.Errorf("build called %d times", builds)
+	}
+}
+
+func TestApplyBuildChangesRejects(t *testing.T) {
+	for _, changes := range []map[string]any{
+		{"args": map[string]any{"BAD-KEY": "v"}},
+		{"secrets": map[string]any{"K": "../x"}},
+		{"secrets": map[string]any{"K": "secret://tls.key?file"}},
+		{"cache": float64(-1)},
+		{"cache": "big"},
+	} {
+		if _, err := applyBuildChanges(nil, changes); err == nil {
+			t.Errorf("%v accepted", changes)
+		}
+	}
+
+	// A key moves between args and secrets instead of living in both.
+	build, _ := applyBuildChanges(map[string]any{"args": map[string]any{"TOKEN": "plain"}},
+		map[string]any{"secrets": map[string]any{"TOKEN": "secret://tok"}})
+	if _, ok := build["args"]; ok || build["secrets"].(map[string]any)["TOKEN"] != "secret://tok" {
+		t.Errorf("build = %v", build)
+	}
+}
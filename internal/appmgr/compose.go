@@ -0,0 +1,326 @@
+package appmgr
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"odac/internal/api"
+)
+
+// The subset of a docker-compose file the importer understands. Anything
+// else (networks, healthchecks, restart policies, ...) is ignored: ODAC
+// provides its own.
+type composeFile struct {
+	Name     string                    `yaml:"name"`
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image       string `yaml:"image"`
+	Build       any    `yaml:"build"`
+	Command     any    `yaml:"command"`
+	Environment any    `yaml:"environment"`
+	DependsOn   any    `yaml:"depends_on"`
+	Ports       []any  `yaml:"ports"`
+	Volumes     []any  `yaml:"volumes"`
+}
+
+// composeKey turns a service name into a template key that is also valid
+// inside an app name.
+func composeKey(service string) string {
+	return strings.Trim(nonNameCharsRE.ReplaceAllString(strings.ToLower(service), "-"), "-")
+}
+
+// composeToTemplate converts a compose file into template apps keyed by
+// service: image, command, environment, depends_on (as linked), ports and
+// volumes. References to another service's host name in environment values
+// become ${key.name}, so they follow the generated container names.
+func composeToTemplate(data []byte) (string, map[string]any, error) {
+	var file composeFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return "", nil, errors.New(__("Invalid compose file: %s", err.Error()))
+	}
+	if len(file.Services) == 0 {
+		return "", nil, errors.New(__("Invalid compose file: no services defined."))
+	}
+
+	keys := map[string]string{}
+	taken := map[string]string{}
+	for service := range file.Services {
+		key := composeKey(service)
+		if key == "" {
+			return "", nil, errors.New(__("Invalid service name: %s", service))
+		}
+		if other, dup := taken[key]; dup {
+			return "", nil, errors.New(__("Services %s and %s map to the same app name.", other, service))
+		}
+		keys[service], taken[key] = key, service
+	}
+
+	apps := map[string]any{}
+	for service, svc := range file.Services {
+		if svc.Image == "" {
+			return "", nil, errors.New(__("Service %s has no image. Build and push it, then set image:.", service))
+		}
+
+		env, err := composeEnv(svc.Environment)
+		if err != nil {
+			return "", nil, errors.New(__("Service %s: %s", service, err.Error()))
+		}
+		for k, v := range env {
+			env[k] = rewriteServiceHosts(k, v.(string), service, keys)
+		}
+
+		linked := []any{}
+		for _, dep := range composeList(svc.DependsOn) {
+			key, ok := keys[dep]
+			if !ok {
+				return "", nil, errors.New(__("Service %s depends on undefined service %s.", service, dep))
+			}
+			linked = append(linked, key)
+		}
+
+		ports := []any{}
+		proxied := false
+		for _, raw := range svc.Ports {
+			port, err := composePort(raw)
+			if err != nil {
+				return "", nil, errors.New(__("Service %s: %s", service, err.Error()))
+			}
+			// An unpublished port is routed by the proxy; only one can be,
+			// and the rest stay reachable from the other services anyway.
+			if _, published := port["host"]; !published {
+				if proxied {
+					continue
+				}
+				proxied = true
+			}
+			ports = append(ports, port)
+		}
+
+		volumes := []any{}
+		for _, raw := range svc.Volumes {
+			vol, err := composeVolume(raw)
+			if err != nil {
+				return "", nil, errors.New(__("Service %s: %s", service, err.Error()))
+			}
+			volumes = append(volumes, vol)
+		}
+
+		apps[keys[service]] = map[string]any{
+			"image":   svc.Image,
+			"cmd":     svc.Command,
+			"env":     env,
+			"linked":  linked,
+			"ports":   ports,
+			"volumes": volumes,
+		}
+	}
+	return file.Name, apps, nil
+}
+
+// composeEnv reads `environment` in either the map or the KEY=VALUE list
+// form. A bare KEY (taken from the shell by compose) becomes empty.
+func composeEnv(raw any) (map[string]any, error) {
+	env := map[string]any{}
+	switch v := raw.(type) {
+	case nil:
+	case map[string]any:
+		for k, val := range v {
+			if val == nil {
+				env[k] = ""
+			} else {
+				env[k] = fmt.Sprint(val)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			entry := fmt.Sprint(item)
+			k, val, _ := strings.Cut(entry, "=")
+			env[k] = val
+		}
+	default:
+		return nil, errors.New(__("environment must be a map or a list"))
+	}
+	return env, nil
+}
+
+// composeList reads a list of names or, for depends_on's long form, the keys
+// of a map.
+func composeList(raw any) []string {
+	var out []string
+	switch v := raw.(type) {
+	case []any:
+		for _, item := range v {
+			out = append(out, fmt.Sprint(item))
+		}
+	case map[string]any:
+		for k := range v {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+	}
+	return out
+}
+
+// rewriteServiceHosts replaces another service used as a host name with
+// ${key.name}: the host part of a URL or host:port anywhere, and a bare
+// value only under a host-like variable, since DB_NAME=db is just a name.
+func rewriteServiceHosts(name, value, self string, keys map[string]string) string {
+	upper := strings.ToUpper(name)
+	hostVar := strings.Contains(upper, "HOST") || strings.Contains(upper, "SERVER") || strings.Contains(upper, "ADDR")
+	for service, key := range keys {
+		if service == self {
+			continue
+		}
+		ref := "${" + key + ".name}"
+		if value == service {
+			if hostVar {
+				value = ref
+			}
+			continue
+		}
+		re := regexp.MustCompile(`(^|@|//)` + regexp.QuoteMeta(service) + `(:|/)`)
+		value = re.ReplaceAllString(value, "${1}$$"+ref[1:]+"${2}")
+	}
+	return value
+}
+
+// composePort converts "80", "8080:80", "127.0.0.1:8080:80" or the long
+// form. Ports published on every interface stay public, as in compose.
+func composePort(raw any) (map[string]any, error) {
+	var ip, published, target, protocol string
+	switch v := raw.(type) {
+	case int:
+		target = strconv.Itoa(v)
+	case string:
+		spec, proto, _ := strings.Cut(v, "/")
+		protocol = proto
+		parts := strings.Split(spec, ":")
+		switch len(parts) {
+		case 1:
+			target = parts[0]
+		case 2:
+			published, target = parts[0], parts[1]
+		case 3:
+			ip, published, target = parts[0], parts[1], parts[2]
+		default:
+			return nil, errors.New(__("unsupported port %s", v))
+		}
+	case map[string]any:
+		target = fmt.Sprint(v["target"])
+		if p, ok := v["published"]; ok && p != nil {
+			published = fmt.Sprint(p)
+		}
+		ip, _ = v["host_ip"].(string)
+		protocol, _ = v["protocol"].(string)
+	default:
+		return nil, errors.New(__("unsupported port %s", raw))
+	}
+	if protocol != "" && protocol != "tcp" {
+		return nil, errors.New(__("only TCP ports are supported: %s", raw))
+	}
+
+	containerPort, err := strconv.Atoi(target)
+	if err != nil || containerPort < 1 || containerPort > 65535 {
+		return nil, errors.New(__("unsupported port %s", raw))
+	}
+	port := map[string]any{"container": float64(containerPort)}
+	if published == "" {
+		if ip != "" {
+			port["host"] = "auto"
+		}
+		return port, nil
+	}
+	hostPort, err := strconv.Atoi(published)
+	if err != nil || hostPort < 1 || hostPort > 65535 {
+		return nil, errors.New(__("unsupported port %s", raw))
+	}
+	port["host"] = float64(hostPort)
+	if ip == "" || ip == "0.0.0.0" || ip == "::" {
+		port["public"] = true
+	}
+	return port, nil
+}
+
+// composeVolume converts "name:/path", "./dir:/path[:ro]", "/path" or the
+// long form. Named volumes and relative binds land in the app's directory;
+// a relative bind may not climb out of it.
+func composeVolume(raw any) (map[string]any, error) {
+	var source, target string
+	switch v := raw.(type) {
+	case string:
+		parts := strings.Split(v, ":")
+		if len(parts) == 1 {
+			target = parts[0]
+		} else {
+			source, target = parts[0], parts[1]
+		}
+	case map[string]any:
+		source, _ = v["source"].(string)
+		target, _ = v["target"].(string)
+	default:
+		return nil, errors.New(__("unsupported volume %s", raw))
+	}
+	if !path.IsAbs(target) {
+		return nil, errors.New(__("volume target must be an absolute path: %s", raw))
+	}
+
+	switch {
+	case source == "":
+		// Anonymous volume: named after its mount point.
+		source = strings.ReplaceAll(strings.Trim(path.Clean(target), "/"), "/", "-")
+		if source == "" {
+			source = "root"
+		}
+	case strings.HasPrefix(source, "~"):
+		return nil, errors.New(__("unsupported volume %s", raw))
+	case strings.HasPrefix(source, "."):
+		source = path.Clean(source)
+		if source == ".." || strings.HasPrefix(source, "../") {
+			return nil, errors.New(__("volume %s points outside the project", source))
+		}
+	}
+	return map[string]any{"host": source, "container": target}, nil
+}
+
+// createFromCompose deploys a docker-compose file as a template: one app per
+// service, started in depends_on order. The stack is named by cfg.name, the
+// file's own name: or cfg.project (the directory it came from), in that order.
+func (m *Manager) createFromCompose(cfg map[string]any) *api.Result {
+	data, _ := cfg["compose"].(string)
+	if data == "" {
+		return res(false, __("Missing compose file."))
+	}
+	fileName, apps, err := composeToTemplate([]byte(data))
+	if err != nil {
+		m.clog.Log("createFromCompose: %s", err.Error())
+		return res(false, err.Error())
+	}
+
+	name, _ := cfg["name"].(string)
+	if name == "" {
+		name = fileName
+	}
+	if name == "" {
+		name, _ = cfg["project"].(string)
+	}
+	name = composeKey(name)
+	if name == "" {
+		name = "compose"
+	}
+	if !validAppName(name) {
+		return res(false, __("Invalid app name."))
+	}
+
+	var baseName string
+	m.cfg.View(func() { baseName = m.generateUniqueNameLocked(name) })
+	return m.createFromTemplate(baseName, name, apps, cfg)
+}
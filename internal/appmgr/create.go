@@ -19,7 +19,7 @@ import (
 )
 
 var (
-	templateVarRE = regexp.MustCompile(`\$\{([a-zA-Z0-9_]+)\.([a-zA-Z0-9_.]+)\}`)
+	templateVarRE = regexp.MustCompile(`\$\{([a-zA-Z0-9_-]+)\.([a-zA-Z0-9_.]+)\}`)
 	// createDispatchGitRE is the narrow protocol set the string-dispatch
 	// uses (fromGit's own validation allows ftp/rsync too).
 	createDispatchGitRE = regexp.MustCompile(`^(https?|git|ssh)://`)
@@ -111,7 +111,16 @@ func (m *Manager) Create(config any) *api.Result {
 		}
 	}
 
-	if cfgJSON, err := json.Marshal(cfg); err == nil {
+	logged := cfg
+	if compose, ok := cfg["compose"].(string); ok {
+		// The file's environment may hold credentials.
+		logged = make(map[string]any, len(cfg))
+		for k, v := range cfg {
+			logged[k] = v
+		}
+		logged["compose"] = itoa(len(compose)) + " bytes"
+	}
+	if cfgJSON, err := json.Marshal(logged); err == nil {
 		m.clog.Log("Creating app: " + string(cfgJSON))
 	}
 
@@ -127,6 +136,8 @@ func (m *Manager) Create(config any) *api.Result {
 		return m.createFromGit(cfg)
 	case "template":
 		return m.createFromTemplatePayload(cfg)
+	case "compose":
+		return m.createFromCompose(cfg)
 	default:
 		return res(false, __("Unknown config type: %s", typ))
 	}
@@ -155,7 +166,8 @@ func (m *Manager) isCreating(name string) bool {
 	return m.creating[name]
 }
 
-// createFromRecipe ports #fromRecipe: single-app Hub recipes ("mysql").
+// createFromRecipe ports #fromRecipe: single-app recipes ("mysql") from the
+// Hub, the local catalog or inline.
 func (m *Manager) createFromRecipe(cfg map[string]any) *api.Result {
 	appType, _ := cfg["app"].(string)
 	customName, _ := cfg["name"].(string)
@@ -167,10 +179,7 @@ func (m *Manager) createFromRecipe(cfg map[string]any) *api.Result {
 
 	m.clog.Log("createFromRecipe: Fetching recipe for %s", appType)
 
-	if m.deps.Hub == nil {
-		return res(false, __("Could not find recipe for %s: %s", appType, "Hub is not available"))
-	}
-	recipe, err := m.deps.Hub.GetApp(appType)
+	recipe, err := m.loadRecipe(cfg, appType)
 	if err != nil {
 		m.clog.Error("createFromRecipe: Failed to fetch recipe: %s", err.Error())
 		return res(false, __("Could not find recipe for %s: %s", appType, err.Error()))
@@ -584,14 +593,23 @@ func (m *Manager) createFromTemplate(baseName, recipeName string, templateApps m
 
 // createFromGit ports #fromGit.
 func (m *Manager) createFromGit(cfg map[string]any) *api.Result {
+	return m.deployGit(cfg, nil)
+}
+
+// deployGit clones, builds and starts a git app. preview, when set, marks
+// the app as a preview environment: it clones with its parent's deploy key
+// and persists the block on the app.
+func (m *Manager) deployGit(cfg map[string]any, preview map[string]any) *api.Result {
 	url, _ := cfg["url"].(string)
 	token, _ := cfg["token"].(string)
 	branch, _ := cfg["branch"].(string)
 	name, _ := cfg["name"].(string)
+	rawPath, _ := cfg["path"].(string)
+	knownHosts, _ := cfg["knownHosts"].(string)
 	dev := cfg["dev"] == true
 
 	m.clog.Log("createFromGit: Starting git deployment")
-	m.clog.Log("createFromGit: URL: %s, Branch: %s, Name: %s", url, branch, name)
+	m.clog.Log("createFromGit: URL: %s, Branch: %s, Name: %s, Path: %s", url, branch, name, rawPath)
 
 	if url == "" {
 		return res(false, __("Missing git URL"))
@@ -606,6 +624,15 @@ func (m *Manager) createFromGit(cfg map[string]any) *api.Result {
 	if !validBranch(branch) {
 		return res(false, __("Invalid branch name format."))
 	}
+	repoPath, err := cleanRepoPath(rawPath)
+	if err != nil {
+		return res(false, err.Error())
+	}
+	buildChanges, _ := cfg["build"].(map[string]any)
+	build, err := applyBuildChanges(nil, buildChanges)
+	if err != nil {
+		return res(false, err.Error())
+	}
 	if name == "" {
 		return res(false, __("Missing app name"))
 	}
@@ -647,6 +674,19 @@ func (m *Manager) createFromGit(cfg map[string]any) *api.Result {
 		return res(false, err.Error())
 	}
 
+	// SSH remotes authenticate with the app's deploy key. Creating it here
+	// too (not only through app.deploykey) keeps a failed first attempt
+	// useful: the key in the error is the one the retry will use.
+	deployKey := ""
+	keyOwner := name
+	if preview != nil {
+		keyOwner, _ = preview["parent"].(string)
+	} else if sshGitURL(url) {
+		if deployKey, err = m.ensureDeployKey(name, knownHosts); err != nil {
+			return res(false, err.Error())
+		}
+	}
+
 	imageName := "odac-app-" + name
 	logCtrl, err := logger.NewBuildStream(generateRuntimeID("build"), map[string]any{
 		"image":    imageName,
@@ -658,6 +698,7 @@ func (m *Manager) createFromGit(cfg map[string]any) *api.Result {
 
 	fail := func(err error) *api.Result {
 		m.clog.Error("createFromGit: Failed: %s", err.Error())
+		m.alert("app.build_failed", name, __("Building new app %s failed: %s", name, err.Error()), 1)
 		logCtrl.Finalize(false)
 		if _, statErr := os.Stat(appDir); statErr == nil {
 			os.RemoveAll(appDir)
@@ -667,14 +708,25 @@ func (m *Manager) createFromGit(cfg map[string]any) *api.Result {
 
 	m.clog.Log("createFromGit: Cloning repository...")
 	logCtrl.StartPhase("git_clone")
-	if err := m.deps.Docker.CloneRepo(url, branch, appDir, token, logCtrl); err != nil {
+	if err := m.deps.Docker.CloneRepo(url, branch, appDir, token, m.gitSSHDir(keyOwner, url), logCtrl); err != nil {
+		if deployKey != "" {
+			err = errors.New(__("%s Make sure this deploy key is added to the repository:\n%s", err.Error(), deployKey))
+		}
 		return fail(err)
 	}
 	logCtrl.EndPhase("git_clone", true)
 	m.clog.Log("createFromGit: Clone successful")
 
+	buildDir, err := sourceDir(appDir, repoPath)
+	if err != nil {
+		return fail(err)
+	}
+	buildOpts, err := m.buildOptions(build)
+	if err != nil {
+		return fail(err)
+	}
 	m.clog.Log("createFromGit: Building image...")
-	if err := m.deps.Docker.Build(appDir, imageName, name, logCtrl); err != nil {
+	if err := m.deps.Docker.Build(buildDir, imageName, name, buildOpts, logCtrl); err != nil {
 		return fail(err)
 	}
 	m.clog.Log("createFromGit: Build successful")
@@ -741,6 +793,15 @@ func (m *Manager) createFromGit(cfg map[string]any) *api.Result {
 		if branch != "" {
 			app["branch"] = branch
 		}
+		if repoPath != "" {
+			app["path"] = repoPath
+		}
+		if len(build) > 0 {
+			app["buildConfig"] = build
+		}
+		if preview != nil {
+			app["preview"] = preview
+		}
 		appID = app["id"]
 		m.apps = append(m.apps, app)
 		m.saveAppsLocked()
@@ -766,6 +827,9 @@ func (m *Manager) createFromGit(cfg map[string]any) *api.Result {
 	m.hubTrigger("app.list")
 
 	logCtrl.Finalize(true)
+	if deployKey != "" {
+		return res(true, __("App %s deployed successfully. Deploy key:\n%s", name, deployKey))
+	}
 	return res(true, __("App %s deployed successfully.", name))
 }
 
@@ -50,13 +50,17 @@ func (m *Manager) performBlueGreenDeploy(id any, greenName string, options deplo
 		operation = "Redeploy"
 	}
 
-	var appName string
+	var appName, identity string
 	m.cfg.Mutate(func() {
 		app := m.getLocked(id)
 		if app == nil {
 			return
 		}
 		appName, _ = app["name"].(string)
+		identity = appName
+		if ai, _ := app["_appIdentity"].(string); ai != "" {
+			identity = ai
+		}
 		portList, _ := app["ports"].([]any)
 		primary := ports.Primary(portList)
 		if primary == nil || !jsTruthy(primary["container"]) {
@@ -168,6 +172,8 @@ func (m *Manager) performBlueGreenDeploy(id any, greenName string, options deplo
 
 	m.deps.Docker.Stop(appName)
 	m.deps.Docker.Remove(appName)
+	// Only the green is left; it keeps its own secrets dir after the rename.
+	m.pruneSecretFiles(identity, greenName)
 
 	if m.appDeleted(id) {
 		m.deps.Docker.Stop(greenName)
@@ -228,6 +228,11 @@ func TestStandardRestartForAppWithoutDomains(t *testing.T) {
 	if len(fx.dock.runCalls) != 1 || fx.dock.runCalls[0].name != "plain" {
 		t.Fatalf("runCalls = %v", fx.dock.runCalls)
 	}
+	fx.proxy.mu.Lock()
+	defer fx.proxy.mu.Unlock()
+	if len(fx.proxy.maintenance) != 0 {
+		t.Fatalf("maintenance toggled for an app without domains: %v", fx.proxy.maintenance)
+	}
 }
 
 // A host-networked app owns its port host-wide, so a green container would
@@ -260,6 +265,37 @@ func TestHostNetworkSkipsBlueGreen(t *testing.T) {
 		if len(fx.dock.renames) != 0 {
 			t.Fatalf("renames = %v, want none without a green container", fx.dock.renames)
 		}
+
+		// The recreate gap is covered by the maintenance page.
+		fx.proxy.mu.Lock()
+		defer fx.proxy.mu.Unlock()
+		if len(fx.proxy.maintenance) != 2 || !fx.proxy.maintenance[0] || fx.proxy.maintenance[1] {
+			t.Fatalf("maintenance = %v, want on then off", fx.proxy.maintenance)
+		}
+	})
+
+	t.Run("redeploy recreates in place", func(t *testing.T) {
+		fx := gitAppWithDomain(t)
+		fx.cfg.Mutate(func() {
+			if app := fx.m.getLocked(float64(1)); app != nil {
+				app["networkMode"] = "host"
+			}
+		})
+
+		if r := fx.m.Redeploy(RedeployPayload{Container: "web"}); !r.Status {
+			t.Fatalf("redeploy failed: %v", r.Message)
+		}
+		fx.waitIdle(t)
+
+		fx.proxy.mu.Lock()
+		defer fx.proxy.mu.Unlock()
+		if len(fx.proxy.maintenance) != 2 || !fx.proxy.maintenance[0] || fx.proxy.maintenance[1] {
+			t.Fatalf("maintenance = %v, want on then off once", fx.proxy.maintenance)
+		}
+		// Raising and lifting maintenance each push the config; no third sync.
+		if fx.proxy.syncs != 2 {
+			t.Fatalf("syncs = %d, want 2", fx.proxy.syncs)
+		}
 	})
 
 	t.Run("bridge app with the same shape still gets ZDD", func(t *testing.T) {
@@ -0,0 +1,156 @@
+package appmgr
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"odac/internal/api"
+)
+
+// sshGitURL reports whether a remote is reached over SSH (ssh:// or the
+// scp-like git@host:owner/repo form) and so needs a deploy key.
+func sshGitURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "ssh://") || (!strings.Contains(rawURL, "://") && scpLikeURL.MatchString(rawURL))
+}
+
+// deployKeyDir holds an app's deploy key pair and the known_hosts file
+// pinning its git server. It sits under <base>/keys, outside the config and
+// app directories, and is mounted only into the git sandbox.
+func (m *Manager) deployKeyDir(name string) string {
+	return filepath.Join(m.cfg.BaseDir(), "keys", "deploy", name)
+}
+
+// ensureDeployKey returns the app's public key in authorized_keys form,
+// generating an ed25519 pair on first use. knownHosts, when given, pins the
+// git server's host key instead of trusting it on first connection.
+func (m *Manager) ensureDeployKey(name, knownHosts string) (string, error) {
+	dir := m.deployKeyDir(name)
+	if knownHosts != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "known_hosts"), []byte(strings.TrimSpace(knownHosts)+"\n"), 0o600); err != nil {
+			return "", err
+		}
+	}
+	if pub, err := os.ReadFile(filepath.Join(dir, "id_ed25519.pub")); err == nil {
+		return strings.TrimSpace(string(pub)), nil
+	}
+
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	block, err := ssh.MarshalPrivateKey(privKey, "odac-"+name)
+	if err != nil {
+		return "", err
+	}
+	sshPub, err := ssh.NewPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	pub := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " odac-" + name
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "id_ed25519.pub"), []byte(pub+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	m.log.Log("Generated deploy key for %s", name)
+	return pub, nil
+}
+
+// gitSSHDir is the sshDir argument for clone/fetch: the app's deploy key
+// directory for SSH remotes that have one, "" otherwise.
+func (m *Manager) gitSSHDir(name, rawURL string) string {
+	if !sshGitURL(rawURL) {
+		return ""
+	}
+	dir := m.deployKeyDir(name)
+	if _, err := os.Stat(filepath.Join(dir, "id_ed25519")); err != nil {
+		return ""
+	}
+	return dir
+}
+
+// deployKeyOwner names the app whose deploy key clones and fetches use: a
+// preview environment borrows its parent's.
+func deployKeyOwner(app map[string]any) string {
+	if preview, _ := app["preview"].(map[string]any); preview != nil {
+		if parent, _ := preview["parent"].(string); parent != "" {
+			return parent
+		}
+	}
+	name, _ := app["name"].(string)
+	return name
+}
+
+// DeployKey returns (creating it if needed) the public deploy key for an
+// app, so it can be added to the repository before the first clone. The
+// app does not have to exist yet.
+func (m *Manager) DeployKey(nameArg, knownHostsArg any) *api.Result {
+	name, _ := nameArg.(string)
+	knownHosts, _ := knownHostsArg.(string)
+	if !validAppName(name) {
+		return res(false, __("Invalid app name."))
+	}
+	pub, err := m.ensureDeployKey(name, knownHosts)
+	if err != nil {
+		m.log.Error("Deploy key for %s: %s", name, err.Error())
+		return res(false, err.Error())
+	}
+	return res(true, __("Add this deploy key (read-only) to the repository:\n%s", pub))
+}
+
+// cleanRepoPath validates a monorepo subdirectory: relative, inside the
+// repository, and free of shell metacharacters. "" and "." mean the root.
+func cleanRepoPath(p string) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+	clean := path.Clean(strings.ReplaceAll(p, "\\", "/"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || hasIllegalURLChars(clean) || strings.HasPrefix(clean, "-") {
+		return "", errors.New(__("Invalid repository path: %s", p))
+	}
+	if clean == "." {
+		return "", nil
+	}
+	return clean, nil
+}
+
+// sourceDir resolves the directory to build from: the repository root, or
+// the app's subdirectory, which must exist and may not lead out of the
+// clone through a symlink.
+func sourceDir(appDir, repoPath string) (string, error) {
+	if repoPath == "" {
+		return appDir, nil
+	}
+	dir := filepath.Join(appDir, filepath.FromSlash(repoPath))
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", errors.New(__("Path %s not found in the repository.", repoPath))
+	}
+	root, err := filepath.EvalSymlinks(appDir)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(real, root+string(filepath.Separator)) {
+		return "", errors.New(__("Invalid repository path: %s", repoPath))
+	}
+	if info, err := os.Stat(real); err != nil || !info.IsDir() {
+		return "", errors.New(__("Path %s is not a directory.", repoPath))
+	}
+	return dir, nil
+}
@@ -0,0 +1,104 @@
+package appmgr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateFromGitSSHMonorepo(t *testing.T) {
+	fx := newFixture(t, []any{})
+	fx.dock.mu.Lock()
+	fx.dock.cloneHook = func(dir string) { os.MkdirAll(filepath.Join(dir, "services", "api"), 0o755) }
+	fx.dock.mu.Unlock()
+
+	r := fx.m.Create(map[string]any{
+		"type": "git", "url": "git@git.example.com:team/mono.git", "name": "api", "path": "./services/api/",
+	})
+	if !r.Status {
+		t.Fatalf("create failed: %v", r.Message)
+	}
+	if !strings.Contains(jsString(r.Message), "ssh-ed25519 ") {
+		t.Errorf("deploy key not shown: %q", jsString(r.Message))
+	}
+	fx.waitIdle(t)
+
+	keyDir := fx.m.deployKeyDir("api")
+	info, err := os.Stat(filepath.Join(keyDir, "id_ed25519"))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("private key: %v %v", info, err)
+	}
+	appDir := filepath.Join(fx.m.appsPath(), "api")
+	fx.dock.mu.Lock()
+	sshDirs, sources := fx.dock.gitSSHDirs, fx.dock.buildSources
+	fx.dock.mu.Unlock()
+	if len(sshDirs) != 1 || sshDirs[0] != keyDir {
+		t.Errorf("ssh dirs = %v", sshDirs)
+	}
+	if len(sources) != 1 || sources[0] != filepath.Join(appDir, "services", "api") {
+		t.Errorf("build sources = %v", sources)
+	}
+	if app := fx.findApp("api"); app["path"] != "services/api" {
+		t.Fatalf("path = %v", app["path"])
+	}
+
+	// Redeploy reuses the key and builds the same subdirectory.
+	if r := fx.m.Redeploy(RedeployPayload{Container: "api"}); !r.Status {
+		t.Fatalf("redeploy failed: %v", r.Message)
+	}
+	fx.waitIdle(t)
+	fx.dock.mu.Lock()
+	sshDirs, sources = fx.dock.gitSSHDirs, fx.dock.buildSources
+	fx.dock.mu.Unlock()
+	if len(sshDirs) != 2 || sshDirs[1] != keyDir || sources[1] != sources[0] {
+		t.Errorf("redeploy ssh dirs = %v, sources = %v", sshDirs, sources)
+	}
+
+	fx.m.Delete("api", true)
+	if _, err := os.Stat(keyDir); !os.IsNotExist(err) {
+		t.Error("deploy key outlived a purged app")
+	}
+}
+
+func TestCreateFromGitRejectsBadPath(t *testing.T) {
+	for _, p := range []string{"../other", "/etc", "a/../../b", "x;rm"} {
+		fx := newFixture(t, []any{})
+		r := fx.m.Create(map[string]any{"type": "git", "url": "https://github.com/a/b.git", "name": "x", "path": p})
+		if r.Status || !strings.Contains(jsString(r.Message), "Invalid repository path") {
+			t.Errorf("%s: %v", p, r.Message)
+		}
+	}
+
+	// A path missing from the clone fails the build step and leaves no app.
+	fx := newFixture(t, []any{})
+	r := fx.m.Create(map[string]any{"type": "git", "url": "https://github.com/a/b.git", "name": "x", "path": "nope"})
+	if r.Status || fx.appCount() != 0 {
+		t.Fatalf("missing path accepted: %v", r.Message)
+	}
+}
+
+func TestDeployKey(t *testing.T) {
+	fx := newFixture(t, []any{})
+
+	first := fx.m.DeployKey("web", "")
+	second := fx.m.DeployKey("web", "git.example.com ssh-ed25519 AAAAC3Nza")
+	if !first.Status || jsString(first.Message) != jsString(second.Message) {
+		t.Fatalf("key changed between calls: %v / %v", first.Message, second.Message)
+	}
+	hosts, _ := os.ReadFile(filepath.Join(fx.m.deployKeyDir("web"), "known_hosts"))
+	if string(hosts) != "git.example.com ssh-ed25519 AAAAC3Nza\n" {
+		t.Errorf("known_hosts = %q", hosts)
+	}
+	if r := fx.m.DeployKey("../web", ""); r.Status {
+		t.Error("invalid name accepted")
+	}
+
+	// HTTPS remotes never get the key mounted.
+	if dir := fx.m.gitSSHDir("web", "https://github.com/a/b.git"); dir != "" {
+		t.Errorf("https remote got ssh dir %s", dir)
+	}
+	if dir := fx.m.gitSSHDir("web", "ssh://git@git.example.com/a/b.git"); dir == "" {
+		t.Error("ssh remote without key dir")
+	}
+}
@@ -38,11 +38,14 @@ func getManualEnv(envConfig map[string]any) map[string]any {
 
 // sanitizeEnv ports #sanitizeEnv: mask values whose key matches the
 // sensitive pattern (dev cd7f08b: cert|key|salt|secret|token, `pass` is NOT
-// masked).
+// masked). A secret:// reference is shown as is: it names the secret and
+// holds no value.
 func sanitizeEnv(env map[string]any) map[string]any {
 	sanitized := make(map[string]any, len(env))
 	for key, value := range env {
-		if isSensitiveKey(key) {
+		if _, _, ref := parseSecretRef(value); ref {
+			sanitized[key] = value
+		} else if isSensitiveKey(key) {
 			sanitized[key] = "***"
 		} else {
 			sanitized[key] = value
@@ -61,10 +64,54 @@ func isSensitiveKey(key string) bool {
 	return false
 }
 
+// minRedactLen keeps short values such as "1" or "true" from being masked
+// everywhere they appear in a log line.
+const minRedactLen = 4
+
+// SensitiveValues returns the values to mask in logs that leave the host:
+// those of an app's env vars with sensitive names and of every secret its
+// env references. An empty name collects them across all apps.
+func (m *Manager) SensitiveValues(appName string) []string {
+	var values []string
+	m.cfg.View(func() {
+		for _, app := range m.apps {
+			if appName != "" && app["name"] != appName {
+				continue
+			}
+			for key, v := range m.mergeEnvLocked(app, false) {
+				value := jsString(v)
+				if name, _, ok := parseSecretRef(v); ok {
+					if m.deps.Secrets == nil {
+						continue
+					}
+					if value, _ = m.deps.Secrets.Reveal(name); value == "" {
+						continue
+					}
+				} else if !isSensitiveKey(key) {
+					continue
+				}
+				if len(value) >= minRedactLen {
+					values = append(values, value)
+				}
+			}
+		}
+	})
+	return values
+}
+
 // resolveEnvLocked ports #resolveEnv: system defaults, then linked apps'
 // manual envs, then the app's own manual envs (overriding). Caller holds
 // cfg.View/Mutate (linked apps are resolved through the working set).
-func (m *Manager) resolveEnvLocked(app map[string]any, includeSystem bool) map[string]any {
+// secret:// references, including ones inherited from linked apps, are
+// resolved here; files holds the secrets to mount under /run/secrets.
+func (m *Manager) resolveEnvLocked(app map[string]any, includeSystem bool) (env map[string]any, files map[string]string) {
+	env = m.mergeEnvLocked(app, includeSystem)
+	appName, _ := app["name"].(string)
+	return env, m.revealSecretsLocked(appName, env)
+}
+
+// mergeEnvLocked layers the env without resolving secret:// references.
+func (m *Manager) mergeEnvLocked(app map[string]any, includeSystem bool) map[string]any {
 	finalEnv := map[string]any{}
 	if includeSystem {
 		finalEnv["HOST"] = "0.0.0.0"
@@ -278,6 +325,16 @@ func (m *Manager) SetEnv(id any, env map[string]any) *api.Result {
 			result = res(false, __("Invalid env payload. Expected an object."))
 			return
 		}
+		// Script containers start without the app's env, so a reference
+		// would never reach them.
+		if app["type"] == "script" {
+			for k, v := range env {
+				if _, _, ok := parseSecretRef(v); ok {
+					result = res(false, __("Script app %s cannot use secret references (%s).", app["name"], k))
+					return
+				}
+			}
+		}
 
 		envConfig, _ := app["env"].(map[string]any)
 		if isNewEnvStructure(envConfig) {
@@ -3,7 +3,10 @@ package appmgr
 // Ports of App.test.js "environment management" (incl. the cd7f08b masking
 // change: `pass` no longer masks).
 
-import "testing"
+import (
+	"slices"
+	"testing"
+)
 
 func envFixture(t *testing.T) *fixture {
 	return newFixture(t, []any{
@@ -59,6 +62,24 @@ func TestGetEnvMasksSensitiveValues(t *testing.T) {
 	}
 }
 
+func TestSensitiveValues(t *testing.T) {
+	fx := envFixture(t)
+
+	if got := fx.m.SensitiveValues("app-main"); len(got) != 1 || got[0] != "secret-key-123" {
+		t.Errorf("app-main = %v", got)
+	}
+	// POSTGRES_PASSWORD is not a sensitive name (dev cd7f08b).
+	if all := fx.m.SensitiveValues(""); !slices.Equal(all, []string{"secret-key-123"}) {
+		t.Errorf("all apps = %v", all)
+	}
+
+	fx.m.deps.Secrets = fakeSecrets{"db-password": "pg-pass-9"}
+	fx.m.SetEnv("app-main", map[string]any{"PGPASS": "secret://db-password", "TOKEN_HINT": "no"})
+	if got := fx.m.SensitiveValues("app-main"); !slices.Contains(got, "pg-pass-9") || slices.Contains(got, "no") {
+		t.Errorf("with a secret reference = %v", got)
+	}
+}
+
 func TestSetEnvMergesAndMigratesLegacy(t *testing.T) {
 	fx := envFixture(t)
 
@@ -254,7 +275,7 @@ func TestDeleteThenRecreateSameNameDoesNotReviveLink(t *testing.T) {
 
 	var resolved map[string]any
 	fx.cfg.View(func() {
-		resolved = fx.m.resolveEnvLocked(fx.m.getLocked("app-main"), false)
+		resolved, _ = fx.m.resolveEnvLocked(fx.m.getLocked("app-main"), false)
 	})
 	if _, ok := resolved["POSTGRES_PASSWORD"]; ok {
 		t.Fatalf("recreated app's secret leaked into app-main: %v", resolved)
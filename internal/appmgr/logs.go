@@ -0,0 +1,154 @@
+package appmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"odac/internal/api"
+	"odac/internal/applog"
+)
+
+// exportsToKeep bounds the log archives kept per app.
+const exportsToKeep = 5
+
+// Logs searches an app's runtime logs, including rotated files. The query
+// takes any of since and until (Unix ms, a time ago such as "2h" or "7d",
+// or an RFC 3339 time), grep (a regular expression), stream ("out" or
+// "err"), limit and cursor; see applog.Query.
+func (m *Manager) Logs(id any, queryArg any) *api.Result {
+	name, q, err := m.logQuery(id, queryArg)
+	if err != nil {
+		return res(false, err.Error())
+	}
+	page, err := applog.New(m.logsRoot, name).Query(q)
+	if err != nil {
+		return res(false, err.Error())
+	}
+	return res(true, page)
+}
+
+// LogsExport writes the runtime log lines a query selects to a gzip
+// archive in the app's log directory and returns its path.
+func (m *Manager) LogsExport(id any, queryArg any) *api.Result {
+	name, q, err := m.logQuery(id, queryArg)
+	if err != nil {
+		return res(false, err.Error())
+	}
+	dir := filepath.Join(m.logsRoot, name, "exports")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return res(false, err.Error())
+	}
+	path := filepath.Join(dir, name+"-runtime-"+time.Now().UTC().Format("20060102-150405")+".log.gz")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return res(false, err.Error())
+	}
+	count, err := applog.New(m.logsRoot, name).Export(q, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		m.log.Error("Exporting logs of %s: %s", name, err.Error())
+		return res(false, err.Error())
+	}
+	pruneExports(dir)
+	return res(true, __("Exported %s log lines of %s to %s", itoa(count), name, path),
+		map[string]any{"path": path, "lines": count})
+}
+
+// logQuery resolves the app and parses a Logs query.
+func (m *Manager) logQuery(id any, queryArg any) (string, applog.Query, error) {
+	var q applog.Query
+	var name string
+	m.cfg.View(func() {
+		if app := m.getLocked(id); app != nil {
+			name, _ = app["name"].(string)
+		}
+	})
+	if name == "" {
+		return "", q, errors.New(__("App %s not found.", jsString(id)))
+	}
+	query, _ := queryArg.(map[string]any)
+	now := time.Now()
+	var err error
+	if q.Since, err = parseLogTime(query["since"], now); err != nil {
+		return "", q, err
+	}
+	if q.Until, err = parseLogTime(query["until"], now); err != nil {
+		return "", q, err
+	}
+	if pattern, _ := query["grep"].(string); pattern != "" {
+		if q.Pattern, err = regexp.Compile(pattern); err != nil {
+			return "", q, errors.New(__("Invalid grep pattern: %s", err.Error()))
+		}
+	}
+	switch stream, _ := query["stream"].(string); stream {
+	case "", "out", "err":
+		q.Stream = stream
+	default:
+		return "", q, errors.New(__("Invalid log stream %s. Use out or err.", stream))
+	}
+	if limit, ok := query["limit"].(float64); ok {
+		q.Limit = int(limit)
+	}
+	q.Cursor, _ = query["cursor"].(string)
+	return name, q, nil
+}
+
+// parseLogTime reads a query bound as Unix ms, as a time before now ("90s",
+// "2h", "7d") or as an RFC 3339 time or date. Absent is 0.
+func parseLogTime(v any, now time.Time) (int64, error) {
+	switch t := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return int64(t), nil
+	case string:
+		if t == "" {
+			return 0, nil
+		}
+		if days, ok := strings.CutSuffix(t, "d"); ok {
+			if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+				return now.AddDate(0, 0, -n).UnixMilli(), nil
+			}
+		}
+		if d, err := time.ParseDuration(t); err == nil && d >= 0 {
+			return now.Add(-d).UnixMilli(), nil
+		}
+		if at, err := time.Parse(time.RFC3339, t); err == nil {
+			return at.UnixMilli(), nil
+		}
+		if at, err := time.ParseInLocation("2006-01-02", t, time.Local); err == nil {
+			return at.UnixMilli(), nil
+		}
+	}
+	return 0, errors.New(__("Invalid time %s. Use a duration such as 2h or 7d, or an RFC 3339 time.", jsString(v)))
+}
+
+// pruneExports keeps the newest exportsToKeep archives in dir.
+func pruneExports(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, de := range entries {
+		if strings.HasSuffix(de.Name(), ".log.gz") {
+			names = append(names, de.Name())
+		}
+	}
+	if len(names) <= exportsToKeep {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names[:len(names)-exportsToKeep] {
+		os.Remove(filepath.Join(dir, name))
+	}
+}
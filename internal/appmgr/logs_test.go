@@ -0,0 +1,85 @@
+package appmgr
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"odac/internal/applog"
+)
+
+func TestParseLogTime(t *testing.T) {
+	now := time.Date(2026, 7, 11, 12, 0, 0, 0, time.UTC)
+	for in, want := range map[any]time.Time{
+		"2h":                   now.Add(-2 * time.Hour),
+		"90s":                  now.Add(-90 * time.Second),
+		"7d":                   now.AddDate(0, 0, -7),
+		"2026-07-01T08:00:00Z": time.Date(2026, 7, 1, 8, 0, 0, 0, time.UTC),
+		float64(1000):          time.UnixMilli(1000),
+	} {
+		got, err := parseLogTime(in, now)
+		if err != nil || got != want.UnixMilli() {
+			t.Errorf("parseLogTime(%v) = %d, %v", in, got, err)
+		}
+	}
+	if got, err := parseLogTime(nil, now); got != 0 || err != nil {
+		t.Errorf("absent bound = %d, %v", got, err)
+	}
+	if _, err := parseLogTime("yesterday", now); err == nil {
+		t.Error("accepted an unparseable time")
+	}
+}
+
+func TestLogsQueryAndExport(t *testing.T) {
+	fx := newFixture(t, []any{map[string]any{"id": float64(1), "name": "web", "type": "container", "active": false}})
+	logger, err := fx.m.getLogger("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := logger.NewRuntimeStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Write([]byte("listening on 8080\n"))
+	stream.Error([]byte("panic: boom\n"))
+	stream.End()
+
+	r := fx.m.Logs("web", map[string]any{"since": "1h", "stream": "err"})
+	if !r.Status {
+		t.Fatalf("logs: %v", r.Message)
+	}
+	if page, _ := r.Data.(applog.Page); len(page.Lines) != 1 || page.Lines[0].Text != "panic: boom" {
+		t.Errorf("logs = %+v", r.Data)
+	}
+
+	for _, bad := range []map[string]any{{"grep": "("}, {"stream": "both"}, {"since": "soon"}} {
+		if r := fx.m.Logs("web", bad); r.Status {
+			t.Errorf("accepted %v", bad)
+		}
+	}
+	if r := fx.m.Logs("nope", nil); r.Status {
+		t.Error("queried logs of an unknown app")
+	}
+
+	r = fx.m.LogsExport("web", map[string]any{"grep": "listening"})
+	if !r.Status {
+		t.Fatalf("export: %v", r.Message)
+	}
+	path, _ := r.Data.(map[string]any)["path"].(string)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(zr)
+	if !strings.HasSuffix(string(raw), " out listening on 8080\n") || strings.Contains(string(raw), "boom") {
+		t.Errorf("archive = %q", raw)
+	}
+}
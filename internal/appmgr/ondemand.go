@@ -0,0 +1,142 @@
+package appmgr
+
+import (
+	"net"
+	"strings"
+
+	"odac/internal/api"
+	"odac/internal/netmode"
+)
+
+const (
+	defaultOnDemandLimit = 20 // certificates per hour
+	maxOnDemandLimit     = 1000
+)
+
+// SetOnDemand turns on-demand TLS on or off for an app: the proxy then
+// answers hostnames nobody registered, checks each against the app's ask
+// endpoint or allow patterns and, once approved, routes it to the app with
+// a certificate issued on the fly. settings is {ask: "/path", allow:
+// [patterns], limit: per hour} or {enabled: false}; an empty payload reports
+// the current settings. Domains already issued stay until deleted.
+func (m *Manager) SetOnDemand(id any, settingsArg any) *api.Result {
+	settings, _ := settingsArg.(map[string]any)
+	next, failure := onDemandSettings(settings)
+	if failure != nil {
+		return failure
+	}
+
+	var result *api.Result
+	changed := false
+	m.cfg.Mutate(func() {
+		app := m.getLocked(id)
+		if app == nil {
+			result = res(false, __("App %s not found.", jsString(id)))
+			return
+		}
+		name, _ := app["name"].(string)
+		current, _ := app["onDemand"].(map[string]any)
+		switch {
+		case len(settings) == 0:
+			if current == nil {
+				result = res(true, map[string]any{"enabled": false})
+				return
+			}
+			report := copyMap(current)
+			report["enabled"] = true
+			result = res(true, report)
+		case next == nil:
+			if current == nil {
+				result = res(true, __("On-demand TLS is not enabled for %s.", name))
+				return
+			}
+			delete(app, "onDemand")
+			m.saveAppsLocked()
+			changed = true
+			result = res(true, __("On-demand TLS disabled for %s. Domains it already issued stay until deleted.", name))
+		case netmode.IsHost(app["networkMode"]):
+			result = res(false, __("App %s uses host networking, which rules out zero-downtime deploys, so domains cannot be routed to it. Switch it to bridge networking first: odac app network %s --bridge", name, name))
+		default:
+			app["onDemand"] = next
+			m.saveAppsLocked()
+			changed = true
+			result = res(true, __("On-demand TLS enabled for %s (at most %s certificates per hour).", name, itoa(int(next["limit"].(float64)))))
+		}
+	})
+	if changed {
+		m.proxySync()
+	}
+	return result
+}
+
+// onDemandSettings validates the payload and returns the settings to store,
+// nil for {enabled: false}.
+func onDemandSettings(settings map[string]any) (map[string]any, *api.Result) {
+	if len(settings) == 0 || settings["enabled"] == false {
+		return nil, nil
+	}
+	next := map[string]any{"limit": float64(defaultOnDemandLimit)}
+
+	if v, present := settings["ask"]; present && v != nil && v != "" {
+		ask, _ := v.(string)
+		if !strings.HasPrefix(ask, "/") || strings.ContainsAny(ask, " \t\r\n#") {
+			return nil, res(false, __("Invalid ask path %s: it must start with /.", jsString(v)))
+		}
+		next["ask"] = ask
+	}
+
+	var patterns []string
+	switch v := settings["allow"].(type) {
+	case string:
+		patterns = splitActions(v)
+	case []any:
+		for _, p := range v {
+			s, _ := p.(string)
+			patterns = append(patterns, s)
+		}
+	}
+	if len(patterns) > 0 {
+		allow := make([]any, 0, len(patterns))
+		for _, p := range patterns {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if !validOnDemandPattern(p) {
+				return nil, res(false, __("Invalid allow pattern %s: use a hostname or *.example.com.", p))
+			}
+			allow = append(allow, p)
+		}
+		next["allow"] = allow
+	}
+	if next["ask"] == nil && next["allow"] == nil {
+		return nil, res(false, __("On-demand TLS needs an ask path, allow patterns, or both."))
+	}
+
+	if v, present := settings["limit"]; present {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n > maxOnDemandLimit || n != float64(int(n)) {
+			return nil, res(false, __("Invalid limit: use a whole number of certificates per hour from 1 to %s.", itoa(maxOnDemandLimit)))
+		}
+		next["limit"] = n
+	}
+	return next, nil
+}
+
+// validOnDemandPattern accepts a hostname, optionally behind a leading "*.",
+// of at least two labels, so "*.com" cannot claim a whole TLD.
+func validOnDemandPattern(p string) bool {
+	host, _ := strings.CutPrefix(p, "*.")
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 || net.ParseIP(host) != nil {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
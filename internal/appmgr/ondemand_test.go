@@ -0,0 +1,57 @@
+package appmgr
+
+import "testing"
+
+func TestSetOnDemand(t *testing.T) {
+	fx := newFixture(t, []any{map[string]any{"id": float64(1), "name": "saas", "type": "container"}})
+
+	if r := fx.m.SetOnDemand("saas", map[string]any{"ask": "/domains/check", "allow": "*.customers.test, Shop.Example.com", "limit": float64(50)}); !r.Status {
+		t.Fatalf("enable failed: %v", r.Message)
+	}
+	od, _ := fx.app(0)["onDemand"].(map[string]any)
+	allow, _ := od["allow"].([]any)
+	if od["ask"] != "/domains/check" || od["limit"] != float64(50) || len(allow) != 2 || allow[1] != "shop.example.com" {
+		t.Fatalf("onDemand = %v", od)
+	}
+	if fx.proxy.syncs != 1 {
+		t.Errorf("syncs = %d", fx.proxy.syncs)
+	}
+
+	r := fx.m.SetOnDemand("saas", nil)
+	if report, _ := r.Data.(map[string]any); report["enabled"] != true || report["ask"] != "/domains/check" {
+		t.Fatalf("report = %v", r.Data)
+	}
+
+	for name, settings := range map[string]map[string]any{
+		"nothing to check": {"limit": float64(5)},
+		"relative ask":     {"ask": "check"},
+		"tld wildcard":     {"allow": []any{"*.com"}},
+		"ip pattern":       {"allow": []any{"10.0.0.1"}},
+		"zero limit":       {"ask": "/ok", "limit": float64(0)},
+		"huge limit":       {"ask": "/ok", "limit": float64(5000)},
+	} {
+		if r := fx.m.SetOnDemand("saas", settings); r.Status {
+			t.Errorf("%s accepted", name)
+		}
+	}
+	if od, _ := fx.app(0)["onDemand"].(map[string]any); od["limit"] != float64(50) {
+		t.Fatalf("rejected settings stored: %v", od)
+	}
+
+	if r := fx.m.SetOnDemand("saas", map[string]any{"enabled": false}); !r.Status {
+		t.Fatalf("disable failed: %v", r.Message)
+	}
+	if _, present := fx.app(0)["onDemand"]; present || fx.proxy.syncs != 2 {
+		t.Fatalf("app = %v, syncs = %d", fx.app(0), fx.proxy.syncs)
+	}
+}
+
+func TestSetOnDemandRefusesHostNetworking(t *testing.T) {
+	fx := newFixture(t, []any{map[string]any{"id": float64(1), "name": "saas", "networkMode": "host"}})
+	if r := fx.m.SetOnDemand("saas", map[string]any{"ask": "/ok"}); r.Status {
+		t.Fatal("host-networked app accepted")
+	}
+	if _, present := fx.app(0)["onDemand"]; present {
+		t.Fatal("settings stored")
+	}
+}
@@ -123,7 +123,7 @@ func (m *Manager) StopAll() {
 
 // Delete ports App.delete: force-cleanup regardless of in-flight state.
 func (m *Manager) Delete(id any, purge bool) *api.Result {
-	var name string
+	var name, identity string
 	var idNum float64
 	var activeContainerID string
 	found := false
@@ -131,6 +131,10 @@ func (m *Manager) Delete(id any, purge bool) *api.Result {
 		if app := m.getLocked(id); app != nil {
 			found = true
 			name, _ = app["name"].(string)
+			identity = name
+			if ai, _ := app["_appIdentity"].(string); ai != "" {
+				identity = ai
+			}
 			idNum, _ = app["id"].(float64)
 			activeContainerID, _ = app["activeContainerId"].(string)
 		}
@@ -213,6 +217,19 @@ func (m *Manager) Delete(id any, purge bool) *api.Result {
 		if err := os.RemoveAll(appDir); err != nil {
 			m.log.Error("Failed to remove app directory for %s: %s", name, err.Error())
 		}
+		if name != "" {
+			if err := os.RemoveAll(m.deployKeyDir(name)); err != nil {
+				m.log.Error("Failed to remove deploy key for %s: %s", name, err.Error())
+			}
+			if _, err := m.deps.Docker.ClearBuildCache(name); err != nil {
+				m.log.Error("Failed to remove build cache for %s: %s", name, err.Error())
+			}
+		}
+	}
+	if identity != "" {
+		if err := os.RemoveAll(m.secretsPath(identity)); err != nil {
+			m.log.Error("Failed to remove secret files for %s: %s", name, err.Error())
+		}
 	}
 
 	// Cascading delete: remove associated domains.
@@ -222,6 +239,11 @@ func (m *Manager) Delete(id any, purge bool) *api.Result {
 		}
 	}
 
+	// Cascading delete: previews cannot outlive the app they were cut from.
+	if removed := m.deletePreviewsOf(name, purge); removed > 0 {
+		m.log.Log("Removed %s preview(s) of %s", itoa(removed), name)
+	}
+
 	m.hubTrigger("app.list")
 
 	return res(true, __("App %s deleted successfully.", name))
@@ -321,6 +343,10 @@ func (m *Manager) Restart(id any) *api.Result {
 
 	m.log.Log("Standard restart for %s (not ZDD-eligible). Stopping old container first.", name)
 
+	if m.hasDomainsFor(name, idNum) {
+		m.proxyMaintenance(idNum, true)
+		defer m.proxyMaintenance(idNum, false)
+	}
 	m.Stop(idNum)
 
 	// Give the container environment a moment to release resources.
@@ -381,11 +407,11 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 		return res(false, __("Missing container name"))
 	}
 
-	var name, appBranch, appURL, appImage string
+	var name, appBranch, appURL, appImage, repoPath, keyOwner string
 	var idNum float64
 	var typ string
 	var hasGitMeta bool
-	var gitMeta map[string]any
+	var gitMeta, build map[string]any
 	found := false
 	m.cfg.View(func() {
 		if app := m.getLocked(appName); app != nil {
@@ -396,6 +422,11 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 			appBranch, _ = app["branch"].(string)
 			appURL, _ = app["url"].(string)
 			appImage, _ = app["image"].(string)
+			repoPath, _ = app["path"].(string)
+			keyOwner = deployKeyOwner(app)
+			if b, _ := app["buildConfig"].(map[string]any); b != nil {
+				build = copyMap(b)
+			}
 			if g, _ := app["git"].(map[string]any); g != nil {
 				hasGitMeta = true
 				gitMeta = copyMap(g)
@@ -454,6 +485,7 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 
 	fail := func(err error) *api.Result {
 		m.log.Error("Redeploy failed for %s: %s", name, err.Error())
+		m.alert("app.build_failed", name, __("Redeploy of %s failed: %s", name, err.Error()), 1)
 		if logCtrl != nil {
 			logCtrl.Write([]byte("[Error] " + err.Error() + "\n"))
 			logCtrl.Finalize(false)
@@ -516,7 +548,7 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 
 	if hasGit {
 		// Fast path: incremental fetch (delta download only).
-		if err := m.deps.Docker.FetchRepo(targetURL, targetBranch, appDir, payload.Token, payload.CommitSha, logCtrl); err != nil {
+		if err := m.deps.Docker.FetchRepo(targetURL, targetBranch, appDir, payload.Token, m.gitSSHDir(keyOwner, targetURL), payload.CommitSha, logCtrl); err != nil {
 			return fail(err)
 		}
 	} else {
@@ -528,7 +560,7 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 		if err := os.MkdirAll(appDir, 0o755); err != nil {
 			return fail(err)
 		}
-		if err := m.deps.Docker.CloneRepo(targetURL, targetBranch, appDir, payload.Token, logCtrl); err != nil {
+		if err := m.deps.Docker.CloneRepo(targetURL, targetBranch, appDir, payload.Token, m.gitSSHDir(keyOwner, targetURL), logCtrl); err != nil {
 			return fail(err)
 		}
 	}
@@ -540,7 +572,15 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 
 	// Step 2: rebuild the image (app still running on the old one).
 	m.set(idNum, map[string]any{"status": "building"})
-	if err := m.deps.Docker.Build(appDir, imageName, name, logCtrl); err != nil {
+	buildDir, err := sourceDir(appDir, repoPath)
+	if err != nil {
+		return fail(err)
+	}
+	buildOpts, err := m.buildOptions(build)
+	if err != nil {
+		return fail(err)
+	}
+	if err := m.deps.Docker.Build(buildDir, imageName, name, buildOpts, logCtrl); err != nil {
 		return fail(err)
 	}
 
@@ -566,6 +606,13 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 		// Standard redeploy (no domains).
 		m.log.Log("Standard redeploy for %s (not ZDD-eligible). Stopping old container first.", name)
 
+		// Maintenance is lifted on both exits below rather than at return,
+		// so the site is back before the image prune. Lifting it syncs the
+		// proxy, which otherwise needs its own sync for the new container.
+		maintenance := m.hasDomainsFor(name, idNum)
+		if maintenance {
+			m.proxyMaintenance(idNum, true)
+		}
 		logCtrl.StartPhase("stop_old_container")
 		m.Stop(idNum)
 		logCtrl.EndPhase("stop_old_container", true)
@@ -574,6 +621,9 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 
 		logCtrl.StartPhase("start_new_container")
 		if err := m.runGitApp(idNum, ""); err != nil {
+			if maintenance {
+				m.proxyMaintenance(idNum, false)
+			}
 			return fail(err)
 		}
 		logCtrl.EndPhase("start_new_container", true)
@@ -587,7 +637,11 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 		})
 
 		logCtrl.StartPhase("proxy_propagation")
-		m.proxySync()
+		if maintenance {
+			m.proxyMaintenance(idNum, false)
+		} else {
+			m.proxySync()
+		}
 		m.proxyPurge(idNum)
 		logCtrl.EndPhase("proxy_propagation", true)
 	}
@@ -615,6 +669,7 @@ func (m *Manager) Redeploy(payload RedeployPayload) *api.Result {
 	if len(updates) > 0 {
 		m.set(idNum, updates)
 	}
+	m.touchPreview(idNum)
 
 	// The rebuild retagged odac-app-<name> onto fresh layers, orphaning the
 	// previous image as an untagged (<none>) dangling entry. Sweep those now
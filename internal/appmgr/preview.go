@@ -0,0 +1,493 @@
+package appmgr
+
+import (
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"odac/internal/api"
+	"odac/internal/ports"
+)
+
+// defaultPreviewTTLHours tears a preview down after three days without a
+// deploy, unless the parent app sets its own TTL.
+const defaultPreviewTTLHours = 72
+
+// branchSlug turns a branch name into a DNS label: lowercase letters,
+// digits and single hyphens, at most 63 characters.
+func branchSlug(branch string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(branch) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimRight(b.String(), "-")
+	if len(slug) > 63 {
+		slug = strings.TrimRight(slug[:63], "-")
+	}
+	return slug
+}
+
+// previewName is the child app's name: <parent>-<slug>, cut to the 63
+// characters an app name allows.
+func previewName(parent, slug string) string {
+	name := parent + "-" + slug
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
+
+// previewTTL reads a parent's TTL in hours. ok is false when the parent has
+// not opted into previews.
+func previewTTL(app map[string]any) (ttl float64, ok bool) {
+	settings, _ := app["previews"].(map[string]any)
+	if settings == nil {
+		return 0, false
+	}
+	if n, isNum := settings["ttl"].(float64); isNum && n > 0 {
+		return n, true
+	}
+	return defaultPreviewTTLHours, true
+}
+
+// previewDomainLocked picks the parent domain previews hang off: the
+// shortest plain domain routed to the app. Caller holds cfg.View or Mutate.
+func (m *Manager) previewDomainLocked(appName string) (domain string, wildcard bool) {
+	domains, _ := m.cfg.Get("domains").(map[string]any)
+	var names []string
+	for name, rec := range domains {
+		record, _ := rec.(map[string]any)
+		if record == nil || record["appId"] != appName || record["wildcard"] != nil {
+			continue
+		}
+		if strings.HasPrefix(name, "*.") || !strings.Contains(name, ".") || net.ParseIP(name) != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	record, _ := domains[names[0]].(map[string]any)
+	subs, _ := record["subdomain"].([]any)
+	for _, sub := range subs {
+		if sub == "*" {
+			wildcard = true
+		}
+	}
+	return names[0], wildcard
+}
+
+// SetPreviews opts a git app into preview environments or out of them.
+// settings is {enabled: bool, ttl: hours}; an empty payload reports the
+// current settings. Opting out tears every preview of the app down.
+func (m *Manager) SetPreviews(id any, settingsArg any) *api.Result {
+	settings, _ := settingsArg.(map[string]any)
+	var name string
+	var result *api.Result
+	m.cfg.Mutate(func() {
+		app := m.getLocked(id)
+		if app == nil {
+			result = res(false, __("App %s not found.", jsString(id)))
+			return
+		}
+		name, _ = app["name"].(string)
+		if app["type"] != "git" || app["preview"] != nil {
+			result = res(false, __("Preview environments only apply to git apps."))
+			return
+		}
+		if len(settings) == 0 {
+			ttl, enabled := previewTTL(app)
+			result = res(true, map[string]any{"enabled": enabled, "ttl": ttl})
+			return
+		}
+		if settings["enabled"] == false {
+			delete(app, "previews")
+			m.saveAppsLocked()
+			return
+		}
+		current, _ := app["previews"].(map[string]any)
+		next := copyMap(current)
+		if v, present := settings["ttl"]; present {
+			hours, ok := v.(float64)
+			if !ok || hours <= 0 {
+				result = res(false, __("Invalid preview TTL."))
+				return
+			}
+			next["ttl"] = hours
+		}
+		app["previews"] = next
+		m.saveAppsLocked()
+		ttl, _ := previewTTL(app)
+		result = res(true, __("Preview environments enabled for %s (teardown after %s hours without a deploy).", name, itoa(int(ttl))))
+	})
+	if result != nil {
+		return result
+	}
+
+	removed := m.deletePreviewsOf(name, true)
+	return res(true, __("Preview environments disabled for %s (%s removed).", name, itoa(removed)))
+}
+
+// PreviewCreate deploys branch of a git app as a preview environment, or
+// redeploys the branch head when the preview already exists. opts carries
+// {env: {K: V}} overrides on top of the parent's env and a token for
+// private HTTPS remotes, which is used for this clone only.
+func (m *Manager) PreviewCreate(id any, branchArg any, optsArg any) *api.Result {
+	branch, _ := branchArg.(string)
+	opts, _ := optsArg.(map[string]any)
+	slug := branchSlug(branch)
+	if branch == "" || slug == "" || !validBranch(branch) {
+		return res(false, __("Invalid branch name format."))
+	}
+	token, _ := opts["token"].(string)
+
+	var parentName, url, repoPath, domain, conflict string
+	var wildcard, exists bool
+	var build, manual map[string]any
+	var linked []any
+	var port any
+	var result *api.Result
+	m.cfg.View(func() {
+		parent := m.getLocked(id)
+		if parent == nil {
+			result = res(false, __("App %s not found.", jsString(id)))
+			return
+		}
+		parentName, _ = parent["name"].(string)
+		if parent["type"] != "git" || parent["preview"] != nil {
+			result = res(false, __("Preview environments only apply to git apps."))
+			return
+		}
+		if _, ok := previewTTL(parent); !ok {
+			result = res(false, __("Preview environments are not enabled for %s. Enable them with: odac app preview enable %s", parentName, parentName))
+			return
+		}
+		url, _ = parent["url"].(string)
+		repoPath, _ = parent["path"].(string)
+		if b, _ := parent["buildConfig"].(map[string]any); b != nil {
+			build = copyMap(b)
+		}
+		env, _ := parent["env"].(map[string]any)
+		parentManual, _ := env["manual"].(map[string]any)
+		manual = copyMap(parentManual)
+		if l, _ := env["linked"].([]any); l != nil {
+			linked = append([]any(nil), l...)
+		}
+		portList, _ := parent["ports"].([]any)
+		for _, p := range portList {
+			if entry, _ := p.(map[string]any); entry != nil && entry["host"] == ports.Proxy {
+				port = entry["container"]
+			}
+		}
+
+		if child := m.getLocked(previewName(parentName, slug)); child != nil {
+			preview, _ := child["preview"].(map[string]any)
+			if preview == nil || preview["parent"] != parentName || preview["branch"] != branch {
+				conflict, _ = child["name"].(string)
+				return
+			}
+			exists = true
+		}
+		domain, wildcard = m.previewDomainLocked(parentName)
+	})
+	if result != nil {
+		return result
+	}
+	name := previewName(parentName, slug)
+	if conflict != "" {
+		return res(false, __("App %s already exists", conflict))
+	}
+	if exists {
+		return m.Redeploy(RedeployPayload{Container: name, Token: token})
+	}
+
+	overrides, _ := opts["env"].(map[string]any)
+	for k, v := range overrides {
+		manual[k] = v
+	}
+	if linked == nil {
+		linked = []any{}
+	}
+	cfg := map[string]any{
+		"url":    url,
+		"token":  token,
+		"branch": branch,
+		"name":   name,
+		"path":   repoPath,
+		"env":    map[string]any{"manual": manual, "linked": linked},
+	}
+	if build != nil {
+		cfg["build"] = build
+	}
+	if port != nil {
+		cfg["port"] = port
+	}
+	preview := map[string]any{"parent": parentName, "branch": branch, "active": nowMs()}
+	host := ""
+	if domain != "" && m.deps.DomainBinder != nil {
+		host = slug + "." + domain
+		preview["host"] = host
+	}
+
+	m.log.Log("Creating preview %s of %s (branch: %s)", name, parentName, branch)
+	if r := m.deployGit(cfg, preview); !r.Status {
+		return r
+	}
+	if host == "" {
+		return res(true, __("Preview %s of %s deployed. Add a domain to %s to give previews their own host.", name, parentName, parentName))
+	}
+
+	// The parent's wildcard covers every preview host with one DNS record
+	// and one certificate.
+	if !wildcard {
+		if r := m.deps.DomainBinder.Add("*."+domain, parentName); !r.Status {
+			m.log.Error("Preview wildcard for %s: %s", domain, jsString(r.Message))
+		}
+	}
+	if r := m.deps.DomainBinder.Add(host, name); !r.Status {
+		m.log.Error("Preview host %s: %s", host, jsString(r.Message))
+		return res(true, __("Preview %s of %s deployed, but its host could not be added: %s", name, parentName, jsString(r.Message)))
+	}
+	return res(true, __("Preview %s of %s deployed at https://%s", name, parentName, host))
+}
+
+// PreviewList lists the preview environments of an app, or of every app
+// when id is empty.
+func (m *Manager) PreviewList(id any) *api.Result {
+	parentName := ""
+	type row struct {
+		name, parent, branch, host string
+		active, ttl                float64
+	}
+	var rows []row
+	var result *api.Result
+	m.cfg.View(func() {
+		if jsTruthy(id) {
+			parent := m.getLocked(id)
+			if parent == nil {
+				result = res(false, __("App %s not found.", jsString(id)))
+				return
+			}
+			parentName, _ = parent["name"].(string)
+		}
+		ttls := map[string]float64{}
+		for _, app := range m.apps {
+			if ttl, ok := previewTTL(app); ok {
+				name, _ := app["name"].(string)
+				ttls[name] = ttl
+			}
+		}
+		for _, app := range m.apps {
+			preview, _ := app["preview"].(map[string]any)
+			if preview == nil {
+				continue
+			}
+			r := row{}
+			r.name, _ = app["name"].(string)
+			r.parent, _ = preview["parent"].(string)
+			r.branch, _ = preview["branch"].(string)
+			r.host, _ = preview["host"].(string)
+			r.active, _ = preview["active"].(float64)
+			r.ttl = ttls[r.parent]
+			if parentName == "" || r.parent == parentName {
+				rows = append(rows, r)
+			}
+		}
+	})
+	if result != nil {
+		return result
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].name < rows[j].name })
+	out := make([]any, 0, len(rows))
+	for _, r := range rows {
+		status := "stopped"
+		if m.deps.Docker.GetStatus(r.name).Running {
+			status = "running"
+		}
+		url := ""
+		if r.host != "" {
+			url = "https://" + r.host
+		}
+		expires := ""
+		if r.ttl > 0 && r.active > 0 {
+			expires = time.UnixMilli(int64(r.active + r.ttl*3600000)).UTC().Format(time.RFC3339)
+		}
+		out = append(out, map[string]any{
+			"name":    r.name,
+			"app":     r.parent,
+			"branch":  r.branch,
+			"url":     url,
+			"status":  status,
+			"expires": expires,
+		})
+	}
+	return res(true, out)
+}
+
+// PreviewDelete tears down one preview of an app, named by its branch or
+// its app name.
+func (m *Manager) PreviewDelete(id any, branchArg any) *api.Result {
+	branch, _ := branchArg.(string)
+	var parentName, target string
+	found := false
+	m.cfg.View(func() {
+		parent := m.getLocked(id)
+		if parent == nil {
+			return
+		}
+		found = true
+		parentName, _ = parent["name"].(string)
+		for _, app := range m.apps {
+			preview, _ := app["preview"].(map[string]any)
+			if preview == nil || preview["parent"] != parentName {
+				continue
+			}
+			if preview["branch"] == branch || app["name"] == branch {
+				target, _ = app["name"].(string)
+				return
+			}
+		}
+	})
+	if !found {
+		return res(false, __("App %s not found.", jsString(id)))
+	}
+	if target == "" {
+		return res(false, __("No preview of %s for branch %s.", parentName, branch))
+	}
+	return m.Delete(target, true)
+}
+
+// deletePreviewsOf removes every preview of an app and reports how many
+// went.
+func (m *Manager) deletePreviewsOf(parentName string, purge bool) int {
+	var names []string
+	m.cfg.View(func() {
+		for _, app := range m.apps {
+			if preview, _ := app["preview"].(map[string]any); preview != nil && preview["parent"] == parentName {
+				name, _ := app["name"].(string)
+				names = append(names, name)
+			}
+		}
+	})
+	for _, name := range names {
+		m.Delete(name, purge)
+	}
+	return len(names)
+}
+
+// touchPreview restarts a preview's inactivity clock after a deploy.
+func (m *Manager) touchPreview(id any) {
+	m.cfg.Mutate(func() {
+		app := m.getLocked(id)
+		preview, _ := app["preview"].(map[string]any)
+		if preview == nil {
+			return
+		}
+		next := copyMap(preview)
+		next["active"] = nowMs()
+		app["preview"] = next
+		m.saveAppsLocked()
+	})
+}
+
+// schedulePreviewSweep starts a sweep from the watchdog tick when one is
+// due. Checking remotes takes a git sandbox per preview, so it runs far
+// less often than the tick and never twice at once.
+func (m *Manager) schedulePreviewSweep() {
+	m.mu.Lock()
+	due := !m.previewSweeping && time.Since(m.previewSweptAt) >= m.previewSweepInterval
+	if due {
+		m.previewSweeping = true
+		m.previewSweptAt = time.Now()
+	}
+	m.mu.Unlock()
+	if !due {
+		return
+	}
+	m.spawn(func() {
+		defer func() {
+			m.mu.Lock()
+			m.previewSweeping = false
+			m.mu.Unlock()
+		}()
+		m.sweepPreviews()
+	})
+}
+
+// sweepPreviews tears down previews whose parent is gone or opted out,
+// that saw no deploy within the parent's TTL, or whose branch no longer
+// exists on the remote. A remote that cannot be reached keeps the preview.
+func (m *Manager) sweepPreviews() {
+	type candidate struct {
+		id                        float64
+		name, parent, branch, url string
+		active                    float64
+	}
+	var candidates []candidate
+	ttls := map[string]float64{}
+	m.cfg.View(func() {
+		for _, app := range m.apps {
+			name, _ := app["name"].(string)
+			if ttl, ok := previewTTL(app); ok && app["preview"] == nil {
+				ttls[name] = ttl
+			}
+			preview, _ := app["preview"].(map[string]any)
+			if preview == nil {
+				continue
+			}
+			c := candidate{name: name}
+			c.id, _ = app["id"].(float64)
+			c.url, _ = app["url"].(string)
+			c.parent, _ = preview["parent"].(string)
+			c.branch, _ = preview["branch"].(string)
+			c.active, _ = preview["active"].(float64)
+			candidates = append(candidates, c)
+		}
+	})
+
+	now := nowMs()
+	for _, c := range candidates {
+		if m.inFlight(c.id, c.name) {
+			continue
+		}
+		reason := ""
+		ttl, enabled := ttls[c.parent]
+		switch {
+		case !enabled:
+			reason = "its app is gone or no longer has previews enabled"
+		case now-c.active > ttl*3600000:
+			reason = "no deploy in " + itoa(int(ttl)) + " hours"
+		default:
+			workDir := filepath.Join(m.appsPath(), c.name)
+			exists, err := m.deps.Docker.RemoteBranchExists(c.url, c.branch, workDir, "", m.gitSSHDir(c.parent, c.url))
+			if err != nil {
+				m.log.Error("Preview sweep: checking branch %s of %s: %s", c.branch, c.name, err.Error())
+				continue
+			}
+			if !exists {
+				reason = "branch " + c.branch + " was deleted"
+			}
+		}
+		if reason != "" {
+			m.log.Log("Preview sweep: removing %s (%s)", c.name, reason)
+			m.Delete(c.name, true)
+		}
+	}
+}
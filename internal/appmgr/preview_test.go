@@ -0,0 +1,210 @@
+package appmgr
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"odac/internal/api"
+)
+
+type fakeBinder struct {
+	mu    sync.Mutex
+	added [][2]string // domain, app
+}
+
+func (f *fakeBinder) Add(domain, appID any) api.Result {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.added = append(f.added, [2]string{jsString(domain), jsString(appID)})
+	return api.Res(true, "ok")
+}
+
+func previewParent() map[string]any {
+	return map[string]any{
+		"id": float64(1), "name": "web", "type": "git", "url": "git@github.com:a/web.git",
+		"image": "odac-app-web", "active": false, "status": "stopped",
+		"env":         map[string]any{"manual": map[string]any{"A": "1", "B": "2"}, "linked": []any{}},
+		"ports":       []any{map[string]any{"host": "proxy", "container": float64(8080)}},
+		"buildConfig": map[string]any{"args": map[string]any{"X": "y"}},
+	}
+}
+
+func TestBranchSlugAndPreviewName(t *testing.T) {
+	for branch, want := range map[string]string{
+		"feature/Login":     "feature-login",
+		"fix--double__dash": "fix-double-dash",
+		"-release/1.2-":     "release-1-2",
+		"///":               "",
+	} {
+		if got := branchSlug(branch); got != want {
+			t.Errorf("branchSlug(%q) = %q, want %q", branch, got, want)
+		}
+	}
+	if got := previewName(strings.Repeat("a", 60), "feature"); len(got) > 63 || strings.HasSuffix(got, "-") {
+		t.Errorf("previewName = %q", got)
+	}
+}
+
+func TestPreviewCreateListDelete(t *testing.T) {
+	fx := newFixture(t, []any{previewParent()})
+	binder := &fakeBinder{}
+	fx.m.deps.DomainBinder = binder
+	fx.cfg.Mutate(func() {
+		fx.cfg.Set("domains", map[string]any{
+			"web.example.com": map[string]any{"appId": "web", "subdomain": []any{"www"}},
+		})
+	})
+	if _, err := fx.m.ensureDeployKey("web", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := fx.m.PreviewCreate("web", "feature/Login", nil); r.Status || !strings.Contains(jsString(r.Message), "not enabled") {
+		t.Fatalf("created without opting in: %v", r.Message)
+	}
+	if r := fx.m.SetPreviews("web", map[string]any{"enabled": true, "ttl": float64(24)}); !r.Status {
+		t.Fatalf("enable: %v", r.Message)
+	}
+
+	r := fx.m.PreviewCreate("web", "feature/Login", map[string]any{"env": map[string]any{"B": "3"}})
+	if !r.Status || !strings.Contains(jsString(r.Message), "https://feature-login.web.example.com") {
+		t.Fatalf("create: %v", r.Message)
+	}
+	fx.waitIdle(t)
+
+	child := fx.findApp("web-feature-login")
+	preview, _ := child["preview"].(map[string]any)
+	if preview["parent"] != "web" || preview["branch"] != "feature/Login" || preview["host"] != "feature-login.web.example.com" {
+		t.Fatalf("preview = %v", child["preview"])
+	}
+	manual, _ := child["env"].(map[string]any)["manual"].(map[string]any)
+	if manual["A"] != "1" || manual["B"] != "3" {
+		t.Errorf("env = %v", manual)
+	}
+	portList, _ := child["ports"].([]any)
+	if port, _ := portList[0].(map[string]any); port["container"] != float64(8080) {
+		t.Errorf("ports = %v", child["ports"])
+	}
+
+	fx.dock.mu.Lock()
+	clone := fx.dock.cloneCalls[0]
+	sshDir := fx.dock.gitSSHDirs[0]
+	opts := fx.dock.buildOpts[0]
+	fx.dock.mu.Unlock()
+	if clone[1] != "feature/Login" {
+		t.Errorf("cloned branch %q", clone[1])
+	}
+	if sshDir != fx.m.deployKeyDir("web") {
+		t.Errorf("clone used %q, want the parent's deploy key", sshDir)
+	}
+	if opts.Args["X"] != "y" {
+		t.Errorf("build opts = %+v", opts)
+	}
+
+	binder.mu.Lock()
+	added := append([][2]string(nil), binder.added...)
+	binder.mu.Unlock()
+	want := [][2]string{{"*.web.example.com", "web"}, {"feature-login.web.example.com", "web-feature-login"}}
+	if len(added) != 2 || added[0] != want[0] || added[1] != want[1] {
+		t.Errorf("domains added = %v", added)
+	}
+
+	rows, _ := fx.m.PreviewList("web").Data.([]any)
+	if len(rows) != 1 || rows[0].(map[string]any)["url"] != "https://feature-login.web.example.com" {
+		t.Fatalf("list = %v", rows)
+	}
+
+	// Creating it again redeploys the branch head, still with the parent's key.
+	if r := fx.m.PreviewCreate("web", "feature/Login", nil); !r.Status || !strings.Contains(jsString(r.Message), "redeployed") {
+		t.Fatalf("redeploy: %v", r.Message)
+	}
+	fx.waitIdle(t)
+	fx.dock.mu.Lock()
+	sshDirs := append([]string(nil), fx.dock.gitSSHDirs...)
+	fx.dock.mu.Unlock()
+	if len(sshDirs) != 2 || sshDirs[1] != fx.m.deployKeyDir("web") {
+		t.Errorf("git ssh dirs = %v", sshDirs)
+	}
+
+	if r := fx.m.PreviewDelete("web", "nope"); r.Status {
+		t.Error("deleted a preview that does not exist")
+	}
+	if r := fx.m.PreviewDelete("web", "feature/Login"); !r.Status {
+		t.Fatalf("delete: %v", r.Message)
+	}
+	if fx.findApp("web-feature-login") != nil || fx.findApp("web") == nil {
+		t.Fatal("delete removed the wrong app")
+	}
+}
+
+func TestPreviewsGoWithTheirApp(t *testing.T) {
+	fx := newFixture(t, []any{previewParent()})
+	fx.m.SetPreviews("web", map[string]any{"enabled": true})
+	for _, branch := range []string{"a", "b"} {
+		if r := fx.m.PreviewCreate("web", branch, nil); !r.Status {
+			t.Fatalf("create %s: %v", branch, r.Message)
+		}
+	}
+	fx.waitIdle(t)
+	if fx.appCount() != 3 {
+		t.Fatalf("apps = %d", fx.appCount())
+	}
+	if r := fx.m.SetPreviews("web", map[string]any{"enabled": false}); !r.Status || !strings.Contains(jsString(r.Message), "2 removed") {
+		t.Fatalf("disable: %v", r.Message)
+	}
+
+	fx.m.SetPreviews("web", map[string]any{"enabled": true})
+	fx.m.PreviewCreate("web", "c", nil)
+	fx.waitIdle(t)
+	fx.m.Delete("web", true)
+	if fx.appCount() != 0 {
+		t.Errorf("apps left after deleting the parent: %d", fx.appCount())
+	}
+}
+
+func TestPreviewSweep(t *testing.T) {
+	hour := float64(3600000)
+	now := nowMs()
+	parent := previewParent()
+	parent["previews"] = map[string]any{"ttl": float64(1)}
+	child := func(name, parent, branch string, active float64) map[string]any {
+		return map[string]any{
+			"id": float64(len(name)), "name": name, "type": "git", "url": "https://github.com/a/web.git", "active": false,
+			"preview": map[string]any{"parent": parent, "branch": branch, "active": active},
+		}
+	}
+	fx := newFixture(t, []any{
+		parent,
+		child("web-stale", "web", "stale", now-2*hour),
+		child("web-gone-branch", "web", "gone", now),
+		child("web-live", "web", "live", now),
+		child("web-orphaned-x", "ghost", "x", now),
+	})
+	fx.dock.goneBranches = map[string]bool{"gone": true}
+
+	fx.checkAndSettle(t)
+	for name, kept := range map[string]bool{"web-stale": false, "web-gone-branch": false, "web-live": true, "web-orphaned-x": false} {
+		if (fx.findApp(name) != nil) != kept {
+			t.Errorf("%s kept = %v, want %v", name, !kept, kept)
+		}
+	}
+
+	// The next tick is inside the sweep interval; an unreachable remote
+	// keeps the preview.
+	fx.dock.mu.Lock()
+	checked := len(fx.dock.lsRemotes)
+	fx.dock.lsRemoteErr = errors.New("auth failed")
+	fx.dock.mu.Unlock()
+	fx.checkAndSettle(t)
+	fx.dock.mu.Lock()
+	again := len(fx.dock.lsRemotes)
+	fx.dock.mu.Unlock()
+	if again != checked {
+		t.Errorf("swept again within the interval")
+	}
+	fx.m.sweepPreviews()
+	if fx.findApp("web-live") == nil {
+		t.Error("an unreachable remote tore the preview down")
+	}
+}
@@ -0,0 +1,72 @@
+package appmgr
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// recipeNameRE bounds catalog lookups to plain file names.
+var recipeNameRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,62}$`)
+
+// recipesPath is the local recipe catalog: one <name>.json per recipe, in
+// the schema the Hub returns (image, env directives, ports, volumes,
+// configs, or apps for a multi-app stack).
+func (m *Manager) recipesPath() string {
+	return filepath.Join(m.cfg.BaseDir(), "recipes")
+}
+
+// localRecipe reads name from the local catalog. ok is false when the
+// catalog has no such recipe.
+func (m *Manager) localRecipe(name string) (recipe map[string]any, ok bool, err error) {
+	if !recipeNameRE.MatchString(name) {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(filepath.Join(m.recipesPath(), name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(data, &recipe); err != nil || recipe == nil {
+		return nil, false, errors.New(__("Invalid recipe file %s.json", name))
+	}
+	return recipe, true, nil
+}
+
+// loadRecipe resolves a recipe for createFromRecipe: an inline cfg.recipe
+// (odac app create --recipe ./stack.json) first, then the local catalog,
+// then the Hub. The recipe name defaults to what was asked for.
+func (m *Manager) loadRecipe(cfg map[string]any, appType string) (map[string]any, error) {
+	recipe, _ := cfg["recipe"].(map[string]any)
+	if recipe == nil {
+		local, ok, err := m.localRecipe(appType)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			m.clog.Log("createFromRecipe: Using local recipe %s", appType)
+			recipe = local
+		}
+	}
+	if recipe == nil {
+		if m.deps.Hub == nil {
+			return nil, errors.New("Hub is not available")
+		}
+		hubRecipe, err := m.deps.Hub.GetApp(appType)
+		if err != nil {
+			return nil, err
+		}
+		recipe = hubRecipe
+	}
+	if recipe == nil {
+		return nil, errors.New(__("Recipe is empty."))
+	}
+	if name, _ := recipe["name"].(string); name == "" {
+		recipe["name"] = appType
+	}
+	return recipe, nil
+}
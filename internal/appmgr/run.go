@@ -102,6 +102,7 @@ func (m *Manager) runHeld(id any, logCtrl *applog.BuildControl) error {
 	if err != nil {
 		m.log.Error("Failed to start app %s: %s", name, err.Error())
 		m.set(id, map[string]any{"status": "errored", "updated": nowMs()})
+		m.alert("app.start_failed", name, __("App %s failed to start: %s", name, err.Error()), 1)
 		return err
 	}
 
@@ -135,6 +136,7 @@ func (m *Manager) runGitApp(id any, containerName string) error {
 		devices               []docker.Device
 		gpu                   *gpu.Spec
 		env                   map[string]any
+		secretFiles           map[string]string
 		privileged            string
 		networkMode           string
 		isolated              bool
@@ -173,7 +175,11 @@ func (m *Manager) runGitApp(id any, containerName string) error {
 
 		if s.dev {
 			// Mount the whole app directory to /app for live development.
+			// A monorepo app mounts only its own subdirectory.
 			appDir := filepath.Join(appsRoot, s.identity)
+			if repoPath, _ := app["path"].(string); repoPath != "" {
+				appDir = filepath.Join(appDir, filepath.FromSlash(repoPath))
+			}
 			s.volumes = append(s.volumes, docker.Mount{Host: appDir, Container: "/app"})
 		}
 
@@ -190,7 +196,7 @@ func (m *Manager) runGitApp(id any, containerName string) error {
 			m.saveAppsLocked()
 		}
 
-		s.env = m.resolveEnvLocked(app, true)
+		s.env, s.secretFiles = m.resolveEnvLocked(app, true)
 		if jsTruthy(app["api"]) {
 			s.hasAPI = true
 			s.apiPerms = app["api"]
@@ -211,6 +217,14 @@ func (m *Manager) runGitApp(id any, containerName string) error {
 		}
 	}
 
+	secretMount, err := m.writeSecretFiles(s.identity, s.name, s.secretFiles)
+	if err != nil {
+		return err
+	}
+	if secretMount != nil {
+		s.volumes = append(s.volumes, *secretMount)
+	}
+
 	env["PORT"] = strconv.Itoa(s.port)
 
 	runOptions := docker.RunOptions{
@@ -248,6 +262,9 @@ func (m *Manager) runGitApp(id any, containerName string) error {
 	if !started {
 		return nil
 	}
+	if containerName == "" {
+		m.pruneSecretFiles(s.identity, s.name)
+	}
 
 	if err := m.attachLogger(s.name); err != nil {
 		m.log.Error("Failed to attach logger to app %s: %s", s.name, err.Error())
@@ -278,6 +295,7 @@ func (m *Manager) runContainer(id any, containerName string, logCtrl *applog.Bui
 		gpu                   *gpu.Spec
 		published             []map[string]any
 		env                   map[string]any
+		secretFiles           map[string]string
 		privileged            string
 		networkMode           string
 		isolated              bool
@@ -307,7 +325,7 @@ func (m *Manager) runContainer(id any, containerName string, logCtrl *applog.Bui
 		s.volumes = toMounts(app["volumes"])
 		s.devices = toDevices(app["devices"])
 		s.gpu = toGPU(app["gpu"])
-		s.env = m.resolveEnvLocked(app, true)
+		s.env, s.secretFiles = m.resolveEnvLocked(app, true)
 		if jsTruthy(app["api"]) {
 			s.hasAPI = true
 			s.apiPerms = app["api"]
@@ -353,6 +371,14 @@ func (m *Manager) runContainer(id any, containerName string, logCtrl *applog.Bui
 		}
 	}
 
+	secretMount, err := m.writeSecretFiles(s.identity, s.name, s.secretFiles)
+	if err != nil {
+		return err
+	}
+	if secretMount != nil {
+		s.volumes = append(s.volumes, *secretMount)
+	}
+
 	m.fixVolumePermissions(s.name, s.volumes)
 
 	runOptions := docker.RunOptions{
@@ -384,6 +410,9 @@ func (m *Manager) runContainer(id any, containerName string, logCtrl *applog.Bui
 	if !started {
 		return nil
 	}
+	if containerName == "" {
+		m.pruneSecretFiles(s.identity, s.name)
+	}
 
 	if err := m.attachLogger(s.name); err != nil {
 		m.log.Error("Failed to attach logger to app %s: %s", s.name, err.Error())
@@ -0,0 +1,129 @@
+package appmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"odac/internal/docker"
+)
+
+// secretRefPrefix marks an env value as a reference into the secrets store:
+// secret://name injects the value, secret://name?file mounts it as
+// /run/secrets/name and injects that path instead.
+const secretRefPrefix = "secret://"
+
+// secretsMount is where file secrets appear inside the container.
+const secretsMount = "/run/secrets"
+
+func parseSecretRef(v any) (name string, file bool, ok bool) {
+	s, _ := v.(string)
+	if !strings.HasPrefix(s, secretRefPrefix) {
+		return "", false, false
+	}
+	name, query, _ := strings.Cut(strings.TrimPrefix(s, secretRefPrefix), "?")
+	if name == "" || strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return "", false, false
+	}
+	return name, query == "file", true
+}
+
+// revealSecretsLocked replaces secret:// references in env with their
+// values and returns the file secrets (name -> value) the container needs
+// mounted. A reference that cannot be resolved drops the variable: the app
+// starts without it rather than with the reference string as its value.
+func (m *Manager) revealSecretsLocked(appName string, env map[string]any) map[string]string {
+	files := map[string]string{}
+	for key, v := range env {
+		name, file, ok := parseSecretRef(v)
+		if !ok {
+			continue
+		}
+		if m.deps.Secrets == nil {
+			m.log.Error("App %s: %s references secret %s but the secrets store is unavailable", appName, key, name)
+			delete(env, key)
+			continue
+		}
+		value, err := m.deps.Secrets.Reveal(name)
+		if err != nil {
+			m.log.Error("App %s: %s references secret %s: %s", appName, key, name, err.Error())
+			delete(env, key)
+			continue
+		}
+		if file {
+			files[name] = value
+			env[key] = secretsMount + "/" + name
+		} else {
+			env[key] = value
+		}
+	}
+	return files
+}
+
+// secretsPath holds the file secrets of one app, in one directory per
+// container. The parent is 0700 so only root on the host can read them.
+func (m *Manager) secretsPath(identity string) string {
+	return filepath.Join(m.cfg.BaseDir(), "run", "secrets", identity)
+}
+
+// writeSecretFiles writes the file secrets of the container about to start
+// and returns the mount for them, or nil when the app has none. Each
+// container gets its own directory, so a Blue-Green deploy never rewrites
+// the files the old container still has mounted.
+func (m *Manager) writeSecretFiles(identity, container string, files map[string]string) (*docker.Mount, error) {
+	if identity == "" || container == "" {
+		if len(files) == 0 {
+			return nil, nil
+		}
+		return nil, errors.New("app has no identity")
+	}
+	dir := filepath.Join(m.secretsPath(identity), container)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(filepath.Dir(dir)), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return nil, err
+	}
+	for name, value := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o444); err != nil {
+			return nil, err
+		}
+	}
+	return &docker.Mount{Host: dir, Container: secretsMount + ":ro"}, nil
+}
+
+// pruneSecretFiles removes the secret files of every container of the app
+// but keep. Call it only once keep is the app's one live container.
+func (m *Manager) pruneSecretFiles(identity, keep string) {
+	if identity == "" {
+		return
+	}
+	dir := m.secretsPath(identity)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	kept := false
+	for _, ent := range entries {
+		if ent.Name() == keep && ent.IsDir() {
+			kept = true
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, ent.Name())); err != nil {
+			m.log.Error("Failed to remove stale secret files for %s: %s", identity, err.Error())
+		}
+	}
+	if !kept {
+		os.Remove(dir)
+	}
+}
@@ -0,0 +1,146 @@
+package appmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"odac/internal/docker"
+)
+
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) Reveal(name string) (string, error) {
+	if v, ok := f[name]; ok {
+		return v, nil
+	}
+	return "", errors.New("secret not found")
+}
+
+func TestSecretRefsResolveAtStart(t *testing.T) {
+	fx := newFixture(t, []any{
+		map[string]any{
+			"id": float64(1), "name": "web", "type": "container", "image": "app", "active": true,
+			"env": map[string]any{
+				"manual": map[string]any{
+					"API_KEY":  "secret://api-key",
+					"TLS_KEY":  "secret://tls.key?file",
+					"MISSING":  "secret://nope",
+					"LOG_MODE": "plain",
+				},
+				"linked": []any{"db"},
+			},
+		},
+		map[string]any{
+			"id": float64(2), "name": "db", "type": "container",
+			"env": map[string]any{"manual": map[string]any{"DB_PASSWORD": "secret://db-password"}},
+		},
+	})
+	fx.m.deps.Secrets = fakeSecrets{"api-key": "k-123", "tls.key": "PEM", "db-password": "pw"}
+
+	fx.checkAndSettle(t)
+
+	opts := fx.dock.runCallAt(0).options
+	if opts.Env["API_KEY"] != "k-123" || opts.Env["DB_PASSWORD"] != "pw" || opts.Env["LOG_MODE"] != "plain" {
+		t.Fatalf("env = %v", opts.Env)
+	}
+	if opts.Env["TLS_KEY"] != "/run/secrets/tls.key" {
+		t.Fatalf("file secret env = %q", opts.Env["TLS_KEY"])
+	}
+	if _, ok := opts.Env["MISSING"]; ok {
+		t.Fatal("unresolved reference reached the container")
+	}
+
+	dir := filepath.Join(fx.m.secretsPath("web"), "web")
+	want := docker.Mount{Host: dir, Container: "/run/secrets:ro"}
+	mounted := false
+	for _, v := range opts.Volumes {
+		mounted = mounted || v == want
+	}
+	if !mounted {
+		t.Fatalf("volumes = %v", opts.Volumes)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "tls.key")); err != nil || string(data) != "PEM" {
+		t.Fatalf("secret file = %q, %v", data, err)
+	}
+
+	// The dashboard only ever sees the references.
+	r := fx.m.GetEnv("web")
+	data, _ := r.Data.(map[string]any)
+	manual, _ := data["manual"].(map[string]any)
+	if manual["API_KEY"] != "secret://api-key" {
+		t.Fatalf("getEnv manual = %v", manual)
+	}
+	for _, v := range []string{"k-123", "PEM", "pw"} {
+		if strings.Contains(jsString(data), v) {
+			t.Fatalf("getEnv revealed %q: %v", v, data)
+		}
+	}
+
+	if r := fx.m.Delete("web", false); !r.Status {
+		t.Fatalf("delete: %v", r.Message)
+	}
+	if _, err := os.Stat(fx.m.secretsPath("web")); !os.IsNotExist(err) {
+		t.Fatal("secret files outlived the app")
+	}
+}
+
+func TestSecretFilesPerContainer(t *testing.T) {
+	fx := newFixture(t, nil)
+	blue := filepath.Join(fx.m.secretsPath("web"), "web")
+	green := filepath.Join(fx.m.secretsPath("web"), "web-green-1")
+
+	if _, err := fx.m.writeSecretFiles("web", "web", map[string]string{"tls.key": "old"}); err != nil {
+		t.Fatal(err)
+	}
+	mount, err := fx.m.writeSecretFiles("web", "web-green-1", map[string]string{"tls.key": "new"})
+	if err != nil || mount == nil || mount.Host != green {
+		t.Fatalf("green mount = %v, %v", mount, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(blue, "tls.key")); string(data) != "old" {
+		t.Fatalf("green start rewrote the live container's secret: %q", data)
+	}
+
+	fx.m.pruneSecretFiles("web", "web-green-1")
+	if _, err := os.Stat(blue); !os.IsNotExist(err) {
+		t.Fatal("old container's secrets survived the prune")
+	}
+	if data, _ := os.ReadFile(filepath.Join(green, "tls.key")); string(data) != "new" {
+		t.Fatalf("green secret = %q", data)
+	}
+
+	fx.m.pruneSecretFiles("web", "web")
+	if _, err := os.Stat(fx.m.secretsPath("web")); !os.IsNotExist(err) {
+		t.Fatal("empty secrets dir left behind")
+	}
+}
+
+func TestSecretFilesFollowAppIdentity(t *testing.T) {
+	fx := newFixture(t, []any{
+		map[string]any{"id": float64(1), "name": "web", "type": "container", "image": "app"},
+	})
+	fx.m.cfg.Mutate(func() { fx.m.getLocked("web")["_appIdentity"] = "web-old" })
+	if _, err := fx.m.writeSecretFiles("web-old", "web", map[string]string{"k": "v"}); err != nil {
+		t.Fatal(err)
+	}
+	if r := fx.m.Delete("web", false); !r.Status {
+		t.Fatalf("delete: %v", r.Message)
+	}
+	if _, err := os.Stat(fx.m.secretsPath("web-old")); !os.IsNotExist(err) {
+		t.Fatal("secret files under the app identity outlived the app")
+	}
+}
+
+func TestScriptAppRejectsSecretRefs(t *testing.T) {
+	fx := newFixture(t, []any{
+		map[string]any{"id": float64(1), "name": "job", "type": "script", "file": "/srv/job.js"},
+	})
+	if r := fx.m.SetEnv("job", map[string]any{"TOKEN": "secret://api-token"}); r.Status {
+		t.Fatal("script app accepted a secret reference")
+	}
+	if r := fx.m.SetEnv("job", map[string]any{"MODE": "plain"}); !r.Status {
+		t.Fatalf("plain env: %v", r.Message)
+	}
+}
@@ -0,0 +1,309 @@
+// Package audit keeps an append-only record of the commands the local API
+// and the Hub channel carried out: when, which action, who asked, with what
+// arguments and how it ended.
+//
+// Entries are JSON lines in <base>/logs/audit/audit.log. Each carries the
+// SHA-256 of the entry before it, and its own hash covers that link, so
+// editing or deleting a line breaks the chain from there on. Files rotate at
+// maxFileSize; the chain runs on across rotations, and the oldest file kept
+// starts a verifiable run of its own.
+//
+// Successful calls to read-only actions are left out, so a CLI following
+// logs does not drown the record. Refused calls are always kept.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"odac/internal/api"
+	"odac/internal/config"
+	"odac/internal/lang"
+	"odac/internal/logx"
+)
+
+var __ = lang.T
+
+const (
+	fileName    = "audit.log"
+	maxFileSize = 10 << 20
+	filesToKeep = 5 // rotated files besides the live one
+	maxLine     = 1 << 20
+)
+
+// readOnly actions are only recorded when they fail.
+var readOnly = map[string]bool{
+	"app.list": true, "app.logs": true, "app.stats": true, "app.build_stats": true, "app.preview.list": true,
+	"domain.list": true, "domain.auth.list": true, "dns.list": true, "mail.list": true, "tunnel.list": true, "stream.list": true,
+	"firewall.list": true, "secret.list": true, "log.sink.list": true, "alert.channel.list": true,
+	"alert.rule.list": true, "alert.history": true, "audit.list": true, "token.list": true, "system.info": true, "system.stats": true,
+}
+
+// Entry is one audit record.
+type Entry struct {
+	Seq     int64           `json:"seq"`
+	Time    time.Time       `json:"time"`
+	Source  string          `json:"source"` // "api" or "hub"
+	Action  string          `json:"action"`
+	Caller  api.Caller      `json:"caller"`
+	Args    json.RawMessage `json:"args,omitempty"`
+	Status  bool            `json:"status"`
+	Message string          `json:"message,omitempty"`
+	Prev    string          `json:"prev"`
+	Hash    string          `json:"hash,omitempty"`
+}
+
+// digest is the entry's hash: SHA-256 over its JSON with Hash empty.
+func (e Entry) digest() string {
+	e.Hash = ""
+	raw, _ := json.Marshal(e)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log is the audit log writer.
+type Log struct {
+	dir     string
+	log     *logx.Logger
+	now     func() time.Time
+	maxSize int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	seq  int64
+	last string
+}
+
+// New opens the audit log under cfg's base directory and picks the chain up
+// where the previous run left it.
+func New(cfg *config.Store) *Log {
+	l := &Log{
+		dir:     filepath.Join(cfg.BaseDir(), "logs", "audit"),
+		log:     logx.New("Audit"),
+		now:     time.Now,
+		maxSize: maxFileSize,
+	}
+	for _, path := range l.files() {
+		if e, ok := lastEntry(path); ok {
+			l.seq, l.last = e.Seq, e.Hash
+		}
+	}
+	return l
+}
+
+// files lists the log files oldest first.
+func (l *Log) files() []string {
+	var out []string
+	for i := filesToKeep; i >= 1; i-- {
+		out = append(out, filepath.Join(l.dir, fmt.Sprintf("%s.%d", fileName, i)))
+	}
+	return append(out, filepath.Join(l.dir, fileName))
+}
+
+func lastEntry(path string) (Entry, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Entry{}, false
+	}
+	defer f.Close()
+	var last Entry
+	found := false
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), maxLine)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && e.Hash != "" {
+			last, found = e, true
+		}
+	}
+	return last, found
+}
+
+// Record appends one command. It writes synchronously: an entry the caller
+// has been told about must not sit in a buffer when the server dies.
+func (l *Log) Record(source, action string, caller api.Caller, args []any, r *api.Result) {
+	status, message := true, ""
+	if r != nil {
+		status = r.Status
+		message, _ = r.Message.(string)
+	}
+	if status && readOnly[action] {
+		return
+	}
+	e := Entry{Source: source, Action: action, Caller: caller, Status: status, Message: truncate(message, maxString)}
+	if len(args) > 0 {
+		e.Args, _ = json.Marshal(sanitizeArgs(action, args))
+		if len(e.Args) > maxArgs {
+			e.Args, _ = json.Marshal(__("(%s bytes, not recorded)", len(e.Args)))
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq, e.Time, e.Prev = l.seq, l.now().UTC(), l.last
+	e.Hash = e.digest()
+	line, err := json.Marshal(e)
+	if err != nil {
+		l.log.Error("Audit entry for %s could not be encoded: %s", action, err.Error())
+		return
+	}
+	line = append(line, '\n')
+	if err := l.write(line); err != nil {
+		l.log.Error("Audit entry for %s could not be written: %s", action, err.Error())
+		return
+	}
+	l.last = e.Hash
+}
+
+func (l *Log) write(line []byte) error {
+	if l.f != nil && l.size+int64(len(line)) > l.maxSize {
+		l.rotate()
+	}
+	if l.f == nil {
+		if err := os.MkdirAll(l.dir, 0o700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(l.dir, fileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		l.f, l.size = f, info.Size()
+	}
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts audit.log to audit.log.1 and so on, dropping the oldest.
+func (l *Log) rotate() {
+	l.f.Close()
+	l.f = nil
+	files := l.files()
+	os.Remove(files[0])
+	for i := 1; i < len(files); i++ {
+		os.Rename(files[i], files[i-1])
+	}
+}
+
+// Close closes the live file.
+func (l *Log) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+}
+
+// Row is one entry as audit.list shows it.
+type Row struct {
+	Seq    int64  `json:"seq"`
+	Time   string `json:"time"`
+	Caller string `json:"caller"`
+	Action string `json:"action"`
+	Args   string `json:"args"`
+	Result string `json:"result"`
+}
+
+// List returns entries, oldest first. query may hold since (2h, 7d or an
+// RFC 3339 time), action (a glob such as "app.*") and limit (the newest
+// entries to keep, 100 by default). The whole chain is checked on the way;
+// a break is reported in the message.
+func (l *Log) List(queryArg any) api.Result {
+	query, _ := queryArg.(map[string]any)
+	q, err := parseQuery(query, l.now())
+	if err != nil {
+		return api.Res(false, err.Error())
+	}
+
+	l.mu.Lock()
+	if l.f != nil {
+		l.f.Sync()
+	}
+	files := l.files()
+	l.mu.Unlock()
+
+	var rows []Row
+	var prev string
+	var broken int64
+	first := true
+	for _, path := range files {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for line := range bytes.Lines(raw) {
+			var e Entry
+			if json.Unmarshal(line, &e) != nil {
+				if broken == 0 {
+					broken = -1
+				}
+				continue
+			}
+			if broken == 0 && (e.digest() != e.Hash || (!first && e.Prev != prev)) {
+				broken = e.Seq
+			}
+			first, prev = false, e.Hash
+			if q.matches(e) {
+				rows = append(rows, row(e))
+			}
+		}
+	}
+	if len(rows) > q.limit {
+		rows = rows[len(rows)-q.limit:]
+	}
+	out := make([]any, len(rows))
+	for i, r := range rows {
+		out[i] = r
+	}
+	switch {
+	case broken > 0:
+		return api.Res(true, __("Warning: the audit chain is broken at entry %s. Entries from there on may have been altered.", broken), out)
+	case broken < 0:
+		return api.Res(true, __("Warning: the audit log holds a line that is not a valid entry."), out)
+	}
+	return api.Res(true, out)
+}
+
+func row(e Entry) Row {
+	caller := e.Caller.Kind
+	if e.Caller.Name != "" {
+		caller += ":" + e.Caller.Name
+	}
+	if e.Caller.User != "" {
+		caller += " (" + e.Caller.User + ")"
+	}
+	if e.Source == "hub" && e.Caller.Kind != "hub" {
+		caller = "hub " + caller
+	}
+	result := "ok"
+	if !e.Status {
+		result = "failed"
+	}
+	if e.Message != "" {
+		result += ": " + e.Message
+	}
+	return Row{
+		Seq:    e.Seq,
+		Time:   e.Time.Local().Format("2006-01-02 15:04:05"),
+		Caller: caller,
+		Action: e.Action,
+		Args:   string(e.Args),
+		Result: result,
+	}
+}
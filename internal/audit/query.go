@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultLimit = 100
+
+type query struct {
+	since  time.Time
+	action string
+	limit  int
+}
+
+func parseQuery(m map[string]any, now time.Time) (query, error) {
+	q := query{limit: defaultLimit}
+	if s, _ := m["since"].(string); s != "" {
+		at, ok := parseSince(s, now)
+		if !ok {
+			return q, errors.New(__("Invalid time %s. Use a duration such as 2h or 7d, or an RFC 3339 time.", s))
+		}
+		q.since = at
+	}
+	if a, _ := m["action"].(string); a != "" {
+		if _, err := path.Match(a, ""); err != nil {
+			return q, errors.New(__("Invalid action pattern %s.", a))
+		}
+		q.action = a
+	}
+	switch n := m["limit"].(type) {
+	case nil:
+	case float64:
+		if n < 1 {
+			return q, errors.New(__("Invalid limit: %s", fmt.Sprint(n)))
+		}
+		q.limit = int(n)
+	default:
+		return q, errors.New(__("Invalid limit: %s", fmt.Sprint(n)))
+	}
+	return q, nil
+}
+
+func parseSince(s string, now time.Time) (time.Time, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), true
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), true
+	}
+	if at, err := time.Parse(time.RFC3339, s); err == nil {
+		return at, true
+	}
+	if at, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return at, true
+	}
+	return time.Time{}, false
+}
+
+func (q query) matches(e Entry) bool {
+	if !q.since.IsZero() && e.Time.Before(q.since) {
+		return false
+	}
+	if q.action == "" {
+		return true
+	}
+	ok, _ := path.Match(q.action, e.Action)
+	return ok
+}
@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"unicode/utf8"
+
+	"odac/internal/logx"
+)
+
+const (
+	maxString = 256
+	maxArgs   = 8 << 10
+)
+
+// positional lists the arguments that carry a credential as a bare string,
+// where logx.Sanitize has no key to go by.
+var positional = map[string][]int{
+	"auth":             {0},
+	"secret.set":       {1},
+	"tunnel.add":       {3},
+	"domain.auth.user": {2},
+	"mail.create":      {1, 2},
+	"mail.password":    {1, 2},
+}
+
+// bodyKeys hold message content (mail.send) rather than anything about
+// who did what.
+var bodyKeys = map[string]bool{"text": true, "html": true, "attachments": true, "raw": true}
+
+// sanitizeArgs masks credentials and message bodies and shortens long
+// strings. Environment maps are dropped whole by logx.Sanitize.
+func sanitizeArgs(action string, args []any) any {
+	out := logx.Sanitize(append([]any(nil), args...)).([]any)
+	for _, i := range positional[action] {
+		if i < len(out) && out[i] != nil {
+			out[i] = "***"
+		}
+	}
+	for i, v := range out {
+		out[i] = shorten(v)
+	}
+	return out
+}
+
+func shorten(v any) any {
+	switch t := v.(type) {
+	case string:
+		return truncate(t, maxString)
+	case map[string]any:
+		for k, val := range t {
+			if bodyKeys[k] {
+				t[k] = "***"
+			} else {
+				t[k] = shorten(val)
+			}
+		}
+	case []any:
+		for i, val := range t {
+			t[i] = shorten(val)
+		}
+	}
+	return v
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
@@ -22,14 +22,18 @@ import (
 // moduleKeys maps each module file (name without .json) to the top-level
 // config keys it owns. Mirrors #moduleMap in core/Config.js.
 var moduleKeys = map[string][]string{
+	"acme":     {"acme"},
+	"alert":    {"alerts"},
 	"api":      {"api"},
 	"app":      {"apps", "app"},
 	"dns":      {"dns"},
 	"domain":   {"domains"},
 	"firewall": {"firewall"},
 	"hub":      {"hub"},
+	"log":      {"logShipping"},
 	"mail":     {"mail"},
-	"proxy":    {"tunnels"},
+	"proxy":    {"tunnels", "relayTunnels", "streams", "proxyCache"},
+	"secret":   {"secrets"},
 	"server":   {"server"},
 	"service":  {"services"},
 	"ssl":      {"ssl"},
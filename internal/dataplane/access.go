@@ -0,0 +1,62 @@
+package dataplane
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// accessEntry renders a domain's auth block for the proxy, nil when it has no
+// rules. A forward-auth rule names an ODAC app; it is resolved here to the
+// address the proxy can reach, and left without a URL (so the proxy refuses
+// the request) while that app is down. Caller holds cfg.Mutate.
+func (p *Proxy) accessEntry(apps []any, domain string, record map[string]any) map[string]any {
+	auth, _ := record["auth"].(map[string]any)
+	rules, _ := auth["rules"].([]any)
+	if len(rules) == 0 {
+		return nil
+	}
+	out := map[string]any{"rules": make([]any, 0, len(rules))}
+	if realm, _ := auth["realm"].(string); realm != "" {
+		out["realm"] = realm
+	}
+	if users, _ := auth["users"].(map[string]any); len(users) > 0 {
+		out["users"] = users
+	}
+	for _, r := range rules {
+		rule, _ := r.(map[string]any)
+		if rule == nil {
+			continue
+		}
+		compiled := make(map[string]any, len(rule))
+		for k, v := range rule {
+			compiled[k] = v
+		}
+		if fwd, _ := rule["forward"].(map[string]any); fwd != nil {
+			compiled["forward"] = map[string]any{
+				"url":     p.forwardAuthURL(apps, domain, fwd),
+				"headers": orList(fwd["headers"]),
+			}
+		}
+		out["rules"] = append(out["rules"].([]any), compiled)
+	}
+	return out
+}
+
+func (p *Proxy) forwardAuthURL(apps []any, domain string, fwd map[string]any) string {
+	app := findApp(apps, fwd["app"])
+	if app == nil {
+		p.log.Error("Forward-auth app %s for %s not found", fwd["app"], domain)
+		return ""
+	}
+	backend := p.resolveBackend(app)
+	if backend == nil {
+		p.log.Error("Forward-auth app %s for %s has no port", fwd["app"], domain)
+		return ""
+	}
+	uri, _ := fwd["uri"].(string)
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
+	}
+	return "http://" + net.JoinHostPort(backend.host, strconv.Itoa(backend.port)) + uri
+}
@@ -0,0 +1,157 @@
+package dataplane
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"odac/internal/api"
+)
+
+// Purge drops a domain's cached assets and pages: all of them, or with opts
+// {tags, url, prefix} only those tagged by the app (X-Odac-Cache-Tags), the
+// one at url, or those below prefix.
+func (p *Proxy) Purge(domainArg, optsArg any) api.Result {
+	domain := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(str(domainArg))), "www.")
+	if domain == "" {
+		return api.Res(false, __("Domain is required."))
+	}
+	var found bool
+	p.cfg.View(func() {
+		domains, _ := p.cfg.Get("domains").(map[string]any)
+		_, found = domains[domain]
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+
+	opts, _ := optsArg.(map[string]any)
+	payload := map[string]any{"domain": domain}
+	var tags []string
+	switch v := opts["tags"].(type) {
+	case []any:
+		for _, t := range v {
+			if s := strings.TrimSpace(str(t)); s != "" {
+				tags = append(tags, s)
+			}
+		}
+	case string:
+		for _, t := range strings.Split(v, ",") {
+			if s := strings.TrimSpace(t); s != "" {
+				tags = append(tags, s)
+			}
+		}
+	}
+	if len(tags) > 0 {
+		payload["tags"] = tags
+	}
+	if raw := str(opts["url"]); raw != "" {
+		path := raw
+		if u, err := url.Parse(raw); err == nil && u.Host != "" {
+			if host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."); host != domain {
+				return api.Res(false, __("%s is not a URL of %s.", raw, domain))
+			}
+			path = u.EscapedPath()
+		}
+		if !strings.HasPrefix(path, "/") {
+			return api.Res(false, __("The URL must be a path starting with / or a full URL."))
+		}
+		payload["url"] = path
+	}
+	if prefix := str(opts["prefix"]); prefix != "" {
+		if !strings.HasPrefix(prefix, "/") {
+			return api.Res(false, __("The prefix must start with /."))
+		}
+		payload["prefix"] = prefix
+	}
+
+	sock := p.proc.SocketPath()
+	if _, err := os.Stat(sock); err != nil {
+		return api.Res(false, __("The proxy is not running."))
+	}
+	if len(payload) == 1 {
+		return api.Res(true, __("Purged %s cached entries for %s.", strconv.Itoa(p.PurgeCache(domain)), domain))
+	}
+	envelope, err := requestJSON(sock, "POST", "/cache/purge", payload)
+	if err != nil {
+		p.log.Error("Failed to purge cache: %s", err.Error())
+		return api.Res(false, __("Failed to purge the cache: %s", err.Error()))
+	}
+	purged, _ := envelope["purged"].(float64)
+	p.log.Log("Cache purged: %s matching entries for %s", strconv.Itoa(int(purged)), domain)
+	return api.Res(true, __("Purged %s cached entries for %s.", strconv.Itoa(int(purged)), domain))
+}
+
+// diskCacheMinMB keeps the tier big enough that its per-entry cap (an eighth
+// of the tier) still holds typical bundles and media.
+const diskCacheMinMB = 64
+
+// DiskCache shows or sets the size in MB of the proxy's on-disk cache tier
+// (opts {size}); 0 turns it off and deletes its files.
+func (p *Proxy) DiskCache(optsArg any) api.Result {
+	opts, _ := optsArg.(map[string]any)
+	raw, set := opts["size"]
+	if !set {
+		return p.diskCacheStatus()
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.ToUpper(str(raw)), "MB")))
+	if err != nil || size < 0 {
+		return api.Res(false, __("The size must be a number of MB, or 0 to turn the disk cache off."))
+	}
+	if size > 0 && size < diskCacheMinMB {
+		return api.Res(false, __("The disk cache needs at least %s MB.", strconv.Itoa(diskCacheMinMB)))
+	}
+	p.cfg.Mutate(func() {
+		settings := p.cfg.Map("proxyCache")
+		if size == 0 {
+			delete(settings, "diskSize")
+		} else {
+			settings["diskSize"] = size
+		}
+		p.cfg.Set("proxyCache", settings)
+	})
+	p.SyncConfig()
+	if size == 0 {
+		p.log.Log("Proxy disk cache turned off")
+		return api.Res(true, __("Disk cache turned off."))
+	}
+	p.log.Log("Proxy disk cache set to %s MB", strconv.Itoa(size))
+	return api.Res(true, __("Disk cache set to %s MB.", strconv.Itoa(size)))
+}
+
+// diskCacheStatus reports the configured size and, while the proxy runs,
+// what the tier holds.
+func (p *Proxy) diskCacheStatus() api.Result {
+	var size int
+	p.cfg.View(func() {
+		size = jsParseInt(p.cfg.Map("proxyCache")["diskSize"])
+	})
+	if size <= 0 {
+		return api.Res(true, __("Disk cache is off."))
+	}
+	msg := __("Disk cache: %s MB", strconv.Itoa(size))
+	sock := p.proc.SocketPath()
+	if _, err := os.Stat(sock); err == nil {
+		if stats, err := requestJSON(sock, "GET", "/cache/stats", nil); err == nil {
+			if disk, _ := stats["disk"].(map[string]any); disk != nil {
+				msg += __(", %s entries, %s MB used", strconv.Itoa(jsParseInt(disk["entries"])), strconv.Itoa(jsParseInt(disk["totalSizeMB"])))
+			}
+		}
+	}
+	return api.Res(true, msg+".")
+}
+
+// diskCacheEntry renders the payload's diskCache block, nil while the tier
+// is off. Caller holds cfg.Mutate.
+func (p *Proxy) diskCacheEntry() map[string]any {
+	size := jsParseInt(p.cfg.Map("proxyCache")["diskSize"])
+	if size <= 0 {
+		return nil
+	}
+	return map[string]any{
+		"dir":     filepath.Join(p.cfg.BaseDir(), "cache", "proxy"),
+		"maxSize": int64(size) << 20,
+	}
+}
@@ -0,0 +1,123 @@
+package dataplane
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestProxyPurge(t *testing.T) {
+	dir, err := os.MkdirTemp("", "odacpurge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "proxy.sock")
+
+	var mu sync.Mutex
+	var bodies []map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache/purge", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+		w.Write([]byte(`{"success":true,"purged":3}`))
+	})
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	cfg := newStore(t)
+	cfg.Set("domains", map[string]any{"example.com": map[string]any{"appId": "blog"}})
+	p := NewProxy(cfg, t.TempDir(), nil)
+	p.proc = &fakeProc{running: true, socket: sock}
+
+	for _, bad := range []struct {
+		domain any
+		opts   map[string]any
+	}{
+		{"", nil},
+		{"missing.com", nil},
+		{"example.com", map[string]any{"url": "https://other.com/a"}},
+		{"example.com", map[string]any{"url": "articles/42"}},
+		{"example.com", map[string]any{"prefix": "articles"}},
+	} {
+		if r := p.Purge(bad.domain, bad.opts); r.Status {
+			t.Errorf("%v %v accepted", bad.domain, bad.opts)
+		}
+	}
+	mu.Lock()
+	if len(bodies) != 0 {
+		t.Fatalf("invalid requests reached the proxy: %v", bodies)
+	}
+	mu.Unlock()
+
+	r := p.Purge("www.example.com", map[string]any{
+		"tags":   []any{"article-42", " ", "author-7"},
+		"url":    "https://www.example.com/articles/42",
+		"prefix": "/feed/",
+	})
+	if !r.Status {
+		t.Fatalf("purge failed: %v", r.Message)
+	}
+	if r := p.Purge("example.com", map[string]any{"tags": "home, nav"}); !r.Status {
+		t.Fatalf("purge failed: %v", r.Message)
+	}
+	if r := p.Purge("example.com", nil); !r.Status {
+		t.Fatalf("purge failed: %v", r.Message)
+	}
+
+	want := []map[string]any{
+		{"domain": "example.com", "tags": []any{"article-42", "author-7"}, "url": "/articles/42", "prefix": "/feed/"},
+		{"domain": "example.com", "tags": []any{"home", "nav"}},
+		{"domain": "example.com"},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(bodies, want) {
+		t.Fatalf("bodies = %v", bodies)
+	}
+}
+
+func TestProxyDiskCache(t *testing.T) {
+	cs := newControlServer(t)
+	p, _ := newTestProxy(t, cs, nil)
+
+	for _, bad := range []any{"-1", "lots", 10} {
+		if r := p.DiskCache(map[string]any{"size": bad}); r.Status {
+			t.Errorf("size %v accepted", bad)
+		}
+	}
+	if r := p.DiskCache(nil); !r.Status || r.Message != "Disk cache is off." {
+		t.Errorf("status = %v", r.Message)
+	}
+
+	if r := p.DiskCache(map[string]any{"size": "2048"}); !r.Status {
+		t.Fatalf("set failed: %v", r.Message)
+	}
+	want := map[string]any{
+		"dir":     filepath.Join(p.cfg.BaseDir(), "cache", "proxy"),
+		"maxSize": float64(2048 << 20),
+	}
+	if got := cs.nextConfig(t)["diskCache"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("diskCache = %v, want %v", got, want)
+	}
+
+	if r := p.DiskCache(map[string]any{"size": 0}); !r.Status {
+		t.Fatalf("off failed: %v", r.Message)
+	}
+	if got, ok := cs.nextConfig(t)["diskCache"]; ok {
+		t.Errorf("diskCache = %v after turning it off", got)
+	}
+}
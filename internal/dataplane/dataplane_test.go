@@ -98,6 +98,12 @@ func newControlServer(t *testing.T) *controlServer {
 	mux.HandleFunc("/ready", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(int(cs.ready.Load()))
 	})
+	mux.HandleFunc("/ondemand", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`{"pending":[{"domain":"Shop.Customer.test","app":"ctrapp"}]}`))
+	})
+	mux.HandleFunc("/streams", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`{"streams":[{"name":"pg","active":2,"total":9,"refused":1,"bytesIn":512,"bytesOut":2048}]}`))
+	})
 
 	l, err := net.Listen("unix", cs.sock)
 	if err != nil {
@@ -0,0 +1,384 @@
+package dataplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odac/internal/api"
+	"odac/internal/config"
+	"odac/internal/firewall"
+	"odac/internal/logx"
+)
+
+// Firewall owns the persisted policy in the firewall config module and keeps
+// the three daemons' guards in step with it. Each daemon raises auto-bans
+// locally (mail auth failures, HTTP 4xx floods, DNS floods); the poll drains
+// them over GET /firewall/bans, merges them into firewall.bans and pushes
+// the merged policy back to every daemon, so a ban raised by one is
+// enforced by all and survives restarts.
+type Firewall struct {
+	cfg   *config.Store
+	log   *logx.Logger
+	procs []process
+
+	pollEvery time.Duration
+	last      time.Time // touched only by Check (1s tick goroutine)
+	busy      atomic.Bool
+	round     sync.Mutex // serializes drain/merge/push rounds with Ban and Unban pushes
+	now       func() time.Time
+}
+
+// NewFirewall wires the manager. Any service may be nil (not started on
+// this host); its daemon is then simply skipped.
+func NewFirewall(cfg *config.Store, proxy *Proxy, mail *Mail, dns *DNS) *Firewall {
+	f := &Firewall{
+		cfg:       cfg,
+		log:       logx.New("Firewall"),
+		pollEvery: 10 * time.Second,
+		now:       time.Now,
+	}
+	if proxy != nil {
+		f.procs = append(f.procs, proxy.proc)
+	}
+	if mail != nil {
+		f.procs = append(f.procs, mail.proc)
+	}
+	if dns != nil {
+		f.procs = append(f.procs, dns.proc)
+	}
+	return f
+}
+
+// Check runs on the 1s tick. The drain/merge/push round trips run off the
+// tick goroutine every pollEvery; a slow daemon never stacks rounds.
+func (f *Firewall) Check() {
+	now := f.now()
+	if now.Sub(f.last) < f.pollEvery {
+		return
+	}
+	f.last = now
+	if !f.busy.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer f.busy.Store(false)
+		f.round.Lock()
+		defer f.round.Unlock()
+		f.collect()
+		f.push()
+	}()
+}
+
+// liftedKeep is how long an unban is remembered, so a daemon that raised the
+// ban before it was lifted cannot restore it by offering it again.
+const liftedKeep = 24 * time.Hour
+
+// collect drains the daemons' locally raised bans into firewall.bans and
+// drops expired entries.
+func (f *Firewall) collect() {
+	var raised []firewall.Ban
+	for _, proc := range f.procs {
+		if !proc.Running() {
+			continue
+		}
+		bans, err := drainBans(proc.SocketPath())
+		if err != nil {
+			continue // daemon restarting; its queue is retried next round
+		}
+		raised = append(raised, bans...)
+	}
+
+	nowMs := f.now().UnixMilli()
+	f.cfg.Mutate(func() {
+		fw := f.cfg.Map("firewall")
+		if fw == nil {
+			fw = map[string]any{"enabled": true}
+			f.cfg.Set("firewall", fw)
+		}
+		list, _ := fw["bans"].([]any)
+		kept := make([]any, 0, len(list)+len(raised))
+		seen := map[string]bool{}
+		changed := false
+		lifted, _ := fw["lifted"].(map[string]any)
+		for ip, at := range lifted {
+			if millis(at) <= nowMs-liftedKeep.Milliseconds() {
+				delete(lifted, ip)
+				changed = true
+			}
+		}
+		for _, item := range list {
+			ban, _ := item.(map[string]any)
+			if ban == nil || banExpired(ban, nowMs) {
+				changed = true
+				continue
+			}
+			seen[str(ban["ip"])] = true
+			kept = append(kept, ban)
+		}
+		for _, b := range raised {
+			if seen[b.IP] || b.Expired(time.UnixMilli(nowMs)) {
+				continue
+			}
+			if at, ok := lifted[b.IP]; ok && millis(at) >= b.Created {
+				continue // offered again after an operator lifted it
+			}
+			seen[b.IP] = true
+			kept = append(kept, banEntry(b))
+			changed = true
+		}
+		if changed {
+			fw["bans"] = kept
+			f.cfg.Touch("firewall")
+		}
+	})
+}
+
+// Sync pushes the policy to every running daemon (POST /firewall). The
+// proxy also receives it inside its /config payload; the direct push keeps
+// a ban's propagation independent of routing syncs.
+func (f *Firewall) Sync() {
+	f.round.Lock()
+	defer f.round.Unlock()
+	f.push()
+}
+
+func (f *Firewall) push() {
+	var body []byte
+	var err error
+	f.cfg.View(func() {
+		body, err = json.Marshal(firewallPolicy(f.cfg))
+	})
+	if err != nil {
+		f.log.Error("Failed to marshal firewall policy: %s", err.Error())
+		return
+	}
+	for _, proc := range f.procs {
+		if !proc.Running() {
+			continue
+		}
+		sock := proc.SocketPath()
+		if _, serr := os.Stat(sock); serr != nil {
+			continue
+		}
+		if perr := postRaw(sock, "/firewall", body); perr != nil && !retryable(perr) {
+			f.log.Error("Failed to push firewall policy: %s", perr.Error())
+		}
+	}
+}
+
+// Ban adds (or replaces) a manual ban. duration is "" for permanent or a
+// Go duration with an optional day suffix ("30m", "12h", "7d").
+func (f *Firewall) Ban(target, duration, reason any) api.Result {
+	ip, ok := firewall.ValidTarget(str(target))
+	if !ok {
+		return api.Res(false, __("Invalid IP address or CIDR range: %s", str(target)))
+	}
+	var until int64
+	if d := strings.TrimSpace(str(duration)); d != "" {
+		dur, err := parseBanDuration(d)
+		if err != nil || dur <= 0 {
+			return api.Res(false, __("Invalid ban duration: %s", d))
+		}
+		until = f.now().Add(dur).UnixMilli()
+	}
+	entry := banEntry(firewall.Ban{
+		IP:      ip,
+		Until:   until,
+		Reason:  str(reason),
+		Source:  "manual",
+		Created: f.now().UnixMilli(),
+	})
+
+	f.cfg.Mutate(func() {
+		fw := f.cfg.Map("firewall")
+		if fw == nil {
+			fw = map[string]any{"enabled": true}
+			f.cfg.Set("firewall", fw)
+		}
+		list, _ := fw["bans"].([]any)
+		kept := make([]any, 0, len(list)+1)
+		for _, item := range list {
+			if ban, _ := item.(map[string]any); ban != nil && str(ban["ip"]) != ip {
+				kept = append(kept, ban)
+			}
+		}
+		fw["bans"] = append(kept, entry)
+		if lifted, _ := fw["lifted"].(map[string]any); lifted != nil {
+			delete(lifted, ip)
+		}
+		f.cfg.Touch("firewall")
+	})
+	go f.Sync()
+
+	if until == 0 {
+		return api.Res(true, __("%s banned permanently.", ip))
+	}
+	return api.Res(true, __("%s banned until %s.", ip, time.UnixMilli(until).Format(time.RFC3339)))
+}
+
+// Unban lifts a ban. The pushed policy no longer carries it and lists it
+// under lifted, so every daemon drops it on the next sync (immediately,
+// below), including a daemon still holding it as its own unconfirmed ban.
+func (f *Firewall) Unban(target any) api.Result {
+	ip, ok := firewall.ValidTarget(str(target))
+	if !ok {
+		return api.Res(false, __("Invalid IP address or CIDR range: %s", str(target)))
+	}
+	found := false
+	f.cfg.Mutate(func() {
+		fw := f.cfg.Map("firewall")
+		list, _ := fw["bans"].([]any)
+		kept := make([]any, 0, len(list))
+		for _, item := range list {
+			if ban, _ := item.(map[string]any); ban != nil && str(ban["ip"]) == ip {
+				found = true
+				continue
+			}
+			kept = append(kept, item)
+		}
+		if found {
+			fw["bans"] = kept
+			lifted, _ := fw["lifted"].(map[string]any)
+			if lifted == nil {
+				lifted = map[string]any{}
+				fw["lifted"] = lifted
+			}
+			lifted[ip] = f.now().UnixMilli()
+			f.cfg.Touch("firewall")
+		}
+	})
+	if !found {
+		return api.Res(false, __("%s is not banned.", ip))
+	}
+	go f.Sync()
+	return api.Res(true, __("%s unbanned.", ip))
+}
+
+// List renders the active bans, one per line, ordered by address.
+func (f *Firewall) List() api.Result {
+	nowMs := f.now().UnixMilli()
+	var bans []map[string]any
+	f.cfg.View(func() {
+		list, _ := f.cfg.Map("firewall")["bans"].([]any)
+		for _, item := range list {
+			if ban, _ := item.(map[string]any); ban != nil && !banExpired(ban, nowMs) {
+				bans = append(bans, ban)
+			}
+		}
+	})
+	if len(bans) == 0 {
+		return api.Res(true, __("No active bans."))
+	}
+	sort.SliceStable(bans, func(i, j int) bool {
+		return str(bans[i]["ip"]) < str(bans[j]["ip"])
+	})
+	lines := make([]string, len(bans))
+	for i, ban := range bans {
+		until := __("permanent")
+		if ms := millis(ban["until"]); ms > 0 {
+			until = time.UnixMilli(ms).Format(time.RFC3339)
+		}
+		line := fmt.Sprintf("%s  %s  %s", str(ban["ip"]), until, str(ban["source"]))
+		if reason := str(ban["reason"]); reason != "" {
+			line += "  " + reason
+		}
+		lines[i] = line
+	}
+	return api.Res(true, __("Active bans:")+"\n"+strings.Join(lines, "\n"))
+}
+
+// firewallPolicy renders the firewall config module for the daemons: the
+// stored map with expired bans dropped and the GeoIP database resolved
+// (firewall.geoip, else <baseDir>/geoip/country.mmdb when present). Caller
+// holds cfg.View or cfg.Mutate.
+func firewallPolicy(cfg *config.Store) map[string]any {
+	stored := cfg.Map("firewall")
+	out := make(map[string]any, len(stored)+2)
+	for k, v := range stored {
+		out[k] = v
+	}
+	if len(stored) == 0 {
+		out["enabled"] = true
+	}
+
+	nowMs := time.Now().UnixMilli()
+	list, _ := stored["bans"].([]any)
+	bans := make([]any, 0, len(list))
+	for _, item := range list {
+		if ban, _ := item.(map[string]any); ban != nil && !banExpired(ban, nowMs) {
+			bans = append(bans, ban)
+		}
+	}
+	out["bans"] = bans
+
+	if !truthy(out["geoip"]) {
+		path := filepath.Join(cfg.BaseDir(), "geoip", "country.mmdb")
+		if _, err := os.Stat(path); err == nil {
+			out["geoip"] = path
+		}
+	}
+	return out
+}
+
+func drainBans(sock string) ([]firewall.Ban, error) {
+	resp, err := socketClient(sock, 5*time.Second).Get("http://localhost/firewall/bans")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Bans []firewall.Ban `json:"bans"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Bans, nil
+}
+
+func banEntry(b firewall.Ban) map[string]any {
+	return map[string]any{
+		"ip":      b.IP,
+		"until":   b.Until,
+		"reason":  b.Reason,
+		"source":  b.Source,
+		"created": b.Created,
+	}
+}
+
+func banExpired(ban map[string]any, nowMs int64) bool {
+	until := millis(ban["until"])
+	return until > 0 && until <= nowMs
+}
+
+// millis reads a timestamp stored either in-process (int64) or decoded
+// from the module file (float64).
+func millis(v any) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// parseBanDuration accepts time.ParseDuration syntax plus whole days ("7d").
+func parseBanDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		if _, err := fmt.Sscanf(days, "%d", &n); err != nil || fmt.Sprint(n) != days {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
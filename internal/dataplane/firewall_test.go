@@ -0,0 +1,166 @@
+package dataplane
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"odac/internal/firewall"
+)
+
+// guardDaemon serves a real firewall.Guard on a unix socket, standing in
+// for one of the three daemons.
+func guardDaemon(t *testing.T, name string) (*firewall.Guard, *fakeProc) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "odacfw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, name+".sock")
+
+	g := firewall.NewGuard(name)
+	mux := http.NewServeMux()
+	g.Mount(mux)
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return g, &fakeProc{running: true, socket: sock}
+}
+
+func TestFirewallSharesAutoBans(t *testing.T) {
+	cfg := newStore(t)
+	mailGuard, mailProc := guardDaemon(t, "Mail")
+	proxyGuard, proxyProc := guardDaemon(t, "Proxy")
+	f := &Firewall{cfg: cfg, procs: []process{proxyProc, mailProc}, now: time.Now}
+
+	// Six failed logins trip the default mail.auth rule on the mail daemon.
+	for i := 0; i < 6; i++ {
+		mailGuard.Record(firewall.EventMailAuth, "198.51.100.4")
+	}
+	f.collect()
+	f.Sync()
+
+	bans, _ := cfg.Map("firewall")["bans"].([]any)
+	if len(bans) != 1 || str(bans[0].(map[string]any)["ip"]) != "198.51.100.4" {
+		t.Fatalf("persisted bans = %v", bans)
+	}
+	if ok, _ := proxyGuard.Check("198.51.100.4", "example.com"); ok {
+		t.Error("mail ban not enforced by the proxy")
+	}
+	if ok, _ := mailGuard.Check("198.51.100.4", ""); ok {
+		t.Error("mail ban lost on the mail daemon after the push")
+	}
+
+	if r := f.Unban("198.51.100.4"); !r.Status {
+		t.Fatalf("unban: %v", r.Message)
+	}
+	f.Sync()
+	if ok, _ := proxyGuard.Check("198.51.100.4", ""); !ok {
+		t.Error("unbanned address still blocked by the proxy")
+	}
+	if ok, _ := mailGuard.Check("198.51.100.4", ""); !ok {
+		t.Error("unbanned address still blocked by the mail daemon")
+	}
+}
+
+// TestFirewallUnbanOutlivesReoffer lifts a ban that daemons still hold as
+// their own: the push drops it there, and an older copy offered again later
+// does not restore it.
+func TestFirewallUnbanOutlivesReoffer(t *testing.T) {
+	cfg := newStore(t)
+	mailGuard, mailProc := guardDaemon(t, "Mail")
+	proxyGuard, proxyProc := guardDaemon(t, "Proxy")
+	f := &Firewall{cfg: cfg, procs: []process{proxyProc, mailProc}, now: time.Now}
+
+	ip := "198.51.100.5"
+	created := time.Now().Add(-time.Minute).UnixMilli()
+	mailGuard.Ban(firewall.Ban{IP: ip, Source: firewall.EventMailAuth, Created: created})
+	f.collect() // merged, but the push carrying it never arrives
+
+	if r := f.Unban(ip); !r.Status {
+		t.Fatalf("unban: %v", r.Message)
+	}
+	f.Sync()
+	if ok, _ := mailGuard.Check(ip, ""); !ok {
+		t.Error("lifted ban still enforced by the daemon that raised it")
+	}
+
+	proxyGuard.Ban(firewall.Ban{IP: ip, Source: firewall.EventHTTP4xx, Created: created})
+	f.collect()
+	if bans, _ := cfg.Map("firewall")["bans"].([]any); len(bans) != 0 {
+		t.Fatalf("ban offered again after the unban was restored: %v", bans)
+	}
+
+	// A ban raised after the unban is a new one.
+	proxyGuard.Ban(firewall.Ban{IP: "198.51.100.6", Source: firewall.EventHTTP4xx})
+	mailGuard.Ban(firewall.Ban{IP: ip, Source: firewall.EventMailAuth, Created: time.Now().Add(time.Second).UnixMilli()})
+	f.collect()
+	if bans, _ := cfg.Map("firewall")["bans"].([]any); len(bans) != 2 {
+		t.Errorf("new bans after the unban = %v", bans)
+	}
+}
+
+func TestFirewallManualBans(t *testing.T) {
+	cfg := newStore(t)
+	now := time.UnixMilli(1_700_000_000_000)
+	f := &Firewall{cfg: cfg, now: func() time.Time { return now }}
+
+	if r := f.Ban("not-an-ip", "", ""); r.Status {
+		t.Error("invalid target accepted")
+	}
+	if r := f.Ban("10.0.0.1", "soon", ""); r.Status {
+		t.Error("invalid duration accepted")
+	}
+	if r := f.Ban("10.1.2.3/8", "7d", "scanner"); !r.Status {
+		t.Fatalf("ban: %v", r.Message)
+	}
+	if r := f.Ban("203.0.113.9", "", ""); !r.Status {
+		t.Fatalf("ban: %v", r.Message)
+	}
+
+	bans, _ := cfg.Map("firewall")["bans"].([]any)
+	if len(bans) != 2 {
+		t.Fatalf("bans = %v", bans)
+	}
+	first := bans[0].(map[string]any)
+	if first["ip"] != "10.0.0.0/8" || millis(first["until"]) != now.Add(7*24*time.Hour).UnixMilli() {
+		t.Errorf("first ban = %v", first)
+	}
+
+	list := f.List()
+	msg, _ := list.Message.(string)
+	if !strings.Contains(msg, "10.0.0.0/8") || !strings.Contains(msg, "scanner") || !strings.Contains(msg, "203.0.113.9") {
+		t.Errorf("list = %q", msg)
+	}
+
+	now = now.Add(8 * 24 * time.Hour)
+	if msg, _ := f.List().Message.(string); strings.Contains(msg, "10.0.0.0/8") {
+		t.Errorf("expired ban listed: %q", msg)
+	}
+
+	if r := f.Unban("192.0.2.1"); r.Status {
+		t.Error("unbanning an unknown address succeeded")
+	}
+}
+
+func TestFirewallPolicyGeoIPDefault(t *testing.T) {
+	cfg := newStore(t)
+	if _, ok := firewallPolicy(cfg)["geoip"]; ok {
+		t.Error("geoip set without a database on disk")
+	}
+	path := filepath.Join(cfg.BaseDir(), "geoip", "country.mmdb")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("x"), 0644)
+	if got := firewallPolicy(cfg)["geoip"]; got != path {
+		t.Errorf("geoip = %v, want %s", got, path)
+	}
+}
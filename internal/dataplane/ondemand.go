@@ -0,0 +1,95 @@
+package dataplane
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// onDemandClaimTTL matches how long the proxy keeps an approved host.
+const onDemandClaimTTL = 10 * time.Minute
+
+// OnDemandIssuer registers a hostname an app claimed through on-demand TLS
+// and starts its certificate. *domains.Domain implements it.
+type OnDemandIssuer interface {
+	IssueOnDemand(domain, app string)
+}
+
+// SetOnDemand fills the issuer seam: domains borrows this Proxy for config
+// syncs, so the two are wired in two steps. Call it before the first tick.
+func (p *Proxy) SetOnDemand(issuer OnDemandIssuer) { p.issuer = issuer }
+
+// onDemandEntries renders the apps that take on-demand TLS, with the
+// backend the proxy asks. Caller holds cfg.Mutate.
+func (p *Proxy) onDemandEntries(apps []any) []any {
+	out := []any{}
+	for _, a := range apps {
+		app, _ := a.(map[string]any)
+		od, _ := app["onDemand"].(map[string]any)
+		if od == nil {
+			continue
+		}
+		backend := p.resolveBackend(app)
+		if backend == nil {
+			p.log.Log("OnDemand: No port found for app %s", app["name"])
+			continue
+		}
+		entry := map[string]any{"app": app["name"], "host": backend.host, "port": backend.port}
+		if ask := str(od["ask"]); ask != "" {
+			entry["ask"] = ask
+		}
+		if allow, _ := od["allow"].([]any); len(allow) > 0 {
+			entry["allow"] = allow
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// pollOnDemand hands the hostnames the proxy approved to the issuer. It
+// runs off the tick, one poll at a time, and only while some app takes
+// on-demand TLS.
+func (p *Proxy) pollOnDemand() {
+	if p.issuer == nil || p.onDemandApps.Load() == 0 || !p.polling.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer p.polling.Store(false)
+		sock := p.proc.SocketPath()
+		if _, err := os.Stat(sock); err != nil {
+			return
+		}
+		envelope, err := requestJSON(sock, "GET", "/ondemand", nil)
+		if err != nil {
+			p.log.Error("Failed to poll on-demand TLS requests: %s", err.Error())
+			return
+		}
+		list, _ := envelope["pending"].([]any)
+		for _, v := range list {
+			req, _ := v.(map[string]any)
+			domain := strings.ToLower(str(req["domain"]))
+			if domain != "" && p.claim(domain) {
+				p.issuer.IssueOnDemand(domain, str(req["app"]))
+			}
+		}
+	}()
+}
+
+// claim reports whether domain is due for the issuer: the proxy keeps
+// listing a host until its certificate lands, so each one is handed over
+// once per onDemandClaimTTL.
+func (p *Proxy) claim(domain string) bool {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for host, at := range p.claimed {
+		if now.Sub(at) > onDemandClaimTTL {
+			delete(p.claimed, host)
+		}
+	}
+	if _, ok := p.claimed[domain]; ok {
+		return false
+	}
+	p.claimed[domain] = now
+	return true
+}
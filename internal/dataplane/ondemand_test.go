@@ -0,0 +1,74 @@
+package dataplane
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeIssuer struct {
+	mu     sync.Mutex
+	issued [][2]string
+}
+
+func (f *fakeIssuer) IssueOnDemand(domain, app string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.issued = append(f.issued, [2]string{domain, app})
+}
+
+func (f *fakeIssuer) calls() [][2]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][2]string(nil), f.issued...)
+}
+
+func TestProxyOnDemand(t *testing.T) {
+	cs := newControlServer(t)
+	resolver := &fakeResolver{ips: map[string]string{"ctr-123": "10.5.0.2"}}
+	resolver.available.Store(true)
+	p, _ := newTestProxy(t, cs, resolver)
+	seedApps(p)
+	issuer := &fakeIssuer{}
+	p.SetOnDemand(issuer)
+	p.active = true
+
+	// No app takes on-demand TLS yet, so the tick does not poll.
+	p.Check()
+	time.Sleep(50 * time.Millisecond)
+	if got := issuer.calls(); len(got) != 0 {
+		t.Fatalf("issued = %v", got)
+	}
+
+	apps, _ := p.cfg.Get("apps").([]any)
+	apps[1].(map[string]any)["onDemand"] = map[string]any{"ask": "/check", "limit": float64(20)}
+	domains := p.cfg.Map("domains")
+	domains["shop.customer.test"] = map[string]any{"appId": "ctrapp", "onDemand": true}
+	p.SyncConfig()
+	payload := cs.nextConfig(t)
+	want := []any{map[string]any{"app": "ctrapp", "host": "10.5.0.2", "port": float64(8080), "ask": "/check"}}
+	if got := payload["onDemand"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("onDemand = %#v", got)
+	}
+	site, _ := payload["domains"].(map[string]any)["shop.customer.test"].(map[string]any)
+	if site["onDemand"] != true {
+		t.Errorf("site = %v", site)
+	}
+
+	p.Check()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(issuer.calls()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The proxy lists the host until its certificate lands; it is handed
+	// over once.
+	for i := 0; i < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+		p.Check()
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := issuer.calls(); !reflect.DeepEqual(got, [][2]string{{"shop.customer.test", "ctrapp"}}) {
+		t.Fatalf("issued = %v", got)
+	}
+}
@@ -0,0 +1,68 @@
+package dataplane
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// maxErrorPage caps a custom page pushed to the proxy.
+const maxErrorPage = 256 * 1024
+
+// errorPageKeys are the pages a domain can customize.
+var errorPageKeys = []string{"404", "502", "503", "504", "maintenance"}
+
+// errorPages loads a domain's custom pages for the /config payload. A page
+// comes from the record's errorPages entry (absolute, or relative to
+// <baseDir>/pages/<domain>) or, when unset, from <baseDir>/pages/<domain>/
+// <key>.html if present. Caller holds cfg.Mutate (see syncConfig).
+func (p *Proxy) errorPages(domain string, record map[string]any) map[string]any {
+	dir := filepath.Join(p.cfg.BaseDir(), "pages", domain)
+	configured, _ := record["errorPages"].(map[string]any)
+	out := map[string]any{}
+	for _, key := range errorPageKeys {
+		path, explicit := configured[key].(string)
+		if !explicit || path == "" {
+			explicit = false
+			path = key + ".html"
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		html, err := readErrorPage(path)
+		if err != nil {
+			if explicit {
+				p.log.Error("Failed to read %s page for %s: %s", key, domain, err.Error())
+			}
+			continue
+		}
+		out[key] = html
+	}
+	return out
+}
+
+func readErrorPage(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, maxErrorPage))
+	return string(b), err
+}
+
+// maintenanceEntry renders a domain's maintenance block for the proxy, nil
+// when the domain is live. rebuilding forces it on while appmgr recreates
+// the app.
+func maintenanceEntry(record map[string]any, rebuilding bool) map[string]any {
+	stored, _ := record["maintenance"].(map[string]any)
+	if !rebuilding && !truthy(stored["enabled"]) {
+		return nil
+	}
+	out := make(map[string]any, len(stored)+1)
+	for k, v := range stored {
+		out[k] = v
+	}
+	out["enabled"] = true
+	return out
+}
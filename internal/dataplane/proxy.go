@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"odac/internal/config"
@@ -34,6 +35,7 @@ type Tunnel struct {
 	Domain    string
 	Container string
 	Token     string
+	Relay     string // Self-hosted relay URL; empty = ODAC Cloud
 }
 
 // Proxy is the Go port of server/src/Proxy.js: supervises bin/odac-proxy and
@@ -51,22 +53,30 @@ type Proxy struct {
 
 	syncMu sync.Mutex // serializes config pushes (Node's event loop did)
 
-	mu      sync.Mutex
-	active  bool
-	tunnels map[string]Tunnel // by domain; full-replace semantics
+	mu          sync.Mutex
+	active      bool
+	tunnels     map[string]Tunnel    // by domain; full-replace semantics
+	maintenance map[string]bool      // app ids whose domains show the maintenance page
+	claimed     map[string]time.Time // on-demand hosts handed to the issuer
+
+	issuer       OnDemandIssuer
+	onDemandApps atomic.Int32 // apps taking on-demand TLS, as of the last payload
+	polling      atomic.Bool
 }
 
 // NewProxy wires the service. containers may be nil until task 3.4.
 func NewProxy(cfg *config.Store, binDir string, containers ContainerIPs) *Proxy {
 	p := &Proxy{
-		cfg:        cfg,
-		log:        logx.New("Proxy"),
-		containers: containers,
-		retryDelay: time.Second,
-		readyPoll:  200 * time.Millisecond,
-		dockerWait: 3 * time.Second,
-		dockerPoll: 100 * time.Millisecond,
-		tunnels:    map[string]Tunnel{},
+		cfg:         cfg,
+		log:         logx.New("Proxy"),
+		containers:  containers,
+		retryDelay:  time.Second,
+		readyPoll:   200 * time.Millisecond,
+		dockerWait:  3 * time.Second,
+		dockerPoll:  100 * time.Millisecond,
+		tunnels:     map[string]Tunnel{},
+		maintenance: map[string]bool{},
+		claimed:     map[string]time.Time{},
 	}
 	p.proc = supervise.New(supervise.Options{
 		Name:      "proxy",
@@ -107,13 +117,15 @@ func (p *Proxy) Stop() {
 	p.proc.Stop()
 }
 
-// Check runs on the 1s tick: respawn the binary if it is gone.
+// Check runs on the 1s tick: respawn the binary if it is gone and pick up
+// the hostnames it approved for on-demand TLS.
 func (p *Proxy) Check() {
 	p.mu.Lock()
 	active := p.active
 	p.mu.Unlock()
 	if active {
 		p.proc.Ensure()
+		p.pollOnDemand()
 	}
 }
 
@@ -219,6 +231,44 @@ func (p *Proxy) DeleteACMEChallenge(token string) {
 	}
 }
 
+// SetTLSALPNChallenge has the proxy answer a TLS-ALPN-01 validation for
+// domain on port 443 (POST /acme/tls-alpn). Like SetACMEChallenge it
+// propagates failure so the SSL module can try the next challenge type.
+func (p *Proxy) SetTLSALPNChallenge(domain, keyAuthorization string) error {
+	if !p.proc.Running() {
+		return errors.New("Proxy process not running")
+	}
+	sock := p.proc.SocketPath()
+	if _, err := os.Stat(sock); err != nil {
+		return errors.New("Proxy API not available")
+	}
+
+	status, err := requestStatus(sock, "POST", "/acme/tls-alpn",
+		map[string]any{"domain": domain, "keyAuthorization": keyAuthorization})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("Proxy returned HTTP %d for TLS-ALPN challenge", status)
+	}
+	return nil
+}
+
+// DeleteTLSALPNChallenge removes a domain's TLS-ALPN-01 challenge,
+// best-effort.
+func (p *Proxy) DeleteTLSALPNChallenge(domain string) {
+	if !p.proc.Running() {
+		return
+	}
+	sock := p.proc.SocketPath()
+	if _, err := os.Stat(sock); err != nil {
+		return
+	}
+	if _, err := requestStatus(sock, "DELETE", "/acme/tls-alpn", map[string]any{"domain": domain}); err != nil {
+		p.log.Error("Failed to delete TLS-ALPN challenge: %s", err.Error())
+	}
+}
+
 // SetTunnels ports setTunnels(): the Hub always sends the complete list, so
 // this is a full replace — missing entries are deletions. Persists
 // config.tunnels and syncs immediately. Returns the configured count; the
@@ -264,6 +314,30 @@ func (p *Proxy) WaitForReady(timeout time.Duration) bool {
 	return false
 }
 
+// SetMaintenance puts every domain of an app into maintenance mode (on) or
+// back to its configured state, syncing the proxy when that changes. appmgr
+// uses it around recreates that cannot run Blue-Green.
+func (p *Proxy) SetMaintenance(appID any, on bool) {
+	key := fmt.Sprint(appID)
+	p.mu.Lock()
+	changed := p.maintenance[key] != on
+	if on {
+		p.maintenance[key] = true
+	} else {
+		delete(p.maintenance, key)
+	}
+	p.mu.Unlock()
+	if changed {
+		p.SyncConfig()
+	}
+}
+
+func (p *Proxy) inMaintenance(app map[string]any) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.maintenance[fmt.Sprint(app["id"])]
+}
+
 // SyncConfig pushes the full routing config (Proxy.js syncConfig).
 func (p *Proxy) SyncConfig() {
 	p.syncMu.Lock()
@@ -335,18 +409,29 @@ func (p *Proxy) buildPayload() map[string]any {
 	apps, _ := p.cfg.Get("apps").([]any)
 
 	proxyDomains := map[string]any{}
+	agents := []any{}
 	for name, rec := range domains {
 		record, _ := rec.(map[string]any)
 		if record == nil {
 			continue
 		}
+		if relay, _ := record["relay"].(map[string]any); relay != nil {
+			// Served by a tunnel agent that dials in to this proxy.
+			agents = append(agents, map[string]any{"domain": name, "tokenHash": relay["tokenHash"]})
+			proxyDomains[name] = p.siteEntry(apps, name, record, &backendInfo{}, nil)
+			continue
+		}
 		app := findApp(apps, record["appId"])
 		if app == nil {
 			p.log.Log("Proxy: App %s not found for domain %s", record["appId"], name)
 			continue
 		}
+		maintenance := maintenanceEntry(record, p.inMaintenance(app))
 		backend := p.resolveBackend(app)
-		if backend == nil {
+		if backend == nil && maintenance != nil {
+			// A stopped app still gets its maintenance page.
+			backend = &backendInfo{host: "127.0.0.1"}
+		} else if backend == nil {
 			p.log.Log("Proxy: No port found for app %s (domain: %s)", app["name"], name)
 			continue
 		}
@@ -356,18 +441,7 @@ func (p *Proxy) buildPayload() map[string]any {
 			target = "Container Network"
 		}
 		p.log.Log("Proxy: Routing domain [%s] -> App [%s] via %s (%s:%d)", name, app["name"], target, backend.host, backend.port)
-
-		entry := map[string]any{
-			"domain":      name,
-			"port":        backend.port,
-			"subdomain":   orList(record["subdomain"]),
-			"cert":        orMap(record["cert"]),
-			"containerIP": backend.host,
-		}
-		if backend.internal {
-			entry["container"] = backend.host
-		}
-		proxyDomains[name] = entry
+		proxyDomains[name] = p.siteEntry(apps, name, record, backend, maintenance)
 	}
 
 	tunnels := []any{}
@@ -382,40 +456,117 @@ func (p *Proxy) buildPayload() map[string]any {
 			p.log.Log(fmt.Sprintf("Tunnel: No port found for %s (domain: %s)", tn.Container, tn.Domain))
 			continue
 		}
-		tunnels = append(tunnels, map[string]any{
+		entry := map[string]any{
 			"domain": tn.Domain, "host": backend.host, "port": backend.port, "token": tn.Token,
-		})
+		}
+		if tn.Relay != "" {
+			entry["relay"] = tn.Relay
+		}
+		tunnels = append(tunnels, entry)
 	}
 
+	streams := p.streamEntries(apps)
+	onDemand := p.onDemandEntries(apps)
+	p.onDemandApps.Store(int32(len(onDemand)))
+
 	p.log.Log("Proxy: Syncing %d domains, %d tunnels", len(proxyDomains), len(tunnels))
 
 	total, used := memInfo()
-	firewall := p.cfg.Get("firewall")
-	if !truthy(firewall) {
-		firewall = map[string]any{"enabled": true}
-	}
+	firewall := firewallPolicy(p.cfg)
 	var ssl any // JSON null when unset (Node: config.ssl || null)
 	if v := p.cfg.Get("ssl"); truthy(v) {
 		ssl = v
 	}
 
-	return map[string]any{
+	payload := map[string]any{
 		"domains":  proxyDomains,
 		"firewall": firewall,
 		"memory":   map[string]any{"total": total, "used": used},
+		"onDemand": onDemand,
+		"relay":    agents,
 		"ssl":      ssl,
+		"streams":  streams,
 		"tunnels":  tunnels,
 	}
+	if disk := p.diskCacheEntry(); disk != nil {
+		payload["diskCache"] = disk
+	}
+	return payload
 }
 
-// tunnelList snapshots the tunnel map, sorted by domain for a deterministic
+// siteEntry renders one domain's proxy entry. Caller holds cfg.Mutate.
+func (p *Proxy) siteEntry(apps []any, name string, record map[string]any, backend *backendInfo, maintenance map[string]any) map[string]any {
+	entry := map[string]any{
+		"domain":      name,
+		"port":        backend.port,
+		"subdomain":   orList(record["subdomain"]),
+		"cert":        orMap(p.domainCert(name)),
+		"containerIP": backend.host,
+	}
+	if backend.internal {
+		entry["container"] = backend.host
+	}
+	if _, relayed := record["relay"]; relayed {
+		entry["tunnelId"] = name
+	}
+	if waf := record["waf"]; truthy(waf) {
+		entry["waf"] = waf
+	}
+	if limits, _ := record["rateLimits"].([]any); len(limits) > 0 {
+		entry["rateLimits"] = limits
+	}
+	if pages := p.errorPages(name, record); len(pages) > 0 {
+		entry["errorPages"] = pages
+	}
+	if maintenance != nil {
+		entry["maintenance"] = maintenance
+	}
+	if record["onDemand"] == true {
+		entry["onDemand"] = true
+	}
+	if mtls, _ := record["mtls"].(map[string]any); mtls != nil {
+		entry["mtls"] = mtls
+	}
+	if backend, _ := record["backend"].(map[string]any); backend != nil {
+		entry["backend"] = backend
+	}
+	if cacheKey, _ := record["cacheKey"].(map[string]any); cacheKey != nil {
+		entry["cacheKey"] = cacheKey
+	}
+	if auth := p.accessEntry(apps, name, record); auth != nil {
+		entry["auth"] = auth
+	}
+	return entry
+}
+
+// domainCert returns the certificate record serving name, which is the
+// parent's for a domain under a wildcard certificate. Caller holds cfg.View
+// or cfg.Mutate.
+func (p *Proxy) domainCert(name string) any {
+	domains := p.cfg.Map("domains")
+	record, _ := domains[name].(map[string]any)
+	if parent, _ := record["wildcard"].(string); parent != "" {
+		parentRecord, _ := domains[parent].(map[string]any)
+		return parentRecord["cert"]
+	}
+	return record["cert"]
+}
+
+// tunnelList snapshots the Hub tunnels plus the self-hosted relay tunnels
+// (which win on the same domain), sorted by domain for a deterministic
 // payload (Node emitted Map insertion order; the binary treats the list as a
-// set, so ordering is free to differ).
+// set, so ordering is free to differ). Caller holds cfg.View or cfg.Mutate.
 func (p *Proxy) tunnelList() []Tunnel {
+	local := relayTunnels(p.cfg)
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	out := make([]Tunnel, 0, len(p.tunnels))
+	out := make([]Tunnel, 0, len(p.tunnels)+len(local))
 	for _, t := range p.tunnels {
+		if _, ok := local[t.Domain]; !ok {
+			out = append(out, t)
+		}
+	}
+	for _, t := range local {
 		out = append(out, t)
 	}
 	sort.Slice(out, func(i, j int) bool { return out[i].Domain < out[j].Domain })
@@ -464,28 +615,34 @@ func (p *Proxy) resolveBackend(app map[string]any) *backendInfo {
 	}
 
 	if internal {
-		target := app["activeContainerId"]
-		if !truthy(target) {
-			target = app["name"]
-		}
-		resolved := ""
-		if p.containers != nil {
-			if ip, err := p.containers.GetIP(str(target)); err == nil {
-				resolved = ip
-			}
+		if ip := p.containerIP(app); ip != "" {
+			host = ip
 		}
-		if resolved != "" {
+	}
+
+	return &backendInfo{host: host, port: port, internal: internal}
+}
+
+// containerIP returns the app container's address on the internal network,
+// falling back to the cached app.ip, or "" when neither is known.
+func (p *Proxy) containerIP(app map[string]any) string {
+	target := app["activeContainerId"]
+	if !truthy(target) {
+		target = app["name"]
+	}
+	if p.containers != nil {
+		if ip, err := p.containers.GetIP(str(target)); err == nil && ip != "" {
 			// Cache like Node (app.ip = containerIP): the live config map is
 			// mutated without marking the module dirty — it persists whenever
 			// the app module is next saved for another reason.
-			app["ip"] = resolved
-			host = resolved
-		} else if truthy(app["ip"]) {
-			host = str(app["ip"])
+			app["ip"] = ip
+			return ip
 		}
 	}
-
-	return &backendInfo{host: host, port: port, internal: internal}
+	if truthy(app["ip"]) {
+		return str(app["ip"])
+	}
+	return ""
 }
 
 // findApp ports apps.find(a => a.name === record.appId || a.id === record.appId).
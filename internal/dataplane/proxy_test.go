@@ -2,6 +2,7 @@ package dataplane
 
 import (
 	"encoding/json"
+	"maps"
 	"net"
 	"net/http"
 	"os"
@@ -11,6 +12,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"odac/internal/api"
 )
 
 func newTestProxy(t *testing.T, cs *controlServer, resolver ContainerIPs) (*Proxy, *fakeProc) {
@@ -107,6 +110,53 @@ func TestProxyPayloadAssembly(t *testing.T) {
 	}
 }
 
+func TestProxyWildcardHostUsesParentCert(t *testing.T) {
+	cs := newControlServer(t)
+	p, _ := newTestProxy(t, cs, nil)
+	seedApps(p)
+	domains := p.cfg.Map("domains")
+	domains["pr-1.host.test"] = map[string]any{"appId": "portapp", "cert": false, "wildcard": "host.test"}
+
+	p.SyncConfig()
+	payload := cs.nextConfig(t)
+
+	got, _ := payload["domains"].(map[string]any)["pr-1.host.test"].(map[string]any)
+	want := map[string]any{"ssl": map[string]any{"key": "k", "cert": "c"}}
+	if !reflect.DeepEqual(got["cert"], want) || got["port"] != float64(4000) {
+		t.Errorf("entry = %#v", got)
+	}
+}
+
+// Per-domain settings the proxy applies itself reach it unchanged, and only
+// on the domain that sets them.
+func TestProxyDomainPassThrough(t *testing.T) {
+	cs := newControlServer(t)
+	p, _ := newTestProxy(t, cs, nil)
+	seedApps(p)
+
+	settings := map[string]any{
+		"waf":        map[string]any{"mode": "detect"},
+		"rateLimits": []any{map[string]any{"path": "/login", "max": float64(5), "windowMs": float64(60000)}},
+		"mtls":       map[string]any{"ca": "/odac/cert/client-ca/port.test.pem", "mode": "optional"},
+		"backend":    map[string]any{"protocol": "h2c", "grpcWeb": true},
+		"cacheKey":   map[string]any{"ignoreQuery": []any{"utm_*"}, "query": true, "device": true},
+	}
+	maps.Copy(p.cfg.Map("domains")["port.test"].(map[string]any), settings)
+
+	p.SyncConfig()
+	got, _ := cs.nextConfig(t)["domains"].(map[string]any)
+	port, _ := got["port.test"].(map[string]any)
+	host, _ := got["host.test"].(map[string]any)
+	for key, want := range settings {
+		if !reflect.DeepEqual(port[key], want) {
+			t.Errorf("port.test %s = %#v", key, port[key])
+		}
+		if host[key] != nil {
+			t.Errorf("host.test %s = %#v", key, host[key])
+		}
+	}
+}
+
 func TestProxySSLNullWhenUnset(t *testing.T) {
 	cs := newControlServer(t)
 	p, _ := newTestProxy(t, cs, nil)
@@ -119,6 +169,90 @@ func TestProxySSLNullWhenUnset(t *testing.T) {
 	}
 }
 
+func TestProxyErrorPagesAndMaintenance(t *testing.T) {
+	cs := newControlServer(t)
+	p, _ := newTestProxy(t, cs, nil)
+	seedApps(p)
+
+	base := p.cfg.BaseDir()
+	dir := filepath.Join(base, "pages", "port.test")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "502.html"), []byte("<h1>down</h1>"), 0o644)
+	os.WriteFile(filepath.Join(base, "gone.html"), []byte("gone"), 0o644)
+
+	domains := p.cfg.Map("domains")
+	domains["port.test"].(map[string]any)["errorPages"] = map[string]any{
+		"404": filepath.Join(base, "gone.html"),
+		"504": "missing.html", // explicit but absent: logged, skipped
+	}
+	domains["host.test"].(map[string]any)["maintenance"] = map[string]any{"enabled": false, "allow": []any{"203.0.113.7"}}
+	domains["ctr.test"].(map[string]any)["maintenance"] = map[string]any{"enabled": true, "retryAfter": float64(60)}
+
+	// A recreate forces maintenance on, even for an app with no port yet.
+	p.SetMaintenance("a5", true)
+	payload := cs.nextConfig(t)
+	got, _ := payload["domains"].(map[string]any)
+
+	port, _ := got["port.test"].(map[string]any)
+	if !reflect.DeepEqual(port["errorPages"], map[string]any{"502": "<h1>down</h1>", "404": "gone"}) {
+		t.Errorf("port.test errorPages = %v", port["errorPages"])
+	}
+	if host, _ := got["host.test"].(map[string]any); host["maintenance"] != nil {
+		t.Errorf("disabled maintenance sent: %v", host["maintenance"])
+	}
+	if ctr, _ := got["ctr.test"].(map[string]any); !reflect.DeepEqual(ctr["maintenance"], map[string]any{"enabled": true, "retryAfter": float64(60)}) {
+		t.Errorf("ctr.test maintenance = %v", ctr["maintenance"])
+	}
+	noport, _ := got["noport.test"].(map[string]any)
+	if !reflect.DeepEqual(noport["maintenance"], map[string]any{"enabled": true}) || noport["port"] != float64(0) {
+		t.Errorf("noport.test = %v", noport)
+	}
+
+	p.SetMaintenance("a5", false)
+	payload = cs.nextConfig(t)
+	got, _ = payload["domains"].(map[string]any)
+	if _, ok := got["noport.test"]; ok {
+		t.Error("portless app still routed after maintenance ended")
+	}
+}
+
+func TestProxyAccessForwardAuth(t *testing.T) {
+	cs := newControlServer(t)
+	p, _ := newTestProxy(t, cs, nil)
+	seedApps(p)
+
+	domains := p.cfg.Map("domains")
+	domains["port.test"].(map[string]any)["auth"] = map[string]any{
+		"users": map[string]any{"alice": "$2a$10$hash"},
+		"rules": []any{
+			map[string]any{"path": "/", "forward": map[string]any{"app": "hostapp", "uri": "api/verify"}},
+			map[string]any{"path": "/ops", "allow": []any{"10.0.0.0/8"}, "basic": true},
+			map[string]any{"path": "/down", "forward": map[string]any{"app": "noport"}},
+		},
+	}
+	domains["host.test"].(map[string]any)["auth"] = map[string]any{"rules": []any{}}
+
+	p.SyncConfig()
+	got, _ := cs.nextConfig(t)["domains"].(map[string]any)
+
+	want := map[string]any{
+		"users": map[string]any{"alice": "$2a$10$hash"},
+		"rules": []any{
+			map[string]any{"path": "/", "forward": map[string]any{"url": "http://127.0.0.1:3000/api/verify", "headers": []any{}}},
+			map[string]any{"path": "/ops", "allow": []any{"10.0.0.0/8"}, "basic": true},
+			map[string]any{"path": "/down", "forward": map[string]any{"url": "", "headers": []any{}}},
+		},
+	}
+	if port, _ := got["port.test"].(map[string]any); !reflect.DeepEqual(port["auth"], want) {
+		t.Errorf("port.test auth = %v", port["auth"])
+	}
+	if host, _ := got["host.test"].(map[string]any); host["auth"] != nil {
+		t.Errorf("empty auth sent: %v", host["auth"])
+	}
+}
+
 func TestProxySetTunnels(t *testing.T) {
 	cs := newControlServer(t)
 	p, _ := newTestProxy(t, cs, nil)
@@ -148,6 +282,147 @@ func TestProxySetTunnels(t *testing.T) {
 	}
 }
 
+func TestProxyRelayTunnels(t *testing.T) {
+	cs := newControlServer(t)
+	p, _ := newTestProxy(t, cs, nil)
+	seedApps(p)
+	p.SetTunnels([]Tunnel{{Domain: "office.test", Container: "portapp", Token: "cloud"}})
+	cs.nextConfig(t)
+
+	for name, r := range map[string]api.Result{
+		"bad url":     p.AddTunnel("office.test", "hostapp", "ftp://relay.test", "tok"),
+		"no token":    p.AddTunnel("office.test", "hostapp", "wss://relay.test", ""),
+		"unknown app": p.AddTunnel("office.test", "ghost", "wss://relay.test", "tok"),
+		"bad domain":  p.AddTunnel("office", "hostapp", "wss://relay.test", "tok"),
+	} {
+		if r.Status {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	// A self-hosted tunnel replaces the Hub one for the same domain and
+	// survives the next Hub full replace.
+	if r := p.AddTunnel("Office.test", "a1", "https://relay.test", "tok"); !r.Status {
+		t.Fatalf("AddTunnel: %v", r.Message)
+	}
+	want := []any{map[string]any{
+		"domain": "office.test", "host": "127.0.0.1", "port": float64(3000), "token": "tok",
+		"relay": "wss://relay.test/_odac/ws",
+	}}
+	if got := cs.nextConfig(t)["tunnels"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("tunnels = %#v", got)
+	}
+	p.SetTunnels(nil)
+	if got := cs.nextConfig(t)["tunnels"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("after Hub replace: %#v", got)
+	}
+	if msg, _ := p.ListTunnels().Message.(string); !strings.Contains(msg, "office.test  hostapp  wss://relay.test/_odac/ws") || strings.Contains(msg, "tok") {
+		t.Errorf("list = %q", msg)
+	}
+
+	if r := p.DeleteTunnel("office.test"); !r.Status {
+		t.Fatalf("DeleteTunnel: %v", r.Message)
+	}
+	if got, _ := cs.nextConfig(t)["tunnels"].([]any); len(got) != 0 {
+		t.Errorf("deleted tunnel still sent: %#v", got)
+	}
+}
+
+func TestProxyStreams(t *testing.T) {
+	cs := newControlServer(t)
+	resolver := &fakeResolver{ips: map[string]string{"ctr-123": "10.5.0.2"}}
+	resolver.available.Store(true)
+	p, _ := newTestProxy(t, cs, resolver)
+	seedApps(p)
+
+	for name, r := range map[string]api.Result{
+		"bad name":        p.AddStream("PG SQL", 5432, map[string]any{"app": "ctrapp"}),
+		"reserved port":   p.AddStream("web", 443, map[string]any{"app": "ctrapp"}),
+		"bad port":        p.AddStream("pg", 70000, map[string]any{"app": "ctrapp"}),
+		"unknown app":     p.AddStream("pg", 5432, map[string]any{"app": "ghost"}),
+		"udp tls":         p.AddStream("pg", 5432, map[string]any{"app": "ctrapp", "udp": true, "tls": "terminate", "domain": "host.test"}),
+		"tls no domain":   p.AddStream("pg", 5432, map[string]any{"app": "ctrapp", "tls": "passthrough"}),
+		"unknown domain":  p.AddStream("pg", 5432, map[string]any{"app": "ctrapp", "tls": "terminate", "domain": "db.test"}),
+		"unknown tls":     p.AddStream("pg", 5432, map[string]any{"app": "ctrapp", "tls": "mutual", "domain": "host.test"}),
+		"bad domain name": p.AddStream("pg", 5432, map[string]any{"app": "ctrapp", "domain": "db"}),
+	} {
+		if r.Status {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	if r := p.AddStream("pg", 5432, map[string]any{"app": "a2", "port": 8080, "tls": "terminate", "domain": "host.test"}); !r.Status {
+		t.Fatalf("AddStream: %v", r.Message)
+	}
+	want := []any{map[string]any{
+		"name": "pg", "protocol": "tcp", "listen": float64(5432), "host": "10.5.0.2", "port": float64(8080),
+		"tls": "terminate", "domain": "host.test", "cert": map[string]any{"ssl": map[string]any{"key": "k", "cert": "c"}},
+	}}
+	if got := cs.nextConfig(t)["streams"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("streams = %#v", got)
+	}
+
+	// A published container port is reached through its host port.
+	if r := p.AddStream("dns", 5353, map[string]any{"app": "hostapp", "port": 3000, "udp": true}); !r.Status {
+		t.Fatalf("AddStream udp: %v", r.Message)
+	}
+	apps, _ := p.cfg.Get("apps").([]any)
+	apps[0].(map[string]any)["ports"] = []any{map[string]any{"host": float64(13000), "container": float64(3000)}}
+	p.SyncConfig()
+	cs.nextConfig(t)
+	got, _ := cs.nextConfig(t)["streams"].([]any)
+	if len(got) != 2 || got[0].(map[string]any)["host"] != "127.0.0.1" || got[0].(map[string]any)["port"] != float64(13000) {
+		t.Errorf("streams = %#v", got)
+	}
+
+	// Only passthrough streams for different domains share a port.
+	if r := p.AddStream("pg2", 5432, map[string]any{"app": "ctrapp"}); r.Status {
+		t.Error("plain stream accepted on a taken port")
+	}
+	if r := p.AddStream("a", 8443, map[string]any{"app": "ctrapp", "tls": "passthrough", "domain": "a.test"}); !r.Status {
+		t.Fatalf("passthrough a: %v", r.Message)
+	}
+	if r := p.AddStream("b", 8443, map[string]any{"app": "ctrapp", "tls": "passthrough", "domain": "b.test"}); !r.Status {
+		t.Fatalf("passthrough b: %v", r.Message)
+	}
+	if r := p.AddStream("c", 8443, map[string]any{"app": "ctrapp", "tls": "passthrough", "domain": "a.test"}); r.Status {
+		t.Error("second passthrough stream for the same domain accepted")
+	}
+
+	msg, _ := p.ListStreams().Message.(string)
+	if !strings.Contains(msg, "pg  tcp/5432  ctrapp:8080  tls=terminate host.test  active=2 total=9 refused=1 in=512B out=2.0KiB") {
+		t.Errorf("list = %q", msg)
+	}
+
+	if r := p.DeleteStream("pg"); !r.Status {
+		t.Fatalf("DeleteStream: %v", r.Message)
+	}
+	if r := p.DeleteStream("pg"); r.Status {
+		t.Error("deleting a missing stream succeeded")
+	}
+}
+
+func TestProxyRelayAgents(t *testing.T) {
+	cs := newControlServer(t)
+	p, _ := newTestProxy(t, cs, nil)
+	seedApps(p)
+	p.cfg.Map("domains")["office.test"] = map[string]any{
+		"relay":     map[string]any{"tokenHash": "abc123"},
+		"subdomain": []any{"www"},
+		"cert":      map[string]any{},
+	}
+
+	p.SyncConfig()
+	payload := cs.nextConfig(t)
+	if want := []any{map[string]any{"domain": "office.test", "tokenHash": "abc123"}}; !reflect.DeepEqual(payload["relay"], want) {
+		t.Errorf("relay = %#v", payload["relay"])
+	}
+	office, _ := payload["domains"].(map[string]any)["office.test"].(map[string]any)
+	if office["tunnelId"] != "office.test" || office["port"] != float64(0) {
+		t.Errorf("office.test = %v", office)
+	}
+}
+
 func TestProxyStartRestoresTunnels(t *testing.T) {
 	cs := newControlServer(t)
 	p, fp := newTestProxy(t, cs, nil)
@@ -417,11 +692,13 @@ func keys(m map[string]any) []string {
 	return out
 }
 
-// acmeServer fakes the proxy's /acme/challenge endpoints (contract 0.3),
-// recording bodies and answering a scripted status.
+// acmeServer fakes the proxy's /acme/challenge and /acme/tls-alpn
+// endpoints (contract 0.3), recording bodies and answering a scripted
+// status.
 type acmeServer struct {
 	sock   string
 	mu     sync.Mutex
+	paths  []string
 	posts  []map[string]any
 	dels   []map[string]any
 	status int
@@ -437,10 +714,11 @@ func newACMEServer(t *testing.T) *acmeServer {
 
 	as := &acmeServer{sock: filepath.Join(dir, "proxy.sock"), status: http.StatusOK}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/acme/challenge", func(w http.ResponseWriter, r *http.Request) {
+	record := func(w http.ResponseWriter, r *http.Request) {
 		var body map[string]any
 		json.NewDecoder(r.Body).Decode(&body)
 		as.mu.Lock()
+		as.paths = append(as.paths, r.Method+" "+r.URL.Path)
 		if r.Method == http.MethodDelete {
 			as.dels = append(as.dels, body)
 		} else {
@@ -449,7 +727,9 @@ func newACMEServer(t *testing.T) *acmeServer {
 		status := as.status
 		as.mu.Unlock()
 		w.WriteHeader(status)
-	})
+	}
+	mux.HandleFunc("/acme/challenge", record)
+	mux.HandleFunc("/acme/tls-alpn", record)
 
 	l, err := net.Listen("unix", as.sock)
 	if err != nil {
@@ -493,6 +773,36 @@ func TestProxySetACMEChallenge(t *testing.T) {
 	}
 }
 
+func TestProxyTLSALPNChallenge(t *testing.T) {
+	as := newACMEServer(t)
+	cfg := newStore(t)
+	p := NewProxy(cfg, t.TempDir(), nil)
+	p.proc = &fakeProc{running: true, socket: as.sock}
+
+	if err := p.SetTLSALPNChallenge("example.com", "tok.thumb"); err != nil {
+		t.Fatalf("SetTLSALPNChallenge: %v", err)
+	}
+	p.DeleteTLSALPNChallenge("example.com")
+	as.mu.Lock()
+	paths := append([]string(nil), as.paths...)
+	posts := append([]map[string]any(nil), as.posts...)
+	dels := append([]map[string]any(nil), as.dels...)
+	as.mu.Unlock()
+	if !reflect.DeepEqual(paths, []string{"POST /acme/tls-alpn", "DELETE /acme/tls-alpn"}) {
+		t.Fatalf("paths = %v", paths)
+	}
+	if posts[0]["domain"] != "example.com" || posts[0]["keyAuthorization"] != "tok.thumb" || dels[0]["domain"] != "example.com" {
+		t.Fatalf("posts = %v, dels = %v", posts, dels)
+	}
+
+	as.mu.Lock()
+	as.status = http.StatusInternalServerError
+	as.mu.Unlock()
+	if err := p.SetTLSALPNChallenge("example.com", "x"); err == nil || !strings.Contains(err.Error(), "HTTP 500") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
 func TestProxyDeleteACMEChallenge(t *testing.T) {
 	as := newACMEServer(t)
 	cfg := newStore(t)
@@ -0,0 +1,136 @@
+package dataplane
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"odac/internal/api"
+	"odac/internal/config"
+)
+
+// relayAgentPath is the relay endpoint agents dial (odac-proxy and ODAC
+// Cloud alike).
+const relayAgentPath = "/_odac/ws"
+
+// Self-hosted relay tunnels live in config.relayTunnels, keyed by domain:
+// {"container": app, "relay": "wss://...", "token": "..."}. They sit beside
+// the Hub-managed config.tunnels, which SetTunnels replaces wholesale.
+
+// relayTunnels reads the self-hosted tunnels. Caller holds cfg.View or
+// cfg.Mutate.
+func relayTunnels(cfg *config.Store) map[string]Tunnel {
+	out := map[string]Tunnel{}
+	for domain, v := range cfg.Map("relayTunnels") {
+		if val, _ := v.(map[string]any); val != nil {
+			out[domain] = Tunnel{Domain: domain, Container: str(val["container"]), Token: str(val["token"]), Relay: str(val["relay"])}
+		}
+	}
+	return out
+}
+
+// normalizeRelayURL accepts ws(s):// or http(s):// and defaults the path to
+// the agent endpoint.
+func normalizeRelayURL(raw string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", false
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = relayAgentPath
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return u.String(), true
+}
+
+// AddTunnel exposes an app through a self-hosted relay: this server dials
+// relayURL as the agent for domain, authenticating with token (issued on
+// the relay by `odac domain relay`).
+func (p *Proxy) AddTunnel(domainArg, appArg, relayArg, tokenArg any) api.Result {
+	domain := strings.ToLower(strings.TrimSpace(str(domainArg)))
+	if !strings.Contains(domain, ".") || strings.ContainsAny(domain, "/\\ ") {
+		return api.Res(false, __("Invalid domain format."))
+	}
+	relay, ok := normalizeRelayURL(str(relayArg))
+	if !ok {
+		return api.Res(false, __("Invalid relay URL: %s", str(relayArg)))
+	}
+	token, _ := tokenArg.(string)
+	if token == "" {
+		return api.Res(false, __("Token is required."))
+	}
+
+	var appName string
+	p.cfg.Mutate(func() {
+		apps, _ := p.cfg.Get("apps").([]any)
+		app := findApp(apps, appArg)
+		if app == nil {
+			return
+		}
+		appName = str(app["name"])
+		tunnels := p.cfg.Map("relayTunnels")
+		if tunnels == nil {
+			tunnels = map[string]any{}
+		}
+		tunnels[domain] = map[string]any{"container": appName, "relay": relay, "token": token}
+		p.cfg.Set("relayTunnels", tunnels)
+	})
+	if appName == "" {
+		return api.Res(false, __("App %s not found.", str(appArg)))
+	}
+
+	p.log.Log("Relay tunnel for %s -> %s added", domain, appName)
+	p.SyncConfig()
+	return api.Res(true, __("Tunnel for %s added.", domain))
+}
+
+// DeleteTunnel removes a self-hosted relay tunnel.
+func (p *Proxy) DeleteTunnel(domainArg any) api.Result {
+	domain := strings.ToLower(strings.TrimSpace(str(domainArg)))
+	found := false
+	p.cfg.Mutate(func() {
+		tunnels := p.cfg.Map("relayTunnels")
+		if _, found = tunnels[domain]; found {
+			delete(tunnels, domain)
+			p.cfg.Set("relayTunnels", tunnels)
+		}
+	})
+	if !found {
+		return api.Res(false, __("Tunnel for %s not found.", domain))
+	}
+	p.log.Log("Relay tunnel for %s removed", domain)
+	p.SyncConfig()
+	return api.Res(true, __("Tunnel for %s removed.", domain))
+}
+
+// ListTunnels renders every tunnel, Hub-managed and self-hosted, one per
+// line. Tokens are never shown.
+func (p *Proxy) ListTunnels() api.Result {
+	var list []Tunnel
+	p.cfg.View(func() {
+		list = p.tunnelList()
+	})
+	if len(list) == 0 {
+		return api.Res(true, __("No tunnels."))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Domain < list[j].Domain })
+	lines := make([]string, len(list))
+	for i, t := range list {
+		relay := t.Relay
+		if relay == "" {
+			relay = "ODAC Cloud"
+		}
+		lines[i] = fmt.Sprintf("%s  %s  %s", t.Domain, t.Container, relay)
+	}
+	return api.Res(true, __("Tunnels:")+"\n"+strings.Join(lines, "\n"))
+}
@@ -0,0 +1,274 @@
+package dataplane
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"odac/internal/api"
+	"odac/internal/netmode"
+	"odac/internal/ports"
+)
+
+// Streams live in config.streams, keyed by name:
+// {"protocol": "tcp"|"udp", "listen": 5432, "app": name, "port": 5432,
+// "tls": ""|"terminate"|"passthrough", "domain": "db.example.com"}.
+// The proxy binary opens one listener per protocol and port; passthrough
+// streams may share a port and are told apart by SNI.
+
+var streamNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// reservedStreamPorts are held by the web proxy, the mail and DNS servers
+// and the local API.
+var reservedStreamPorts = map[string]bool{
+	"tcp/80": true, "tcp/443": true, "udp/443": true,
+	"tcp/53": true, "udp/53": true,
+	"tcp/25": true, "tcp/465": true, "tcp/587": true,
+	"tcp/110": true, "tcp/995": true, "tcp/143": true, "tcp/993": true,
+	"tcp/1453": true,
+}
+
+// AddStream creates or replaces a layer-4 stream to an app port. opts holds
+// app, port (the app's container port; defaults to listen), udp, tls and
+// domain.
+func (p *Proxy) AddStream(nameArg, listenArg, optsArg any) api.Result {
+	name := strings.ToLower(strings.TrimSpace(str(nameArg)))
+	if !streamNameRe.MatchString(name) {
+		return api.Res(false, __("Invalid stream name. Use lowercase letters, digits and dashes."))
+	}
+	opts, _ := optsArg.(map[string]any)
+	protocol := "tcp"
+	if opts["udp"] == true {
+		protocol = "udp"
+	}
+	listen := jsParseInt(listenArg)
+	if listen < 1 || listen > 65535 {
+		return api.Res(false, __("Invalid listen port: %s", str(listenArg)))
+	}
+	key := protocol + "/" + strconv.Itoa(listen)
+	if reservedStreamPorts[key] {
+		return api.Res(false, __("Port %s is used by ODAC itself.", key))
+	}
+	port := listen
+	if v := opts["port"]; truthy(v) {
+		if port = jsParseInt(v); port < 1 || port > 65535 {
+			return api.Res(false, __("Invalid app port: %s", str(v)))
+		}
+	}
+	mode := str(opts["tls"])
+	switch mode {
+	case "", "terminate", "passthrough":
+	default:
+		return api.Res(false, __("Invalid TLS mode %s. Use terminate or passthrough.", mode))
+	}
+	if mode != "" && protocol == "udp" {
+		return api.Res(false, __("TLS is only available for TCP streams."))
+	}
+	domain := strings.ToLower(strings.TrimSpace(str(opts["domain"])))
+	if domain != "" && (!strings.Contains(domain, ".") || strings.ContainsAny(domain, "/\\ ")) {
+		return api.Res(false, __("Invalid domain format."))
+	}
+	if mode != "" && domain == "" {
+		return api.Res(false, __("A TLS stream needs --domain."))
+	}
+
+	var appName, failure string
+	p.cfg.Mutate(func() {
+		apps, _ := p.cfg.Get("apps").([]any)
+		app := findApp(apps, opts["app"])
+		if app == nil {
+			failure = __("App %s not found.", str(opts["app"]))
+			return
+		}
+		if _, ok := p.cfg.Map("domains")[domain].(map[string]any); mode == "terminate" && !ok {
+			failure = __("Domain %s is not configured. Add it first so it gets a certificate.", domain)
+			return
+		}
+		streams := p.cfg.Map("streams")
+		for other, v := range streams {
+			s, _ := v.(map[string]any)
+			if other == name || s == nil || str(s["protocol"]) != protocol || jsParseInt(s["listen"]) != listen {
+				continue
+			}
+			// Only passthrough streams for different domains can share a port.
+			if mode != "passthrough" || str(s["tls"]) != "passthrough" || str(s["domain"]) == domain {
+				failure = __("Port %s is already used by stream %s.", key, other)
+				return
+			}
+		}
+		appName = str(app["name"])
+		if streams == nil {
+			streams = map[string]any{}
+		}
+		entry := map[string]any{"protocol": protocol, "listen": float64(listen), "app": appName, "port": float64(port)}
+		if mode != "" {
+			entry["tls"] = mode
+		}
+		if domain != "" {
+			entry["domain"] = domain
+		}
+		streams[name] = entry
+		p.cfg.Set("streams", streams)
+	})
+	if failure != "" {
+		return api.Res(false, failure)
+	}
+
+	p.log.Log("Stream %s (%s) -> %s:%s added", name, key, appName, strconv.Itoa(port))
+	p.SyncConfig()
+	return api.Res(true, __("Stream %s added on %s.", name, key))
+}
+
+// DeleteStream removes a stream and closes its listener when no other
+// stream shares the port.
+func (p *Proxy) DeleteStream(nameArg any) api.Result {
+	name := strings.ToLower(strings.TrimSpace(str(nameArg)))
+	found := false
+	p.cfg.Mutate(func() {
+		streams := p.cfg.Map("streams")
+		if _, found = streams[name]; found {
+			delete(streams, name)
+			p.cfg.Set("streams", streams)
+		}
+	})
+	if !found {
+		return api.Res(false, __("Stream %s not found.", name))
+	}
+	p.log.Log("Stream %s removed", name)
+	p.SyncConfig()
+	return api.Res(true, __("Stream %s removed.", name))
+}
+
+// ListStreams renders every stream with the proxy's live counters, one per
+// line.
+func (p *Proxy) ListStreams() api.Result {
+	var lines []string
+	p.cfg.View(func() {
+		for name, v := range p.cfg.Map("streams") {
+			s, _ := v.(map[string]any)
+			if s == nil {
+				continue
+			}
+			line := fmt.Sprintf("%s  %s/%d  %s:%d", name, str(s["protocol"]), jsParseInt(s["listen"]), str(s["app"]), jsParseInt(s["port"]))
+			if mode := str(s["tls"]); mode != "" {
+				line += "  tls=" + mode + " " + str(s["domain"])
+			}
+			lines = append(lines, line)
+		}
+	})
+	if len(lines) == 0 {
+		return api.Res(true, __("No streams."))
+	}
+	sort.Strings(lines)
+
+	stats := p.streamStats()
+	for i, line := range lines {
+		name, _, _ := strings.Cut(line, " ")
+		if st, ok := stats[name]; ok {
+			lines[i] = fmt.Sprintf("%s  active=%d total=%d refused=%d in=%s out=%s", line,
+				jsParseInt(st["active"]), jsParseInt(st["total"]), jsParseInt(st["refused"]),
+				formatBytes(st["bytesIn"]), formatBytes(st["bytesOut"]))
+		}
+	}
+	return api.Res(true, __("Streams:")+"\n"+strings.Join(lines, "\n"))
+}
+
+// streamStats fetches the proxy's per-stream counters by name; empty when
+// the proxy is not running.
+func (p *Proxy) streamStats() map[string]map[string]any {
+	out := map[string]map[string]any{}
+	sock := p.proc.SocketPath()
+	if _, err := os.Stat(sock); err != nil {
+		return out
+	}
+	envelope, err := requestJSON(sock, "GET", "/streams", nil)
+	if err != nil {
+		p.log.Error("Failed to read stream stats: %s", err.Error())
+		return out
+	}
+	list, _ := envelope["streams"].([]any)
+	for _, v := range list {
+		if st, _ := v.(map[string]any); st != nil {
+			out[str(st["name"])] = st
+		}
+	}
+	return out
+}
+
+func formatBytes(v any) string {
+	n, _ := v.(float64)
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0fB", n)
+	}
+	exp, div := 0, float64(unit)
+	for n/div >= unit && exp < 4 {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", n/div, "KMGTP"[exp])
+}
+
+// streamEntries renders config.streams for the proxy payload. Caller holds
+// cfg.Mutate.
+func (p *Proxy) streamEntries(apps []any) []any {
+	names := make([]string, 0)
+	streams := p.cfg.Map("streams")
+	for name := range streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []any{}
+	for _, name := range names {
+		s, _ := streams[name].(map[string]any)
+		if s == nil {
+			continue
+		}
+		app := findAppByName(apps, str(s["app"]))
+		if app == nil {
+			p.log.Log("Stream: App %s not found for stream %s", s["app"], name)
+			continue
+		}
+		host, port := p.streamBackend(app, jsParseInt(s["port"]))
+		if host == "" {
+			p.log.Log("Stream: No address for app %s (stream: %s)", s["app"], name)
+			continue
+		}
+		entry := map[string]any{
+			"name": name, "protocol": s["protocol"], "listen": jsParseInt(s["listen"]),
+			"host": host, "port": port,
+		}
+		if mode := str(s["tls"]); mode != "" {
+			entry["tls"] = mode
+		}
+		if domain := str(s["domain"]); domain != "" {
+			entry["domain"] = domain
+			if str(s["tls"]) == "terminate" {
+				entry["cert"] = orMap(p.domainCert(domain))
+			}
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// streamBackend resolves where an app's container port is reachable: its
+// published host port on loopback, the port itself for a host-network app,
+// else the container address.
+func (p *Proxy) streamBackend(app map[string]any, port int) (string, int) {
+	portList, _ := app["ports"].([]any)
+	for _, v := range portList {
+		entry, _ := v.(map[string]any)
+		if ports.IsPublished(entry) && jsParseInt(entry["container"]) == port {
+			return ports.Loopback, jsParseInt(entry["host"])
+		}
+	}
+	if netmode.IsHost(app["networkMode"]) {
+		return netmode.LoopbackAddr, port
+	}
+	return p.containerIP(app), port
+}
@@ -12,6 +12,7 @@ import (
 
 	"odac/internal/dns/config"
 	"odac/internal/dns/resolver"
+	"odac/internal/firewall"
 )
 
 // Readiness reports whether the public DNS listeners (UDP:53 and TCP:53)
@@ -30,12 +31,14 @@ func (r *Readiness) IsReady() bool {
 // Server is the HTTP API server that receives config updates from Node.js.
 type Server struct {
 	resolver  *resolver.Resolver
+	guard     *firewall.Guard
 	readiness *Readiness
 }
 
-// NewServer creates a new API server wrapping the DNS resolver.
-func NewServer(r *resolver.Resolver, rd *Readiness) *Server {
-	return &Server{resolver: r, readiness: rd}
+// NewServer creates a new API server wrapping the DNS resolver and the
+// rate limiter's firewall guard.
+func NewServer(r *resolver.Resolver, g *firewall.Guard, rd *Readiness) *Server {
+	return &Server{resolver: r, guard: g, readiness: rd}
 }
 
 // HandleConfig processes full zone configuration syncs from Node.js.
@@ -93,6 +96,10 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
 	case "/config":
 		s.HandleConfig(w, r)
+	case "/firewall":
+		s.guard.HandlePolicy(w, r)
+	case "/firewall/bans":
+		s.guard.HandleBans(w, r)
 	case "/health":
 		s.HandleHealth(w, r)
 	case "/ready":
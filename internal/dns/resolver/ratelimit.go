@@ -3,7 +3,9 @@ package resolver
 // Rate limiter for DNS queries using a lock-free sync.Map for O(1) per-IP
 // tracking. Mirrors Node.js DNS.js rate limiting: 2500 requests/minute/IP
 // with localhost bypass. A background goroutine periodically evicts stale
-// entries to prevent unbounded memory growth.
+// entries to prevent unbounded memory growth. Addresses blocked by the
+// shared firewall policy are refused outright, and every window an address
+// overruns counts as a "dns.flood" event towards its auto-ban.
 
 import (
 	"log"
@@ -13,6 +15,8 @@ import (
 	"time"
 
 	"github.com/miekg/dns"
+
+	"odac/internal/firewall"
 )
 
 const (
@@ -26,6 +30,7 @@ const (
 // Implements dns.Handler so it can be used as middleware in the handler chain.
 type RateLimiter struct {
 	counts   sync.Map // IP string -> *ipCounter
+	guard    *firewall.Guard
 	limit    int
 	next     dns.Handler
 	stop     chan struct{}
@@ -44,6 +49,7 @@ type ipCounter struct {
 // Starts a background cleanup goroutine for stale entry eviction.
 func NewRateLimiter(next dns.Handler) *RateLimiter {
 	rl := &RateLimiter{
+		guard:    firewall.NewGuard("DNS"),
 		limit:    defaultRateLimit,
 		next:     next,
 		stop:     make(chan struct{}),
@@ -54,6 +60,11 @@ func NewRateLimiter(next dns.Handler) *RateLimiter {
 	return rl
 }
 
+// Guard returns the shared IP policy engine (control API: /firewall).
+func (rl *RateLimiter) Guard() *firewall.Guard {
+	return rl.guard
+}
+
 // Stop terminates the background cleanup goroutine.
 // Must be called during graceful shutdown to prevent goroutine leaks.
 func (rl *RateLimiter) Stop() {
@@ -71,6 +82,11 @@ func (rl *RateLimiter) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
 		return
 	}
 
+	if ok, _ := rl.guard.Check(clientIP, ""); !ok {
+		refuse(w, req)
+		return
+	}
+
 	now := time.Now().UnixMilli()
 
 	// Load or create counter — lock-free O(1)
@@ -108,10 +124,9 @@ func (rl *RateLimiter) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
 		// Rate limited — send empty response (same as Node.js DNS.js)
 		if count == int64(rl.limit)+1 {
 			log.Printf("[DNS] Rate limit exceeded for %s", clientIP)
+			rl.guard.Record(firewall.EventDNSFlood, clientIP)
 		}
-		msg := new(dns.Msg)
-		msg.SetRcode(req, dns.RcodeRefused)
-		w.WriteMsg(msg)
+		refuse(w, req)
 		return
 	}
 
@@ -127,6 +142,7 @@ func (rl *RateLimiter) cleanupLoop() {
 		select {
 		case <-ticker.C:
 			rl.cleanup()
+			rl.guard.Prune()
 		case <-rl.stop:
 			return
 		}
@@ -159,6 +175,13 @@ func (rl *RateLimiter) forceCleanup() {
 	rl.cleanup()
 }
 
+// refuse answers REFUSED (same as Node.js DNS.js for limited clients).
+func refuse(w dns.ResponseWriter, req *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetRcode(req, dns.RcodeRefused)
+	w.WriteMsg(msg)
+}
+
 // extractIP extracts the IP address from a net.Addr, stripping the port.
 func extractIP(addr net.Addr) string {
 	if addr == nil {
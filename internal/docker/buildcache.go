@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cacheMount is where a compile container sees its app's build cache.
+const cacheMount = "/cache"
+
+// buildCacheDir is <cacheRoot>/<app>/<strategy>: one cache per app and
+// toolchain, so a project that switches from npm to pnpm starts clean and
+// apps never read each other's downloads. "" when caching is not set up.
+func (c *Client) buildCacheDir(appName, strategyKey string) string {
+	if c.cacheRoot == "" || !validCacheName(appName) {
+		return ""
+	}
+	return filepath.Join(c.cacheRoot, appName, strings.ToLower(strategyKey))
+}
+
+func validCacheName(appName string) bool {
+	return appName != "" && appName != "." && appName != ".." && !strings.ContainsAny(appName, `/\`)
+}
+
+// trimBuildCache empties a strategy cache that grew past limit after a
+// build. The next build fills it again from scratch, which keeps the cap a
+// hard bound without tracking per-file access times.
+func (c *Client) trimBuildCache(dir string, limit int64, buildLog BuildLog) {
+	size := dirSize(dir)
+	if size <= limit {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		c.log.Error("[Builder] Failed to clear build cache %s: %s", dir, err.Error())
+		return
+	}
+	msg := fmt.Sprintf("[Builder] Build cache reached %d MB (cap %d MB) and was cleared.", size>>20, limit>>20)
+	c.log.Log("%s", msg)
+	if buildLog != nil {
+		fmt.Fprintln(buildLog, msg)
+	}
+}
+
+// ClearBuildCache removes every build cache of an app and returns the
+// number of bytes freed.
+func (c *Client) ClearBuildCache(appName string) (int64, error) {
+	if !validCacheName(appName) {
+		return 0, errors.New("Invalid app name")
+	}
+	if c.cacheRoot == "" {
+		return 0, nil
+	}
+	dir := filepath.Join(c.cacheRoot, appName)
+	size := dirSize(dir)
+	if err := os.RemoveAll(dir); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// dirSize sums the sizes of the regular files below dir, skipping anything
+// it cannot read.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
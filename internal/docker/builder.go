@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -41,8 +43,48 @@ func parseMajorMinor(raw string) string {
 	return majorMinorRe.FindString(raw)
 }
 
+// toolVersion returns the version pinned for tool in an asdf/mise
+// .tool-versions file ("ruby 3.3.0" -> "3.3.0").
+func toolVersion(content, tool string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == tool {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// javaMajor returns the feature release of a Java version: "17" for
+// "17.0.2" or "temurin-17", "8" for the legacy "1.8".
+func javaMajor(raw string) string {
+	m := javaVersionRe.FindStringSubmatch(raw)
+	if m == nil {
+		return ""
+	}
+	if m[1] == "1" && m[2] != "" {
+		return m[2]
+	}
+	return m[1]
+}
+
+// javaResolver reads .java-version, then .tool-versions, and renders the
+// major version into the compiler image's tag format.
+func javaResolver(tagFormat string) versionResolver {
+	return versionResolver{file: ".java-version", fallbackFile: ".tool-versions", parse: func(content, filename string) string {
+		if filename == ".tool-versions" {
+			content = toolVersion(content, "java")
+		}
+		if major := javaMajor(strings.TrimSpace(content)); major != "" {
+			return fmt.Sprintf(tagFormat, major)
+		}
+		return ""
+	}}
+}
+
 var (
 	goDirectiveRe    = regexp.MustCompile(`(?m)^go\s+(\d+\.\d+)`)
+	javaVersionRe    = regexp.MustCompile(`(\d+)(?:\.(\d+))?`)
+	semverRe         = regexp.MustCompile(`\d+\.\d+\.\d+`)
 	nodeMajorRe      = regexp.MustCompile(`(\d+)`)
 	pythonRuntimeRe  = regexp.MustCompile(`python-(\d+\.\d+)`)
 	requiresPythonRe = regexp.MustCompile(`requires-python\s*=\s*["']([^"']+)["']`)
@@ -54,6 +96,31 @@ var (
 			}
 			return ""
 		}},
+		"DENO": {file: ".tool-versions", parse: func(content, _ string) string {
+			if v := semverRe.FindString(toolVersion(content, "deno")); v != "" {
+				return "alpine-" + v
+			}
+			return ""
+		}},
+		"DOTNET": {file: "global.json", parse: func(content, _ string) string {
+			var global struct {
+				SDK struct {
+					Version string `json:"version"`
+				} `json:"sdk"`
+			}
+			if json.Unmarshal([]byte(content), &global) != nil {
+				return ""
+			}
+			return parseMajorMinor(global.SDK.Version)
+		}},
+		"ELIXIR": {file: ".tool-versions", parse: func(content, _ string) string {
+			if v := parseMajorMinor(toolVersion(content, "elixir")); v != "" {
+				return v + "-alpine"
+			}
+			return ""
+		}},
+		"JAVA_GRADLE": javaResolver("jdk%s"),
+		"JAVA_MAVEN":  javaResolver("3-eclipse-temurin-%s"),
 		"NODE": {file: "package.json", parse: func(content, _ string) string {
 			var pkg struct {
 				Engines struct {
@@ -93,6 +160,12 @@ var (
 			}
 			return ""
 		}},
+		"RUBY": {file: ".ruby-version", fallbackFile: ".tool-versions", parse: func(content, filename string) string {
+			if filename == ".tool-versions" {
+				content = toolVersion(content, "ruby")
+			}
+			return parseMajorMinor(content)
+		}},
 		"RUST": {file: "rust-toolchain.toml", fallbackFile: "rust-toolchain", parse: func(content, filename string) string {
 			if filename == "rust-toolchain" {
 				if v := parseMajorMinor(strings.TrimSpace(content)); v != "" {
@@ -119,6 +192,47 @@ type packageSpec struct {
 	cmd       []string
 	setup     []string
 	env       [][2]string // ordered KEY,VALUE pairs
+
+	// baseImageFor derives the runtime image from the resolved compiler
+	// image, for runtimes that must match the version the project was
+	// built with. baseImage stays the default-version equivalent.
+	baseImageFor func(compilerImage string) string
+}
+
+var trailingMajorRe = regexp.MustCompile(`(\d+)$`)
+
+// javaRuntimeImage maps maven:3-eclipse-temurin-17 or gradle:jdk17 to the
+// matching Temurin JRE.
+func javaRuntimeImage(compilerImage string) string {
+	major := trailingMajorRe.FindString(compilerImage)
+	if major == "" {
+		major = "21"
+	}
+	return "eclipse-temurin:" + major + "-jre-alpine"
+}
+
+// dotnetRuntimeImage maps the SDK image to the ASP.NET runtime of the same
+// channel.
+func dotnetRuntimeImage(compilerImage string) string {
+	return strings.Replace(compilerImage, "/dotnet/sdk:", "/dotnet/aspnet:", 1) + "-alpine"
+}
+
+// rubyRuntimeImage maps the full Ruby image the gems were compiled on to the
+// slim image of the same interpreter version.
+func rubyRuntimeImage(compilerImage string) string {
+	if v := parseMajorMinor(compilerImage); v != "" {
+		return "ruby:" + v + "-slim"
+	}
+	return "ruby:slim"
+}
+
+// denoRuntimeImage maps any Deno image variant to the Alpine one of the same
+// release, so DENO_DIR stays readable by the runtime that filled it.
+func denoRuntimeImage(compilerImage string) string {
+	if v := semverRe.FindString(compilerImage); v != "" {
+		return "denoland/deno:alpine-" + v
+	}
+	return "denoland/deno:alpine"
 }
 
 // buildStrategy is one entry of Node's BUILD_STRATEGIES.
@@ -135,6 +249,10 @@ type buildStrategy struct {
 	pkg             *packageSpec
 	custom          bool
 	image           string // resolved compiler image
+
+	// cacheEnv points the toolchain's download and build caches below
+	// cacheMount, so they survive between builds of the same app.
+	cacheEnv [][2]string
 }
 
 var buildStrategies = map[string]buildStrategy{
@@ -144,21 +262,89 @@ var buildStrategies = map[string]buildStrategy{
 		installCmd: "bun install --frozen-lockfile",
 		buildCmd:   "bun run build --if-present",
 		cleanupCmd: "bun install --production && rm -rf test tests",
+		cacheEnv:   [][2]string{{"BUN_INSTALL_CACHE_DIR", "/cache/bun"}},
 		pkg:        &packageSpec{baseImage: "oven/bun:alpine", user: "bun", cmd: []string{"bun", "run", "start"}},
 	},
+	"DENO": {
+		key: "DENO", name: "Deno", triggers: []string{"deno.json", "deno.jsonc"},
+		imageBase: "denoland/deno", imageDefault: "alpine", versionResolver: "DENO",
+		installCmd: "DENO_DIR=/app/.deno deno install",
+		buildCmd:   `if grep -qs '"build"' deno.json deno.jsonc; then DENO_DIR=/app/.deno deno task build; fi`,
+		pkg: &packageSpec{
+			baseImage: "denoland/deno:alpine", user: "deno",
+			cmd:          []string{"sh", "-c", `if grep -qs '"start"' deno.json deno.jsonc; then exec deno task start; else exec deno run -A main.ts; fi`},
+			env:          [][2]string{{"DENO_DIR", "/app/.deno"}},
+			baseImageFor: denoRuntimeImage,
+		},
+	},
+	"DOTNET": {
+		key: "DOTNET", name: ".NET", triggers: []string{"*.csproj", "*.fsproj"},
+		imageBase: "mcr.microsoft.com/dotnet/sdk", imageDefault: "10.0", versionResolver: "DOTNET",
+		installCmd: "dotnet restore",
+		buildCmd:   "dotnet publish -c Release -o /app/publish --no-restore",
+		cleanupCmd: "rm -rf bin obj",
+		cacheEnv:   [][2]string{{"NUGET_PACKAGES", "/cache/nuget"}},
+		pkg: &packageSpec{
+			baseImage: "mcr.microsoft.com/dotnet/aspnet:10.0-alpine", user: "app",
+			cmd:          []string{"sh", "-c", `export ASPNETCORE_HTTP_PORTS="${PORT:-8080}"; exec dotnet "$(ls /app/publish/*.runtimeconfig.json | head -n 1 | sed "s/runtimeconfig.json$/dll/")"`},
+			env:          [][2]string{{"DOTNET_ROLL_FORWARD", "Major"}},
+			baseImageFor: dotnetRuntimeImage,
+		},
+	},
+	"ELIXIR": {
+		key: "ELIXIR", name: "Elixir", triggers: []string{"mix.exs"},
+		imageBase: "elixir", imageDefault: "alpine", versionResolver: "ELIXIR",
+		installCmd: "apk add --no-cache build-base git && mix local.hex --force && mix local.rebar --force && MIX_ENV=prod mix deps.get --only prod",
+		buildCmd:   `export MIX_ENV=prod && mix compile && if mix help assets.deploy >/dev/null 2>&1; then mix assets.deploy; fi && mix release --overwrite --path /app/release && APP=$(mix run --no-compile --no-start -e "IO.puts(Mix.Project.config()[:app])" | tail -n 1) && ln -sf "$APP" /app/release/bin/odac-start`,
+		cleanupCmd: "rm -rf _build deps",
+		cacheEnv:   [][2]string{{"HEX_HOME", "/cache/hex"}, {"MIX_HOME", "/cache/mix"}},
+		// The release bundles ERTS, so the runtime only needs its shared libraries.
+		pkg: &packageSpec{
+			baseImage: "alpine:latest", user: "nobody",
+			cmd: []string{"/app/release/bin/odac-start", "start"},
+			setup: []string{
+				`apk add --no-cache libstdc++ libgcc ncurses-libs openssl`,
+			},
+			env: [][2]string{{"LANG", "C.UTF-8"}, {"MIX_ENV", "prod"}, {"PHX_SERVER", "true"}},
+		},
+	},
 	"GO": {
 		key: "GO", name: "Go", triggers: []string{"go.mod"},
 		imageBase: "golang", imageDefault: "alpine", versionResolver: "GO",
 		installCmd: "go mod download",
 		buildCmd:   `PKG=$(go list -f "{{.Name}} {{.ImportPath}}" ./... | grep "^main " | head -n 1 | cut -d" " -f2); if [ -z "$PKG" ]; then PKG="."; fi; go build -o app $PKG`,
+		cacheEnv:   [][2]string{{"GOMODCACHE", "/cache/go/mod"}, {"GOCACHE", "/cache/go/build"}},
 		pkg:        &packageSpec{baseImage: "alpine:latest", user: "nobody", cmd: []string{"/app/app"}},
 	},
+	"JAVA_GRADLE": {
+		key: "JAVA_GRADLE", name: "Java (Gradle)", triggers: []string{"build.gradle", "build.gradle.kts"},
+		imageBase: "gradle", imageDefault: "jdk21", versionResolver: "JAVA_GRADLE",
+		buildCmd:   `if [ -x gradlew ]; then G=./gradlew; else G=gradle; fi; $G --no-daemon -q build -x test && cp "$(ls build/libs/*.jar | grep -v -e "-plain.jar$" | head -n 1)" /app/app.jar`,
+		cleanupCmd: "rm -rf build .gradle",
+		cacheEnv:   [][2]string{{"GRADLE_USER_HOME", "/cache/gradle"}},
+		pkg: &packageSpec{
+			baseImage: "eclipse-temurin:21-jre-alpine", user: "nobody", cmd: []string{"java", "-jar", "/app/app.jar"},
+			baseImageFor: javaRuntimeImage,
+		},
+	},
+	"JAVA_MAVEN": {
+		key: "JAVA_MAVEN", name: "Java (Maven)", triggers: []string{"pom.xml"},
+		imageBase: "maven", imageDefault: "3-eclipse-temurin-21", versionResolver: "JAVA_MAVEN",
+		buildCmd:   `if [ -x mvnw ]; then M=./mvnw; else M=mvn; fi; $M -B -q -DskipTests package && cp "$(ls target/*.jar | grep -v -e "-sources.jar$" -e "-javadoc.jar$" -e "/original-" | head -n 1)" /app/app.jar`,
+		cleanupCmd: "rm -rf target",
+		cacheEnv:   [][2]string{{"MAVEN_OPTS", "-Dmaven.repo.local=/cache/maven"}},
+		pkg: &packageSpec{
+			baseImage: "eclipse-temurin:21-jre-alpine", user: "nobody", cmd: []string{"java", "-jar", "/app/app.jar"},
+			baseImageFor: javaRuntimeImage,
+		},
+	},
 	"NODE_NPM": {
 		key: "NODE_NPM", name: "Node.js (npm)", triggers: []string{"package-lock.json"},
 		imageBase: "node", imageDefault: "lts-alpine", versionResolver: "NODE",
 		installCmd: "if [ -f package-lock.json ]; then npm ci --no-audit --no-fund; else npm install --no-audit --no-fund; fi",
 		buildCmd:   "npm run build --if-present",
 		cleanupCmd: "npm prune --production && rm -rf test tests",
+		cacheEnv:   [][2]string{{"npm_config_cache", "/cache/npm"}},
 		pkg:        &packageSpec{baseImage: "node:lts-alpine", user: "node", cmd: []string{"npm", "start"}},
 	},
 	"NODE_PNPM": {
@@ -167,6 +353,7 @@ var buildStrategies = map[string]buildStrategy{
 		installCmd: "corepack enable && corepack prepare pnpm@latest --activate && pnpm install --frozen-lockfile",
 		buildCmd:   "pnpm run build --if-present",
 		cleanupCmd: "pnpm prune --prod && rm -rf test tests",
+		cacheEnv:   [][2]string{{"npm_config_store_dir", "/cache/pnpm"}, {"COREPACK_HOME", "/cache/corepack"}},
 		pkg:        &packageSpec{baseImage: "node:lts-alpine", user: "node", cmd: []string{"npm", "start"}},
 	},
 	"NODE_YARN": {
@@ -175,6 +362,7 @@ var buildStrategies = map[string]buildStrategy{
 		installCmd: "corepack enable && yarn install --frozen-lockfile",
 		buildCmd:   "yarn run build --if-present",
 		cleanupCmd: "yarn install --production --frozen-lockfile && rm -rf test tests",
+		cacheEnv:   [][2]string{{"YARN_CACHE_FOLDER", "/cache/yarn"}, {"COREPACK_HOME", "/cache/corepack"}},
 		pkg:        &packageSpec{baseImage: "node:lts-alpine", user: "node", cmd: []string{"npm", "start"}},
 	},
 	"PHP": {
@@ -182,6 +370,7 @@ var buildStrategies = map[string]buildStrategy{
 		imageBase: "composer", imageDefault: "lts", versionResolver: "PHP",
 		installCmd: "if [ -f composer.json ]; then composer install --no-dev --ignore-platform-reqs; fi",
 		buildCmd:   "true",
+		cacheEnv:   [][2]string{{"COMPOSER_CACHE_DIR", "/cache/composer"}},
 		pkg: &packageSpec{
 			baseImage: "php:8.2-apache", user: "www-data", cmd: []string{"apache2-foreground"},
 			setup: []string{
@@ -194,20 +383,42 @@ var buildStrategies = map[string]buildStrategy{
 	"PYTHON": {
 		key: "PYTHON", name: "Python", triggers: []string{"requirements.txt", "pyproject.toml"},
 		imageBase: "python", imageDefault: "3-slim", versionResolver: "PYTHON",
-		installCmd: "[ ! -f requirements.txt ] || pip install --no-cache-dir -r requirements.txt --target /app/deps",
+		installCmd: "[ ! -f requirements.txt ] || pip install -r requirements.txt --target /app/deps",
 		buildCmd:   "rm -rf __pycache__",
+		cacheEnv:   [][2]string{{"PIP_CACHE_DIR", "/cache/pip"}},
 		pkg: &packageSpec{
 			baseImage: "python:3-slim", user: "nobody",
 			cmd: []string{"sh", "-c", "if [ -f main.py ]; then python main.py; elif [ -f run.py ]; then python run.py; else python app.py; fi"},
 			env: [][2]string{{"PYTHONPATH", "/app/deps"}},
 		},
 	},
+	"RUBY": {
+		key: "RUBY", name: "Ruby", triggers: []string{"Gemfile"},
+		imageBase: "ruby", imageDefault: "latest", versionResolver: "RUBY",
+		installCmd: "bundle config set --local deployment true && bundle config set --local without development:test && bundle install -j4",
+		buildCmd:   `if [ -f bin/rails ] && bundle exec rails -T assets:precompile 2>/dev/null | grep -q assets:precompile; then RAILS_ENV=production SECRET_KEY_BASE_DUMMY=1 bundle exec rails assets:precompile; fi`,
+		cleanupCmd: "rm -rf tmp/cache spec test",
+		cacheEnv:   [][2]string{{"BUNDLE_USER_CACHE", "/cache/bundle"}},
+		pkg: &packageSpec{
+			baseImage: "ruby:slim", user: "nobody",
+			cmd: []string{"sh", "-c", `if [ -f bin/rails ]; then exec bundle exec rails server -b 0.0.0.0 -p "${PORT:-3000}"; else exec bundle exec rackup -o 0.0.0.0 -p "${PORT:-3000}"; fi`},
+			setup: []string{
+				`apt-get update -qq && apt-get install -y -qq --no-install-recommends libpq5 >/dev/null && rm -rf /var/lib/apt/lists/*`,
+			},
+			env: [][2]string{
+				{"BUNDLE_DEPLOYMENT", "1"}, {"BUNDLE_WITHOUT", "development:test"},
+				{"RAILS_ENV", "production"}, {"RACK_ENV", "production"}, {"RAILS_LOG_TO_STDOUT", "1"},
+			},
+			baseImageFor: rubyRuntimeImage,
+		},
+	},
 	"RUST": {
 		key: "RUST", name: "Rust", triggers: []string{"Cargo.toml", "Cargo.lock"},
 		imageBase: "rust", imageDefault: "alpine", versionResolver: "RUST",
 		installCmd: "apk add --no-cache musl-dev",
-		buildCmd:   `cargo build --release && find target/release -maxdepth 1 -type f -executable -not -name "*.*" | head -n 1 | xargs -I {} cp {} /app/app`,
+		buildCmd:   `cargo build --release && find "${CARGO_TARGET_DIR:-target}/release" -maxdepth 1 -type f -executable -not -name "*.*" | head -n 1 | xargs -I {} cp {} /app/app`,
 		cleanupCmd: "rm -rf target src",
+		cacheEnv:   [][2]string{{"CARGO_HOME", "/cache/cargo"}, {"CARGO_TARGET_DIR", "/cache/target"}},
 		pkg:        &packageSpec{baseImage: "alpine:latest", user: "nobody", cmd: []string{"/app/app"}},
 	},
 	"STATIC": {
@@ -241,6 +452,44 @@ var compileEnv = []string{
 	"COMPOSER_NO_INTERACTION=1",
 }
 
+// BuildOptions carries an app's build inputs. None of them end up in the
+// final image: the cache and the compile env live only in the compile
+// container, and a custom Dockerfile gets secrets as BuildKit secrets.
+type BuildOptions struct {
+	// CacheLimit caps the app's build cache in bytes; 0 builds without one.
+	CacheLimit int64
+	// Args are plain build variables: compile env for detected projects,
+	// --build-arg for a custom Dockerfile.
+	Args map[string]string
+	// Secrets are like Args but masked in the build log, and reach a custom
+	// Dockerfile only through RUN --mount=type=secret,id=<KEY>.
+	Secrets map[string]string
+}
+
+// buildVarName limits build arg and secret keys to plain variable names;
+// they are interpolated into the custom `docker build` command line.
+var buildVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// env renders Args and Secrets as a sorted KEY=VALUE list.
+func (o BuildOptions) env() []string {
+	var env []string
+	for _, vars := range []map[string]string{o.Args, o.Secrets} {
+		for _, k := range slices.Sorted(maps.Keys(vars)) {
+			env = append(env, k+"="+vars[k])
+		}
+	}
+	return env
+}
+
+// secretValues lists the values the build log must mask.
+func (o BuildOptions) secretValues() []string {
+	var values []string
+	for _, k := range slices.Sorted(maps.Keys(o.Secrets)) {
+		values = append(values, o.Secrets[k])
+	}
+	return values
+}
+
 // BuildContext carries the two views of the source directory (Builder.js's
 // context object): InternalPath for this process's own FS reads/writes,
 // HostPath for bind mounts handed to the host's Docker daemon (DooD).
@@ -253,11 +502,12 @@ type BuildContext struct {
 // Build ports Container.build + Builder.build: detects the project type,
 // then either forwards a custom Dockerfile build or runs the two-stage
 // compile/package pipeline, producing imageName. Parallel builds of the
-// same image are rejected. When buildLog is nil and AppName is set, the
+// same image are rejected. opts carries the app's build cache cap, args and
+// secrets. When buildLog is nil and AppName is set, the
 // builder creates (and finalizes) its own applog build stream; a
 // caller-provided buildLog is never finalized here (App finalizes after
 // deployment completes).
-func (c *Client) Build(sourceDir, imageName, appName string, buildLog BuildLog) error {
+func (c *Client) Build(sourceDir, imageName, appName string, opts BuildOptions, buildLog BuildLog) error {
 	if !c.available {
 		return fmt.Errorf("Docker is not available")
 	}
@@ -268,6 +518,13 @@ func (c *Client) Build(sourceDir, imageName, appName string, buildLog BuildLog)
 	if !safeImageRef.MatchString(imageName) {
 		return fmt.Errorf("Invalid image name: %q", imageName)
 	}
+	for _, vars := range []map[string]string{opts.Args, opts.Secrets} {
+		for k := range vars {
+			if !buildVarName.MatchString(k) {
+				return fmt.Errorf("Invalid build variable name: %q", k)
+			}
+		}
+	}
 
 	c.mu.Lock()
 	if c.activeBuilds[imageName] {
@@ -287,11 +544,11 @@ func (c *Client) Build(sourceDir, imageName, appName string, buildLog BuildLog)
 		name = filepath.Base(sourceDir)
 	}
 	bctx := BuildContext{InternalPath: sourceDir, HostPath: c.ResolveHostPath(sourceDir), AppName: name}
-	return c.builderRun(bctx, imageName, buildLog)
+	return c.builderRun(bctx, imageName, opts, buildLog)
 }
 
 // builderRun is Builder.build.
-func (c *Client) builderRun(bctx BuildContext, imageName string, buildLog BuildLog) error {
+func (c *Client) builderRun(bctx BuildContext, imageName string, opts BuildOptions, buildLog BuildLog) error {
 	// Self-created logger when the caller did not pass one (standalone
 	// builder path). Only this path finalizes the log.
 	var ownCtrl *applog.BuildControl
@@ -334,7 +591,7 @@ func (c *Client) builderRun(bctx BuildContext, imageName string, buildLog BuildL
 			if buildLog != nil {
 				buildLog.StartPhase("custom")
 			}
-			if err := c.packageCustom(bctx, imageName, buildLog); err != nil {
+			if err := c.packageCustom(bctx, imageName, opts, buildLog); err != nil {
 				return err
 			}
 			if buildLog != nil {
@@ -345,7 +602,7 @@ func (c *Client) builderRun(bctx BuildContext, imageName string, buildLog BuildL
 		if buildLog != nil {
 			buildLog.StartPhase("compile")
 		}
-		if err := c.compile(strategy, bctx, buildLog); err != nil {
+		if err := c.compile(strategy, bctx, opts, buildLog); err != nil {
 			return err
 		}
 		if buildLog != nil {
@@ -383,7 +640,9 @@ func detectStrategy(internalPath string) *buildStrategy {
 		return &buildStrategy{name: "Custom Dockerfile", custom: true}
 	}
 
-	order := []string{"PYTHON", "GO", "RUST", "BUN", "NODE_PNPM", "NODE_YARN", "NODE_NPM"}
+	// Backend frameworks come before the Node strategies: Rails, Spring
+	// and ASP.NET projects often carry a package.json for their assets.
+	order := []string{"PYTHON", "GO", "RUST", "JAVA_MAVEN", "JAVA_GRADLE", "DOTNET", "RUBY", "ELIXIR", "DENO", "BUN", "NODE_PNPM", "NODE_YARN", "NODE_NPM"}
 	var chosen *buildStrategy
 	for _, key := range order {
 		s := buildStrategies[key]
@@ -414,6 +673,12 @@ func detectStrategy(internalPath string) *buildStrategy {
 
 func strategyTriggered(internalPath string, s buildStrategy) bool {
 	for _, trigger := range s.triggers {
+		if strings.Contains(trigger, "*") {
+			if matches, _ := filepath.Glob(filepath.Join(internalPath, trigger)); len(matches) > 0 {
+				return true
+			}
+			continue
+		}
 		if fileExists(filepath.Join(internalPath, trigger)) {
 			return true
 		}
@@ -452,8 +717,9 @@ func resolveImage(internalPath string, s *buildStrategy) string {
 
 // compile ports Builder.#compile: run install/build/cleanup in an
 // unprivileged runner with the source bind-mounted and host networking
-// (speed + registry caching).
-func (c *Client) compile(strategy *buildStrategy, bctx BuildContext, buildLog BuildLog) error {
+// (speed + registry caching). With a cache cap set, the app's cache
+// directory for this strategy is mounted at cacheMount.
+func (c *Client) compile(strategy *buildStrategy, bctx BuildContext, opts BuildOptions, buildLog BuildLog) error {
 	c.log.Log("[Phase 1] Compiling artifacts using %s...", strategy.image)
 
 	var cmds []string
@@ -475,12 +741,33 @@ func (c *Client) compile(strategy *buildStrategy, bctx BuildContext, buildLog Bu
 		buildLog.StartPhase("run_compile")
 	}
 
+	binds := []string{bctx.HostPath + ":/app"}
+	env := append(append([]string{}, compileEnv...), opts.env()...)
+	cacheDir := ""
+	if opts.CacheLimit > 0 && len(strategy.cacheEnv) > 0 {
+		cacheDir = c.buildCacheDir(bctx.AppName, strategy.key)
+	}
+	if cacheDir != "" {
+		if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+			c.log.Error("[Builder] Build cache for %s unavailable: %s", bctx.AppName, err.Error())
+			cacheDir = ""
+		} else {
+			binds = append(binds, c.ResolveHostPath(cacheDir)+":"+cacheMount)
+			for _, kv := range strategy.cacheEnv {
+				env = append(env, kv[0]+"="+kv[1])
+			}
+		}
+	}
+
 	status, err := c.runBuilderContainer(strategy.image, []string{"sh", "-c", commands}, &container.HostConfig{
-		Binds:       []string{bctx.HostPath + ":/app"},
+		Binds:       binds,
 		AutoRemove:  true,
 		Privileged:  false, // SECURITY: strict no to privileged
 		NetworkMode: "host",
-	}, "/app", compileEnv, buildLog)
+	}, "/app", env, opts.secretValues(), buildLog)
+	if cacheDir != "" {
+		c.trimBuildCache(cacheDir, opts.CacheLimit, buildLog)
+	}
 	if err != nil {
 		return err
 	}
@@ -500,7 +787,7 @@ func (c *Client) compile(strategy *buildStrategy, bctx BuildContext, buildLog Bu
 func (c *Client) packageImage(strategy *buildStrategy, bctx BuildContext, imageName string, buildLog BuildLog) error {
 	c.log.Log("[Phase 2] Packaging final image %s...", imageName)
 
-	dockerfile := generateDockerfile(strategy.pkg)
+	dockerfile := generateDockerfile(strategy.runtimePackage())
 	dockerfilePath := filepath.Join(bctx.InternalPath, "Dockerfile.odac")
 	dockerignorePath := filepath.Join(bctx.InternalPath, ".dockerignore")
 
@@ -541,7 +828,7 @@ func (c *Client) packageImage(strategy *buildStrategy, bctx BuildContext, imageN
 		},
 		AutoRemove: true,
 		Privileged: false, // not needed, just socket access
-	}, "", nil, buildLog)
+	}, "", nil, nil, buildLog)
 	if err != nil {
 		return err
 	}
@@ -556,11 +843,24 @@ func (c *Client) packageImage(strategy *buildStrategy, bctx BuildContext, imageN
 }
 
 // packageCustom ports Builder.#packageCustom: forward the user's own
-// Dockerfile to the host daemon through docker:cli.
-func (c *Client) packageCustom(bctx BuildContext, imageName string, buildLog BuildLog) error {
+// Dockerfile to the host daemon through docker:cli. Args and secrets are
+// handed to the docker CLI through its environment and referenced by name,
+// so their values never appear on the command line.
+func (c *Client) packageCustom(bctx BuildContext, imageName string, opts BuildOptions, buildLog BuildLog) error {
 	c.log.Log("[Builder] Building from Custom Dockerfile for %s...", imageName)
 
-	buildCmd := fmt.Sprintf("docker build --progress=plain -t %s /app", imageName)
+	flags := ""
+	for _, k := range slices.Sorted(maps.Keys(opts.Args)) {
+		flags += " --build-arg " + k
+	}
+	for _, k := range slices.Sorted(maps.Keys(opts.Secrets)) {
+		flags += fmt.Sprintf(" --secret id=%s,env=%s", k, k)
+	}
+	buildCmd := fmt.Sprintf("docker build --progress=plain%s -t %s /app", flags, imageName)
+	env := opts.env()
+	if len(opts.Secrets) > 0 {
+		env = append(env, "DOCKER_BUILDKIT=1")
+	}
 
 	if buildLog != nil {
 		buildLog.StartPhase("pull_builder")
@@ -577,7 +877,7 @@ func (c *Client) packageCustom(bctx BuildContext, imageName string, buildLog Bui
 		Binds:      []string{"/var/run/docker.sock:/var/run/docker.sock", bctx.HostPath + ":/app"},
 		AutoRemove: true,
 		Privileged: false,
-	}, "", nil, buildLog)
+	}, "", env, opts.secretValues(), buildLog)
 	if err != nil {
 		return err
 	}
@@ -592,8 +892,9 @@ func (c *Client) packageCustom(bctx BuildContext, imageName string, buildLog Bui
 }
 
 // runBuilderContainer creates + runs one ephemeral build container and
-// returns its exit code, streaming output into buildLog.
-func (c *Client) runBuilderContainer(image string, cmd []string, hostCfg *container.HostConfig, workDir string, env []string, buildLog BuildLog) (int64, error) {
+// returns its exit code, streaming output into buildLog with every value in
+// secrets masked.
+func (c *Client) runBuilderContainer(image string, cmd []string, hostCfg *container.HostConfig, workDir string, env, secrets []string, buildLog BuildLog) (int64, error) {
 	ctx := context.Background()
 	created, err := c.api.ContainerCreate(ctx, &container.Config{
 		Image:      image,
@@ -604,7 +905,17 @@ func (c *Client) runBuilderContainer(image string, cmd []string, hostCfg *contai
 	if err != nil {
 		return 0, err
 	}
-	return c.runToCompletion(ctx, created.ID, writerOrNil(buildLog), "")
+	return c.runToCompletion(ctx, created.ID, writerOrNil(buildLog), secrets...)
+}
+
+// runtimePackage is the strategy's packageSpec with the runtime image
+// resolved against the compiler image actually used.
+func (s *buildStrategy) runtimePackage() *packageSpec {
+	pkg := *s.pkg
+	if pkg.baseImageFor != nil {
+		pkg.baseImage = pkg.baseImageFor(s.image)
+	}
+	return &pkg
 }
 
 // generateDockerfile renders the ephemeral packaging Dockerfile exactly as
@@ -36,6 +36,12 @@ func TestDetectStrategy(t *testing.T) {
 		{"npm by package-lock", map[string]string{"package-lock.json": ""}, "Node.js (npm)"},
 		{"bare package.json falls back to npm", map[string]string{"package.json": "{}"}, "Node.js (npm)"},
 		{"python beats go", map[string]string{"pyproject.toml": "", "go.mod": "module x"}, "Python"},
+		{"maven by pom", map[string]string{"pom.xml": "<project/>"}, "Java (Maven)"},
+		{"gradle kotlin dsl", map[string]string{"build.gradle.kts": ""}, "Java (Gradle)"},
+		{"dotnet by csproj glob", map[string]string{"Api.csproj": "<Project/>"}, ".NET"},
+		{"rails with package.json", map[string]string{"Gemfile": "", "package.json": "{}", "yarn.lock": ""}, "Ruby"},
+		{"elixir by mix.exs", map[string]string{"mix.exs": ""}, "Elixir"},
+		{"deno by deno.jsonc", map[string]string{"deno.jsonc": "{}"}, "Deno"},
 		{"php by composer", map[string]string{"composer.json": "{}"}, "PHP"},
 		{"php by index.php", map[string]string{"index.php": "<?php"}, "PHP"},
 		{"static by index.html", map[string]string{"index.html": "<html>"}, "Static Web"},
@@ -72,6 +78,17 @@ func TestResolveImageVersions(t *testing.T) {
 		{"python default", map[string]string{"requirements.txt": ""}, "python:3-slim"},
 		{"rust toolchain toml", map[string]string{"Cargo.toml": "", "rust-toolchain.toml": `channel = "1.78.0"`}, "rust:1.78-alpine"},
 		{"rust bare toolchain", map[string]string{"Cargo.toml": "", "rust-toolchain": "1.75.0\n"}, "rust:1.75-alpine"},
+		{"maven java-version", map[string]string{"pom.xml": "", ".java-version": "17.0.2\n"}, "maven:3-eclipse-temurin-17"},
+		{"maven legacy java-version", map[string]string{"pom.xml": "", ".java-version": "1.8"}, "maven:3-eclipse-temurin-8"},
+		{"gradle tool-versions", map[string]string{"build.gradle": "", ".tool-versions": "nodejs 20.1.0\njava temurin-21.0.1\n"}, "gradle:jdk21"},
+		{"gradle default", map[string]string{"build.gradle": ""}, "gradle:jdk21"},
+		{"dotnet global.json", map[string]string{"App.csproj": "", "global.json": `{"sdk":{"version":"8.0.404"}}`}, "mcr.microsoft.com/dotnet/sdk:8.0"},
+		{"dotnet default", map[string]string{"App.fsproj": ""}, "mcr.microsoft.com/dotnet/sdk:10.0"},
+		{"ruby version file", map[string]string{"Gemfile": "", ".ruby-version": "ruby-3.3.5\n"}, "ruby:3.3"},
+		{"ruby tool-versions fallback", map[string]string{"Gemfile": "", ".tool-versions": "ruby 3.2.2\n"}, "ruby:3.2"},
+		{"ruby default", map[string]string{"Gemfile": ""}, "ruby:latest"},
+		{"elixir tool-versions", map[string]string{"mix.exs": "", ".tool-versions": "erlang 27.1\nelixir 1.17.3-otp-27\n"}, "elixir:1.17-alpine"},
+		{"deno tool-versions", map[string]string{"deno.json": "", ".tool-versions": "deno 2.1.4\n"}, "denoland/deno:alpine-2.1.4"},
 		{"static no resolver", map[string]string{"index.html": ""}, "alpine:latest"},
 	}
 	for _, c := range cases {
@@ -122,7 +139,7 @@ func TestBuildTwoStagePipeline(t *testing.T) {
 
 	src := writeFiles(t, map[string]string{"go.mod": "module x\n\ngo 1.22\n"})
 
-	if err := c.Build(src, "odac-app-x", "x", nil); err != nil {
+	if err := c.Build(src, "odac-app-x", "x", BuildOptions{}, nil); err != nil {
 		t.Fatal(err)
 	}
 
@@ -181,7 +198,7 @@ func TestBuildCustomDockerfile(t *testing.T) {
 	c := newTestClient(t, f)
 
 	src := writeFiles(t, map[string]string{"Dockerfile": "FROM scratch"})
-	if err := c.Build(src, "custom-img", "x", nil); err != nil {
+	if err := c.Build(src, "custom-img", "x", BuildOptions{}, nil); err != nil {
 		t.Fatal(err)
 	}
 	if len(f.created) != 1 {
@@ -199,7 +216,7 @@ func TestBuildFailureExitCode(t *testing.T) {
 	f.waitCodes["ctr1"] = 2 // compile container fails
 
 	src := writeFiles(t, map[string]string{"go.mod": "module x\n"})
-	err := c.Build(src, "img", "x", nil)
+	err := c.Build(src, "img", "x", BuildOptions{}, nil)
 	if err == nil || err.Error() != "Compilation failed with exit code 2" {
 		t.Errorf("err = %v", err)
 	}
@@ -209,7 +226,7 @@ func TestBuildRejectsUndetectableProject(t *testing.T) {
 	f := newFakeAPI()
 	c := newTestClient(t, f)
 	src := writeFiles(t, map[string]string{"README.md": "x"})
-	err := c.Build(src, "img", "x", nil)
+	err := c.Build(src, "img", "x", BuildOptions{}, nil)
 	if err == nil || !strings.Contains(err.Error(), "Could not detect project type") {
 		t.Errorf("err = %v", err)
 	}
@@ -223,7 +240,7 @@ func TestBuildRejectsParallelSameImage(t *testing.T) {
 	c.mu.Unlock()
 
 	src := writeFiles(t, map[string]string{"Dockerfile": "FROM scratch"})
-	err := c.Build(src, "img", "x", nil)
+	err := c.Build(src, "img", "x", BuildOptions{}, nil)
 	if err == nil || err.Error() != "Build already in progress for img" {
 		t.Errorf("err = %v", err)
 	}
@@ -234,7 +251,7 @@ func TestBuildRejectsUnsafeImageName(t *testing.T) {
 	c := newTestClient(t, f)
 
 	src := writeFiles(t, map[string]string{"Dockerfile": "FROM scratch"})
-	err := c.Build(src, "img;touch /pwned", "x", nil)
+	err := c.Build(src, "img;touch /pwned", "x", BuildOptions{}, nil)
 	if err == nil || !strings.Contains(err.Error(), "Invalid image name") {
 		t.Errorf("err = %v, want Invalid image name", err)
 	}
@@ -251,7 +268,7 @@ func TestBuildSelfCreatedLoggerFinalizes(t *testing.T) {
 	c := New(f, Options{LogsRoot: logsRoot})
 
 	src := writeFiles(t, map[string]string{"Dockerfile": "FROM scratch"})
-	if err := c.Build(src, "img", "myapp", nil); err != nil {
+	if err := c.Build(src, "img", "myapp", BuildOptions{}, nil); err != nil {
 		t.Fatal(err)
 	}
 
@@ -270,3 +287,134 @@ func TestBuildSelfCreatedLoggerFinalizes(t *testing.T) {
 		t.Error("self-created build logger did not write a summary")
 	}
 }
+
+func TestBuildCacheArgsAndSecrets(t *testing.T) {
+	f := newFakeAPI()
+	f.images["node:lts-alpine"] = image.InspectResponse{}
+	f.images[packagerImage] = image.InspectResponse{}
+	f.logOutputs["ctr1"] = "fetching with npm_s3cr3t\n"
+	cacheRoot := t.TempDir()
+	c := New(f, Options{LogsRoot: t.TempDir(), BuildCacheRoot: cacheRoot})
+
+	src := writeFiles(t, map[string]string{"package-lock.json": "", "package.json": "{}"})
+	buildLog := &recordingBuildLog{}
+	opts := BuildOptions{
+		CacheLimit: 1 << 30,
+		Args:       map[string]string{"NODE_ENV": "production"},
+		Secrets:    map[string]string{"NPM_TOKEN": "npm_s3cr3t"},
+	}
+	if err := c.Build(src, "odac-app-web", "web", opts, buildLog); err != nil {
+		t.Fatal(err)
+	}
+
+	compile := f.created[0]
+	cacheDir := filepath.Join(cacheRoot, "web", "node_npm")
+	if binds := compile.HostConfig.Binds; len(binds) != 2 || binds[1] != cacheDir+":/cache" {
+		t.Errorf("compile binds = %v", binds)
+	}
+	env := strings.Join(compile.Config.Env, ",")
+	for _, want := range []string{"npm_config_cache=/cache/npm", "NODE_ENV=production", "NPM_TOKEN=npm_s3cr3t"} {
+		if !strings.Contains(env, want) {
+			t.Errorf("compile env missing %s: %v", want, compile.Config.Env)
+		}
+	}
+	if strings.Contains(buildLog.String(), "npm_s3cr3t") || !strings.Contains(buildLog.String(), "*****") {
+		t.Errorf("secret not masked: %q", buildLog.String())
+	}
+
+	// The packaging step never sees the compile inputs.
+	pack := f.created[1]
+	if len(pack.Config.Env) != 0 || strings.Contains(pack.Config.Cmd[2], "NPM_TOKEN") {
+		t.Errorf("package step got build inputs: %v %q", pack.Config.Env, pack.Config.Cmd[2])
+	}
+
+	// A zero cap builds without the cache mount.
+	f.created = nil
+	if err := c.Build(src, "odac-app-web", "web", BuildOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if binds := f.created[0].HostConfig.Binds; len(binds) != 1 {
+		t.Errorf("uncached binds = %v", binds)
+	}
+}
+
+func TestBuildCustomDockerfileSecrets(t *testing.T) {
+	f := newFakeAPI()
+	f.images[packagerImage] = image.InspectResponse{}
+	c := newTestClient(t, f)
+
+	src := writeFiles(t, map[string]string{"Dockerfile": "FROM scratch"})
+	opts := BuildOptions{Args: map[string]string{"VERSION": "1.2"}, Secrets: map[string]string{"NPM_TOKEN": "npm_s3cr3t"}}
+	if err := c.Build(src, "custom-img", "x", opts, nil); err != nil {
+		t.Fatal(err)
+	}
+	call := f.created[0]
+	want := "docker build --progress=plain --build-arg VERSION --secret id=NPM_TOKEN,env=NPM_TOKEN -t custom-img /app"
+	if got := call.Config.Cmd[2]; got != want {
+		t.Errorf("custom cmd = %q", got)
+	}
+	env := strings.Join(call.Config.Env, ",")
+	if !strings.Contains(env, "NPM_TOKEN=npm_s3cr3t") || !strings.Contains(env, "VERSION=1.2") {
+		t.Errorf("custom env = %v", call.Config.Env)
+	}
+
+	bad := BuildOptions{Secrets: map[string]string{"X;rm -rf /": "v"}}
+	if err := c.Build(src, "custom-img", "x", bad, nil); err == nil || !strings.Contains(err.Error(), "Invalid build variable name") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestBuildCacheTrimAndClear(t *testing.T) {
+	c := New(newFakeAPI(), Options{BuildCacheRoot: t.TempDir()})
+	dir := c.buildCacheDir("web", "NODE_NPM")
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "blob"), make([]byte, 4096), 0o644)
+
+	c.trimBuildCache(dir, 8192, nil)
+	if _, err := os.Stat(filepath.Join(dir, "blob")); err != nil {
+		t.Fatal("cache under the cap was trimmed")
+	}
+	c.trimBuildCache(dir, 1024, nil)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("cache over the cap survived")
+	}
+
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "blob"), make([]byte, 4096), 0o644)
+	if freed, err := c.ClearBuildCache("web"); err != nil || freed != 4096 {
+		t.Fatalf("clear = %d, %v", freed, err)
+	}
+	if _, err := c.ClearBuildCache("../etc"); err == nil {
+		t.Error("traversal name accepted")
+	}
+	if c.buildCacheDir("../etc", "GO") != "" {
+		t.Error("traversal cache dir built")
+	}
+}
+
+func TestVersionedRuntimeImages(t *testing.T) {
+	cases := []struct {
+		files map[string]string
+		want  string
+	}{
+		{map[string]string{"pom.xml": "", ".java-version": "17"}, "eclipse-temurin:17-jre-alpine"},
+		{map[string]string{"build.gradle": ""}, "eclipse-temurin:21-jre-alpine"},
+		{map[string]string{"Api.csproj": "", "global.json": `{"sdk":{"version":"8.0.100"}}`}, "mcr.microsoft.com/dotnet/aspnet:8.0-alpine"},
+		{map[string]string{"Gemfile": "", ".ruby-version": "3.3.0"}, "ruby:3.3-slim"},
+		{map[string]string{"Gemfile": ""}, "ruby:slim"},
+		{map[string]string{"mix.exs": "", ".tool-versions": "elixir 1.17.3\n"}, "alpine:latest"},
+		{map[string]string{"deno.json": "", ".tool-versions": "deno 2.1.4\n"}, "denoland/deno:alpine-2.1.4"},
+		{map[string]string{"go.mod": "module x\n"}, "alpine:latest"},
+	}
+	for _, c := range cases {
+		strategy := detectStrategy(writeFiles(t, c.files))
+		if got := strategy.runtimePackage().baseImage; got != c.want {
+			t.Errorf("%s: runtime image = %q, want %q", strategy.name, got, c.want)
+		}
+	}
+
+	// Resolving never rewrites the shared strategy table.
+	if base := buildStrategies["RUBY"].pkg.baseImage; base != "ruby:slim" {
+		t.Errorf("table base image changed to %q", base)
+	}
+}
@@ -153,6 +153,9 @@ type Client struct {
 	// logsRoot feeds the builder's self-created loggers (<base>/logs).
 	logsRoot string
 
+	// cacheRoot holds the per-app build caches (<base>/cache/build).
+	cacheRoot string
+
 	mu           sync.Mutex
 	activeBuilds map[string]bool
 	buildLoggers map[string]*applog.Logger
@@ -168,6 +171,9 @@ type Options struct {
 	HostRoot string
 	// LogsRoot is where per-app logs live, e.g. <baseDir>/logs.
 	LogsRoot string
+	// BuildCacheRoot is where per-app build caches live, e.g.
+	// <baseDir>/cache/build. Empty disables build caching.
+	BuildCacheRoot string
 }
 
 // Connect builds a Client over the real Docker engine (env-configured, API
@@ -188,6 +194,7 @@ func New(api API, opts Options) *Client {
 		log:          logx.New("Container"),
 		hostRoot:     opts.HostRoot,
 		logsRoot:     opts.LogsRoot,
+		cacheRoot:    opts.BuildCacheRoot,
 		activeBuilds: map[string]bool{},
 		buildLoggers: map[string]*applog.Logger{},
 	}
@@ -14,6 +14,17 @@ import (
 // gitImage is the sandbox image for clone/fetch operations.
 const gitImage = "alpine/git"
 
+// submoduleCmd checks out submodules at the pinned commits after a clone
+// or reset. Repos without a .gitmodules file skip it.
+const submoduleCmd = ` && if [ -f .gitmodules ]; then git submodule sync --recursive && git submodule update --init --recursive --depth 1; fi`
+
+// sshMount is where an app's deploy key directory appears in the sandbox.
+// It holds id_ed25519 and known_hosts; unknown hosts are pinned on first
+// use (accept-new), a changed host key fails the connection.
+const sshMount = "/ssh"
+
+const gitSSHCommand = "ssh -i " + sshMount + "/id_ed25519 -o IdentitiesOnly=yes -o UserKnownHostsFile=" + sshMount + "/known_hosts -o StrictHostKeyChecking=accept-new"
+
 // secureURL injects an oauth2 basic-auth token into an https remote URL.
 func secureURL(url, token string) string {
 	if token != "" && strings.HasPrefix(url, "https://") {
@@ -26,7 +37,8 @@ func secureURL(url, token string) string {
 // targetDir using an isolated, unprivileged alpine/git container. All
 // dynamic values reach the shell only via "$VAR" env expansion, never
 // string interpolation, so quote/metachars in them are not re-parsed.
-func (c *Client) CloneRepo(url, branch, targetDir, token string, buildLog BuildLog) error {
+// sshDir, when set, is the app's deploy key directory for SSH remotes.
+func (c *Client) CloneRepo(url, branch, targetDir, token, sshDir string, buildLog BuildLog) error {
 	if !c.available {
 		return fmt.Errorf("Docker is not available")
 	}
@@ -53,8 +65,9 @@ func (c *Client) CloneRepo(url, branch, targetDir, token string, buildLog BuildL
 		env = append(env, "GIT_BRANCH="+branch)
 		gitCmd = `git clone --depth 1 --branch "$GIT_BRANCH" "$GIT_REMOTE_URL" .`
 	}
+	gitCmd += submoduleCmd
 
-	if err := c.runGitSandbox(gitCmd, env, targetDir, token, buildLog, "clone"); err != nil {
+	if err := c.runGitSandbox(gitCmd, env, targetDir, token, sshDir, buildLog, "clone"); err != nil {
 		c.log.Error("[Git] Clone failed: %s", err.Error())
 		return err
 	}
@@ -65,7 +78,7 @@ func (c *Client) CloneRepo(url, branch, targetDir, token string, buildLog BuildL
 // FetchRepo ports Container.fetchRepo: fetches the branch head (or a
 // pinned commit) into an existing clone and hard-resets to it. For private
 // repos the authenticated URL is set only for the fetch and restored after.
-func (c *Client) FetchRepo(url, branch, targetDir, token, commitSha string, buildLog BuildLog) error {
+func (c *Client) FetchRepo(url, branch, targetDir, token, sshDir, commitSha string, buildLog BuildLog) error {
 	if !c.available {
 		return fmt.Errorf("Docker is not available")
 	}
@@ -105,8 +118,9 @@ func (c *Client) FetchRepo(url, branch, targetDir, token, commitSha string, buil
 	if token != "" {
 		gitCmd = `git remote set-url origin "$GIT_REMOTE_URL" && ` + gitCmd + ` && git remote set-url origin "$GIT_ORIGINAL_URL"`
 	}
+	gitCmd += submoduleCmd
 
-	if err := c.runGitSandbox(gitCmd, env, targetDir, token, buildLog, "fetch"); err != nil {
+	if err := c.runGitSandbox(gitCmd, env, targetDir, token, sshDir, buildLog, "fetch"); err != nil {
 		c.log.Error("[Git] Fetch failed: %s", err.Error())
 		return err
 	}
@@ -114,12 +128,57 @@ func (c *Client) FetchRepo(url, branch, targetDir, token, commitSha string, buil
 	return nil
 }
 
+// RemoteBranchExists asks the remote whether branch still exists, without
+// touching a clone. workDir is only the sandbox's working directory. A
+// network or auth failure is an error, never a missing branch.
+func (c *Client) RemoteBranchExists(url, branch, workDir, token, sshDir string) (bool, error) {
+	if !c.available {
+		return false, fmt.Errorf("Docker is not available")
+	}
+	if err := c.EnsureImage(gitImage, nil); err != nil {
+		return false, err
+	}
+	env := []string{"GIT_REMOTE_URL=" + secureURL(url, token), "GIT_BRANCH=" + branch}
+	gitCmd := `git ls-remote --exit-code --heads "$GIT_REMOTE_URL" "refs/heads/$GIT_BRANCH"`
+	status, err := c.gitSandboxStatus(gitCmd, env, workDir, token, sshDir, nil)
+	if err != nil {
+		return false, err
+	}
+	// ls-remote --exit-code exits 2 when no ref matches.
+	switch status {
+	case 0:
+		return true, nil
+	case 2:
+		return false, nil
+	}
+	return false, fmt.Errorf("Git ls-remote failed with exit code %d.", status)
+}
+
 // runGitSandbox creates and runs one ephemeral alpine/git container with
-// targetDir bind-mounted at /git, streaming (token-sanitized) output into
-// buildLog, and force-removing the container afterwards.
-func (c *Client) runGitSandbox(gitCmd string, env []string, targetDir, token string, buildLog BuildLog, op string) error {
+// targetDir bind-mounted at /git (and sshDir at /ssh), streaming
+// (token-sanitized) output into buildLog, and force-removing the container
+// afterwards.
+func (c *Client) runGitSandbox(gitCmd string, env []string, targetDir, token, sshDir string, buildLog BuildLog, op string) error {
+	status, err := c.gitSandboxStatus(gitCmd, env, targetDir, token, sshDir, buildLog)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		// Node capitalizes the op in the message ("Git clone failed…").
+		return fmt.Errorf("Git %s failed with exit code %d.", op, status)
+	}
+	return nil
+}
+
+// gitSandboxStatus is runGitSandbox without the exit code interpretation.
+func (c *Client) gitSandboxStatus(gitCmd string, env []string, targetDir, token, sshDir string, buildLog BuildLog) (int64, error) {
 	ctx := context.Background()
 	hostPath := c.ResolveHostPath(targetDir)
+	binds := []string{hostPath + ":/git"}
+	if sshDir != "" {
+		binds = append(binds, c.ResolveHostPath(sshDir)+":"+sshMount)
+		env = append(env, "GIT_SSH_COMMAND="+gitSSHCommand)
+	}
 
 	created, err := c.api.ContainerCreate(ctx, &container.Config{
 		Image:      gitImage,
@@ -128,30 +187,22 @@ func (c *Client) runGitSandbox(gitCmd string, env []string, targetDir, token str
 		Env:        env,
 		WorkingDir: "/git",
 	}, &container.HostConfig{
-		Binds:      []string{hostPath + ":/git"},
+		Binds:      binds,
 		Privileged: false, // SECURITY: rootless git
 	}, nil, nil, "")
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer c.api.ContainerRemove(ctx, created.ID, container.RemoveOptions{Force: true})
 
-	status, err := c.runToCompletion(ctx, created.ID, buildLog, token)
-	if err != nil {
-		return err
-	}
-	if status != 0 {
-		// Node capitalizes the op in the message ("Git clone failed…").
-		return fmt.Errorf("Git %s failed with exit code %d.", op, status)
-	}
-	return nil
+	return c.runToCompletion(ctx, created.ID, buildLog, token)
 }
 
 // runToCompletion starts a created container, streams its demuxed output
-// into logw (both streams to the same writer, token occurrences masked)
+// into logw (both streams to the same writer, secret occurrences masked)
 // and waits for its exit code. The wait channel is registered before the
 // start so fast-exiting containers cannot be missed.
-func (c *Client) runToCompletion(ctx context.Context, id string, logw io.Writer, token string) (int64, error) {
+func (c *Client) runToCompletion(ctx context.Context, id string, logw io.Writer, secrets ...string) (int64, error) {
 	waitCh, errCh := c.api.ContainerWait(ctx, id, container.WaitConditionNextExit)
 
 	if err := c.api.ContainerStart(ctx, id, container.StartOptions{}); err != nil {
@@ -163,8 +214,10 @@ func (c *Client) runToCompletion(ctx context.Context, id string, logw io.Writer,
 			ShowStdout: true, ShowStderr: true, Follow: true,
 		}); err == nil {
 			w := logw
-			if token != "" {
-				w = &maskingWriter{w: logw, secret: token}
+			for _, secret := range secrets {
+				if secret != "" {
+					w = &maskingWriter{w: w, secret: secret}
+				}
 			}
 			// Both stdout and stderr land in the same build log, like
 			// Node's #streamContainerLogs single handler.
@@ -6,6 +6,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
@@ -24,9 +25,9 @@ import (
 // This file replaces SSL/Acme.js — the hand-written RFC 8555 client — with
 // golang.org/x/crypto/acme (the PLAN 3.5 decision). Preserved from Node:
 // the EC P-256 account key persisted at <certDir>/acme_account.key (PKCS#8
-// PEM, 0600, regenerated when missing or unreadable), EC P-256 domain keys,
-// CSRs whose CN is the first domain with every domain in the SAN list, and
-// the order flow (per-authorization challenge create → accept → poll →
+// PEM, 0600, regenerated when missing or unreadable), EC P-256 domain keys
+// by default, CSRs whose CN is the first domain with every domain in the SAN
+// list, and the order flow (per-authorization challenge create → accept → poll →
 // best-effort remove, then finalize + certificate download as a PEM chain).
 // The JWS/nonce/directory plumbing Acme.js implemented by hand is the
 // library's job now. Polling budgets: Node polled 30 attempts (~85s) per
@@ -48,24 +49,29 @@ type acmeClient struct {
 	log    *logx.Logger
 }
 
-// newACMEClient ports Acme.create(): load-or-create the account key,
-// discover the directory and register (or retrieve) the account. hc
-// overrides the HTTP client for tests; nil uses the default.
-func newACMEClient(certDir, directoryURL string, hc *http.Client, log *logx.Logger) (acmeOrderer, error) {
-	key, err := loadOrCreateAccountKey(certDir)
+// newACMEClient ports Acme.create(): load-or-create the CA's account key,
+// discover the directory and register (or retrieve) the account, bound to
+// the CA's EAB credentials when it has them. hc overrides the HTTP client
+// for tests; nil uses the default.
+func newACMEClient(certDir string, ca acmeCA, hc *http.Client, log *logx.Logger) (acmeOrderer, error) {
+	key, err := loadOrCreateAccountKey(certDir, ca.Name)
 	if err != nil {
 		return nil, err
 	}
 
 	client := &acme.Client{
 		Key:          key,
-		DirectoryURL: directoryURL,
+		DirectoryURL: ca.Directory,
 		HTTPClient:   hc,
 	}
 
+	account := &acme.Account{}
+	if ca.KID != "" {
+		account.ExternalAccountBinding = &acme.ExternalAccountBinding{KID: ca.KID, Key: ca.HMAC}
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), registerTimeout)
 	defer cancel()
-	_, err = client.Register(ctx, &acme.Account{}, acme.AcceptTOS)
+	_, err = client.Register(ctx, account, acme.AcceptTOS)
 	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
 		return nil, fmt.Errorf("ACME account registration failed: %w", err)
 	}
@@ -73,9 +79,13 @@ func newACMEClient(certDir, directoryURL string, hc *http.Client, log *logx.Logg
 	return &acmeClient{client: client, log: log}, nil
 }
 
-// loadOrCreateAccountKey ports the account-key half of Acme.#init.
-func loadOrCreateAccountKey(certDir string) (*ecdsa.PrivateKey, error) {
+// loadOrCreateAccountKey ports the account-key half of Acme.#init. Each CA
+// has its own account key; Let's Encrypt keeps Node's file name.
+func loadOrCreateAccountKey(certDir, ca string) (*ecdsa.PrivateKey, error) {
 	keyPath := filepath.Join(certDir, "acme_account.key")
+	if ca != "" && ca != "letsencrypt" {
+		keyPath = filepath.Join(certDir, "acme_account."+ca+".key")
+	}
 
 	if raw, err := os.ReadFile(keyPath); err == nil {
 		if block, _ := pem.Decode(raw); block != nil {
@@ -139,7 +149,9 @@ func (a *acmeClient) Order(o orderOpts) (string, error) {
 		}
 
 		// The library computes the RFC 8555 §8 auth values from the account
-		// key thumbprint — what Acme.js derived by hand.
+		// key thumbprint — what Acme.js derived by hand. TLS-ALPN-01 uses
+		// the same key authorization as HTTP-01; the proxy hashes it into
+		// its challenge certificate.
 		var authValue string
 		if o.ChallengeType == "dns-01" {
 			authValue, err = a.client.DNS01ChallengeRecord(challenge.Token)
@@ -184,10 +196,21 @@ func (a *acmeClient) Order(o orderOpts) (string, error) {
 	return string(out), nil
 }
 
-// generateKeyPair ports Acme.generateKeyPair(): an EC P-256 domain key as
-// (PKCS#8 PEM, signer).
-func generateKeyPair() (string, crypto.Signer, error) {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+// generateKeyPair ports Acme.generateKeyPair(): a domain key of keyType
+// (ec256, the default, ec384, rsa2048 or rsa4096) as (PKCS#8 PEM, signer).
+func generateKeyPair(keyType string) (string, crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+	switch keyType {
+	case "ec384":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "rsa2048":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "rsa4096":
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
 	if err != nil {
 		return "", nil, err
 	}
@@ -200,7 +223,7 @@ func generateKeyPair() (string, crypto.Signer, error) {
 }
 
 // createCSR ports Acme.createCsr(): DER-encoded PKCS#10 with CN = first
-// domain and every domain in the SAN extension, signed ECDSA-SHA256.
+// domain and every domain in the SAN extension, signed with the domain key.
 func createCSR(domains []string, key crypto.Signer) ([]byte, error) {
 	if len(domains) == 0 {
 		return nil, errors.New("no domains for CSR")
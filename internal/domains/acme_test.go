@@ -43,6 +43,7 @@ type fakeACME struct {
 	finalized   bool
 	orderDomain []string
 	certDER     [][]byte
+	account     map[string]any // last new-account payload
 }
 
 func newFakeACME(t *testing.T) *fakeACME {
@@ -116,7 +117,12 @@ func (f *fakeACME) nonce(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (f *fakeACME) newAccount(w http.ResponseWriter, _ *http.Request) {
+func (f *fakeACME) newAccount(w http.ResponseWriter, r *http.Request) {
+	var account map[string]any
+	json.Unmarshal(jwsPayload(r), &account)
+	f.mu.Lock()
+	f.account = account
+	f.mu.Unlock()
 	f.head(w)
 	w.Header().Set("Location", f.url("/account/1"))
 	w.WriteHeader(http.StatusCreated)
@@ -247,7 +253,7 @@ func (f *fakeACME) cert(w http.ResponseWriter, _ *http.Request) {
 func TestAccountKeyPersistence(t *testing.T) {
 	dir := t.TempDir()
 
-	k1, err := loadOrCreateAccountKey(dir)
+	k1, err := loadOrCreateAccountKey(dir, "letsencrypt")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -260,7 +266,7 @@ func TestAccountKeyPersistence(t *testing.T) {
 	}
 
 	// Second load returns the SAME key (Node reuses the PEM file).
-	k2, err := loadOrCreateAccountKey(dir)
+	k2, err := loadOrCreateAccountKey(dir, "letsencrypt")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -272,7 +278,7 @@ func TestAccountKeyPersistence(t *testing.T) {
 	if err := os.WriteFile(filepath.Join(dir, "acme_account.key"), []byte("garbage"), 0o600); err != nil {
 		t.Fatal(err)
 	}
-	k3, err := loadOrCreateAccountKey(dir)
+	k3, err := loadOrCreateAccountKey(dir, "letsencrypt")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -282,7 +288,7 @@ func TestAccountKeyPersistence(t *testing.T) {
 }
 
 func TestCSRShape(t *testing.T) {
-	_, key, err := generateKeyPair()
+	_, key, err := generateKeyPair("")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -310,12 +316,12 @@ func TestOrderFlowAgainstFakeServer(t *testing.T) {
 	dir := t.TempDir()
 	log := logx.New("SSL")
 
-	client, err := newACMEClient(dir, fake.url("/directory"), fake.ts.Client(), log)
+	client, err := newACMEClient(dir, acmeCA{Name: "letsencrypt", Directory: fake.url("/directory")}, fake.ts.Client(), log)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, key, err := generateKeyPair()
+	_, key, err := generateKeyPair("")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -374,20 +380,64 @@ func TestOrderFlowAgainstFakeServer(t *testing.T) {
 	}
 
 	// A second client from the same dir reuses the account key.
-	if _, err := newACMEClient(dir, fake.url("/directory"), fake.ts.Client(), log); err != nil {
+	if _, err := newACMEClient(dir, acmeCA{Name: "letsencrypt", Directory: fake.url("/directory")}, fake.ts.Client(), log); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccountBoundWithEAB(t *testing.T) {
+	fake := newFakeACME(t)
+	dir := t.TempDir()
+	ca := acmeCA{Name: "zerossl", Directory: fake.url("/directory"), KID: "kid-1", HMAC: []byte("mac-key")}
+	if _, err := newACMEClient(dir, ca, fake.ts.Client(), logx.New("SSL")); err != nil {
 		t.Fatal(err)
 	}
+
+	fake.mu.Lock()
+	eab, _ := fake.account["externalAccountBinding"].(map[string]any)
+	fake.mu.Unlock()
+	protected, _ := eab["protected"].(string)
+	raw, _ := base64.RawURLEncoding.DecodeString(protected)
+	var header map[string]any
+	json.Unmarshal(raw, &header)
+	if header["kid"] != "kid-1" || header["alg"] != "HS256" {
+		t.Fatalf("EAB header = %v", header)
+	}
+	// Each CA gets its own account key.
+	if _, err := os.Stat(filepath.Join(dir, "acme_account.zerossl.key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "acme_account.key")); !os.IsNotExist(err) {
+		t.Fatalf("Let's Encrypt account key created: %v", err)
+	}
+}
+
+func TestDomainKeyTypes(t *testing.T) {
+	for keyType, want := range map[string]x509.PublicKeyAlgorithm{"": x509.ECDSA, "ec384": x509.ECDSA, "rsa2048": x509.RSA} {
+		_, key, err := generateKeyPair(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := createCSR([]string{"example.com"}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, _ := x509.ParseCertificateRequest(der)
+		if csr.PublicKeyAlgorithm != want || csr.CheckSignature() != nil {
+			t.Errorf("%q: algorithm %v", keyType, csr.PublicKeyAlgorithm)
+		}
+	}
 }
 
 func TestOrderRejectsMissingChallengeType(t *testing.T) {
 	fake := newFakeACME(t)
 	dir := t.TempDir()
 
-	client, err := newACMEClient(dir, fake.url("/directory"), fake.ts.Client(), logx.New("SSL"))
+	client, err := newACMEClient(dir, acmeCA{Name: "letsencrypt", Directory: fake.url("/directory")}, fake.ts.Client(), logx.New("SSL"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, key, _ := generateKeyPair()
+	_, key, _ := generateKeyPair("")
 	csr, _ := createCSR([]string{"example.com"}, key)
 
 	_, err = client.Order(orderOpts{
@@ -0,0 +1,393 @@
+package domains
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"odac/internal/api"
+)
+
+// Access control lives in record["auth"]:
+//
+//	{"realm": "...", "users": {"alice": "<bcrypt>"},
+//	 "rules": [{"path": "/admin", "basic": true, "allow": [...],
+//	            "forward": {"app": "sso", "uri": "/verify", "headers": [...]}}]}
+//
+// The dataplane resolves forward.app to an address when it builds the proxy
+// payload; the proxy enforces the rules.
+
+// authPath normalizes a rule path: "/" by default, "=/x" for an exact match.
+func authPath(raw any) (string, string) {
+	p, _ := raw.(string)
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return "/", ""
+	}
+	if !strings.HasPrefix(strings.TrimPrefix(p, "="), "/") {
+		return "", __("Path must start with / (or =/ for an exact match): %s", p)
+	}
+	return p, ""
+}
+
+func authBlock(record map[string]any) map[string]any {
+	auth, _ := record["auth"].(map[string]any)
+	if auth == nil {
+		auth = map[string]any{}
+		record["auth"] = auth
+	}
+	return auth
+}
+
+// pruneAuth drops rules that no longer restrict anything and the whole
+// block once nothing is left.
+func pruneAuth(record map[string]any) {
+	auth, _ := record["auth"].(map[string]any)
+	if auth == nil {
+		return
+	}
+	rules, _ := auth["rules"].([]any)
+	kept := rules[:0]
+	for _, r := range rules {
+		rule, _ := r.(map[string]any)
+		allow, _ := rule["allow"].([]any)
+		if rule != nil && (truthy(rule["basic"]) || truthy(rule["public"]) || len(allow) > 0 || rule["forward"] != nil) {
+			kept = append(kept, rule)
+		}
+	}
+	if len(kept) == 0 {
+		delete(auth, "rules")
+	} else {
+		auth["rules"] = kept
+	}
+	if users, _ := auth["users"].(map[string]any); len(users) == 0 {
+		delete(auth, "users")
+	}
+	if len(auth) == 0 || (auth["rules"] == nil && auth["users"] == nil) {
+		delete(record, "auth")
+	}
+}
+
+// AuthSet creates or updates the rule for a path. opts carries only the
+// settings to change: basic, public (bool), allow (IPs/CIDRs; empty clears),
+// forward (app id or name; "" clears), uri, headers (forward-auth identity
+// headers) and realm (domain-wide).
+func (d *Domain) AuthSet(domainArg, pathArg, optsArg any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+	path, errMsg := authPath(pathArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	opts, _ := optsArg.(map[string]any)
+	if len(opts) == 0 {
+		return api.Res(false, __("Nothing to change."))
+	}
+
+	var allowList []any
+	_, setAllow := opts["allow"]
+	if setAllow {
+		if allowList, _, errMsg = parseAllow(opts["allow"]); errMsg != "" {
+			return api.Res(false, errMsg)
+		}
+	}
+	var headers []any
+	for _, h := range splitList(opts["headers"]) {
+		if !validHeaderName(h) {
+			return api.Res(false, __("Invalid header name: %s", h))
+		}
+		headers = append(headers, http.CanonicalHeaderKey(h))
+	}
+	forwardApp, setForward := opts["forward"].(string)
+
+	found, appFound := false, true
+	d.cfg.Mutate(func() {
+		record, _ := d.domainsLocked(false)[domain].(map[string]any)
+		if record == nil {
+			return
+		}
+		found = true
+		if setForward && forwardApp != "" {
+			appFound = false
+			apps, _ := d.cfg.Get("apps").([]any)
+			for _, a := range apps {
+				if app, _ := a.(map[string]any); app != nil && (app["id"] == forwardApp || app["name"] == forwardApp) {
+					appFound = true
+					break
+				}
+			}
+			if !appFound {
+				return
+			}
+		}
+
+		auth := authBlock(record)
+		if realm, ok := opts["realm"].(string); ok {
+			if realm == "" {
+				delete(auth, "realm")
+			} else {
+				auth["realm"] = realm
+			}
+		}
+		rules, _ := auth["rules"].([]any)
+		var rule map[string]any
+		for _, r := range rules {
+			if m, _ := r.(map[string]any); m != nil && m["path"] == path {
+				rule = m
+				break
+			}
+		}
+		if rule == nil {
+			rule = map[string]any{"path": path}
+			auth["rules"] = append(rules, rule)
+		}
+		for _, key := range []string{"basic", "public"} {
+			if v, ok := opts[key].(bool); ok {
+				if v {
+					rule[key] = true
+				} else {
+					delete(rule, key)
+				}
+			}
+		}
+		if setAllow {
+			if len(allowList) == 0 {
+				delete(rule, "allow")
+			} else {
+				rule["allow"] = allowList
+			}
+		}
+		switch {
+		case setForward && forwardApp == "":
+			delete(rule, "forward")
+		case setForward:
+			rule["forward"] = map[string]any{"app": forwardApp}
+		}
+		if fwd, _ := rule["forward"].(map[string]any); fwd != nil {
+			if uri, ok := opts["uri"].(string); ok {
+				fwd["uri"] = uri
+			}
+			if headers != nil {
+				fwd["headers"] = headers
+			}
+		}
+		pruneAuth(record)
+		d.cfg.Touch("domains")
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+	if !appFound {
+		return api.Res(false, __("App %s not found.", forwardApp))
+	}
+
+	if d.proxy != nil {
+		d.proxy.SyncConfig()
+	}
+	d.log.Log("Access rule for %s%s updated", domain, path)
+	return api.Res(true, __("Access rule for %s%s updated.", domain, path))
+}
+
+// AuthRemove deletes the rule for a path.
+func (d *Domain) AuthRemove(domainArg, pathArg any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+	path, errMsg := authPath(pathArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+
+	found, removed := false, false
+	d.cfg.Mutate(func() {
+		record, _ := d.domainsLocked(false)[domain].(map[string]any)
+		if record == nil {
+			return
+		}
+		found = true
+		auth, _ := record["auth"].(map[string]any)
+		rules, _ := auth["rules"].([]any)
+		for i, r := range rules {
+			if m, _ := r.(map[string]any); m != nil && m["path"] == path {
+				auth["rules"] = append(rules[:i:i], rules[i+1:]...)
+				removed = true
+				break
+			}
+		}
+		if removed {
+			pruneAuth(record)
+			d.cfg.Touch("domains")
+		}
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+	if !removed {
+		return api.Res(false, __("No access rule for %s%s.", domain, path))
+	}
+
+	if d.proxy != nil {
+		d.proxy.SyncConfig()
+	}
+	d.log.Log("Access rule for %s%s removed", domain, path)
+	return api.Res(true, __("Access rule for %s%s removed.", domain, path))
+}
+
+// AuthUser adds or updates a basic-auth user (the password is stored as a
+// bcrypt hash), or deletes it when remove is true.
+func (d *Domain) AuthUser(domainArg, userArg, passwordArg, remove any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+	user, _ := userArg.(string)
+	user = strings.TrimSpace(user)
+	if user == "" || strings.Contains(user, ":") {
+		return api.Res(false, __("Invalid user name."))
+	}
+
+	var hash []byte
+	if remove != true {
+		password, _ := passwordArg.(string)
+		if len(password) < 8 {
+			return api.Res(false, __("Password must be at least 8 characters."))
+		}
+		var err error
+		if hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost); err != nil {
+			return api.Res(false, err.Error())
+		}
+	}
+
+	found, existed := false, false
+	d.cfg.Mutate(func() {
+		record, _ := d.domainsLocked(false)[domain].(map[string]any)
+		if record == nil {
+			return
+		}
+		found = true
+		auth := authBlock(record)
+		users, _ := auth["users"].(map[string]any)
+		if users == nil {
+			users = map[string]any{}
+			auth["users"] = users
+		}
+		_, existed = users[user]
+		if hash == nil {
+			delete(users, user)
+		} else {
+			users[user] = string(hash)
+		}
+		pruneAuth(record)
+		d.cfg.Touch("domains")
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+	if hash == nil && !existed {
+		return api.Res(false, __("User %s not found on %s.", user, domain))
+	}
+
+	if d.proxy != nil {
+		d.proxy.SyncConfig()
+	}
+	if hash == nil {
+		d.log.Log("Basic-auth user %s removed from %s", user, domain)
+		return api.Res(true, __("User %s removed from %s.", user, domain))
+	}
+	d.log.Log("Basic-auth user %s saved for %s", user, domain)
+	return api.Res(true, __("User %s saved for %s.", user, domain))
+}
+
+// AuthList renders a domain's rules and user names, one per line. Password
+// hashes are never shown.
+func (d *Domain) AuthList(domainArg any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+
+	var found bool
+	var lines, users []string
+	d.cfg.View(func() {
+		record, _ := d.domainsLocked(false)[domain].(map[string]any)
+		if record == nil {
+			return
+		}
+		found = true
+		auth, _ := record["auth"].(map[string]any)
+		rules, _ := auth["rules"].([]any)
+		for _, r := range rules {
+			rule, _ := r.(map[string]any)
+			if rule == nil {
+				continue
+			}
+			var parts []string
+			if truthy(rule["public"]) {
+				parts = append(parts, "public")
+			}
+			if allow, _ := rule["allow"].([]any); len(allow) > 0 {
+				parts = append(parts, "allow "+strings.Join(splitList(allow), ","))
+			}
+			if truthy(rule["basic"]) {
+				parts = append(parts, "basic")
+			}
+			if fwd, _ := rule["forward"].(map[string]any); fwd != nil {
+				uri, _ := fwd["uri"].(string)
+				parts = append(parts, fmt.Sprintf("forward %s%s", str(fwd["app"]), uri))
+			}
+			lines = append(lines, fmt.Sprintf("%s  %s", str(rule["path"]), strings.Join(parts, "  ")))
+		}
+		list, _ := auth["users"].(map[string]any)
+		users = sortedKeys(list)
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+	if len(lines) == 0 && len(users) == 0 {
+		return api.Res(true, __("No access rules on %s.", domain))
+	}
+	sort.Strings(lines)
+	out := __("Access rules for %s:", domain)
+	if len(lines) > 0 {
+		out += "\n" + strings.Join(lines, "\n")
+	}
+	if len(users) > 0 {
+		out += "\n" + __("Users: %s", strings.Join(users, ", "))
+	}
+	return api.Res(true, out)
+}
+
+// splitList reads a comma or space separated string or a JSON array.
+func splitList(v any) []string {
+	var out []string
+	switch x := v.(type) {
+	case string:
+		out = strings.FieldsFunc(x, func(r rune) bool { return r == ',' || r == ' ' })
+	case []any:
+		for _, e := range x {
+			if s := strings.TrimSpace(str(e)); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+func validHeaderName(h string) bool {
+	for _, c := range h {
+		if !(c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return h != ""
+}
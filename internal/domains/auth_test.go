@@ -0,0 +1,117 @@
+package domains
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"odac/internal/api"
+)
+
+func TestAuthSetAndRemove(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{
+		"example.com": map[string]any{"appId": "myapp"},
+	})
+
+	if r := fx.d.AuthSet("example.com", "/admin", map[string]any{"basic": true, "allow": "10.0.0.0/8 203.0.113.7", "realm": "Staff"}); !r.Status {
+		t.Fatalf("set: %v", r.Message)
+	}
+	if r := fx.d.AuthSet("www.example.com", "", map[string]any{"forward": "otherapp", "uri": "/verify", "headers": "remote-user,X-Email"}); !r.Status {
+		t.Fatalf("set forward: %v", r.Message)
+	}
+	auth, _ := fx.domain("example.com")["auth"].(map[string]any)
+	want := map[string]any{
+		"realm": "Staff",
+		"rules": []any{
+			map[string]any{"path": "/admin", "basic": true, "allow": []any{"10.0.0.0/8", "203.0.113.7"}},
+			map[string]any{"path": "/", "forward": map[string]any{"app": "otherapp", "uri": "/verify", "headers": []any{"Remote-User", "X-Email"}}},
+		},
+	}
+	if !reflect.DeepEqual(auth, want) {
+		t.Fatalf("auth = %v", auth)
+	}
+	if fx.proxy.syncCount() != 2 {
+		t.Errorf("proxy syncs = %d", fx.proxy.syncCount())
+	}
+
+	// Clearing everything on a rule drops it.
+	fx.d.AuthSet("example.com", "/admin", map[string]any{"basic": false, "allow": ""})
+	auth, _ = fx.domain("example.com")["auth"].(map[string]any)
+	if rules, _ := auth["rules"].([]any); len(rules) != 1 {
+		t.Fatalf("emptied rule kept: %v", auth)
+	}
+
+	if r := fx.d.AuthRemove("example.com", "/"); !r.Status {
+		t.Fatalf("remove: %v", r.Message)
+	}
+	if _, ok := fx.domain("example.com")["auth"]; ok {
+		t.Error("empty auth block kept")
+	}
+	if r := fx.d.AuthRemove("example.com", "/"); r.Status {
+		t.Error("removing a missing rule succeeded")
+	}
+}
+
+func TestAuthSetRejects(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{
+		"example.com": map[string]any{"appId": "myapp"},
+	})
+
+	cases := map[string]api.Result{
+		"missing domain": fx.d.AuthSet("nope.com", "/", map[string]any{"basic": true}),
+		"bad path":       fx.d.AuthSet("example.com", "admin", map[string]any{"basic": true}),
+		"no options":     fx.d.AuthSet("example.com", "/", nil),
+		"bad allow":      fx.d.AuthSet("example.com", "/", map[string]any{"allow": "not-an-ip"}),
+		"bad header":     fx.d.AuthSet("example.com", "/", map[string]any{"forward": "myapp", "headers": "X:Bad"}),
+		"unknown app":    fx.d.AuthSet("example.com", "/", map[string]any{"forward": "ghost"}),
+	}
+	for name, r := range cases {
+		if r.Status {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	if _, ok := fx.domain("example.com")["auth"]; ok {
+		t.Error("rejected call changed the record")
+	}
+}
+
+func TestAuthUsers(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{
+		"example.com": map[string]any{"appId": "myapp"},
+	})
+
+	if r := fx.d.AuthUser("example.com", "alice", "short", nil); r.Status {
+		t.Error("short password accepted")
+	}
+	if r := fx.d.AuthUser("example.com", "alice", "correct horse", nil); !r.Status {
+		t.Fatalf("add user: %v", r.Message)
+	}
+	auth, _ := fx.domain("example.com")["auth"].(map[string]any)
+	hash, _ := auth["users"].(map[string]any)["alice"].(string)
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte("correct horse")) != nil {
+		t.Fatalf("stored hash does not verify: %q", hash)
+	}
+
+	fx.d.AuthSet("example.com", "/", map[string]any{"basic": true})
+	r := fx.d.AuthList("example.com")
+	msg, _ := r.Message.(string)
+	if !r.Status || !strings.Contains(msg, "/  basic") || !strings.Contains(msg, "Users: alice") || strings.Contains(msg, "$2") {
+		t.Errorf("list = %q", msg)
+	}
+
+	if r = fx.d.AuthUser("example.com", "alice", nil, true); !r.Status {
+		t.Fatalf("delete user: %v", r.Message)
+	}
+	if r = fx.d.AuthUser("example.com", "alice", nil, true); r.Status {
+		t.Error("deleting a missing user succeeded")
+	}
+	auth, _ = fx.domain("example.com")["auth"].(map[string]any)
+	if _, ok := auth["users"]; ok {
+		t.Errorf("empty users kept: %v", auth)
+	}
+}
@@ -0,0 +1,91 @@
+package domains
+
+import (
+	"strings"
+
+	"odac/internal/api"
+)
+
+// Backend sets the protocol the proxy speaks to a domain's app: "http1"
+// (the default), "h2c" or "https". opts is {protocol, insecure, serverName,
+// grpcWeb}; without a protocol it shows the current setting.
+func (d *Domain) Backend(domainArg, optsArg any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+	opts, _ := optsArg.(map[string]any)
+
+	var found bool
+	var current map[string]any
+	d.cfg.View(func() {
+		record, _ := d.domainsLocked(false)[domain].(map[string]any)
+		found = record != nil
+		if b, _ := record["backend"].(map[string]any); b != nil {
+			current = make(map[string]any, len(b))
+			for k, v := range b {
+				current[k] = v
+			}
+		}
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+
+	protocol, _ := opts["protocol"].(string)
+	if protocol == "" {
+		if current == nil {
+			current = map[string]any{"protocol": "http1"}
+		}
+		return api.Res(true, current)
+	}
+
+	var backend map[string]any
+	switch protocol {
+	case "http1":
+		if opts["grpcWeb"] == true || opts["insecure"] == true {
+			return api.Res(false, __("gRPC-Web and --insecure need the h2c or https protocol."))
+		}
+	case "h2c", "https":
+		backend = map[string]any{"protocol": protocol}
+		if opts["grpcWeb"] == true {
+			backend["grpcWeb"] = true
+		}
+		serverName, _ := opts["serverName"].(string)
+		if protocol == "h2c" && (opts["insecure"] == true || serverName != "") {
+			return api.Res(false, __("--insecure and --server-name only apply to https."))
+		}
+		if opts["insecure"] == true {
+			backend["insecure"] = true
+		}
+		if serverName != "" {
+			name, errMsg := validate(serverName)
+			if errMsg != "" {
+				return api.Res(false, errMsg)
+			}
+			backend["serverName"] = name
+		}
+	default:
+		return api.Res(false, __("Invalid protocol %s: use http1, h2c or https.", protocol))
+	}
+
+	d.cfg.Mutate(func() {
+		if record, _ := d.domainsLocked(false)[domain].(map[string]any); record != nil {
+			if backend == nil {
+				delete(record, "backend")
+			} else {
+				record["backend"] = backend
+			}
+			d.cfg.Touch("domains")
+		}
+	})
+	if d.proxy != nil {
+		d.proxy.SyncConfig()
+	}
+	d.log.Log("Backend protocol for %s set to %s", domain, protocol)
+	if backend["insecure"] == true {
+		return api.Res(true, __("%s now reaches its app over %s without verifying its certificate.", domain, protocol))
+	}
+	return api.Res(true, __("%s now reaches its app over %s.", domain, protocol))
+}
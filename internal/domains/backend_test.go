@@ -0,0 +1,46 @@
+package domains
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBackend(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{"example.com": map[string]any{"appId": "myapp"}})
+
+	if r := fx.d.Backend("example.com", nil); !r.Status || !reflect.DeepEqual(r.Data, map[string]any{"protocol": "http1"}) {
+		t.Fatalf("show = %v %v", r.Status, r.Data)
+	}
+	for _, bad := range []map[string]any{
+		{"protocol": "http3"},
+		{"protocol": "h2c", "insecure": true},
+		{"protocol": "http1", "grpcWeb": true},
+		{"protocol": "https", "serverName": "bad/name"},
+	} {
+		if r := fx.d.Backend("example.com", bad); r.Status {
+			t.Errorf("%v accepted", bad)
+		}
+	}
+	if r := fx.d.Backend("missing.com", map[string]any{"protocol": "h2c"}); r.Status {
+		t.Error("unknown domain accepted")
+	}
+
+	if r := fx.d.Backend("example.com", map[string]any{"protocol": "https", "insecure": true, "serverName": "App.Internal", "grpcWeb": true}); !r.Status {
+		t.Fatalf("set failed: %v", r.Message)
+	}
+	want := map[string]any{"protocol": "https", "insecure": true, "serverName": "app.internal", "grpcWeb": true}
+	if got := fx.domain("example.com")["backend"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("backend = %v", got)
+	}
+	if fx.proxy.syncCount() == 0 {
+		t.Error("proxy not synced")
+	}
+
+	if r := fx.d.Backend("example.com", map[string]any{"protocol": "http1"}); !r.Status {
+		t.Fatalf("reset failed: %v", r.Message)
+	}
+	if fx.domain("example.com")["backend"] != nil {
+		t.Error("backend left set")
+	}
+}
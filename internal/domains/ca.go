@@ -0,0 +1,383 @@
+package domains
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+
+	"odac/internal/api"
+)
+
+const secretPrefix = "secret://"
+
+// builtinCAs are the ACME directories known by name. ZeroSSL and Google
+// Trust Services only issue to accounts bound to EAB credentials.
+var builtinCAs = map[string]struct {
+	directory string
+	eab       bool
+}{
+	"letsencrypt": {letsEncryptURL, false},
+	"zerossl":     {"https://acme.zerossl.com/v2/DV90", true},
+	"google":      {"https://dv.acme-v02.api.pki.goog/directory", true},
+}
+
+var (
+	caNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+	keyTypes = []string{"ec256", "ec384", "rsa2048", "rsa4096"}
+)
+
+// acmeCA is a certificate authority resolved for one order.
+type acmeCA struct {
+	Name      string
+	Directory string
+	KID       string // EAB key ID; empty without EAB
+	HMAC      []byte // Decoded EAB MAC key
+}
+
+// rateLimited reports whether the CA refused an order for issuing too
+// much, which is when the next CA in the list is tried.
+func rateLimited(err error) bool {
+	var ae *acme.Error
+	return errors.As(err, &ae) &&
+		(ae.StatusCode == 429 || ae.ProblemType == "urn:ietf:params:acme:error:rateLimited")
+}
+
+// SetSecrets wires the secret store resolving EAB MAC keys. Call it before
+// the first Check.
+func (s *SSL) SetSecrets(r SecretRevealer) { s.secrets = r }
+
+// issuance returns the CAs to try in order and the key type for domain's
+// certificate: the domain's own settings, else the server's, else Let's
+// Encrypt with an EC P-256 key.
+func (s *SSL) issuance(domain string) ([]string, string) {
+	var cas []string
+	var keyType string
+	s.cfg.View(func() {
+		settings := s.cfg.Map("acme")
+		domains, _ := s.cfg.Get("domains").(map[string]any)
+		record, _ := domains[domain].(map[string]any)
+		cert, _ := record["cert"].(map[string]any)
+		for _, m := range []map[string]any{cert, settings} {
+			if list, _ := m["ca"].([]any); len(list) > 0 && cas == nil {
+				for _, v := range list {
+					if name, _ := v.(string); name != "" {
+						cas = append(cas, name)
+					}
+				}
+			}
+			if kt, _ := m["keyType"].(string); kt != "" && keyType == "" {
+				keyType = kt
+			}
+		}
+	})
+	if len(cas) == 0 {
+		cas = []string{"letsencrypt"}
+	}
+	if keyType == "" {
+		keyType = "ec256"
+	}
+	return cas, keyType
+}
+
+// loadCA resolves a CA name to its directory and EAB credentials.
+func (s *SSL) loadCA(name string) (acmeCA, error) {
+	var directory, kid, hmacRef string
+	s.cfg.View(func() {
+		cas, _ := s.cfg.Map("acme")["cas"].(map[string]any)
+		entry, _ := cas[name].(map[string]any)
+		directory, _ = entry["directory"].(string)
+		eab, _ := entry["eab"].(map[string]any)
+		kid, _ = eab["kid"].(string)
+		hmacRef, _ = eab["hmacKey"].(string)
+	})
+	builtin, isBuiltin := builtinCAs[name]
+	switch {
+	case name == "letsencrypt":
+		directory = acmeDirectory()
+	case isBuiltin:
+		directory = builtin.directory
+	case directory == "":
+		return acmeCA{}, errors.New(__("Unknown certificate authority %s.", name))
+	}
+
+	ca := acmeCA{Name: name, Directory: directory}
+	if kid == "" {
+		if builtin.eab {
+			return acmeCA{}, errors.New(__("%s needs EAB credentials: odac ssl ca add %s --eab-kid <kid> --eab-hmac secret://<name>", name, name))
+		}
+		return ca, nil
+	}
+	if s.secrets == nil {
+		return acmeCA{}, errors.New(__("The secret store is not available to read the EAB key of %s.", name))
+	}
+	raw, err := s.secrets.Reveal(strings.TrimPrefix(hmacRef, secretPrefix))
+	if err != nil {
+		return acmeCA{}, errors.New(__("Failed to read the EAB key of %s: %s", name, err.Error()))
+	}
+	raw = strings.TrimRight(strings.TrimSpace(raw), "=")
+	key, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		key, err = base64.RawStdEncoding.DecodeString(raw)
+	}
+	if err != nil || len(key) == 0 {
+		return acmeCA{}, errors.New(__("The EAB key of %s is not base64.", name))
+	}
+	ca.KID, ca.HMAC = kid, key
+	return ca, nil
+}
+
+// client opens an ACME account with the named CA.
+func (s *SSL) client(name string) (acmeOrderer, error) {
+	ca, err := s.loadCA(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.newClient(ca)
+}
+
+// CAAdd registers an ACME certificate authority, or sets the EAB
+// credentials of a built-in one. opts is {directory, kid, hmacKey}; the
+// MAC key must be a secret:// reference so it never lands in the config.
+func (s *SSL) CAAdd(nameArg, optsArg any) api.Result {
+	name, _ := nameArg.(string)
+	name = strings.ToLower(strings.TrimSpace(name))
+	opts, _ := optsArg.(map[string]any)
+	directory, _ := opts["directory"].(string)
+	kid, _ := opts["kid"].(string)
+	hmacKey, _ := opts["hmacKey"].(string)
+
+	if !caNameRe.MatchString(name) {
+		return api.Res(false, __("Invalid CA name. Use up to 32 lowercase letters, digits and hyphens."))
+	}
+	if _, builtin := builtinCAs[name]; builtin {
+		if directory != "" {
+			return api.Res(false, __("%s is a built-in CA: only its EAB credentials can be set.", name))
+		}
+	} else if u, err := url.Parse(directory); err != nil || u.Scheme != "https" || u.Host == "" {
+		return api.Res(false, __("A CA needs the https:// URL of its ACME directory."))
+	}
+	if (kid == "") != (hmacKey == "") {
+		return api.Res(false, __("EAB needs both a key ID and a MAC key."))
+	}
+	if hmacKey != "" && (!strings.HasPrefix(hmacKey, secretPrefix) || len(hmacKey) == len(secretPrefix)) {
+		return api.Res(false, __("Store the EAB MAC key as a secret and pass it as secret://<name>."))
+	}
+
+	entry := map[string]any{}
+	if directory != "" {
+		entry["directory"] = directory
+	}
+	if kid != "" {
+		entry["eab"] = map[string]any{"kid": kid, "hmacKey": hmacKey}
+	}
+	s.cfg.Mutate(func() {
+		settings := s.cfg.Map("acme")
+		if settings == nil {
+			settings = map[string]any{}
+		}
+		cas, _ := settings["cas"].(map[string]any)
+		if cas == nil {
+			cas = map[string]any{}
+			settings["cas"] = cas
+		}
+		cas[name] = entry
+		s.cfg.Set("acme", settings)
+	})
+	s.log.Log("Certificate authority %s saved", name)
+	return api.Res(true, __("Certificate authority %s saved.", name))
+}
+
+// CADelete removes a CA, or the EAB credentials of a built-in one. A CA
+// still listed in the server's or a domain's settings is kept.
+func (s *SSL) CADelete(nameArg any) api.Result {
+	name, _ := nameArg.(string)
+	var users []string
+	found := false
+	s.cfg.Mutate(func() {
+		settings := s.cfg.Map("acme")
+		cas, _ := settings["cas"].(map[string]any)
+		if _, found = cas[name]; !found {
+			return
+		}
+		if listContains(settings["ca"], name) {
+			users = append(users, __("the server default"))
+		}
+		domains, _ := s.cfg.Get("domains").(map[string]any)
+		for _, domain := range sortedKeys(domains) {
+			record, _ := domains[domain].(map[string]any)
+			cert, _ := record["cert"].(map[string]any)
+			if listContains(cert["ca"], name) {
+				users = append(users, domain)
+			}
+		}
+		if len(users) > 0 {
+			return
+		}
+		delete(cas, name)
+		s.cfg.Touch("acme")
+	})
+	if !found {
+		return api.Res(false, __("Certificate authority %s not found.", name))
+	}
+	if len(users) > 0 {
+		return api.Res(false, __("Certificate authority %s is still used by: %s", name, strings.Join(users, ", ")))
+	}
+	s.log.Log("Certificate authority %s removed", name)
+	return api.Res(true, __("Certificate authority %s removed.", name))
+}
+
+// CAs lists the built-in and registered CAs. EAB credentials show as their
+// key ID only.
+func (s *SSL) CAs() api.Result {
+	rows := []any{}
+	s.cfg.View(func() {
+		settings := s.cfg.Map("acme")
+		cas, _ := settings["cas"].(map[string]any)
+		defaults, _ := settings["ca"].([]any)
+		if len(defaults) == 0 {
+			defaults = []any{"letsencrypt"}
+		}
+		names := sortedKeys(cas)
+		for name := range builtinCAs {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			entry, _ := cas[name].(map[string]any)
+			eab, _ := entry["eab"].(map[string]any)
+			directory, _ := entry["directory"].(string)
+			if builtin, ok := builtinCAs[name]; ok {
+				directory = builtin.directory
+			}
+			kid, _ := eab["kid"].(string)
+			rows = append(rows, map[string]any{
+				"name":      name,
+				"directory": directory,
+				"eab":       kid,
+				"default":   listContains(defaults, name),
+			})
+		}
+	})
+	return api.Res(true, rows)
+}
+
+// Settings shows or changes which CAs issue a domain's certificate, in the
+// order they are tried, and its key type. An empty domain is the server
+// default. opts is {ca: [names], keyType}; an empty list or "" goes back to
+// the default. Takes effect at the next issuance.
+func (s *SSL) Settings(domainArg, optsArg any) api.Result {
+	domain := ""
+	if raw, _ := domainArg.(string); raw != "" {
+		var errMsg string
+		if domain, errMsg = validate(raw); errMsg != "" {
+			return api.Res(false, errMsg)
+		}
+		domain = strings.TrimPrefix(domain, "www.")
+	}
+	opts, _ := optsArg.(map[string]any)
+
+	var found bool
+	var parent string
+	s.cfg.View(func() {
+		if domain == "" {
+			found = true
+			return
+		}
+		domains, _ := s.cfg.Get("domains").(map[string]any)
+		record, _ := domains[domain].(map[string]any)
+		found = record != nil
+		parent, _ = record["wildcard"].(string)
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+	if parent != "" {
+		return api.Res(false, __("Domain %s is served by the wildcard certificate of %s. Change the settings there.", domain, parent))
+	}
+
+	rawCA, setCA := opts["ca"]
+	keyType, setKey := opts["keyType"].(string)
+	if !setCA && !setKey {
+		cas, kt := s.issuance(domain)
+		return api.Res(true, map[string]any{"ca": cas, "keyType": kt})
+	}
+
+	var cas []any
+	if setCA {
+		var list []any
+		switch v := rawCA.(type) {
+		case []any:
+			list = v
+		case string:
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					list = append(list, name)
+				}
+			}
+		}
+		for _, v := range list {
+			name, _ := v.(string)
+			name = strings.ToLower(name)
+			if _, err := s.loadCA(name); err != nil {
+				return api.Res(false, err.Error())
+			}
+			if !listContains(cas, name) {
+				cas = append(cas, name)
+			}
+		}
+	}
+	if setKey && keyType != "" && !slices.Contains(keyTypes, keyType) {
+		return api.Res(false, __("Invalid key type %s: use %s.", keyType, strings.Join(keyTypes, ", ")))
+	}
+
+	s.cfg.Mutate(func() {
+		var target map[string]any
+		if domain == "" {
+			target = s.cfg.Map("acme")
+			if target == nil {
+				target = map[string]any{}
+				s.cfg.Set("acme", target)
+			}
+			s.cfg.Touch("acme")
+		} else {
+			domains, _ := s.cfg.Get("domains").(map[string]any)
+			record, _ := domains[domain].(map[string]any)
+			if record == nil {
+				return
+			}
+			target, _ = record["cert"].(map[string]any)
+			if target == nil {
+				target = map[string]any{}
+				record["cert"] = target
+			}
+			s.cfg.Touch("domains")
+		}
+		if setCA {
+			if len(cas) == 0 {
+				delete(target, "ca")
+			} else {
+				target["ca"] = cas
+			}
+		}
+		if setKey {
+			if keyType == "" {
+				delete(target, "keyType")
+			} else {
+				target["keyType"] = keyType
+			}
+		}
+	})
+
+	if domain == "" {
+		return api.Res(true, __("Default certificate settings saved. They apply to new certificates and renewals."))
+	}
+	return api.Res(true, __("Certificate settings of %s saved. Run odac ssl renew -d %s to apply them now.", domain, domain))
+}
@@ -0,0 +1,173 @@
+package domains
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+)
+
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) Reveal(name string) (string, error) {
+	if v, ok := f[name]; ok {
+		return v, nil
+	}
+	return "", errors.New("secret not found")
+}
+
+func TestTLSALPN01ChallengeCallbacksUseProxy(t *testing.T) {
+	fx := newSSLFixture(t)
+	fx.orderer.handler = func(_ int, o orderOpts) (string, error) {
+		if o.ChallengeType != "tls-alpn-01" {
+			return "", errors.New("connection refused on port 80")
+		}
+		if err := o.ChallengeCreate("example.com", "tls-alpn-01", "tok", "tok.thumb"); err != nil {
+			return "", err
+		}
+		o.ChallengeRemove("example.com", "tls-alpn-01", "tok", "tok.thumb")
+		return "mock-certificate", nil
+	}
+	fx.setDomains(map[string]any{"example.com": certRecord(nowMs()+1000, "", "")})
+
+	fx.s.Renew("example.com")
+	fx.waitIdle(t)
+
+	fx.proxy.mu.Lock()
+	defer fx.proxy.mu.Unlock()
+	if !reflect.DeepEqual(fx.proxy.alpnCalls, [][2]string{{"example.com", "tok.thumb"}}) || !reflect.DeepEqual(fx.proxy.alpnDels, []string{"example.com"}) {
+		t.Fatalf("set = %v, delete = %v", fx.proxy.alpnCalls, fx.proxy.alpnDels)
+	}
+	if calls := fx.orderer.callList(); len(calls) != 2 {
+		t.Fatalf("%d orders, want http-01 then tls-alpn-01", len(calls))
+	}
+}
+
+func TestCAFallbackOnRateLimit(t *testing.T) {
+	fx := newSSLFixture(t)
+	if r := fx.s.CAAdd("internal", map[string]any{"directory": "https://ca.internal/acme/acme/directory"}); !r.Status {
+		t.Fatal(r.Message)
+	}
+	fx.setDomains(map[string]any{"expired.com": certRecord(nowMs()-100000, "", "")})
+	if r := fx.s.Settings("expired.com", map[string]any{"ca": "letsencrypt, internal", "keyType": "rsa2048"}); !r.Status {
+		t.Fatal(r.Message)
+	}
+	fx.orderer.handler = func(call int, o orderOpts) (string, error) {
+		if call == 1 {
+			return "", &acme.Error{StatusCode: 429, ProblemType: "urn:ietf:params:acme:error:rateLimited"}
+		}
+		csr, err := x509.ParseCertificateRequest(o.CSR)
+		if err != nil || csr.PublicKeyAlgorithm != x509.RSA {
+			return "", errors.New("CSR without an RSA key")
+		}
+		return "mock-certificate", nil
+	}
+
+	fx.s.Check()
+	fx.waitIdle(t)
+
+	// The rate limit skips the other challenge types and moves to the next CA.
+	if calls := fx.orderer.callList(); len(calls) != 2 || calls[1].ChallengeType != "http-01" {
+		t.Fatalf("calls = %d", len(calls))
+	}
+	fx.clientMu.Lock()
+	cas := fx.clientCAs
+	fx.clientMu.Unlock()
+	if len(cas) != 2 || cas[0].Name != "letsencrypt" || cas[1].Name != "internal" || cas[1].Directory != "https://ca.internal/acme/acme/directory" {
+		t.Fatalf("clients = %+v", cas)
+	}
+	ssl, _ := fx.domain("expired.com")["cert"].(map[string]any)["ssl"].(map[string]any)
+	if ssl["issuer"] != "internal" {
+		t.Fatalf("ssl = %v", ssl)
+	}
+}
+
+func TestCAOtherErrorsDoNotFallBack(t *testing.T) {
+	fx := newSSLFixture(t)
+	fx.s.CAAdd("internal", map[string]any{"directory": "https://ca.internal/directory"})
+	fx.setDomains(map[string]any{"expired.com": certRecord(nowMs()-100000, "", "")})
+	fx.s.Settings("", map[string]any{"ca": []any{"letsencrypt", "internal"}})
+	fx.orderer.handler = func(int, orderOpts) (string, error) { return "", errors.New("unauthorized") }
+
+	fx.s.Check()
+	fx.waitIdle(t)
+
+	fx.clientMu.Lock()
+	defer fx.clientMu.Unlock()
+	if len(fx.clientCAs) != 1 || fx.clientCAs[0].Name != "letsencrypt" {
+		t.Fatalf("clients = %+v", fx.clientCAs)
+	}
+}
+
+func TestCASettings(t *testing.T) {
+	fx := newSSLFixture(t)
+	fx.setDomains(map[string]any{"example.com": certRecord(nowMs()+1000, "", "")})
+
+	for name, args := range map[string][2]any{
+		"bad name":         {"Zero SSL", map[string]any{"directory": "https://x.test/dir"}},
+		"no directory":     {"custom", map[string]any{}},
+		"plain http":       {"custom", map[string]any{"directory": "http://x.test/dir"}},
+		"builtin override": {"zerossl", map[string]any{"directory": "https://x.test/dir"}},
+		"kid alone":        {"zerossl", map[string]any{"kid": "kid-1"}},
+		"raw MAC key":      {"zerossl", map[string]any{"kid": "kid-1", "hmacKey": "c2VjcmV0"}},
+	} {
+		if r := fx.s.CAAdd(args[0], args[1]); r.Status {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	// Built-ins needing EAB are refused until they have credentials.
+	if r := fx.s.Settings("example.com", map[string]any{"ca": []any{"zerossl"}}); r.Status || !strings.Contains(r.Message.(string), "EAB") {
+		t.Errorf("zerossl without EAB: %v", r.Message)
+	}
+	if r := fx.s.Settings("example.com", map[string]any{"ca": []any{"nope"}}); r.Status {
+		t.Error("unknown CA accepted")
+	}
+	if r := fx.s.Settings("example.com", map[string]any{"keyType": "dsa"}); r.Status {
+		t.Error("unknown key type accepted")
+	}
+
+	mac := base64.RawURLEncoding.EncodeToString([]byte("mac-key-bytes"))
+	fx.s.SetSecrets(fakeSecrets{"zerossl-mac": mac})
+	if r := fx.s.CAAdd("zerossl", map[string]any{"kid": "kid-1", "hmacKey": "secret://zerossl-mac"}); !r.Status {
+		t.Fatal(r.Message)
+	}
+	ca, err := fx.s.loadCA("zerossl")
+	if err != nil || ca.KID != "kid-1" || string(ca.HMAC) != "mac-key-bytes" || ca.Directory != "https://acme.zerossl.com/v2/DV90" {
+		t.Fatalf("loadCA = %+v, %v", ca, err)
+	}
+
+	if r := fx.s.Settings("", map[string]any{"keyType": "ec384"}); !r.Status {
+		t.Fatal(r.Message)
+	}
+	if r := fx.s.Settings("example.com", map[string]any{"ca": []any{"zerossl", "letsencrypt"}}); !r.Status {
+		t.Fatal(r.Message)
+	}
+	r := fx.s.Settings("example.com", nil)
+	if want := map[string]any{"ca": []string{"zerossl", "letsencrypt"}, "keyType": "ec384"}; !reflect.DeepEqual(r.Data, want) {
+		t.Fatalf("settings = %v", r.Data)
+	}
+
+	if r := fx.s.CADelete("zerossl"); r.Status || !strings.Contains(r.Message.(string), "example.com") {
+		t.Errorf("CA in use deleted: %v", r.Message)
+	}
+	rows, _ := fx.s.CAs().Data.([]any)
+	if len(rows) != 3 {
+		t.Fatalf("rows = %v", rows)
+	}
+	if z := rows[2].(map[string]any); z["name"] != "zerossl" || z["eab"] != "kid-1" || z["default"] != false {
+		t.Errorf("zerossl row = %v", z)
+	}
+
+	fx.s.Settings("example.com", map[string]any{"ca": []any{}})
+	if cas, _ := fx.s.issuance("example.com"); !reflect.DeepEqual(cas, []string{"letsencrypt"}) {
+		t.Errorf("reset CA list = %v", cas)
+	}
+	if r := fx.s.CADelete("zerossl"); !r.Status {
+		t.Errorf("delete: %v", r.Message)
+	}
+}
@@ -0,0 +1,164 @@
+package domains
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"odac/internal/api"
+)
+
+// maxCacheKeyNames bounds each list of a cache key policy.
+const maxCacheKeyNames = 32
+
+// Cache sets what tells a domain's cached pages apart beyond path and Vary.
+// opts is {ignoreQuery, query, cookies, headers, device, debug}, replacing
+// the whole policy, or {reset}; without options it shows the current one.
+func (d *Domain) Cache(domainArg, optsArg any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+	opts, _ := optsArg.(map[string]any)
+
+	var found bool
+	var current map[string]any
+	d.cfg.View(func() {
+		record, _ := d.domainsLocked(false)[domain].(map[string]any)
+		found = record != nil
+		if k, _ := record["cacheKey"].(map[string]any); k != nil {
+			current = copyShallow(k)
+		}
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+	if len(opts) == 0 {
+		if current == nil {
+			return api.Res(true, __("%s caches pages by path and Vary only; URLs with a query string are not cached.", domain))
+		}
+		return api.Res(true, current)
+	}
+
+	var policy map[string]any
+	if opts["reset"] != true {
+		var errMsg string
+		if policy, errMsg = cacheKeyPolicy(opts); errMsg != "" {
+			return api.Res(false, errMsg)
+		}
+	}
+
+	d.cfg.Mutate(func() {
+		if record, _ := d.domainsLocked(false)[domain].(map[string]any); record != nil {
+			if len(policy) == 0 {
+				delete(record, "cacheKey")
+			} else {
+				record["cacheKey"] = policy
+			}
+			d.cfg.Touch("domains")
+		}
+	})
+	if d.proxy != nil {
+		d.proxy.SyncConfig()
+	}
+	if len(policy) == 0 {
+		d.log.Log("Page cache key for %s reset", domain)
+		return api.Res(true, __("%s caches pages by path and Vary only again.", domain))
+	}
+	d.log.Log("Page cache key for %s updated", domain)
+	return api.Res(true, __("Page cache key for %s updated.", domain))
+}
+
+// cacheKeyPolicy validates the options of Cache into the stored policy.
+func cacheKeyPolicy(opts map[string]any) (map[string]any, string) {
+	policy := map[string]any{}
+	for _, field := range []string{"query", "device", "debug"} {
+		if opts[field] == true {
+			policy[field] = true
+		}
+	}
+
+	ignore, errMsg := cacheKeyNames(opts["ignoreQuery"], func(name string) bool {
+		name = strings.TrimSuffix(name, "*")
+		return name != "" && !strings.ContainsAny(name, "&=#*? ")
+	})
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	cookies, errMsg := cacheKeyNames(opts["cookies"], validToken)
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	headers, errMsg := cacheKeyNames(opts["headers"], func(name string) bool {
+		switch strings.ToLower(name) {
+		case "authorization", "cookie", "host", "accept-encoding":
+			return false
+		}
+		return validToken(name)
+	})
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	var canonical []any
+	for _, h := range headers {
+		if h = http.CanonicalHeaderKey(h.(string)); !listContains(canonical, h.(string)) {
+			canonical = append(canonical, h)
+		}
+	}
+
+	for field, list := range map[string][]any{"ignoreQuery": ignore, "cookies": cookies, "headers": canonical} {
+		if len(list) > 0 {
+			policy[field] = list
+		}
+	}
+	return policy, ""
+}
+
+// cacheKeyNames reads one list of names, from a list or a comma separated
+// string, dropping duplicates.
+func cacheKeyNames(v any, valid func(string) bool) ([]any, string) {
+	var raw []string
+	switch x := v.(type) {
+	case []any:
+		for _, item := range x {
+			raw = append(raw, str(item))
+		}
+	case []string:
+		raw = x
+	case string:
+		raw = strings.Split(x, ",")
+	}
+	var names []any
+	for _, name := range raw {
+		name = strings.TrimSpace(name)
+		if name == "" || listContains(names, name) {
+			continue
+		}
+		if len(name) > 128 || !valid(name) {
+			return nil, __("Invalid name in the cache key: %s", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) > maxCacheKeyNames {
+		return nil, __("A cache key list takes at most %s names.", strconv.Itoa(maxCacheKeyNames))
+	}
+	return names, ""
+}
+
+// validToken reports whether s is an HTTP token, as header and cookie names
+// must be.
+func validToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package domains
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{"example.com": map[string]any{"appId": "myapp"}})
+
+	if r := fx.d.Cache("example.com", nil); !r.Status || r.Data != nil {
+		t.Fatalf("show = %v %v", r.Status, r.Data)
+	}
+	for _, bad := range []map[string]any{
+		{"ignoreQuery": []any{"utm_*", "a=b"}},
+		{"ignoreQuery": "*"},
+		{"cookies": []any{"bad name"}},
+		{"headers": []any{"Authorization"}},
+		{"headers": "Cookie"},
+	} {
+		if r := fx.d.Cache("example.com", bad); r.Status {
+			t.Errorf("%v accepted", bad)
+		}
+	}
+	if r := fx.d.Cache("missing.com", map[string]any{"query": true}); r.Status {
+		t.Error("unknown domain accepted")
+	}
+
+	r := fx.d.Cache("www.example.com", map[string]any{
+		"ignoreQuery": []any{"utm_*", "fbclid", "utm_*"},
+		"query":       true,
+		"cookies":     "currency, lang",
+		"headers":     []any{"accept-language", "Accept-Language"},
+		"device":      true,
+		"debug":       false,
+	})
+	if !r.Status {
+		t.Fatalf("set failed: %v", r.Message)
+	}
+	want := map[string]any{
+		"ignoreQuery": []any{"utm_*", "fbclid"},
+		"query":       true,
+		"cookies":     []any{"currency", "lang"},
+		"headers":     []any{"Accept-Language"},
+		"device":      true,
+	}
+	if got := fx.domain("example.com")["cacheKey"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("cacheKey = %v", got)
+	}
+	if r := fx.d.Cache("example.com", nil); !reflect.DeepEqual(r.Data, want) {
+		t.Errorf("show = %v", r.Data)
+	}
+	if fx.proxy.syncCount() == 0 {
+		t.Error("proxy not synced")
+	}
+
+	if r := fx.d.Cache("example.com", map[string]any{"reset": true}); !r.Status {
+		t.Fatalf("reset failed: %v", r.Message)
+	}
+	if fx.domain("example.com")["cacheKey"] != nil {
+		t.Error("cacheKey left set")
+	}
+}
@@ -32,12 +32,15 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"odac/internal/api"
 	"odac/internal/config"
 	"odac/internal/dataplane"
+	"odac/internal/firewall"
 	"odac/internal/lang"
 	"odac/internal/logx"
 	"odac/internal/netmode"
@@ -60,6 +63,8 @@ type ProxyService interface {
 	SyncConfig()
 	SetACMEChallenge(token, keyAuthorization string) error
 	DeleteACMEChallenge(token string)
+	SetTLSALPNChallenge(domain, keyAuthorization string) error
+	DeleteTLSALPNChallenge(domain string)
 }
 
 // MailService clears the mail binary's per-domain TLS cache after cert
@@ -74,6 +79,17 @@ type Renewer interface {
 	Renew(domain any) api.Result
 }
 
+// Alerter receives renewal failures; *alert.Alerter implements it.
+type Alerter interface {
+	Alert(kind, subject, message string, value float64)
+}
+
+// SecretRevealer resolves secret:// references (EAB MAC keys);
+// *secrets.Store implements it.
+type SecretRevealer interface {
+	Reveal(name string) (string, error)
+}
+
 // Domain is the Domain.js singleton. All collaborators are nil-tolerant,
 // like the Node registry which never resolves a missing module.
 type Domain struct {
@@ -83,6 +99,9 @@ type Domain struct {
 	ssl   Renewer
 	proxy ProxyService
 	mail  MailService
+
+	mu     sync.Mutex
+	issued map[string][]time.Time // on-demand certificates per app, last hour
 }
 
 // NewDomain wires the manager. baseDir-derived paths come from cfg.
@@ -163,7 +182,7 @@ func (d *Domain) Add(domainArg, appID any) api.Result {
 	// read lock. targetName is the app the domain binds to.
 	var exists, found, targetHostNet bool
 	var targetName string
-	var parentDomain, sub string
+	var parentDomain, sub, wildcardParent string
 	var subAlready bool
 	d.cfg.View(func() {
 		domains := d.domainsLocked(false)
@@ -200,6 +219,18 @@ func (d *Domain) Add(domainArg, appID any) api.Result {
 				break
 			}
 		}
+		if parentDomain != "" {
+			return
+		}
+
+		// One level under another app's domain that holds a '*' wildcard:
+		// the wildcard CNAME and certificate already cover the host.
+		if dot := strings.IndexByte(domain, '.'); dot > 0 {
+			record, _ := domains[domain[dot+1:]].(map[string]any)
+			if record != nil && listContains(record["subdomain"], "*") {
+				wildcardParent = domain[dot+1:]
+			}
+		}
 	})
 
 	if exists {
@@ -248,6 +279,24 @@ func (d *Domain) Add(domainArg, appID any) api.Result {
 		return api.Res(true, __("Added %s as a subdomain of %s.", domain, parentDomain))
 	}
 
+	if wildcardParent != "" {
+		d.cfg.Mutate(func() {
+			d.domainsLocked(true)[domain] = map[string]any{
+				"appId":     targetName,
+				"created":   float64(time.Now().UnixMilli()),
+				"subdomain": []any{},
+				"cert":      false,
+				"wildcard":  wildcardParent,
+			}
+			d.cfg.Touch("domains")
+		})
+		d.log.Log("Domain %s added to app %s under the wildcard of %s", domain, targetName, wildcardParent)
+		if d.proxy != nil {
+			d.proxy.SyncConfig()
+		}
+		return api.Res(true, __("Domain %s added to app %s.", domain, targetName))
+	}
+
 	isLocalOrIP := domain == "localhost" || ipv4Re.MatchString(domain)
 	isWildcard := strings.HasPrefix(domain, "*.")
 
@@ -335,7 +384,7 @@ func (d *Domain) Delete(domainArg any, skipSync bool) api.Result {
 	}
 
 	// Snapshot what we need under the read lock.
-	var isMain bool
+	var isMain, covered bool
 	var recordAppID any
 	var dkimSelector string
 	var parentDomain, sub string
@@ -346,6 +395,7 @@ func (d *Domain) Delete(domainArg any, skipSync bool) api.Result {
 			isMain = true
 			if record != nil {
 				recordAppID = record["appId"]
+				_, covered = record["wildcard"].(string)
 				cert, _ := record["cert"].(map[string]any)
 				dkim, _ := cert["dkim"].(map[string]any)
 				dkimSelector, _ = dkim["selector"].(string)
@@ -367,7 +417,7 @@ func (d *Domain) Delete(domainArg any, skipSync bool) api.Result {
 	})
 
 	if isMain {
-		if domain != "localhost" && !ipv4Re.MatchString(domain) {
+		if domain != "localhost" && !ipv4Re.MatchString(domain) && !covered {
 			if dkimSelector == "" {
 				dkimSelector = "default"
 			}
@@ -483,6 +533,98 @@ func (d *Domain) DeleteByApp(appID string) error {
 	return nil
 }
 
+// Maintenance switches a domain's maintenance page on or off. allow (a
+// comma-separated string or list of IPs/CIDR ranges) and retryAfter
+// (seconds) replace the stored values when given; both survive switching
+// off so the next --on reuses them.
+func (d *Domain) Maintenance(domainArg, on, allow, retryAfter any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+
+	allowList, setAllow, errMsg := parseAllow(allow)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+
+	retry := 0
+	switch v := retryAfter.(type) {
+	case float64:
+		retry = int(v)
+	case string:
+		if v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return api.Res(false, __("Invalid Retry-After seconds: %s", v))
+			}
+			retry = n
+		}
+	}
+
+	enabled := on == true
+	found := false
+	d.cfg.Mutate(func() {
+		record, _ := d.domainsLocked(false)[domain].(map[string]any)
+		if record == nil {
+			return
+		}
+		found = true
+		m, _ := record["maintenance"].(map[string]any)
+		if m == nil {
+			m = map[string]any{}
+			record["maintenance"] = m
+		}
+		m["enabled"] = enabled
+		if setAllow {
+			m["allow"] = allowList
+		}
+		if retry > 0 {
+			m["retryAfter"] = float64(retry)
+		}
+		d.cfg.Touch("domains")
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+
+	if d.proxy != nil {
+		d.proxy.SyncConfig()
+	}
+	if enabled {
+		d.log.Log("Maintenance mode enabled for %s", domain)
+		return api.Res(true, __("Maintenance mode enabled for %s.", domain))
+	}
+	d.log.Log("Maintenance mode disabled for %s", domain)
+	return api.Res(true, __("Maintenance mode disabled for %s.", domain))
+}
+
+// parseAllow reads an allow-list argument: a comma or space separated
+// string from the CLI or a JSON array. set is false when the caller left the
+// list alone (nil or "").
+func parseAllow(allow any) (list []any, set bool, errMsg string) {
+	var entries []string
+	switch v := allow.(type) {
+	case string:
+		entries = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+		set = v != ""
+	case []any:
+		for _, e := range v {
+			entries = append(entries, str(e))
+		}
+		set = true
+	}
+	for _, e := range entries {
+		target, ok := firewall.ValidTarget(e)
+		if !ok {
+			return nil, false, __("Invalid IP address or CIDR range: %s", e)
+		}
+		list = append(list, target)
+	}
+	return list, set, ""
+}
+
 // List ports list(): all registered domains, optionally filtered by app.
 // The payload keeps Node's per-record key order (domain, subdomain, app,
 // created) with absent fields omitted like JS undefined; records are ordered
@@ -8,6 +8,8 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+
+	"odac/internal/api"
 )
 
 func msgOf(t *testing.T, v any) string {
@@ -298,6 +300,40 @@ func TestAddWildcardDomain(t *testing.T) {
 	}
 }
 
+func TestAddUnderAnotherAppsWildcard(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{
+		"example.com": map[string]any{"appId": "myapp", "subdomain": []any{"www", "*"}},
+	})
+
+	r := fx.d.Add("feature-x.example.com", "otherapp")
+	if !r.Status {
+		t.Fatalf("add failed: %v", r.Message)
+	}
+	rec := fx.domain("feature-x.example.com")
+	if rec["appId"] != "otherapp" || rec["wildcard"] != "example.com" || rec["cert"] != false {
+		t.Fatalf("record = %v", rec)
+	}
+	if len(fx.dns.recorded()) != 0 || len(fx.renew.renewed()) != 0 {
+		t.Fatal("a wildcard-covered host needs no DNS records or certificate")
+	}
+
+	// Deleting it leaves the parent's DNS records alone.
+	if r := fx.d.Delete("feature-x.example.com", false); !r.Status {
+		t.Fatalf("delete failed: %v", r.Message)
+	}
+	if len(fx.dns.deleted()) != 0 || fx.domain("example.com") == nil {
+		t.Fatalf("dns deletes = %v", fx.dns.deleted())
+	}
+
+	// Without the wildcard, another app's subdomain is a domain of its own.
+	fx.setDomains(map[string]any{"example.com": map[string]any{"appId": "myapp"}})
+	fx.d.Add("feature-y.example.com", "otherapp")
+	if rec := fx.domain("feature-y.example.com"); rec["wildcard"] != nil || len(fx.dns.recorded()) == 0 {
+		t.Fatalf("record = %v", rec)
+	}
+}
+
 // ─── delete() ───────────────────────────────────────────────────────────
 
 func TestDeleteExistingDomain(t *testing.T) {
@@ -561,3 +597,55 @@ func TestDeleteByAppNoDomains(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// ─── maintenance() ──────────────────────────────────────────────────────
+
+func TestMaintenanceToggle(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{
+		"example.com": map[string]any{"appId": "myapp"},
+	})
+
+	r := fx.d.Maintenance("www.example.com", true, "203.0.113.7, 10.0.0.0/8", "600")
+	if !r.Status {
+		t.Fatalf("maintenance on failed: %v", r.Message)
+	}
+	m, _ := fx.domain("example.com")["maintenance"].(map[string]any)
+	allow, _ := m["allow"].([]any)
+	if m["enabled"] != true || m["retryAfter"] != float64(600) || len(allow) != 2 || allow[1] != "10.0.0.0/8" {
+		t.Fatalf("maintenance = %v", m)
+	}
+	if fx.proxy.syncCount() != 1 {
+		t.Fatalf("proxy syncs = %d", fx.proxy.syncCount())
+	}
+
+	// Switching off keeps the allow list and Retry-After for the next --on.
+	if r = fx.d.Maintenance("example.com", false, nil, nil); !r.Status {
+		t.Fatalf("maintenance off failed: %v", r.Message)
+	}
+	m, _ = fx.domain("example.com")["maintenance"].(map[string]any)
+	if m["enabled"] != false || m["retryAfter"] != float64(600) || len(m["allow"].([]any)) != 2 {
+		t.Fatalf("maintenance after off = %v", m)
+	}
+}
+
+func TestMaintenanceRejects(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{
+		"example.com": map[string]any{"appId": "myapp"},
+	})
+
+	cases := map[string]api.Result{
+		"missing domain": fx.d.Maintenance("nope.com", true, nil, nil),
+		"bad allow":      fx.d.Maintenance("example.com", true, "not-an-ip", nil),
+		"bad retry":      fx.d.Maintenance("example.com", true, nil, "soon"),
+	}
+	for name, r := range cases {
+		if r.Status {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	if _, ok := fx.domain("example.com")["maintenance"]; ok {
+		t.Error("rejected call changed the record")
+	}
+}
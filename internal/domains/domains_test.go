@@ -62,11 +62,14 @@ func (f *fakeDNS) deleted() []map[string]any {
 
 // fakeProxy records syncs and ACME challenge pushes.
 type fakeProxy struct {
-	mu       sync.Mutex
-	syncs    int
-	setCalls [][2]string // token, keyAuthorization
-	delCalls []string    // token
-	setErr   error
+	mu        sync.Mutex
+	syncs     int
+	setCalls  [][2]string // token, keyAuthorization
+	delCalls  []string    // token
+	setErr    error
+	alpnCalls [][2]string // domain, keyAuthorization
+	alpnDels  []string    // domain
+	alpnErr   error
 }
 
 func (f *fakeProxy) SyncConfig() {
@@ -91,6 +94,22 @@ func (f *fakeProxy) DeleteACMEChallenge(token string) {
 	f.delCalls = append(f.delCalls, token)
 }
 
+func (f *fakeProxy) SetTLSALPNChallenge(domain, keyAuthorization string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.alpnErr != nil {
+		return f.alpnErr
+	}
+	f.alpnCalls = append(f.alpnCalls, [2]string{domain, keyAuthorization})
+	return nil
+}
+
+func (f *fakeProxy) DeleteTLSALPNChallenge(domain string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.alpnDels = append(f.alpnDels, domain)
+}
+
 func (f *fakeProxy) syncCount() int {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -0,0 +1,258 @@
+package domains
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"odac/internal/api"
+)
+
+// expiryWarning is how long before an imported certificate expires the scan
+// starts warning, and how often it repeats the warning.
+const (
+	expiryWarning      = 30 * 24 * time.Hour
+	expiryWarningEvery = 24 * time.Hour
+)
+
+// Import installs a certificate obtained elsewhere (EV/OV, an internal CA)
+// for a domain. opts is {cert, key, chain} in PEM; cert may already carry
+// its chain. An imported certificate is never renewed through ACME, only
+// watched for expiry. {remove: true} drops it and hands the domain back to
+// ACME.
+func (s *SSL) Import(domainArg, optsArg any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+	opts, _ := optsArg.(map[string]any)
+
+	var found bool
+	var parent string
+	var subdomains []any
+	s.cfg.View(func() {
+		domains, _ := s.cfg.Get("domains").(map[string]any)
+		record, _ := domains[domain].(map[string]any)
+		if record == nil {
+			return
+		}
+		found = true
+		parent, _ = record["wildcard"].(string)
+		if subs, ok := record["subdomain"].([]any); ok {
+			subdomains = append([]any(nil), subs...)
+		}
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+	if parent != "" {
+		return api.Res(false, __("Domain %s is served by the wildcard certificate of %s. Import the certificate there.", domain, parent))
+	}
+	if opts["remove"] == true {
+		return s.removeImport(domain)
+	}
+
+	certPEM, _ := opts["cert"].(string)
+	keyPEM, _ := opts["key"].(string)
+	chainPEM, _ := opts["chain"].(string)
+	if certPEM == "" || keyPEM == "" {
+		return api.Res(false, __("Both a certificate and its private key are required."))
+	}
+
+	chain := parseCertificates(certPEM + "\n" + chainPEM)
+	if len(chain) == 0 {
+		return api.Res(false, __("No PEM certificate found."))
+	}
+	var fullchain strings.Builder
+	for _, c := range chain {
+		pem.Encode(&fullchain, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	if _, err := tls.X509KeyPair([]byte(fullchain.String()), []byte(keyPEM)); err != nil {
+		return api.Res(false, __("The private key is not valid PEM or does not match the certificate."))
+	}
+
+	leaf := chain[0]
+	now := s.now()
+	if now.After(leaf.NotAfter) {
+		return api.Res(false, __("The certificate expired on %s.", leaf.NotAfter.UTC().Format(time.DateOnly)))
+	}
+	if now.Before(leaf.NotBefore) {
+		return api.Res(false, __("The certificate is not valid before %s.", leaf.NotBefore.UTC().Format(time.RFC3339)))
+	}
+	if leaf.VerifyHostname(domain) != nil {
+		return api.Res(false, __("The certificate does not cover %s. It is issued for: %s", domain, strings.Join(leaf.DNSNames, ", ")))
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		if chain[i].CheckSignatureFrom(chain[i+1]) != nil {
+			return api.Res(false, __("The chain is out of order or incomplete: %s is not signed by %s.", chain[i].Subject.CommonName, chain[i+1].Subject.CommonName))
+		}
+	}
+
+	keyFile := filepath.Join(s.certDir, domain+".imported.key")
+	crtFile := filepath.Join(s.certDir, domain+".imported.crt")
+	if err := os.MkdirAll(s.certDir, 0o700); err != nil {
+		return api.Res(false, __("Failed to save the certificate: %s", err.Error()))
+	}
+	if err := writeKeyFile(keyFile, keyPEM); err != nil {
+		return api.Res(false, __("Failed to save the certificate: %s", err.Error()))
+	}
+	if err := os.WriteFile(crtFile, []byte(fullchain.String()), 0o644); err != nil {
+		return api.Res(false, __("Failed to save the certificate: %s", err.Error()))
+	}
+
+	// An ACME run already under way would otherwise replace the import.
+	s.mu.Lock()
+	if run, ok := s.processing[domain]; ok {
+		run.cancel()
+	}
+	delete(s.queued, domain)
+	delete(s.checked, domain)
+	s.mu.Unlock()
+
+	saved := false
+	s.cfg.Mutate(func() {
+		domains, _ := s.cfg.Get("domains").(map[string]any)
+		record, _ := domains[domain].(map[string]any)
+		if record == nil {
+			return
+		}
+		cert, _ := record["cert"].(map[string]any)
+		if cert == nil {
+			cert = map[string]any{}
+			record["cert"] = cert
+		}
+		cert["ssl"] = map[string]any{
+			"key":      keyFile,
+			"cert":     crtFile,
+			"expiry":   float64(leaf.NotAfter.UnixMilli()),
+			"imported": true,
+		}
+		s.cfg.Touch("domains")
+		saved = true
+	})
+	if !saved {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+
+	if s.mail != nil {
+		s.mail.ClearSSLCache(domain)
+	}
+	if s.proxy != nil {
+		s.proxy.SyncConfig()
+	}
+	s.log.Log("Imported SSL certificate for %s, valid until %s", domain, leaf.NotAfter.UTC().Format(time.DateOnly))
+
+	var uncovered []string
+	for _, name := range expectedNames(domain, subdomains)[1:] {
+		if leaf.VerifyHostname(name) != nil {
+			uncovered = append(uncovered, name)
+		}
+	}
+	msg := __("Certificate imported for %s, valid until %s. It is not renewed automatically: import a new one before it expires.", domain, leaf.NotAfter.UTC().Format(time.DateOnly))
+	if len(uncovered) > 0 {
+		msg += " " + __("It does not cover: %s", strings.Join(uncovered, ", "))
+	}
+	return api.Res(true, msg)
+}
+
+// removeImport drops an imported certificate and starts ACME issuance.
+func (s *SSL) removeImport(domain string) api.Result {
+	var keyFile, crtFile string
+	removed := false
+	s.cfg.Mutate(func() {
+		domains, _ := s.cfg.Get("domains").(map[string]any)
+		record, _ := domains[domain].(map[string]any)
+		cert, _ := record["cert"].(map[string]any)
+		ssl, _ := cert["ssl"].(map[string]any)
+		if ssl["imported"] != true {
+			return
+		}
+		keyFile, _ = ssl["key"].(string)
+		crtFile, _ = ssl["cert"].(string)
+		delete(cert, "ssl")
+		s.cfg.Touch("domains")
+		removed = true
+	})
+	if !removed {
+		return api.Res(false, __("Domain %s has no imported certificate.", domain))
+	}
+	os.Remove(keyFile)
+	os.Remove(crtFile)
+
+	s.log.Log("Removed the imported SSL certificate of %s", domain)
+	s.spawn(func() { s.ssl(domain) })
+	if s.proxy != nil {
+		s.proxy.SyncConfig()
+	}
+	return api.Res(true, __("Imported certificate removed from %s. A Let's Encrypt certificate is being requested.", domain))
+}
+
+// watchImported warns, once a day, when an imported certificate is inside
+// the expiry window: nothing renews it.
+func (s *SSL) watchImported(domain string, expiry float64) {
+	left := time.UnixMilli(int64(expiry)).Sub(s.now())
+	if left > expiryWarning {
+		return
+	}
+	s.mu.Lock()
+	st := s.checked[domain]
+	if st == nil {
+		st = &domainState{}
+		s.checked[domain] = st
+	}
+	due := st.lastExpiryWarning.IsZero() || s.now().Sub(st.lastExpiryWarning) >= expiryWarningEvery
+	if due {
+		st.lastExpiryWarning = s.now()
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+
+	var line string
+	if left <= 0 {
+		line = __("The imported SSL certificate of %s has expired. Import a new one: odac ssl import -d %s", domain, domain)
+	} else {
+		line = __("The imported SSL certificate of %s expires in %s days. Import a new one: odac ssl import -d %s", domain, strconv.Itoa(int(left.Hours()/24)), domain)
+	}
+	s.log.Error(line)
+	if s.alerter != nil {
+		s.alerter.Alert("ssl.expiring", domain, line, 1)
+	}
+}
+
+// importedLocked reports whether domain serves an imported certificate.
+// Caller holds cfg.View or cfg.Mutate.
+func (s *SSL) importedLocked(domain string) bool {
+	domains, _ := s.cfg.Get("domains").(map[string]any)
+	record, _ := domains[domain].(map[string]any)
+	cert, _ := record["cert"].(map[string]any)
+	ssl, _ := cert["ssl"].(map[string]any)
+	return ssl["imported"] == true
+}
+
+// parseCertificates decodes every CERTIFICATE block in order, skipping
+// anything else a bundle may carry.
+func parseCertificates(bundle string) []*x509.Certificate {
+	var out []*x509.Certificate
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return out
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if c, err := x509.ParseCertificate(block.Bytes); err == nil {
+			out = append(out, c)
+		}
+	}
+}
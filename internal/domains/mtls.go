@@ -0,0 +1,95 @@
+package domains
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"odac/internal/api"
+)
+
+// MTLS sets up client certificate authentication for a domain. opts is
+// {ca: PEM bundle, mode: "require"|"optional"}; a mode alone changes the
+// mode of an existing setup, and {off: true} turns it off. The proxy then
+// forwards the verified client's subject to the app as headers.
+func (d *Domain) MTLS(domainArg, optsArg any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+	opts, _ := optsArg.(map[string]any)
+	caFile := filepath.Join(d.cfg.BaseDir(), "cert", "client-ca", domain+".pem")
+
+	var found, enabled bool
+	d.cfg.View(func() {
+		record, _ := d.domainsLocked(false)[domain].(map[string]any)
+		found = record != nil
+		_, enabled = record["mtls"].(map[string]any)
+	})
+	if !found {
+		return api.Res(false, __("Domain %s not found.", domain))
+	}
+
+	if opts["off"] == true {
+		if !enabled {
+			return api.Res(true, __("Client certificate authentication is not enabled for %s.", domain))
+		}
+		d.cfg.Mutate(func() {
+			if record, _ := d.domainsLocked(false)[domain].(map[string]any); record != nil {
+				delete(record, "mtls")
+				d.cfg.Touch("domains")
+			}
+		})
+		os.Remove(caFile)
+		if d.proxy != nil {
+			d.proxy.SyncConfig()
+		}
+		d.log.Log("Client certificate authentication disabled for %s", domain)
+		return api.Res(true, __("Client certificate authentication disabled for %s.", domain))
+	}
+
+	mode, _ := opts["mode"].(string)
+	if mode == "" {
+		mode = "require"
+	}
+	if mode != "require" && mode != "optional" {
+		return api.Res(false, __("Invalid mode %s: use require or optional.", mode))
+	}
+
+	bundle, _ := opts["ca"].(string)
+	if bundle == "" && !enabled {
+		return api.Res(false, __("A CA bundle is required to enable client certificate authentication."))
+	}
+	if bundle != "" {
+		certs := parseCertificates(bundle)
+		hasCA := false
+		for _, c := range certs {
+			hasCA = hasCA || c.IsCA
+		}
+		if !hasCA {
+			return api.Res(false, __("The CA bundle holds no CA certificate."))
+		}
+		if err := os.MkdirAll(filepath.Dir(caFile), 0o700); err != nil {
+			return api.Res(false, __("Failed to save the CA bundle: %s", err.Error()))
+		}
+		if err := os.WriteFile(caFile, []byte(bundle), 0o644); err != nil {
+			return api.Res(false, __("Failed to save the CA bundle: %s", err.Error()))
+		}
+	}
+
+	d.cfg.Mutate(func() {
+		if record, _ := d.domainsLocked(false)[domain].(map[string]any); record != nil {
+			record["mtls"] = map[string]any{"ca": caFile, "mode": mode}
+			d.cfg.Touch("domains")
+		}
+	})
+	if d.proxy != nil {
+		d.proxy.SyncConfig()
+	}
+	d.log.Log("Client certificate authentication (%s) enabled for %s", mode, domain)
+	if mode == "optional" {
+		return api.Res(true, __("Client certificates are now verified when offered on %s. Clients without one still get through, marked NONE.", domain))
+	}
+	return api.Res(true, __("Client certificates are now required on %s.", domain))
+}
@@ -0,0 +1,55 @@
+package domains
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMTLS(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{"example.com": map[string]any{"appId": "myapp"}})
+	ca := issue(t, nil, "Client CA", nil, time.Now().Add(365*24*time.Hour))
+	leaf := issue(t, ca, "client", nil, time.Now().Add(24*time.Hour))
+
+	if r := fx.d.MTLS("example.com", map[string]any{"mode": "optional"}); r.Status {
+		t.Error("mode accepted before a CA bundle was set")
+	}
+	if r := fx.d.MTLS("example.com", map[string]any{"ca": leaf.certPEM}); r.Status {
+		t.Error("bundle without a CA certificate accepted")
+	}
+	if r := fx.d.MTLS("example.com", map[string]any{"ca": ca.certPEM, "mode": "sometimes"}); r.Status {
+		t.Error("unknown mode accepted")
+	}
+	if r := fx.d.MTLS("missing.com", map[string]any{"ca": ca.certPEM}); r.Status {
+		t.Error("unknown domain accepted")
+	}
+
+	if r := fx.d.MTLS("example.com", map[string]any{"ca": ca.certPEM}); !r.Status {
+		t.Fatalf("enable failed: %v", r.Message)
+	}
+	m, _ := fx.domain("example.com")["mtls"].(map[string]any)
+	if m["mode"] != "require" || mustRead(t, m["ca"].(string)) != ca.certPEM {
+		t.Fatalf("mtls = %v", m)
+	}
+	if fx.proxy.syncCount() == 0 {
+		t.Error("proxy not synced")
+	}
+
+	if r := fx.d.MTLS("example.com", map[string]any{"mode": "optional"}); !r.Status {
+		t.Fatalf("mode change failed: %v", r.Message)
+	}
+	if m, _ := fx.domain("example.com")["mtls"].(map[string]any); m["mode"] != "optional" {
+		t.Fatalf("mtls = %v", m)
+	}
+
+	if r := fx.d.MTLS("example.com", map[string]any{"off": true}); !r.Status {
+		t.Fatalf("off failed: %v", r.Message)
+	}
+	if fx.domain("example.com")["mtls"] != nil {
+		t.Error("mtls left on")
+	}
+	if _, err := os.Stat(m["ca"].(string)); !os.IsNotExist(err) {
+		t.Errorf("CA bundle left behind: %v", err)
+	}
+}
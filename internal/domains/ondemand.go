@@ -0,0 +1,92 @@
+package domains
+
+import (
+	"strconv"
+	"time"
+
+	"odac/internal/netmode"
+)
+
+const defaultOnDemandLimit = 20 // certificates per app per hour
+
+// IssueOnDemand registers a hostname the proxy approved for an app's
+// on-demand TLS and starts its certificate. The host is registered as is,
+// with no DNS records or subdomains: the customer points it here, not us.
+// Fills dataplane's OnDemandIssuer seam.
+func (d *Domain) IssueOnDemand(domainArg, appID string) {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" || domain == "localhost" || ipv4Re.MatchString(domain) {
+		return
+	}
+
+	var exists, allowed bool
+	limit := defaultOnDemandLimit
+	d.cfg.View(func() {
+		if _, ok := d.domainsLocked(false)[domain]; ok {
+			exists = true
+			return
+		}
+		apps, _ := d.cfg.Get("apps").([]any)
+		for _, a := range apps {
+			app, _ := a.(map[string]any)
+			if app == nil || app["name"] != appID {
+				continue
+			}
+			od, _ := app["onDemand"].(map[string]any)
+			allowed = od != nil && !netmode.IsHost(app["networkMode"])
+			if n, ok := od["limit"].(float64); ok && n > 0 {
+				limit = int(n)
+			}
+			break
+		}
+	})
+	if exists || !allowed {
+		return
+	}
+	if !d.takeOnDemandSlot(appID, limit) {
+		d.log.Error("On-demand TLS limit of %s certificates per hour reached for app %s, %s refused", strconv.Itoa(limit), appID, domain)
+		return
+	}
+
+	d.cfg.Mutate(func() {
+		d.domainsLocked(true)[domain] = map[string]any{
+			"appId":     appID,
+			"created":   float64(time.Now().UnixMilli()),
+			"subdomain": []any{},
+			"cert":      map[string]any{},
+			"onDemand":  true,
+		}
+		d.cfg.Touch("domains")
+	})
+	d.log.Log("On-demand domain %s added to app %s", domain, appID)
+
+	if d.ssl != nil {
+		d.ssl.Renew(domain)
+	}
+	if d.proxy != nil {
+		d.proxy.SyncConfig()
+	}
+}
+
+// takeOnDemandSlot counts one issuance against the app's hourly limit,
+// reporting false when the limit is already used up.
+func (d *Domain) takeOnDemandSlot(appID string, limit int) bool {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.issued == nil {
+		d.issued = map[string][]time.Time{}
+	}
+	recent := d.issued[appID][:0]
+	for _, at := range d.issued[appID] {
+		if now.Sub(at) < time.Hour {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= limit {
+		d.issued[appID] = recent
+		return false
+	}
+	d.issued[appID] = append(recent, now)
+	return true
+}
@@ -0,0 +1,42 @@
+package domains
+
+import "testing"
+
+func TestIssueOnDemand(t *testing.T) {
+	fx := newFixture(t)
+	fx.cfg.Mutate(func() {
+		fx.cfg.Set("apps", []any{
+			map[string]any{"id": "app-1", "name": "myapp", "onDemand": map[string]any{"ask": "/ok", "limit": float64(2)}},
+			map[string]any{"id": "app-2", "name": "otherapp"},
+		})
+	})
+
+	fx.d.IssueOnDemand("shop.customer.test", "myapp")
+	rec := fx.domain("shop.customer.test")
+	if rec == nil || rec["appId"] != "myapp" || rec["onDemand"] != true {
+		t.Fatalf("record = %v", rec)
+	}
+	if subs, _ := rec["subdomain"].([]any); len(subs) != 0 {
+		t.Errorf("subdomain = %v", rec["subdomain"])
+	}
+	if len(fx.dns.recorded()) != 0 {
+		t.Errorf("DNS records created for a customer domain: %v", fx.dns.recorded())
+	}
+	if got := fx.renew.renewed(); len(got) != 1 || got[0] != "shop.customer.test" {
+		t.Fatalf("renewed = %v", got)
+	}
+
+	// Existing domains and apps without on-demand TLS are left alone.
+	fx.d.IssueOnDemand("shop.customer.test", "myapp")
+	fx.d.IssueOnDemand("other.customer.test", "otherapp")
+	if fx.domain("other.customer.test") != nil || len(fx.renew.renewed()) != 1 {
+		t.Fatalf("renewed = %v", fx.renew.renewed())
+	}
+
+	// The hourly limit counts issuances, not current domains.
+	fx.d.IssueOnDemand("two.customer.test", "myapp")
+	fx.d.IssueOnDemand("three.customer.test", "myapp")
+	if fx.domain("two.customer.test") == nil || fx.domain("three.customer.test") != nil {
+		t.Fatalf("limit not applied: %v", fx.renew.renewed())
+	}
+}
@@ -0,0 +1,78 @@
+package domains
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"odac/internal/api"
+)
+
+// Relay registers domain as a tunnel relay hostname: odac-proxy on this
+// server accepts the agent for it and forwards the domain's traffic down the
+// agent's tunnel. The record has no appId; record["relay"]["tokenHash"] holds
+// sha256 of the agent token, which is only ever shown once. Calling Relay on
+// an existing relay domain rotates the token and drops the connected agent.
+func (d *Domain) Relay(domainArg any) api.Result {
+	domain, errMsg := validate(domainArg)
+	if errMsg != "" {
+		return api.Res(false, errMsg)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+	if domain == "localhost" || ipv4Re.MatchString(domain) || strings.HasPrefix(domain, "*.") {
+		return api.Res(false, __("A relay needs a real host name: %s", domain))
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return api.Res(false, __("Could not generate a token: %s", err.Error()))
+	}
+	token := hex.EncodeToString(raw)
+	sum := sha256.Sum256([]byte(token))
+
+	var exists, taken bool
+	d.cfg.Mutate(func() {
+		domains := d.domainsLocked(true)
+		record, _ := domains[domain].(map[string]any)
+		if record != nil {
+			exists = true
+			if _, ok := record["relay"]; !ok {
+				taken = true
+				return
+			}
+		} else {
+			record = map[string]any{
+				"created":   float64(time.Now().UnixMilli()),
+				"subdomain": []any{"www"},
+				"cert":      map[string]any{},
+			}
+			domains[domain] = record
+		}
+		record["relay"] = map[string]any{"tokenHash": hex.EncodeToString(sum[:])}
+		d.cfg.Touch("domains")
+	})
+	if taken {
+		return api.Res(false, __("Domain %s is already registered to an app.", domain))
+	}
+
+	if exists {
+		d.log.Log("Rotated relay token for %s", domain)
+	} else {
+		d.dns.Record(
+			map[string]any{"name": domain, "type": "A"},
+			map[string]any{"name": domain, "type": "AAAA"},
+			map[string]any{"name": "www." + domain, "type": "CNAME", "value": domain},
+		)
+		if d.ssl != nil {
+			d.ssl.Renew(domain)
+		}
+		d.log.Log("Relay domain %s added", domain)
+	}
+	if d.proxy != nil {
+		d.proxy.SyncConfig()
+	}
+
+	return api.Res(true, __("Relay for %s is ready. On the machine that runs the app:\n  odac tunnel add -d %s -a <app> --relay https://%s --token %s", domain, domain, domain, token))
+}
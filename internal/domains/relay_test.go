@@ -0,0 +1,58 @@
+package domains
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func relayToken(t *testing.T, msg any) string {
+	t.Helper()
+	s, _ := msg.(string)
+	i := strings.LastIndex(s, "--token ")
+	if i < 0 {
+		t.Fatalf("no token in %q", s)
+	}
+	return s[i+len("--token "):]
+}
+
+func TestRelay(t *testing.T) {
+	fx := newFixture(t)
+	fx.setDomains(map[string]any{
+		"example.com": map[string]any{"appId": "myapp"},
+	})
+
+	r := fx.d.Relay("www.office.example.org")
+	if !r.Status {
+		t.Fatalf("relay: %v", r.Message)
+	}
+	token := relayToken(t, r.Message)
+	sum := sha256.Sum256([]byte(token))
+	record := fx.domain("office.example.org")
+	relay, _ := record["relay"].(map[string]any)
+	if relay["tokenHash"] != hex.EncodeToString(sum[:]) || record["appId"] != nil {
+		t.Fatalf("record = %v", record)
+	}
+	if len(fx.dns.recorded()) != 3 || len(fx.renew.renewed()) != 1 || fx.proxy.syncCount() != 1 {
+		t.Errorf("dns %v, renewed %v, syncs %d", fx.dns.recorded(), fx.renew.renewed(), fx.proxy.syncCount())
+	}
+
+	// Again: the token rotates without touching DNS or SSL.
+	r = fx.d.Relay("office.example.org")
+	if !r.Status || relayToken(t, r.Message) == token {
+		t.Fatalf("rotate: %v", r.Message)
+	}
+	if len(fx.dns.recorded()) != 3 || len(fx.renew.renewed()) != 1 {
+		t.Error("rotation re-created DNS or SSL")
+	}
+
+	for _, name := range []string{"example.com", "localhost", "*.example.org", "nodot"} {
+		if r := fx.d.Relay(name); r.Status {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	if fx.domain("example.com")["relay"] != nil {
+		t.Error("app domain turned into a relay")
+	}
+}
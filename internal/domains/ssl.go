@@ -51,9 +51,10 @@ func (r *sslRun) isCancelled() bool { r.mu.Lock(); defer r.mu.Unlock(); return r
 
 // domainState is one #checked entry: SAN-check throttle + error backoff.
 type domainState struct {
-	lastSanCheck time.Time
-	errorCount   int
-	interval     time.Time // backoff: no new attempt before this instant
+	lastSanCheck      time.Time
+	errorCount        int
+	interval          time.Time // backoff: no new attempt before this instant
+	lastExpiryWarning time.Time // imported certificates only
 }
 
 // SSL is the SSL.js singleton: certificate lifecycle over config.domains.
@@ -64,9 +65,11 @@ type SSL struct {
 	dns     DNSService
 	proxy   ProxyService
 	mail    MailService
+	alerter Alerter
+	secrets SecretRevealer
 
-	// newClient is Acme.create(); tests swap in a fake orderer.
-	newClient func() (acmeOrderer, error)
+	// newClient is Acme.create() for one CA; tests swap in a fake orderer.
+	newClient func(ca acmeCA) (acmeOrderer, error)
 	now       func() time.Time
 
 	// bg tracks detached renewals (Node's un-awaited #ssl calls) so tests
@@ -80,6 +83,10 @@ type SSL struct {
 	queued     map[string]bool
 }
 
+// SetAlerter wires the alert sink for failed renewals. Call it before the
+// first Check.
+func (s *SSL) SetAlerter(a Alerter) { s.alerter = a }
+
 // acmeDirectory picks the ACME directory URL. ODAC_ACME_URL overrides it
 // (no Node equivalent — Node hardcodes production). It exists for the 3.8
 // staging host, where cert issue/renew must run for real against the Let's
@@ -106,9 +113,8 @@ func NewSSL(cfg *config.Store, dns DNSService, proxy ProxyService, mail MailServ
 		processing: map[string]*sslRun{},
 		queued:     map[string]bool{},
 	}
-	directory := acmeDirectory()
-	s.newClient = func() (acmeOrderer, error) {
-		return newACMEClient(s.certDir, directory, nil, s.log)
+	s.newClient = func(ca acmeCA) (acmeOrderer, error) {
+		return newACMEClient(s.certDir, ca, nil, s.log)
 	}
 	hardenCertDir(s.certDir)
 	return s
@@ -197,9 +203,8 @@ func (s *SSL) scan() {
 	})
 
 	for _, domain := range names {
-		var skip bool
+		var skip, hasSSL, imported bool
 		var expiry float64
-		var hasSSL bool
 		s.cfg.View(func() {
 			domains, _ := s.cfg.Get("domains").(map[string]any)
 			record, _ := domains[domain].(map[string]any)
@@ -216,11 +221,16 @@ func (s *SSL) scan() {
 			if ssl != nil {
 				hasSSL = true
 				expiry, _ = ssl["expiry"].(float64)
+				imported = ssl["imported"] == true
 			}
 		})
 		if skip {
 			continue
 		}
+		if imported {
+			s.watchImported(domain, expiry)
+			continue
+		}
 
 		// Expiry: renew when missing or inside the 30-day window.
 		if !hasSSL || float64(s.now().UnixMilli())+1000*60*60*24*30 > expiry {
@@ -351,6 +361,11 @@ func (s *SSL) Renew(domainArg any) api.Result {
 	if !found {
 		return api.Res(false, __("Domain %s not found.", domain))
 	}
+	imported := false
+	s.cfg.View(func() { imported = s.importedLocked(domain) })
+	if imported {
+		return api.Res(false, __("Domain %s uses an imported certificate, which is not renewed through Let's Encrypt. Import a new one, or switch back with: odac ssl import -d %s --remove", domain, domain))
+	}
 
 	target := domain
 	s.spawn(func() { s.ssl(target) })
@@ -400,14 +415,11 @@ func (s *SSL) ssl(domain string) {
 	}
 }
 
-// generate is the try body of #ssl: client, SAN list, key+CSR, order,
-// save — with the cancellation checks between each stage.
+// generate is the try body of #ssl: SAN list, key+CSR, order, save, with
+// the cancellation checks between each stage. The domain's CAs are tried
+// in order; only a rate limit moves on to the next one.
 func (s *SSL) generate(domain string, run *sslRun) error {
-	client, err := s.newClient()
-	if err != nil {
-		return err
-	}
-
+	cas, keyType := s.issuance(domain)
 	var subdomains []any
 	s.cfg.View(func() {
 		domains, _ := s.cfg.Get("domains").(map[string]any)
@@ -423,7 +435,7 @@ func (s *SSL) generate(domain string, run *sslRun) error {
 		return nil
 	}
 
-	keyPEM, signer, err := generateKeyPair()
+	keyPEM, signer, err := generateKeyPair(keyType)
 	if err != nil {
 		return err
 	}
@@ -432,16 +444,26 @@ func (s *SSL) generate(domain string, run *sslRun) error {
 		return err
 	}
 
-	s.log.Log("Requesting SSL certificate for domain %s...", domain)
-
-	if run.isCancelled() {
-		s.log.Log("SSL generation for %s cancelled before ACME request.", domain)
-		return nil
-	}
-
-	cert, err := s.requestCertificate(client, csr, names, run)
-	if err != nil {
-		return err
+	var cert, issuer string
+	for i, name := range cas {
+		if run.isCancelled() {
+			s.log.Log("SSL generation for %s cancelled before ACME request.", domain)
+			return nil
+		}
+		client, err := s.client(name)
+		if err != nil {
+			return err
+		}
+		s.log.Log("Requesting SSL certificate for domain %s from %s...", domain, name)
+		cert, err = s.requestCertificate(client, csr, names, run)
+		if err == nil {
+			issuer = name
+			break
+		}
+		if !rateLimited(err) || i == len(cas)-1 || run.isCancelled() {
+			return err
+		}
+		s.log.Error("%s is rate limiting certificates for %s. Trying %s.", name, domain, cas[i+1])
 	}
 
 	if run.isCancelled() {
@@ -454,13 +476,15 @@ func (s *SSL) generate(domain string, run *sslRun) error {
 		return nil
 	}
 
-	s.saveCertificate(domain, keyPEM, cert)
+	s.saveCertificate(domain, keyPEM, cert, issuer)
 	return nil
 }
 
 // requestCertificate ports #requestCertificate: HTTP-01 first (fast, no
-// nameserver delegation needed), DNS-01 as the universal fallback; wildcard
-// orders go straight to DNS-01.
+// nameserver delegation needed), then TLS-ALPN-01 on port 443 for hosts
+// whose port 80 is blocked, and DNS-01 as the universal fallback; wildcard
+// orders go straight to DNS-01. A rate limit ends the attempt: every
+// challenge type would hit it.
 func (s *SSL) requestCertificate(client acmeOrderer, csr []byte, names []string, run *sslRun) (string, error) {
 	hasWildcard := false
 	for _, d := range names {
@@ -476,10 +500,19 @@ func (s *SSL) requestCertificate(client acmeOrderer, csr []byte, names []string,
 		if err == nil {
 			return cert, nil
 		}
-		if run.isCancelled() {
-			return "", err // propagate cancellation, don't fall back
+		if run.isCancelled() || rateLimited(err) {
+			return "", err // propagate, don't fall back
 		}
-		s.log.Log("HTTP-01 challenge failed: %s. Falling back to DNS-01...", err.Error())
+		s.log.Log("HTTP-01 challenge failed: %s. Trying TLS-ALPN-01...", err.Error())
+
+		cert, err = s.acmeOrder(client, csr, names, "tls-alpn-01", run)
+		if err == nil {
+			return cert, nil
+		}
+		if run.isCancelled() || rateLimited(err) {
+			return "", err
+		}
+		s.log.Log("TLS-ALPN-01 challenge failed: %s. Falling back to DNS-01...", err.Error())
 	} else {
 		s.log.Log("Wildcard domain detected. Skipping HTTP-01 and using DNS-01 exclusively.")
 	}
@@ -505,6 +538,12 @@ func (s *SSL) acmeOrder(client acmeOrderer, csr []byte, names []string, challeng
 					return errors.New("Proxy process not running")
 				}
 				return s.proxy.SetACMEChallenge(token, authValue)
+			case "tls-alpn-01":
+				s.log.Log("Creating TLS-ALPN-01 challenge for %s", identifier)
+				if s.proxy == nil {
+					return errors.New("Proxy process not running")
+				}
+				return s.proxy.SetTLSALPNChallenge(identifier, authValue)
 			case "dns-01":
 				authzName := strings.TrimPrefix(identifier, "*.")
 				s.log.Log("Creating DNS-01 challenge for %s", authzName)
@@ -527,6 +566,11 @@ func (s *SSL) acmeOrder(client acmeOrderer, csr []byte, names []string, challeng
 				if s.proxy != nil {
 					s.proxy.DeleteACMEChallenge(token)
 				}
+			case "tls-alpn-01":
+				s.log.Log("Removing TLS-ALPN-01 challenge for %s", identifier)
+				if s.proxy != nil {
+					s.proxy.DeleteTLSALPNChallenge(identifier)
+				}
 			case "dns-01":
 				authzName := strings.TrimPrefix(identifier, "*.")
 				s.log.Log("Removing DNS-01 challenge for %s", authzName)
@@ -596,9 +640,9 @@ func (s *SSL) self() {
 }
 
 // saveCertificate ports #saveCertificate: write the key/cert pair, update
-// the domain record (90-day expiry window), clear the mail TLS cache and
-// sync the proxy so it reloads certificates.
-func (s *SSL) saveCertificate(domain, keyPEM, certPEM string) {
+// the domain record (90-day expiry window, issuing CA), clear the mail TLS
+// cache and sync the proxy so it reloads certificates.
+func (s *SSL) saveCertificate(domain, keyPEM, certPEM, issuer string) {
 	s.mu.Lock()
 	delete(s.checked, domain) // success resets backoff + SAN throttle
 	s.mu.Unlock()
@@ -624,7 +668,7 @@ func (s *SSL) saveCertificate(domain, keyPEM, certPEM string) {
 	s.cfg.Mutate(func() {
 		domains, _ := s.cfg.Get("domains").(map[string]any)
 		record, _ := domains[domain].(map[string]any)
-		if record == nil {
+		if record == nil || s.importedLocked(domain) {
 			return
 		}
 		cert, _ := record["cert"].(map[string]any)
@@ -636,12 +680,13 @@ func (s *SSL) saveCertificate(domain, keyPEM, certPEM string) {
 			"key":    keyFile,
 			"cert":   crtFile,
 			"expiry": float64(s.now().UnixMilli() + 1000*60*60*24*30*3),
+			"issuer": issuer,
 		}
 		s.cfg.Touch("domains")
 		saved = true
 	})
 	if !saved {
-		return // Node: !domainRecord → silent return
+		return // Node: !domainRecord → silent return; or imported meanwhile
 	}
 
 	if s.mail != nil {
@@ -681,17 +726,22 @@ func (s *SSL) handleSSLError(domain string, err error) {
 	secs := int(backoff / time.Second)
 	msg := err.Error()
 	var dnsErr *net.DNSError
+	var line string
 	switch {
 	// logx.Error does no %-substitution (Node parity), so render first.
 	case strings.Contains(msg, "validateStatus"):
-		s.log.Error(fmt.Sprintf("SSL certificate request failed for domain %s (Attempt %d). Next retry in %ds. Reason: HTTP validation error.",
-			domain, count, secs))
+		line = fmt.Sprintf("SSL certificate request failed for domain %s (Attempt %d). Next retry in %ds. Reason: HTTP validation error.",
+			domain, count, secs)
 	case errors.As(err, &dnsErr) || errors.Is(err, syscall.ECONNREFUSED):
-		s.log.Error(fmt.Sprintf("SSL request failed for domain %s (Attempt %d). Next retry in %ds. Network issue: %s",
-			domain, count, secs, msg))
+		line = fmt.Sprintf("SSL request failed for domain %s (Attempt %d). Next retry in %ds. Network issue: %s",
+			domain, count, secs, msg)
 	default:
-		s.log.Error(fmt.Sprintf("SSL request failed for domain %s (Attempt %d). Next retry in %ds. Error: %s",
-			domain, count, secs, msg))
+		line = fmt.Sprintf("SSL request failed for domain %s (Attempt %d). Next retry in %ds. Error: %s",
+			domain, count, secs, msg)
+	}
+	s.log.Error(line)
+	if s.alerter != nil {
+		s.alerter.Alert("ssl.failed", domain, line, float64(count))
 	}
 }
 
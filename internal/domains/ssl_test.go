@@ -51,6 +51,7 @@ type sslFixture struct {
 	s           *SSL
 	orderer     *fakeOrderer
 	clientCalls int
+	clientCAs   []acmeCA
 	clientMu    sync.Mutex
 }
 
@@ -58,9 +59,10 @@ func newSSLFixture(t *testing.T) *sslFixture {
 	t.Helper()
 	fx := &sslFixture{fixture: newFixture(t), orderer: &fakeOrderer{}}
 	fx.s = NewSSL(fx.cfg, fx.dns, fx.proxy, fx.mail)
-	fx.s.newClient = func() (acmeOrderer, error) {
+	fx.s.newClient = func(ca acmeCA) (acmeOrderer, error) {
 		fx.clientMu.Lock()
 		fx.clientCalls++
+		fx.clientCAs = append(fx.clientCAs, ca)
 		fx.clientMu.Unlock()
 		return fx.orderer, nil
 	}
@@ -382,8 +384,8 @@ func TestRenewSubdomainRenewsParent(t *testing.T) {
 func TestRenewFallsBackToDNS01(t *testing.T) {
 	fx := newSSLFixture(t)
 	fx.orderer.handler = func(call int, o orderOpts) (string, error) {
-		if o.ChallengeType == "http-01" {
-			return "", errors.New("HTTP-01 challenge validation failed")
+		if o.ChallengeType != "dns-01" {
+			return "", errors.New(o.ChallengeType + " challenge validation failed")
 		}
 		return "mock-certificate-dns", nil
 	}
@@ -395,7 +397,7 @@ func TestRenewFallsBackToDNS01(t *testing.T) {
 	fx.waitIdle(t)
 
 	calls := fx.orderer.callList()
-	if len(calls) != 2 || calls[0].ChallengeType != "http-01" || calls[1].ChallengeType != "dns-01" {
+	if len(calls) != 3 || calls[0].ChallengeType != "http-01" || calls[1].ChallengeType != "tls-alpn-01" || calls[2].ChallengeType != "dns-01" {
 		t.Fatalf("calls = %+v", calls)
 	}
 	raw, err := os.ReadFile(filepath.Join(fx.s.certDir, "expired.com.crt"))
@@ -592,6 +594,34 @@ func TestErrorBackoffSchedule(t *testing.T) {
 	}
 }
 
+type recordingAlerter struct{ values []float64 }
+
+func (r *recordingAlerter) Alert(kind, subject, message string, value float64) {
+	if kind == "ssl.failed" && subject == "expired.com" && strings.Contains(message, "boom") {
+		r.values = append(r.values, value)
+	}
+}
+
+func TestErrorsRaiseAlertsWithAttemptCount(t *testing.T) {
+	fx := newSSLFixture(t)
+	fx.orderer.handler = func(_ int, _ orderOpts) (string, error) {
+		return "", errors.New("boom")
+	}
+	fx.setDomains(map[string]any{"expired.com": certRecord(nowMs()-100000, "", "")})
+	alerts := &recordingAlerter{}
+	fx.s.SetAlerter(alerts)
+
+	clock := time.Now()
+	fx.s.now = func() time.Time { return clock }
+	for range 2 {
+		fx.s.ssl("expired.com")
+		clock = clock.Add(time.Hour)
+	}
+	if len(alerts.values) != 2 || alerts.values[0] != 1 || alerts.values[1] != 2 {
+		t.Errorf("alerts = %v", alerts.values)
+	}
+}
+
 // ─── SAN math + save guard ──────────────────────────────────────────────
 
 func TestExpectedNamesWildcardCoverage(t *testing.T) {
@@ -0,0 +1,44 @@
+package firewall
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// The control-socket endpoints are identical on all three daemons, so they
+// live here and each daemon mounts them on its own mux.
+
+// HandlePolicy replaces the policy. Endpoint: POST /firewall
+func (g *Guard) HandlePolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var p Policy
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		log.Printf("[%s-FW] Failed to decode policy: %v", g.name, err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	g.Update(p)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// HandleBans hands the locally raised bans to the orchestrator.
+// Endpoint: GET /firewall/bans
+func (g *Guard) HandleBans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"bans": g.DrainBans()})
+}
+
+// Mount registers both endpoints on a daemon's control mux.
+func (g *Guard) Mount(mux *http.ServeMux) {
+	mux.HandleFunc("/firewall", g.HandlePolicy)
+	mux.HandleFunc("/firewall/bans", g.HandleBans)
+}
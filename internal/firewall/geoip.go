@@ -0,0 +1,340 @@
+package firewall
+
+// Minimal reader for MaxMind DB (.mmdb) files, enough to resolve an address
+// to its ISO country code in GeoLite2-Country / GeoIP2-Country / DB-IP
+// country databases. Implements the public MaxMind DB format spec (binary
+// search tree + typed data section) without pulling in a dependency; the
+// whole file is read into memory once, country databases are a few MB.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// GeoDB is an opened MaxMind-format database. Safe for concurrent lookups.
+type GeoDB struct {
+	buf        []byte
+	data       []byte // data section
+	nodeCount  uint32
+	recordSize int
+	ipVersion  int
+	ipv4Start  uint32 // node reached after the 96 leading zero bits (IPv6 trees)
+}
+
+// OpenGeoDB loads a database file into memory and validates its metadata.
+func OpenGeoDB(path string) (*GeoDB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseGeoDB(buf)
+}
+
+func parseGeoDB(buf []byte) (*GeoDB, error) {
+	idx := bytes.LastIndex(buf, metadataMarker)
+	if idx < 0 {
+		return nil, errors.New("geoip: metadata marker not found")
+	}
+	metaStart := idx + len(metadataMarker)
+	meta, _, err := (&decoder{buf: buf[metaStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: metadata: %w", err)
+	}
+	m, ok := meta.(map[string]any)
+	if !ok {
+		return nil, errors.New("geoip: metadata is not a map")
+	}
+
+	db := &GeoDB{
+		buf:        buf,
+		nodeCount:  uint32(asUint(m["node_count"])),
+		recordSize: int(asUint(m["record_size"])),
+		ipVersion:  int(asUint(m["ip_version"])),
+	}
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", db.recordSize)
+	}
+
+	treeSize := int(db.nodeCount) * db.recordSize / 4
+	dataStart := treeSize + 16
+	if dataStart > idx {
+		return nil, errors.New("geoip: search tree exceeds file")
+	}
+	db.data = buf[dataStart:idx]
+
+	if db.ipVersion == 6 {
+		node := uint32(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record reads the left (bit 0) or right (bit 1) record of a tree node.
+func (db *GeoDB) record(node uint32, bit int) uint32 {
+	switch db.recordSize {
+	case 24:
+		off := int(node) * 6
+		b := db.buf[off+bit*3:]
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	case 28:
+		off := int(node) * 7
+		b := db.buf[off:]
+		if bit == 0 {
+			return uint32(b[3]&0xF0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3]&0x0F)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	default:
+		off := int(node) * 8
+		return binary.BigEndian.Uint32(db.buf[off+bit*4:])
+	}
+}
+
+// Country returns the ISO 3166-1 alpha-2 code for addr ("" when unknown).
+// The country record is preferred; registered_country covers ranges such
+// as anycast blocks that only carry the registrant's country.
+func (db *GeoDB) Country(addr netip.Addr) string {
+	rec := db.lookup(addr)
+	m, _ := rec.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := m[key].(map[string]any); ok {
+			if code, ok := c["iso_code"].(string); ok && code != "" {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+func (db *GeoDB) lookup(addr netip.Addr) any {
+	addr = addr.Unmap()
+	var ip []byte
+	node := uint32(0)
+	switch {
+	case addr.Is4():
+		a := addr.As4()
+		ip = a[:]
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	case addr.Is6():
+		if db.ipVersion != 6 {
+			return nil
+		}
+		a := addr.As16()
+		ip = a[:]
+	default:
+		return nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		return nil // nodeCount itself is the "no data" sentinel
+	}
+	off := int(node-db.nodeCount) - 16
+	if off < 0 || off >= len(db.data) {
+		return nil
+	}
+	v, _, err := (&decoder{buf: db.data}).decode(off)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// decoder walks the MaxMind DB data section format. Pointers are offsets
+// into buf, which is the data section (or the metadata block).
+type decoder struct {
+	buf   []byte
+	depth int
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+var errCorrupt = errors.New("geoip: corrupt data section")
+
+func (d *decoder) decode(off int) (any, int, error) {
+	if off >= len(d.buf) {
+		return nil, 0, errCorrupt
+	}
+	ctrl := d.buf[off]
+	off++
+	typ := int(ctrl >> 5)
+	if typ == typePointer {
+		ptr, next, err := d.pointer(ctrl, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		if d.depth > 32 {
+			return nil, 0, errCorrupt
+		}
+		d.depth++
+		v, _, err := d.decode(ptr)
+		d.depth--
+		return v, next, err
+	}
+	if typ == typeExtended {
+		if off >= len(d.buf) {
+			return nil, 0, errCorrupt
+		}
+		typ = 7 + int(d.buf[off])
+		off++
+	}
+
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if off+n > len(d.buf) {
+			return nil, 0, errCorrupt
+		}
+		v := 0
+		for _, b := range d.buf[off : off+n] {
+			v = v<<8 | int(b)
+		}
+		off += n
+		switch size {
+		case 29:
+			size = 29 + v
+		case 30:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			k, next, err := d.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			v, after, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			if ks, ok := k.(string); ok {
+				m[ks] = v
+			}
+			off = after
+		}
+		return m, off, nil
+	case typeArray:
+		arr := make([]any, 0, size)
+		for i := 0; i < size; i++ {
+			v, next, err := d.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			arr = append(arr, v)
+			off = next
+		}
+		return arr, off, nil
+	case typeBool:
+		return size != 0, off, nil
+	case typeEndMarker, typeContainer:
+		return nil, off, nil
+	}
+
+	if off+size > len(d.buf) {
+		return nil, 0, errCorrupt
+	}
+	raw := d.buf[off : off+size]
+	off += size
+	switch typ {
+	case typeString:
+		return string(raw), off, nil
+	case typeBytes:
+		return append([]byte(nil), raw...), off, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), off, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), off, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		var v uint64
+		for _, b := range raw {
+			v = v<<8 | uint64(b) // uint128 truncates; never used for country data
+		}
+		return v, off, nil
+	case typeInt32:
+		var v uint32
+		for _, b := range raw {
+			v = v<<8 | uint32(b)
+		}
+		return int64(int32(v)), off, nil
+	}
+	return nil, 0, errCorrupt
+}
+
+// pointer decodes a pointer's target offset and the offset just past it.
+func (d *decoder) pointer(ctrl byte, off int) (int, int, error) {
+	ss := int(ctrl>>3) & 0x3
+	n := ss + 1
+	if off+n > len(d.buf) {
+		return 0, 0, errCorrupt
+	}
+	b := d.buf[off : off+n]
+	vvv := int(ctrl & 0x7)
+	var p int
+	switch ss {
+	case 0:
+		p = vvv<<8 | int(b[0])
+	case 1:
+		p = (vvv<<16 | int(b[0])<<8 | int(b[1])) + 2048
+	case 2:
+		p = (vvv<<24 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])) + 526336
+	default:
+		p = int(binary.BigEndian.Uint32(b))
+	}
+	return p, off + n, nil
+}
+
+func asUint(v any) uint64 {
+	switch x := v.(type) {
+	case uint64:
+		return x
+	case int64:
+		if x > 0 {
+			return uint64(x)
+		}
+	}
+	return 0
+}
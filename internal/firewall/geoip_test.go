@@ -0,0 +1,161 @@
+package firewall
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildMMDB writes a minimal IPv4, 24-bit-record MaxMind database mapping
+// each prefix to {"country": {"iso_code": code}}.
+func buildMMDB(t *testing.T, countries map[string]string) []byte {
+	t.Helper()
+
+	type node struct {
+		child [2]*node
+		code  string
+	}
+	root := &node{}
+	for cidr, code := range countries {
+		p := netip.MustParsePrefix(cidr)
+		ip := p.Addr().As4()
+		n := root
+		for i := 0; i < p.Bits(); i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if n.child[bit] == nil {
+				n.child[bit] = &node{}
+			}
+			n = n.child[bit]
+		}
+		n.code = code
+	}
+
+	// Number interior nodes breadth-first; leaves become data pointers.
+	var order []*node
+	index := map[*node]int{}
+	queue := []*node{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.code != "" {
+			continue
+		}
+		index[n] = len(order)
+		order = append(order, n)
+		for _, c := range n.child {
+			if c != nil {
+				queue = append(queue, c)
+			}
+		}
+	}
+	nodeCount := len(order)
+
+	var data []byte
+	dataOff := map[string]int{}
+	for _, code := range countries {
+		if _, ok := dataOff[code]; ok {
+			continue
+		}
+		dataOff[code] = len(data)
+		data = append(data, mmdbMap(1)...)
+		data = append(data, mmdbString("country")...)
+		data = append(data, mmdbMap(1)...)
+		data = append(data, mmdbString("iso_code")...)
+		data = append(data, mmdbString(code)...)
+	}
+
+	var buf []byte
+	for _, n := range order {
+		for _, c := range n.child {
+			v := nodeCount // empty
+			switch {
+			case c == nil:
+			case c.code != "":
+				v = nodeCount + 16 + dataOff[c.code]
+			default:
+				v = index[c]
+			}
+			buf = append(buf, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	buf = append(buf, mmdbMap(3)...)
+	buf = append(buf, mmdbString("node_count")...)
+	buf = append(buf, 6<<5|4, byte(nodeCount>>24), byte(nodeCount>>16), byte(nodeCount>>8), byte(nodeCount))
+	buf = append(buf, mmdbString("record_size")...)
+	buf = append(buf, 5<<5|1, 24)
+	buf = append(buf, mmdbString("ip_version")...)
+	buf = append(buf, 5<<5|1, 4)
+	return buf
+}
+
+func mmdbMap(n int) []byte { return []byte{byte(7<<5 | n)} }
+
+func mmdbString(s string) []byte { return append([]byte{byte(2<<5 | len(s))}, s...) }
+
+func TestGeoDBCountry(t *testing.T) {
+	db, err := parseGeoDB(buildMMDB(t, map[string]string{
+		"1.0.0.0/8":      "DE",
+		"2.2.0.0/16":     "US",
+		"203.0.113.0/24": "KP",
+	}))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	cases := map[string]string{
+		"1.2.3.4":        "DE",
+		"2.2.9.9":        "US",
+		"2.3.0.1":        "",
+		"203.0.113.77":   "KP",
+		"::ffff:1.0.0.1": "DE",
+		"2001:db8::1":    "", // IPv6 against an IPv4 tree
+	}
+	for ip, want := range cases {
+		if got := db.Country(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Country(%s) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestGeoDBRejectsGarbage(t *testing.T) {
+	if _, err := parseGeoDB([]byte("not a database")); err == nil {
+		t.Error("expected an error for a file without metadata")
+	}
+}
+
+func TestGuardCountryRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := os.WriteFile(path, buildMMDB(t, map[string]string{
+		"1.0.0.0/8": "DE",
+		"2.0.0.0/8": "KP",
+	}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGuard("Test")
+	g.Update(Policy{
+		Enabled:   true,
+		GeoIP:     path,
+		Countries: Countries{Block: []string{"kp"}},
+		Domains: map[string]DomainRule{
+			"admin.example.com": {Countries: &Countries{Allow: []string{"US"}}},
+		},
+	})
+
+	if ok, reason := g.Check("2.1.1.1", "example.com"); ok || reason != "country KP" {
+		t.Errorf("blocked country passed: %v %q", ok, reason)
+	}
+	if ok, _ := g.Check("1.1.1.1", "example.com"); !ok {
+		t.Error("unlisted country blocked globally")
+	}
+	if ok, _ := g.Check("1.1.1.1", "www.admin.example.com"); ok {
+		t.Error("domain allow-list did not block DE")
+	}
+	// Addresses the database does not know are never country-blocked.
+	if ok, _ := g.Check("9.9.9.9", "admin.example.com"); !ok {
+		t.Error("address without a country blocked by allow-list")
+	}
+}
@@ -0,0 +1,448 @@
+package firewall
+
+import (
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTracked caps the per-event offender table. Beyond it the oldest window
+// is simply dropped: an attacker spraying addresses cannot grow memory, at
+// worst one of them escapes its ban by a window.
+const maxTracked = 50000
+
+// Guard is a daemon's compiled view of the policy: the static rule sets,
+// the ban table (pushed bans plus the ones this daemon raised itself), the
+// optional GeoIP database and the auto-ban counters.
+type Guard struct {
+	name string // log prefix: "Proxy", "Mail", "DNS"
+	now  func() time.Time
+
+	mu        sync.RWMutex
+	policy    Policy
+	global    compiled
+	domains   map[string]compiled
+	bans      banTable
+	geo       *GeoDB
+	geoPath   string
+	geoMod    time.Time
+	local     map[string]localBan // bans raised here, keyed by IP
+	offenders map[string]*offense // event + "|" + IP
+}
+
+type localBan struct {
+	ban       Ban
+	drainedAt time.Time // last handed to the orchestrator; zero until then
+}
+
+// drainRetry is how long a drained ban waits for a push carrying it before
+// it is offered again, in case the drain response never arrived.
+const drainRetry = time.Minute
+
+type offense struct {
+	count int
+	start time.Time
+}
+
+// compiled is a rule set ready for matching.
+type compiled struct {
+	white     addrSet
+	black     addrSet
+	countries *countrySet
+}
+
+type countrySet struct {
+	allow map[string]bool
+	block map[string]bool
+}
+
+// addrSet matches single addresses in O(1) and CIDR blocks linearly (block
+// lists are short; single addresses are the bulk of any real list).
+type addrSet struct {
+	addrs    map[netip.Addr]struct{}
+	prefixes []netip.Prefix
+}
+
+type banTable struct {
+	addrs    map[netip.Addr]Ban
+	prefixes []Ban
+	nets     []netip.Prefix // parallel to prefixes
+}
+
+// NewGuard returns a Guard enforcing the built-in defaults (enabled, no
+// static rules, default auto-ban thresholds) until the first policy push.
+func NewGuard(name string) *Guard {
+	g := &Guard{
+		name:      name,
+		now:       time.Now,
+		domains:   map[string]compiled{},
+		local:     map[string]localBan{},
+		offenders: map[string]*offense{},
+	}
+	g.Update(Policy{Enabled: true})
+	return g
+}
+
+// Update replaces the policy. A ban this daemon raised is dropped locally
+// once the pushed policy carries it, which is authoritative from then on,
+// once an operator has lifted it, or once it has expired. A push without it
+// may predate the orchestrator's merge, so it changes nothing.
+func (g *Guard) Update(p Policy) {
+	global := compiled{
+		white:     parseSet(p.Whitelist),
+		black:     parseSet(p.Blacklist),
+		countries: parseCountries(&p.Countries),
+	}
+	domains := make(map[string]compiled, len(p.Domains))
+	for name, rule := range p.Domains {
+		c := compiled{
+			white:     parseSet(rule.Whitelist),
+			black:     parseSet(rule.Blacklist),
+			countries: global.countries,
+		}
+		if rule.Countries != nil {
+			c.countries = parseCountries(rule.Countries)
+		}
+		domains[strings.ToLower(name)] = c
+	}
+	bans := buildBans(p.Bans)
+	pushed := make(map[string]bool, len(p.Bans))
+	for _, b := range p.Bans {
+		pushed[b.IP] = true
+	}
+	now := g.now()
+
+	g.mu.Lock()
+	g.policy = p
+	g.global = global
+	g.domains = domains
+	g.bans = bans
+	for ip, lb := range g.local {
+		lifted, ok := p.Lifted[ip]
+		if pushed[ip] || (ok && lifted >= lb.ban.Created) || lb.ban.Expired(now) {
+			delete(g.local, ip)
+		}
+	}
+	g.mu.Unlock()
+
+	g.loadGeo(p.GeoIP)
+}
+
+// loadGeo (re)opens the country database when its path or mtime changed.
+// A missing or broken file disables country rules with a log line; it never
+// fails the policy push.
+func (g *Guard) loadGeo(path string) {
+	var mod time.Time
+	if path != "" {
+		if st, err := os.Stat(path); err == nil {
+			mod = st.ModTime()
+		}
+	}
+	g.mu.RLock()
+	same := path == g.geoPath && mod.Equal(g.geoMod)
+	g.mu.RUnlock()
+	if same {
+		return
+	}
+
+	var db *GeoDB
+	if path != "" {
+		var err error
+		if db, err = OpenGeoDB(path); err != nil {
+			log.Printf("[%s-FW] GeoIP database unavailable (%s): %v", g.name, path, err)
+			db = nil
+		} else {
+			log.Printf("[%s-FW] GeoIP database loaded: %s", g.name, path)
+		}
+	}
+	g.mu.Lock()
+	g.geo, g.geoPath, g.geoMod = db, path, mod
+	g.mu.Unlock()
+}
+
+// Enabled reports whether the pushed policy is switched on.
+func (g *Guard) Enabled() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.policy.Enabled
+}
+
+// Check decides whether ip may reach domain ("" for daemons without a
+// Host). It returns false plus a short reason when the address is blocked.
+// Order: whitelists, bans, blacklists, country rules.
+func (g *Guard) Check(ip, domain string) (bool, string) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return true, ""
+	}
+	addr = addr.Unmap()
+	now := g.now()
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if !g.policy.Enabled {
+		return true, ""
+	}
+
+	rules := g.global
+	override, hasOverride := g.lookupDomain(domain)
+	if hasOverride {
+		rules.countries = override.countries
+	}
+
+	if g.global.white.contains(addr) || (hasOverride && override.white.contains(addr)) {
+		return true, ""
+	}
+	if ban, ok := g.bans.match(addr); ok && !ban.Expired(now) {
+		return false, "banned"
+	}
+	if lb, ok := g.local[addr.String()]; ok && !lb.ban.Expired(now) {
+		return false, "banned"
+	}
+	if g.global.black.contains(addr) || (hasOverride && override.black.contains(addr)) {
+		return false, "blacklisted"
+	}
+	if rules.countries != nil && g.geo != nil {
+		if code := g.geo.Country(addr); code != "" {
+			if rules.countries.block[code] {
+				return false, "country " + code
+			}
+			if len(rules.countries.allow) > 0 && !rules.countries.allow[code] {
+				return false, "country " + code
+			}
+		}
+	}
+	return true, ""
+}
+
+// lookupDomain finds the override for domain or its closest configured
+// parent. Caller holds g.mu.
+func (g *Guard) lookupDomain(domain string) (compiled, bool) {
+	if domain == "" || len(g.domains) == 0 {
+		return compiled{}, false
+	}
+	domain = strings.TrimPrefix(strings.ToLower(domain), "www.")
+	for {
+		if c, ok := g.domains[domain]; ok {
+			return c, true
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return compiled{}, false
+		}
+		domain = domain[i+1:]
+	}
+}
+
+// Record counts one event for ip and bans the address once the event's
+// auto-ban rule trips. It reports whether this call raised a ban.
+// Whitelisted addresses are never counted.
+func (g *Guard) Record(event, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	now := g.now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.policy.Enabled || g.global.white.contains(addr) {
+		return false
+	}
+	rule := g.policy.rule(event)
+	if rule.Threshold <= 0 {
+		return false
+	}
+
+	key := event + "|" + addr.String()
+	off := g.offenders[key]
+	if off == nil || now.Sub(off.start) > time.Duration(rule.Window)*time.Second {
+		if off == nil && len(g.offenders) >= maxTracked {
+			g.pruneLocked(now)
+		}
+		off = &offense{start: now}
+		g.offenders[key] = off
+	}
+	off.count++
+	if off.count <= rule.Threshold {
+		return false
+	}
+	delete(g.offenders, key)
+
+	ban := Ban{IP: addr.String(), Reason: event + " threshold exceeded", Source: event, Created: now.UnixMilli()}
+	if rule.Duration > 0 {
+		ban.Until = now.Add(time.Duration(rule.Duration) * time.Second).UnixMilli()
+	}
+	g.banLocked(ban)
+	return true
+}
+
+// Forget clears an address's counter for an event (a successful login
+// resets its failed-attempt streak).
+func (g *Guard) Forget(event, ip string) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return
+	}
+	g.mu.Lock()
+	delete(g.offenders, event+"|"+addr.Unmap().String())
+	g.mu.Unlock()
+}
+
+// Ban blocks an address locally and queues it for the orchestrator.
+func (g *Guard) Ban(ban Ban) {
+	if ban.Created == 0 {
+		ban.Created = g.now().UnixMilli()
+	}
+	g.mu.Lock()
+	g.banLocked(ban)
+	g.mu.Unlock()
+}
+
+func (g *Guard) banLocked(ban Ban) {
+	if _, exists := g.local[ban.IP]; exists {
+		return
+	}
+	g.local[ban.IP] = localBan{ban: ban}
+	log.Printf("[%s-FW] Banning %s: %s", g.name, ban.IP, ban.Reason)
+}
+
+// DrainBans returns the bans raised here since the last drain, plus those
+// drained more than drainRetry ago that no push has carried yet. They stay
+// enforced locally until a policy push carries them.
+func (g *Guard) DrainBans() []Ban {
+	now := g.now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := []Ban{}
+	for ip, lb := range g.local {
+		if !lb.drainedAt.IsZero() && now.Sub(lb.drainedAt) < drainRetry {
+			continue
+		}
+		out = append(out, lb.ban)
+		lb.drainedAt = now
+		g.local[ip] = lb
+	}
+	return out
+}
+
+// Prune drops expired local bans and stale counters. Daemons call it from
+// their existing cleanup loops.
+func (g *Guard) Prune() {
+	g.mu.Lock()
+	g.pruneLocked(g.now())
+	g.mu.Unlock()
+}
+
+func (g *Guard) pruneLocked(now time.Time) {
+	for ip, lb := range g.local {
+		if lb.ban.Expired(now) {
+			delete(g.local, ip)
+		}
+	}
+	for key, off := range g.offenders {
+		event := key[:strings.IndexByte(key, '|')]
+		if now.Sub(off.start) > time.Duration(g.policy.rule(event).Window)*time.Second {
+			delete(g.offenders, key)
+		}
+	}
+	if len(g.offenders) >= maxTracked {
+		g.offenders = map[string]*offense{}
+	}
+}
+
+// parseSet compiles IP / CIDR strings, skipping (and logging) garbage so a
+// typo in one entry never disables the rest of the list.
+func parseSet(list []string) addrSet {
+	s := addrSet{addrs: make(map[netip.Addr]struct{}, len(list))}
+	for _, raw := range list {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if strings.Contains(raw, "/") {
+			if p, err := netip.ParsePrefix(raw); err == nil {
+				s.prefixes = append(s.prefixes, p.Masked())
+				continue
+			}
+		} else if a, err := netip.ParseAddr(raw); err == nil {
+			s.addrs[a.Unmap()] = struct{}{}
+			continue
+		}
+		log.Printf("[FW] Ignoring invalid firewall entry %q", raw)
+	}
+	return s
+}
+
+func (s addrSet) contains(a netip.Addr) bool {
+	if _, ok := s.addrs[a]; ok {
+		return true
+	}
+	for _, p := range s.prefixes {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCountries(c *Countries) *countrySet {
+	if c == nil || (len(c.Allow) == 0 && len(c.Block) == 0) {
+		return nil
+	}
+	set := &countrySet{allow: map[string]bool{}, block: map[string]bool{}}
+	for _, code := range c.Allow {
+		set.allow[strings.ToUpper(strings.TrimSpace(code))] = true
+	}
+	for _, code := range c.Block {
+		set.block[strings.ToUpper(strings.TrimSpace(code))] = true
+	}
+	return set
+}
+
+func buildBans(list []Ban) banTable {
+	t := banTable{addrs: make(map[netip.Addr]Ban, len(list))}
+	for _, b := range list {
+		if p, err := netip.ParsePrefix(b.IP); err == nil {
+			t.prefixes = append(t.prefixes, b)
+			t.nets = append(t.nets, p.Masked())
+		} else if a, err := netip.ParseAddr(b.IP); err == nil {
+			t.addrs[a.Unmap()] = b
+		}
+	}
+	return t
+}
+
+func (t banTable) match(a netip.Addr) (Ban, bool) {
+	if b, ok := t.addrs[a]; ok {
+		return b, true
+	}
+	for i, p := range t.nets {
+		if p.Contains(a) {
+			return t.prefixes[i], true
+		}
+	}
+	return Ban{}, false
+}
+
+// ValidTarget reports whether s is an IP address or CIDR block, normalizing
+// it (IPv4-mapped addresses unmapped, prefixes masked).
+func ValidTarget(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return "", false
+		}
+		return p.Masked().String(), true
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return "", false
+	}
+	return a.Unmap().String(), true
+}
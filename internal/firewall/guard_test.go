@@ -0,0 +1,173 @@
+package firewall
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestGuard(p Policy) (*Guard, *time.Time) {
+	now := time.UnixMilli(1_700_000_000_000)
+	g := NewGuard("Test")
+	g.now = func() time.Time { return now }
+	g.Update(p)
+	return g, &now
+}
+
+func TestGuardListsAndCIDR(t *testing.T) {
+	g, _ := newTestGuard(Policy{
+		Enabled:   true,
+		Blacklist: []string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32", "not-an-ip"},
+		Whitelist: []string{"10.1.2.3"},
+		Domains: map[string]DomainRule{
+			"example.com": {Blacklist: []string{"198.51.100.0/24"}},
+		},
+	})
+
+	cases := []struct {
+		ip, domain string
+		want       bool
+	}{
+		{"10.9.9.9", "", false},
+		{"10.1.2.3", "", true}, // whitelist beats the /8
+		{"192.0.2.7", "", false},
+		{"::ffff:192.0.2.7", "", false},
+		{"192.0.2.8", "", true},
+		{"2001:db8::1", "", false},
+		{"198.51.100.5", "shop.example.com", false},
+		{"198.51.100.5", "other.org", true},
+		{"garbage", "", true},
+	}
+	for _, c := range cases {
+		if ok, _ := g.Check(c.ip, c.domain); ok != c.want {
+			t.Errorf("Check(%s, %q) = %v, want %v", c.ip, c.domain, ok, c.want)
+		}
+	}
+
+	g.Update(Policy{Enabled: false, Blacklist: []string{"10.0.0.0/8"}})
+	if ok, _ := g.Check("10.9.9.9", ""); !ok {
+		t.Error("disabled policy still blocks")
+	}
+}
+
+func TestGuardPushedBans(t *testing.T) {
+	g, now := newTestGuard(Policy{})
+	g.Update(Policy{Enabled: true, Bans: []Ban{
+		{IP: "203.0.113.0/24"},
+		{IP: "198.51.100.9", Until: now.Add(time.Minute).UnixMilli()},
+	}})
+	if ok, reason := g.Check("203.0.113.200", ""); ok || reason != "banned" {
+		t.Errorf("CIDR ban not enforced: %v %q", ok, reason)
+	}
+	if ok, _ := g.Check("198.51.100.9", ""); ok {
+		t.Error("timed ban not enforced")
+	}
+	*now = now.Add(2 * time.Minute)
+	if ok, _ := g.Check("198.51.100.9", ""); !ok {
+		t.Error("expired ban still enforced")
+	}
+}
+
+func TestGuardAutoBan(t *testing.T) {
+	g, now := newTestGuard(Policy{
+		Enabled:   true,
+		Whitelist: []string{"192.0.2.1"},
+		AutoBan:   map[string]AutoBanRule{EventHTTP4xx: {Threshold: 2, Window: 60, Duration: 600}},
+	})
+
+	ip := "198.51.100.1"
+	if g.Record(EventHTTP4xx, ip) || g.Record(EventHTTP4xx, ip) {
+		t.Fatal("banned at the threshold; only exceeding it should ban")
+	}
+	if !g.Record(EventHTTP4xx, ip) {
+		t.Fatal("third event did not ban")
+	}
+	if ok, _ := g.Check(ip, ""); ok {
+		t.Error("auto-banned address still allowed")
+	}
+	for i := 0; i < 5; i++ {
+		if g.Record(EventHTTP4xx, "192.0.2.1") {
+			t.Fatal("whitelisted address was banned")
+		}
+	}
+
+	bans := g.DrainBans()
+	if len(bans) != 1 || bans[0].IP != ip || bans[0].Source != EventHTTP4xx {
+		t.Fatalf("drained = %+v", bans)
+	}
+	if want := now.Add(600 * time.Second).UnixMilli(); bans[0].Until != want {
+		t.Errorf("until = %d, want %d", bans[0].Until, want)
+	}
+	if again := g.DrainBans(); len(again) != 0 {
+		t.Errorf("second drain returned %+v", again)
+	}
+
+	// A push that predates the orchestrator's merge keeps the drained ban.
+	g.Update(Policy{Enabled: true})
+	if ok, _ := g.Check(ip, ""); ok {
+		t.Error("drained ban dropped by a push that does not carry it")
+	}
+	// A lost drain response: the ban is offered again after drainRetry.
+	*now = now.Add(drainRetry)
+	if again := g.DrainBans(); len(again) != 1 || again[0].IP != ip {
+		t.Fatalf("unconfirmed ban not offered again: %+v", again)
+	}
+
+	// Once a push carries it, the policy is authoritative.
+	g.Update(Policy{Enabled: true, Bans: bans})
+	g.Update(Policy{Enabled: true})
+	if ok, _ := g.Check(ip, ""); !ok {
+		t.Error("ban lifted by the orchestrator is still enforced")
+	}
+	if again := g.DrainBans(); len(again) != 0 {
+		t.Errorf("confirmed ban offered again: %+v", again)
+	}
+
+	// An operator lifting a ban the daemon still holds unconfirmed.
+	other := "198.51.100.9"
+	g.Ban(Ban{IP: other, Source: EventHTTP4xx})
+	g.DrainBans()
+	g.Update(Policy{Enabled: true, Lifted: map[string]int64{other: now.UnixMilli()}})
+	if ok, _ := g.Check(other, ""); !ok {
+		t.Error("lifted ban still enforced")
+	}
+}
+
+func TestGuardAutoBanWindow(t *testing.T) {
+	g, now := newTestGuard(Policy{
+		Enabled: true,
+		AutoBan: map[string]AutoBanRule{EventDNSFlood: {Threshold: 1, Window: 10}},
+	})
+	ip := "198.51.100.2"
+	g.Record(EventDNSFlood, ip)
+	*now = now.Add(11 * time.Second)
+	if g.Record(EventDNSFlood, ip) {
+		t.Error("events in different windows were added up")
+	}
+	g.Forget(EventDNSFlood, ip)
+	if g.Record(EventDNSFlood, ip) {
+		t.Error("Forget did not reset the counter")
+	}
+	if !g.Record(EventDNSFlood, ip) {
+		t.Error("threshold exceeded without a ban")
+	}
+	if bans := g.DrainBans(); len(bans) != 1 || bans[0].Until != 0 {
+		t.Errorf("zero duration should ban permanently: %+v", bans)
+	}
+}
+
+func TestValidTarget(t *testing.T) {
+	cases := map[string]string{
+		"192.0.2.7":        "192.0.2.7",
+		" ::ffff:10.0.0.1": "10.0.0.1",
+		"10.1.2.3/8":       "10.0.0.0/8",
+		"2001:db8::1/32":   "2001:db8::/32",
+		"example.com":      "",
+		"10.0.0.0/99":      "",
+	}
+	for in, want := range cases {
+		got, ok := ValidTarget(in)
+		if ok != (want != "") || got != want {
+			t.Errorf("ValidTarget(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+}
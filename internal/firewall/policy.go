@@ -0,0 +1,103 @@
+// Package firewall is the IP policy engine shared by the three data-plane
+// daemons (odac-proxy, odac-mail, odac-dns). The orchestrator owns the
+// policy in the `firewall` config module and pushes it to every daemon over
+// its control socket (POST /firewall); each daemon compiles it into a Guard
+// and consults that on its hot path.
+//
+// One policy, three enforcement points:
+//
+//   - Static rules: blacklist/whitelist entries are single IPs or CIDR
+//     blocks, optionally overridden per domain (proxy only: mail and DNS
+//     have no Host to key on and always use the global lists).
+//   - Country rules: allow/block lists of ISO 3166 codes resolved through a
+//     local MaxMind-format database (geoip.go). No database, no country
+//     blocking: an unresolvable address is never blocked on country alone.
+//   - Bans: time-limited (or permanent) entries written by `odac firewall
+//     ban` or raised automatically. A daemon that sees an offender cross an
+//     auto-ban threshold (IMAP/SMTP auth failures, HTTP 4xx floods, DNS
+//     floods) bans it locally at once and queues the ban; the orchestrator
+//     drains the queue on its tick (GET /firewall/bans), persists it and
+//     pushes the merged policy back out, so one daemon's ban reaches the
+//     other two and survives restarts.
+package firewall
+
+import "time"
+
+// Event names reported by the daemons. Each maps to an AutoBanRule.
+const (
+	EventMailAuth = "mail.auth" // failed SMTP/IMAP authentication
+	EventHTTP4xx  = "http.4xx"  // client error response from the proxy
+	EventDNSFlood = "dns.flood" // DNS query rate limit exceeded
+)
+
+// Policy is the wire shape of the `firewall` config key as every daemon
+// receives it. Unknown keys (the proxy's rateLimit, maxWsPerIp, ...) are
+// ignored here and decoded by the daemon that owns them.
+type Policy struct {
+	Enabled   bool                   `json:"enabled"`
+	Blacklist []string               `json:"blacklist"`
+	Whitelist []string               `json:"whitelist"`
+	Countries Countries              `json:"countries"`
+	GeoIP     string                 `json:"geoip,omitempty"` // resolved .mmdb path; set by the orchestrator
+	Domains   map[string]DomainRule  `json:"domains,omitempty"`
+	Bans      []Ban                  `json:"bans,omitempty"`
+	Lifted    map[string]int64       `json:"lifted,omitempty"` // IP -> Unix ms an operator lifted its ban
+	AutoBan   map[string]AutoBanRule `json:"autoBan,omitempty"`
+}
+
+// Countries holds ISO 3166-1 alpha-2 codes. A non-empty Allow list blocks
+// every resolvable country not on it; Block always wins over Allow.
+type Countries struct {
+	Allow []string `json:"allow,omitempty"`
+	Block []string `json:"block,omitempty"`
+}
+
+// DomainRule overrides the global lists for one domain and its subdomains.
+// Lists are additive to the global ones; Countries, when set, replaces the
+// global country rule for that domain.
+type DomainRule struct {
+	Blacklist []string   `json:"blacklist,omitempty"`
+	Whitelist []string   `json:"whitelist,omitempty"`
+	Countries *Countries `json:"countries,omitempty"`
+}
+
+// Ban blocks one address or CIDR block. Until is a Unix millisecond
+// deadline; zero means permanent.
+type Ban struct {
+	IP      string `json:"ip"`
+	Until   int64  `json:"until"`
+	Reason  string `json:"reason,omitempty"`
+	Source  string `json:"source,omitempty"` // "manual", or the event that raised it
+	Created int64  `json:"created,omitempty"`
+}
+
+// Expired reports whether a timed ban has run out at now.
+func (b Ban) Expired(now time.Time) bool {
+	return b.Until > 0 && now.UnixMilli() >= b.Until
+}
+
+// AutoBanRule bans an address that produces more than Threshold events
+// within Window seconds, for Duration seconds (0 = permanent). Threshold <= 0
+// disables the rule.
+type AutoBanRule struct {
+	Threshold int `json:"threshold"`
+	Window    int `json:"window"`
+	Duration  int `json:"duration"`
+}
+
+// DefaultAutoBan are the rules applied for events the policy does not
+// mention. mail.auth keeps the thresholds the mail daemon always had (more
+// than 5 failures within an hour bans for a day).
+var DefaultAutoBan = map[string]AutoBanRule{
+	EventMailAuth: {Threshold: 5, Window: 3600, Duration: 86400},
+	EventHTTP4xx:  {Threshold: 300, Window: 60, Duration: 3600},
+	EventDNSFlood: {Threshold: 3, Window: 600, Duration: 3600},
+}
+
+// rule returns the effective auto-ban rule for an event.
+func (p *Policy) rule(event string) AutoBanRule {
+	if r, ok := p.AutoBan[event]; ok {
+		return r
+	}
+	return DefaultAutoBan[event]
+}
@@ -152,6 +152,8 @@ type Hub struct {
 
 	bg sync.WaitGroup
 
+	auditor api.Auditor
+
 	mu       sync.Mutex
 	active   bool
 	commands map[string]*command
@@ -216,6 +218,9 @@ func (h *Hub) register(name string, c *command) {
 	h.order = append(h.order, name)
 }
 
+// SetAuditor wires the audit log for inbound commands. Call it before Start.
+func (h *Hub) SetAuditor(a api.Auditor) { h.auditor = a }
+
 // Start ports start().
 func (h *Hub) Start() {
 	h.mu.Lock()
@@ -342,6 +347,7 @@ func (h *Hub) processCommand(action string, payload any, requestID any) {
 	h.mu.Unlock()
 
 	result, err := runFn(cmd.fn, payload)
+	h.audit(action, payload, requestID, result, err)
 	if err != nil {
 		h.log.Log("Command execution failed: %s", err.Error())
 		if jsTruthy(requestID) {
@@ -361,6 +367,25 @@ func (h *Hub) processCommand(action string, payload any, requestID any) {
 	}
 }
 
+// audit records one command with the Hub request ID as the caller.
+func (h *Hub) audit(action string, payload, requestID, result any, err error) {
+	if h.auditor == nil {
+		return
+	}
+	caller := api.Caller{Kind: "hub"}
+	if jsTruthy(requestID) {
+		caller.Name = fmt.Sprint(requestID)
+	}
+	var r api.Result
+	if err != nil {
+		r = api.Res(false, err.Error())
+	} else {
+		n := normalizeResult(result)
+		r = api.Res(n.success == nil || jsTruthy(n.success), n.message)
+	}
+	h.auditor.Record("hub", action, caller, []any{payload}, &r)
+}
+
 // cmdResult is the normalized {success, message, data} triple feeding
 // command.response, with JS-undefined tracked per field.
 type cmdResult struct {
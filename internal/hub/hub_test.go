@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -1231,3 +1232,37 @@ func TestNormalizeResultShapes(t *testing.T) {
 		t.Errorf("map: %+v", r)
 	}
 }
+
+type recordingAuditor struct {
+	mu      sync.Mutex
+	callers []api.Caller
+	actions []string
+	status  []bool
+}
+
+func (r *recordingAuditor) Record(source, action string, caller api.Caller, _ []any, res *api.Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if source == "hub" {
+		r.callers = append(r.callers, caller)
+		r.actions = append(r.actions, action)
+		r.status = append(r.status, res.Status)
+	}
+}
+
+func TestCommandsAreAudited(t *testing.T) {
+	fx := newHubFixture(t, func(f *hubFixture) { f.noMail = true })
+	auditor := &recordingAuditor{}
+	fx.h.SetAuditor(auditor)
+
+	fx.h.processCommand("app.stop", map[string]any{"id": "web"}, "req-1")
+	fx.h.processCommand("mail.delete", map[string]any{"email": "a@example.com"}, float64(7))
+	fx.waitIdle()
+
+	auditor.mu.Lock()
+	defer auditor.mu.Unlock()
+	want := []api.Caller{{Kind: "hub", Name: "req-1"}, {Kind: "hub", Name: "7"}}
+	if !reflect.DeepEqual(auditor.callers, want) || !reflect.DeepEqual(auditor.status, []bool{true, false}) {
+		t.Errorf("audit = %v %v %v", auditor.actions, auditor.callers, auditor.status)
+	}
+}
@@ -0,0 +1,299 @@
+package logship
+
+import (
+	"errors"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"odac/internal/api"
+	"odac/internal/lang"
+)
+
+var __ = lang.T
+
+const configKey = "logShipping"
+
+var (
+	sinkNameRe  = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+	labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// SinkConfig is one configured destination.
+type SinkConfig struct {
+	Name    string
+	Type    string // "syslog", "loki" or "otlp"
+	URL     string
+	Headers map[string]string // HTTP sinks; values may be secret:// references
+	Labels  map[string]string // added to every line
+	Apps    []string          // empty for every app
+	Daemon  bool              // ship ODAC's own logs too
+}
+
+func (c SinkConfig) equal(o SinkConfig) bool {
+	return c.Name == o.Name && c.Type == o.Type && c.URL == o.URL && c.Daemon == o.Daemon &&
+		maps.Equal(c.Headers, o.Headers) && maps.Equal(c.Labels, o.Labels) && slices.Equal(c.Apps, o.Apps)
+}
+
+// sinkConfigs reads the sinks of the logShipping setting, skipping entries
+// a hand edit left unusable.
+func sinkConfigs(settings map[string]any) []SinkConfig {
+	list, _ := settings["sinks"].([]any)
+	var out []SinkConfig
+	for _, item := range list {
+		raw, _ := item.(map[string]any)
+		if raw == nil {
+			continue
+		}
+		conf := SinkConfig{
+			Headers: stringMap(raw["headers"]),
+			Labels:  stringMap(raw["labels"]),
+			Daemon:  raw["daemon"] != false,
+		}
+		conf.Name, _ = raw["name"].(string)
+		conf.Type, _ = raw["type"].(string)
+		conf.URL, _ = raw["url"].(string)
+		if apps, _ := raw["apps"].([]any); apps != nil {
+			for _, a := range apps {
+				if name, _ := a.(string); name != "" {
+					conf.Apps = append(conf.Apps, name)
+				}
+			}
+		}
+		if validateSink(conf) == nil {
+			out = append(out, conf)
+		}
+	}
+	return out
+}
+
+func stringMap(v any) map[string]string {
+	raw, _ := v.(map[string]any)
+	if len(raw) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(raw))
+	for k, val := range raw {
+		if s, ok := val.(string); ok {
+			out[k] = s
+		}
+	}
+	return out
+}
+
+func validateSink(c SinkConfig) error {
+	if !sinkNameRe.MatchString(c.Name) {
+		return errors.New(__("Invalid sink name. Use up to 32 lowercase letters, digits and hyphens."))
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host == "" {
+		return errors.New(__("Invalid sink URL %s.", c.URL))
+	}
+	switch c.Type {
+	case "syslog":
+		if u.Scheme != "udp" && u.Scheme != "tcp" && u.Scheme != "tls" {
+			return errors.New(__("A syslog sink URL starts with udp://, tcp:// or tls://."))
+		}
+	case "loki", "otlp":
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.New(__("A %s sink URL starts with http:// or https://.", c.Type))
+		}
+	default:
+		return errors.New(__("Unknown sink type %s. Use syslog, loki or otlp.", c.Type))
+	}
+	for name := range c.Labels {
+		if !labelNameRe.MatchString(name) {
+			return errors.New(__("Invalid label name %s.", name))
+		}
+	}
+	return nil
+}
+
+// displayURL hides a password in a sink URL.
+func displayURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "***")
+	}
+	return u.String()
+}
+
+// List reports the sinks with their delivery state. Header values are not
+// shown.
+func (s *Shipper) List() api.Result {
+	var confs []SinkConfig
+	s.cfg.View(func() {
+		confs = sinkConfigs(s.cfg.Map(configKey))
+	})
+	s.mu.Lock()
+	running := maps.Clone(s.sinks)
+	s.mu.Unlock()
+
+	rows := []any{}
+	for _, c := range confs {
+		headers := make([]string, 0, len(c.Headers))
+		for name := range c.Headers {
+			headers = append(headers, name)
+		}
+		sort.Strings(headers)
+		apps := "*"
+		if len(c.Apps) > 0 {
+			apps = strings.Join(c.Apps, ",")
+		}
+		row := map[string]any{
+			"name": c.Name, "type": c.Type, "url": displayURL(c.URL),
+			"apps": apps, "daemon": c.Daemon, "headers": strings.Join(headers, ","),
+		}
+		if sk := running[c.Name]; sk != nil {
+			st := sk.status()
+			row["sent"], row["spooled"], row["dropped"], row["error"] = st.sent, st.spooled, st.dropped, st.lastError
+		}
+		rows = append(rows, row)
+	}
+	return api.Res(true, rows)
+}
+
+// AddSink creates or replaces a sink. opts holds type and url, and
+// optionally headers, labels, apps and daemon (default true).
+func (s *Shipper) AddSink(nameArg, optsArg any) api.Result {
+	name, _ := nameArg.(string)
+	opts, _ := optsArg.(map[string]any)
+	conf := SinkConfig{Name: name, Headers: stringMap(opts["headers"]), Labels: stringMap(opts["labels"]), Daemon: opts["daemon"] != false}
+	conf.Type, _ = opts["type"].(string)
+	conf.URL, _ = opts["url"].(string)
+	var apps []any
+	if list, _ := opts["apps"].([]any); list != nil {
+		for _, a := range list {
+			if app, _ := a.(string); app != "" {
+				conf.Apps = append(conf.Apps, app)
+				apps = append(apps, app)
+			}
+		}
+	}
+	if err := validateSink(conf); err != nil {
+		return api.Res(false, err.Error())
+	}
+
+	entry := map[string]any{"name": conf.Name, "type": conf.Type, "url": conf.URL}
+	if len(conf.Headers) > 0 {
+		entry["headers"] = opts["headers"]
+	}
+	if len(conf.Labels) > 0 {
+		entry["labels"] = opts["labels"]
+	}
+	if len(apps) > 0 {
+		entry["apps"] = apps
+	}
+	if !conf.Daemon {
+		entry["daemon"] = false
+	}
+	replaced := false
+	s.cfg.Mutate(func() {
+		settings := s.cfg.Map(configKey)
+		if settings == nil {
+			settings = map[string]any{}
+		}
+		list, _ := settings["sinks"].([]any)
+		next := make([]any, 0, len(list)+1)
+		for _, item := range list {
+			if raw, _ := item.(map[string]any); raw != nil && raw["name"] == conf.Name {
+				replaced = true
+				continue
+			}
+			next = append(next, item)
+		}
+		settings["sinks"] = append(next, entry)
+		s.cfg.Set(configKey, settings)
+	})
+	s.reload()
+	if replaced {
+		return api.Res(true, __("Log sink %s updated.", conf.Name))
+	}
+	return api.Res(true, __("Log sink %s added.", conf.Name))
+}
+
+// DeleteSink removes a sink and its spool.
+func (s *Shipper) DeleteSink(nameArg any) api.Result {
+	name, _ := nameArg.(string)
+	found := false
+	s.cfg.Mutate(func() {
+		settings := s.cfg.Map(configKey)
+		list, _ := settings["sinks"].([]any)
+		next := make([]any, 0, len(list))
+		for _, item := range list {
+			if raw, _ := item.(map[string]any); raw != nil && raw["name"] == name {
+				found = true
+				continue
+			}
+			next = append(next, item)
+		}
+		if found {
+			settings["sinks"] = next
+			s.cfg.Set(configKey, settings)
+		}
+	})
+	if !found {
+		return api.Res(false, __("Log sink %s not found.", name))
+	}
+	s.reload()
+	if sinkNameRe.MatchString(name) {
+		removeSpool(s.spoolDir, name)
+	}
+	return api.Res(true, __("Log sink %s deleted.", name))
+}
+
+// SetLabels merges labels into an app's shipped-log labels; a null value
+// removes that label. Without labels it reports the current ones.
+func (s *Shipper) SetLabels(appArg, labelsArg any) api.Result {
+	app, _ := appArg.(string)
+	if app == "" {
+		return api.Res(false, __("App name is required."))
+	}
+	changes, _ := labelsArg.(map[string]any)
+	for name, v := range changes {
+		if _, ok := v.(string); !labelNameRe.MatchString(name) || (!ok && v != nil) {
+			return api.Res(false, __("Invalid label %s.", name))
+		}
+	}
+	current := map[string]any{}
+	s.cfg.Mutate(func() {
+		settings := s.cfg.Map(configKey)
+		byApp, _ := settings["labels"].(map[string]any)
+		if existing, _ := byApp[app].(map[string]any); existing != nil {
+			maps.Copy(current, existing)
+		}
+		if len(changes) == 0 {
+			return
+		}
+		for name, v := range changes {
+			if v == nil {
+				delete(current, name)
+			} else {
+				current[name] = v
+			}
+		}
+		if settings == nil {
+			settings = map[string]any{}
+		}
+		if byApp == nil {
+			byApp = map[string]any{}
+		}
+		if len(current) == 0 {
+			delete(byApp, app)
+		} else {
+			byApp[app] = maps.Clone(current)
+		}
+		settings["labels"] = byApp
+		s.cfg.Set(configKey, settings)
+	})
+	if len(changes) > 0 {
+		s.reload()
+	}
+	return api.Res(true, current)
+}
@@ -0,0 +1,197 @@
+package logship
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const httpTimeout = 15 * time.Second
+
+// attributes are the labels a line carries to every sink: where it comes
+// from and its stream, then the sink's labels, then the app's.
+func attributes(e Entry, static map[string]string) map[string]string {
+	out := map[string]string{"stream": e.Stream}
+	if e.App != "" {
+		out["source"], out["app"] = "app", e.App
+	} else {
+		out["source"], out["service"] = "daemon", e.Service
+	}
+	for k, v := range static {
+		out[k] = v
+	}
+	for k, v := range e.Labels {
+		out[k] = v
+	}
+	return out
+}
+
+// postJSON sends payload and treats any non-2xx answer as a failure. Errors
+// name the endpoint without its credentials and never quote the response.
+func postJSON(client *http.Client, endpoint string, headers map[string]string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("POST %s: %w", displayURL(endpoint), err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: HTTP %d", displayURL(endpoint), resp.StatusCode)
+	}
+	return nil
+}
+
+// lokiSender pushes to Loki's /loki/api/v1/push, one stream per label set.
+type lokiSender struct {
+	url      string
+	headers  map[string]string
+	labels   map[string]string
+	hostname string
+	client   *http.Client
+}
+
+func newLoki(conf SinkConfig, headers map[string]string, hostname string) *lokiSender {
+	return &lokiSender{url: conf.URL, headers: headers, labels: conf.Labels, hostname: hostname, client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (s *lokiSender) send(batch []Entry) error {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	var streams []*stream
+	byKey := map[string]*stream{}
+	for _, e := range batch {
+		labels := attributes(e, s.labels)
+		labels["host"] = s.hostname
+		key := labelKey(labels)
+		st := byKey[key]
+		if st == nil {
+			st = &stream{Stream: labels}
+			byKey[key] = st
+			streams = append(streams, st)
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), e.Text})
+	}
+	return postJSON(s.client, s.url, s.headers, map[string]any{"streams": streams})
+}
+
+func (s *lokiSender) close() {}
+
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + strconv.Quote(labels[k]) + ",")
+	}
+	return b.String()
+}
+
+// otlpSender posts OTLP/HTTP JSON to a collector's /v1/logs, one resource
+// per app or daemon.
+type otlpSender struct {
+	url      string
+	headers  map[string]string
+	labels   map[string]string
+	hostname string
+	client   *http.Client
+}
+
+func newOTLP(conf SinkConfig, headers map[string]string, hostname string) *otlpSender {
+	return &otlpSender{url: conf.URL, headers: headers, labels: conf.Labels, hostname: hostname, client: &http.Client{Timeout: httpTimeout}}
+}
+
+type otlpAttr struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+func otlpAttrs(m map[string]string) []otlpAttr {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]otlpAttr, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, otlpAttr{Key: k, Value: map[string]string{"stringValue": m[k]}})
+	}
+	return out
+}
+
+func (s *otlpSender) send(batch []Entry) error {
+	type record struct {
+		TimeUnixNano   string            `json:"timeUnixNano"`
+		SeverityNumber int               `json:"severityNumber"`
+		SeverityText   string            `json:"severityText"`
+		Body           map[string]string `json:"body"`
+		Attributes     []otlpAttr        `json:"attributes"`
+	}
+	type resourceLogs struct {
+		Resource  map[string]any   `json:"resource"`
+		ScopeLogs []map[string]any `json:"scopeLogs"`
+		records   []record
+	}
+	var resources []*resourceLogs
+	byService := map[string]*resourceLogs{}
+	for _, e := range batch {
+		service := e.App
+		if service == "" {
+			service = "odac-" + e.Service
+		}
+		rl := byService[service]
+		if rl == nil {
+			rl = &resourceLogs{Resource: map[string]any{"attributes": otlpAttrs(map[string]string{
+				"service.name": service,
+				"host.name":    s.hostname,
+			})}}
+			byService[service] = rl
+			resources = append(resources, rl)
+		}
+		severity, text := 9, "INFO"
+		if e.Stream == "err" {
+			severity, text = 17, "ERROR"
+		}
+		rl.records = append(rl.records, record{
+			TimeUnixNano:   strconv.FormatInt(e.Time.UnixNano(), 10),
+			SeverityNumber: severity,
+			SeverityText:   text,
+			Body:           map[string]string{"stringValue": e.Text},
+			Attributes:     otlpAttrs(attributes(e, s.labels)),
+		})
+	}
+	for _, rl := range resources {
+		rl.ScopeLogs = []map[string]any{{"scope": map[string]string{"name": "odac"}, "logRecords": rl.records}}
+	}
+	return postJSON(s.client, s.url, s.headers, map[string]any{"resourceLogs": resources})
+}
+
+func (s *otlpSender) close() {}
@@ -0,0 +1,330 @@
+// Package logship forwards app runtime and build logs and ODAC's own daemon
+// logs to external sinks: RFC 5424 syslog over UDP, TCP or TLS, a Loki push
+// endpoint, or an OTLP/HTTP logs endpoint.
+//
+// Every line passes one dispatcher that masks sensitive env values and fans
+// it out to the sinks that want it. Each sink batches its lines and, while
+// its endpoint is unreachable, spools the batches under
+// <baseDir>/logs/spool/<sink> up to a size cap, dropping the oldest first.
+// Nothing on the logging path ever waits for the network.
+//
+// Sinks live under the "logShipping" config key:
+//
+//	{"sinks": [{"name", "type", "url", "headers", "labels", "apps", "daemon"}],
+//	 "labels": {app: {key: value}}, "spoolMB": 64}
+package logship
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odac/internal/applog"
+	"odac/internal/config"
+	"odac/internal/logx"
+)
+
+const (
+	inboxSize       = 8192
+	redactRefresh   = time.Minute
+	tailInterval    = 2 * time.Second
+	defaultSpoolMB  = 64
+	maxLineLength   = 16 * 1024
+	redactedValue   = "***"
+	daemonLogSuffix = ".log"
+)
+
+// daemonLogs are the data-plane log files under <baseDir>/logs, tailed and
+// shipped as daemon logs of the service of the same name.
+var daemonLogs = []string{"proxy", "dns", "mail"}
+
+// Entry is one log line. App is set for app logs, Service ("server",
+// "proxy", "dns", "mail") for daemon logs. Stream is "out", "err" or
+// "build"; Labels are the app's labels.
+type Entry struct {
+	Time    time.Time         `json:"time"`
+	App     string            `json:"app,omitempty"`
+	Service string            `json:"service,omitempty"`
+	Stream  string            `json:"stream"`
+	Text    string            `json:"text"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// Redactor supplies the values to mask before a line leaves the host: the
+// values of an app's sensitive env vars, or of every app's for an empty
+// name. *appmgr.Manager provides it.
+type Redactor interface {
+	SensitiveValues(app string) []string
+}
+
+// SecretRevealer resolves secret:// references in sink headers.
+// *secrets.Store provides it.
+type SecretRevealer interface {
+	Reveal(name string) (string, error)
+}
+
+// Deps are the Shipper's collaborators. Either may be nil.
+type Deps struct {
+	Redactor Redactor
+	Secrets  SecretRevealer
+}
+
+// Shipper owns the configured sinks and the dispatcher feeding them.
+type Shipper struct {
+	cfg      *config.Store
+	deps     Deps
+	logsDir  string
+	spoolDir string
+	hostname string
+	log      *logx.Logger
+
+	inbox   chan Entry
+	dropped atomic.Int64
+
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	done    sync.WaitGroup
+	sinks   map[string]*sink
+	labels  map[string]map[string]string
+	redact  map[string]*redaction
+}
+
+type redaction struct {
+	replacer *strings.Replacer
+	at       time.Time
+}
+
+// New builds a Shipper for the config in cfg. Nothing runs until Start.
+func New(cfg *config.Store, deps Deps) *Shipper {
+	hostname, _ := os.Hostname()
+	logsDir := filepath.Join(cfg.BaseDir(), "logs")
+	return &Shipper{
+		cfg:      cfg,
+		deps:     deps,
+		logsDir:  logsDir,
+		spoolDir: filepath.Join(logsDir, "spool"),
+		hostname: hostname,
+		log:      logx.New("LogShip"),
+		inbox:    make(chan Entry, inboxSize),
+		sinks:    map[string]*sink{},
+		redact:   map[string]*redaction{},
+	}
+}
+
+// Start brings up the configured sinks, the dispatcher and the data-plane
+// log tailers.
+func (s *Shipper) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.stop = make(chan struct{})
+	s.mu.Unlock()
+
+	s.reload()
+	s.done.Add(2)
+	go s.dispatch()
+	go s.tailDaemonLogs()
+}
+
+// Stop halts the dispatcher and the sinks. Lines still buffered go to the
+// sinks' spools and are sent after the next Start.
+func (s *Shipper) Stop() {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = false
+	close(s.stop)
+	s.mu.Unlock()
+	s.done.Wait()
+
+	s.mu.Lock()
+	sinks := s.sinks
+	s.sinks = map[string]*sink{}
+	s.mu.Unlock()
+	for _, sk := range sinks {
+		sk.Stop()
+	}
+}
+
+// App is the applog tap: it ships every app runtime and build entry.
+func (s *Shipper) App(app string, stream applog.Stream, e applog.Entry) {
+	kind := e.T
+	if stream == applog.Build {
+		kind = "build"
+	}
+	s.ingest(Entry{Time: time.UnixMilli(e.TS), App: app, Stream: kind, Text: e.D})
+}
+
+// Writer returns an io.Writer that ships what is written to it as daemon
+// logs of service, for teeing logx output.
+func (s *Shipper) Writer(service, stream string) io.Writer {
+	return daemonWriter{s: s, service: service, stream: stream}
+}
+
+type daemonWriter struct {
+	s       *Shipper
+	service string
+	stream  string
+}
+
+func (w daemonWriter) Write(p []byte) (int, error) {
+	w.s.ingest(Entry{Time: time.Now(), Service: w.service, Stream: w.stream, Text: string(p)})
+	return len(p), nil
+}
+
+// ingest queues an entry without ever blocking the writer; when the
+// dispatcher falls that far behind, the entry is counted and dropped.
+func (s *Shipper) ingest(e Entry) {
+	select {
+	case s.inbox <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *Shipper) dispatch() {
+	defer s.done.Done()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case e := <-s.inbox:
+			s.route(e)
+		}
+	}
+}
+
+// route splits an entry into lines, masks them and hands them to the sinks
+// that take them.
+func (s *Shipper) route(e Entry) {
+	s.mu.Lock()
+	var targets []*sink
+	for _, sk := range s.sinks {
+		if sk.accepts(e) {
+			targets = append(targets, sk)
+		}
+	}
+	labels := s.labels[e.App]
+	s.mu.Unlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	replacer := s.replacerFor(e.App)
+	for _, text := range strings.Split(strings.TrimRight(e.Text, "\r\n"), "\n") {
+		text = strings.TrimRight(text, "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if len(text) > maxLineLength {
+			text = text[:maxLineLength]
+		}
+		if replacer != nil {
+			text = replacer.Replace(text)
+		}
+		line := e
+		line.Text = text
+		line.Labels = labels
+		for _, sk := range targets {
+			sk.push(line)
+		}
+	}
+}
+
+// replacerFor returns the cached masker for an app's lines, or for daemon
+// lines (every app's values), refreshed once a minute.
+func (s *Shipper) replacerFor(app string) *strings.Replacer {
+	if s.deps.Redactor == nil {
+		return nil
+	}
+	s.mu.Lock()
+	cached := s.redact[app]
+	s.mu.Unlock()
+	if cached != nil && time.Since(cached.at) < redactRefresh {
+		return cached.replacer
+	}
+
+	values := s.deps.Redactor.SensitiveValues(app)
+	// Longest first, so a value containing another is masked whole.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	var pairs []string
+	for _, v := range values {
+		pairs = append(pairs, v, redactedValue)
+	}
+	r := &redaction{at: time.Now()}
+	if len(pairs) > 0 {
+		r.replacer = strings.NewReplacer(pairs...)
+	}
+	s.mu.Lock()
+	s.redact[app] = r
+	s.mu.Unlock()
+	return r.replacer
+}
+
+// reload rebuilds the sinks from config. Sinks whose settings did not
+// change keep running; the others are stopped (their buffers spooled) and
+// started afresh.
+func (s *Shipper) reload() {
+	var confs []SinkConfig
+	labels := map[string]map[string]string{}
+	spoolMB := defaultSpoolMB
+	s.cfg.View(func() {
+		settings := s.cfg.Map(configKey)
+		confs = sinkConfigs(settings)
+		if byApp, _ := settings["labels"].(map[string]any); byApp != nil {
+			for app, raw := range byApp {
+				labels[app] = stringMap(raw)
+			}
+		}
+		if mb, ok := settings["spoolMB"].(float64); ok && mb > 0 {
+			spoolMB = int(mb)
+		}
+	})
+
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	old := s.sinks
+	next := map[string]*sink{}
+	var stale, fresh []*sink
+	for _, conf := range confs {
+		if sk := old[conf.Name]; sk != nil && sk.conf.equal(conf) && sk.spool.maxBytes == int64(spoolMB)<<20 {
+			next[conf.Name] = sk
+			delete(old, conf.Name)
+			continue
+		}
+		sk, err := s.newSink(conf, int64(spoolMB)<<20)
+		if err != nil {
+			s.log.Error("Sink %s: %s", conf.Name, err.Error())
+			continue
+		}
+		next[conf.Name] = sk
+		fresh = append(fresh, sk)
+	}
+	for _, sk := range old {
+		stale = append(stale, sk)
+	}
+	s.sinks = next
+	s.labels = labels
+	s.mu.Unlock()
+
+	for _, sk := range stale {
+		sk.Stop()
+	}
+	for _, sk := range fresh {
+		sk.Start()
+	}
+}
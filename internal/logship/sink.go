@@ -0,0 +1,349 @@
+package logship
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"odac/internal/logx"
+)
+
+const (
+	batchSize     = 500
+	flushInterval = time.Second
+	maxBuffered   = 20 * batchSize
+	maxBackoff    = time.Minute
+	secretPrefix  = "secret://"
+)
+
+// sender delivers one batch to a sink's endpoint.
+type sender interface {
+	send(batch []Entry) error
+	close()
+}
+
+// sink batches lines for one destination. Its worker sends the spool
+// (oldest first) before new lines, so lines arrive in order; while the
+// destination fails it backs off and parks new batches in the spool.
+type sink struct {
+	conf  SinkConfig
+	out   sender
+	spool *spool
+	log   *logx.Logger
+
+	mu       sync.Mutex
+	buf      []Entry
+	sent     int64
+	dropped  int64
+	lastErr  string
+	failures int
+	retryAt  time.Time
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+type sinkStatus struct {
+	sent, spooled, dropped int64
+	lastError              string
+}
+
+func (s *Shipper) newSink(conf SinkConfig, spoolBytes int64) (*sink, error) {
+	headers := make(map[string]string, len(conf.Headers))
+	for name, value := range conf.Headers {
+		if ref, ok := strings.CutPrefix(value, secretPrefix); ok {
+			if s.deps.Secrets == nil {
+				return nil, fmt.Errorf("header %s references secret %s but the secrets store is unavailable", name, ref)
+			}
+			revealed, err := s.deps.Secrets.Reveal(ref)
+			if err != nil {
+				return nil, fmt.Errorf("header %s references secret %s: %w", name, ref, err)
+			}
+			value = revealed
+		}
+		headers[name] = value
+	}
+
+	var out sender
+	switch conf.Type {
+	case "syslog":
+		out = newSyslog(conf, s.hostname)
+	case "loki":
+		out = newLoki(conf, headers, s.hostname)
+	case "otlp":
+		out = newOTLP(conf, headers, s.hostname)
+	default:
+		return nil, fmt.Errorf("unknown sink type %s", conf.Type)
+	}
+	return &sink{
+		conf:  conf,
+		out:   out,
+		spool: &spool{dir: filepath.Join(s.spoolDir, conf.Name), maxBytes: spoolBytes},
+		log:   logx.New("LogShip", conf.Name),
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// accepts reports whether the sink ships this entry.
+func (k *sink) accepts(e Entry) bool {
+	if e.App == "" {
+		return k.conf.Daemon
+	}
+	return len(k.conf.Apps) == 0 || slices.Contains(k.conf.Apps, e.App)
+}
+
+// Start runs the worker.
+func (k *sink) Start() {
+	go k.run()
+}
+
+// Stop ends the worker, spooling what it had not sent.
+func (k *sink) Stop() {
+	close(k.stop)
+	<-k.done
+}
+
+func (k *sink) push(e Entry) {
+	k.mu.Lock()
+	k.buf = append(k.buf, e)
+	if len(k.buf) > maxBuffered {
+		k.buf = k.buf[1:]
+		k.dropped++
+	}
+	full := len(k.buf) >= batchSize
+	k.mu.Unlock()
+	if full {
+		select {
+		case k.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (k *sink) run() {
+	defer close(k.done)
+	defer k.out.close()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.stop:
+			k.spoolBuffered()
+			return
+		case <-ticker.C:
+		case <-k.wake:
+		}
+		k.flush()
+	}
+}
+
+func (k *sink) flush() {
+	k.mu.Lock()
+	backingOff := time.Now().Before(k.retryAt)
+	k.mu.Unlock()
+	if backingOff {
+		k.spoolBuffered()
+		return
+	}
+
+	for {
+		path, batch, ok := k.spool.oldest()
+		if !ok {
+			break
+		}
+		if err := k.out.send(batch); err != nil {
+			k.failed(err)
+			k.spoolBuffered()
+			return
+		}
+		k.spool.remove(path)
+		k.delivered(len(batch))
+	}
+	for {
+		batch := k.take()
+		if len(batch) == 0 {
+			return
+		}
+		if err := k.out.send(batch); err != nil {
+			k.failed(err)
+			k.spoolBatch(batch)
+			k.spoolBuffered()
+			return
+		}
+		k.delivered(len(batch))
+	}
+}
+
+func (k *sink) take() []Entry {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	n := min(len(k.buf), batchSize)
+	if n == 0 {
+		return nil
+	}
+	batch := append([]Entry(nil), k.buf[:n]...)
+	k.buf = k.buf[n:]
+	return batch
+}
+
+func (k *sink) spoolBuffered() {
+	for {
+		batch := k.take()
+		if len(batch) == 0 {
+			return
+		}
+		k.spoolBatch(batch)
+	}
+}
+
+func (k *sink) spoolBatch(batch []Entry) {
+	dropped, err := k.spool.write(batch)
+	k.mu.Lock()
+	k.dropped += int64(dropped)
+	if err != nil {
+		k.dropped += int64(len(batch))
+	}
+	k.mu.Unlock()
+	if err != nil {
+		k.log.Error("Spooling %s lines failed: %s", strconv.Itoa(len(batch)), err.Error())
+	}
+}
+
+func (k *sink) failed(err error) {
+	k.mu.Lock()
+	k.failures++
+	backoff := min(time.Second<<min(k.failures, 6), maxBackoff)
+	k.retryAt = time.Now().Add(backoff)
+	first := k.lastErr == ""
+	k.lastErr = err.Error()
+	k.mu.Unlock()
+	if first {
+		k.log.Error("Delivery failed, spooling until it recovers: %s", err.Error())
+	}
+}
+
+func (k *sink) delivered(n int) {
+	k.mu.Lock()
+	k.sent += int64(n)
+	recovered := k.lastErr != ""
+	k.lastErr, k.failures = "", 0
+	k.mu.Unlock()
+	if recovered {
+		k.log.Log("Delivering again")
+	}
+}
+
+func (k *sink) status() sinkStatus {
+	spooled := k.spool.count()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return sinkStatus{sent: k.sent, spooled: spooled + int64(len(k.buf)), dropped: k.dropped, lastError: k.lastErr}
+}
+
+// spool keeps undelivered batches as JSON files named
+// <unix nanos>-<line count>.json, capped at maxBytes by dropping the oldest.
+type spool struct {
+	dir      string
+	maxBytes int64
+	last     int64
+}
+
+func (p *spool) files() []string {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, de := range entries {
+		if strings.HasSuffix(de.Name(), ".json") {
+			names = append(names, de.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func spoolCount(name string) int64 {
+	_, count, _ := strings.Cut(strings.TrimSuffix(name, ".json"), "-")
+	n, _ := strconv.ParseInt(count, 10, 64)
+	return n
+}
+
+// write stores a batch and trims the spool to its cap, returning how many
+// lines the trim dropped.
+func (p *spool) write(batch []Entry) (int, error) {
+	if err := os.MkdirAll(p.dir, 0o700); err != nil {
+		return 0, err
+	}
+	raw, err := json.Marshal(batch)
+	if err != nil {
+		return 0, err
+	}
+	stamp := max(time.Now().UnixNano(), p.last+1)
+	p.last = stamp
+	name := fmt.Sprintf("%019d-%d.json", stamp, len(batch))
+	if err := os.WriteFile(filepath.Join(p.dir, name), raw, 0o600); err != nil {
+		return 0, err
+	}
+
+	names := p.files()
+	sizes := make([]int64, len(names))
+	var total int64
+	for i, n := range names {
+		if info, err := os.Stat(filepath.Join(p.dir, n)); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	dropped := 0
+	for i := 0; total > p.maxBytes && i < len(names); i++ {
+		os.Remove(filepath.Join(p.dir, names[i]))
+		total -= sizes[i]
+		dropped += int(spoolCount(names[i]))
+	}
+	return dropped, nil
+}
+
+// oldest returns the oldest spooled batch. Unreadable files are removed.
+func (p *spool) oldest() (string, []Entry, bool) {
+	for _, name := range p.files() {
+		path := filepath.Join(p.dir, name)
+		raw, err := os.ReadFile(path)
+		var batch []Entry
+		if err == nil {
+			err = json.Unmarshal(raw, &batch)
+		}
+		if err != nil {
+			os.Remove(path)
+			continue
+		}
+		return path, batch, true
+	}
+	return "", nil, false
+}
+
+func (p *spool) remove(path string) {
+	os.Remove(path)
+}
+
+func (p *spool) count() int64 {
+	var n int64
+	for _, name := range p.files() {
+		n += spoolCount(name)
+	}
+	return n
+}
+
+func removeSpool(root, name string) {
+	os.RemoveAll(filepath.Join(root, name))
+}
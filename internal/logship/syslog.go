@@ -0,0 +1,153 @@
+package logship
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// syslogEnterpriseID names ODAC's structured-data element. 32473 is
+	// the number RFC 5612 reserves for documentation and examples.
+	syslogEnterpriseID = "odac@32473"
+	facilityDaemon     = 3
+	facilityLocal0     = 16
+	maxUDPMessage      = 2048
+	dialTimeout        = 10 * time.Second
+	writeTimeout       = 10 * time.Second
+)
+
+// syslogSender writes RFC 5424 messages: one datagram each over UDP,
+// octet-counted frames (RFC 6587) over TCP and TLS.
+type syslogSender struct {
+	network  string
+	addr     string
+	tls      *tls.Config
+	labels   map[string]string
+	hostname string
+	conn     net.Conn
+}
+
+func newSyslog(conf SinkConfig, hostname string) *syslogSender {
+	u, _ := url.Parse(conf.URL)
+	port := u.Port()
+	if port == "" {
+		port = "514"
+		if u.Scheme == "tls" {
+			port = "6514"
+		}
+	}
+	s := &syslogSender{network: u.Scheme, addr: net.JoinHostPort(u.Hostname(), port), labels: conf.Labels, hostname: hostname}
+	if u.Scheme == "tls" {
+		s.network = "tcp"
+		s.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	return s
+}
+
+func (s *syslogSender) send(batch []Entry) error {
+	if s.conn == nil {
+		dialer := &net.Dialer{Timeout: dialTimeout}
+		var conn net.Conn
+		var err error
+		if s.tls != nil {
+			conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, s.tls)
+		} else {
+			conn, err = dialer.Dial(s.network, s.addr)
+		}
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	var err error
+	if s.network == "udp" {
+		for _, e := range batch {
+			msg := formatSyslog(e, s.labels, s.hostname)
+			if len(msg) > maxUDPMessage {
+				msg = msg[:maxUDPMessage]
+			}
+			if _, err = s.conn.Write([]byte(msg)); err != nil {
+				break
+			}
+		}
+	} else {
+		var buf bytes.Buffer
+		for _, e := range batch {
+			msg := formatSyslog(e, s.labels, s.hostname)
+			fmt.Fprintf(&buf, "%d %s", len(msg), msg)
+		}
+		_, err = s.conn.Write(buf.Bytes())
+	}
+	if err != nil {
+		s.close()
+	}
+	return err
+}
+
+func (s *syslogSender) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// formatSyslog renders one RFC 5424 message. App lines use facility
+// local0, daemon lines facility daemon; stderr is severity error, the rest
+// informational. The line's labels travel as structured data.
+func formatSyslog(e Entry, static map[string]string, hostname string) string {
+	facility, severity := facilityLocal0, 6
+	appName := e.App
+	if e.App == "" {
+		facility, appName = facilityDaemon, "odac-"+e.Service
+	}
+	if e.Stream == "err" {
+		severity = 3
+	}
+
+	attrs := attributes(e, static)
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sd strings.Builder
+	sd.WriteString("[" + syslogEnterpriseID)
+	for _, k := range keys {
+		sd.WriteString(" " + syslogField(k, 32) + `="` + sdEscaper.Replace(attrs[k]) + `"`)
+	}
+	sd.WriteString("]")
+
+	return fmt.Sprintf("<%d>1 %s %s %s - %s %s %s",
+		facility*8+severity,
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogField(hostname, 255), syslogField(appName, 48), syslogField(e.Stream, 32),
+		sd.String(), e.Text)
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogField makes a header field legal: printable ASCII without spaces,
+// at most max bytes, "-" when empty.
+func syslogField(v string, max int) string {
+	out := []byte(v)
+	for i, c := range out {
+		if c < 33 || c > 126 {
+			out[i] = '_'
+		}
+	}
+	if len(out) > max {
+		out = out[:max]
+	}
+	if len(out) == 0 {
+		return "-"
+	}
+	return string(out)
+}
@@ -0,0 +1,83 @@
+package logship
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tailer follows one data-plane log file from its size at start, reopening
+// it when rotation replaces or truncates it. A trailing partial line waits
+// for the rest of it.
+type tailer struct {
+	path    string
+	service string
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+func (s *Shipper) tailDaemonLogs() {
+	defer s.done.Done()
+	tailers := make([]*tailer, 0, len(daemonLogs))
+	for _, name := range daemonLogs {
+		t := &tailer{path: filepath.Join(s.logsDir, name+daemonLogSuffix), service: name}
+		if info, err := os.Stat(t.path); err == nil {
+			t.info, t.offset = info, info.Size()
+		}
+		tailers = append(tailers, t)
+	}
+	ticker := time.NewTicker(tailInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			for _, t := range tailers {
+				t.poll(s.ingest)
+			}
+		}
+	}
+}
+
+func (t *tailer) poll(emit func(Entry)) {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return
+	}
+	if t.info == nil || !os.SameFile(t.info, info) || info.Size() < t.offset {
+		t.offset, t.partial = 0, nil
+	}
+	t.info = info
+	if info.Size() == t.offset {
+		return
+	}
+	f, err := os.Open(t.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(f, info.Size()-t.offset))
+	if err != nil {
+		return
+	}
+	t.offset += int64(len(data))
+	data = append(t.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		if len(data) > maxLineLength {
+			end = len(data) - 1
+		} else {
+			t.partial = data
+			return
+		}
+	}
+	t.partial = append([]byte(nil), data[end+1:]...)
+	emit(Entry{Time: time.Now(), Service: t.service, Stream: "out", Text: string(data[:end+1])})
+}
@@ -349,6 +349,10 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.HandleAccountList(w, r)
 	case "/config":
 		s.HandleConfig(w, r)
+	case "/firewall":
+		s.firewall.Guard().HandlePolicy(w, r)
+	case "/firewall/bans":
+		s.firewall.Guard().HandleBans(w, r)
 	case "/health":
 		s.HandleHealth(w, r)
 	case "/send":
@@ -1,93 +1,65 @@
 // Package auth — firewall.go implements IP-based brute-force protection
-// and connection blocking for the mail server. Mirrors the Node.js Mail.js
-// #handleFailedAuth / #block / #isBlocked logic with identical thresholds.
+// and connection blocking for the mail server. Failed logins feed the
+// shared firewall's "mail.auth" auto-ban (default: more than 5 failures in
+// an hour bans for 24 hours), so the ban is persisted by the orchestrator
+// and enforced by the proxy and DNS daemons as well.
 package auth
 
 import (
-	"log"
-	"sync"
 	"time"
-)
 
-const (
-	maxFailedAttempts = 5
-	blockDuration     = 24 * time.Hour
-	attemptResetAfter = 1 * time.Hour
+	"odac/internal/firewall"
 )
 
-type attemptRecord struct {
-	attempts int
-	last     time.Time
-}
+const blockDuration = 24 * time.Hour
 
-// Firewall tracks failed authentication attempts per IP and blocks
-// offending addresses for 24 hours after 5 consecutive failures.
-// Thread-safe via sync.Map for lock-free reads on the hot path.
+// Firewall adapts the shared firewall.Guard to the SMTP/IMAP call sites.
 type Firewall struct {
-	blocked  sync.Map // map[string]time.Time (IP → unblock time)
-	attempts sync.Map // map[string]*attemptRecord
-	Enabled  bool     // Set to false to disable blocking (testing)
-	mu       sync.Mutex
+	guard   *firewall.Guard
+	Enabled bool // Set to false to disable blocking (testing)
 }
 
 // NewFirewall creates a new Firewall instance with blocking enabled.
 func NewFirewall() *Firewall {
-	return &Firewall{Enabled: true}
+	return &Firewall{guard: firewall.NewGuard("Mail"), Enabled: true}
+}
+
+// Guard returns the shared IP policy engine (control API: /firewall).
+func (f *Firewall) Guard() *firewall.Guard {
+	return f.guard
 }
 
 // HandleFailedAuth records a failed authentication attempt for the given IP.
-// Blocks the IP after maxFailedAttempts consecutive failures within attemptResetAfter.
 func (f *Firewall) HandleFailedAuth(ip string) {
 	if !f.Enabled {
 		return
 	}
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	val, _ := f.attempts.LoadOrStore(ip, &attemptRecord{})
-	rec := val.(*attemptRecord)
-
-	// Reset counter if last attempt was more than 1 hour ago
-	if time.Since(rec.last) > attemptResetAfter {
-		rec.attempts = 0
-	}
-
-	rec.attempts++
-	rec.last = time.Now()
-
-	if rec.attempts > maxFailedAttempts {
-		f.Block(ip, "Too many failed login attempts")
-		f.attempts.Delete(ip)
-	}
+	f.guard.Record(firewall.EventMailAuth, ip)
 }
 
 // ClearAttempts removes the failed attempt counter for an IP after successful login.
 func (f *Firewall) ClearAttempts(ip string) {
-	f.attempts.Delete(ip)
+	f.guard.Forget(firewall.EventMailAuth, ip)
 }
 
-// Block adds an IP to the blocklist for 24 hours.
+// Block bans an IP for 24 hours.
 func (f *Firewall) Block(ip, reason string) {
-	if _, loaded := f.blocked.LoadOrStore(ip, time.Now().Add(blockDuration)); !loaded {
-		log.Printf("[Mail-FW] Blocking IP %s: %s", ip, reason)
-	}
+	now := time.Now()
+	f.guard.Ban(firewall.Ban{
+		IP:      ip,
+		Until:   now.Add(blockDuration).UnixMilli(),
+		Reason:  reason,
+		Source:  firewall.EventMailAuth,
+		Created: now.UnixMilli(),
+	})
 }
 
-// IsBlocked checks if an IP is currently blocked.
-// Automatically removes expired blocks (lazy cleanup).
+// IsBlocked checks if an IP is currently blocked by a ban, a blacklist
+// entry or a country rule.
 func (f *Firewall) IsBlocked(ip string) bool {
 	if !f.Enabled {
 		return false
 	}
-	val, ok := f.blocked.Load(ip)
-	if !ok {
-		return false
-	}
-
-	unblockTime := val.(time.Time)
-	if time.Now().After(unblockTime) {
-		f.blocked.Delete(ip)
-		return false
-	}
-	return true
+	ok, _ := f.guard.Check(ip, "")
+	return !ok
 }
@@ -11,7 +11,10 @@ import (
 	"odac/internal/proxy/proxy"
 )
 
-var validTokenRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+var (
+	validTokenRegex  = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	validDomainRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z0-9-]{2,63}$`)
+)
 
 // acmeRequest represents the JSON payload for ACME HTTP-01 challenge token management.
 type acmeRequest struct {
@@ -37,13 +40,15 @@ func (r *Readiness) IsReady() bool {
 type Server struct {
 	proxy     *proxy.Proxy
 	firewall  *proxy.Firewall
+	streams   *proxy.Streams
 	readiness *Readiness
 }
 
-func NewServer(p *proxy.Proxy, f *proxy.Firewall, r *Readiness) *Server {
+func NewServer(p *proxy.Proxy, f *proxy.Firewall, st *proxy.Streams, r *Readiness) *Server {
 	return &Server{
 		proxy:     p,
 		firewall:  f,
+		streams:   st,
 		readiness: r,
 	}
 }
@@ -95,9 +100,52 @@ func (s *Server) HandleACMEChallenge(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// alpnRequest is the JSON payload for ACME TLS-ALPN-01 challenges.
+type alpnRequest struct {
+	Domain           string `json:"domain"`
+	KeyAuthorization string `json:"keyAuthorization"`
+}
+
+// HandleTLSALPNChallenge manages ACME TLS-ALPN-01 challenges: POST prepares
+// the challenge certificate for a domain, DELETE removes it.
+func (s *Server) HandleTLSALPNChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req alpnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if len(req.Domain) > 253 || !validDomainRegex.MatchString(req.Domain) {
+		http.Error(w, "Invalid domain", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		s.proxy.DeleteTLSALPNChallenge(req.Domain)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+		return
+	}
+	if req.KeyAuthorization == "" {
+		http.Error(w, "Missing keyAuthorization", http.StatusBadRequest)
+		return
+	}
+	if err := s.proxy.SetTLSALPNChallenge(req.Domain, req.KeyAuthorization); err != nil {
+		log.Printf("Failed to prepare TLS-ALPN-01 challenge for %s: %v", req.Domain, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
 // HandleCachePurge clears cached assets for a specific domain or all domains.
 // POST with {"domain": "example.com"} purges that domain.
 // POST with empty body or {"domain": ""} purges all cached assets.
+// Adding "tags", "url" (exact path) or "prefix" purges only the domain's
+// matching assets and pages.
 func (s *Server) HandleCachePurge(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -105,20 +153,32 @@ func (s *Server) HandleCachePurge(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Domain string `json:"domain"`
+		Domain string   `json:"domain"`
+		Tags   []string `json:"tags"`
+		URL    string   `json:"url"`
+		Prefix string   `json:"prefix"`
 	}
 	// Body is optional — empty body means purge all
 	json.NewDecoder(r.Body).Decode(&req)
 
 	cache := s.proxy.Cache()
 	var count int
+	filter := proxy.PurgeFilter{Tags: req.Tags, URL: req.URL, Prefix: req.Prefix}
 
-	if req.Domain != "" {
+	switch {
+	case len(req.Tags) > 0 || req.URL != "" || req.Prefix != "":
+		if req.Domain == "" {
+			http.Error(w, "domain is required", http.StatusBadRequest)
+			return
+		}
+		count = cache.PurgeMatching(req.Domain, filter) + s.proxy.Pages().PurgeMatching(req.Domain, filter)
+		log.Printf("[Cache] Purged %d matching entries for domain: %s", count, req.Domain)
+	case req.Domain != "":
 		count = cache.Purge(req.Domain)
 		s.proxy.Pages().Purge(req.Domain)
 		s.proxy.Hints().Purge(req.Domain)
 		log.Printf("[Cache] Purged %d entries for domain: %s", count, req.Domain)
-	} else {
+	default:
 		count = cache.PurgeAll()
 		s.proxy.Pages().PurgeAll()
 		s.proxy.Hints().PurgeAll()
@@ -144,6 +204,31 @@ func (s *Server) HandleCacheStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(s.proxy.Cache().Stats())
 }
 
+// HandleOnDemand lists the hostnames approved for on-demand TLS that are
+// still waiting for a certificate; the orchestrator polls it.
+func (s *Server) HandleOnDemand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"pending": s.proxy.OnDemand().Pending()})
+}
+
+// HandleStreams returns per-stream connection and byte counters.
+func (s *Server) HandleStreams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"streams": s.streams.Stats()})
+}
+
 // HandleReady reports public-listener readiness for the zero-downtime handover.
 // Returns 200 OK only after both :80 and :443 have been bound and are accepting
 // connections. The Node.js Updater polls this before signaling the old container
@@ -177,10 +262,13 @@ func (s *Server) HandleConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Received config update: %d domains, firewall enabled: %v, tunnels: %d", len(cfg.Domains), cfg.Firewall.Enabled, len(cfg.Tunnels))
+	log.Printf("Received config update: %d domains, firewall enabled: %v, tunnels: %d, streams: %d", len(cfg.Domains), cfg.Firewall.Enabled, len(cfg.Tunnels), len(cfg.Streams))
 
-	s.proxy.UpdateConfig(cfg.Domains, cfg.SSL, cfg.Tunnels, cfg.Memory)
+	s.proxy.UpdateConfig(cfg.Domains, cfg.SSL, cfg.Tunnels, cfg.Relay, cfg.Memory)
+	s.proxy.ConfigureDiskCache(cfg.DiskCache)
+	s.proxy.OnDemand().UpdateConfig(cfg.OnDemand)
 	s.firewall.UpdateConfig(cfg.Firewall)
+	s.streams.UpdateConfig(cfg.Streams)
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
@@ -189,9 +277,13 @@ func (s *Server) HandleConfig(w http.ResponseWriter, r *http.Request) {
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/acme/challenge", s.HandleACMEChallenge)
+	mux.HandleFunc("/acme/tls-alpn", s.HandleTLSALPNChallenge)
 	mux.HandleFunc("/cache/purge", s.HandleCachePurge)
 	mux.HandleFunc("/cache/stats", s.HandleCacheStats)
 	mux.HandleFunc("/config", s.HandleConfig)
+	s.firewall.Guard().Mount(mux)
+	mux.HandleFunc("/ondemand", s.HandleOnDemand)
 	mux.HandleFunc("/ready", s.HandleReady)
+	mux.HandleFunc("/streams", s.HandleStreams)
 	mux.ServeHTTP(w, r)
 }
@@ -1,12 +1,50 @@
 package config
 
+import "odac/internal/firewall"
+
 // Config represents the full configuration payload from Node.js
 type Config struct {
-	Domains  map[string]Website `json:"domains"`
-	Firewall Firewall           `json:"firewall"`
-	Memory   *Memory            `json:"memory,omitempty"`
-	SSL      *SSL               `json:"ssl"`
-	Tunnels  []Tunnel           `json:"tunnels"`
+	DiskCache *DiskCache         `json:"diskCache,omitempty"`
+	Domains   map[string]Website `json:"domains"`
+	Firewall  Firewall           `json:"firewall"`
+	Memory    *Memory            `json:"memory,omitempty"`
+	OnDemand  []OnDemand         `json:"onDemand,omitempty"`
+	Relay     []RelayAgent       `json:"relay,omitempty"`
+	SSL       *SSL               `json:"ssl"`
+	Streams   []Stream           `json:"streams,omitempty"`
+	Tunnels   []Tunnel           `json:"tunnels"`
+}
+
+// DiskCache turns on the on-disk cache tier in Dir, capped at MaxSize bytes.
+type DiskCache struct {
+	Dir     string `json:"dir"`
+	MaxSize int64  `json:"maxSize"`
+}
+
+// Stream is a layer-4 listener forwarding to Host:Port. With TLS
+// "terminate" the proxy decrypts using Cert; with "passthrough" it routes
+// the still-encrypted connection by SNI (Domain), so several passthrough
+// streams can share one port.
+type Stream struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"` // "tcp" or "udp"
+	Listen   int    `json:"listen"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	TLS      string `json:"tls,omitempty"`    // "", "terminate" or "passthrough"
+	Domain   string `json:"domain,omitempty"` // Certificate and SNI name; firewall override key
+	Cert     Cert   `json:"cert"`
+}
+
+// OnDemand lets an app claim hostnames nobody configured: an unknown SNI
+// matching one of Allow ("shop.example.com", "*.example.com"), or for which
+// a GET of Ask on the app answers 2xx, is queued for a certificate.
+type OnDemand struct {
+	App   string   `json:"app"`
+	Host  string   `json:"host"`
+	Port  int      `json:"port"`
+	Ask   string   `json:"ask,omitempty"` // Path on the app; the hostname is passed as ?domain=
+	Allow []string `json:"allow,omitempty"`
 }
 
 // Memory represents host memory info provided by Node.js (os.totalmem/os.freemem).
@@ -22,17 +60,112 @@ type Tunnel struct {
 	Host   string `json:"host"`
 	Port   int    `json:"port"`
 	Token  string `json:"token"`
+	Relay  string `json:"relay,omitempty"` // Relay WebSocket URL; empty = ODAC Cloud
+}
+
+// RelayAgent is a tunnel agent allowed to connect to this proxy when it acts
+// as a relay. Websites with TunnelID set to Domain are served through it.
+type RelayAgent struct {
+	Domain    string `json:"domain"`
+	TokenHash string `json:"tokenHash"` // Hex SHA-256 of the agent's token
 }
 
 // Website represents a single site configuration
 type Website struct {
-	Domain      string   `json:"domain"`
-	Port        int      `json:"port"`        // The backend port (e.g., 3000, 60001)
-	Container   string   `json:"container"`   // Container name (if running in Docker)
-	ContainerIP string   `json:"containerIP"` // Direct IP if available
-	Subdomains  []string `json:"subdomain"`
-	Cert        Cert     `json:"cert"`
-	TunnelID    string   `json:"tunnelId,omitempty"` // Non-empty if site is served via remote tunnel
+	Domain      string            `json:"domain"`
+	Port        int               `json:"port"`        // The backend port (e.g., 3000, 60001)
+	Container   string            `json:"container"`   // Container name (if running in Docker)
+	ContainerIP string            `json:"containerIP"` // Direct IP if available
+	Subdomains  []string          `json:"subdomain"`
+	Cert        Cert              `json:"cert"`
+	TunnelID    string            `json:"tunnelId,omitempty"`   // Non-empty if site is served via remote tunnel
+	WAF         *WAF              `json:"waf,omitempty"`        // Web application firewall; nil = off
+	RateLimits  []RateLimitRule   `json:"rateLimits,omitempty"` // Per-path token-bucket limits
+	ErrorPages  map[string]string `json:"errorPages,omitempty"` // "404", "502", "503", "504" or "maintenance" -> HTML
+	Maintenance *Maintenance      `json:"maintenance,omitempty"`
+	Auth        *Access           `json:"auth,omitempty"`     // Access control; nil = open
+	OnDemand    bool              `json:"onDemand,omitempty"` // Added by on-demand TLS; never falls back to the global cert
+	MTLS        *MTLS             `json:"mtls,omitempty"`     // Client certificate authentication; nil = off
+	Backend     *Backend          `json:"backend,omitempty"`  // How the app is reached; nil = HTTP/1.1
+	CacheKey    *CacheKey         `json:"cacheKey,omitempty"` // Page cache key policy; nil = path and Vary only
+}
+
+// CacheKey widens what tells cached pages of one path apart.
+type CacheKey struct {
+	IgnoreQuery []string `json:"ignoreQuery,omitempty"` // Params dropped from the URL; "utm_*" matches a prefix
+	Query       bool     `json:"query,omitempty"`       // Cache URLs whose other params remain, keyed by them sorted
+	Cookies     []string `json:"cookies,omitempty"`     // Cookies whose values join the key
+	Headers     []string `json:"headers,omitempty"`     // Request headers whose values join the key
+	Device      bool     `json:"device,omitempty"`      // Key by device class from the User-Agent
+	Debug       bool     `json:"debug,omitempty"`       // Send the key in X-Odac-Cache-Key
+}
+
+// Backend selects the protocol the proxy speaks to a website's app.
+type Backend struct {
+	Protocol   string `json:"protocol"`             // "http1" (default), "h2c" (HTTP/2 without TLS) or "https"
+	Insecure   bool   `json:"insecure,omitempty"`   // https: skip certificate verification
+	ServerName string `json:"serverName,omitempty"` // https: name the certificate must carry; default the domain
+	GRPCWeb    bool   `json:"grpcWeb,omitempty"`    // Translate browser gRPC-Web requests to gRPC
+}
+
+// MTLS asks clients of a website for a certificate signed by one of the CAs
+// in the CA bundle file.
+type MTLS struct {
+	CA   string `json:"ca"`
+	Mode string `json:"mode"` // "require" (default) or "optional"
+}
+
+// Access protects a website with per-path rules. The most specific rule
+// applies: exact paths ("=/health") first, then the longest prefix.
+type Access struct {
+	Realm string            `json:"realm,omitempty"` // Basic-auth realm; default the domain
+	Users map[string]string `json:"users,omitempty"` // User -> bcrypt hash
+	Rules []AccessRule      `json:"rules,omitempty"`
+}
+
+// AccessRule is one path's requirements; all configured checks must pass.
+type AccessRule struct {
+	Path    string       `json:"path"`
+	Public  bool         `json:"public,omitempty"` // No checks (carves a hole in a parent rule)
+	Allow   []string     `json:"allow,omitempty"`  // IPs or CIDR ranges; empty = any address
+	Basic   bool         `json:"basic,omitempty"`  // Require one of Users
+	Forward *ForwardAuth `json:"forward,omitempty"`
+}
+
+// ForwardAuth asks an authentication service about every request: a 2xx
+// lets it through with Headers copied upstream, anything else is returned
+// to the client (login redirect, 401, ...).
+type ForwardAuth struct {
+	URL     string   `json:"url"`               // Empty = service unavailable (requests are refused)
+	Headers []string `json:"headers,omitempty"` // Identity headers to pass on; default Remote-User, Remote-Email, Remote-Groups, Remote-Name
+}
+
+// Maintenance answers a website's requests with a 503 page while Enabled,
+// except for the allowed addresses.
+type Maintenance struct {
+	Enabled    bool     `json:"enabled"`
+	Allow      []string `json:"allow,omitempty"`      // IPs or CIDR ranges served normally
+	RetryAfter int      `json:"retryAfter,omitempty"` // Seconds; 0 = 300
+}
+
+// WAF configures the request inspection stage for one website.
+type WAF struct {
+	Mode            string         `json:"mode"`                      // "block" (default), "detect" (log only) or "off"
+	Rules           []string       `json:"rules,omitempty"`           // Enabled groups or rule IDs; empty = all
+	Disable         []string       `json:"disable,omitempty"`         // Groups or rule IDs switched off
+	Exclusions      []WAFExclusion `json:"exclusions,omitempty"`      // Per-path rule exclusions
+	AllowedMethods  []string       `json:"allowedMethods,omitempty"`  // Overrides the default method list
+	MaxBodyBytes    int64          `json:"maxBodyBytes,omitempty"`    // Request body limit; 0 = none
+	MaxURLLength    int            `json:"maxUrlLength,omitempty"`    // Request-URI length limit; 0 = none
+	MaxHeaders      int            `json:"maxHeaders,omitempty"`      // Header count limit; 0 = none
+	BlockUserAgents []string       `json:"blockUserAgents,omitempty"` // Extra User-Agent substrings to refuse
+}
+
+// WAFExclusion switches rules off below a path prefix ("/api/upload") or
+// for a single path ("=/search").
+type WAFExclusion struct {
+	Path  string   `json:"path"`
+	Rules []string `json:"rules,omitempty"` // Groups or rule IDs; empty = every rule
 }
 
 // Cert represents SSL certificate paths
@@ -46,19 +179,33 @@ type SSL struct {
 	Cert string `json:"cert"`
 }
 
-// Firewall represents firewall rules
+// Firewall represents firewall rules. The IP policy (enabled flag, CIDR
+// lists, countries, per-domain overrides, bans) is the shared
+// firewall.Policy; the rest is proxy-only.
 type Firewall struct {
-	Enabled        bool      `json:"enabled"`
+	firewall.Policy
 	RateLimit      RateLimit `json:"rateLimit"`
 	MaxWSPerIP     int       `json:"maxWsPerIp"`     // Max concurrent WebSockets per IP
 	RequestTimeout int       `json:"requestTimeout"` // Timeout for regular HTTP requests in seconds
-	Blacklist      []string  `json:"blacklist"`
-	Whitelist      []string  `json:"whitelist"`
 }
 
-// RateLimit configuration
+// RateLimit is the global per-IP token bucket: Max requests per WindowMs,
+// bursting up to Burst (default Max).
 type RateLimit struct {
 	Enabled  bool `json:"enabled"`
 	WindowMs int  `json:"windowMs"`
 	Max      int  `json:"max"`
+	Burst    int  `json:"burst,omitempty"`
+}
+
+// RateLimitRule is a website's token bucket for one path. The most specific
+// matching rule applies: exact paths ("=/login") first, then the longest
+// prefix ("" covers the whole site).
+type RateLimitRule struct {
+	Path     string   `json:"path"`
+	Methods  []string `json:"methods,omitempty"` // Empty = every method
+	Max      int      `json:"max"`               // Requests per window (refill rate)
+	WindowMs int      `json:"windowMs"`
+	Burst    int      `json:"burst,omitempty"` // Bucket size; 0 = Max
+	Key      string   `json:"key,omitempty"`   // "ip" (default), "header:<Name>" or "cookie:<name>"
 }
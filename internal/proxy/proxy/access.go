@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"odac/internal/proxy/config"
+)
+
+// forwardAuthBodyLimit caps the auth service response relayed to a refused
+// client (login page, JSON error).
+const forwardAuthBodyLimit = 64 * 1024
+
+var defaultForwardHeaders = []string{"Remote-User", "Remote-Email", "Remote-Groups", "Remote-Name"}
+
+// forwardAuthClient never follows redirects: a 302 to the login page is the
+// answer the client needs to see.
+var forwardAuthClient = &http.Client{
+	Timeout: 10 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// accessPolicy is one website's compiled access control.
+type accessPolicy struct {
+	domain string
+	realm  string
+	users  map[string][]byte // user -> bcrypt hash
+	rules  []accessRule
+
+	// verified remembers the last password digest that matched per user, so
+	// browsers resending credentials on every request cost one bcrypt run.
+	mu       sync.Mutex
+	verified map[string][32]byte
+}
+
+type accessRule struct {
+	path    string
+	exact   bool
+	public  bool
+	allow   []netip.Prefix
+	basic   bool
+	forward *forwardAuth
+}
+
+type forwardAuth struct {
+	url     string
+	headers []string
+}
+
+// newAccessPolicy compiles a website's auth block; nil when it has no rules.
+func newAccessPolicy(domain string, cfg *config.Access) *accessPolicy {
+	if cfg == nil || len(cfg.Rules) == 0 {
+		return nil
+	}
+	a := &accessPolicy{
+		domain:   domain,
+		realm:    cfg.Realm,
+		users:    map[string][]byte{},
+		verified: map[string][32]byte{},
+	}
+	if a.realm == "" {
+		a.realm = domain
+	}
+	for user, hash := range cfg.Users {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			log.Printf("[Access] Ignoring user %s on %s: not a bcrypt hash", logSafe(user), domain)
+			continue
+		}
+		a.users[user] = []byte(hash)
+	}
+	for _, r := range cfg.Rules {
+		rule := accessRule{path: r.Path, public: r.Public, basic: r.Basic}
+		if strings.HasPrefix(rule.path, "=") {
+			rule.path, rule.exact = rule.path[1:], true
+		}
+		for _, entry := range r.Allow {
+			p, ok := parseAllowEntry(entry)
+			if !ok {
+				// Kept as a never-matching entry: an allow-list emptied by
+				// typos would otherwise admit every address.
+				log.Printf("[Access] Invalid allow entry %q for %s%s", entry, domain, r.Path)
+			}
+			rule.allow = append(rule.allow, p)
+		}
+		if r.Forward != nil {
+			rule.forward = &forwardAuth{url: r.Forward.URL, headers: r.Forward.Headers}
+			if len(rule.forward.headers) == 0 {
+				rule.forward.headers = defaultForwardHeaders
+			}
+		}
+		a.rules = append(a.rules, rule)
+	}
+	sort.SliceStable(a.rules, func(i, j int) bool {
+		x, y := a.rules[i], a.rules[j]
+		if x.exact != y.exact {
+			return x.exact
+		}
+		return len(x.path) > len(y.path)
+	})
+	return a
+}
+
+// match returns the rule governing path, or nil.
+func (a *accessPolicy) match(path string) *accessRule {
+	for i := range a.rules {
+		rule := &a.rules[i]
+		if rule.exact && path == rule.path || !rule.exact && strings.HasPrefix(path, rule.path) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// protects reports whether a rule guards path.
+func (a *accessPolicy) protects(path string) bool {
+	rule := a.match(path)
+	return rule != nil && !rule.public
+}
+
+// allow enforces the matching rule. It returns false when the request was
+// answered (403, 401, the auth service's reply, or 503 when it is down).
+// Identity headers are always stripped from the client request so an app
+// can trust them.
+func (a *accessPolicy) allow(w http.ResponseWriter, r *http.Request, ip string) bool {
+	rule := a.match(r.URL.Path)
+	for _, h := range defaultForwardHeaders {
+		r.Header.Del(h)
+	}
+	if rule != nil && rule.forward != nil {
+		for _, h := range rule.forward.headers {
+			r.Header.Del(h)
+		}
+	}
+	if rule == nil || rule.public {
+		return true
+	}
+
+	if len(rule.allow) > 0 && !prefixesContain(rule.allow, ip) {
+		log.Printf("[Access] Denied %s on %s%s: address not allowed", ip, a.domain, logSafe(r.URL.Path))
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+
+	if rule.basic {
+		user, pass, ok := r.BasicAuth()
+		if !ok || !a.checkPassword(user, pass) {
+			if ok {
+				log.Printf("[Access] Failed login for %s on %s from %s", logSafe(user), a.domain, ip)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+strings.ReplaceAll(a.realm, `"`, "")+`", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return false
+		}
+		r.Header.Del("Authorization") // the app never sees the password
+		r.Header.Set("Remote-User", user)
+	}
+
+	if rule.forward != nil && !rule.forward.check(w, r, ip) {
+		return false
+	}
+	return true
+}
+
+func (a *accessPolicy) checkPassword(user, pass string) bool {
+	hash, ok := a.users[user]
+	if !ok {
+		// Same work as a real check so user names cannot be probed by timing.
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(pass))
+		return false
+	}
+	digest := sha256.Sum256([]byte(pass))
+	a.mu.Lock()
+	last, seen := a.verified[user]
+	a.mu.Unlock()
+	if seen && subtle.ConstantTimeCompare(last[:], digest[:]) == 1 {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(pass)) != nil {
+		return false
+	}
+	a.mu.Lock()
+	a.verified[user] = digest
+	a.mu.Unlock()
+	return true
+}
+
+var dummyHash = sync.OnceValue(func() []byte {
+	h, _ := bcrypt.GenerateFromPassword([]byte("odac-access-dummy"), bcrypt.DefaultCost)
+	return h
+})
+
+// check asks the auth service about r. On 2xx the configured identity
+// headers are copied onto r; anything else is relayed to the client.
+func (f *forwardAuth) check(w http.ResponseWriter, r *http.Request, ip string) bool {
+	if f.url == "" {
+		http.Error(w, "Authentication Unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, f.url, nil)
+	if err != nil {
+		log.Printf("[Access] Invalid forward-auth URL for %s: %v", r.Host, err)
+		http.Error(w, "Authentication Unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	for k, v := range r.Header {
+		switch k {
+		case "Connection", "Upgrade", "Content-Length", "Transfer-Encoding", "Te", "Trailer", "Keep-Alive":
+			continue
+		}
+		req.Header[k] = v
+	}
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	req.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	req.Header.Set("X-Forwarded-For", ip)
+
+	resp, err := forwardAuthClient.Do(req)
+	if err != nil {
+		log.Printf("[Access] Forward-auth for %s failed: %v", r.Host, err)
+		http.Error(w, "Authentication Unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		for _, h := range f.headers {
+			if v := resp.Header.Values(h); len(v) > 0 {
+				r.Header[http.CanonicalHeaderKey(h)] = v
+			}
+		}
+		return true
+	}
+
+	for _, h := range []string{"Location", "Set-Cookie", "WWW-Authenticate", "Content-Type", "Cache-Control"} {
+		if v := resp.Header.Values(h); len(v) > 0 {
+			w.Header()[h] = v
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, io.LimitReader(resp.Body, forwardAuthBodyLimit))
+	return false
+}
+
+// parseAllowEntry reads an IP or CIDR range; the zero Prefix (matches
+// nothing) when invalid.
+func parseAllowEntry(entry string) (netip.Prefix, bool) {
+	if p, err := netip.ParsePrefix(entry); err == nil {
+		return p.Masked(), true
+	}
+	if addr, err := netip.ParseAddr(entry); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+func prefixesContain(prefixes []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.IsValid() && p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
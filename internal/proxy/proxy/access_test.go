@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"odac/internal/proxy/config"
+)
+
+func TestAccessAllowList(t *testing.T) {
+	a := newAccessPolicy("example.com", &config.Access{Rules: []config.AccessRule{
+		{Path: "/admin", Allow: []string{"10.0.0.0/8", "203.0.113.7"}},
+		{Path: "/admin/health", Public: true},
+		{Path: "/typo", Allow: []string{"not-an-ip"}},
+	}})
+
+	check := func(path, ip string) int {
+		w := httptest.NewRecorder()
+		if a.allow(w, httptest.NewRequest("GET", path, nil), ip) {
+			return http.StatusOK
+		}
+		return w.Code
+	}
+	cases := []struct {
+		path, ip string
+		want     int
+	}{
+		{"/admin/users", "10.2.3.4", http.StatusOK},
+		{"/admin/users", "203.0.113.7", http.StatusOK},
+		{"/admin/users", "198.51.100.1", http.StatusForbidden},
+		{"/admin/health", "198.51.100.1", http.StatusOK},
+		{"/", "198.51.100.1", http.StatusOK},
+		{"/typo", "198.51.100.1", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		if got := check(c.path, c.ip); got != c.want {
+			t.Errorf("%s from %s = %d, want %d", c.path, c.ip, got, c.want)
+		}
+	}
+	if !a.protects("/admin") || a.protects("/admin/health") || a.protects("/") {
+		t.Error("protects disagrees with the rules")
+	}
+	if newAccessPolicy("example.com", &config.Access{}) != nil {
+		t.Error("policy without rules compiled")
+	}
+}
+
+func TestAccessBasicAuth(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	a := newAccessPolicy("example.com", &config.Access{
+		Realm: "Staff",
+		Users: map[string]string{"alice": string(hash), "mallory": "plaintext"},
+		Rules: []config.AccessRule{{Path: "/", Basic: true}},
+	})
+	if _, ok := a.users["mallory"]; ok {
+		t.Error("non-bcrypt user loaded")
+	}
+
+	login := func(user, pass string) (*httptest.ResponseRecorder, *http.Request, bool) {
+		r := httptest.NewRequest("GET", "/", nil)
+		if user != "" {
+			r.SetBasicAuth(user, pass)
+		}
+		r.Header.Set("Remote-User", "admin") // spoofed by the client
+		w := httptest.NewRecorder()
+		return w, r, a.allow(w, r, "198.51.100.1")
+	}
+
+	w, _, ok := login("", "")
+	if ok || w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Basic realm="Staff", charset="UTF-8"` {
+		t.Fatalf("anonymous: %v %d %v", ok, w.Code, w.Header())
+	}
+	if _, _, ok = login("alice", "wrong"); ok {
+		t.Error("wrong password accepted")
+	}
+	if _, _, ok = login("bob", "s3cret"); ok {
+		t.Error("unknown user accepted")
+	}
+	for i := 0; i < 2; i++ { // second pass hits the verified cache
+		_, r, ok := login("alice", "s3cret")
+		if !ok || r.Header.Get("Remote-User") != "alice" || r.Header.Get("Authorization") != "" {
+			t.Fatalf("valid login %d: %v %v", i, ok, r.Header)
+		}
+	}
+	if _, _, ok = login("alice", "s3cret!"); ok {
+		t.Error("cached digest matched a different password")
+	}
+}
+
+func TestAccessForwardAuth(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "session=ok" {
+			w.Header().Set("Location", "https://auth.example.com/login?rd="+r.Header.Get("X-Forwarded-Uri"))
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		if r.Header.Get("X-Forwarded-Host") != "app.example.com" || r.Header.Get("X-Forwarded-Method") != "POST" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Remote-User", "alice")
+		w.Header().Set("Remote-Groups", "admins")
+		w.Header().Set("X-Internal", "leak")
+	}))
+	defer auth.Close()
+
+	a := newAccessPolicy("app.example.com", &config.Access{Rules: []config.AccessRule{
+		{Path: "/", Forward: &config.ForwardAuth{URL: auth.URL + "/verify"}},
+		{Path: "/down", Forward: &config.ForwardAuth{}},
+	}})
+
+	request := func(path, cookie string) (*httptest.ResponseRecorder, *http.Request, bool) {
+		r := httptest.NewRequest("POST", "http://app.example.com"+path, nil)
+		r.Header.Set("Remote-Groups", "root") // spoofed by the client
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		w := httptest.NewRecorder()
+		return w, r, a.allow(w, r, "198.51.100.1")
+	}
+
+	w, r, ok := request("/dashboard?tab=1", "")
+	if ok || w.Code != http.StatusFound || w.Header().Get("Location") != "https://auth.example.com/login?rd=/dashboard?tab=1" {
+		t.Fatalf("unauthenticated: %v %d %v", ok, w.Code, w.Header())
+	}
+
+	_, r, ok = request("/dashboard", "session=ok")
+	if !ok || r.Header.Get("Remote-User") != "alice" || r.Header.Get("Remote-Groups") != "admins" || r.Header.Get("X-Internal") != "" {
+		t.Fatalf("authenticated: %v %v", ok, r.Header)
+	}
+
+	// No resolvable auth app: fail closed.
+	if w, _, ok = request("/down", "session=ok"); ok || w.Code != http.StatusServiceUnavailable {
+		t.Errorf("unavailable auth: %v %d", ok, w.Code)
+	}
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"sync"
+
+	"odac/internal/proxy/config"
+)
+
+// backend is a website's compiled backend protocol: the URL scheme the
+// director uses and the transport that speaks it.
+type backend struct {
+	scheme    string
+	transport http.RoundTripper
+	grpcWeb   bool
+}
+
+type backendKey struct{}
+
+// tlsBackend identifies an HTTPS transport. Sites only share connections
+// when they verify the same way.
+type tlsBackend struct {
+	serverName string
+	insecure   bool
+}
+
+// backendTransport routes each request to the transport of its website's
+// backend protocol; requests without one use plain HTTP/1.1.
+type backendTransport struct {
+	http1 *http.Transport
+	h2c   *http.Transport
+	mu    sync.Mutex
+	tls   map[tlsBackend]*http.Transport
+}
+
+func newBackendTransport(base *http.Transport) *backendTransport {
+	h2c := base.Clone()
+	h2c.Protocols = new(http.Protocols)
+	h2c.Protocols.SetUnencryptedHTTP2(true)
+	return &backendTransport{http1: base, h2c: h2c, tls: make(map[tlsBackend]*http.Transport)}
+}
+
+func (t *backendTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if b, _ := req.Context().Value(backendKey{}).(*backend); b != nil {
+		return b.transport.RoundTrip(req)
+	}
+	return t.http1.RoundTrip(req)
+}
+
+// tlsTransport returns the HTTPS transport for key, creating it on first
+// use so config reloads keep the connection pools.
+func (t *backendTransport) tlsTransport(key tlsBackend) *http.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr, ok := t.tls[key]; ok {
+		return tr
+	}
+	tr := t.http1.Clone()
+	tr.TLSClientConfig = &tls.Config{
+		ServerName:         key.serverName,
+		InsecureSkipVerify: key.insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+	t.tls[key] = tr
+	return tr
+}
+
+// newBackend compiles a website's backend; nil for the HTTP/1.1 default.
+func (t *backendTransport) newBackend(site config.Website) *backend {
+	b := site.Backend
+	if b == nil {
+		return nil
+	}
+	switch b.Protocol {
+	case "h2c":
+		return &backend{scheme: "http", transport: t.h2c, grpcWeb: b.GRPCWeb}
+	case "https":
+		name := b.ServerName
+		if name == "" {
+			name = site.Domain
+		}
+		return &backend{scheme: "https", transport: t.tlsTransport(tlsBackend{name, b.Insecure}), grpcWeb: b.GRPCWeb}
+	}
+	return nil
+}
+
+// withBackend attaches the site's backend to the request for the director
+// and the transport.
+func withBackend(r *http.Request, b *backend) *http.Request {
+	if b == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), backendKey{}, b))
+}
+
+func backendOf(r *http.Request) *backend {
+	b, _ := r.Context().Value(backendKey{}).(*backend)
+	return b
+}
+
+// isGRPC reports gRPC and gRPC-Web requests.
+func isGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// streamWriter sends the response head as soon as it is written, so a
+// streaming client sees it before the first message.
+type streamWriter struct {
+	http.ResponseWriter
+}
+
+func (s streamWriter) WriteHeader(code int) {
+	s.ResponseWriter.WriteHeader(code)
+	s.Flush()
+}
+
+func (s streamWriter) Flush() {
+	http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+func (s streamWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// serveStream proxies a gRPC call without the compression and cache
+// writers, translating gRPC-Web when the site asks for it.
+func (p *Proxy) serveStream(w http.ResponseWriter, r *http.Request) {
+	if b := backendOf(r); b != nil && b.grpcWeb && isGRPCWeb(r) {
+		gw, req := translateGRPCWeb(w, r)
+		p.reverseProxy.ServeHTTP(streamWriter{gw}, req)
+		gw.finish()
+		return
+	}
+	p.reverseProxy.ServeHTTP(streamWriter{w}, r)
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"odac/internal/proxy/config"
+)
+
+// grpcBackend answers like a unary gRPC service: it echoes the request
+// body and sets grpc-status as an undeclared trailer.
+func grpcBackend(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	w.Header().Set("X-Proto", r.Proto)
+	w.Header().Set("X-Te", r.Header.Get("Te"))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	w.Header().Set(http.TrailerPrefix+"Grpc-Message", "ok")
+}
+
+// backendProxy serves p over HTTP/2 with TLS and returns a client for it.
+func backendProxy(t *testing.T, p *Proxy) (string, *http.Client) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(p)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.URL, srv.Client()
+}
+
+func backendSite(t *testing.T, name, backendURL string, b *config.Backend) config.Website {
+	t.Helper()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(strings.TrimPrefix(backendURL, "http://"), "https://"))
+	n, _ := strconv.Atoi(port)
+	return config.Website{Domain: name, Port: n, ContainerIP: "127.0.0.1", Backend: b}
+}
+
+func post(t *testing.T, client *http.Client, url, host, contentType string, body []byte) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url+"/pkg.Service/Method", bytes.NewReader(body))
+	req.Host = host
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, got
+}
+
+func TestGRPCOverH2C(t *testing.T) {
+	h2c := httptest.NewUnstartedServer(http.HandlerFunc(grpcBackend))
+	h2c.Config.Protocols = new(http.Protocols)
+	h2c.Config.Protocols.SetUnencryptedHTTP2(true)
+	h2c.Start()
+	defer h2c.Close()
+
+	p := NewProxy()
+	p.UpdateConfig(map[string]config.Website{
+		"grpc.test": backendSite(t, "grpc.test", h2c.URL, &config.Backend{Protocol: "h2c", GRPCWeb: true}),
+	}, nil, nil, nil, nil)
+	url, client := backendProxy(t, p)
+
+	message := []byte{0, 0, 0, 0, 3, 'a', 'b', 'c'}
+	resp, body := post(t, client, url, "grpc.test", "application/grpc+proto", message)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Proto") != "HTTP/2.0" || resp.Header.Get("X-Te") != "trailers" {
+		t.Fatalf("status %d, headers %v", resp.StatusCode, resp.Header)
+	}
+	if !bytes.Equal(body, message) || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("body = %q, encoding %q", body, resp.Header.Get("Content-Encoding"))
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" || resp.Trailer.Get("Grpc-Message") != "ok" {
+		t.Errorf("trailers = %v", resp.Trailer)
+	}
+
+	// gRPC-Web: the backend sees plain gRPC and the trailers come back as
+	// the last frame of the body.
+	frame := "\x80\x00\x00\x00\x22grpc-message: ok\r\ngrpc-status: 0\r\n"
+	resp, body = post(t, client, url, "grpc.test", "application/grpc-web+proto", message)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/grpc-web+proto" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if string(body) != string(message)+frame || len(resp.Trailer) != 0 {
+		t.Errorf("body = %q, trailers %v", body, resp.Trailer)
+	}
+
+	resp, body = post(t, client, url, "grpc.test", "application/grpc-web-text", []byte(base64.StdEncoding.EncodeToString(message)))
+	if ct := resp.Header.Get("Content-Type"); ct != "application/grpc-web-text" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var decoded []byte
+	for chunk := range strings.SplitAfterSeq(string(body), "=") {
+		d, _ := base64.StdEncoding.DecodeString(chunk)
+		decoded = append(decoded, d...)
+	}
+	if string(decoded) != string(message)+frame {
+		t.Errorf("text body = %q (%q)", body, decoded)
+	}
+}
+
+func TestHTTPSBackend(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			t.Error("backend reached without TLS")
+		}
+		io.WriteString(w, "secure")
+	}))
+	defer backend.Close()
+
+	p := NewProxy()
+	p.UpdateConfig(map[string]config.Website{
+		"verified.test": backendSite(t, "verified.test", backend.URL, &config.Backend{Protocol: "https"}),
+		"insecure.test": backendSite(t, "insecure.test", backend.URL, &config.Backend{Protocol: "https", Insecure: true}),
+	}, nil, nil, nil, nil)
+	url, client := backendProxy(t, p)
+
+	get := func(host string) (int, string) {
+		req, _ := http.NewRequest("GET", url+"/", nil)
+		req.Host = host
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, _ := get("verified.test"); code != http.StatusBadGateway {
+		t.Errorf("unverifiable backend certificate: status %d", code)
+	}
+	if code, body := get("insecure.test"); code != http.StatusOK || body != "secure" {
+		t.Errorf("insecure backend: %d %q", code, body)
+	}
+}
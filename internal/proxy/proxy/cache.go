@@ -70,6 +70,7 @@ type cacheEntry struct {
 	lastMod     string
 	size        int
 	statusCode  int
+	tags        []string // From X-Odac-Cache-Tags, for PurgeMatching
 
 	// Frequency tracking: exponentially weighted moving average of request rate
 	hitCount  atomic.Int64
@@ -124,6 +125,8 @@ type CacheManager struct {
 	enabled       atomic.Bool  // Master switch — disabled under extreme memory pressure
 	underPressure atomic.Bool  // True when memory is tight (only cache hot assets)
 
+	disk *DiskCache // Optional on-disk tier, off until configured
+
 	stopCh chan struct{}
 }
 
@@ -153,6 +156,7 @@ func NewCacheManager() *CacheManager {
 	// Conservative default until Node.js sends first memory update via config sync
 	cm.maxSize.Store(64 * 1024 * 1024) // 64MB
 
+	cm.disk = NewDiskCache(cm.stopCh)
 	go cm.maintenanceLoop()
 	return cm
 }
@@ -162,6 +166,11 @@ func (cm *CacheManager) Stop() {
 	close(cm.stopCh)
 }
 
+// Disk returns the on-disk tier.
+func (cm *CacheManager) Disk() *DiskCache {
+	return cm.disk
+}
+
 // cacheKey builds a unique key from domain + request path.
 func cacheKey(host, urlPath string) string {
 	return host + urlPath
@@ -300,76 +309,91 @@ func (cm *CacheManager) Get(host, urlPath string) *cacheEntry {
 	return entry
 }
 
-// Put stores a response in cache if admission criteria are met.
+// Put stores a response in cache if admission criteria are met: in memory,
+// and on disk when that tier is on.
 func (cm *CacheManager) Put(host, urlPath string, resp *http.Response, body []byte) {
-	if !cm.enabled.Load() {
-		return
-	}
-
-	// Size guard
-	if len(body) > cacheMaxFileSize || len(body) == 0 {
-		return
-	}
-
-	// Content-Type validation
-	ct := resp.Header.Get("Content-Type")
-	if !cacheableContentType(ct) {
+	if len(body) == 0 || !IsCacheableResponse(resp) {
 		return
 	}
 
-	// Only cache successful responses
-	if resp.StatusCode != http.StatusOK {
-		return
-	}
-
-	// Respect Cache-Control: no-store, private
-	cc := resp.Header.Get("Cache-Control")
-	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
-		return
+	key := cacheKey(host, urlPath)
+	if score, ok := cm.score(key, urlPath); ok && cm.disk.admit(score, int64(len(body))) {
+		cm.disk.put(assetMeta(key, resp), body)
 	}
 
-	// Never cache responses that set cookies — they are per-user/session
-	if resp.Header.Get("Set-Cookie") != "" {
+	if !cm.enabled.Load() || len(body) > cacheMaxFileSize {
 		return
 	}
 
-	// Never cache responses with Vary: Cookie or Vary: * (uncacheable by definition)
-	if vary := strings.ToLower(resp.Header.Get("Vary")); vary != "" {
-		if strings.Contains(vary, "*") || strings.Contains(vary, "cookie") || strings.Contains(vary, "authorization") {
-			return
-		}
-	}
-
-	key := cacheKey(host, urlPath)
-
 	// Admission control: check if this asset has enough request frequency
 	if !cm.shouldAdmit(key, urlPath, len(body)) {
 		return
 	}
 
-	// Preserve relevant headers
-	headers := make(http.Header)
-	for _, h := range []string{
-		"Cache-Control", "Content-Type", "ETag",
-		"Last-Modified", "Vary",
-	} {
-		if v := resp.Header.Get(h); v != "" {
-			headers.Set(h, v)
-		}
-	}
-
 	now := time.Now()
-	entry := &cacheEntry{
+	cm.store(key, &cacheEntry{
 		body:        body,
-		contentType: ct,
+		contentType: resp.Header.Get("Content-Type"),
 		createdAt:   now.UnixNano(),
 		etag:        resp.Header.Get("ETag"),
-		headers:     headers,
+		headers:     assetHeaders(resp.Header),
 		lastMod:     resp.Header.Get("Last-Modified"),
 		size:        len(body),
 		statusCode:  resp.StatusCode,
+		tags:        parseCacheTags(resp.Header),
+	})
+}
+
+// putSpill commits an asset body too large for memory, already streamed
+// to disk, or discards it.
+func (cm *CacheManager) putSpill(host, urlPath string, resp *http.Response, spill *diskSpill) {
+	key := cacheKey(host, urlPath)
+	score, ok := cm.score(key, urlPath)
+	cl := resp.Header.Get("Content-Length")
+	if !ok || !IsCacheableResponse(resp) || !cm.disk.admit(score, spill.size) ||
+		(cl != "" && cl != strconv.FormatInt(spill.size, 10)) {
+		spill.abort()
+		return
 	}
-	entry.lastAccess.Store(now.UnixNano())
+	spill.commit(assetMeta(key, resp))
+}
+
+// promote copies a disk hit into memory in the background once the asset
+// qualifies for the memory tier.
+func (cm *CacheManager) promote(urlPath string, e *diskEntry) {
+	if e.Size > cacheMaxFileSize || !cm.enabled.Load() {
+		return
+	}
+	if score, ok := cm.score(e.Key, urlPath); !ok || score < cacheMinFrequency || !e.promoting.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer e.promoting.Store(false)
+		if !cm.shouldAdmit(e.Key, urlPath, int(e.Size)) {
+			return
+		}
+		body, err := cm.disk.readBody(e)
+		if err != nil {
+			cm.disk.remove(e.Key)
+			return
+		}
+		cm.store(e.Key, &cacheEntry{
+			body:        body,
+			contentType: e.Header.Get("Content-Type"),
+			createdAt:   e.Created,
+			etag:        e.Header.Get("ETag"),
+			headers:     e.Header,
+			lastMod:     e.Header.Get("Last-Modified"),
+			size:        len(body),
+			statusCode:  e.Status,
+			tags:        e.Tags,
+		})
+	}()
+}
+
+// store puts an admitted entry in memory, replacing any previous one.
+func (cm *CacheManager) store(key string, entry *cacheEntry) {
+	entry.lastAccess.Store(time.Now().UnixNano())
 	entry.hitCount.Store(1)
 
 	// Check if replacing existing entry
@@ -381,11 +405,38 @@ func (cm *CacheManager) Put(host, urlPath string, resp *http.Response, body []by
 	cm.totalSize.Add(int64(entry.size))
 }
 
+// assetHeaders keeps the response headers safe to replay from cache.
+func assetHeaders(h http.Header) http.Header {
+	headers := make(http.Header)
+	for _, name := range []string{
+		"Cache-Control", "Content-Type", "ETag",
+		"Last-Modified", "Vary",
+	} {
+		if v := h.Get(name); v != "" {
+			headers.Set(name, v)
+		}
+	}
+	return headers
+}
+
+// assetMeta describes an asset response for the disk tier.
+func assetMeta(key string, resp *http.Response) diskMeta {
+	return diskMeta{
+		Key:     key,
+		Status:  resp.StatusCode,
+		Header:  assetHeaders(resp.Header),
+		Tags:    parseCacheTags(resp.Header),
+		Created: time.Now().UnixNano(),
+	}
+}
+
 // Purge removes all cache entries for a specific domain (app).
 // Called after deployments to ensure fresh assets are served.
 func (cm *CacheManager) Purge(host string) int {
 	prefix := host + "/"
-	count := 0
+	count := cm.disk.purgeBeside(&cm.entries, func(k string, _ *diskEntry) bool {
+		return k == host || strings.HasPrefix(k, prefix)
+	})
 
 	cm.entries.Range(func(key, value interface{}) bool {
 		k := key.(string)
@@ -410,8 +461,16 @@ func (cm *CacheManager) Purge(host string) int {
 	return count
 }
 
-// PurgeAll clears the entire cache.
+// PurgeAll clears the entire cache, memory and disk.
 func (cm *CacheManager) PurgeAll() int {
+	count := cm.disk.purgeBeside(&cm.entries, func(k string, _ *diskEntry) bool {
+		return !strings.HasPrefix(k, "page:")
+	})
+	return count + cm.purgeMemory()
+}
+
+// purgeMemory clears the memory tier only.
+func (cm *CacheManager) purgeMemory() int {
 	count := 0
 	cm.entries.Range(func(key, value interface{}) bool {
 		entry := value.(*cacheEntry)
@@ -444,6 +503,7 @@ func (cm *CacheManager) Stats() map[string]interface{} {
 		"maxSizeMB":     cm.maxSize.Load() / (1024 * 1024),
 		"totalSizeMB":   cm.totalSize.Load() / (1024 * 1024),
 		"underPressure": cm.underPressure.Load(),
+		"disk":          cm.disk.Stats(),
 	}
 }
 
@@ -517,15 +577,11 @@ func (cm *CacheManager) shouldAdmit(key, urlPath string, size int) bool {
 		}
 	}
 
-	// Check pre-admission frequency
-	val, ok := cm.frequency.Load(key)
+	score, ok := cm.score(key, urlPath)
 	if !ok {
 		return false
 	}
 
-	fr := val.(*frequencyRecord)
-	score := fr.frequency() * assetPriority(urlPath)
-
 	// Under memory pressure: only admit high-score assets
 	if cm.underPressure.Load() {
 		return score >= cacheHighFrequency
@@ -534,6 +590,16 @@ func (cm *CacheManager) shouldAdmit(key, urlPath string, size int) bool {
 	return score >= cacheMinFrequency
 }
 
+// score is an asset's admission score, pre-admission frequency × priority;
+// false when it was never requested.
+func (cm *CacheManager) score(key, urlPath string) (float64, bool) {
+	val, ok := cm.frequency.Load(key)
+	if !ok {
+		return 0, false
+	}
+	return val.(*frequencyRecord).frequency() * assetPriority(urlPath), true
+}
+
 // ============================================================================
 // Internal: Memory Management
 // ============================================================================
@@ -559,7 +625,7 @@ func (cm *CacheManager) UpdateMemory(total, used uint64) {
 			log.Printf("[Cache] Memory critical (%.0f%% free of %dMB). Disabling cache.",
 				freePercent, total/(1024*1024))
 			cm.enabled.Store(false)
-			cm.PurgeAll()
+			cm.purgeMemory()
 		}
 		return
 	}
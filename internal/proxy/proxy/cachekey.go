@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"odac/internal/proxy/config"
+)
+
+// cacheKeyHeader carries a page's cache key back to the client when the
+// website's policy asks for it, or "bypass" when the page cache is skipped.
+const cacheKeyHeader = "X-Odac-Cache-Key"
+
+// cacheKeyPolicy is a website's compiled CacheKey. Its methods accept a nil
+// policy, which keys pages by path and Vary alone and never caches a URL
+// with a query string.
+type cacheKeyPolicy struct {
+	ignore         []string // Exact query param names
+	ignorePrefixes []string // From "utm_*"
+	query          bool
+	cookies        []string
+	headers        []string // Lower case, like Vary fields in buildVariant
+	device         bool
+	debug          bool
+}
+
+// newCacheKeyPolicy compiles a website's cacheKey; nil when it has none.
+func newCacheKeyPolicy(c *config.CacheKey) *cacheKeyPolicy {
+	if c == nil {
+		return nil
+	}
+	kp := &cacheKeyPolicy{query: c.Query, cookies: c.Cookies, device: c.Device, debug: c.Debug}
+	for _, name := range c.IgnoreQuery {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			kp.ignorePrefixes = append(kp.ignorePrefixes, prefix)
+		} else {
+			kp.ignore = append(kp.ignore, name)
+		}
+	}
+	for _, h := range c.Headers {
+		kp.headers = append(kp.headers, strings.ToLower(h))
+	}
+	return kp
+}
+
+func (kp *cacheKeyPolicy) ignored(param string) bool {
+	if slices.Contains(kp.ignore, param) {
+		return true
+	}
+	for _, prefix := range kp.ignorePrefixes {
+		if strings.HasPrefix(param, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyQuery returns the part of a raw query that belongs in the key: the
+// params left once the ignored ones are dropped, sorted by name. ok is false
+// when params remain and the policy does not key by them.
+func (kp *cacheKeyPolicy) keyQuery(raw string) (string, bool) {
+	if raw == "" {
+		return "", true
+	}
+	if kp == nil {
+		return "", false
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return "", false
+	}
+	for name := range values {
+		if kp.ignored(name) {
+			delete(values, name)
+		}
+	}
+	if len(values) == 0 {
+		return "", true
+	}
+	if !kp.query {
+		return "", false
+	}
+	return values.Encode(), true
+}
+
+// keysVary reports whether a Vary field outside varyWhitelist is covered by
+// the key anyway.
+func (kp *cacheKeyPolicy) keysVary(field string) bool {
+	if kp == nil {
+		return false
+	}
+	return slices.Contains(kp.headers, field) || (field == "user-agent" && kp.device)
+}
+
+// parts returns the variant parts the policy adds for r, in buildVariant's
+// "name=value" form.
+func (kp *cacheKeyPolicy) parts(r *http.Request) []string {
+	if kp == nil {
+		return nil
+	}
+	var parts []string
+	for _, h := range kp.headers {
+		parts = append(parts, h+"="+r.Header.Get(h))
+	}
+	for _, name := range kp.cookies {
+		value := ""
+		if c, err := r.Cookie(name); err == nil {
+			value = c.Value
+		}
+		parts = append(parts, "cookie:"+name+"="+value)
+	}
+	if kp.device {
+		parts = append(parts, "device:"+deviceClass(r.UserAgent()))
+	}
+	return parts
+}
+
+// keysCookies reports whether every cookie r carries is one the key is built
+// from. Only then is the response known to be the same for everyone who
+// sends the same values.
+func (kp *cacheKeyPolicy) keysCookies(r *http.Request) bool {
+	if r.Header.Get("Cookie") == "" {
+		return true
+	}
+	if kp == nil || len(kp.cookies) == 0 {
+		return false
+	}
+	cookies := r.Cookies()
+	if len(cookies) == 0 {
+		return false
+	}
+	for _, c := range cookies {
+		if !slices.Contains(kp.cookies, c.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// copyTo gives a revalidation request the query, headers and cookies of r
+// that the key is built from, so it fetches and stores the same variant.
+func (kp *cacheKeyPolicy) copyTo(req, r *http.Request) {
+	if kp == nil {
+		return
+	}
+	req.URL.RawQuery, _ = kp.keyQuery(r.URL.RawQuery)
+	for _, h := range kp.headers {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	for _, name := range kp.cookies {
+		if c, err := r.Cookie(name); err == nil {
+			req.AddCookie(c)
+		}
+	}
+	if kp.device {
+		req.Header.Set("User-Agent", r.UserAgent())
+	}
+}
+
+// deviceClass buckets a User-Agent into "mobile", "tablet" or "desktop".
+func deviceClass(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return "tablet"
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod") ||
+		strings.Contains(ua, "android"):
+		return "mobile"
+	}
+	return "desktop"
+}
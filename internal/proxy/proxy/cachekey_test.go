@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"odac/internal/proxy/config"
+)
+
+func TestCacheKeyQuery(t *testing.T) {
+	ignoreOnly := newCacheKeyPolicy(&config.CacheKey{IgnoreQuery: []string{"utm_*", "fbclid"}})
+	keyed := newCacheKeyPolicy(&config.CacheKey{IgnoreQuery: []string{"utm_*"}, Query: true})
+	tests := []struct {
+		kp     *cacheKeyPolicy
+		raw    string
+		want   string
+		wantOK bool
+	}{
+		{nil, "", "", true},
+		{nil, "utm_source=x", "", false},
+		{ignoreOnly, "utm_source=news&utm_medium=mail&fbclid=1", "", true},
+		{ignoreOnly, "utm_source=news&page=2", "", false},
+		{ignoreOnly, "fbclid2=1", "", false},
+		{keyed, "sort=asc&utm_source=news&page=2", "page=2&sort=asc", true},
+		{keyed, "a=1;b=2", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.kp.keyQuery(tt.raw)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("keyQuery(%q) = %q, %v; want %q, %v", tt.raw, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestDeviceClass(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148":       "mobile",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) Chrome/120.0 Mobile Safari/537.36": "mobile",
+		"Mozilla/5.0 (Linux; Android 13; SM-X700) Chrome/120.0 Safari/537.36":        "tablet",
+		"Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) Mobile/15E148":                "tablet",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0 Safari/537.36":       "desktop",
+		"": "desktop",
+	}
+	for ua, want := range tests {
+		if got := deviceClass(ua); got != want {
+			t.Errorf("deviceClass(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestPageCacheKeyPolicy(t *testing.T) {
+	pc, cm := newTestPageCache()
+	defer cm.Stop()
+	kp := newCacheKeyPolicy(&config.CacheKey{
+		IgnoreQuery: []string{"utm_*"},
+		Query:       true,
+		Cookies:     []string{"currency"},
+		Headers:     []string{"Accept-Language"},
+		Device:      true,
+	})
+	resp := &http.Response{StatusCode: 200, Header: http.Header{
+		"Content-Type": []string{"text/html"},
+		"Vary":         []string{"Accept-Language, User-Agent"},
+	}}
+	req := func(target, cookie, ua string) *http.Request {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("Accept-Language", "de")
+		r.Header.Set("User-Agent", ua)
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		return r
+	}
+	put := func(r *http.Request, body string) {
+		pc.Put("example.com", r.URL.Path, r, kp, resp, []byte(body), time.Hour)
+		pc.Put("example.com", r.URL.Path, withIP(r, secondClient), kp, resp, []byte(body), time.Hour)
+	}
+	const desktop, phone = "Mozilla/5.0 (X11; Linux x86_64)", "Mozilla/5.0 (iPhone) Mobile"
+
+	put(req("http://example.com/list?page=2&sort=asc&utm_source=a", "currency=EUR", desktop), "page 2 EUR")
+	put(req("http://example.com/list?page=2&sort=asc", "currency=EUR", phone), "page 2 EUR mobile")
+	put(req("http://example.com/list?page=3", "currency=EUR; session=abc", desktop), "private")
+
+	get := func(r *http.Request) string {
+		if e := pc.Get("example.com", r.URL.Path, r, kp); e != nil {
+			return string(e.body)
+		}
+		return ""
+	}
+	if got := get(req("http://example.com/list?sort=asc&page=2&utm_campaign=b", "currency=EUR; session=xyz", desktop)); got != "page 2 EUR" {
+		t.Errorf("reordered query with other utm = %q", got)
+	}
+	if got := get(req("http://example.com/list?page=2&sort=asc", "currency=EUR", phone)); got != "page 2 EUR mobile" {
+		t.Errorf("mobile = %q", got)
+	}
+	if got := get(req("http://example.com/list?page=2&sort=asc", "currency=USD", desktop)); got != "" {
+		t.Errorf("other currency served %q", got)
+	}
+	if got := get(req("http://example.com/list?page=3", "currency=EUR", desktop)); got != "" {
+		t.Errorf("response to a session cookie cached: %q", got)
+	}
+	r := req("http://example.com/list?page=2&sort=asc", "currency=EUR", desktop)
+	if key, _ := pc.requestKey("example.com", r.URL.Path, r, kp); key != "page:example.com/list?page=2&sort=asc|accept-language=de&cookie:currency=EUR&device:desktop" {
+		t.Errorf("key = %q", key)
+	}
+
+	if n := pc.PurgeMatching("example.com", PurgeFilter{URL: "/list"}); n != 2 {
+		t.Errorf("URL purge dropped %d entries, want both query variants", n)
+	}
+}
+
+// TestCacheKeyThroughProxy checks the debug header and that a marketing URL
+// is served the page cached for the clean one.
+func TestCacheKeyThroughProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set(pageCacheHeader, "60")
+		io.WriteString(w, "<h1>Home</h1>")
+	}))
+	defer backend.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	n, _ := strconv.Atoi(port)
+
+	p := NewProxy()
+	p.UpdateConfig(map[string]config.Website{
+		"example.com": {Domain: "example.com", Port: n, ContainerIP: "127.0.0.1", CacheKey: &config.CacheKey{
+			IgnoreQuery: []string{"utm_*"},
+			Debug:       true,
+		}},
+	}, nil, nil, nil, nil)
+
+	get := func(target, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = ip + ":40000"
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+	get("http://example.com/", "198.51.100.1")
+	get("http://example.com/?utm_source=news", secondClient)
+
+	w := get("http://example.com/?utm_source=ads&utm_medium=cpc", "198.51.100.2")
+	if w.Header().Get("X-Odac-Cache") != "HIT" || w.Header().Get(cacheKeyHeader) != "example.com/" {
+		t.Fatalf("marketing URL not served from cache: %v", w.Header())
+	}
+	if w := get("http://example.com/?page=2", "198.51.100.2"); w.Header().Get(cacheKeyHeader) != "bypass" || w.Header().Get("X-Odac-Cache") == "HIT" {
+		t.Errorf("unkeyed query: %v", w.Header())
+	}
+}
@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"odac/internal/proxy/config"
+)
+
+// newTestDiskCache returns an enabled tier in a fresh directory.
+func newTestDiskCache(t *testing.T, dir string, maxSize int64) *DiskCache {
+	t.Helper()
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	dc := NewDiskCache(stop)
+	if _, ok := dc.Configure(&config.DiskCache{Dir: dir, MaxSize: maxSize}); !ok {
+		t.Fatal("Configure did not enable the tier")
+	}
+	return dc
+}
+
+// waitDisk waits for the writer to index key.
+func waitDisk(t *testing.T, dc *DiskCache, key string) *diskEntry {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if v, ok := dc.entries.Load(key); ok {
+			return v.(*diskEntry)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s never reached disk", key)
+	return nil
+}
+
+func cssMeta(key string) diskMeta {
+	return diskMeta{Key: key, Status: 200, Header: http.Header{
+		"Content-Type": []string{"text/css"},
+		"Etag":         []string{`"v1"`},
+	}, Created: time.Now().UnixNano()}
+}
+
+func TestDiskCacheWarmStart(t *testing.T) {
+	dir := t.TempDir()
+	dc := newTestDiskCache(t, dir, 64<<20)
+	body := []byte(strings.Repeat("body{color:red}", 100))
+	dc.put(cssMeta("example.com/site.css"), body)
+	dc.put(cssMeta("example.com/broken.css"), body)
+	waitDisk(t, dc, "example.com/site.css")
+	broken := waitDisk(t, dc, "example.com/broken.css")
+
+	// Damage one file the way a bad disk would: same size, other bytes.
+	raw, _ := os.ReadFile(broken.file)
+	raw[0] ^= 0xff
+	os.WriteFile(broken.file, raw, 0o600)
+
+	restarted := newTestDiskCache(t, dir, 64<<20)
+	gen := restarted.gen.Load()
+	restarted.load(gen, func(diskMeta, []byte) {})
+
+	e := restarted.get("example.com/site.css")
+	if e == nil {
+		t.Fatal("entry not warm-loaded")
+	}
+	if restarted.get("example.com/broken.css") != nil {
+		t.Error("corrupt entry served")
+	}
+	if _, err := os.Stat(broken.file); !os.IsNotExist(err) {
+		t.Error("corrupt file left on disk")
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/site.css", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	w := httptest.NewRecorder()
+	if !restarted.ServeFromDisk(w, req, e) {
+		t.Fatal("ServeFromDisk failed")
+	}
+	if w.Code != http.StatusPartialContent || w.Body.String() != "body" || w.Header().Get("X-Odac-Cache") != "HIT" {
+		t.Fatalf("range = %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	req = httptest.NewRequest("GET", "http://example.com/site.css", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	w = httptest.NewRecorder()
+	restarted.ServeFromDisk(w, req, e)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional = %d", w.Code)
+	}
+
+	// A file truncated behind the index's back is dropped on read.
+	os.Truncate(e.file, 10)
+	if restarted.ServeFromDisk(httptest.NewRecorder(), req, e) || restarted.get("example.com/site.css") != nil {
+		t.Error("truncated file served")
+	}
+}
+
+func TestDiskCacheRestoresPages(t *testing.T) {
+	dir := t.TempDir()
+	dc := newTestDiskCache(t, dir, 64<<20)
+	pc, cm := newTestPageCache()
+	defer cm.Stop()
+	cm.disk = dc
+
+	req := httptest.NewRequest("GET", "http://example.com/about", nil)
+	resp := &http.Response{StatusCode: 200, Header: http.Header{
+		"Content-Type":  []string{"text/html"},
+		cacheTagsHeader: []string{"about"},
+	}}
+	pc.Put("example.com", "/about", req, nil, resp, []byte("<h1>About</h1>"), time.Hour)
+	pc.Put("example.com", "/about", withIP(req, secondClient), nil, resp, []byte("<h1>About</h1>"), time.Hour)
+	waitDisk(t, dc, "page:example.com/about")
+
+	restarted := newTestDiskCache(t, dir, 64<<20)
+	pc2, cm2 := newTestPageCache()
+	defer cm2.Stop()
+	cm2.disk = restarted
+	restarted.load(restarted.gen.Load(), pc2.restore)
+
+	entry := pc2.Get("example.com", "/about", httptest.NewRequest("GET", "http://example.com/about", nil), nil)
+	if entry == nil || string(entry.body) != "<h1>About</h1>" {
+		t.Fatal("page not restored")
+	}
+	if n := pc2.PurgeMatching("example.com", PurgeFilter{Tags: []string{"about"}}); n != 1 {
+		t.Errorf("purged %d, want 1 (memory and disk counted once)", n)
+	}
+	if _, ok := restarted.entries.Load("page:example.com/about"); ok {
+		t.Error("disk copy survived the purge")
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dc := newTestDiskCache(t, t.TempDir(), 64<<10)
+	body := bytes.Repeat([]byte("x"), 6<<10)
+	hot := cssMeta("example.com/hot.css")
+	dc.put(hot, body)
+	e := waitDisk(t, dc, hot.Key)
+	e.hitCount.Store(1000)
+
+	for i := 0; i < 20; i++ {
+		m := cssMeta("example.com/cold-" + strconv.Itoa(i) + ".png")
+		dc.put(m, body)
+		waitDisk(t, dc, m.Key)
+	}
+	if got := dc.totalSize.Load(); got > 64<<10 {
+		t.Errorf("tier holds %d bytes, cap %d", got, 64<<10)
+	}
+	if dc.get(hot.Key) == nil {
+		t.Error("hot entry evicted before cold ones")
+	}
+	if dc.get("example.com/cold-0.png") != nil {
+		t.Error("oldest cold entry kept")
+	}
+}
+
+func TestDiskCacheDisable(t *testing.T) {
+	dir := t.TempDir() + "/cache"
+	dc := newTestDiskCache(t, dir, 64<<20)
+	dc.put(cssMeta("example.com/a.css"), []byte("a{}"))
+	waitDisk(t, dc, "example.com/a.css")
+
+	dc.Configure(nil)
+	if dc.get("example.com/a.css") != nil {
+		t.Error("served while off")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("directory kept after turning the tier off")
+	}
+}
+
+// TestLargeAssetThroughProxy checks that an asset too large for memory is
+// spilled to disk on a miss and then served from there, ranges included.
+func TestLargeAssetThroughProxy(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), (cacheMaxFileSize/10)+1000)
+	var fetches atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	defer backend.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	n, _ := strconv.Atoi(port)
+
+	p := NewProxy()
+	p.UpdateConfig(map[string]config.Website{
+		"example.com": {Domain: "example.com", Port: n, ContainerIP: "127.0.0.1"},
+	}, nil, nil, nil, nil)
+	p.ConfigureDiskCache(&config.DiskCache{Dir: t.TempDir(), MaxSize: 512 << 20})
+
+	get := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/bundle.js", nil)
+		req.RemoteAddr = "198.51.100.1:40000"
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 5; i++ {
+		p.cache.recordFrequency(cacheKey("example.com", "/bundle.js"))
+	}
+	if w := get(""); w.Body.Len() != len(body) {
+		t.Fatalf("miss served %d bytes", w.Body.Len())
+	}
+	waitDisk(t, p.cache.disk, "example.com/bundle.js")
+
+	w := get("bytes=10-19")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "0123456789" || w.Header().Get("X-Odac-Cache") != "HIT" {
+		t.Fatalf("range = %d %q", w.Code, w.Body.String())
+	}
+	w = get("")
+	if got, _ := io.ReadAll(w.Body); !bytes.Equal(got, body) {
+		t.Fatalf("full hit served %d bytes", len(got))
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("backend fetched %d times", n)
+	}
+
+	if n := p.Cache().Purge("example.com"); n != 1 {
+		t.Errorf("purged %d", n)
+	}
+	w = get("")
+	if w.Header().Get("X-Odac-Cache") == "HIT" || fetches.Load() != 2 {
+		t.Error("served from disk after purge")
+	}
+}
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"bufio"
 	"log"
 	"net"
 	"net/http"
@@ -8,43 +9,42 @@ import (
 	"sync"
 	"time"
 
+	"odac/internal/firewall"
 	"odac/internal/proxy/config"
 )
 
 type Firewall struct {
-	config        config.Firewall
-	blacklistMap  map[string]struct{}
-	whitelistMap  map[string]struct{}
-	requestCounts map[string]*requestRecord
-	wsCounts      map[string]int // Active WebSocket connections per IP
-	mu            sync.RWMutex
-	stopCleanup   chan struct{}
-}
-
-type requestRecord struct {
-	count     int
-	timestamp int64
+	config      config.Firewall
+	guard       *firewall.Guard
+	limiter     *rateLimiter   // Global per-IP token buckets
+	wsCounts    map[string]int // Active WebSocket connections per IP
+	mu          sync.RWMutex
+	stopCleanup chan struct{}
 }
 
 func NewFirewall(cfg config.Firewall) *Firewall {
 	f := &Firewall{
-		config:        cfg,
-		blacklistMap:  sliceToMap(cfg.Blacklist),
-		whitelistMap:  sliceToMap(cfg.Whitelist),
-		requestCounts: make(map[string]*requestRecord),
-		wsCounts:      make(map[string]int),
-		stopCleanup:   make(chan struct{}),
+		config:      cfg,
+		guard:       firewall.NewGuard("Proxy"),
+		limiter:     newRateLimiter(rateLimiterCapacity),
+		wsCounts:    make(map[string]int),
+		stopCleanup: make(chan struct{}),
 	}
+	f.guard.Update(cfg.Policy)
 	go f.startCleanupLoop()
 	return f
 }
 
 func (f *Firewall) UpdateConfig(cfg config.Firewall) {
 	f.mu.Lock()
-	defer f.mu.Unlock()
 	f.config = cfg
-	f.blacklistMap = sliceToMap(cfg.Blacklist)
-	f.whitelistMap = sliceToMap(cfg.Whitelist)
+	f.mu.Unlock()
+	f.guard.Update(cfg.Policy)
+}
+
+// Guard returns the shared IP policy engine (control API: /firewall).
+func (f *Firewall) Guard() *firewall.Guard {
+	return f.guard
 }
 
 func (f *Firewall) GetRequestTimeout() int {
@@ -58,7 +58,7 @@ func (f *Firewall) startCleanupLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			f.cleanup()
+			f.guard.Prune()
 		case <-f.stopCleanup:
 			ticker.Stop()
 			return
@@ -66,24 +66,6 @@ func (f *Firewall) startCleanupLoop() {
 	}
 }
 
-func (f *Firewall) cleanup() {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	if f.config.RateLimit.WindowMs == 0 {
-		return
-	}
-
-	now := time.Now().UnixMilli()
-	windowMs := int64(f.config.RateLimit.WindowMs)
-
-	for ip, record := range f.requestCounts {
-		if now-record.timestamp > windowMs {
-			delete(f.requestCounts, ip)
-		}
-	}
-}
-
 func (f *Firewall) Check(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		f.mu.RLock()
@@ -93,12 +75,8 @@ func (f *Firewall) Check(next http.Handler) http.Handler {
 			return
 		}
 
-		// Copy config values needed for checking to avoid holding RLock too long if possible,
-		// but checking slice contains is fast enough to keep lock.
-		// However, we need to upgrade lock for rate limiting.
-
-		blacklistMap := f.blacklistMap
-		whitelistMap := f.whitelistMap
+		// Copy config values needed for checking to avoid holding RLock too long;
+		// we need to upgrade the lock for rate limiting.
 		rateLimit := f.config.RateLimit
 		f.mu.RUnlock()
 
@@ -112,46 +90,29 @@ func (f *Firewall) Check(next http.Handler) http.Handler {
 			ip = ip[7:]
 		}
 
-		if _, ok := whitelistMap[ip]; ok {
-			next.ServeHTTP(w, r)
-			return
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
 		}
 
-		if _, ok := blacklistMap[ip]; ok {
-			log.Printf("Blocked request from blacklisted IP: %s", ip)
+		if ok, reason := f.guard.Check(ip, host); !ok {
+			debugLog("Blocked request from %s to %s: %s", ip, host, reason)
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
-		if rateLimit.Enabled {
-			f.mu.Lock()
-			// Memory protection
-			if len(f.requestCounts) > 20000 {
-				f.requestCounts = make(map[string]*requestRecord)
-				log.Println("Firewall request counts cleared due to memory limit")
+		if rateLimit.Enabled && rateLimit.Max > 0 && rateLimit.WindowMs > 0 {
+			burst := rateLimit.Burst
+			if burst <= 0 {
+				burst = rateLimit.Max
 			}
-
-			now := time.Now().UnixMilli()
-			record, exists := f.requestCounts[ip]
-
-			if !exists {
-				f.requestCounts[ip] = &requestRecord{count: 1, timestamp: now}
-			} else {
-				if now-record.timestamp > int64(rateLimit.WindowMs) {
-					record.count = 1
-					record.timestamp = now
-				} else {
-					record.count++
-				}
-			}
-
-			count := f.requestCounts[ip].count
-			f.mu.Unlock()
-
-			if count > rateLimit.Max {
-				if count == rateLimit.Max+1 {
+			window := time.Duration(rateLimit.WindowMs) * time.Millisecond
+			d := f.limiter.take(ip, float64(rateLimit.Max)/window.Seconds(), burst)
+			if !d.allowed {
+				if d.first {
 					log.Printf("Rate limit exceeded for IP: %s", ip)
 				}
+				setRateHeaders(w.Header(), d, window)
 				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 				return
 			}
@@ -185,14 +146,52 @@ func (f *Firewall) Check(next http.Handler) http.Handler {
 			}()
 		}
 
-		next.ServeHTTP(w, r)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		// 4xx floods (path scanners, credential stuffing against login forms)
+		// feed the shared auto-ban; 429s we produced ourselves do not count
+		// twice, the rate limiter already answered those.
+		if sw.status >= 400 && sw.status < 500 && sw.status != http.StatusTooManyRequests {
+			f.guard.Record(firewall.EventHTTP4xx, ip)
+		}
 	})
 }
 
-func sliceToMap(slice []string) map[string]struct{} {
-	m := make(map[string]struct{}, len(slice))
-	for _, s := range slice {
-		m[s] = struct{}{}
+// statusWriter records the response status for the auto-ban counters while
+// keeping the optional interfaces the proxy relies on (Flusher for
+// streaming, Hijacker for WebSocket upgrades and the anti-scan drop).
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	// 1xx (103 Early Hints) precede the real status; skip them.
+	if sw.status == 0 && code >= 200 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
-	return m
+}
+
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(sw.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
 }
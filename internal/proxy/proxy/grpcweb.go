@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// gRPC-Web (https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md)
+// is gRPC for browsers, which cannot read HTTP trailers: the trailers travel
+// as a last length-prefixed frame of the body instead, flagged 0x80. The
+// -text variant base64-encodes the body both ways.
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+	grpcWebTrailerFlag     = 0x80
+)
+
+func isGRPCWeb(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// translateGRPCWeb turns a gRPC-Web request into a gRPC one and returns the
+// writer that turns the response back. finish must be called once the
+// response has been proxied.
+func translateGRPCWeb(w http.ResponseWriter, r *http.Request) (*grpcWebWriter, *http.Request) {
+	ct := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(ct, grpcWebTextContentType)
+	prefix := grpcWebContentType
+	if text {
+		prefix = grpcWebTextContentType
+	}
+
+	req := r.Clone(r.Context())
+	req.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(ct, prefix))
+	req.Header.Set("Te", "trailers")
+	req.Header.Del("Content-Length")
+	req.Header.Del("X-Grpc-Web")
+	req.ContentLength = -1
+	if text {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{base64.NewDecoder(base64.StdEncoding, r.Body), r.Body}
+	}
+	return &grpcWebWriter{w: w, header: make(http.Header), prefix: prefix, text: text}, req
+}
+
+// grpcWebWriter keeps the backend's response headers to itself until
+// WriteHeader, so the trailers set after the body never reach the client
+// as HTTP trailers; finish writes them as the trailer frame.
+type grpcWebWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	prefix      string
+	text        bool
+	wroteHeader bool
+	announced   []string
+}
+
+func (gw *grpcWebWriter) Header() http.Header {
+	return gw.header
+}
+
+func (gw *grpcWebWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+	dst := gw.w.Header()
+	for k, vv := range gw.header {
+		if k == "Trailer" {
+			for _, v := range vv {
+				for _, name := range strings.Split(v, ",") {
+					gw.announced = append(gw.announced, http.CanonicalHeaderKey(strings.TrimSpace(name)))
+				}
+			}
+			continue
+		}
+		dst[k] = vv
+	}
+	if ct := dst.Get("Content-Type"); strings.HasPrefix(ct, "application/grpc") {
+		dst.Set("Content-Type", gw.prefix+strings.TrimPrefix(ct, "application/grpc"))
+	}
+	dst.Del("Content-Length")
+	gw.w.WriteHeader(code)
+}
+
+func (gw *grpcWebWriter) Write(b []byte) (int, error) {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if !gw.text {
+		return gw.w.Write(b)
+	}
+	if _, err := gw.w.Write([]byte(base64.StdEncoding.EncodeToString(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (gw *grpcWebWriter) Flush() {
+	http.NewResponseController(gw.w).Flush()
+}
+
+// finish writes the backend's trailers as the trailer frame. A response
+// without trailers (an error page, or a trailers-only gRPC reply whose
+// status is in the headers) gets none.
+func (gw *grpcWebWriter) finish() {
+	trailers := make(http.Header)
+	for _, name := range gw.announced {
+		if vv := gw.header[name]; len(vv) > 0 {
+			trailers[name] = vv
+		}
+	}
+	for k, vv := range gw.header {
+		if name, ok := strings.CutPrefix(k, http.TrailerPrefix); ok {
+			trailers[http.CanonicalHeaderKey(name)] = vv
+		}
+	}
+	if len(trailers) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(trailers))
+	for k := range trailers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var block strings.Builder
+	for _, k := range names {
+		for _, v := range trailers[k] {
+			block.WriteString(strings.ToLower(k) + ": " + v + "\r\n")
+		}
+	}
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	frame = append(frame, block.String()...)
+	gw.Write(frame)
+	gw.Flush()
+}
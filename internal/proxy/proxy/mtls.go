@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"odac/internal/proxy/config"
+)
+
+// Client certificate details forwarded to apps on mTLS websites. Clients
+// can never set them: the director strips them from every request.
+const (
+	clientCertVerified    = "X-Odac-Client-Cert-Verified" // "SUCCESS" or "NONE"
+	clientCertSubject     = "X-Odac-Client-Cert-Subject"
+	clientCertIssuer      = "X-Odac-Client-Cert-Issuer"
+	clientCertSerial      = "X-Odac-Client-Cert-Serial"
+	clientCertFingerprint = "X-Odac-Client-Cert-Fingerprint" // SHA-256, hex
+)
+
+var clientCertHeaders = []string{clientCertVerified, clientCertSubject, clientCertIssuer, clientCertSerial, clientCertFingerprint}
+
+// clientCA is one website's compiled mTLS policy. Its TLS config is cloned
+// from the server's on the first handshake that needs it.
+type clientCA struct {
+	pool    *x509.CertPool
+	require bool
+
+	once sync.Once
+	conf *tls.Config
+}
+
+// newClientCA loads a website's CA bundle; nil when mTLS is off.
+func newClientCA(domain string, m *config.MTLS) *clientCA {
+	if m == nil {
+		return nil
+	}
+	pool := x509.NewCertPool()
+	pemData, err := os.ReadFile(m.CA)
+	if err == nil && !pool.AppendCertsFromPEM(pemData) {
+		err = fmt.Errorf("no certificates in %s", m.CA)
+	}
+	if err != nil {
+		// Fail closed: with an empty pool no client certificate verifies.
+		log.Printf("[mTLS] Failed to load the CA bundle of %s: %v", domain, err)
+		pool = x509.NewCertPool()
+	}
+	return &clientCA{pool: pool, require: m.Mode != "optional"}
+}
+
+func (c *clientCA) config(base *tls.Config) *tls.Config {
+	c.once.Do(func() {
+		conf := base.Clone()
+		conf.GetConfigForClient = nil
+		conf.ClientCAs = c.pool
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.require {
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		// Tickets of its own, so a session resumed here was verified
+		// against this website's CAs.
+		var key [32]byte
+		rand.Read(key[:])
+		conf.SetSessionTicketKeys([][32]byte{key})
+		c.conf = conf
+	})
+	return c.conf
+}
+
+// clientAuthConfig asks for a client certificate on websites with mTLS and
+// leaves base alone otherwise.
+func (p *Proxy) clientAuthConfig(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if hello.ServerName == "" {
+			return nil, nil
+		}
+		p.mu.RLock()
+		website, exists := p.resolveDomain(strings.ToLower(hello.ServerName))
+		ca := p.clientCAs[website.Domain]
+		p.mu.RUnlock()
+		if !exists || ca == nil {
+			return nil, nil
+		}
+		return ca.config(base), nil
+	}
+}
+
+// setClientCertHeaders tells the app who the client is. Only verified
+// chains count; on an "optional" website a client without a certificate is
+// NONE.
+func setClientCertHeaders(req *http.Request) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		req.Header.Set(clientCertVerified, "NONE")
+		return
+	}
+	leaf := req.TLS.VerifiedChains[0][0]
+	sum := sha256.Sum256(leaf.Raw)
+	req.Header.Set(clientCertVerified, "SUCCESS")
+	req.Header.Set(clientCertSubject, headerSafe(leaf.Subject.String()))
+	req.Header.Set(clientCertIssuer, headerSafe(leaf.Issuer.String()))
+	req.Header.Set(clientCertSerial, strings.ToUpper(leaf.SerialNumber.Text(16)))
+	req.Header.Set(clientCertFingerprint, hex.EncodeToString(sum[:]))
+}
+
+// headerSafe drops the control characters a certificate name may carry,
+// which would make the upstream request invalid.
+func headerSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
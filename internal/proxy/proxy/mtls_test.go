@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"odac/internal/proxy/config"
+)
+
+// testCA issues client certificates for the mTLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) client(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(0xBEEF),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Acme"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// mtlsProxy serves p over TLS the way cmd/odac-proxy does and returns its
+// address.
+func mtlsProxy(t *testing.T, p *Proxy) string {
+	t.Helper()
+	base := &tls.Config{GetCertificate: p.GetCertificate, MinVersion: tls.VersionTLS12}
+	base.GetConfigForClient = p.ConfigForClient(base)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: p}
+	go srv.Serve(tls.NewListener(l, base))
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().String()
+}
+
+func TestMTLS(t *testing.T) {
+	seen := make(chan http.Header, 10)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Clone()
+	}))
+	defer backend.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	backendPort, _ := strconv.Atoi(port)
+
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, ca.pem, 0o600)
+	site := func(name, mode string) config.Website {
+		w := config.Website{Domain: name, Port: backendPort, ContainerIP: "127.0.0.1", Cert: config.Cert{SSL: selfSigned(t, t.TempDir(), name)}}
+		if mode != "" {
+			w.MTLS = &config.MTLS{CA: caFile, Mode: mode}
+		}
+		return w
+	}
+	p := NewProxy()
+	p.UpdateConfig(map[string]config.Website{
+		"secure.test":   site("secure.test", "require"),
+		"optional.test": site("optional.test", "optional"),
+		"open.test":     site("open.test", ""),
+	}, nil, nil, nil, nil)
+	addr := mtlsProxy(t, p)
+
+	get := func(host string, certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{ServerName: host, InsecureSkipVerify: true, Certificates: certs},
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}}
+		req, _ := http.NewRequest("GET", "https://"+host+"/", nil)
+		req.Header.Set(clientCertSubject, "CN=forged")
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	if _, err := get("secure.test"); err == nil {
+		t.Fatal("required client certificate not enforced")
+	}
+	other := newTestCA(t)
+	if _, err := get("secure.test", other.client(t, "intruder")); err == nil {
+		t.Fatal("certificate from an unknown CA accepted")
+	}
+
+	if resp, err := get("secure.test", ca.client(t, "alice")); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET = %v, %v", resp, err)
+	}
+	h := <-seen
+	if h.Get(clientCertVerified) != "SUCCESS" || h.Get(clientCertSubject) != "CN=alice,O=Acme" ||
+		h.Get(clientCertIssuer) != "CN=Test CA" || h.Get(clientCertSerial) != "BEEF" || len(h.Get(clientCertFingerprint)) != 64 {
+		t.Errorf("headers = %v", h)
+	}
+
+	if resp, err := get("optional.test"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("optional GET = %v, %v", resp, err)
+	}
+	if h := <-seen; h.Get(clientCertVerified) != "NONE" || h.Get(clientCertSubject) != "" {
+		t.Errorf("headers = %v", h)
+	}
+
+	// Websites without mTLS neither ask for a certificate nor pass forged
+	// headers on.
+	if resp, err := get("open.test", ca.client(t, "alice")); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("open GET = %v, %v", resp, err)
+	}
+	if h := <-seen; h.Get(clientCertSubject) != "" || h.Get(clientCertVerified) != "" {
+		t.Errorf("headers = %v", h)
+	}
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"odac/internal/proxy/config"
+)
+
+const (
+	onDemandWait       = 30 * time.Second // how long a handshake waits for its certificate
+	onDemandPendingTTL = 10 * time.Minute // an approved host the server never picked up is dropped
+	onDemandDenyTTL    = 10 * time.Minute // a refused host is not asked about again before this
+	maxOnDemandPending = 256
+	maxOnDemandDenied  = 10000
+)
+
+// OnDemand decides whether an unknown hostname may get a certificate and
+// parks the handshakes waiting for it. The orchestrator polls Pending,
+// issues the certificate and syncs the config, which releases the waiters.
+type OnDemand struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	rules   []config.OnDemand
+	pending map[string]*onDemandRequest
+	denied  map[string]time.Time
+}
+
+type onDemandRequest struct {
+	app      string // "" while the ask is still running
+	since    time.Time
+	ready    chan struct{}
+	approved bool
+}
+
+// OnDemandRequest is one approved hostname awaiting its certificate.
+type OnDemandRequest struct {
+	Domain string `json:"domain"`
+	App    string `json:"app"`
+}
+
+func NewOnDemand() *OnDemand {
+	return &OnDemand{
+		client:  &http.Client{Timeout: 5 * time.Second},
+		pending: make(map[string]*onDemandRequest),
+		denied:  make(map[string]time.Time),
+	}
+}
+
+// UpdateConfig replaces the per-app rules. Earlier refusals are forgotten
+// when the rules changed; every issuance syncs the config, so an unchanged
+// push keeps them.
+func (o *OnDemand) UpdateConfig(rules []config.OnDemand) {
+	sorted := append([]config.OnDemand(nil), rules...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].App < sorted[j].App })
+	o.mu.Lock()
+	if !slices.EqualFunc(o.rules, sorted, sameOnDemandRule) {
+		o.denied = make(map[string]time.Time)
+	}
+	o.rules = sorted
+	o.mu.Unlock()
+}
+
+func sameOnDemandRule(a, b config.OnDemand) bool {
+	return a.App == b.App && a.Host == b.Host && a.Port == b.Port && a.Ask == b.Ask && slices.Equal(a.Allow, b.Allow)
+}
+
+// Await blocks until host has a certificate, reporting false when it is
+// refused or the wait times out. Concurrent handshakes for one host share
+// a single approval check.
+func (o *OnDemand) Await(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !validOnDemandHost(host) {
+		return false
+	}
+	now := time.Now()
+
+	o.mu.Lock()
+	req := o.pending[host]
+	if req == nil {
+		if until, ok := o.denied[host]; ok && now.Before(until) || len(o.rules) == 0 || len(o.pending) >= maxOnDemandPending {
+			o.mu.Unlock()
+			return false
+		}
+		req = &onDemandRequest{since: now, ready: make(chan struct{})}
+		o.pending[host] = req
+		rules := o.rules
+		o.mu.Unlock()
+		go o.approve(host, req, rules)
+	} else {
+		o.mu.Unlock()
+	}
+
+	timer := time.NewTimer(onDemandWait)
+	defer timer.Stop()
+	select {
+	case <-req.ready:
+		return req.approved
+	case <-timer.C:
+		return false
+	}
+}
+
+// approve runs the rules in app order; the first app that claims host
+// gets it.
+func (o *OnDemand) approve(host string, req *onDemandRequest, rules []config.OnDemand) {
+	app := ""
+	for _, rule := range rules {
+		if matchOnDemand(host, rule.Allow) || rule.Ask != "" && o.ask(host, rule) {
+			app = rule.App
+			break
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if app == "" {
+		delete(o.pending, host)
+		if len(o.denied) >= maxOnDemandDenied {
+			o.pruneDenied(time.Now())
+		}
+		o.denied[host] = time.Now().Add(onDemandDenyTTL)
+		close(req.ready)
+		debugLog("[OnDemand] No app claims %s", host)
+		return
+	}
+	req.app = app
+	log.Printf("[OnDemand] %s approved for %s, waiting for its certificate", host, app)
+}
+
+func (o *OnDemand) ask(host string, rule config.OnDemand) bool {
+	target := "http://" + net.JoinHostPort(rule.Host, strconv.Itoa(rule.Port)) + rule.Ask
+	sep := "?"
+	if strings.Contains(rule.Ask, "?") {
+		sep = "&"
+	}
+	resp, err := o.client.Get(target + sep + "domain=" + url.QueryEscape(host))
+	if err != nil {
+		debugLog("[OnDemand] Ask endpoint of %s failed: %v", rule.App, err)
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// Release wakes the handshakes for every pending host that now has a
+// certificate.
+func (o *OnDemand) Release(hasCert func(host string) bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for host, req := range o.pending {
+		if req.app != "" && hasCert(host) {
+			req.approved = true
+			close(req.ready)
+			delete(o.pending, host)
+		}
+	}
+}
+
+// Pending lists the approved hosts still waiting for a certificate.
+func (o *OnDemand) Pending() []OnDemandRequest {
+	now := time.Now()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := []OnDemandRequest{}
+	for host, req := range o.pending {
+		if req.app == "" {
+			continue
+		}
+		if now.Sub(req.since) > onDemandPendingTTL {
+			close(req.ready)
+			delete(o.pending, host)
+			continue
+		}
+		out = append(out, OnDemandRequest{Domain: host, App: req.app})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Domain < out[j].Domain })
+	return out
+}
+
+func (o *OnDemand) pruneDenied(now time.Time) {
+	for host, until := range o.denied {
+		if now.After(until) {
+			delete(o.denied, host)
+		}
+	}
+	if len(o.denied) >= maxOnDemandDenied {
+		o.denied = make(map[string]time.Time)
+	}
+}
+
+// matchOnDemand reports whether host matches one of the patterns. A leading
+// "*." matches any subdomain, at any depth, but not the bare parent.
+func matchOnDemand(host string, patterns []string) bool {
+	for _, p := range patterns {
+		if suffix, ok := strings.CutPrefix(p, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == p {
+			return true
+		}
+	}
+	return false
+}
+
+// validOnDemandHost accepts DNS names only: scanners probing with IPs,
+// single labels or junk never reach the ask endpoint.
+func validOnDemandHost(host string) bool {
+	if len(host) > 253 || !strings.Contains(host, ".") || net.ParseIP(host) != nil {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
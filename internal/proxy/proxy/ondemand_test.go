@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"odac/internal/proxy/config"
+)
+
+// waitPending polls until host is approved and queued for the orchestrator.
+func waitPending(t *testing.T, o *OnDemand, host, app string) {
+	t.Helper()
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, req := range o.Pending() {
+			if req.Domain == host && req.App == app {
+				return
+			}
+		}
+	}
+	t.Fatalf("%s never became pending for %s: %+v", host, app, o.Pending())
+}
+
+func TestOnDemandCertificateIssuedWhileHandshakeWaits(t *testing.T) {
+	p := NewProxy()
+	p.OnDemand().UpdateConfig([]config.OnDemand{{App: "shop", Host: "127.0.0.1", Port: 1, Allow: []string{"*.customers.test"}}})
+
+	type result struct {
+		cert *tls.Certificate
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		cert, err := p.GetCertificate(&tls.ClientHelloInfo{ServerName: "shop.customers.test"})
+		done <- result{cert, err}
+	}()
+	waitPending(t, p.OnDemand(), "shop.customers.test", "shop")
+
+	// The orchestrator registers the domain first, then saves its cert.
+	p.UpdateConfig(map[string]config.Website{
+		"shop.customers.test": {Domain: "shop.customers.test", OnDemand: true},
+	}, nil, nil, nil, nil)
+	select {
+	case r := <-done:
+		t.Fatalf("handshake finished before the certificate existed: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	paths := selfSigned(t, t.TempDir(), "shop.customers.test")
+	p.UpdateConfig(map[string]config.Website{
+		"shop.customers.test": {Domain: "shop.customers.test", OnDemand: true, Cert: config.Cert{SSL: paths}},
+	}, nil, nil, nil, nil)
+	select {
+	case r := <-done:
+		if r.err != nil || r.cert == nil {
+			t.Fatalf("GetCertificate = %v, %v", r.cert, r.err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("handshake never released")
+	}
+	if pending := p.OnDemand().Pending(); len(pending) != 0 {
+		t.Errorf("still pending: %+v", pending)
+	}
+}
+
+func TestOnDemandAskEndpoint(t *testing.T) {
+	asked := make(chan string, 10)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked <- r.URL.RequestURI()
+		if r.URL.Query().Get("domain") != "ok.example.org" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer app.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(app.URL, "http://"))
+	portNum, _ := strconv.Atoi(port)
+
+	rules := []config.OnDemand{
+		{App: "b-saas", Host: host, Port: portNum, Ask: "/check?v=1"},
+		{App: "a-other", Host: host, Port: portNum, Allow: []string{"shop.example.net"}},
+	}
+	o := NewOnDemand()
+	o.UpdateConfig(rules)
+
+	go o.Await("ok.example.org")
+	waitPending(t, o, "ok.example.org", "b-saas")
+	if uri := <-asked; uri != "/check?v=1&domain=ok.example.org" {
+		t.Errorf("asked %q", uri)
+	}
+
+	start := time.Now()
+	if o.Await("nope.example.org") {
+		t.Fatal("refused host approved")
+	}
+	<-asked
+	// A refusal is remembered: the app is not asked again.
+	if o.Await("nope.example.org") || time.Since(start) > 2*time.Second {
+		t.Fatal("refused host approved or slow")
+	}
+	select {
+	case uri := <-asked:
+		t.Errorf("asked again: %q", uri)
+	default:
+	}
+	// A sync with the same rules, as after every issuance, keeps the refusal;
+	// changed rules drop it.
+	o.UpdateConfig(rules)
+	if o.Await("nope.example.org") {
+		t.Fatal("refused host approved")
+	}
+	select {
+	case uri := <-asked:
+		t.Errorf("asked again after an unchanged sync: %q", uri)
+	default:
+	}
+	o.UpdateConfig(append(rules[:1:1], config.OnDemand{App: "a-other", Host: host, Port: portNum}))
+	if o.Await("nope.example.org") {
+		t.Fatal("refused host approved")
+	}
+	if uri := <-asked; uri != "/check?v=1&domain=nope.example.org" {
+		t.Errorf("asked %q after the rules changed", uri)
+	}
+
+	for _, bad := range []string{"10.0.0.1", "localhost", "a..b", "-x.example.org", "x_y.example.org"} {
+		if o.Await(bad) {
+			t.Errorf("%q approved", bad)
+		}
+	}
+	select {
+	case uri := <-asked:
+		t.Errorf("invalid host reached the ask endpoint: %q", uri)
+	default:
+	}
+}
+
+func TestMatchOnDemand(t *testing.T) {
+	patterns := []string{"*.customers.test", "shop.example.com"}
+	for host, want := range map[string]bool{
+		"a.customers.test":   true,
+		"a.b.customers.test": true,
+		"customers.test":     false,
+		"shop.example.com":   true,
+		"x.shop.example.com": false,
+		"evilcustomers.test": false,
+	} {
+		if got := matchOnDemand(host, patterns); got != want {
+			t.Errorf("matchOnDemand(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
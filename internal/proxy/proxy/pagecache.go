@@ -4,6 +4,7 @@ import (
 	"hash/fnv"
 	"net"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,6 +21,8 @@ import (
 //
 // Supports Vary-based variants (whitelisted headers only) so the same
 // URL can serve different cached responses for HTML vs AJAX requests.
+// A website's cache key policy (cachekey.go) can add query params, cookies,
+// headers and the device class to the key.
 //
 // Uses stale-while-revalidate: cached response is served instantly,
 // backend is checked async (throttled to 1 req/s per entry).
@@ -55,6 +58,7 @@ type pageEntry struct {
 	ttl        time.Duration // App-specified TTL from X-Odac-Cache
 	createdAt  int64         // Unix nano
 	firstIP    string        // Source IP of the first observation (pre-stable)
+	tags       []string      // From X-Odac-Cache-Tags, for PurgeMatching
 
 	lastAccess      atomic.Int64
 	hitCount        atomic.Int64
@@ -104,7 +108,8 @@ func clientIP(r *http.Request) string {
 	return r.RemoteAddr
 }
 
-// pageKey builds a cache key from host + path + vary variant.
+// pageKey builds a cache key from host + path + vary variant. A keyed query
+// is part of urlPath ("/list?page=2").
 func pageKey(host, urlPath, variant string) string {
 	if variant == "" {
 		return "page:" + host + urlPath
@@ -112,20 +117,20 @@ func pageKey(host, urlPath, variant string) string {
 	return "page:" + host + urlPath + "|" + variant
 }
 
-// buildVariant extracts the vary-based cache key suffix from the request.
+// buildVariant extracts the vary-based cache key suffix from the request,
+// plus the parts kp keys by.
 // Returns ("", true) if no variant needed, (variant, true) if safe,
 // or ("", false) if the Vary header contains unsafe fields.
-func buildVariant(r *http.Request, varyHeader string) (string, bool) {
-	if varyHeader == "" {
-		return "", true
-	}
-
-	var parts []string
+func buildVariant(r *http.Request, varyHeader string, kp *cacheKeyPolicy) (string, bool) {
+	parts := kp.parts(r)
 	for _, field := range strings.Split(varyHeader, ",") {
 		field = strings.TrimSpace(strings.ToLower(field))
 		if field == "" || field == "accept-encoding" {
 			continue // Ignored — we cache raw body
 		}
+		if kp.keysVary(field) {
+			continue // Already in parts
+		}
 		if !varyWhitelist[field] {
 			return "", false // Unsafe field — don't cache
 		}
@@ -139,16 +144,35 @@ func buildVariant(r *http.Request, varyHeader string) (string, bool) {
 	}
 
 	// Sort for deterministic key
-	for i := 1; i < len(parts); i++ {
-		j := i
-		for j > 0 && parts[j] < parts[j-1] {
-			parts[j], parts[j-1] = parts[j-1], parts[j]
-			j--
-		}
-	}
+	slices.Sort(parts)
 	return strings.Join(parts, "&"), true
 }
 
+// requestKey builds r's key with the Vary header learned for the URL. ok is
+// false when r bypasses the page cache.
+func (pc *PageCache) requestKey(host, urlPath string, r *http.Request, kp *cacheKeyPolicy) (string, bool) {
+	varyHeader := ""
+	if v, ok := pc.varyMap.Load(host + urlPath); ok {
+		varyHeader = v.(string)
+	}
+	return pageKeyFor(host, urlPath, r, kp, varyHeader)
+}
+
+func pageKeyFor(host, urlPath string, r *http.Request, kp *cacheKeyPolicy, varyHeader string) (string, bool) {
+	query, ok := kp.keyQuery(r.URL.RawQuery)
+	if !ok {
+		return "", false
+	}
+	variant, ok := buildVariant(r, varyHeader, kp)
+	if !ok {
+		return "", false
+	}
+	if query != "" {
+		urlPath += "?" + query
+	}
+	return pageKey(host, urlPath, variant), true
+}
+
 // ParseTTL extracts the cache TTL from the X-Odac-Cache header.
 // Returns 0 if the header is missing, invalid, or explicitly 0.
 func ParseTTL(resp *http.Response) time.Duration {
@@ -188,8 +212,9 @@ func IsPageCacheAllowed(resp *http.Response) bool {
 	return true
 }
 
-// Get retrieves a cached page. Returns nil on miss or if expired.
-func (pc *PageCache) Get(host, urlPath string, r *http.Request) *pageEntry {
+// Get retrieves a cached page, keyed under kp. Returns nil on miss or if
+// expired.
+func (pc *PageCache) Get(host, urlPath string, r *http.Request, kp *cacheKeyPolicy) *pageEntry {
 	if !pc.cache.enabled.Load() {
 		return nil
 	}
@@ -199,28 +224,16 @@ func (pc *PageCache) Get(host, urlPath string, r *http.Request) *pageEntry {
 		return nil
 	}
 
-	// No query strings
-	if r.URL.RawQuery != "" {
-		return nil
-	}
-
 	// No Authorization header
 	if r.Header.Get("Authorization") != "" {
 		return nil
 	}
 
-	// Look up the learned Vary header for this URL
-	varyHeader := ""
-	if v, ok := pc.varyMap.Load(host + urlPath); ok {
-		varyHeader = v.(string)
-	}
-
-	variant, safe := buildVariant(r, varyHeader)
-	if !safe {
+	// Query strings only as far as the key policy covers them
+	key, ok := pc.requestKey(host, urlPath, r, kp)
+	if !ok {
 		return nil
 	}
-
-	key := pageKey(host, urlPath, variant)
 	val, ok := pc.entries.Load(key)
 	if !ok {
 		return nil
@@ -233,6 +246,7 @@ func (pc *PageCache) Get(host, urlPath string, r *http.Request) *pageEntry {
 		pc.entries.Delete(key)
 		pc.totalSize.Add(-int64(entry.size))
 		pc.cache.totalSize.Add(-int64(entry.size))
+		pc.cache.disk.remove(key)
 		return nil
 	}
 
@@ -246,8 +260,8 @@ func (pc *PageCache) Get(host, urlPath string, r *http.Request) *pageEntry {
 	return entry
 }
 
-// Put stores a page response in cache.
-func (pc *PageCache) Put(host, urlPath string, r *http.Request, resp *http.Response, body []byte, ttl time.Duration) {
+// Put stores a page response in cache, keyed under kp.
+func (pc *PageCache) Put(host, urlPath string, r *http.Request, kp *cacheKeyPolicy, resp *http.Response, body []byte, ttl time.Duration) {
 	if !pc.cache.enabled.Load() || ttl <= 0 {
 		return
 	}
@@ -257,7 +271,9 @@ func (pc *PageCache) Put(host, urlPath string, r *http.Request, resp *http.Respo
 	// would let it be served to other users (a cross-user data leak). A
 	// cookieless response is, by construction, not personalized by session, so
 	// it is safe to share with everyone — including cookied users on a hit.
-	if r.Header.Get("Cookie") != "" {
+	// Cookies the key policy keys by are the exception: the entry is only
+	// shared with requests carrying the same values.
+	if !kp.keysCookies(r) {
 		return
 	}
 
@@ -272,8 +288,8 @@ func (pc *PageCache) Put(host, urlPath string, r *http.Request, resp *http.Respo
 	}
 
 	varyHeader := resp.Header.Get("Vary")
-	variant, safe := buildVariant(r, varyHeader)
-	if !safe {
+	key, ok := pageKeyFor(host, urlPath, r, kp, varyHeader)
+	if !ok {
 		return
 	}
 
@@ -285,8 +301,6 @@ func (pc *PageCache) Put(host, urlPath string, r *http.Request, resp *http.Respo
 		pc.varyMap.Delete(urlKey)
 	}
 
-	key := pageKey(host, urlPath, variant)
-
 	newHash := hashBody(body)
 	ip := clientIP(r)
 
@@ -304,6 +318,14 @@ func (pc *PageCache) Put(host, urlPath string, r *http.Request, resp *http.Respo
 			if !entry.stable && ip != entry.firstIP {
 				entry.stable = true
 				entry.lastAccess.Store(time.Now().UnixNano())
+				pc.cache.disk.put(diskMeta{
+					Key:     key,
+					Status:  entry.statusCode,
+					Header:  entry.headers,
+					Tags:    entry.tags,
+					Created: entry.createdAt,
+					Expires: entry.createdAt + int64(entry.ttl),
+				}, entry.body)
 				debugLog("[PageCache] Stability confirmed (2 clients): %s", key)
 			}
 			return
@@ -312,6 +334,7 @@ func (pc *PageCache) Put(host, urlPath string, r *http.Request, resp *http.Respo
 		pc.entries.Delete(key)
 		pc.totalSize.Add(-int64(entry.size))
 		pc.cache.totalSize.Add(-int64(entry.size))
+		pc.cache.disk.remove(key)
 		debugLog("[PageCache] Content changed (dynamic?): %s", key)
 	}
 
@@ -339,6 +362,7 @@ func (pc *PageCache) Put(host, urlPath string, r *http.Request, resp *http.Respo
 		statusCode: resp.StatusCode,
 		ttl:        ttl,
 		firstIP:    ip,
+		tags:       parseCacheTags(resp.Header),
 	}
 	entry.lastAccess.Store(now.UnixNano())
 	entry.hitCount.Store(1)
@@ -385,7 +409,10 @@ func ServePageFromCache(w http.ResponseWriter, r *http.Request, entry *pageEntry
 // Purge removes all page cache entries for a domain.
 func (pc *PageCache) Purge(host string) int {
 	prefix := "page:" + host
-	count := 0
+	count := pc.cache.disk.purgeBeside(&pc.entries, func(k string, _ *diskEntry) bool {
+		rest, ok := strings.CutPrefix(k, prefix)
+		return ok && strings.HasPrefix(rest, "/")
+	})
 	pc.entries.Range(func(key, value interface{}) bool {
 		k := key.(string)
 		if strings.HasPrefix(k, prefix) {
@@ -412,7 +439,9 @@ func (pc *PageCache) Purge(host string) int {
 
 // PurgeAll clears all page cache entries.
 func (pc *PageCache) PurgeAll() int {
-	count := 0
+	count := pc.cache.disk.purgeBeside(&pc.entries, func(k string, _ *diskEntry) bool {
+		return strings.HasPrefix(k, "page:")
+	})
 	pc.entries.Range(func(key, value interface{}) bool {
 		entry := value.(*pageEntry)
 		pc.entries.Delete(key)
@@ -429,3 +458,41 @@ func (pc *PageCache) PurgeAll() int {
 
 	return count
 }
+
+// restore re-admits a page the disk tier kept across a restart. It was
+// stable when written, so it is served again at once; a page cached since
+// the restart wins.
+func (pc *PageCache) restore(meta diskMeta, body []byte) {
+	if !pc.cache.enabled.Load() {
+		return
+	}
+	totalUsed := pc.cache.totalSize.Load() + pc.totalSize.Load()
+	if totalUsed+int64(len(body)) > pc.cache.maxSize.Load() {
+		return
+	}
+
+	entry := &pageEntry{
+		body:       body,
+		bodyHash:   hashBody(body),
+		createdAt:  meta.Created,
+		etag:       meta.Header.Get("ETag"),
+		headers:    meta.Header,
+		lastMod:    meta.Header.Get("Last-Modified"),
+		size:       len(body),
+		stable:     true,
+		statusCode: meta.Status,
+		ttl:        time.Duration(meta.Expires - meta.Created),
+		tags:       meta.Tags,
+	}
+	entry.lastAccess.Store(time.Now().UnixNano())
+	if _, loaded := pc.entries.LoadOrStore(meta.Key, entry); loaded {
+		return
+	}
+	pc.totalSize.Add(int64(entry.size))
+	pc.cache.totalSize.Add(int64(entry.size))
+
+	if vary := meta.Header.Get("Vary"); vary != "" {
+		urlKey := pageKeyPath(strings.TrimPrefix(meta.Key, "page:"))
+		pc.varyMap.LoadOrStore(urlKey, vary)
+	}
+}
@@ -101,7 +101,7 @@ func TestBuildVariant(t *testing.T) {
 			for k, v := range tt.reqHeaders {
 				req.Header.Set(k, v)
 			}
-			variant, ok := buildVariant(req, tt.vary)
+			variant, ok := buildVariant(req, tt.vary, nil)
 			if ok != tt.wantOK {
 				t.Errorf("buildVariant() ok = %v, want %v", ok, tt.wantOK)
 			}
@@ -130,15 +130,15 @@ func TestPageCache_PutAndGet(t *testing.T) {
 	body := []byte("<html><body>Landing</body></html>")
 
 	// First Put — pending (not stable yet)
-	pc.Put("example.com", "/landing", req, resp, body, 3600*time.Second)
-	if pc.Get("example.com", "/landing", req) != nil {
+	pc.Put("example.com", "/landing", req, nil, resp, body, 3600*time.Second)
+	if pc.Get("example.com", "/landing", req, nil) != nil {
 		t.Error("Should not serve after first Put (not stable)")
 	}
 
 	// Second Put from a distinct client, same body — confirmed stable
-	pc.Put("example.com", "/landing", withIP(req, secondClient), resp, body, 3600*time.Second)
+	pc.Put("example.com", "/landing", withIP(req, secondClient), nil, resp, body, 3600*time.Second)
 
-	entry := pc.Get("example.com", "/landing", req)
+	entry := pc.Get("example.com", "/landing", req, nil)
 	if entry == nil {
 		t.Fatal("Expected page cache hit after stability confirmed")
 	}
@@ -164,10 +164,10 @@ func TestPageCache_DynamicContentNotCached(t *testing.T) {
 	}
 
 	// Two different bodies (e.g. CSRF token changes) — should NOT become stable
-	pc.Put("example.com", "/csrf-page", req, resp, []byte("<html>token=abc123</html>"), 3600*time.Second)
-	pc.Put("example.com", "/csrf-page", req, resp, []byte("<html>token=def456</html>"), 3600*time.Second)
+	pc.Put("example.com", "/csrf-page", req, nil, resp, []byte("<html>token=abc123</html>"), 3600*time.Second)
+	pc.Put("example.com", "/csrf-page", req, nil, resp, []byte("<html>token=def456</html>"), 3600*time.Second)
 
-	if pc.Get("example.com", "/csrf-page", req) != nil {
+	if pc.Get("example.com", "/csrf-page", req, nil) != nil {
 		t.Error("Dynamic content (different bodies) should not be cached")
 	}
 }
@@ -198,17 +198,17 @@ func TestPageCache_VaryVariants(t *testing.T) {
 
 	// Store HTML variant (no X-Odac header) — two distinct clients for stability
 	htmlReq := httptest.NewRequest("GET", "http://example.com/about", nil)
-	pc.Put("example.com", "/about", htmlReq, htmlResp, htmlBody, 60*time.Second)
-	pc.Put("example.com", "/about", withIP(htmlReq, secondClient), htmlResp, htmlBody, 60*time.Second)
+	pc.Put("example.com", "/about", htmlReq, nil, htmlResp, htmlBody, 60*time.Second)
+	pc.Put("example.com", "/about", withIP(htmlReq, secondClient), nil, htmlResp, htmlBody, 60*time.Second)
 
 	// Store JSON variant (X-Odac: ajax) — two distinct clients for stability
 	ajaxReq := httptest.NewRequest("GET", "http://example.com/about", nil)
 	ajaxReq.Header.Set("X-Odac", "ajax")
-	pc.Put("example.com", "/about", ajaxReq, jsonResp, jsonBody, 60*time.Second)
-	pc.Put("example.com", "/about", withIP(ajaxReq, secondClient), jsonResp, jsonBody, 60*time.Second)
+	pc.Put("example.com", "/about", ajaxReq, nil, jsonResp, jsonBody, 60*time.Second)
+	pc.Put("example.com", "/about", withIP(ajaxReq, secondClient), nil, jsonResp, jsonBody, 60*time.Second)
 
 	// Get HTML variant
-	entry := pc.Get("example.com", "/about", htmlReq)
+	entry := pc.Get("example.com", "/about", htmlReq, nil)
 	if entry == nil {
 		t.Fatal("Expected HTML variant hit")
 	}
@@ -217,7 +217,7 @@ func TestPageCache_VaryVariants(t *testing.T) {
 	}
 
 	// Get JSON variant
-	entry = pc.Get("example.com", "/about", ajaxReq)
+	entry = pc.Get("example.com", "/about", ajaxReq, nil)
 	if entry == nil {
 		t.Fatal("Expected JSON variant hit")
 	}
@@ -245,11 +245,11 @@ func TestPageCache_CookiedRequestNotCached(t *testing.T) {
 		req := httptest.NewRequest("GET", "http://example.com/panel", nil)
 		req.RemoteAddr = ip + ":40000"
 		req.Header.Set("Cookie", "sid="+ip)
-		pc.Put("example.com", "/panel", req, resp, body, 3600*time.Second)
+		pc.Put("example.com", "/panel", req, nil, resp, body, 3600*time.Second)
 	}
 
 	anon := httptest.NewRequest("GET", "http://example.com/panel", nil)
-	if pc.Get("example.com", "/panel", anon) != nil {
+	if pc.Get("example.com", "/panel", anon, nil) != nil {
 		t.Error("Cookied responses must not be cached (cross-user leak)")
 	}
 }
@@ -270,16 +270,16 @@ func TestPageCache_SameClientDoesNotStabilize(t *testing.T) {
 
 	// Same client (same IP) reloading its own page twice must NOT stabilize —
 	// otherwise one user could pin their personalized page for everyone.
-	pc.Put("example.com", "/page", req, resp, body, 3600*time.Second)
-	pc.Put("example.com", "/page", req, resp, body, 3600*time.Second)
+	pc.Put("example.com", "/page", req, nil, resp, body, 3600*time.Second)
+	pc.Put("example.com", "/page", req, nil, resp, body, 3600*time.Second)
 
-	if pc.Get("example.com", "/page", req) != nil {
+	if pc.Get("example.com", "/page", req, nil) != nil {
 		t.Error("A single client must not be able to stabilize an entry")
 	}
 
 	// A second, distinct client with the same body promotes it.
-	pc.Put("example.com", "/page", withIP(req, secondClient), resp, body, 3600*time.Second)
-	if pc.Get("example.com", "/page", req) == nil {
+	pc.Put("example.com", "/page", withIP(req, secondClient), nil, resp, body, 3600*time.Second)
+	if pc.Get("example.com", "/page", req, nil) == nil {
 		t.Error("Two distinct clients with identical body should stabilize")
 	}
 }
@@ -299,14 +299,14 @@ func TestPageCache_ServesStableEntryToCookiedClient(t *testing.T) {
 	body := []byte("<html>Public Home</html>")
 
 	// Stabilize from two anonymous clients.
-	pc.Put("example.com", "/home", req, resp, body, 3600*time.Second)
-	pc.Put("example.com", "/home", withIP(req, secondClient), resp, body, 3600*time.Second)
+	pc.Put("example.com", "/home", req, nil, resp, body, 3600*time.Second)
+	pc.Put("example.com", "/home", withIP(req, secondClient), nil, resp, body, 3600*time.Second)
 
 	// A cookied request still receives the (proven-anonymous) cached body —
 	// this is what keeps caching useful for sites that set benign cookies.
 	cookied := httptest.NewRequest("GET", "http://example.com/home", nil)
 	cookied.Header.Set("Cookie", "_ga=123")
-	if pc.Get("example.com", "/home", cookied) == nil {
+	if pc.Get("example.com", "/home", cookied, nil) == nil {
 		t.Error("Stable anonymous entry should be served to cookied clients too")
 	}
 }
@@ -316,7 +316,7 @@ func TestPageCache_RejectsQueryString(t *testing.T) {
 	defer cm.Stop()
 
 	req := httptest.NewRequest("GET", "http://example.com/page?token=secret", nil)
-	entry := pc.Get("example.com", "/page", req)
+	entry := pc.Get("example.com", "/page", req, nil)
 	if entry != nil {
 		t.Error("Should not return cache for query string requests")
 	}
@@ -328,7 +328,7 @@ func TestPageCache_RejectsAuthorization(t *testing.T) {
 
 	req := httptest.NewRequest("GET", "http://example.com/page", nil)
 	req.Header.Set("Authorization", "Bearer token")
-	entry := pc.Get("example.com", "/page", req)
+	entry := pc.Get("example.com", "/page", req, nil)
 	if entry != nil {
 		t.Error("Should not return cache for authorized requests")
 	}
@@ -350,11 +350,11 @@ func TestPageCache_TTLExpiration(t *testing.T) {
 	body := []byte("<html>test</html>")
 
 	// Two distinct clients for stability, with a real TTL
-	pc.Put("example.com", "/page", req, resp, body, 1*time.Second)
-	pc.Put("example.com", "/page", withIP(req, secondClient), resp, body, 1*time.Second)
+	pc.Put("example.com", "/page", req, nil, resp, body, 1*time.Second)
+	pc.Put("example.com", "/page", withIP(req, secondClient), nil, resp, body, 1*time.Second)
 
 	// Should be stable and serveable now
-	entry := pc.Get("example.com", "/page", req)
+	entry := pc.Get("example.com", "/page", req, nil)
 	if entry == nil {
 		t.Fatal("Expected cache hit before expiration")
 	}
@@ -362,7 +362,7 @@ func TestPageCache_TTLExpiration(t *testing.T) {
 	// Wait for TTL to expire
 	time.Sleep(1100 * time.Millisecond)
 
-	entry = pc.Get("example.com", "/page", req)
+	entry = pc.Get("example.com", "/page", req, nil)
 	if entry != nil {
 		t.Error("Expired entry should not be returned")
 	}
@@ -381,20 +381,20 @@ func TestPageCache_Purge(t *testing.T) {
 		},
 	}
 
-	pc.Put("example.com", "/page", req, resp, []byte("<html>test</html>"), 3600*time.Second)
-	pc.Put("example.com", "/page", withIP(req, secondClient), resp, []byte("<html>test</html>"), 3600*time.Second)
-	pc.Put("other.com", "/page", req, resp, []byte("<html>other</html>"), 3600*time.Second)
-	pc.Put("other.com", "/page", withIP(req, secondClient), resp, []byte("<html>other</html>"), 3600*time.Second)
+	pc.Put("example.com", "/page", req, nil, resp, []byte("<html>test</html>"), 3600*time.Second)
+	pc.Put("example.com", "/page", withIP(req, secondClient), nil, resp, []byte("<html>test</html>"), 3600*time.Second)
+	pc.Put("other.com", "/page", req, nil, resp, []byte("<html>other</html>"), 3600*time.Second)
+	pc.Put("other.com", "/page", withIP(req, secondClient), nil, resp, []byte("<html>other</html>"), 3600*time.Second)
 
 	count := pc.Purge("example.com")
 	if count != 1 {
 		t.Errorf("Expected 1 purged, got %d", count)
 	}
 
-	if pc.Get("example.com", "/page", req) != nil {
+	if pc.Get("example.com", "/page", req, nil) != nil {
 		t.Error("example.com should be purged")
 	}
-	if pc.Get("other.com", "/page", req) == nil {
+	if pc.Get("other.com", "/page", req, nil) == nil {
 		t.Error("other.com should still exist")
 	}
 }
@@ -413,9 +413,9 @@ func TestPageCache_UnsafeVaryRejectsCache(t *testing.T) {
 		},
 	}
 
-	pc.Put("example.com", "/page", req, resp, []byte("<html>test</html>"), 3600*time.Second)
+	pc.Put("example.com", "/page", req, nil, resp, []byte("<html>test</html>"), 3600*time.Second)
 
-	if pc.Get("example.com", "/page", req) != nil {
+	if pc.Get("example.com", "/page", req, nil) != nil {
 		t.Error("Should not cache with Vary: Cookie")
 	}
 }
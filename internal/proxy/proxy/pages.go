@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"odac/internal/proxy/config"
+)
+
+// defaultMaintenanceRetry is the Retry-After sent when a site does not set one.
+const defaultMaintenanceRetry = 300
+
+// defaultMaintenancePage is served in maintenance mode when the site has
+// neither a "maintenance" nor a "503" page.
+var defaultMaintenancePage = []byte(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Down for maintenance</title>
+<style>body{font-family:system-ui,sans-serif;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0;color:#333;background:#fafafa}main{text-align:center;padding:2rem}h1{font-weight:600}</style>
+</head>
+<body><main><h1>Down for maintenance</h1><p>We'll be back shortly.</p></main></body>
+</html>
+`)
+
+// replaceableStatus lists the upstream statuses a custom page may replace.
+var replaceableStatus = map[int]bool{
+	http.StatusNotFound:           true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// sitePages is one website's compiled error pages and maintenance state.
+type sitePages struct {
+	pages       map[int][]byte
+	maintenance []byte // nil = not in maintenance
+	allow       []netip.Prefix
+	retryAfter  string
+}
+
+type sitePagesKey struct{}
+
+// newSitePages compiles a website's pages; nil when it has no custom pages
+// and is not in maintenance.
+func newSitePages(site config.Website) *sitePages {
+	s := &sitePages{pages: map[int][]byte{}}
+	for key, html := range site.ErrorPages {
+		if code, err := strconv.Atoi(key); err == nil && replaceableStatus[code] && html != "" {
+			s.pages[code] = []byte(html)
+		}
+	}
+	if m := site.Maintenance; m != nil && m.Enabled {
+		switch {
+		case site.ErrorPages["maintenance"] != "":
+			s.maintenance = []byte(site.ErrorPages["maintenance"])
+		case s.pages[http.StatusServiceUnavailable] != nil:
+			s.maintenance = s.pages[http.StatusServiceUnavailable]
+		default:
+			s.maintenance = defaultMaintenancePage
+		}
+		for _, a := range m.Allow {
+			if p, ok := parseAllowEntry(a); ok {
+				s.allow = append(s.allow, p)
+			} else {
+				log.Printf("[Pages] Ignoring invalid maintenance allow entry %q for %s", a, site.Domain)
+			}
+		}
+		retry := m.RetryAfter
+		if retry <= 0 {
+			retry = defaultMaintenanceRetry
+		}
+		s.retryAfter = strconv.Itoa(retry)
+	}
+	if len(s.pages) == 0 && s.maintenance == nil {
+		return nil
+	}
+	return s
+}
+
+// serveMaintenance answers r with the maintenance page unless the site is
+// live or the client is allowed through. It returns true when it answered.
+func (s *sitePages) serveMaintenance(w http.ResponseWriter, r *http.Request, ip string) bool {
+	if s.maintenance == nil {
+		return false
+	}
+	if prefixesContain(s.allow, ip) {
+		return false
+	}
+	w.Header().Set("Retry-After", s.retryAfter)
+	w.Header().Set("Cache-Control", "no-store")
+	writePage(w, r, http.StatusServiceUnavailable, s.maintenance)
+	return true
+}
+
+// withSitePages attaches the site's pages to the request for errorHandler
+// and ModifyResponse.
+func withSitePages(r *http.Request, s *sitePages) *http.Request {
+	if s == nil || len(s.pages) == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), sitePagesKey{}, s))
+}
+
+// customPage returns the site's page for code, or nil.
+func customPage(r *http.Request, code int) []byte {
+	s, _ := r.Context().Value(sitePagesKey{}).(*sitePages)
+	if s == nil {
+		return nil
+	}
+	return s.pages[code]
+}
+
+// writePage answers with page for clients that accept HTML and with the
+// plain status text for everyone else (API clients, health checks).
+func writePage(w http.ResponseWriter, r *http.Request, code int, page []byte) {
+	if page == nil || !acceptsHTML(r) {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		w.Write(page)
+	}
+}
+
+// replaceErrorPage swaps an upstream error body for the site's custom page.
+func replaceErrorPage(resp *http.Response) {
+	if resp.Request == nil || !replaceableStatus[resp.StatusCode] || !acceptsHTML(resp.Request) {
+		return
+	}
+	page := customPage(resp.Request, resp.StatusCode)
+	if page == nil {
+		return
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(page))
+	resp.ContentLength = int64(len(page))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(page)))
+	resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("ETag")
+	resp.Header.Del("Last-Modified")
+}
+
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
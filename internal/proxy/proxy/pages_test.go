@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"odac/internal/proxy/config"
+)
+
+func htmlRequest(method, target string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	return r
+}
+
+func TestSitePagesMaintenance(t *testing.T) {
+	if newSitePages(config.Website{Domain: "example.com"}) != nil {
+		t.Fatal("site without pages compiled")
+	}
+
+	s := newSitePages(config.Website{
+		Domain:     "example.com",
+		ErrorPages: map[string]string{"503": "<h1>busy</h1>"},
+		Maintenance: &config.Maintenance{
+			Enabled: true,
+			Allow:   []string{"203.0.113.7", "10.0.0.0/8", "bogus"},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	if !s.serveMaintenance(w, htmlRequest("GET", "/"), "198.51.100.1") {
+		t.Fatal("maintenance did not answer")
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "300" || w.Body.String() != "<h1>busy</h1>" {
+		t.Fatalf("maintenance response: %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+
+	for _, ip := range []string{"203.0.113.7", "10.1.2.3", "::ffff:10.9.9.9"} {
+		if s.serveMaintenance(httptest.NewRecorder(), htmlRequest("GET", "/"), ip) {
+			t.Errorf("allowed address %s got the maintenance page", ip)
+		}
+	}
+
+	// Non-HTML clients get the plain status.
+	w = httptest.NewRecorder()
+	s.serveMaintenance(w, httptest.NewRequest("GET", "/api", nil), "198.51.100.1")
+	if w.Code != http.StatusServiceUnavailable || strings.Contains(w.Body.String(), "<h1>") {
+		t.Fatalf("API client got HTML: %q", w.Body.String())
+	}
+
+	// Dedicated maintenance page beats 503; built-in page as the last resort.
+	s = newSitePages(config.Website{
+		ErrorPages:  map[string]string{"503": "busy", "maintenance": "back soon"},
+		Maintenance: &config.Maintenance{Enabled: true, RetryAfter: 60},
+	})
+	if string(s.maintenance) != "back soon" || s.retryAfter != "60" {
+		t.Errorf("maintenance page = %q, retry = %s", s.maintenance, s.retryAfter)
+	}
+	s = newSitePages(config.Website{Maintenance: &config.Maintenance{Enabled: true}})
+	if string(s.maintenance) != string(defaultMaintenancePage) {
+		t.Error("built-in maintenance page not used")
+	}
+}
+
+func TestReplaceErrorPage(t *testing.T) {
+	s := newSitePages(config.Website{ErrorPages: map[string]string{"404": "<p>lost</p>", "418": "teapot"}})
+	if _, ok := s.pages[418]; ok {
+		t.Error("non-replaceable status compiled")
+	}
+
+	respond := func(r *http.Request, code int) *http.Response {
+		resp := &http.Response{
+			StatusCode: code,
+			Header:     http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}},
+			Body:       io.NopCloser(strings.NewReader(`{"error":"not found"}`)),
+			Request:    withSitePages(r, s),
+		}
+		replaceErrorPage(resp)
+		return resp
+	}
+
+	resp := respond(htmlRequest("GET", "/missing"), http.StatusNotFound)
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "<p>lost</p>" || resp.Header.Get("Content-Encoding") != "" || resp.ContentLength != int64(len(body)) {
+		t.Fatalf("replaced response: %q %v", body, resp.Header)
+	}
+
+	resp = respond(httptest.NewRequest("GET", "/api/missing", nil), http.StatusNotFound)
+	if body, _ = io.ReadAll(resp.Body); string(body) != `{"error":"not found"}` {
+		t.Errorf("API response replaced: %q", body)
+	}
+	resp = respond(htmlRequest("GET", "/"), http.StatusInternalServerError)
+	if body, _ = io.ReadAll(resp.Body); string(body) != `{"error":"not found"}` {
+		t.Errorf("status without a page replaced: %q", body)
+	}
+}
+
+func TestErrorHandlerPages(t *testing.T) {
+	p := NewProxy()
+	s := newSitePages(config.Website{ErrorPages: map[string]string{"502": "down", "504": "slow"}})
+
+	w := httptest.NewRecorder()
+	p.errorHandler(w, withSitePages(htmlRequest("GET", "/"), s), errors.New("dial tcp: connection refused"))
+	if w.Code != http.StatusBadGateway || w.Body.String() != "down" {
+		t.Errorf("502: %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	p.errorHandler(w, withSitePages(htmlRequest("GET", "/"), s), context.DeadlineExceeded)
+	if w.Code != http.StatusGatewayTimeout || w.Body.String() != "slow" {
+		t.Errorf("504: %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	p.errorHandler(w, htmlRequest("GET", "/"), errors.New("dial tcp: connection refused"))
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "Bad Gateway") {
+		t.Errorf("site without pages: %d %q", w.Code, w.Body.String())
+	}
+}
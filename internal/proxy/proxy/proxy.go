@@ -3,16 +3,16 @@ package proxy
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
 	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/zstd"
 	"golang.org/x/crypto/ocsp"
@@ -101,9 +102,10 @@ func (bufferPool) Put(buf []byte) {
 }
 
 type Proxy struct {
-	acmeChallenges map[string]string // ACME HTTP-01 challenge tokens: token -> keyAuthorization
-	acmeMu         sync.RWMutex      // Separate mutex for ACME challenges to avoid contention
-	cache          *CacheManager     // Smart adaptive asset cache
+	acmeChallenges map[string]string           // ACME HTTP-01 challenge tokens: token -> keyAuthorization
+	alpnChallenges map[string]*tls.Certificate // ACME TLS-ALPN-01 challenge certificates by domain
+	acmeMu         sync.RWMutex                // Separate mutex for ACME challenges to avoid contention
+	cache          *CacheManager               // Smart adaptive asset cache
 	domains        map[string]config.Website
 	hints          *HintsStore // 103 Early Hints engine
 	pages          *PageCache  // App-controlled HTML page cache
@@ -113,7 +115,18 @@ type Proxy struct {
 	mu             sync.RWMutex
 	reverseProxy   *httputil.ReverseProxy
 	tunnel         *TunnelManager
-	httpClient     *http.Client // For OCSP requests
+	relay          *TunnelRelay
+	onDemand       *OnDemand
+	httpClient     *http.Client               // For OCSP requests
+	wafs           map[*config.WAF]*wafEngine // Compiled per-website WAF rules
+	rates          map[string]*ratePolicy     // Compiled per-website rate limits, by domain
+	limiter        *rateLimiter               // Token buckets behind rates
+	sitePages      map[string]*sitePages      // Compiled error/maintenance pages, by domain
+	access         map[string]*accessPolicy   // Compiled auth rules, by domain
+	clientCAs      map[string]*clientCA       // Compiled mTLS policies, by domain
+	backends       map[string]*backend        // Compiled non-HTTP/1.1 backends, by domain
+	cacheKeys      map[string]*cacheKeyPolicy // Compiled page cache key policies, by domain
+	transport      *backendTransport
 }
 
 // ocspCacheEntry stores OCSP response with expiration
@@ -126,6 +139,7 @@ func NewProxy() *Proxy {
 	cm := NewCacheManager()
 	p := &Proxy{
 		acmeChallenges: make(map[string]string),
+		alpnChallenges: make(map[string]*tls.Certificate),
 		cache:          cm,
 		domains:        make(map[string]config.Website),
 		hints:          NewHintsStore(),
@@ -133,16 +147,39 @@ func NewProxy() *Proxy {
 		sslCache:       make(map[string]*tls.Certificate),
 		ocspCache:      make(map[string]*ocspCacheEntry),
 		tunnel:         NewTunnelManager(),
+		relay:          NewTunnelRelay(),
+		onDemand:       NewOnDemand(),
+		wafs:           make(map[*config.WAF]*wafEngine),
+		rates:          make(map[string]*ratePolicy),
+		limiter:        newRateLimiter(rateLimiterCapacity),
+		sitePages:      make(map[string]*sitePages),
+		access:         make(map[string]*accessPolicy),
+		clientCAs:      make(map[string]*clientCA),
+		backends:       make(map[string]*backend),
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second, // OCSP requests should be fast
 		},
 	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
 	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		Proxy: func(r *http.Request) (*url.URL, error) {
+			if strings.HasSuffix(r.URL.Hostname(), relayHostSuffix) {
+				return nil, nil
+			}
+			return http.ProxyFromEnvironment(r)
+		},
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// Relayed sites are reached through their agent's tunnel.
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				if domain, ok := strings.CutSuffix(host, relayHostSuffix); ok {
+					return p.relay.Dial(domain)
+				}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
 		ForceAttemptHTTP2: true,
 		// MaxIdleConns: 10000 ensures we can reuse many connections in high-throughput scenarios
 		// (Performance > Memory for this Enterprise Proxy)
@@ -153,10 +190,11 @@ func NewProxy() *Proxy {
 		ExpectContinueTimeout: 1 * time.Second,
 		ResponseHeaderTimeout: 60 * time.Second, // Timeout if backend server doesn't send headers in time
 	}
+	p.transport = newBackendTransport(transport)
 
 	p.reverseProxy = &httputil.ReverseProxy{
 		Director:      p.director,
-		Transport:     transport,
+		Transport:     p.transport,
 		BufferPool:    bufferPool{}, // Zero-allocation: reuse buffers from pool
 		FlushInterval: -1,           // Flush every chunk immediately — critical for streaming/large files
 		ErrorHandler:  p.errorHandler,
@@ -198,8 +236,14 @@ func NewProxy() *Proxy {
 				p.hints.Learn(host, r.Request.URL.Path, r)
 			}
 
-			// Strip internal header — never expose to client
-			r.Header.Del(pageCacheHeader)
+			// Internal headers never reach the client. A cacheRecordWriter
+			// still needs them and strips them itself.
+			if !recording(r.Request) {
+				r.Header.Del(pageCacheHeader)
+				r.Header.Del(cacheTagsHeader)
+			}
+
+			replaceErrorPage(r)
 
 			return nil
 		},
@@ -225,18 +269,64 @@ func (p *Proxy) SetACMEChallenge(token, keyAuthorization string) {
 	log.Printf("ACME HTTP-01 challenge token set: %.8s...", token)
 }
 
-func (p *Proxy) UpdateConfig(domains map[string]config.Website, globalSSL *config.SSL, tunnels []config.Tunnel, memory *config.Memory) {
+func (p *Proxy) UpdateConfig(domains map[string]config.Website, globalSSL *config.SSL, tunnels []config.Tunnel, relay []config.RelayAgent, memory *config.Memory) {
+	wafs := make(map[*config.WAF]*wafEngine)
+	rates := make(map[string]*ratePolicy)
+	pages := make(map[string]*sitePages)
+	access := make(map[string]*accessPolicy)
+	clientCAs := make(map[string]*clientCA)
+	backends := make(map[string]*backend)
+	cacheKeys := make(map[string]*cacheKeyPolicy)
+	for _, site := range domains {
+		if engine := newWAFEngine(site.WAF); engine != nil {
+			wafs[site.WAF] = engine
+		}
+		if policy := newRatePolicy(site.Domain, site.RateLimits); policy != nil {
+			rates[site.Domain] = policy
+		}
+		if sp := newSitePages(site); sp != nil {
+			pages[site.Domain] = sp
+		}
+		if policy := newAccessPolicy(site.Domain, site.Auth); policy != nil {
+			access[site.Domain] = policy
+		}
+		if ca := newClientCA(site.Domain, site.MTLS); ca != nil {
+			clientCAs[site.Domain] = ca
+		}
+		if b := p.transport.newBackend(site); b != nil {
+			backends[site.Domain] = b
+		}
+		if kp := newCacheKeyPolicy(site.CacheKey); kp != nil {
+			cacheKeys[site.Domain] = kp
+		}
+	}
+
 	p.mu.Lock()
 	p.domains = domains
+	p.wafs = wafs
+	p.rates = rates
+	p.sitePages = pages
+	p.access = access
+	p.clientCAs = clientCAs
+	p.backends = backends
+	p.cacheKeys = cacheKeys
 	p.globalSSL = globalSSL
 	p.sslCache = make(map[string]*tls.Certificate)
 	p.ocspCache = make(map[string]*ocspCacheEntry) // Clear OCSP cache on config update
 	p.mu.Unlock()
 
+	p.onDemand.Release(func(host string) bool {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+		site, ok := p.resolveDomain(host)
+		return ok && site.Cert.SSL.Key != "" && site.Cert.SSL.Cert != ""
+	})
+
 	// Update tunnel connections outside main lock (TunnelManager has its own mutex)
 	if tunnels != nil {
 		p.tunnel.UpdateConfig(tunnels)
 	}
+	p.relay.UpdateConfig(relay)
 
 	// Update cache memory limits from Node.js-provided host memory info
 	if memory != nil && memory.Total > 0 {
@@ -254,14 +344,12 @@ func (p *Proxy) director(req *http.Request) {
 	req.Header.Del("X-Remote-Addr")
 	req.Header.Del("X-Client-IP")
 	req.Header.Del("X-Originating-IP")
-
-	if req.Header.Get("X-Request-ID") == "" {
-		uuid := make([]byte, 16)
-		if _, err := rand.Read(uuid); err == nil {
-			req.Header.Set("X-Request-ID", hex.EncodeToString(uuid))
-		}
+	for _, h := range clientCertHeaders {
+		req.Header.Del(h)
 	}
 
+	ensureRequestID(req)
+
 	host := req.Host
 	if strings.Contains(host, ":") {
 		host, _, _ = net.SplitHostPort(host)
@@ -286,7 +374,14 @@ func (p *Proxy) director(req *http.Request) {
 		targetHost = website.Container
 	}
 
+	if website.TunnelID != "" {
+		targetHost, targetPort = website.TunnelID+relayHostSuffix, "80"
+	}
+
 	req.URL.Scheme = "http"
+	if b := backendOf(req); b != nil {
+		req.URL.Scheme = b.scheme
+	}
 	req.URL.Host = net.JoinHostPort(targetHost, targetPort)
 
 	if _, ok := req.Header["User-Agent"]; !ok {
@@ -309,6 +404,9 @@ func (p *Proxy) director(req *http.Request) {
 	} else {
 		req.Header.Set("X-Forwarded-Proto", "http")
 	}
+	if website.MTLS != nil {
+		setClientCertHeaders(req)
+	}
 
 	if strings.ToLower(req.Header.Get("Connection")) == "upgrade" &&
 		strings.ToLower(req.Header.Get("Upgrade")) == "websocket" {
@@ -341,8 +439,20 @@ func (p *Proxy) errorHandler(w http.ResponseWriter, r *http.Request, err error)
 	}
 
 	log.Printf("Proxy error for %s: %v", r.Host, err)
-	w.WriteHeader(http.StatusBadGateway)
-	w.Write([]byte("Bad Gateway"))
+	code := http.StatusBadGateway
+	var ne net.Error
+	var tooLarge *http.MaxBytesError
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout() {
+		code = http.StatusGatewayTimeout
+	} else if errors.As(err, &tooLarge) {
+		code = http.StatusRequestEntityTooLarge
+	}
+	writePage(w, r, code, customPage(r, code))
+}
+
+// OnDemand returns the on-demand TLS gate.
+func (p *Proxy) OnDemand() *OnDemand {
+	return p.onDemand
 }
 
 // Tunnel returns the tunnel manager for lifecycle management.
@@ -351,6 +461,9 @@ func (p *Proxy) Tunnel() *TunnelManager {
 }
 
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The request ID keys WAF logs, so a client does not get to pick it.
+	r.Header.Del("X-Request-ID")
+
 	host := r.Host
 	if strings.Contains(host, ":") {
 		host, _, _ = net.SplitHostPort(host)
@@ -397,11 +510,29 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		host = host[4:]
 	}
 
+	// Tunnel agents dial in here on the domain this proxy relays for them.
+	// The token travels in the query, so plain HTTP is only taken from
+	// loopback.
+	if r.URL.Path == tunnelAgentPath && websocket.IsWebSocketUpgrade(r) && p.relay.Serves(host) {
+		if ip := net.ParseIP(clientIP(r)); r.TLS == nil && (ip == nil || !ip.IsLoopback()) {
+			http.Error(w, "TLS required", http.StatusForbidden)
+			return
+		}
+		p.relay.ServeAgent(w, r, host)
+		return
+	}
+
 	p.mu.RLock()
 	website, exists := p.resolveDomain(host)
 	// Check SSL availability (Site-specific or Global)
 	hasSSL := (website.Cert.SSL.Key != "" && website.Cert.SSL.Cert != "") ||
 		(p.globalSSL != nil && p.globalSSL.Key != "" && p.globalSSL.Cert != "")
+	waf := p.wafs[website.WAF]
+	rates := p.rates[website.Domain]
+	pages := p.sitePages[website.Domain]
+	access := p.access[website.Domain]
+	backend := p.backends[website.Domain]
+	cacheKeys := p.cacheKeys[website.Domain]
 	p.mu.RUnlock()
 
 	// Security: Strict Host Validation
@@ -445,6 +576,12 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Plain HTTP carries no client certificate, so it cannot pass mTLS.
+	if r.TLS == nil && website.MTLS != nil && website.MTLS.Mode != "optional" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	// Security Headers
 	// Note: Other security headers (X-Frame-Options, etc.) are handled in ModifyResponse
 	// to allow upstream overrides. HSTS is forced here because we handle SSL termination.
@@ -454,6 +591,40 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
 	}
 
+	ip := strings.TrimPrefix(clientIP(r), "::ffff:")
+
+	// ── Maintenance: a 503 page for everyone but the allowed addresses ──
+	if pages != nil {
+		if pages.serveMaintenance(w, r, ip) {
+			return
+		}
+		r = withSitePages(r, pages)
+	}
+
+	// ── WAF: inspect before anything is served or proxied ──
+	if waf != nil && !waf.allow(w, r, host) {
+		return
+	}
+
+	// ── Rate limits: per-path token buckets ──
+	if rates != nil && !rates.allow(p.limiter, w, r, ip) {
+		return
+	}
+
+	// ── Access control: IP allow-lists, basic auth, forward-auth ──
+	// Protected responses may be per-user, so they bypass the page cache.
+	private := access != nil && access.protects(r.URL.Path)
+	if access != nil && !access.allow(w, r, ip) {
+		return
+	}
+
+	// ── gRPC: streamed straight through, trailers intact ──
+	r = withBackend(r, backend)
+	if isGRPC(r) {
+		p.serveStream(w, r)
+		return
+	}
+
 	// Compression negotiation
 	acceptEncoding := r.Header.Get("Accept-Encoding")
 	var encoding string
@@ -508,29 +679,63 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				ServeFromCache(w, r, entry)
 			}
 			if entry.ShouldRevalidate() {
-				go p.revalidateCache(host, r, entry)
+				go p.revalidateCache(host, r, entry.etag, entry.lastMod, entry.FinishRevalidation)
 			}
 			return
 		}
 
+		// ── Disk tier: large assets and entries kept across restarts ──
+		if entry := p.cache.disk.get(cacheKey(host, r.URL.Path)); entry != nil {
+			// Ranges refer to the raw body, so they are never compressed.
+			served := false
+			if encoding != "" && r.Header.Get("Range") == "" {
+				cw := newCompressionResponseWriter(w, encoding)
+				served = p.cache.disk.ServeFromDisk(cw, r, entry)
+				cw.Close()
+			} else {
+				served = p.cache.disk.ServeFromDisk(w, r, entry)
+			}
+			if served {
+				p.cache.promote(r.URL.Path, entry)
+				if entry.ShouldRevalidate() {
+					go p.revalidateCache(host, r, entry.Header.Get("ETag"), entry.Header.Get("Last-Modified"), entry.FinishRevalidation)
+				}
+				return
+			}
+		}
+
 		// Cache miss: proxy to backend but capture the response for caching.
 		// cacheRecordWriter MUST wrap the compressionResponseWriter (not vice versa)
 		// so it captures the raw uncompressed body from the backend.
 		// Chain: backend → reverseProxy → cacheRecordWriter → compressionWriter → client
 		crw := newCacheRecordWriter(w, encoding)
+		crw.disk = p.cache.disk
 		defer crw.Close()
-		p.reverseProxy.ServeHTTP(crw, r)
+		p.reverseProxy.ServeHTTP(crw, withRecording(r))
 
 		// Store in cache if response was cacheable (runs inline, body already buffered)
-		if crw.statusCode == http.StatusOK && crw.body.Len() > 0 && crw.body.Len() <= cacheMaxFileSize {
-			p.cache.Put(host, r.URL.Path, crw.toFakeResponse(), crw.body.Bytes())
+		if crw.statusCode == http.StatusOK {
+			if crw.spill != nil {
+				p.cache.putSpill(host, r.URL.Path, crw.toFakeResponse(), crw.spill)
+				crw.spill = nil
+			} else if !crw.truncated && crw.body.Len() > 0 {
+				p.cache.Put(host, r.URL.Path, crw.toFakeResponse(), crw.body.Bytes())
+			}
 		}
 		return
 	}
 
 	// ── Page Cache: App-controlled HTML caching via X-Odac-Cache header ──
-	if !isWebSocket && r.Method == http.MethodGet && r.URL.RawQuery == "" {
-		if entry := p.pages.Get(host, r.URL.Path, r); entry != nil {
+	_, pageQuery := cacheKeys.keyQuery(r.URL.RawQuery)
+	if cacheKeys != nil && cacheKeys.debug && r.Method == http.MethodGet && !isWebSocket {
+		key, ok := p.pages.requestKey(host, r.URL.Path, r, cacheKeys)
+		if !ok || private || r.Header.Get("Authorization") != "" {
+			key = "bypass"
+		}
+		w.Header().Set(cacheKeyHeader, strings.TrimPrefix(key, "page:"))
+	}
+	if !isWebSocket && !private && r.Method == http.MethodGet && pageQuery {
+		if entry := p.pages.Get(host, r.URL.Path, r, cacheKeys); entry != nil {
 			if encoding != "" {
 				cw := newCompressionResponseWriter(w, encoding)
 				ServePageFromCache(cw, r, entry)
@@ -548,12 +753,12 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Authorization") == "" {
 			crw := newCacheRecordWriter(w, encoding)
 			defer crw.Close()
-			p.reverseProxy.ServeHTTP(crw, r)
+			p.reverseProxy.ServeHTTP(crw, withRecording(r))
 
 			// Check if backend opted in to page caching
 			fakeResp := crw.toFakeResponse()
-			if crw.pageTTL > 0 && IsPageCacheAllowed(fakeResp) && crw.body.Len() > 0 {
-				p.pages.Put(host, r.URL.Path, r, fakeResp, crw.body.Bytes(), crw.pageTTL)
+			if crw.pageTTL > 0 && IsPageCacheAllowed(fakeResp) && !crw.truncated && crw.body.Len() > 0 {
+				p.pages.Put(host, r.URL.Path, r, cacheKeys, fakeResp, crw.body.Bytes(), crw.pageTTL)
 			}
 			return
 		}
@@ -744,6 +949,11 @@ func (p *Proxy) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, er
 	// Only serve certificates for explicitly configured domains
 	if !exists {
 		p.mu.RUnlock()
+		// An app with on-demand TLS may claim the name; the handshake then
+		// waits for the certificate instead of failing.
+		if p.onDemand.Await(host) {
+			return p.GetCertificate(hello)
+		}
 		debugLog("[DEBUG] Unknown SNI '%s' - rejecting connection (anti-scan protection)", host)
 		return nil, nil // Returns TLS alert: unrecognized_name
 	}
@@ -772,6 +982,13 @@ func (p *Proxy) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, er
 		certKey = website.Cert.SSL.Key
 		certFile = website.Cert.SSL.Cert
 		source = "site"
+	} else if website.OnDemand {
+		// Still being issued: the self-signed global cert would only earn
+		// the visitor a browser warning.
+		if p.onDemand.Await(host) {
+			return p.GetCertificate(hello)
+		}
+		return nil, nil
 	} else if p.globalSSL != nil && p.globalSSL.Key != "" && p.globalSSL.Cert != "" {
 		// Global SSL fallback - only for known websites without specific certs
 		debugLog("[DEBUG] Using Global SSL for known website %s", host)
@@ -938,6 +1155,12 @@ type cacheRecordWriter struct {
 	statusCode   int
 	wroteHead    bool
 	shouldBuffer bool // Only buffer body when response is potentially cacheable
+	truncated    bool // Body outgrew the buffer; it must not be cached
+
+	// disk, when set and on, takes asset bodies too large for memory: the
+	// buffer moves to spill and the rest of the body follows it there.
+	disk  *DiskCache
+	spill *diskSpill
 }
 
 func newCacheRecordWriter(w http.ResponseWriter, encoding string) *cacheRecordWriter {
@@ -977,8 +1200,10 @@ func (crw *cacheRecordWriter) WriteHeader(code int) {
 		}
 	}
 
-	// Strip internal headers from client response and snapshot
+	// Strip internal headers from the client response; the snapshot keeps
+	// the tags for Put.
 	crw.w.Header().Del(pageCacheHeader)
+	crw.w.Header().Del(cacheTagsHeader)
 	crw.headers.Del(pageCacheHeader)
 
 	if crw.compressor != nil {
@@ -994,8 +1219,8 @@ func (crw *cacheRecordWriter) Write(b []byte) (int, error) {
 	}
 
 	// Only buffer when response is cacheable (avoids overhead for non-cached responses)
-	if crw.shouldBuffer && crw.body.Len()+len(b) <= pageMaxBodySize {
-		crw.body.Write(b)
+	if crw.shouldBuffer {
+		crw.buffer(b)
 	}
 
 	// Send to client (compressed if compressor is active, raw otherwise)
@@ -1005,6 +1230,30 @@ func (crw *cacheRecordWriter) Write(b []byte) (int, error) {
 	return crw.w.Write(b)
 }
 
+// buffer keeps b for the cache: in memory up to the limit for pages or
+// assets, then on disk when the tier is on, else not at all.
+func (crw *cacheRecordWriter) buffer(b []byte) {
+	switch {
+	case crw.truncated:
+	case crw.spill != nil:
+		crw.spill.Write(b)
+	case crw.pageTTL == 0 && crw.body.Len()+len(b) <= cacheMaxFileSize,
+		crw.pageTTL > 0 && crw.body.Len()+len(b) <= pageMaxBodySize:
+		crw.body.Write(b)
+	case crw.pageTTL == 0 && crw.disk != nil:
+		if crw.spill = crw.disk.spill(); crw.spill != nil {
+			crw.spill.Write(crw.body.Bytes())
+			crw.spill.Write(b)
+			crw.body = bytes.Buffer{}
+			return
+		}
+		fallthrough
+	default:
+		crw.truncated = true
+		crw.body = bytes.Buffer{}
+	}
+}
+
 func (crw *cacheRecordWriter) Flush() {
 	if crw.compressor != nil {
 		crw.compressor.Flush()
@@ -1015,11 +1264,15 @@ func (crw *cacheRecordWriter) Flush() {
 	}
 }
 
-// Close flushes and returns the compressor to its pool.
+// Close flushes and returns the compressor to its pool, and drops a spill
+// nobody committed (an aborted or uncacheable response).
 func (crw *cacheRecordWriter) Close() {
 	if crw.compressor != nil {
 		crw.compressor.Close()
 	}
+	if crw.spill != nil {
+		crw.spill.abort()
+	}
 }
 
 // toFakeResponse creates a minimal http.Response for cache admission checks.
@@ -1035,17 +1288,21 @@ func (crw *cacheRecordWriter) toFakeResponse() *http.Response {
 // ============================================================================
 
 // revalidateCache sends a conditional request to the backend to check if
-// the cached asset has changed. If it has, the cache entry is updated.
-// This runs in a background goroutine — the client already got the cached response.
-func (p *Proxy) revalidateCache(host string, originalReq *http.Request, entry *cacheEntry) {
-	defer entry.FinishRevalidation()
+// the cached asset, memory or disk, has changed. If it has, the cache entry
+// is updated. This runs in a background goroutine — the client already got
+// the cached response.
+func (p *Proxy) revalidateCache(host string, originalReq *http.Request, etag, lastMod string, finish func()) {
+	defer finish()
 
 	// Build a conditional request to the backend
 	p.mu.RLock()
 	website, exists := p.resolveDomain(host)
+	backend := p.backends[website.Domain]
 	p.mu.RUnlock()
 
-	if !exists {
+	// Relayed sites have no direct address and other protocols no plain
+	// HTTP one; their entries simply expire.
+	if !exists || website.TunnelID != "" || backend != nil {
 		return
 	}
 
@@ -1070,11 +1327,11 @@ func (p *Proxy) revalidateCache(host string, originalReq *http.Request, entry *c
 	}
 
 	// Set conditional headers
-	if entry.etag != "" {
-		req.Header.Set("If-None-Match", entry.etag)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
 	}
-	if entry.lastMod != "" {
-		req.Header.Set("If-Modified-Since", entry.lastMod)
+	if lastMod != "" {
+		req.Header.Set("If-Modified-Since", lastMod)
 	}
 
 	// Preserve original Host header so backend routes correctly
@@ -1094,9 +1351,14 @@ func (p *Proxy) revalidateCache(host string, originalReq *http.Request, entry *c
 	}
 
 	if resp.StatusCode == http.StatusOK {
-		// Asset changed — read new body and update cache
+		// Asset changed — read new body and update cache. A large one is
+		// only dropped from disk; the next request caches it again.
 		body, err := io.ReadAll(io.LimitReader(resp.Body, cacheMaxFileSize+1))
-		if err != nil || len(body) > cacheMaxFileSize {
+		if err != nil {
+			return
+		}
+		if len(body) > cacheMaxFileSize {
+			p.cache.disk.remove(cacheKey(host, originalReq.URL.Path))
 			return
 		}
 
@@ -1131,6 +1393,14 @@ func (p *Proxy) Pages() *PageCache {
 	return p.pages
 }
 
+// ConfigureDiskCache applies the disk tier setting and, when the tier is
+// newly on, warm-loads what a previous proxy left in its directory.
+func (p *Proxy) ConfigureDiskCache(c *config.DiskCache) {
+	if gen, load := p.cache.disk.Configure(c); load {
+		go p.cache.disk.load(gen, p.pages.restore)
+	}
+}
+
 // revalidatePageCache sends a conditional request to check if a cached page changed.
 // If the backend no longer sends X-Odac-Cache, the entry is removed.
 func (p *Proxy) revalidatePageCache(host string, originalReq *http.Request, entry *pageEntry) {
@@ -1138,9 +1408,11 @@ func (p *Proxy) revalidatePageCache(host string, originalReq *http.Request, entr
 
 	p.mu.RLock()
 	website, exists := p.resolveDomain(host)
+	backend := p.backends[website.Domain]
+	cacheKeys := p.cacheKeys[website.Domain]
 	p.mu.RUnlock()
 
-	if !exists {
+	if !exists || website.TunnelID != "" || backend != nil {
 		return
 	}
 
@@ -1160,6 +1432,7 @@ func (p *Proxy) revalidatePageCache(host string, originalReq *http.Request, entr
 	if err != nil {
 		return
 	}
+	cacheKeys.copyTo(req, originalReq)
 
 	if entry.etag != "" {
 		req.Header.Set("If-None-Match", entry.etag)
@@ -1211,11 +1484,12 @@ func (p *Proxy) revalidatePageCache(host string, originalReq *http.Request, entr
 			return
 		}
 
-		// Feed Put the cookieless revalidation request (req), not originalReq:
-		// the backend fetch above carried no cookies, so `body` is the
-		// anonymous variant and is safe to cache. originalReq may be cookied,
-		// which Put would (correctly) reject.
-		p.pages.Put(host, originalReq.URL.Path, req, resp, body, newTTL)
+		// Feed Put the revalidation request (req), not originalReq: the
+		// backend fetch above carried no cookies beyond those the key is built
+		// from, so `body` is the shared variant and is safe to cache.
+		// originalReq may carry a session cookie, which Put would (correctly)
+		// reject.
+		p.pages.Put(host, originalReq.URL.Path, req, cacheKeys, resp, body, newTTL)
 		debugLog("[PageCache] Revalidated (200, updated): %s%s", host, originalReq.URL.Path)
 	}
 }
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// cacheTagsHeader is the response header apps use to tag cached responses
+// (surrogate keys), so they can later be purged together.
+const cacheTagsHeader = "X-Odac-Cache-Tags"
+
+const (
+	// maxCacheTags bounds the tags kept per entry.
+	maxCacheTags = 32
+	// maxCacheTagLength bounds a single tag; longer ones are ignored.
+	maxCacheTagLength = 128
+)
+
+// parseCacheTags reads the tags of a response: separated by commas or
+// spaces, duplicates dropped.
+func parseCacheTags(h http.Header) []string {
+	var tags []string
+	for _, v := range h.Values(cacheTagsHeader) {
+		for _, tag := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			if len(tag) > maxCacheTagLength || slices.Contains(tags, tag) {
+				continue
+			}
+			tags = append(tags, tag)
+			if len(tags) == maxCacheTags {
+				return tags
+			}
+		}
+	}
+	return tags
+}
+
+// PurgeFilter selects the cached responses of one host to drop: those
+// tagged with any of Tags, the one at URL, or everything below Prefix. The
+// zero filter selects the whole host.
+type PurgeFilter struct {
+	Tags   []string
+	URL    string
+	Prefix string
+}
+
+func (f PurgeFilter) match(urlPath string, tags []string) bool {
+	if len(f.Tags) == 0 && f.URL == "" && f.Prefix == "" {
+		return true
+	}
+	if f.URL != "" && urlPath == f.URL {
+		return true
+	}
+	if f.Prefix != "" && strings.HasPrefix(urlPath, f.Prefix) {
+		return true
+	}
+	for _, tag := range tags {
+		if slices.Contains(f.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// PurgeMatching removes host's cached assets selected by f.
+func (cm *CacheManager) PurgeMatching(host string, f PurgeFilter) int {
+	count := cm.disk.purgeBeside(&cm.entries, func(k string, e *diskEntry) bool {
+		urlPath, ok := strings.CutPrefix(k, host)
+		return ok && strings.HasPrefix(urlPath, "/") && f.match(urlPath, e.Tags)
+	})
+	cm.entries.Range(func(key, value interface{}) bool {
+		urlPath, ok := strings.CutPrefix(key.(string), host)
+		if !ok || !strings.HasPrefix(urlPath, "/") {
+			return true
+		}
+		entry := value.(*cacheEntry)
+		if f.match(urlPath, entry.tags) && cm.entries.CompareAndDelete(key, value) {
+			cm.totalSize.Add(-int64(entry.size))
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// PurgeMatching removes host's cached pages, every variant, selected by f.
+func (pc *PageCache) PurgeMatching(host string, f PurgeFilter) int {
+	prefix := "page:" + host
+	count := pc.cache.disk.purgeBeside(&pc.entries, func(k string, e *diskEntry) bool {
+		rest, ok := strings.CutPrefix(k, prefix)
+		urlPath := pageKeyPath(rest)
+		return ok && strings.HasPrefix(rest, "/") && f.match(urlPath, e.Tags)
+	})
+	pc.entries.Range(func(key, value interface{}) bool {
+		rest, ok := strings.CutPrefix(key.(string), prefix)
+		if !ok || !strings.HasPrefix(rest, "/") {
+			return true
+		}
+		urlPath := pageKeyPath(rest)
+		entry := value.(*pageEntry)
+		if f.match(urlPath, entry.tags) && pc.entries.CompareAndDelete(key, value) {
+			pc.totalSize.Add(-int64(entry.size))
+			pc.cache.totalSize.Add(-int64(entry.size))
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// pageKeyPath strips the keyed query and the variant from a page key, or
+// from its part after the host.
+func pageKeyPath(rest string) string {
+	rest, _, _ = strings.Cut(rest, "|")
+	rest, _, _ = strings.Cut(rest, "?")
+	return rest
+}
+
+type recordingKey struct{}
+
+// withRecording marks a request whose response goes through a
+// cacheRecordWriter, which needs the internal cache headers and strips them
+// itself.
+func withRecording(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), recordingKey{}, true))
+}
+
+func recording(r *http.Request) bool {
+	return r != nil && r.Context().Value(recordingKey{}) == true
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"odac/internal/proxy/config"
+)
+
+func TestParseCacheTags(t *testing.T) {
+	h := http.Header{}
+	h.Add(cacheTagsHeader, "article-42, author-7 article-42")
+	h.Add(cacheTagsHeader, "home,"+strings.Repeat("x", maxCacheTagLength+1))
+	if got, want := parseCacheTags(h), []string{"article-42", "author-7", "home"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCacheTags = %v, want %v", got, want)
+	}
+	if got := parseCacheTags(http.Header{}); got != nil {
+		t.Errorf("no header: %v", got)
+	}
+}
+
+func TestPurgeMatching(t *testing.T) {
+	pc, cm := newTestPageCache()
+	defer cm.Stop()
+
+	putAsset := func(host, urlPath, tags string) {
+		for i := 0; i < 10; i++ {
+			cm.recordFrequency(cacheKey(host, urlPath))
+		}
+		cm.Put(host, urlPath, &http.Response{StatusCode: 200, Header: http.Header{
+			"Content-Type":  []string{"text/css"},
+			cacheTagsHeader: []string{tags},
+		}}, []byte("body{}"))
+	}
+	putPage := func(host, urlPath, tags string) {
+		req := httptest.NewRequest("GET", "http://"+host+urlPath, nil)
+		resp := &http.Response{StatusCode: 200, Header: http.Header{
+			"Content-Type":  []string{"text/html"},
+			cacheTagsHeader: []string{tags},
+		}}
+		pc.Put(host, urlPath, req, nil, resp, []byte("<p>"+urlPath+"</p>"), time.Hour)
+		pc.Put(host, urlPath, withIP(req, secondClient), nil, resp, []byte("<p>"+urlPath+"</p>"), time.Hour)
+	}
+	reset := func() {
+		cm.PurgeAll()
+		pc.PurgeAll()
+		putAsset("example.com", "/articles/42.css", "article-42")
+		putAsset("example.com", "/site.css", "")
+		putAsset("example.com.au", "/articles/42.css", "article-42")
+		putPage("example.com", "/articles/42", "article-42 author-7")
+		putPage("example.com", "/articles/43", "article-43 author-7")
+		putPage("example.com", "/about", "")
+		putPage("example.com.au", "/articles/42", "article-42")
+	}
+	pageCached := func(host, urlPath string) bool {
+		return pc.Get(host, urlPath, httptest.NewRequest("GET", "http://"+host+urlPath, nil), nil) != nil
+	}
+	assetCached := func(host, urlPath string) bool {
+		_, ok := cm.entries.Load(cacheKey(host, urlPath))
+		return ok
+	}
+
+	reset()
+	if n := cm.PurgeMatching("example.com", PurgeFilter{Tags: []string{"article-42"}}) +
+		pc.PurgeMatching("example.com", PurgeFilter{Tags: []string{"article-42"}}); n != 2 {
+		t.Errorf("tag purge removed %d entries, want 2", n)
+	}
+	if assetCached("example.com", "/articles/42.css") || pageCached("example.com", "/articles/42") {
+		t.Error("tagged entries survived")
+	}
+	if !pageCached("example.com", "/articles/43") || !assetCached("example.com", "/site.css") || !assetCached("example.com.au", "/articles/42.css") || !pageCached("example.com.au", "/articles/42") {
+		t.Error("untagged entries or other hosts purged")
+	}
+
+	reset()
+	if n := pc.PurgeMatching("example.com", PurgeFilter{URL: "/articles/4"}); n != 0 {
+		t.Errorf("exact URL matched %d prefixes", n)
+	}
+	if n := pc.PurgeMatching("example.com", PurgeFilter{URL: "/about"}); n != 1 || pageCached("example.com", "/about") {
+		t.Errorf("URL purge removed %d", n)
+	}
+
+	reset()
+	if n := pc.PurgeMatching("example.com", PurgeFilter{Prefix: "/articles/"}); n != 2 || !pageCached("example.com", "/about") {
+		t.Errorf("prefix purge removed %d", n)
+	}
+
+	reset()
+	if n := cm.PurgeMatching("example.com", PurgeFilter{}) + pc.PurgeMatching("example.com", PurgeFilter{}); n != 5 {
+		t.Errorf("host purge removed %d, want 5", n)
+	}
+	if !pageCached("example.com.au", "/articles/42") {
+		t.Error("host purge reached a longer host name")
+	}
+}
+
+// TestCacheTagsThroughProxy checks that page-cache opt-in and tags survive
+// ModifyResponse and never reach the client.
+func TestCacheTagsThroughProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set(pageCacheHeader, "60")
+		w.Header().Set(cacheTagsHeader, "article-42")
+		io.WriteString(w, "<h1>Article 42</h1>")
+	}))
+	defer backend.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	n, _ := strconv.Atoi(port)
+
+	p := NewProxy()
+	p.UpdateConfig(map[string]config.Website{
+		"example.com": {Domain: "example.com", Port: n, ContainerIP: "127.0.0.1"},
+	}, nil, nil, nil, nil)
+
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/articles/42", nil)
+		req.RemoteAddr = ip + ":40000"
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+	for _, ip := range []string{"198.51.100.1", secondClient} {
+		w := get(ip)
+		if w.Header().Get(cacheTagsHeader) != "" || w.Header().Get(pageCacheHeader) != "" {
+			t.Fatalf("internal headers leaked: %v", w.Header())
+		}
+	}
+	if w := get("198.51.100.2"); w.Header().Get("X-Odac-Cache") != "HIT" {
+		t.Fatalf("page not cached: %v", w.Header())
+	}
+
+	if n := p.Pages().PurgeMatching("example.com", PurgeFilter{Tags: []string{"article-42"}}); n != 1 {
+		t.Errorf("purged %d", n)
+	}
+	if w := get("198.51.100.2"); w.Header().Get("X-Odac-Cache") == "HIT" {
+		t.Error("served from cache after purge")
+	}
+}
@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"container/list"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"odac/internal/proxy/config"
+)
+
+// rateLimiterCapacity bounds the buckets a limiter tracks. The least
+// recently used bucket is evicted past it; losing an idle bucket only
+// refills it early.
+const rateLimiterCapacity = 50000
+
+// rateLimiter holds token buckets in a bounded LRU. A bucket refills at
+// rate tokens per second up to burst; each request takes one token.
+type rateLimiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*list.Element
+	lru      *list.List // front = most recently used
+	capacity int
+	now      func() time.Time
+}
+
+type rateBucket struct {
+	key     string
+	tokens  float64
+	last    time.Time
+	full    time.Time // when the bucket is back at burst if left alone
+	limited bool      // last request was refused (logs once per episode)
+}
+
+// rateDecision is the outcome of one take, enough for the RateLimit-* and
+// Retry-After response headers.
+type rateDecision struct {
+	allowed   bool
+	first     bool // first refusal after an allowed request
+	limit     int
+	remaining int
+	reset     time.Duration // until the bucket is full again
+	retry     time.Duration // until the next token (refusals only)
+}
+
+func newRateLimiter(capacity int) *rateLimiter {
+	return &rateLimiter{
+		buckets:  make(map[string]*list.Element),
+		lru:      list.New(),
+		capacity: capacity,
+		now:      time.Now,
+	}
+}
+
+// take consumes one token from key's bucket.
+func (l *rateLimiter) take(key string, rate float64, burst int) rateDecision {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var b *rateBucket
+	if el, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(el)
+		b = el.Value.(*rateBucket)
+		b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	} else {
+		b = &rateBucket{key: key, tokens: float64(burst)}
+		l.buckets[key] = l.lru.PushFront(b)
+		l.evict(now)
+	}
+	b.last = now
+
+	d := rateDecision{limit: burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.allowed = true
+		b.limited = false
+	} else {
+		d.first = !b.limited
+		b.limited = true
+		d.retry = rateSeconds((1 - b.tokens) / rate)
+	}
+	d.remaining = int(b.tokens)
+	d.reset = rateSeconds((float64(burst) - b.tokens) / rate)
+	b.full = now.Add(d.reset)
+	return d
+}
+
+// evict drops buckets past capacity, plus already-refilled ones at the
+// cold end of the list, which are indistinguishable from absent ones.
+func (l *rateLimiter) evict(now time.Time) {
+	for l.lru.Len() > 0 {
+		el := l.lru.Back()
+		b := el.Value.(*rateBucket)
+		if l.lru.Len() <= l.capacity && (b.full.IsZero() || now.Before(b.full)) {
+			return
+		}
+		l.lru.Remove(el)
+		delete(l.buckets, b.key)
+	}
+}
+
+// rateSeconds converts fractional seconds to a duration.
+func rateSeconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// setRateHeaders writes the RateLimit-* fields and, on refusals,
+// Retry-After. Values are whole seconds, rounded up.
+func setRateHeaders(h http.Header, d rateDecision, window time.Duration) {
+	h.Set("RateLimit-Limit", strconv.Itoa(d.limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.reset)))
+	h.Set("RateLimit-Policy", strconv.Itoa(d.limit)+";w="+strconv.Itoa(ceilSeconds(window)))
+	if !d.allowed {
+		h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(d.retry))))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ratePolicy is one website's compiled rate limit rules, most specific
+// path first.
+type ratePolicy struct {
+	domain string
+	rules  []rateRule
+}
+
+type rateRule struct {
+	id      string // bucket namespace: path plus methods
+	path    string
+	exact   bool
+	methods map[string]bool // nil = every method
+	rate    float64         // tokens per second
+	burst   int
+	window  time.Duration
+	keyKind string // "ip", "header" or "cookie"
+	keyName string
+}
+
+// newRatePolicy compiles a website's rateLimits; nil when it has none.
+func newRatePolicy(domain string, rules []config.RateLimitRule) *ratePolicy {
+	p := &ratePolicy{domain: domain}
+	for _, r := range rules {
+		if r.Max <= 0 || r.WindowMs <= 0 {
+			log.Printf("[RateLimit] Ignoring rule for %s%s: max and windowMs are required", domain, r.Path)
+			continue
+		}
+		rule := rateRule{
+			path:    r.Path,
+			window:  time.Duration(r.WindowMs) * time.Millisecond,
+			burst:   r.Burst,
+			keyKind: "ip",
+		}
+		if strings.HasPrefix(rule.path, "=") {
+			rule.path, rule.exact = rule.path[1:], true
+		}
+		if rule.burst <= 0 {
+			rule.burst = r.Max
+		}
+		rule.rate = float64(r.Max) / rule.window.Seconds()
+		if kind, name, ok := strings.Cut(r.Key, ":"); ok && name != "" && (kind == "header" || kind == "cookie") {
+			rule.keyKind, rule.keyName = kind, name
+		} else if r.Key != "" && r.Key != "ip" {
+			log.Printf("[RateLimit] Unknown key %q for %s%s, using ip", r.Key, domain, r.Path)
+		}
+		rule.id = r.Path
+		if len(r.Methods) > 0 {
+			rule.methods = map[string]bool{}
+			names := make([]string, 0, len(r.Methods))
+			for _, m := range r.Methods {
+				m = strings.ToUpper(strings.TrimSpace(m))
+				rule.methods[m] = true
+				names = append(names, m)
+			}
+			sort.Strings(names)
+			rule.id += " " + strings.Join(names, ",")
+		}
+		p.rules = append(p.rules, rule)
+	}
+	if len(p.rules) == 0 {
+		return nil
+	}
+	// Exact paths before prefixes, longer prefixes before shorter ones.
+	sort.SliceStable(p.rules, func(i, j int) bool {
+		a, b := p.rules[i], p.rules[j]
+		if a.exact != b.exact {
+			return a.exact
+		}
+		return len(a.path) > len(b.path)
+	})
+	return p
+}
+
+// match returns the rule governing r, or nil.
+func (p *ratePolicy) match(r *http.Request) *rateRule {
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if rule.methods != nil && !rule.methods[r.Method] {
+			continue
+		}
+		if rule.exact && r.URL.Path == rule.path || !rule.exact && strings.HasPrefix(r.URL.Path, rule.path) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// key identifies the client a rule counts: the named header or cookie
+// when present, else the client IP.
+func (rule *rateRule) key(r *http.Request, ip string) string {
+	switch rule.keyKind {
+	case "header":
+		if v := r.Header.Get(rule.keyName); v != "" {
+			return "h:" + v
+		}
+	case "cookie":
+		if c, err := r.Cookie(rule.keyName); err == nil && c.Value != "" {
+			return "c:" + c.Value
+		}
+	}
+	return "ip:" + ip
+}
+
+// allow applies the website's rate limits. It returns false when the
+// request was answered with 429.
+func (p *ratePolicy) allow(l *rateLimiter, w http.ResponseWriter, r *http.Request, ip string) bool {
+	rule := p.match(r)
+	if rule == nil {
+		return true
+	}
+	client := rule.key(r, ip)
+	d := l.take(p.domain+"\x00"+rule.id+"\x00"+client, rule.rate, rule.burst)
+	setRateHeaders(w.Header(), d, rule.window)
+	if d.allowed {
+		return true
+	}
+	if d.first {
+		// Header and cookie values may be credentials; log only the kind.
+		by := ip
+		if !strings.HasPrefix(client, "ip:") {
+			by = rule.keyKind + " " + rule.keyName + " from " + ip
+		}
+		log.Printf("[RateLimit] Limit exceeded on %s%s by %s", p.domain, logSafe(rule.path), by)
+	}
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	return false
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odac/internal/proxy/config"
+)
+
+func testLimiter(capacity int) (*rateLimiter, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	l := newRateLimiter(capacity)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	l, now := testLimiter(100)
+
+	// 1 token/s, burst 3: three immediate requests pass, the fourth waits.
+	for i := 0; i < 3; i++ {
+		if d := l.take("k", 1, 3); !d.allowed || d.remaining != 2-i {
+			t.Fatalf("request %d: %+v", i+1, d)
+		}
+	}
+	d := l.take("k", 1, 3)
+	if d.allowed || !d.first || d.retry != time.Second {
+		t.Fatalf("over burst: %+v", d)
+	}
+	if d = l.take("k", 1, 3); d.allowed || d.first {
+		t.Fatalf("second refusal should not be first: %+v", d)
+	}
+
+	*now = now.Add(1500 * time.Millisecond)
+	if d = l.take("k", 1, 3); !d.allowed {
+		t.Fatalf("refilled token refused: %+v", d)
+	}
+	if d = l.take("k", 1, 3); d.allowed || d.retry != 500*time.Millisecond {
+		t.Fatalf("partial token: %+v", d)
+	}
+
+	// Refill caps at burst however long the bucket idles.
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		l.take("k", 1, 3)
+	}
+	if d = l.take("k", 1, 3); d.allowed {
+		t.Fatal("bucket refilled beyond burst")
+	}
+}
+
+func TestRateLimiterBoundedLRU(t *testing.T) {
+	l, now := testLimiter(3)
+	for i := 0; i < 3; i++ {
+		l.take(fmt.Sprint("k", i), 1, 1)
+	}
+	l.take("k0", 1, 1) // k0 becomes most recent; k1 is now the oldest
+	l.take("k3", 1, 1)
+	if len(l.buckets) != 3 {
+		t.Fatalf("buckets = %d, want 3", len(l.buckets))
+	}
+	if _, ok := l.buckets["k1"]; ok {
+		t.Error("least recently used bucket was not evicted")
+	}
+	if _, ok := l.buckets["k0"]; !ok {
+		t.Error("recently used bucket was evicted")
+	}
+
+	// Refilled buckets at the cold end are dropped on the next insert.
+	*now = now.Add(time.Minute)
+	l.take("k4", 1, 1)
+	if len(l.buckets) != 1 {
+		t.Errorf("idle refilled buckets kept: %d", len(l.buckets))
+	}
+}
+
+func TestRatePolicyRoutes(t *testing.T) {
+	p := newRatePolicy("example.com", []config.RateLimitRule{
+		{Path: "", Max: 100, WindowMs: 1000},
+		{Path: "/login", Methods: []string{"post"}, Max: 5, WindowMs: 60000},
+		{Path: "/api", Max: 10, WindowMs: 1000, Key: "header:X-API-Key"},
+		{Path: "=/api/health", Max: 1000, WindowMs: 1000},
+		{Path: "/broken"},
+	})
+	cases := []struct {
+		method, path string
+		window       time.Duration
+	}{
+		{"GET", "/", time.Second},
+		{"POST", "/login", time.Minute},
+		{"GET", "/login", time.Second}, // method filter falls through
+		{"GET", "/api/users", time.Second},
+		{"GET", "/api/health", time.Second},
+	}
+	for _, c := range cases {
+		rule := p.match(httptest.NewRequest(c.method, c.path, nil))
+		if rule == nil || rule.window != c.window {
+			t.Errorf("%s %s matched %+v", c.method, c.path, rule)
+		}
+	}
+	if rule := p.match(httptest.NewRequest("GET", "/api/health", nil)); rule.burst != 1000 {
+		t.Errorf("exact rule not preferred: %+v", rule)
+	}
+	if len(p.rules) != 4 {
+		t.Errorf("invalid rule compiled: %d rules", len(p.rules))
+	}
+	if newRatePolicy("example.com", nil) != nil {
+		t.Error("policy without rules compiled")
+	}
+}
+
+func TestRatePolicyAllow(t *testing.T) {
+	l, _ := testLimiter(100)
+	p := newRatePolicy("example.com", []config.RateLimitRule{
+		{Path: "/login", Max: 2, WindowMs: 60000},
+		{Path: "/api", Max: 1, WindowMs: 10000, Key: "header:X-API-Key"},
+	})
+
+	login := func(ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.allow(l, w, httptest.NewRequest("POST", "/login", nil), ip)
+		return w
+	}
+	login("1.1.1.1")
+	w := login("1.1.1.1")
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Fatalf("second login: %d %v", w.Code, w.Header())
+	}
+	w = login("1.1.1.1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Reset") != "60" {
+		t.Fatalf("third login: %d %v", w.Code, w.Header())
+	}
+	if w = login("2.2.2.2"); w.Code != http.StatusOK {
+		t.Error("limit leaked across client IPs")
+	}
+
+	api := func(key, ip string) int {
+		r := httptest.NewRequest("GET", "/api/x", nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		p.allow(l, w, r, ip)
+		return w.Code
+	}
+	api("alpha", "1.1.1.1")
+	if api("alpha", "3.3.3.3") != http.StatusTooManyRequests {
+		t.Error("header key not shared across IPs")
+	}
+	if api("beta", "1.1.1.1") != http.StatusOK {
+		t.Error("distinct header keys share a bucket")
+	}
+	api("", "4.4.4.4")
+	if api("", "4.4.4.4") != http.StatusTooManyRequests {
+		t.Error("missing header did not fall back to the client IP")
+	}
+
+	w = httptest.NewRecorder()
+	if !p.allow(l, w, httptest.NewRequest("GET", "/", nil), "1.1.1.1") || w.Header().Get("RateLimit-Limit") != "" {
+		t.Error("unmatched path was limited")
+	}
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/yamux"
+
+	"odac/internal/proxy/config"
+)
+
+// relayHostSuffix marks a backend address that is a tunnel agent rather than
+// a TCP host: the director targets "<domain>.relay.odac.internal" and the
+// transport dials it through the agent's yamux session.
+const relayHostSuffix = ".relay.odac.internal"
+
+var errAgentOffline = errors.New("tunnel agent not connected")
+
+// TunnelRelay is the server side of tunnels, so one public odac-proxy can
+// front machines behind NAT the way ODAC Cloud does. Agents dial in over
+// WebSocket (see TunnelManager), authenticate with their domain's token and
+// keep a yamux session open; each proxied connection is a stream opened
+// down that session.
+type TunnelRelay struct {
+	mu       sync.RWMutex
+	tokens   map[string][32]byte // domain -> sha256(token)
+	sessions map[string]*yamux.Session
+	upgrader websocket.Upgrader
+}
+
+// NewTunnelRelay creates a relay with no agents.
+func NewTunnelRelay() *TunnelRelay {
+	return &TunnelRelay{
+		tokens:   make(map[string][32]byte),
+		sessions: make(map[string]*yamux.Session),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  128 * 1024,
+			WriteBufferSize: 128 * 1024,
+			// Agents are not browsers; the token is the credential.
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+	}
+}
+
+// UpdateConfig replaces the allowed agents. Sessions of agents that were
+// removed or whose token changed are closed.
+func (tr *TunnelRelay) UpdateConfig(agents []config.RelayAgent) {
+	tokens := make(map[string][32]byte, len(agents))
+	for _, a := range agents {
+		raw, err := hex.DecodeString(a.TokenHash)
+		if err != nil || len(raw) != sha256.Size {
+			log.Printf("[Relay] Ignoring agent %s: invalid token hash", a.Domain)
+			continue
+		}
+		tokens[strings.ToLower(a.Domain)] = [32]byte(raw)
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for domain, session := range tr.sessions {
+		if old, ok := tr.tokens[domain]; !ok || old != tokens[domain] {
+			log.Printf("[Relay] Agent for %s no longer allowed, disconnecting", domain)
+			session.Close()
+			delete(tr.sessions, domain)
+		}
+	}
+	tr.tokens = tokens
+}
+
+// Serves reports whether host is the domain of an agent allowed to connect.
+func (tr *TunnelRelay) Serves(host string) bool {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	_, ok := tr.tokens[strings.ToLower(host)]
+	return ok
+}
+
+// ServeAgent authenticates an agent that dialed in on host and holds its
+// session until it drops. An agent only connects on its own domain.
+func (tr *TunnelRelay) ServeAgent(w http.ResponseWriter, r *http.Request, host string) {
+	domain := strings.ToLower(r.Header.Get("X-Agent-Domain"))
+	digest := sha256.Sum256([]byte(r.URL.Query().Get("odac_ws_token")))
+
+	tr.mu.RLock()
+	want, ok := tr.tokens[domain]
+	tr.mu.RUnlock()
+	if !ok || domain != strings.ToLower(host) || subtle.ConstantTimeCompare(want[:], digest[:]) != 1 {
+		log.Printf("[Relay] Rejected agent for %s from %s", logSafe(domain), clientIP(r))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ws, err := tr.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[Relay] Upgrade failed for %s: %v", domain, err)
+		return
+	}
+	session, err := yamux.Server(newWSConn(ws), tunnelYamuxConfig())
+	if err != nil {
+		ws.Close()
+		return
+	}
+
+	tr.mu.Lock()
+	if old := tr.sessions[domain]; old != nil {
+		old.Close() // an agent that reconnects replaces its stale session
+	}
+	tr.sessions[domain] = session
+	tr.mu.Unlock()
+	log.Printf("[Relay] Agent connected for %s from %s", domain, clientIP(r))
+
+	<-session.CloseChan()
+
+	tr.mu.Lock()
+	if tr.sessions[domain] == session {
+		delete(tr.sessions, domain)
+	}
+	tr.mu.Unlock()
+	log.Printf("[Relay] Agent disconnected for %s", domain)
+}
+
+// Dial opens a stream to the agent serving domain.
+func (tr *TunnelRelay) Dial(domain string) (net.Conn, error) {
+	tr.mu.RLock()
+	session := tr.sessions[domain]
+	tr.mu.RUnlock()
+	if session == nil {
+		return nil, errAgentOffline
+	}
+	return session.Open()
+}
+
+// Stop disconnects every agent.
+func (tr *TunnelRelay) Stop() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for domain, session := range tr.sessions {
+		session.Close()
+		delete(tr.sessions, domain)
+	}
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"odac/internal/proxy/config"
+)
+
+// TestTunnelRelayEndToEnd runs a relay proxy and an agent on localhost: the
+// agent dials the relay on its domain, and requests for that domain reach the
+// app behind it.
+func TestTunnelRelayEndToEnd(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello from "+r.Host+r.URL.Path+" via "+r.Header.Get("X-Forwarded-For"))
+	}))
+	defer app.Close()
+
+	token := "agent-secret"
+	sum := sha256.Sum256([]byte(token))
+	relay := NewProxy()
+	relay.UpdateConfig(map[string]config.Website{
+		"localhost": {Domain: "localhost", TunnelID: "localhost"},
+	}, nil, nil, []config.RelayAgent{{Domain: "localhost", TokenHash: hex.EncodeToString(sum[:])}}, nil)
+	front := httptest.NewServer(relay)
+	defer front.Close()
+	defer relay.relay.Stop()
+
+	get := func() (*http.Response, string) {
+		req, _ := http.NewRequest("GET", front.URL+"/status", nil)
+		req.Host = "localhost"
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	if resp, _ := get(); resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("no agent yet: %d", resp.StatusCode)
+	}
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(app.URL, "http://"))
+	_, frontPort, _ := net.SplitHostPort(strings.TrimPrefix(front.URL, "http://"))
+	portNum, _ := strconv.Atoi(port)
+	agent := NewTunnelManager()
+	defer agent.Stop()
+	agent.UpdateConfig([]config.Tunnel{{
+		Domain: "localhost", Host: host, Port: portNum, Token: token,
+		Relay: "ws://localhost:" + frontPort + tunnelAgentPath,
+	}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, body := get()
+		if resp.StatusCode == http.StatusOK {
+			if !strings.HasPrefix(body, "hello from localhost/status via 127.0.0.1") {
+				t.Fatalf("body = %q", body)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("agent never came online: %d %q", resp.StatusCode, body)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Removing the agent from the relay config drops its session.
+	relay.UpdateConfig(map[string]config.Website{
+		"localhost": {Domain: "localhost", TunnelID: "localhost"},
+	}, nil, nil, nil, nil)
+	if resp, _ := get(); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("removed agent still served: %d", resp.StatusCode)
+	}
+}
+
+func TestTunnelRelayRejectsBadToken(t *testing.T) {
+	sum := sha256.Sum256([]byte("right"))
+	tr := NewTunnelRelay()
+	tr.UpdateConfig([]config.RelayAgent{
+		{Domain: "office.test", TokenHash: hex.EncodeToString(sum[:])},
+		{Domain: "broken.test", TokenHash: "nothex"},
+	})
+	if _, ok := tr.tokens["broken.test"]; ok {
+		t.Error("invalid token hash accepted")
+	}
+
+	for _, c := range []struct{ host, domain, token string }{
+		{"office.test", "office.test", "wrong"},
+		{"office.test", "other.test", "right"},
+		{"other.test", "office.test", "right"},
+		{"", "", ""},
+	} {
+		r := httptest.NewRequest("GET", tunnelAgentPath+"?odac_ws_token="+c.token, nil)
+		r.Header.Set("X-Agent-Domain", c.domain)
+		w := httptest.NewRecorder()
+		tr.ServeAgent(w, r, c.host)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s on %s/%s: %d", c.domain, c.host, c.token, w.Code)
+		}
+	}
+	if _, err := tr.Dial("office.test"); err != errAgentOffline {
+		t.Errorf("Dial without agent: %v", err)
+	}
+}
+
+// TestTunnelRelayAgentEndpointScope checks that /_odac/ws is the agent
+// endpoint only on a relay domain, and only over TLS or from loopback.
+func TestTunnelRelayAgentEndpointScope(t *testing.T) {
+	sum := sha256.Sum256([]byte("right"))
+	p := NewProxy()
+	defer p.relay.Stop()
+	p.UpdateConfig(map[string]config.Website{
+		"office.test": {Domain: "office.test", TunnelID: "office.test"},
+		"shop.test":   {Domain: "shop.test", Port: 1, ContainerIP: "127.0.0.1"},
+	}, nil, nil, []config.RelayAgent{{Domain: "office.test", TokenHash: hex.EncodeToString(sum[:])}}, nil)
+
+	serve := func(host, remote string) int {
+		r := httptest.NewRequest("GET", "http://"+host+tunnelAgentPath+"?odac_ws_token=wrong", nil)
+		r.RemoteAddr = remote + ":40000"
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("X-Agent-Domain", "office.test")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := serve("office.test", "203.0.113.7"); code != http.StatusForbidden {
+		t.Errorf("plain HTTP from outside: %d, want 403", code)
+	}
+	if code := serve("office.test", "127.0.0.1"); code != http.StatusUnauthorized {
+		t.Errorf("loopback on the relay domain: %d, want the relay's 401", code)
+	}
+	if code := serve("shop.test", "127.0.0.1"); code == http.StatusUnauthorized || code == http.StatusForbidden {
+		t.Errorf("agent endpoint answered on another site: %d", code)
+	}
+}
@@ -0,0 +1,485 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odac/internal/firewall"
+	"odac/internal/netutil"
+	"odac/internal/proxy/config"
+)
+
+const (
+	streamDialTimeout  = 10 * time.Second
+	streamHelloTimeout = 10 * time.Second // ClientHello (passthrough) or TLS handshake (terminate)
+	udpSessionIdle     = 2 * time.Minute
+	maxUDPSessions     = 4096 // per listener
+	maxDatagram        = 64 << 10
+)
+
+var errHelloRead = errors.New("client hello read")
+
+// Streams runs the layer-4 listeners: plain TCP/UDP forwarding, TLS
+// termination, and TLS passthrough routed by SNI. Listeners are keyed by
+// protocol and port; UpdateConfig opens, re-routes and closes them without
+// touching established connections on ports that stay.
+type Streams struct {
+	guard *firewall.Guard
+
+	mu        sync.Mutex
+	listeners map[string]*streamListener // "tcp/5432"
+	stats     map[string]*streamStats    // by stream name, kept across updates
+}
+
+type streamListener struct {
+	key    string
+	routes atomic.Pointer[streamRoutes]
+	closer io.Closer
+}
+
+// streamRoutes is what one port serves: a single plain or terminating
+// stream, or passthrough streams by SNI.
+type streamRoutes struct {
+	single *streamRoute
+	sni    map[string]*streamRoute
+}
+
+type streamRoute struct {
+	cfg   config.Stream
+	addr  string
+	tls   *tls.Config // terminate only
+	stats *streamStats
+}
+
+type streamStats struct {
+	active, total, refused, bytesIn, bytesOut atomic.Int64
+}
+
+// StreamStats is one stream's counters as the control API reports them.
+type StreamStats struct {
+	Name     string `json:"name"`
+	Active   int64  `json:"active"`   // Open connections (UDP: client sessions)
+	Total    int64  `json:"total"`    // Connections accepted since start
+	Refused  int64  `json:"refused"`  // Turned away by the firewall
+	BytesIn  int64  `json:"bytesIn"`  // Client to backend
+	BytesOut int64  `json:"bytesOut"` // Backend to client
+}
+
+// NewStreams creates the stream runner. guard is the proxy firewall's IP
+// policy; every connection (UDP: every new client session) passes it.
+func NewStreams(guard *firewall.Guard) *Streams {
+	return &Streams{
+		guard:     guard,
+		listeners: make(map[string]*streamListener),
+		stats:     make(map[string]*streamStats),
+	}
+}
+
+// UpdateConfig replaces the stream set.
+func (s *Streams) UpdateConfig(streams []config.Stream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]*streamStats, len(streams))
+	wanted := make(map[string]*streamRoutes)
+	for _, st := range streams {
+		key := st.Protocol + "/" + strconv.Itoa(st.Listen)
+		routes := wanted[key]
+		if routes == nil {
+			routes = &streamRoutes{}
+			wanted[key] = routes
+		}
+		stat := s.stats[st.Name]
+		if stat == nil {
+			stat = &streamStats{}
+		}
+		stats[st.Name] = stat
+		route := &streamRoute{cfg: st, addr: net.JoinHostPort(st.Host, strconv.Itoa(st.Port)), stats: stat}
+		switch {
+		case st.TLS == "passthrough" && routes.single == nil:
+			if routes.sni == nil {
+				routes.sni = make(map[string]*streamRoute)
+			}
+			routes.sni[strings.ToLower(st.Domain)] = route
+		case st.TLS != "passthrough" && routes.single == nil && routes.sni == nil:
+			if st.TLS == "terminate" {
+				route.tls = streamTLSConfig(st.Cert.SSL)
+			}
+			routes.single = route
+		default:
+			log.Printf("[Stream] %s: %s is already taken, skipping", st.Name, key)
+		}
+	}
+	s.stats = stats
+
+	for key, ls := range s.listeners {
+		if _, ok := wanted[key]; !ok {
+			ls.closer.Close()
+			delete(s.listeners, key)
+			log.Printf("[Stream] Closed %s", key)
+		}
+	}
+	for key, routes := range wanted {
+		ls := s.listeners[key]
+		if ls == nil {
+			var err error
+			if ls, err = s.open(key); err != nil {
+				log.Printf("[Stream] Cannot listen on %s: %v", key, err)
+				continue
+			}
+			s.listeners[key] = ls
+			log.Printf("[Stream] Listening on %s", key)
+		}
+		ls.routes.Store(routes)
+	}
+}
+
+func (s *Streams) open(key string) (*streamListener, error) {
+	protocol, port, _ := strings.Cut(key, "/")
+	lc := net.ListenConfig{Control: netutil.SetSocketOptions}
+	ls := &streamListener{key: key}
+	if protocol == "udp" {
+		pc, err := lc.ListenPacket(context.Background(), "udp", ":"+port)
+		if err != nil {
+			return nil, err
+		}
+		ls.closer = pc
+		go s.serveUDP(ls, pc)
+		return ls, nil
+	}
+	l, err := lc.Listen(context.Background(), "tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	ls.closer = l
+	go s.serveTCP(ls, l)
+	return ls, nil
+}
+
+// Close shuts every listener; established connections run on.
+func (s *Streams) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, ls := range s.listeners {
+		ls.closer.Close()
+		delete(s.listeners, key)
+	}
+}
+
+// Stats returns the counters of every configured stream, by name.
+func (s *Streams) Stats() []StreamStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]StreamStats, 0, len(s.stats))
+	for name, st := range s.stats {
+		out = append(out, StreamStats{
+			Name:     name,
+			Active:   st.active.Load(),
+			Total:    st.total.Load(),
+			Refused:  st.refused.Load(),
+			BytesIn:  st.bytesIn.Load(),
+			BytesOut: st.bytesOut.Load(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// streamTLSConfig loads the certificate on first use. A new config is built
+// on every update, so a renewed certificate is picked up on the next sync.
+func streamTLSConfig(paths config.SSL) *tls.Config {
+	var once sync.Once
+	var cert *tls.Certificate
+	var err error
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			once.Do(func() {
+				if paths.Cert == "" || paths.Key == "" {
+					err = errors.New("no certificate for this domain yet")
+					return
+				}
+				var kp tls.Certificate
+				if kp, err = tls.LoadX509KeyPair(paths.Cert, paths.Key); err == nil {
+					cert = &kp
+				}
+			})
+			return cert, err
+		},
+	}
+}
+
+func (s *Streams) serveTCP(ls *streamListener, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			time.Sleep(50 * time.Millisecond) // EMFILE and friends: back off instead of spinning
+			continue
+		}
+		go s.handleTCP(ls, conn)
+	}
+}
+
+func (s *Streams) handleTCP(ls *streamListener, conn net.Conn) {
+	defer conn.Close()
+	routes := ls.routes.Load()
+	if routes == nil {
+		return
+	}
+	ip := remoteIP(conn.RemoteAddr())
+
+	route := routes.single
+	var client net.Conn = conn
+	if route == nil {
+		conn.SetReadDeadline(time.Now().Add(streamHelloTimeout))
+		sni, hello, err := peekSNI(conn)
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			debugLog("[Stream] %s: no SNI from %s: %v", ls.key, ip, err)
+			return
+		}
+		if route = routes.sni[strings.ToLower(sni)]; route == nil {
+			debugLog("[Stream] %s: unknown SNI %s from %s", ls.key, sni, ip)
+			return
+		}
+		client = &prefixConn{Conn: conn, prefix: hello}
+	}
+
+	if ok, reason := s.guard.Check(ip, route.cfg.Domain); !ok {
+		route.stats.refused.Add(1)
+		debugLog("[Stream] %s: blocked %s: %s", route.cfg.Name, ip, reason)
+		return
+	}
+
+	if route.tls != nil {
+		tc := tls.Server(conn, route.tls)
+		tc.SetDeadline(time.Now().Add(streamHelloTimeout))
+		if err := tc.Handshake(); err != nil {
+			debugLog("[Stream] %s: TLS handshake with %s failed: %v", route.cfg.Name, ip, err)
+			return
+		}
+		tc.SetDeadline(time.Time{})
+		client = tc
+	}
+
+	upstream, err := net.DialTimeout("tcp", route.addr, streamDialTimeout)
+	if err != nil {
+		log.Printf("[Stream] %s: backend %s unreachable: %v", route.cfg.Name, route.addr, err)
+		return
+	}
+	defer upstream.Close()
+
+	route.stats.total.Add(1)
+	route.stats.active.Add(1)
+	defer route.stats.active.Add(-1)
+	pipeStream(client, upstream, route.stats)
+}
+
+// pipeStream copies both ways until each side has finished sending,
+// passing half-closes on so request/response protocols end cleanly.
+func pipeStream(client, upstream net.Conn, st *streamStats) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyHalf := func(dst, src net.Conn, counter *atomic.Int64) {
+		defer wg.Done()
+		buf := proxyBufferPool.Get().([]byte)
+		io.CopyBuffer(countingWriter{dst, counter}, src, buf)
+		proxyBufferPool.Put(buf)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	go copyHalf(upstream, client, &st.bytesIn)
+	go copyHalf(client, upstream, &st.bytesOut)
+	wg.Wait()
+}
+
+// countingWriter keeps the byte counters live for long connections.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// peekSNI reads the TLS ClientHello and returns its server name together
+// with the bytes consumed, which must be replayed to the backend.
+func peekSNI(conn net.Conn) (string, []byte, error) {
+	var buf bytes.Buffer
+	var sni string
+	err := tls.Server(helloConn{r: io.TeeReader(conn, &buf)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			sni = hello.ServerName
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if sni == "" {
+		if errors.Is(err, errHelloRead) {
+			err = errors.New("client sent no server name")
+		}
+		return "", nil, err
+	}
+	return sni, buf.Bytes(), nil
+}
+
+// helloConn feeds a handshake that must only read: its alert on abort is
+// discarded.
+type helloConn struct {
+	r io.Reader
+}
+
+func (c helloConn) Read(p []byte) (int, error)     { return c.r.Read(p) }
+func (helloConn) Write(p []byte) (int, error)      { return len(p), nil }
+func (helloConn) Close() error                     { return nil }
+func (helloConn) LocalAddr() net.Addr              { return nil }
+func (helloConn) RemoteAddr() net.Addr             { return nil }
+func (helloConn) SetDeadline(time.Time) error      { return nil }
+func (helloConn) SetReadDeadline(time.Time) error  { return nil }
+func (helloConn) SetWriteDeadline(time.Time) error { return nil }
+
+// prefixConn replays the peeked ClientHello before the rest of the stream.
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(p []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(p, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *prefixConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// udpSession is one client's flow: datagrams from the client go out on
+// conn, replies come back from it.
+type udpSession struct {
+	conn     net.Conn
+	lastSeen atomic.Int64 // unix nanoseconds of the last datagram either way
+}
+
+func (s *Streams) serveUDP(ls *streamListener, pc net.PacketConn) {
+	var mu sync.Mutex
+	sessions := make(map[string]*udpSession)
+	defer func() {
+		mu.Lock()
+		for _, sess := range sessions {
+			sess.conn.Close()
+		}
+		mu.Unlock()
+	}()
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		routes := ls.routes.Load()
+		if routes == nil || routes.single == nil {
+			continue
+		}
+		route := routes.single
+		key := addr.String()
+
+		mu.Lock()
+		sess := sessions[key]
+		full := len(sessions) >= maxUDPSessions
+		mu.Unlock()
+		if sess == nil {
+			ip := remoteIP(addr)
+			if ok, reason := s.guard.Check(ip, route.cfg.Domain); !ok {
+				route.stats.refused.Add(1)
+				debugLog("[Stream] %s: blocked %s: %s", route.cfg.Name, ip, reason)
+				continue
+			}
+			if full {
+				continue
+			}
+			conn, err := net.DialTimeout("udp", route.addr, streamDialTimeout)
+			if err != nil {
+				log.Printf("[Stream] %s: backend %s unreachable: %v", route.cfg.Name, route.addr, err)
+				continue
+			}
+			sess = &udpSession{conn: conn}
+			sess.lastSeen.Store(time.Now().UnixNano())
+			mu.Lock()
+			sessions[key] = sess
+			mu.Unlock()
+			route.stats.total.Add(1)
+			route.stats.active.Add(1)
+			go func() {
+				s.udpReplies(pc, addr, sess, route.stats)
+				mu.Lock()
+				delete(sessions, key)
+				mu.Unlock()
+				sess.conn.Close()
+				route.stats.active.Add(-1)
+			}()
+		}
+		sess.lastSeen.Store(time.Now().UnixNano())
+		if _, err := sess.conn.Write(buf[:n]); err == nil {
+			route.stats.bytesIn.Add(int64(n))
+		}
+	}
+}
+
+// udpReplies relays the backend's datagrams to the client until the flow
+// has been idle for udpSessionIdle in both directions.
+func (s *Streams) udpReplies(pc net.PacketConn, client net.Addr, sess *udpSession, st *streamStats) {
+	buf := make([]byte, maxDatagram)
+	for {
+		sess.conn.SetReadDeadline(time.Unix(0, sess.lastSeen.Load()).Add(udpSessionIdle))
+		n, err := sess.conn.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() && time.Since(time.Unix(0, sess.lastSeen.Load())) < udpSessionIdle {
+				continue // the client spoke since the deadline was set
+			}
+			return
+		}
+		sess.lastSeen.Store(time.Now().UnixNano())
+		if _, err := pc.WriteTo(buf[:n], client); err == nil {
+			st.bytesOut.Add(int64(n))
+		}
+	}
+}
+
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return strings.TrimPrefix(host, "::ffff:")
+}
@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"odac/internal/firewall"
+	"odac/internal/proxy/config"
+)
+
+// streamBackend answers every connection with its name after reading the
+// first chunk the client sends, and returns its port.
+func streamBackend(t *testing.T, name string) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 4096)
+				n, _ := c.Read(buf)
+				io.WriteString(c, name+":"+strconv.Itoa(int(buf[0]))+":"+strconv.Itoa(n))
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func freeStreamPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// clientHello returns the first TLS record a client sends for serverName.
+func clientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+	c, s := net.Pipe()
+	go tls.Client(c, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+	defer c.Close()
+	defer s.Close()
+	buf := make([]byte, 16384)
+	n, err := s.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func dialStream(t *testing.T, port int, payload []byte) string {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(port), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	conn.Write(payload)
+	reply, _ := io.ReadAll(conn)
+	return string(reply)
+}
+
+func TestStreamForwardsPlainTCP(t *testing.T) {
+	backend := streamBackend(t, "db")
+	listen := freeStreamPort(t)
+	s := NewStreams(firewall.NewGuard("Test"))
+	defer s.Close()
+	s.UpdateConfig([]config.Stream{{Name: "db", Protocol: "tcp", Listen: listen, Host: "127.0.0.1", Port: backend}})
+
+	if got := dialStream(t, listen, []byte("ping")); got != "db:112:4" {
+		t.Fatalf("reply = %q", got)
+	}
+	stats := s.Stats()
+	if len(stats) != 1 || stats[0].Total != 1 || stats[0].BytesIn != 4 || stats[0].BytesOut != 8 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	s.UpdateConfig(nil)
+	if _, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(listen), time.Second); err == nil {
+		t.Fatal("listener still open after the stream was removed")
+	}
+}
+
+func TestStreamRoutesPassthroughBySNI(t *testing.T) {
+	a := streamBackend(t, "a")
+	b := streamBackend(t, "b")
+	listen := freeStreamPort(t)
+	s := NewStreams(firewall.NewGuard("Test"))
+	defer s.Close()
+	s.UpdateConfig([]config.Stream{
+		{Name: "a", Protocol: "tcp", Listen: listen, Host: "127.0.0.1", Port: a, TLS: "passthrough", Domain: "a.example.com"},
+		{Name: "b", Protocol: "tcp", Listen: listen, Host: "127.0.0.1", Port: b, TLS: "passthrough", Domain: "b.example.com"},
+	})
+
+	helloA := clientHello(t, "a.example.com")
+	want := "a:22:" + strconv.Itoa(len(helloA)) // the backend gets the ClientHello unchanged
+	if got := dialStream(t, listen, helloA); got != want {
+		t.Fatalf("a.example.com reply = %q, want %q", got, want)
+	}
+	if got := dialStream(t, listen, clientHello(t, "B.example.com")); !strings.HasPrefix(got, "b:") {
+		t.Fatalf("b.example.com reply = %q", got)
+	}
+	if got := dialStream(t, listen, clientHello(t, "c.example.com")); got != "" {
+		t.Fatalf("unknown SNI reached a backend: %q", got)
+	}
+}
+
+// selfSigned writes a certificate for name to dir and returns its paths.
+func selfSigned(t *testing.T, dir, name string) config.SSL {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	paths := config.SSL{Cert: filepath.Join(dir, "cert.pem"), Key: filepath.Join(dir, "key.pem")}
+	os.WriteFile(paths.Cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(paths.Key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return paths
+}
+
+func TestStreamTerminatesTLS(t *testing.T) {
+	backend := streamBackend(t, "mqtt")
+	listen := freeStreamPort(t)
+	s := NewStreams(firewall.NewGuard("Test"))
+	defer s.Close()
+	s.UpdateConfig([]config.Stream{{
+		Name: "mqtt", Protocol: "tcp", Listen: listen, Host: "127.0.0.1", Port: backend,
+		TLS: "terminate", Domain: "mqtt.example.com", Cert: config.Cert{SSL: selfSigned(t, t.TempDir(), "mqtt.example.com")},
+	}})
+
+	conn, err := tls.Dial("tcp", "127.0.0.1:"+strconv.Itoa(listen), &tls.Config{ServerName: "mqtt.example.com", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if cn := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; cn != "mqtt.example.com" {
+		t.Errorf("served certificate for %q", cn)
+	}
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	conn.Write([]byte("ping"))
+	reply, _ := io.ReadAll(conn)
+	if string(reply) != "mqtt:112:4" { // the backend sees plain bytes
+		t.Fatalf("reply = %q", reply)
+	}
+}
+
+func TestStreamRefusesFirewalledClients(t *testing.T) {
+	backend := streamBackend(t, "db")
+	listen := freeStreamPort(t)
+	guard := firewall.NewGuard("Test")
+	guard.Update(firewall.Policy{Enabled: true, Domains: map[string]firewall.DomainRule{
+		"db.example.com": {Blacklist: []string{"127.0.0.1"}},
+	}})
+	s := NewStreams(guard)
+	defer s.Close()
+	s.UpdateConfig([]config.Stream{{Name: "db", Protocol: "tcp", Listen: listen, Host: "127.0.0.1", Port: backend, Domain: "db.example.com"}})
+
+	if got := dialStream(t, listen, []byte("ping")); got != "" {
+		t.Fatalf("blacklisted client got %q", got)
+	}
+	if stats := s.Stats(); stats[0].Refused != 1 || stats[0].Total != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestStreamForwardsUDP(t *testing.T) {
+	backend, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := backend.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			backend.WriteTo(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := pc.LocalAddr().(*net.UDPAddr).Port
+	pc.Close()
+
+	s := NewStreams(firewall.NewGuard("Test"))
+	defer s.Close()
+	s.UpdateConfig([]config.Stream{{Name: "dns", Protocol: "udp", Listen: listen, Host: "127.0.0.1", Port: backend.LocalAddr().(*net.UDPAddr).Port}})
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+strconv.Itoa(listen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	conn.Write([]byte("hi"))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "echo:hi" {
+		t.Fatalf("reply = %q, %v", buf[:n], err)
+	}
+	// The reply can overtake the counter update; give it a moment.
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		stats := s.Stats()
+		if stats[0].Active == 1 && stats[0].BytesIn == 2 && stats[0].BytesOut == 7 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v", stats)
+		}
+	}
+}
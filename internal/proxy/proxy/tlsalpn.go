@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"log"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// acmeTLSProto is the ALPN protocol a CA offers when it validates a
+// TLS-ALPN-01 challenge (RFC 8737).
+const acmeTLSProto = "acme-tls/1"
+
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// SetTLSALPNChallenge prepares the certificate answering a TLS-ALPN-01
+// challenge for domain: self-signed, for that name only, carrying the
+// SHA-256 of the key authorization.
+func (p *Proxy) SetTLSALPNChallenge(domain, keyAuthorization string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(keyAuthorization))
+	value, err := asn1.Marshal(sum[:])
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:    serial,
+		Subject:         pkix.Name{CommonName: domain},
+		DNSNames:        []string{domain},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: idPeAcmeIdentifier, Critical: true, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	p.acmeMu.Lock()
+	p.alpnChallenges[strings.ToLower(domain)] = &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	p.acmeMu.Unlock()
+	log.Printf("ACME TLS-ALPN-01 challenge set for %s", domain)
+	return nil
+}
+
+// DeleteTLSALPNChallenge drops a domain's challenge certificate.
+func (p *Proxy) DeleteTLSALPNChallenge(domain string) {
+	p.acmeMu.Lock()
+	delete(p.alpnChallenges, strings.ToLower(domain))
+	p.acmeMu.Unlock()
+	log.Printf("ACME TLS-ALPN-01 challenge removed for %s", domain)
+}
+
+// ConfigForClient is the server's tls.Config.GetConfigForClient: it answers
+// TLS-ALPN-01 validation handshakes with the challenge certificate, and asks
+// for a client certificate on websites with mTLS.
+func (p *Proxy) ConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	clientAuth := p.clientAuthConfig(base)
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if slices.Contains(hello.SupportedProtos, acmeTLSProto) {
+			p.acmeMu.RLock()
+			cert := p.alpnChallenges[strings.ToLower(hello.ServerName)]
+			p.acmeMu.RUnlock()
+			if cert != nil {
+				return &tls.Config{
+					Certificates: []tls.Certificate{*cert},
+					NextProtos:   []string{acmeTLSProto},
+					MinVersion:   tls.VersionTLS12,
+				}, nil
+			}
+		}
+		return clientAuth(hello)
+	}
+}
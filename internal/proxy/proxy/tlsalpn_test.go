@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/asn1"
+	"testing"
+
+	"odac/internal/proxy/config"
+)
+
+func TestTLSALPNChallenge(t *testing.T) {
+	p := NewProxy()
+	p.UpdateConfig(map[string]config.Website{
+		"site.test": {Domain: "site.test", Port: 1, Cert: config.Cert{SSL: selfSigned(t, t.TempDir(), "site.test")}},
+	}, nil, nil, nil, nil)
+	addr := mtlsProxy(t, p)
+
+	dial := func(name string, protos ...string) (*tls.ConnectionState, error) {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: name, NextProtos: protos, InsecureSkipVerify: true})
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		state := conn.ConnectionState()
+		return &state, nil
+	}
+
+	if err := p.SetTLSALPNChallenge("site.test", "token.thumbprint"); err != nil {
+		t.Fatal(err)
+	}
+	state, err := dial("site.test", acmeTLSProto)
+	if err != nil {
+		t.Fatalf("validation handshake: %v", err)
+	}
+	if state.NegotiatedProtocol != acmeTLSProto {
+		t.Errorf("protocol = %q", state.NegotiatedProtocol)
+	}
+	leaf := state.PeerCertificates[0]
+	sum := sha256.Sum256([]byte("token.thumbprint"))
+	want, _ := asn1.Marshal(sum[:])
+	found := false
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(idPeAcmeIdentifier) {
+			found = ext.Critical && bytes.Equal(ext.Value, want)
+		}
+	}
+	if !found || len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "site.test" {
+		t.Fatalf("challenge certificate: names %v, acmeIdentifier ok %v", leaf.DNSNames, found)
+	}
+
+	// Browsers still get the site's certificate.
+	state, err = dial("site.test", "h2", "http/1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range state.PeerCertificates[0].Extensions {
+		if ext.Id.Equal(idPeAcmeIdentifier) {
+			t.Fatal("challenge certificate served to a regular client")
+		}
+	}
+
+	p.DeleteTLSALPNChallenge("site.test")
+	if state, err := dial("site.test", acmeTLSProto); err == nil && state.NegotiatedProtocol == acmeTLSProto {
+		t.Error("challenge still answered after it was removed")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"sync"
 	"time"
@@ -16,9 +17,14 @@ import (
 )
 
 const (
-	// tunnelWSURL is the ODAC Cloud tunnel proxy WebSocket endpoint.
+	// tunnelWSURL is the ODAC Cloud tunnel proxy WebSocket endpoint, used
+	// when a tunnel names no relay of its own.
 	tunnelWSURL = "wss://tunnel.odac.run/_odac/ws"
 
+	// tunnelAgentPath is where a relay (ODAC Cloud or an odac-proxy, see
+	// relay.go) accepts agents.
+	tunnelAgentPath = "/_odac/ws"
+
 	// tunnelReconnectInterval is the delay between reconnection attempts.
 	tunnelReconnectInterval = 5 * time.Second
 
@@ -27,27 +33,29 @@ const (
 	tunnelCopyBufSize = 64 * 1024
 )
 
-// tunnelConn represents a single active tunnel connection to ODAC Cloud
+// tunnelConn represents a single active tunnel connection to a relay
 // for one domain. Each tunnel has its own WebSocket + yamux session.
 type tunnelConn struct {
 	domain  string
 	host    string // Resolved backend IP/hostname
 	port    int    // Resolved backend port
 	token   string
+	relay   string     // Relay WebSocket URL
+	mu      sync.Mutex // Guards session and ws, set by runTunnel and closed by closeTunnel
 	session *yamux.Session
 	ws      *websocket.Conn
 	stopCh  chan struct{}
 }
 
-// TunnelManager manages outbound tunnel connections to ODAC Cloud.
-// This ODAC instance acts as the tunnel AGENT (client) — it connects
-// to the cloud tunnel proxy and forwards incoming streams to local apps.
+// TunnelManager manages outbound tunnel connections to ODAC Cloud or a
+// self-hosted relay. This ODAC instance acts as the tunnel AGENT (client) —
+// it connects to the relay and forwards incoming streams to local apps.
 type TunnelManager struct {
 	conns map[string]*tunnelConn // domain -> active connection
 	mu    sync.RWMutex
 }
 
-// NewTunnelManager creates a tunnel manager for outbound cloud connections.
+// NewTunnelManager creates a tunnel manager for outbound relay connections.
 func NewTunnelManager() *TunnelManager {
 	return &TunnelManager{
 		conns: make(map[string]*tunnelConn),
@@ -71,6 +79,9 @@ func (tm *TunnelManager) UpdateConfig(tunnels []config.Tunnel) {
 	// Build incoming set for quick lookup
 	incoming := make(map[string]config.Tunnel, len(tunnels))
 	for _, t := range tunnels {
+		if t.Relay == "" {
+			t.Relay = tunnelWSURL
+		}
 		incoming[t.Domain] = t
 	}
 
@@ -86,8 +97,8 @@ func (tm *TunnelManager) UpdateConfig(tunnels []config.Tunnel) {
 	// Start new tunnels or update existing ones
 	for domain, t := range incoming {
 		if existing, ok := tm.conns[domain]; ok {
-			// Token or backend changed — reconnect
-			if existing.token != t.Token || existing.host != t.Host || existing.port != t.Port {
+			// Token, backend or relay changed — reconnect
+			if existing.token != t.Token || existing.host != t.Host || existing.port != t.Port || existing.relay != t.Relay {
 				log.Printf("[Tunnel] Config changed, reconnecting: %s", domain)
 				tm.closeTunnel(existing)
 				delete(tm.conns, domain)
@@ -101,6 +112,7 @@ func (tm *TunnelManager) UpdateConfig(tunnels []config.Tunnel) {
 			host:   t.Host,
 			port:   t.Port,
 			token:  t.Token,
+			relay:  t.Relay,
 			stopCh: make(chan struct{}),
 		}
 		tm.conns[domain] = conn
@@ -134,7 +146,7 @@ func (tm *TunnelManager) runTunnel(tc *tunnelConn) {
 	}
 }
 
-// connect establishes a single WebSocket + yamux session to ODAC Cloud.
+// connect establishes a single WebSocket + yamux session to the relay.
 // It blocks until the session closes or an error occurs.
 func (tm *TunnelManager) connect(tc *tunnelConn) error {
 	dialer := websocket.Dialer{
@@ -147,54 +159,77 @@ func (tm *TunnelManager) connect(tc *tunnelConn) error {
 	header := http.Header{}
 	header.Set("X-Agent-Domain", tc.domain)
 
-	url := tunnelWSURL + "?odac_ws_token=" + tc.token
+	target, err := url.Parse(tc.relay)
+	if err != nil {
+		return err
+	}
+	query := target.Query()
+	query.Set("odac_ws_token", tc.token)
+	target.RawQuery = query.Encode()
 
-	log.Printf("[Tunnel] Connecting to cloud for domain: %s", tc.domain)
+	log.Printf("[Tunnel] Connecting to %s for domain: %s", target.Host, tc.domain)
 
-	ws, _, err := dialer.Dial(url, header)
+	ws, _, err := dialer.Dial(target.String(), header)
 	if err != nil {
 		return err
 	}
-	tc.ws = ws
 
 	log.Printf("[Tunnel] Connected for domain: %s", tc.domain)
 
 	// Wrap WebSocket as net.Conn for yamux
 	conn := newWSConn(ws)
 
-	// Start yamux CLIENT session — ODAC Cloud is the server that opens streams
-	yamuxCfg := yamux.DefaultConfig()
-	yamuxCfg.EnableKeepAlive = true
-	yamuxCfg.KeepAliveInterval = 15 * time.Second
-	yamuxCfg.ConnectionWriteTimeout = 10 * time.Second
-	yamuxCfg.MaxStreamWindowSize = 4 * 1024 * 1024 // 4MB — must match server side
-	yamuxCfg.LogOutput = io.Discard
-
-	session, err := yamux.Client(conn, yamuxCfg)
+	// Start yamux CLIENT session — the relay is the server that opens streams
+	session, err := yamux.Client(conn, tunnelYamuxConfig())
 	if err != nil {
 		ws.Close()
 		return err
 	}
-	tc.session = session
 
-	// Accept streams from ODAC Cloud and forward to local app
-	tm.acceptStreams(tc)
+	// Publish for closeTunnel, unless it already ran while we were dialing.
+	tc.mu.Lock()
+	select {
+	case <-tc.stopCh:
+		tc.mu.Unlock()
+		session.Close()
+		ws.Close()
+		return nil
+	default:
+	}
+	tc.session, tc.ws = session, ws
+	tc.mu.Unlock()
+
+	// Accept streams from the relay and forward to local app
+	tm.acceptStreams(tc, session)
 
 	// Cleanup
 	session.Close()
 	ws.Close()
-	tc.session = nil
-	tc.ws = nil
+	tc.mu.Lock()
+	tc.session, tc.ws = nil, nil
+	tc.mu.Unlock()
 
-	log.Printf("[Tunnel] Disconnected from cloud for domain: %s", tc.domain)
+	log.Printf("[Tunnel] Disconnected from relay for domain: %s", tc.domain)
 	return nil
 }
 
-// acceptStreams continuously accepts yamux streams from ODAC Cloud
+// tunnelYamuxConfig is shared by agents and the relay; both sides must agree
+// on the stream window.
+func tunnelYamuxConfig() *yamux.Config {
+	cfg := yamux.DefaultConfig()
+	cfg.EnableKeepAlive = true
+	cfg.KeepAliveInterval = 15 * time.Second
+	cfg.ConnectionWriteTimeout = 10 * time.Second
+	cfg.MaxStreamWindowSize = 4 * 1024 * 1024 // 4MB — must match server side
+	cfg.LogOutput = io.Discard
+	return cfg
+}
+
+// acceptStreams continuously accepts yamux streams from the relay
 // and forwards each one to the local app as a raw TCP pipe.
-func (tm *TunnelManager) acceptStreams(tc *tunnelConn) {
+func (tm *TunnelManager) acceptStreams(tc *tunnelConn, session *yamux.Session) {
 	for {
-		stream, err := tc.session.AcceptStream()
+		stream, err := session.AcceptStream()
 		if err != nil {
 			// Session closed or error — trigger reconnect
 			select {
@@ -235,7 +270,7 @@ func handleStream(tc *tunnelConn, stream net.Conn) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 
-	// Cloud → Backend (request direction)
+	// Relay → Backend (request direction)
 	go func() {
 		defer wg.Done()
 		bp := tunnelBufPool.Get().(*[]byte)
@@ -247,13 +282,13 @@ func handleStream(tc *tunnelConn, stream net.Conn) {
 		}
 	}()
 
-	// Backend → Cloud (response direction)
+	// Backend → Relay (response direction)
 	go func() {
 		defer wg.Done()
 		bp := tunnelBufPool.Get().(*[]byte)
 		io.CopyBuffer(stream, backend, *bp)
 		tunnelBufPool.Put(bp)
-		// Half-close: signal cloud that response is complete
+		// Half-close: signal the relay that response is complete
 		stream.Close()
 	}()
 
@@ -323,6 +358,8 @@ func (c *wsConn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadl
 // AcceptStream unblocks immediately instead of hanging until the remote
 // side closes — preventing goroutine and connection leaks.
 func (tm *TunnelManager) closeTunnel(tc *tunnelConn) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
 	close(tc.stopCh)
 	if tc.session != nil {
 		tc.session.Close()
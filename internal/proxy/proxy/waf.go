@@ -0,0 +1,502 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"odac/internal/proxy/config"
+)
+
+// ============================================================================
+// ODAC WAF: request inspection stage in front of the reverse proxy
+//
+// A compact subset of the OWASP Core Rule Set semantics, compiled per website:
+//   - protocol constraints: method allow-list, URL length, header count,
+//     body size, NUL bytes
+//   - scanner User-Agents (sqlmap, nikto, ...)
+//   - path traversal, OS file access, restricted dot-files
+//   - XSS (script tags, event handlers, javascript: URIs)
+//   - SQL injection (UNION SELECT, tautologies, stacked and time-based
+//     queries, schema probing)
+//
+// Inputs are decoded (URL twice, HTML entities) and SQL comments collapsed
+// before matching. Rule IDs follow the CRS numbering so operators can tune
+// with the IDs they already know. Matches are logged with the request ID the
+// director forwards upstream; in "detect" mode nothing is blocked.
+// ============================================================================
+
+const (
+	// wafInspectLimit is the body prefix inspected; larger bodies are
+	// forwarded intact with only their first bytes checked.
+	wafInspectLimit = 128 * 1024
+
+	// wafMaxArgs bounds the argument values inspected per request.
+	wafMaxArgs = 1024
+)
+
+// Target kinds a pattern rule applies to.
+const (
+	wafPath = 1 << iota
+	wafArgs
+	wafCookies
+)
+
+type wafRule struct {
+	id      string
+	group   string
+	msg     string
+	targets int
+	re      *regexp.Regexp
+}
+
+var wafRules = []wafRule{
+	{"930100", "traversal", "Path traversal", wafPath | wafArgs,
+		regexp.MustCompile(`(?:^|[\\/])\.\.(?:[\\/]|$)`)},
+	{"930120", "traversal", "OS file access attempt", wafPath | wafArgs,
+		regexp.MustCompile(`(?i)(?:/etc/(?:passwd|shadow|group|hosts)\b|/proc/self/|\bboot\.ini\b|\bwin\.ini\b|\\windows\\system32)`)},
+	{"930130", "traversal", "Restricted file access", wafPath,
+		regexp.MustCompile(`(?i)(?:^|/)\.(?:git|svn|hg|env|htaccess|htpasswd|ds_store)(?:/|$)`)},
+	{"941100", "xss", "XSS: script tag", wafArgs | wafCookies,
+		regexp.MustCompile(`(?i)<script[\s/>]`)},
+	{"941110", "xss", "XSS: event handler attribute", wafArgs | wafCookies,
+		regexp.MustCompile(`(?i)<[a-z][^>]*[\s/"']on[a-z]+\s*=`)},
+	{"941120", "xss", "XSS: script URI", wafArgs,
+		regexp.MustCompile(`(?i)\b(?:javascript|vbscript)\s*:`)},
+	{"941130", "xss", "XSS: dangerous tag", wafArgs,
+		regexp.MustCompile(`(?i)<(?:iframe|object|embed|applet|meta|base)\b`)},
+	{"942100", "sqli", "SQL injection: UNION SELECT", wafArgs | wafCookies,
+		regexp.MustCompile(`(?i)\bunion\b(?:\s+(?:all|distinct))?\s+select\b`)},
+	{"942110", "sqli", "SQL injection: tautology", wafArgs | wafCookies,
+		regexp.MustCompile(`(?i)['"]\s*\)?\s*(?:or|and|\|\||&&)\s+['"(]?\s*\w+\s*['")]?\s*(?:=|<>|!=|<|>|\blike\b)`)},
+	{"942120", "sqli", "SQL injection: stacked query", wafArgs | wafCookies,
+		regexp.MustCompile(`(?i);\s*(?:drop|truncate|alter|create|insert|update|delete)\s+(?:table|database|schema|from|into)\b`)},
+	{"942130", "sqli", "SQL injection: time-based probe", wafArgs | wafCookies,
+		regexp.MustCompile(`(?i)(?:\b(?:sleep|benchmark|pg_sleep)\s*\(|\bwaitfor\s+delay\b)`)},
+	{"942140", "sqli", "SQL injection: schema probing", wafArgs | wafCookies,
+		regexp.MustCompile(`(?i)\b(?:information_schema|pg_catalog|sysobjects|syscolumns|mysql\.user)\b`)},
+	{"942150", "sqli", "SQL injection: comment-terminated string", wafArgs,
+		regexp.MustCompile(`['"]\s*\)?\s*(?:--(?:\s|$)|#\s*$|/\*)`)},
+	{"942160", "sqli", "SQL injection: file access", wafArgs | wafCookies,
+		regexp.MustCompile(`(?i)(?:\bload_file\s*\(|\binto\s+(?:out|dump)file\b)`)},
+}
+
+// Constraint rules: evaluated in code, listed here for IDs and messages.
+const (
+	wafRuleMethod    = "911100"
+	wafRuleScanner   = "913100"
+	wafRuleNul       = "920270"
+	wafRuleURLLength = "920300"
+	wafRuleHeaders   = "920380"
+	wafRuleBodySize  = "920400"
+)
+
+var wafConstraintGroups = map[string]string{
+	wafRuleMethod:    "protocol",
+	wafRuleScanner:   "scanner",
+	wafRuleNul:       "protocol",
+	wafRuleURLLength: "protocol",
+	wafRuleHeaders:   "protocol",
+	wafRuleBodySize:  "protocol",
+}
+
+var defaultWAFMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "QUERY"}
+
+var scannerAgents = regexp.MustCompile(`(?i)\b(?:sqlmap|nikto|nessus|nmap|masscan|zgrab|wpscan|acunetix|dirbuster|gobuster|nuclei|havij|w3af|openvas|arachni|fimap|whatweb|zmeu|netsparker|appscan)\b`)
+
+var sqlComment = regexp.MustCompile(`/\*.*?\*/`)
+
+// wafEngine is one website's compiled WAF configuration.
+type wafEngine struct {
+	detect     bool
+	rules      []wafRule
+	constraint map[string]bool // enabled constraint rules
+	exclusions []wafExclusion
+	methods    map[string]bool
+	maxBody    int64
+	maxURL     int
+	maxHeaders int
+	badAgents  []string
+}
+
+type wafExclusion struct {
+	path  string
+	exact bool
+	ids   map[string]bool // nil = every rule
+}
+
+type wafMatch struct {
+	id, msg, target string
+}
+
+// newWAFEngine compiles a website's WAF block; nil when absent or "off".
+func newWAFEngine(cfg *config.WAF) *wafEngine {
+	if cfg == nil {
+		return nil
+	}
+	mode := strings.ToLower(strings.TrimSpace(cfg.Mode))
+	switch mode {
+	case "off", "disabled", "false":
+		return nil
+	case "", "block", "detect":
+	default:
+		log.Printf("[WAF] Unknown mode %q, using block", cfg.Mode)
+		mode = "block"
+	}
+
+	selected := func(id, group string) bool {
+		if len(cfg.Rules) > 0 && !wafListed(cfg.Rules, id, group) {
+			return false
+		}
+		return !wafListed(cfg.Disable, id, group)
+	}
+
+	e := &wafEngine{
+		detect:     mode == "detect",
+		constraint: map[string]bool{},
+		methods:    map[string]bool{},
+		maxBody:    cfg.MaxBodyBytes,
+		maxURL:     cfg.MaxURLLength,
+		maxHeaders: cfg.MaxHeaders,
+	}
+	for _, r := range wafRules {
+		if selected(r.id, r.group) {
+			e.rules = append(e.rules, r)
+		}
+	}
+	for id, group := range wafConstraintGroups {
+		if selected(id, group) {
+			e.constraint[id] = true
+		}
+	}
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultWAFMethods
+	}
+	for _, m := range methods {
+		e.methods[strings.ToUpper(strings.TrimSpace(m))] = true
+	}
+	for _, ua := range cfg.BlockUserAgents {
+		if ua = strings.ToLower(strings.TrimSpace(ua)); ua != "" {
+			e.badAgents = append(e.badAgents, ua)
+		}
+	}
+	for _, ex := range cfg.Exclusions {
+		x := wafExclusion{path: ex.Path}
+		if strings.HasPrefix(x.path, "=") {
+			x.path, x.exact = x.path[1:], true
+		}
+		if x.path == "" {
+			continue
+		}
+		if len(ex.Rules) > 0 {
+			x.ids = map[string]bool{}
+			for _, r := range wafRules {
+				if wafListed(ex.Rules, r.id, r.group) {
+					x.ids[r.id] = true
+				}
+			}
+			for id, group := range wafConstraintGroups {
+				if wafListed(ex.Rules, id, group) {
+					x.ids[id] = true
+				}
+			}
+		}
+		e.exclusions = append(e.exclusions, x)
+	}
+	return e
+}
+
+// wafListed reports whether a list of rule IDs and group names names a rule.
+func wafListed(list []string, id, group string) bool {
+	for _, v := range list {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == id || v == group {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether rule id is switched off for path.
+func (e *wafEngine) excluded(path, id string) bool {
+	for _, x := range e.exclusions {
+		hit := path == x.path
+		if !x.exact && !hit {
+			hit = strings.HasPrefix(path, x.path)
+		}
+		if hit && (x.ids == nil || x.ids[id]) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow runs the WAF stage. It returns false when the request was answered
+// (blocked); in detect mode matches are only logged.
+func (e *wafEngine) allow(w http.ResponseWriter, r *http.Request, host string) bool {
+	e.limitBody(w, r)
+	m := e.inspect(r)
+	if m == nil {
+		return true
+	}
+	id := ensureRequestID(r)
+	action := "Blocked"
+	if e.detect {
+		action = "Detected"
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	log.Printf("[WAF] %s %s %s (%s) at %s%s from %s request_id=%s",
+		action, m.id, m.msg, logSafe(m.target), host, logSafe(r.URL.Path), ip, id)
+	if e.detect {
+		return true
+	}
+	w.Header().Set("X-Request-ID", id)
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// limitBody holds a body of undeclared length, such as a chunked one, to
+// MaxBodyBytes as it is read. Past the limit reads fail and the request is
+// answered 413 (see errorHandler). Declared lengths are checked by inspect.
+func (e *wafEngine) limitBody(w http.ResponseWriter, r *http.Request) {
+	if e.detect || e.maxBody <= 0 || r.ContentLength >= 0 || r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	if !e.constraint[wafRuleBodySize] || e.excluded(r.URL.Path, wafRuleBodySize) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, e.maxBody)
+}
+
+// inspect returns the first rule the request trips, or nil.
+func (e *wafEngine) inspect(r *http.Request) *wafMatch {
+	path := r.URL.Path
+	on := func(id string) bool { return e.constraint[id] && !e.excluded(path, id) }
+
+	if on(wafRuleMethod) && !e.methods[r.Method] {
+		return &wafMatch{wafRuleMethod, "Method not allowed", "REQUEST_METHOD:" + r.Method}
+	}
+	if on(wafRuleURLLength) && e.maxURL > 0 && len(r.URL.RequestURI()) > e.maxURL {
+		return &wafMatch{wafRuleURLLength, "URL too long", "REQUEST_URI"}
+	}
+	if on(wafRuleHeaders) && e.maxHeaders > 0 && len(r.Header) > e.maxHeaders {
+		return &wafMatch{wafRuleHeaders, "Too many headers", "REQUEST_HEADERS"}
+	}
+	if on(wafRuleBodySize) && e.maxBody > 0 && r.ContentLength > e.maxBody {
+		return &wafMatch{wafRuleBodySize, "Request body too large", "REQUEST_BODY"}
+	}
+	if on(wafRuleScanner) {
+		ua := r.Header.Get("User-Agent")
+		if scannerAgents.MatchString(ua) {
+			return &wafMatch{wafRuleScanner, "Security scanner detected", "REQUEST_HEADERS:User-Agent"}
+		}
+		lower := strings.ToLower(ua)
+		for _, bad := range e.badAgents {
+			if strings.Contains(lower, bad) {
+				return &wafMatch{wafRuleScanner, "Blocked User-Agent", "REQUEST_HEADERS:User-Agent"}
+			}
+		}
+	}
+
+	var active []wafRule
+	for _, rule := range e.rules {
+		if !e.excluded(path, rule.id) {
+			active = append(active, rule)
+		}
+	}
+	nul := on(wafRuleNul)
+	if len(active) == 0 && !nul {
+		return nil
+	}
+
+	check := func(kind int, target, value string) *wafMatch {
+		if value == "" {
+			return nil
+		}
+		v := wafDecode(value)
+		if nul && strings.IndexByte(v, 0) >= 0 {
+			return &wafMatch{wafRuleNul, "NUL byte in request", target}
+		}
+		var sql string
+		for _, rule := range active {
+			if rule.targets&kind == 0 {
+				continue
+			}
+			subject := v
+			if rule.group == "sqli" {
+				if sql == "" {
+					sql = sqlComment.ReplaceAllString(v, " ")
+				}
+				subject = sql
+			}
+			if rule.re.MatchString(subject) {
+				return &wafMatch{rule.id, rule.msg, target}
+			}
+		}
+		return nil
+	}
+
+	if m := check(wafPath, "REQUEST_PATH", path); m != nil {
+		return m
+	}
+	n := 0
+query:
+	for name, values := range r.URL.Query() {
+		if m := check(wafArgs, "ARGS_NAMES", name); m != nil {
+			return m
+		}
+		for _, v := range values {
+			if n++; n > wafMaxArgs {
+				break query
+			}
+			if m := check(wafArgs, "ARGS:"+name, v); m != nil {
+				return m
+			}
+		}
+	}
+	for _, c := range r.Cookies() {
+		if m := check(wafCookies, "REQUEST_COOKIES:"+c.Name, c.Value); m != nil {
+			return m
+		}
+	}
+	for _, arg := range wafBodyArgs(r) {
+		if n++; n > wafMaxArgs {
+			break
+		}
+		if m := check(wafArgs, arg[0], arg[1]); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// wafDecode undoes the encodings attackers layer to slip past patterns:
+// a second round of URL decoding (the first was done by net/url) and HTML
+// entities.
+func wafDecode(s string) string {
+	if strings.ContainsAny(s, "%+") {
+		if d, err := url.QueryUnescape(s); err == nil {
+			s = d
+		}
+	}
+	if strings.IndexByte(s, '&') >= 0 {
+		s = html.UnescapeString(s)
+	}
+	return s
+}
+
+// wafBodyArgs extracts inspectable values from a form, multipart, JSON, XML
+// or text body. The consumed prefix is stitched back in front of the
+// remaining body so the backend receives the request unchanged.
+func wafBodyArgs(r *http.Request) [][2]string {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	isJSON := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	isText := mediaType == "text/plain" || strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml")
+	isForm := mediaType == "application/x-www-form-urlencoded"
+	isMultipart := mediaType == "multipart/form-data" && params["boundary"] != ""
+	if !isJSON && !isText && !isForm && !isMultipart {
+		return nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, wafInspectLimit))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil || len(buf) == 0 {
+		return nil
+	}
+
+	var args [][2]string
+	switch {
+	case isForm:
+		values, _ := url.ParseQuery(string(buf))
+		for name, vs := range values {
+			args = append(args, [2]string{"ARGS_NAMES", name})
+			for _, v := range vs {
+				args = append(args, [2]string{"ARGS:" + name, v})
+			}
+		}
+	case isMultipart:
+		mr := multipart.NewReader(bytes.NewReader(buf), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FileName() == "" {
+				v, _ := io.ReadAll(io.LimitReader(part, wafInspectLimit))
+				args = append(args, [2]string{"ARGS:" + part.FormName(), string(v)})
+			}
+			part.Close()
+		}
+	case isJSON:
+		var doc any
+		if json.Unmarshal(buf, &doc) != nil {
+			return [][2]string{{"REQUEST_BODY", string(buf)}}
+		}
+		walkJSON(doc, "json", &args)
+	default:
+		args = append(args, [2]string{"REQUEST_BODY", string(buf)})
+	}
+	return args
+}
+
+// walkJSON collects every string (keys included) of a decoded JSON body.
+func walkJSON(v any, path string, out *[][2]string) {
+	if len(*out) > wafMaxArgs {
+		return
+	}
+	switch x := v.(type) {
+	case string:
+		*out = append(*out, [2]string{"ARGS:" + path, x})
+	case map[string]any:
+		for k, child := range x {
+			*out = append(*out, [2]string{"ARGS_NAMES", k})
+			walkJSON(child, path+"."+k, out)
+		}
+	case []any:
+		for i, child := range x {
+			walkJSON(child, path+"["+strconv.Itoa(i)+"]", out)
+		}
+	}
+}
+
+// ensureRequestID returns the request's X-Request-ID, assigning a random one
+// first. ServeHTTP drops the one a client sends, so the ID is always this
+// proxy's. The director forwards the same header, so WAF log lines and
+// backend logs share the ID.
+func ensureRequestID(req *http.Request) string {
+	if id := req.Header.Get("X-Request-ID"); id != "" {
+		return id
+	}
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(uuid)
+	req.Header.Set("X-Request-ID", id)
+	return id
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"odac/internal/proxy/config"
+)
+
+func wafRequest(method, target, body, contentType string) *http.Request {
+	var r *http.Request
+	if body != "" {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+	} else {
+		r = httptest.NewRequest(method, target, nil)
+	}
+	r.Header.Set("User-Agent", "Mozilla/5.0")
+	return r
+}
+
+func TestWAFDetectsAttacks(t *testing.T) {
+	e := newWAFEngine(&config.WAF{})
+	cases := []struct {
+		name string
+		req  *http.Request
+		id   string
+	}{
+		{"union select", wafRequest("GET", "/items?id=1%20UNION%20SELECT%20password%20FROM%20users", "", ""), "942100"},
+		{"comment obfuscation", wafRequest("GET", "/items?id=1%20UNION/**/SELECT%201", "", ""), "942100"},
+		{"tautology", wafRequest("GET", "/login?user=admin'%20OR%20'1'='1", "", ""), "942110"},
+		{"double encoded traversal", wafRequest("GET", "/download?file=..%252f..%252fetc%252fpasswd", "", ""), "930100"},
+		{"dot file", wafRequest("GET", "/.git/config", "", ""), "930130"},
+		{"form xss", wafRequest("POST", "/comment", "text="+url.QueryEscape("<script>alert(1)</script>"), "application/x-www-form-urlencoded"), "941100"},
+		{"json xss", wafRequest("POST", "/api", `{"user":{"bio":"<img src=x onerror=alert(1)>"}}`, "application/json"), "941110"},
+		{"scanner", func() *http.Request {
+			r := wafRequest("GET", "/", "", "")
+			r.Header.Set("User-Agent", "sqlmap/1.7")
+			return r
+		}(), "913100"},
+	}
+	for _, c := range cases {
+		m := e.inspect(c.req)
+		if m == nil {
+			t.Errorf("%s: not detected", c.name)
+			continue
+		}
+		if m.id != c.id {
+			t.Errorf("%s: matched %s (%s), want %s", c.name, m.id, m.msg, c.id)
+		}
+	}
+}
+
+func TestWAFAllowsCleanTraffic(t *testing.T) {
+	e := newWAFEngine(&config.WAF{})
+	reqs := []*http.Request{
+		wafRequest("GET", "/blog/2024/hello-world?page=2&sort=desc", "", ""),
+		wafRequest("GET", "/search?q=union+station+select+seats", "", ""),
+		wafRequest("POST", "/api/users", `{"name":"O'Brien","email":"ob@example.com"}`, "application/json"),
+		wafRequest("POST", "/contact", "message="+url.QueryEscape("Let's meet at 5 - or later?"), "application/x-www-form-urlencoded"),
+		wafRequest("GET", "/.well-known/acme-challenge/token", "", ""),
+	}
+	for _, r := range reqs {
+		if m := e.inspect(r); m != nil {
+			t.Errorf("%s %s: false positive %s (%s) on %s", r.Method, r.URL, m.id, m.msg, m.target)
+		}
+	}
+}
+
+func TestWAFBlockKeepsBodyForBackend(t *testing.T) {
+	e := newWAFEngine(&config.WAF{})
+
+	body := "name=alice&note=hello"
+	r := wafRequest("POST", "/form", body, "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if !e.allow(w, r, "example.com") {
+		t.Fatal("clean form blocked")
+	}
+	got, _ := io.ReadAll(r.Body)
+	if string(got) != body {
+		t.Errorf("body after inspection = %q, want %q", got, body)
+	}
+
+	r = wafRequest("POST", "/form", "note="+url.QueryEscape("<script>x</script>"), "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	if e.allow(w, r, "example.com") {
+		t.Fatal("malicious form allowed")
+	}
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", w.Code)
+	}
+	if w.Header().Get("X-Request-ID") == "" {
+		t.Error("blocked response carries no request ID")
+	}
+}
+
+func TestWAFDetectMode(t *testing.T) {
+	e := newWAFEngine(&config.WAF{Mode: "detect"})
+	r := wafRequest("GET", "/?q=1%20UNION%20SELECT%201", "", "")
+	w := httptest.NewRecorder()
+	if !e.allow(w, r, "example.com") {
+		t.Error("detect mode blocked a request")
+	}
+	if r.Header.Get("X-Request-ID") == "" {
+		t.Error("detected request was not tagged with a request ID")
+	}
+	if newWAFEngine(&config.WAF{Mode: "off"}) != nil || newWAFEngine(nil) != nil {
+		t.Error("off or absent WAF compiled an engine")
+	}
+}
+
+func TestWAFTuning(t *testing.T) {
+	xss := func(path string) *http.Request {
+		return wafRequest("POST", path, "html="+url.QueryEscape("<iframe src=x>"), "application/x-www-form-urlencoded")
+	}
+
+	e := newWAFEngine(&config.WAF{Exclusions: []config.WAFExclusion{
+		{Path: "/admin/editor", Rules: []string{"xss"}},
+		{Path: "=/raw"},
+	}})
+	if m := e.inspect(xss("/admin/editor/save")); m != nil {
+		t.Errorf("excluded prefix still matched %s", m.id)
+	}
+	if m := e.inspect(xss("/admin/other")); m == nil {
+		t.Error("exclusion leaked outside its prefix")
+	}
+	if m := e.inspect(wafRequest("GET", "/admin/editor?id=1%20UNION%20SELECT%201", "", "")); m == nil {
+		t.Error("group exclusion disabled unrelated rules")
+	}
+	if m := e.inspect(xss("/raw")); m != nil {
+		t.Errorf("exact exclusion still matched %s", m.id)
+	}
+	if m := e.inspect(xss("/raw/sub")); m == nil {
+		t.Error("exact exclusion matched a sub-path")
+	}
+
+	e = newWAFEngine(&config.WAF{Disable: []string{"941130"}})
+	if m := e.inspect(xss("/")); m != nil {
+		t.Errorf("disabled rule matched: %s", m.id)
+	}
+
+	e = newWAFEngine(&config.WAF{Rules: []string{"sqli"}})
+	if m := e.inspect(xss("/")); m != nil {
+		t.Errorf("rule outside the selected groups matched: %s", m.id)
+	}
+
+	e = newWAFEngine(&config.WAF{AllowedMethods: []string{"GET", "HEAD"}, MaxURLLength: 32, BlockUserAgents: []string{"BadBot"}})
+	if m := e.inspect(wafRequest("DELETE", "/x", "", "")); m == nil || m.id != wafRuleMethod {
+		t.Errorf("method allow-list: %+v", m)
+	}
+	if m := e.inspect(wafRequest("GET", "/"+strings.Repeat("a", 40), "", "")); m == nil || m.id != wafRuleURLLength {
+		t.Errorf("URL length: %+v", m)
+	}
+	r := wafRequest("GET", "/", "", "")
+	r.Header.Set("User-Agent", "Mozilla/5.0 (compatible; badbot/2.1)")
+	if m := e.inspect(r); m == nil || m.id != wafRuleScanner {
+		t.Errorf("custom user agent: %+v", m)
+	}
+}
+
+// TestWAFThroughProxy checks the body limit on a chunked upload and that the
+// request ID reaching the app is the proxy's, not the client's.
+func TestWAFThroughProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		io.WriteString(w, r.Header.Get("X-Request-ID")+" "+strconv.Itoa(len(body)))
+	}))
+	defer backend.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	n, _ := strconv.Atoi(port)
+
+	p := NewProxy()
+	p.UpdateConfig(map[string]config.Website{
+		"example.com": {Domain: "example.com", Port: n, ContainerIP: "127.0.0.1", WAF: &config.WAF{MaxBodyBytes: 64}},
+	}, nil, nil, nil, nil)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		// A bare io.Reader has no length, so the body is sent chunked.
+		r := httptest.NewRequest("POST", "http://example.com/upload", io.MultiReader(strings.NewReader(body)))
+		r.Header.Set("User-Agent", "Mozilla/5.0")
+		r.Header.Set("X-Request-ID", "forged")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+	w := post(strings.Repeat("a", 32))
+	id, size, _ := strings.Cut(w.Body.String(), " ")
+	if w.Code != http.StatusOK || size != "32" {
+		t.Fatalf("small chunked body: %d %q", w.Code, w.Body.String())
+	}
+	if id == "forged" || len(id) != 32 {
+		t.Errorf("request ID at the app = %q", id)
+	}
+	if w := post(strings.Repeat("a", 4096)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked body over the limit: %d", w.Code)
+	}
+}
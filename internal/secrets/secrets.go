@@ -0,0 +1,357 @@
+// Package secrets keeps named secrets encrypted at rest in the `secret`
+// config module. Values are sealed with AES-256-GCM under a host key that
+// lives in <base>/keys, outside the config directory, so a copy of the
+// config (backups, support bundles) does not expose them. Apps reference a
+// secret from their env as secret://name; appmgr resolves it only when it
+// starts the container.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"odac/internal/api"
+	"odac/internal/config"
+	"odac/internal/lang"
+	"odac/internal/logx"
+)
+
+var __ = lang.T
+
+// nameRE bounds names to what is safe as an env reference and as a file
+// name under /run/secrets.
+var nameRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// ErrNotFound is returned by Reveal for an unknown secret.
+var ErrNotFound = errors.New("secret not found")
+
+// keyring is the key file: every key still needed to open a stored value,
+// and the one new values are sealed with.
+type keyring struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"` // id -> base64 AES-256 key
+}
+
+// Store manages the secrets. It keeps its own copy of the entries and
+// replaces config.secrets wholesale on every change, so Reveal never takes
+// the config value lock and is safe to call from inside cfg.View.
+type Store struct {
+	cfg     *config.Store
+	log     *logx.Logger
+	keyPath string
+
+	mu    sync.Mutex
+	ring  *keyring
+	items map[string]map[string]any // name -> {value, created, updated}
+}
+
+// New loads the stored secrets. The key file is read on first use.
+func New(cfg *config.Store) *Store {
+	s := &Store{
+		cfg:     cfg,
+		log:     logx.New("Secrets"),
+		keyPath: filepath.Join(cfg.BaseDir(), "keys", "secrets.key"),
+		items:   map[string]map[string]any{},
+	}
+	cfg.View(func() {
+		for name, v := range cfg.Map("secrets") {
+			if item, _ := v.(map[string]any); item != nil {
+				s.items[name] = copyItem(item)
+			}
+		}
+	})
+	return s
+}
+
+func copyItem(item map[string]any) map[string]any {
+	out := make(map[string]any, len(item))
+	for k, v := range item {
+		out[k] = v
+	}
+	return out
+}
+
+// persistLocked publishes a fresh snapshot to the config store.
+func (s *Store) persistLocked() {
+	snapshot := make(map[string]any, len(s.items))
+	for name, item := range s.items {
+		snapshot[name] = copyItem(item)
+	}
+	s.cfg.Set("secrets", snapshot)
+}
+
+// loadRingLocked reads the key file, creating it only while there is
+// nothing it would have to open: a missing key next to stored secrets is an
+// error, never a reason to start over.
+func (s *Store) loadRingLocked() error {
+	if s.ring != nil {
+		return nil
+	}
+	data, err := os.ReadFile(s.keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if len(s.items) > 0 {
+			return errors.New(__("Secrets key file %s is missing. Restore it from a backup to read the stored secrets.", s.keyPath))
+		}
+		ring := &keyring{Keys: map[string]string{}}
+		if err := ring.add(); err != nil {
+			return err
+		}
+		if err := s.writeRing(ring); err != nil {
+			return err
+		}
+		s.ring = ring
+		s.log.Log("Created secrets key %s", s.keyPath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var ring keyring
+	if err := json.Unmarshal(data, &ring); err != nil || ring.Keys[ring.Current] == "" {
+		return errors.New(__("Secrets key file %s is corrupt.", s.keyPath))
+	}
+	s.ring = &ring
+	return nil
+}
+
+// add generates a key and makes it current.
+func (r *keyring) add() error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	next := 1
+	for id := range r.Keys {
+		if n, err := strconv.Atoi(strings.TrimPrefix(id, "k")); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	r.Current = "k" + strconv.Itoa(next)
+	r.Keys[r.Current] = base64.StdEncoding.EncodeToString(key)
+	return nil
+}
+
+func (s *Store) writeRing(ring *keyring) error {
+	if err := os.MkdirAll(filepath.Dir(s.keyPath), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(ring)
+	if err != nil {
+		return err
+	}
+	tmp := s.keyPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.keyPath)
+}
+
+func (r *keyring) aead(id string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(r.Keys[id])
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("unknown key %s", id)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts value as "<keyID>:<base64(nonce|ciphertext)>". The name is
+// bound as associated data, so a value cannot be moved to another name.
+func (r *keyring) seal(name, value string) (string, error) {
+	gcm, err := r.aead(r.Current)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+	return r.Current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (r *keyring) open(name, stored string) (string, error) {
+	id, data, ok := strings.Cut(stored, ":")
+	if !ok {
+		return "", errors.New("malformed value")
+	}
+	gcm, err := r.aead(id)
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return "", errors.New("malformed value")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// Set stores or replaces a secret.
+func (s *Store) Set(nameArg, valueArg any) api.Result {
+	name, _ := nameArg.(string)
+	value, _ := valueArg.(string)
+	if !nameRE.MatchString(name) {
+		return api.Res(false, __("Invalid secret name. Use letters, digits, '.', '_' or '-'."))
+	}
+	if value == "" {
+		return api.Res(false, __("Secret value is required."))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadRingLocked(); err != nil {
+		return api.Res(false, err.Error())
+	}
+	sealed, err := s.ring.seal(name, value)
+	if err != nil {
+		return api.Res(false, err.Error())
+	}
+	now := float64(time.Now().UnixMilli())
+	item := s.items[name]
+	if item == nil {
+		item = map[string]any{"created": now}
+		s.items[name] = item
+	}
+	item["value"] = sealed
+	item["updated"] = now
+	s.persistLocked()
+	s.log.Log("Secret %s saved", name)
+	return api.Res(true, __("Secret %s saved. Restart the apps that use it to apply.", name))
+}
+
+// Delete removes a secret. Apps that still reference it start without it.
+func (s *Store) Delete(nameArg any) api.Result {
+	name, _ := nameArg.(string)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[name]; !ok {
+		return api.Res(false, __("Secret %s not found.", name))
+	}
+	delete(s.items, name)
+	s.persistLocked()
+	s.log.Log("Secret %s deleted", name)
+	return api.Res(true, __("Secret %s deleted.", name))
+}
+
+// List returns the secret names with their timestamps. Values are never
+// returned.
+func (s *Store) List() api.Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.items))
+	for name := range s.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make([]any, len(names))
+	for i, name := range names {
+		item := s.items[name]
+		rows[i] = map[string]any{"name": name, "created": item["created"], "updated": item["updated"]}
+	}
+	return api.Res(true, rows)
+}
+
+// Rotate re-encrypts every secret under a new host key. The old keys stay in
+// the key file until the re-encrypted values are on disk, so a crash at any
+// point leaves every value readable.
+func (s *Store) Rotate() api.Result {
+	current, err := s.reseal()
+	if err != nil {
+		return api.Res(false, err.Error())
+	}
+
+	// Saved without s.mu: SaveDirty takes the config value lock, and a
+	// container start holds that lock while it calls Reveal.
+	if err := s.cfg.SaveDirty(); err != nil {
+		s.log.Error("Rotated secrets not saved yet, keeping old keys: %s", err.Error())
+		return api.Res(false, __("Secrets were re-encrypted but could not be saved: %s", err.Error()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ring.Current == current {
+		ring := &keyring{Current: current, Keys: map[string]string{current: s.ring.Keys[current]}}
+		if err := s.writeRing(ring); err != nil {
+			s.log.Error("Could not drop old secrets keys: %s", err.Error())
+		} else {
+			s.ring = ring
+		}
+	}
+	s.log.Log("Secrets key rotated to %s", current)
+	return api.Res(true, __("Secrets key rotated."))
+}
+
+// reseal adds a key and re-encrypts every value with it, returning the new
+// key's id.
+func (s *Store) reseal() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadRingLocked(); err != nil {
+		return "", err
+	}
+
+	plain := make(map[string]string, len(s.items))
+	for name, item := range s.items {
+		value, err := s.ring.open(name, fmt.Sprint(item["value"]))
+		if err != nil {
+			return "", errors.New(__("Cannot decrypt secret %s: %s", name, err.Error()))
+		}
+		plain[name] = value
+	}
+
+	ring := &keyring{Keys: map[string]string{}}
+	for id, key := range s.ring.Keys {
+		ring.Keys[id] = key
+	}
+	if err := ring.add(); err != nil {
+		return "", err
+	}
+	if err := s.writeRing(ring); err != nil {
+		return "", err
+	}
+	s.ring = ring
+
+	for name, value := range plain {
+		sealed, err := ring.seal(name, value)
+		if err != nil {
+			return "", err
+		}
+		s.items[name]["value"] = sealed
+	}
+	s.persistLocked()
+	return ring.Current, nil
+}
+
+// Reveal decrypts a secret for a container start.
+func (s *Store) Reveal(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	if err := s.loadRingLocked(); err != nil {
+		return "", err
+	}
+	return s.ring.open(name, fmt.Sprint(item["value"]))
+}
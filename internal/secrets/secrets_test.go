@@ -0,0 +1,161 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"odac/internal/config"
+)
+
+func openStore(t *testing.T, base string) (*config.Store, *Store) {
+	t.Helper()
+	cfg, err := config.Open(base)
+	if err != nil {
+		t.Fatalf("config.Open: %v", err)
+	}
+	return cfg, New(cfg)
+}
+
+// dirContains reports whether any file under dir holds needle.
+func dirContains(dir, needle string) bool {
+	found := false
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if data, _ := os.ReadFile(path); strings.Contains(string(data), needle) {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+func TestSetRevealPersists(t *testing.T) {
+	base := t.TempDir()
+	cfg, s := openStore(t, base)
+
+	if r := s.Set("db-password", "hunter2-plaintext"); !r.Status {
+		t.Fatalf("set: %v", r.Message)
+	}
+	if err := cfg.SaveDirty(); err != nil {
+		t.Fatal(err)
+	}
+	if dirContains(filepath.Join(base, "config"), "hunter2-plaintext") {
+		t.Fatal("plaintext written to the config directory")
+	}
+	info, err := os.Stat(filepath.Join(base, "keys", "secrets.key"))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file: %v %v", info, err)
+	}
+
+	_, s = openStore(t, base)
+	if v, err := s.Reveal("db-password"); err != nil || v != "hunter2-plaintext" {
+		t.Fatalf("reveal after reload = %q, %v", v, err)
+	}
+	rows, _ := s.List().Data.([]any)
+	if len(rows) != 1 || strings.Contains(fmt.Sprint(rows), "hunter2") {
+		t.Fatalf("list = %v", rows)
+	}
+
+	if r := s.Delete("db-password"); !r.Status {
+		t.Fatalf("delete: %v", r.Message)
+	}
+	if _, err := s.Reveal("db-password"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("reveal after delete: %v", err)
+	}
+}
+
+func TestSetRejects(t *testing.T) {
+	_, s := openStore(t, t.TempDir())
+	for _, name := range []string{"", "../x", "a/b", ".hidden", strings.Repeat("a", 129)} {
+		if r := s.Set(name, "v"); r.Status {
+			t.Errorf("name %q accepted", name)
+		}
+	}
+	if r := s.Set("empty", ""); r.Status {
+		t.Error("empty value accepted")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	base := t.TempDir()
+	cfg, s := openStore(t, base)
+	s.Set("a", "alpha")
+	s.Set("b", "beta")
+	cfg.SaveDirty()
+	before, _ := os.ReadFile(s.keyPath)
+
+	if r := s.Rotate(); !r.Status {
+		t.Fatalf("rotate: %v", r.Message)
+	}
+	after, _ := os.ReadFile(s.keyPath)
+	if string(after) == string(before) || s.ring.Current != "k2" || len(s.ring.Keys) != 1 {
+		t.Fatalf("ring after rotate = %+v", s.ring)
+	}
+
+	_, s = openStore(t, base)
+	for name, want := range map[string]string{"a": "alpha", "b": "beta"} {
+		if v, err := s.Reveal(name); err != nil || v != want {
+			t.Errorf("%s = %q, %v", name, v, err)
+		}
+	}
+}
+
+func TestRotateUnsaved(t *testing.T) {
+	base := t.TempDir()
+	cfg, s := openStore(t, base)
+	s.Set("a", "alpha")
+	cfg.SaveDirty()
+	// A directory in the temp file's place fails the write even as root.
+	if err := os.Mkdir(filepath.Join(base, "config", "secret.json.tmp"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := s.Rotate(); r.Status {
+		t.Fatal("rotate reported success without saving")
+	}
+	// The old key stays until the values sealed with the new one are saved.
+	if len(s.ring.Keys) != 2 {
+		t.Fatalf("ring after unsaved rotate = %+v", s.ring)
+	}
+	if v, err := s.Reveal("a"); err != nil || v != "alpha" {
+		t.Fatalf("reveal = %q, %v", v, err)
+	}
+}
+
+func TestMissingKeyFile(t *testing.T) {
+	base := t.TempDir()
+	cfg, s := openStore(t, base)
+	s.Set("a", "alpha")
+	cfg.SaveDirty()
+	os.Remove(s.keyPath)
+
+	// Stored secrets without their key must never mint a fresh one.
+	_, s = openStore(t, base)
+	if _, err := s.Reveal("a"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("reveal without key: %v", err)
+	}
+	if r := s.Set("b", "beta"); r.Status {
+		t.Fatal("set succeeded without the key file")
+	}
+	if _, err := os.Stat(s.keyPath); !os.IsNotExist(err) {
+		t.Fatal("a new key file was created")
+	}
+}
+
+func TestValueBoundToName(t *testing.T) {
+	_, s := openStore(t, t.TempDir())
+	s.Set("a", "alpha")
+	s.Set("b", "beta")
+
+	// Swapping ciphertexts between names must not decrypt.
+	s.items["a"]["value"], s.items["b"]["value"] = s.items["b"]["value"], s.items["a"]["value"]
+	if _, err := s.Reveal("a"); err == nil {
+		t.Fatal("moved ciphertext decrypted under another name")
+	}
+}
@@ -109,10 +109,20 @@ func (i *Info) networkUsage() jscanon.Obj {
 	)
 }
 
+// cpuBaseline is the previous CPU sample of one caller.
+type cpuBaseline struct {
+	idle, total int64
+	ok          bool
+}
+
 // cpuUsage ports getCpuUsage(): the busy percentage between this sample and
 // the previous one. The first call (or any unreadable/rolled-back counter)
 // reports 0, exactly like Node's guard.
 func (i *Info) cpuUsage() int {
+	return i.cpuBusy(&i.statsCPU)
+}
+
+func (i *Info) cpuBusy(last *cpuBaseline) int {
 	idle, total, ok := cpuTicksFn()
 	if !ok {
 		return 0
@@ -121,14 +131,14 @@ func (i *Info) cpuUsage() int {
 	i.cpuMu.Lock()
 	defer i.cpuMu.Unlock()
 
-	if !i.hasCPU {
-		i.lastIdle, i.lastTotal, i.hasCPU = idle, total, true
+	if !last.ok {
+		*last = cpuBaseline{idle: idle, total: total, ok: true}
 		return 0
 	}
 
-	idleDiff := idle - i.lastIdle
-	totalDiff := total - i.lastTotal
-	i.lastIdle, i.lastTotal = idle, total
+	idleDiff := idle - last.idle
+	totalDiff := total - last.total
+	last.idle, last.total = idle, total
 
 	if idleDiff < 0 || totalDiff <= 0 {
 		return 0
@@ -144,3 +154,29 @@ func (i *Info) cpuUsage() int {
 	}
 	return usage
 }
+
+// Usage is host utilization in whole percent, for threshold checks.
+type Usage struct {
+	CPU, Memory, Disk, Swap int
+}
+
+// Usage samples the host. CPU is the busy share since the previous Usage
+// call (0 on the first); the rest are used/total as in Stats.
+func (i *Info) Usage() Usage {
+	totalKB, _, availKB := memoryKB()
+	diskTotal, diskFree := diskBytes()
+	swapTotalKB, swapFreeKB := swapKB()
+	return Usage{
+		CPU:    i.cpuBusy(&i.usageCPU),
+		Memory: percent(totalKB-availKB, totalKB),
+		Disk:   percent(diskTotal-diskFree, diskTotal),
+		Swap:   percent(swapTotalKB-swapFreeKB, swapTotalKB),
+	}
+}
+
+func percent(used, total int64) int {
+	if total <= 0 || used <= 0 {
+		return 0
+	}
+	return int(min(used*100/total, 100))
+}
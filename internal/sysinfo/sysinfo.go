@@ -51,10 +51,11 @@ type Info struct {
 	// kept #lastCpuStats across calls); Stats() runs on the Hub's interval,
 	// so consecutive polls yield the busy fraction of that window. The first
 	// sample has no baseline and reports 0.
-	cpuMu     sync.Mutex
-	lastIdle  int64
-	lastTotal int64
-	hasCPU    bool
+	// Usage keeps a baseline of its own so its callers do not shorten the
+	// Hub's window.
+	cpuMu    sync.Mutex
+	statsCPU cpuBaseline
+	usageCPU cpuBaseline
 
 	// Network bandwidth is a byte-delta divided by the elapsed window (Node's
 	// getNetworkUsage kept #lastNetworkStats/#lastNetworkTime). Same
@@ -242,6 +242,27 @@ func TestCpuUsageDelta(t *testing.T) {
 	}
 }
 
+func TestUsageKeepsItsOwnCPUBaseline(t *testing.T) {
+	orig := cpuTicksFn
+	var idle, total int64
+	cpuTicksFn = func() (int64, int64, bool) { return idle, total, true }
+	defer func() { cpuTicksFn = orig }()
+
+	i := &Info{}
+	idle, total = 100, 200
+	i.cpuUsage()
+	i.Usage()
+
+	idle, total = 110, 300
+	if got := i.Usage().CPU; got != 90 {
+		t.Errorf("usage = %d, want 90", got)
+	}
+	// The Stats baseline was not moved by Usage.
+	if got := i.cpuUsage(); got != 90 {
+		t.Errorf("stats = %d, want 90", got)
+	}
+}
+
 // TestNetworkUsageDelta covers Node's getNetworkUsage guards: first sample is
 // 0/0, a normal window divides the byte delta by elapsed seconds (rounded),
 // and a rolled-back counter yields 0/0 while re-baselining.
@@ -41,6 +41,10 @@ type decision struct {
 	reason string
 }
 
+// ceilingReason is the hold reason when growth is wanted but capped; the
+// pressure alert calls it out.
+const ceilingReason = "grow wanted but disk/increment ceiling"
+
 // counters carry the consecutive-tick streaks across decide calls so a single
 // spike never triggers action — the condition must be sustained.
 type counters struct {
@@ -79,7 +83,7 @@ func decide(s snapshot, cfg Config, st *counters) decision {
 			}
 			return decision{action: grow, size: size, reason: reason}
 		}
-		return decision{action: hold, reason: "grow wanted but disk/increment ceiling"}
+		return decision{action: hold, reason: ceilingReason}
 	}
 	st.growStreak = 0
 
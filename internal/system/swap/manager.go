@@ -21,16 +21,22 @@ const checkGate = 30 * time.Second
 // counters and the gate clock, so a restart re-discovers existing increments
 // from /proc/swaps on the next tick (idempotent — no separate reconcile needed).
 type Manager struct {
-	cfg *config.Store
-	ctl controller
-	log *logx.Logger
-	st  counters
+	cfg     *config.Store
+	ctl     controller
+	log     *logx.Logger
+	st      counters
+	alerter Alerter
 
 	now     func() time.Time // seam for tests
 	gate    time.Duration
 	lastRun time.Time
 }
 
+// Alerter receives the memory pressure gauge; *alert.Alerter implements it.
+type Alerter interface {
+	Alert(kind, subject, message string, value float64)
+}
+
 // New builds the swap Manager. On non-Linux hosts the controller is a no-op and
 // snapshots are never ok, so Check holds forever — safe to wire unconditionally.
 func New(cfg *config.Store) *Manager {
@@ -43,6 +49,9 @@ func New(cfg *config.Store) *Manager {
 	}
 }
 
+// SetAlerter wires the pressure gauge. Call it before the first Check.
+func (m *Manager) SetAlerter(a Alerter) { m.alerter = a }
+
 // Check is the Checker entry point invoked by the orchestrator's tick. It
 // self-gates to the check interval, then runs one decide→enact cycle.
 func (m *Manager) Check() {
@@ -55,7 +64,22 @@ func (m *Manager) Check() {
 	cfg := m.loadConfig()
 	dir := m.swapDir(cfg)
 	s := m.sync(cfg, dir)
-	m.enact(decide(s, cfg, &m.st), s, cfg, dir)
+	d := decide(s, cfg, &m.st)
+	m.enact(d, s, cfg, dir)
+	m.report(d, s)
+}
+
+// report feeds the pool fill to the alerter once per gated cycle, so the
+// alert resolves as soon as pressure drops.
+func (m *Manager) report(d decision, s snapshot) {
+	if m.alerter == nil || !s.ok {
+		return
+	}
+	msg := fmt.Sprintf("Memory pool is %d%% full (%s).", poolFillPct(s), context(s))
+	if d.reason == ceilingReason {
+		msg += " Swap cannot grow any further."
+	}
+	m.alerter.Alert("swap.pressure", "swap", msg, float64(poolFillPct(s)))
 }
 
 // Restore reattaches the swap left on disk by the previous boot. Init calls it
@@ -1,6 +1,7 @@
 package swap
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -231,3 +232,32 @@ type testErr struct{}
 func (testErr) Error() string { return "boom" }
 
 var errTest = testErr{}
+
+type fakeAlerter struct {
+	kinds  []string
+	values []float64
+	msgs   []string
+}
+
+func (f *fakeAlerter) Alert(kind, _, message string, value float64) {
+	f.kinds = append(f.kinds, kind)
+	f.values = append(f.values, value)
+	f.msgs = append(f.msgs, message)
+}
+
+func TestManagerReportsPoolPressure(t *testing.T) {
+	m := newTestManager(t, &fakeController{})
+	alerts := &fakeAlerter{}
+	m.SetAlerter(alerts)
+
+	s := snapshot{memTotal: 4 * gib, memAvail: 200 * mib, ok: true}
+	m.report(decision{action: hold, reason: ceilingReason}, s)
+	m.report(decision{action: hold}, snapshot{})
+
+	if len(alerts.kinds) != 1 || alerts.kinds[0] != "swap.pressure" || alerts.values[0] != float64(poolFillPct(s)) {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+	if !strings.Contains(alerts.msgs[0], "cannot grow") {
+		t.Errorf("message = %q", alerts.msgs[0])
+	}
+}
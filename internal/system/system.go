@@ -64,6 +64,8 @@ type Services struct {
 	Api   StartStopper     // 3.3
 	Hub   StartStopChecker // 3.6
 	Swap  RestoreChecker   // elastic host-swap manager (Linux-only at runtime)
+
+	Firewall Checker // shared ban collection across proxy/mail/dns
 }
 
 // Updater gates service startup: Init may block for the update handshake;
@@ -203,6 +205,7 @@ func (s *System) startTick() {
 				check(s.svc.Mail)
 				check(s.svc.Hub)
 				check(s.svc.Swap)
+				check(s.svc.Firewall)
 			}
 		}
 	}()
@@ -103,6 +103,8 @@ type Watchdog struct {
 
 	// Test seam; production value is stopSupervised.
 	reap func(pid int)
+
+	giveUpHook func(message string)
 }
 
 // New creates a watchdog that runs serverCmd (argv form) as its supervised
@@ -124,6 +126,10 @@ func New(cfg *config.Store, serverCmd []string) *Watchdog {
 	}
 }
 
+// SetGiveUpHook registers fn to run, with a description, when the restart
+// budget is exhausted and just before the watchdog exits.
+func (w *Watchdog) SetGiveUpHook(fn func(message string)) { w.giveUpHook = fn }
+
 // Run supervises the server until it exits cleanly (code 0) or exhausts the
 // restart budget. Never returns: it terminates the process via os.Exit.
 func (w *Watchdog) Run() {
@@ -158,6 +164,10 @@ func (w *Watchdog) Run() {
 
 		if !w.registerCrash(time.Now()) {
 			fmt.Fprintln(os.Stderr, "Server has crashed too many times. Not restarting.")
+			if w.giveUpHook != nil {
+				w.giveUpHook(fmt.Sprintf("The server crashed %d times within %s (last exit code %d). The watchdog stopped restarting it.",
+					w.restartCount, restartWindow, code))
+			}
 			w.shutdown(1)
 		}
 		fmt.Println("Server process closed. Restarting...")